@@ -1,37 +1,55 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"io"
 	"log"
 	"myDB/client/cli_core"
-	"net"
 	"os"
+	"strings"
 )
 
+// 用法: cli <addr>[,<addr>...]
+// 多个地址时连接其中的主库, 主库故障时自动切换到新的主库(见cli_core/cluster.go)
+
 func main() {
 	log.Println("Client start..")
 	if len(os.Args) < 2 {
 		log.Println("Invalid tcp server address")
 		return
 	}
-	serverAddr := os.Args[1]
-	conn, err := net.Dial("tcp", serverAddr)
-	if err != nil {
+	cluster := cli_core.NewCluster(os.Args[1], cli_core.DefaultFailoverTimeout)
+	defer cluster.Close()
+	// listen订阅的通知由读协程输出; 故障转移之后需要重新listen
+	cluster.OnPush(func(reply *cli_core.Reply) {
+		reply.Print()
+	})
+	if err := cluster.Connect(); err != nil {
 		log.Printf("[ERROR] Connection errer:%s\n", err)
 		return
 	}
-	log.Printf("Connection to server %s success!\n", serverAddr)
-	// 阻塞通道
-	stop := make(chan error)
-	go cli_core.StartReader(conn, stop)
-	go cli_core.StartWriter(conn, stop)
-	select {
-	case err = <-stop:
-		if errors.Is(err, io.EOF) {
+	log.Printf("Connection to server %s success!\n", cluster.Primary())
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		bytes, _, err := reader.ReadLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				log.Printf("See you next time\n")
+			} else {
+				log.Printf("[ERROR] Fatel error:%s\n", err)
+			}
+			return
+		}
+		reply, err := cluster.Execute(strings.Split(string(bytes), " "))
+		if err != nil {
+			log.Printf("[ERROR] %s\n", err)
+			continue
+		}
+		reply.Print()
+		if strings.ToUpper(string(bytes)) == "QUIT" {
 			log.Printf("See you next time\n")
-		} else {
-			log.Printf("[ERROR] Fatel error:%s\n", err)
+			return
 		}
 	}
 }
@@ -0,0 +1,271 @@
+package cli_core
+
+import (
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 集群客户端
+// 接受多个服务器地址(逗号分隔), 依次向每个服务器发送ROLE, 连接角色为primary的服务器(主库); 不需要额外的代理
+// 请求与回复一一对应: 发送一条语句之后等待它的回复
+// 每个连接由一个读协程解析服务器的消息: 回复交给等待的语句, 推送的通知(PUSH, 见listen)交给OnPush; 故障转移之后在新的连接上重新启动
+// 订阅(listen)属于连接, 故障转移之后需要重新listen
+// 连接断开或者服务器回复不是主库(ErrorNotPrimary)时重新寻找主库:
+// 从上一个主库开始依次尝试所有地址, 都不是主库时等待FailoverRetryInterval之后重试, 超过故障转移的超时时间返回ErrorNoPrimary
+// 每次请求的读写都有截止时间(故障转移的超时时间), 超时的主库(例如挂起)与连接断开同样处理
+// 重试: 只读的语句(select, show, role)在新的主库上自动重试; 服务器拒绝执行(不是主库)的语句没有执行, 同样重试
+// 其他语句在连接断开时可能已经执行, 返回ErrorFailover由调用者决定是否重试
+// 事务中发生故障转移时事务在旧的主库上回滚, 任何语句都不重试, 返回ErrorFailover, 之后的语句在新的事务中执行
+
+const (
+	DefaultFailoverTimeout = 10 * time.Second
+	FailoverRetryInterval  = 200 * time.Millisecond
+	DialTimeout            = time.Second
+	RolePrimary            = "primary"
+	NotPrimary             = "Not the primary server" // 与服务器的ErrorNotPrimary相同
+)
+
+type ErrorNoPrimary struct{}
+type ErrorFailover struct{}
+
+func (err *ErrorNoPrimary) Error() string {
+	return "No primary server is available"
+}
+
+func (err *ErrorFailover) Error() string {
+	return "Connection to the primary is lost, the statement may or may not have been executed"
+}
+
+// Reply 服务器的一条回复
+type Reply struct {
+	Type   ReType
+	Values []string
+}
+
+func (reply *Reply) IsError() bool {
+	return reply.Type == ERROR
+}
+
+func (reply *Reply) notPrimary() bool {
+	return reply.IsError() && len(reply.Values) > 0 && strings.Contains(reply.Values[0], NotPrimary)
+}
+
+// printLock 读协程输出推送的通知, 与语句的回复串行输出
+var printLock sync.Mutex
+
+// Print 与StartReader相同的格式输出
+func (reply *Reply) Print() {
+	printLock.Lock()
+	defer printLock.Unlock()
+	pack := NewPack()
+	pack.isQuerying, pack.output, pack.readyToOutput = reply.Type, reply.Values, true
+	pack.doFmtOutput()
+}
+
+type Cluster struct {
+	endpoints []string
+	timeout   time.Duration // 故障转移的超时时间
+	conn      net.Conn
+	replies   chan *Reply // 当前连接上的回复, 连接断开时由读协程关闭
+	current   int         // 当前(或者上一个)主库的下标
+	inTrans   bool        // 是否在显式开启的事务中
+	onPush    func(reply *Reply)
+}
+
+// NewCluster addrs为逗号分隔的服务器地址, 第一次执行语句时连接主库
+func NewCluster(addrs string, timeout time.Duration) *Cluster {
+	if timeout <= 0 {
+		timeout = DefaultFailoverTimeout
+	}
+	endpoints := make([]string, 0)
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			endpoints = append(endpoints, addr)
+		}
+	}
+	return &Cluster{endpoints: endpoints, timeout: timeout}
+}
+
+// OnPush 设置推送的通知的处理函数, 在读协程中调用; 需要在连接之前设置
+func (c *Cluster) OnPush(fn func(reply *Reply)) {
+	c.onPush = fn
+}
+
+// Primary 当前连接的主库, 没有连接时为空
+func (c *Cluster) Primary() string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.endpoints[c.current]
+}
+
+// Connect 寻找主库并连接
+func (c *Cluster) Connect() error {
+	c.close()
+	deadline := time.Now().Add(c.timeout)
+	for len(c.endpoints) > 0 {
+		for i := 0; i < len(c.endpoints); i++ {
+			n := (c.current + i) % len(c.endpoints)
+			if c.tryPrimary(n) {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(FailoverRetryInterval)
+	}
+	return &ErrorNoPrimary{}
+}
+
+// tryPrimary 连接第n个地址, 是主库时保持连接
+func (c *Cluster) tryPrimary(n int) bool {
+	conn, err := net.DialTimeout("tcp", c.endpoints[n], DialTimeout)
+	if err != nil {
+		return false
+	}
+	c.conn, c.replies = conn, make(chan *Reply, 1)
+	go c.startReader(conn, c.replies)
+	reply, err := c.roundTrip([]string{"ROLE"})
+	if err != nil || reply.Type != STRING || len(reply.Values) == 0 || reply.Values[0] != RolePrimary {
+		c.close()
+		return false
+	}
+	c.current = n
+	log.Printf("[Client] Connected to primary %s\n", c.endpoints[n])
+	return true
+}
+
+// Execute 在主库上执行一条语句, 故障转移时按照重试规则重试
+func (c *Cluster) Execute(args []string) (*Reply, error) {
+	deadline := time.Now().Add(c.timeout)
+	for {
+		if c.conn == nil {
+			if err := c.Connect(); err != nil {
+				return nil, err
+			}
+		}
+		reply, err := c.roundTrip(args)
+		if err == nil && !reply.notPrimary() {
+			c.track(args, reply)
+			return reply, nil
+		}
+		log.Printf("[Client] Primary %s is unavailable, failover\n", c.endpoints[c.current])
+		c.close()
+		inTrans := c.inTrans
+		c.inTrans = false
+		// 服务器拒绝的语句没有执行
+		if inTrans || (err != nil && !isReadOnly(args)) {
+			return nil, &ErrorFailover{}
+		}
+		if time.Now().After(deadline) {
+			return nil, &ErrorNoPrimary{}
+		}
+	}
+}
+
+// track 跟踪显式事务, 服务器遇到错误时回滚当前事务
+func (c *Cluster) track(args []string, reply *Reply) {
+	command := ""
+	if len(args) == 1 {
+		command = strings.ToUpper(args[0])
+	}
+	switch {
+	case reply.IsError() || command == "COMMIT" || command == "ABORT":
+		c.inTrans = false
+	case command == "BEGIN":
+		c.inTrans = true
+	case command == "QUIT":
+		c.inTrans = false
+		c.close()
+	}
+}
+
+func (c *Cluster) Close() {
+	c.close()
+	c.inTrans = false
+}
+
+func (c *Cluster) close() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// roundTrip 发送请求并等待一条回复, 超过c.timeout返回os.ErrDeadlineExceeded
+// 收到回复之后清除截止时间, 空闲的连接上读协程继续等待推送的通知
+func (c *Cluster) roundTrip(args []string) (*Reply, error) {
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+	send := []byte(packBulkArray(args))
+	for index := 0; index < len(send); {
+		n, err := c.conn.Write(send[index:])
+		if err != nil {
+			return nil, err
+		}
+		index += n
+	}
+	select {
+	case reply, ok := <-c.replies:
+		if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		_ = c.conn.SetDeadline(time.Time{})
+		return reply, nil
+	case <-timer.C:
+		return nil, os.ErrDeadlineExceeded
+	}
+}
+
+// startReader 解析一个连接上的消息, 连接断开时关闭replies
+func (c *Cluster) startReader(conn net.Conn, replies chan *Reply) {
+	defer close(replies)
+	pack := NewPack()
+	buffer := make([]byte, 1<<16)
+	length := 0
+	for {
+		if len(buffer)-length < MaxMessageSize {
+			buffer = append(buffer, make([]byte, MaxMessageSize)...)
+		}
+		n, err := conn.Read(buffer[length:])
+		if err != nil {
+			return
+		}
+		length += n
+		for length > 0 {
+			x := resolve(buffer, length, pack)
+			length -= x
+			buffer = buffer[x:]
+			if pack.readyToOutput {
+				reply := &Reply{Type: pack.isQuerying, Values: pack.output}
+				pack.reset()
+				if reply.Type != PUSH {
+					replies <- reply
+				} else if c.onPush != nil {
+					c.onPush(reply)
+				}
+			} else if x == 0 {
+				break
+			}
+		}
+	}
+}
+
+// isReadOnly 可以在新的主库上安全重试的语句
+func isReadOnly(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch strings.ToUpper(args[0]) {
+	case "SELECT", "SHOW", "ROLE":
+		return true
+	}
+	return false
+}
@@ -27,6 +27,7 @@ const (
 	INT     ReType = 3
 	BULKSTR ReType = 4
 	BULKARR ReType = 5
+	PUSH    ReType = 6 // 服务器推送的通知, 格式与BULKARR相同
 )
 
 var typeMap map[rune]ReType
@@ -39,6 +40,7 @@ func init() {
 	typeMap[':'] = INT
 	typeMap['$'] = BULKSTR
 	typeMap['*'] = BULKARR
+	typeMap['>'] = PUSH
 
 	funcMap = make(map[ReType]resolveFunction, 0)
 	funcMap[STRING] = resolveStr
@@ -46,6 +48,7 @@ func init() {
 	funcMap[INT] = resolveStr
 	funcMap[BULKSTR] = resolveBulkStr
 	funcMap[BULKARR] = resolveBulkArr
+	funcMap[PUSH] = resolveBulkArr
 }
 
 type Pack struct {
@@ -78,7 +81,7 @@ func (pack *Pack) reset() {
 func (pack *Pack) doFmtOutput() {
 	if pack.readyToOutput {
 		defer pack.reset()
-		if pack.isQuerying == BULKARR {
+		if pack.isQuerying == BULKARR || pack.isQuerying == PUSH {
 			row, err1 := strconv.Atoi(pack.output[0])
 			col, err2 := strconv.Atoi(pack.output[1])
 			if err1 != nil || err2 != nil {
@@ -150,7 +153,7 @@ func StartReader(conn net.Conn, stop chan error) {
 				break
 			}
 			length -= x
-			byteBuffer = append(byteBuffer[x:])
+			byteBuffer = byteBuffer[x:]
 			if pack.readyToOutput {
 				pack.doFmtOutput()
 			}
@@ -0,0 +1,498 @@
+package dataManager
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 在线物理备份
+// 全量备份拷贝所有表空间的数据文件以及数据库的其他文件; 增量备份只拷贝上一次备份(基准)之后写回数据文件的页
+// 变化的页: 每个表空间上一次备份之后写回数据文件的页的位图, 见changedPages.go
+// 新建, 挂载以及崩溃之后清空的表空间在下一次备份中整体拷贝; 没有记录时(第一次备份之前或.chg丢失)只能进行全量备份
+// 增量备份的基准必须是最近一次备份, 否则返回ErrorBackupBase
+// 拷贝顺序: 数据文件(逐个表空间持有页表的写锁, 期间该表空间的页读写等待) -> 事物状态等其他文件 -> redo log(持有日志的锁) -> 上层的日志(undo log)
+// 备份不是某一时刻的数据文件, 恢复(RestoreBackup)之后打开数据库时按崩溃恢复处理: 重做备份中的redo log里已提交的修改, 撤销未提交的修改
+// 追加写入的文件(redo log, undo log)在内容没有变化时增量备份只拷贝追加的部分, redo log在重启时重置, 重启之后拷贝整个文件
+// 备份目录中的backup.json最后写入, 没有backup.json的目录是不完整的备份
+
+const (
+	BackupManifest string = "backup.json"
+	ChangedSuffix  string = ".chg"
+)
+
+type ErrorBackupBase struct{}
+type ErrorBackupExists struct{}
+
+func (err *ErrorBackupBase) Error() string {
+	return "Base backup isn't the latest backup of this database, take a full backup"
+}
+
+func (err *ErrorBackupExists) Error() string {
+	return "Backup directory already contains a backup"
+}
+
+// BackupStats 一次备份的结果
+type BackupStats struct {
+	Id    string
+	Base  string // 增量备份的基准, 全量备份为空
+	Lsn   int64  // 拷贝redo log时已经刷盘的LSN
+	Pages int64  // 拷贝的数据页数
+	Bytes int64  // 备份的字节数
+}
+
+// backupManifest 备份目录中的backup.json
+type backupManifest struct {
+	Id     string
+	Base   string
+	Run    string // redo log所属的运行(每次启动重置日志)
+	Lsn    int64
+	Spaces map[int64]*spaceBackup
+	Files  map[string]*fileBackup // 文件名相对于数据库路径的后缀
+}
+
+// spaceBackup Whole时备份文件为数据文件的拷贝, 否则为变化的页: [pageId]8[page]PageSize ...
+// PageSize为0时是旧版本的备份, 页大小为8K
+type spaceBackup struct {
+	Pages    int64
+	Whole    bool
+	Changed  int64
+	PageSize int64 `json:",omitempty"`
+}
+
+func (sb *spaceBackup) pageSize() int64 {
+	if sb.PageSize == 0 {
+		return DefaultPageSize
+	}
+	return sb.PageSize
+}
+
+// fileBackup 备份文件为[0, Head)以及[From, Size)两段, 恢复时[Head, From)保持基准中的内容
+type fileBackup struct {
+	Size int64
+	Head int64
+	From int64
+	Crc  uint32 // [Head, Size)的CRC32
+}
+
+func newBackupId() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Backup 将数据库备份到dir, base不为空时为增量备份, base为基准备份的目录
+// logs为上层在redo log之后追加写入的日志文件
+func (dm *DmImpl) Backup(dir, base string, logs []string) (BackupStats, error) {
+	if dm.readOnly {
+		return BackupStats{}, &ErrorReadOnly{}
+	}
+	c := dm.changes
+	c.backupLock.Lock()
+	defer c.backupLock.Unlock()
+	var prev *backupManifest
+	if base != "" {
+		var err error
+		if prev, err = readBackupManifest(base); err != nil {
+			return BackupStats{}, err
+		}
+		c.lock.Lock()
+		since := c.since
+		c.lock.Unlock()
+		if prev.Id != since {
+			return BackupStats{}, &ErrorBackupBase{}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, BackupManifest)); err == nil {
+		return BackupStats{}, &ErrorBackupExists{}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return BackupStats{}, err
+	}
+	m := &backupManifest{Id: newBackupId(), Run: c.run, Spaces: map[int64]*spaceBackup{}, Files: map[string]*fileBackup{}}
+	if prev != nil {
+		m.Base = prev.Id
+	}
+	stats := BackupStats{Id: m.Id, Base: m.Base}
+
+	// 数据文件
+	dm.spaceLock.RLock()
+	spaces := make([]*TableSpace, 0, len(dm.spaces))
+	for _, ts := range dm.spaces {
+		spaces = append(spaces, ts)
+	}
+	dm.spaceLock.RUnlock()
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].id < spaces[j].id })
+	type taken struct {
+		space int64
+		pages pageBitmap
+		whole bool
+	}
+	takenAll := make([]taken, 0, len(spaces))
+	fail := func(err error) (BackupStats, error) {
+		for _, t := range takenAll {
+			c.giveBack(t.space, t.pages, t.whole)
+		}
+		return BackupStats{}, err
+	}
+	for _, ts := range spaces {
+		ts.tier.lock.Lock()
+		pages, whole := c.take(ts.id)
+		takenAll = append(takenAll, taken{space: ts.id, pages: pages, whole: whole})
+		_, existed := prev.spaceOf(ts.id)
+		sb, err := ts.tier.backupTo(dir, strings.TrimPrefix(ts.file, dm.path), pages, prev == nil || whole || !existed)
+		ts.tier.lock.Unlock()
+		if err != nil {
+			return fail(err)
+		}
+		m.Spaces[ts.id] = sb
+		stats.Pages += sb.Changed
+		if stats.Bytes += sb.Changed * sb.PageSize; !sb.Whole {
+			stats.Bytes += sb.Changed * 8
+		}
+	}
+
+	// 其他文件, redo log, 上层的日志
+	others, err := dm.backupFiles(logs)
+	if err != nil {
+		return fail(err)
+	}
+	copyFiles := func(files []string) error {
+		for _, file := range files {
+			name := strings.TrimPrefix(file, dm.path)
+			fb, err := backupFile(file, filepath.Join(dir, name), 0, -1, prev.fileOf(name))
+			if err != nil {
+				return err
+			}
+			m.Files[name] = fb
+			stats.Bytes += fb.Head + fb.Size - fb.From
+		}
+		return nil
+	}
+	if err := copyFiles(others); err != nil {
+		return fail(err)
+	}
+	err = dm.redo.Backup(func(file *os.File, lsn int64) error {
+		name := strings.TrimPrefix(file.Name(), dm.path)
+		var last *fileBackup
+		if prev != nil && prev.Run == c.run {
+			last = prev.fileOf(name)
+		}
+		fb, err := backupFile(file.Name(), filepath.Join(dir, name), SzCheckSum, lsn, last)
+		if err != nil {
+			return err
+		}
+		m.Files[name], m.Lsn = fb, lsn
+		stats.Bytes += fb.Head + fb.Size - fb.From
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if err := copyFiles(logs); err != nil {
+		return fail(err)
+	}
+	if err := writeJsonFile(filepath.Join(dir, BackupManifest), m); err != nil {
+		return fail(err)
+	}
+	if err := c.save(&m.Id); err != nil {
+		return BackupStats{}, err
+	}
+	stats.Lsn = m.Lsn
+	log.Printf("[Data Manager] Backup %s to %s at lsn %d, %d pages, %d bytes\n", m.Id, dir, m.Lsn, stats.Pages, stats.Bytes)
+	return stats, nil
+}
+
+// backupFiles 数据库目录中除数据文件, redo log以及logs之外的文件
+func (dm *DmImpl) backupFiles(logs []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, pattern := range []string{dm.path + ".*", dm.path + "_*"} {
+		matched, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matched...)
+	}
+	skip := map[string]struct{}{dm.path + LogSuffix: {}}
+	for _, file := range logs {
+		skip[file] = struct{}{}
+	}
+	res := make([]string, 0, len(files))
+	for _, file := range files {
+		if _, ext := skip[file]; ext {
+			continue
+		}
+		if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(file, FileSuffix), strings.HasSuffix(file, TierSuffix),
+			strings.HasSuffix(file, TmpSuffix), strings.HasSuffix(file, ChangedSuffix), strings.HasSuffix(file, DoubleWriteSuffix),
+			strings.HasSuffix(file, ZipSuffix), strings.HasSuffix(file, ZipIndexSuffix), isSegmentFile(file):
+			continue
+		}
+		res = append(res, file)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (m *backupManifest) spaceOf(space int64) (*spaceBackup, bool) {
+	if m == nil {
+		return nil, false
+	}
+	sb, ext := m.Spaces[space]
+	return sb, ext
+}
+
+func (m *backupManifest) fileOf(name string) *fileBackup {
+	if m == nil {
+		return nil
+	}
+	return m.Files[name]
+}
+
+// backupTo 拷贝表空间的数据文件(whole)或者pages中的页, 调用方持有写锁
+func (t *pageTier) backupTo(dir, name string, pages pageBitmap, whole bool) (*spaceBackup, error) {
+	size, err := t.primary.Size()
+	if err != nil {
+		return nil, err
+	}
+	sb := &spaceBackup{Pages: size / t.geo.PageSize, Whole: whole, PageSize: t.geo.PageSize}
+	out, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, t.geo.PageSize)
+	ids := make([]int64, 0)
+	if whole {
+		for pageId := int64(1); pageId <= sb.Pages; pageId++ {
+			ids = append(ids, pageId)
+		}
+	} else {
+		for _, pageId := range pages.pages() {
+			if pageId <= sb.Pages {
+				ids = append(ids, pageId)
+			}
+		}
+	}
+	header := make([]byte, 8)
+	for i, pageId := range ids {
+		offset := (pageId - 1) * t.geo.PageSize
+		if _, err = t.fileAt(offset).ReadAt(buf, offset); err != nil {
+			break
+		}
+		if whole {
+			_, err = out.WriteAt(buf, int64(i)*t.geo.PageSize)
+		} else {
+			binary.BigEndian.PutUint64(header, uint64(pageId))
+			_, err = out.WriteAt(append(header, buf...), int64(i)*(t.geo.PageSize+8))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	sb.Changed = int64(len(ids))
+	return sb, err
+}
+
+// backupFile 拷贝文件的前size字节(size < 0时为整个文件), [0, head)总是拷贝
+// last为基准中的同一个文件, 基准之后只在末尾追加时只拷贝追加的部分
+func backupFile(src, dst string, head, size int64, last *fileBackup) (*fileBackup, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	if size < 0 {
+		stat, err := in.Stat()
+		if err != nil {
+			return nil, err
+		}
+		size = stat.Size()
+	}
+	fb := &fileBackup{Size: size, Head: head, From: head}
+	if head > size {
+		fb.Head, fb.From = size, size
+	}
+	// [Head, Size)的CRC, 同时计算基准长度处的前缀
+	crc := crc32.NewIEEE()
+	if last != nil && last.Head == fb.Head && last.Size <= size {
+		if _, err := io.Copy(crc, io.NewSectionReader(in, fb.Head, last.Size-fb.Head)); err != nil {
+			return nil, err
+		}
+		if crc.Sum32() == last.Crc {
+			fb.From = last.Size
+		}
+		if _, err := io.Copy(crc, io.NewSectionReader(in, last.Size, size-last.Size)); err != nil {
+			return nil, err
+		}
+	} else if _, err := io.Copy(crc, io.NewSectionReader(in, fb.Head, size-fb.Head)); err != nil {
+		return nil, err
+	}
+	fb.Crc = crc.Sum32()
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(out, io.NewSectionReader(in, 0, fb.Head))
+	if err == nil {
+		_, err = io.Copy(out, io.NewSectionReader(in, fb.From, size-fb.From))
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return fb, err
+}
+
+func readBackupManifest(dir string) (*backupManifest, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, BackupManifest))
+	if err != nil {
+		return nil, err
+	}
+	m := &backupManifest{}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RestoreBackup 将全量备份以及之后的增量备份依次恢复到数据库路径path, 之后在path上打开数据库时进行崩溃恢复
+// dirs[0]为全量备份, 之后每个增量备份的基准必须是前一个备份; 恢复之后的数据库需要重新进行全量备份
+func RestoreBackup(path string, dirs ...string) error {
+	manifests := make([]*backupManifest, len(dirs))
+	for i, dir := range dirs {
+		m, err := readBackupManifest(dir)
+		if err != nil {
+			return err
+		}
+		if (i == 0 && m.Base != "") || (i > 0 && m.Base != manifests[i-1].Id) {
+			return &ErrorBackupBase{}
+		}
+		manifests[i] = m
+	}
+	for i, m := range manifests {
+		dir := dirs[i]
+		for space, sb := range m.Spaces {
+			name := strings.TrimPrefix(spaceFile(path, space)+FileSuffix, path)
+			if err := restoreSpace(filepath.Join(dir, name), path+name, sb); err != nil {
+				return err
+			}
+		}
+		for _, space := range listTableSpaces(path) {
+			if _, ext := m.Spaces[space]; !ext {
+				_ = removeDataFile(spaceFile(path, space) + FileSuffix)
+			}
+		}
+		for name, fb := range m.Files {
+			if err := restoreFile(filepath.Join(dir, name), path+name, fb); err != nil {
+				return err
+			}
+		}
+		log.Printf("[Data Manager] Restore backup %s from %s\n", m.Id, dir)
+	}
+	return nil
+}
+
+func restoreSpace(src, dst string, sb *spaceBackup) error {
+	if sb.Whole {
+		// 备份为不分段的文件, 删除已有的段
+		if err := removeDataFile(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return copyFile(src, dst)
+	}
+	in, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	pageSize := sb.pageSize()
+	for i := int64(0); i < sb.Changed; i++ {
+		entry := in[i*(pageSize+8) : (i+1)*(pageSize+8)]
+		pageId := int64(binary.BigEndian.Uint64(entry))
+		if _, err = out.WriteAt(entry[8:], (pageId-1)*pageSize); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = out.Truncate(sb.Pages * pageSize)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func restoreFile(src, dst string, fb *fileBackup) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	if fb.From == fb.Head {
+		err = out.Truncate(0)
+	}
+	if err == nil {
+		err = copyAt(out, 0, io.NewSectionReader(in, 0, fb.Head))
+	}
+	if err == nil {
+		err = copyAt(out, fb.From, io.NewSectionReader(in, fb.Head, fb.Size-fb.From))
+	}
+	if err == nil {
+		err = out.Truncate(fb.Size)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// copyAt 将r中的内容写入out的offset处
+func copyAt(out *os.File, offset int64, r io.Reader) error {
+	buf := make([]byte, 1<<16)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := out.WriteAt(buf[:n], offset); werr != nil {
+				return werr
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package dataManager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log"
+	"myDB/transactions"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 流式在线备份
+// BackupTo将数据库的物理拷贝写入一个io.Writer(管道, 网络连接等), 不需要备份目录, 总是全量备份, 不影响增量备份的变化页记录
+// 快照: 开始时刷盘redo log并记录LSN(StartLsn), 拷贝StartLsn之前的日志; 之后逐个表空间持有页表的写锁拷贝数据文件中的页
+// (带页校验和, 与数据文件中相同, 拷贝时校验), 再拷贝其他文件, 最后追加拷贝期间产生的redo log(StartLsn到EndLsn)以及上层的日志
+// 事物状态文件在持有日志的锁时与EndLsn一起读出: 日志中出现的事物都在其中, 提交状态与EndLsn时刻一致, 相当于在EndLsn时刻崩溃
+// 拷贝期间事物继续执行, 拷贝的页可能只包含并发事物的部分修改; 恢复(RestoreStream)之后打开数据库时按崩溃恢复处理,
+// 重做日志中已提交的修改, 撤销未提交的修改
+// 流格式: [Magic]8[PageSize]8[StartLsn]8, 之后为若干段[Kind]1[NameLength]2[Name][Size]8[Data][Crc]4, Name为文件名相对于数据库路径的后缀,
+// Crc为Data的CRC32; 最后一段为End(Data为[EndLsn]8), 没有End段或者校验失败的流不能恢复
+
+const (
+	BackupStreamMagic  string = "MYDBSTRM"
+	SzBackupStreamHead int64  = 24
+
+	streamSpace byte = 'S' // 表空间的数据文件
+	streamFile  byte = 'F' // 其他文件
+	streamLog   byte = 'L' // redo log中的一段记录, 按顺序拼接
+	streamEnd   byte = 'E'
+)
+
+type ErrorBackupStream struct{}
+type ErrorRestoreExists struct{}
+
+func (err *ErrorBackupStream) Error() string {
+	return "Malformed or truncated backup stream"
+}
+
+func (err *ErrorRestoreExists) Error() string {
+	return "Restore target already contains a database"
+}
+
+// countWriter 统计写入的字节数
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// section 写入一段, fill写入size字节的Data
+func (c *countWriter) section(kind byte, name string, size int64, fill func(w io.Writer) error) error {
+	head := make([]byte, 3+len(name)+8)
+	head[0] = kind
+	binary.BigEndian.PutUint16(head[1:], uint16(len(name)))
+	copy(head[3:], name)
+	binary.BigEndian.PutUint64(head[3+len(name):], uint64(size))
+	if _, err := c.Write(head); err != nil {
+		return err
+	}
+	crc := crc32.NewIEEE()
+	data := &countWriter{w: io.MultiWriter(c, crc)}
+	if err := fill(data); err != nil {
+		return err
+	}
+	if data.n != size {
+		return io.ErrUnexpectedEOF
+	}
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc.Sum32())
+	_, err := c.Write(sum)
+	return err
+}
+
+// fileSection 拷贝文件中[offset, offset + size)的内容
+func (c *countWriter) fileSection(kind byte, name string, file *os.File, offset, size int64) error {
+	return c.section(kind, name, size, func(w io.Writer) error {
+		_, err := io.Copy(w, io.NewSectionReader(file, offset, size))
+		return err
+	})
+}
+
+// BackupTo 将数据库的在线物理拷贝写入w, logs为上层在redo log之后追加写入的日志文件
+func (dm *DmImpl) BackupTo(w io.Writer, logs []string) (BackupStats, error) {
+	if dm.readOnly {
+		return BackupStats{}, &ErrorReadOnly{}
+	}
+	stats := BackupStats{Id: newBackupId()}
+	out := &countWriter{w: w}
+	var redoFile *os.File
+	var start int64
+	_ = dm.redo.Backup(func(file *os.File, lsn int64) error {
+		redoFile, start = file, lsn
+		return nil
+	})
+	head := make([]byte, SzBackupStreamHead)
+	copy(head, BackupStreamMagic)
+	binary.BigEndian.PutUint64(head[8:], uint64(dm.geo.PageSize))
+	binary.BigEndian.PutUint64(head[16:], uint64(start))
+	if _, err := out.Write(head); err != nil {
+		return BackupStats{}, err
+	}
+	// 日志文件只在重启时重置, 已经刷盘的部分不会改变, 拷贝时不需要持有日志的锁
+	logName := strings.TrimPrefix(redoFile.Name(), dm.path)
+	if err := out.fileSection(streamLog, logName, redoFile, SzCheckSum, start-SzCheckSum); err != nil {
+		return BackupStats{}, err
+	}
+
+	// 数据文件
+	dm.spaceLock.RLock()
+	spaces := make([]*TableSpace, 0, len(dm.spaces))
+	for _, ts := range dm.spaces {
+		spaces = append(spaces, ts)
+	}
+	dm.spaceLock.RUnlock()
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].id < spaces[j].id })
+	for _, ts := range spaces {
+		pages, err := ts.tier.streamTo(out, strings.TrimPrefix(ts.file, dm.path))
+		if err != nil {
+			return BackupStats{}, err
+		}
+		stats.Pages += pages
+	}
+
+	// 其他文件, 拷贝期间产生的redo log, 上层的日志
+	others, err := dm.backupFiles(logs)
+	if err != nil {
+		return BackupStats{}, err
+	}
+	copyFiles := func(files []string) error {
+		for _, name := range files {
+			file, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			stat, err := file.Stat()
+			if err == nil {
+				err = out.fileSection(streamFile, strings.TrimPrefix(name, dm.path), file, 0, stat.Size())
+			}
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	xidFile := dm.path + transactions.XidFileSuffix
+	for i, name := range others {
+		if name == xidFile {
+			others = append(others[:i], others[i+1:]...)
+			break
+		}
+	}
+	if err := copyFiles(others); err != nil {
+		return BackupStats{}, err
+	}
+	var xids []byte
+	err = dm.redo.Backup(func(_ *os.File, lsn int64) error {
+		stats.Lsn = lsn
+		xids, err = readXidFile(xidFile)
+		return err
+	})
+	if err != nil {
+		return BackupStats{}, err
+	}
+	if err := out.fileSection(streamLog, logName, redoFile, start, stats.Lsn-start); err != nil {
+		return BackupStats{}, err
+	}
+	if xids != nil {
+		err = out.section(streamFile, transactions.XidFileSuffix, int64(len(xids)), func(w io.Writer) error {
+			_, err := w.Write(xids)
+			return err
+		})
+		if err != nil {
+			return BackupStats{}, err
+		}
+	}
+	if err := copyFiles(logs); err != nil {
+		return BackupStats{}, err
+	}
+	end := make([]byte, 8)
+	binary.BigEndian.PutUint64(end, uint64(stats.Lsn))
+	err = out.section(streamEnd, "", int64(len(end)), func(w io.Writer) error {
+		_, err := w.Write(end)
+		return err
+	})
+	if err != nil {
+		return BackupStats{}, err
+	}
+	stats.Bytes = out.n
+	log.Printf("[Data Manager] Stream backup %s from lsn %d to %d, %d pages, %d bytes\n", stats.Id, start, stats.Lsn, stats.Pages, stats.Bytes)
+	return stats, nil
+}
+
+// readXidFile 读出事物状态文件, 只保留头部记录的事物数对应的状态(Begin先写入事物数), 文件不存在时返回nil
+func readXidFile(file string) ([]byte, error) {
+	raw, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) < transactions.XidHeaderLength {
+		return raw, nil
+	}
+	size := transactions.XidHeaderLength + int64(binary.BigEndian.Uint64(raw))*transactions.XidStatusSize
+	if int64(len(raw)) >= size {
+		return raw[:size], nil
+	}
+	// 没有写入状态的事物为ACTIVE
+	return append(raw, make([]byte, size-int64(len(raw)))...), nil
+}
+
+// streamTo 持有写锁拷贝表空间的所有页, 校验页校验和, 返回页数
+func (t *pageTier) streamTo(out *countWriter, name string) (int64, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	size, err := t.primary.Size()
+	if err != nil {
+		return 0, err
+	}
+	pages := size / t.geo.PageSize
+	err = out.section(streamSpace, name, pages*t.geo.PageSize, func(w io.Writer) error {
+		buf := make([]byte, t.geo.PageSize)
+		for pageId := int64(1); pageId <= pages; pageId++ {
+			offset := (pageId - 1) * t.geo.PageSize
+			if _, err := t.fileAt(offset).ReadAt(buf, offset); err != nil {
+				return err
+			}
+			if _, err := t.geo.checkStamp(t.primary.Name(), pageId, buf); err != nil {
+				return err
+			}
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return pages, err
+}
+
+// RestoreStream 将BackupTo写入的流恢复到数据库路径path(不能已有数据库), 之后在path上打开数据库时进行崩溃恢复
+func RestoreStream(path string, r io.Reader) error {
+	if _, err := os.Stat(path + FileSuffix); err == nil {
+		return &ErrorRestoreExists{}
+	}
+	head := make([]byte, SzBackupStreamHead)
+	if _, err := io.ReadFull(r, head); err != nil || string(head[:8]) != BackupStreamMagic {
+		return &ErrorBackupStream{}
+	}
+	var redo *os.File
+	defer func() {
+		if redo != nil {
+			_ = redo.Close()
+		}
+	}()
+	for {
+		kindName := make([]byte, 3)
+		if _, err := io.ReadFull(r, kindName); err != nil {
+			return &ErrorBackupStream{}
+		}
+		name := make([]byte, binary.BigEndian.Uint16(kindName[1:])+8)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return &ErrorBackupStream{}
+		}
+		size := int64(binary.BigEndian.Uint64(name[len(name)-8:]))
+		file := string(name[:len(name)-8])
+		if strings.ContainsAny(file, "/\\") {
+			return &ErrorBackupStream{}
+		}
+		var out io.Writer
+		var end bytes.Buffer
+		var opened *os.File // 当前段写入的文件, 写完之后关闭
+		switch kindName[0] {
+		case streamEnd:
+			out = &end
+		case streamLog:
+			if redo == nil {
+				f, err := os.Create(path + file)
+				if err != nil {
+					return err
+				}
+				redo = f
+				if _, err := redo.Write(make([]byte, SzCheckSum)); err != nil {
+					return err
+				}
+			}
+			out = redo
+		case streamSpace, streamFile:
+			f, err := os.Create(path + file)
+			if err != nil {
+				return err
+			}
+			opened, out = f, f
+		default:
+			return &ErrorBackupStream{}
+		}
+		if err := restoreSection(r, out, size, opened); err != nil {
+			return err
+		}
+		if kindName[0] == streamEnd {
+			if redo == nil || end.Len() != 8 {
+				return &ErrorBackupStream{}
+			}
+			return sealRedoLog(redo)
+		}
+	}
+}
+
+// restoreSection 读出一段的Data写入out并校验, opened不为nil时刷盘并关闭
+func restoreSection(r io.Reader, out io.Writer, size int64, opened *os.File) (err error) {
+	if opened != nil {
+		defer func() {
+			if err == nil {
+				err = opened.Sync()
+			}
+			if cerr := opened.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+	crc := crc32.NewIEEE()
+	if n, err := io.Copy(io.MultiWriter(out, crc), io.LimitReader(r, size)); err != nil {
+		return err
+	} else if n != size {
+		return &ErrorBackupStream{}
+	}
+	sum := make([]byte, 4)
+	if _, err := io.ReadFull(r, sum); err != nil || binary.BigEndian.Uint32(sum) != crc.Sum32() {
+		return &ErrorBackupStream{}
+	}
+	return nil
+}
+
+// sealRedoLog 计算恢复的redo log中所有记录的checkSum并写入文件头
+func sealRedoLog(file *os.File) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	var checkSum int64
+	head := make([]byte, SzData+SzCheckSum)
+	for offset := SzCheckSum; offset+SzData+SzCheckSum <= stat.Size(); {
+		if _, err := file.ReadAt(head, offset); err != nil {
+			return err
+		}
+		data := make([]byte, binary.BigEndian.Uint32(head))
+		if _, err := file.ReadAt(data, offset+SzData+SzCheckSum); err != nil {
+			return &ErrorBackupStream{}
+		}
+		checkSum = calcCheckSum(checkSum, data)
+		offset += SzData + SzCheckSum + int64(len(data))
+	}
+	buf := make([]byte, SzCheckSum)
+	binary.BigEndian.PutUint64(buf, uint64(checkSum))
+	if _, err := file.WriteAt(buf, 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
@@ -0,0 +1,104 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 批量插入
+// 逐条插入时每个DataItem各自查找空闲空间表, 获取页锁, 并记录三条日志(DataItem, 槽位, 页头)
+// InsertBatch按顺序把一批DataItem写入尽量少的页: 选中一个槽式数据页之后连续放入后面的DataItem, 直到页中放不下
+// 同一个页中的DataItem在页中相邻, 每个页只记录一条批量插入日志(BATCHINSERT, 见log.go), 同时包含:
+// 覆盖所有DataItem的可撤销部分(撤销时全部置为无效, 与逐条插入相同), 以及覆盖页头和槽位数组的只重做部分
+// 一条日志要么完整写入要么作为tail丢弃, 崩溃恢复不会看到只有DataItem或者只有槽位的页
+// 与InsertPacked相同, 不保留填充因子的空闲空间; 超过一个页的数据先写入溢出链(见overflow.go); 选中旧格式的数据页时逐条追加
+// 与Insert相同, 超出容量限制时返回error以及已经插入的DataItem的uid, 由上层随事物回滚
+
+// InsertBatch
+// 向系统表空间批量插入, 返回每个DataItem的uid, 顺序与items相同
+func (dm *DmImpl) InsertBatch(xid int64, items [][]byte) ([]int64, error) {
+	return dm.InsertBatchIn(xid, SystemSpace, items)
+}
+
+// InsertBatchIn
+// 向space表空间批量插入
+func (dm *DmImpl) InsertBatchIn(xid, space int64, items [][]byte) ([]int64, error) {
+	uids := make([]int64, 0, len(items))
+	raws := make([][]byte, 0, len(items))
+	for _, data := range items {
+		raw, err := dm.storedRaw(xid, space, data)
+		if err != nil {
+			return uids, err
+		}
+		raws = append(raws, raw)
+	}
+	for len(uids) < len(raws) {
+		inserted, err := dm.insertPage(xid, space, raws[len(uids):])
+		if err != nil {
+			return uids, err
+		}
+		uids = append(uids, inserted...)
+		dm.items.inserted.Add(int64(len(inserted)))
+	}
+	return uids, nil
+}
+
+// insertPage 选择一个页, 从头开始放入raws中尽量多的DataItem(至少一个), 返回放入的DataItem的uid
+func (dm *DmImpl) insertPage(xid, space int64, raws [][]byte) ([]int64, error) {
+	ts := dm.getSpace(space)
+	pg, lock, err := dm.choosePage(space, int64(len(raws[0])), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	var uids []int64
+	if isSlotted(pg.GetData()) {
+		for _, slot := range dm.insertSlottedBatch(xid, space, pg, raws) {
+			uids = append(uids, getSpaceUid(space, pg.GetId(), slot))
+		}
+	} else {
+		uids = []int64{dm.appendData(xid, space, pg, raws[0])}
+	}
+	for range uids {
+		ts.events.insert(pg.GetId())
+	}
+	ts.pageCtl.AddPageInfo(pg.GetId(), pg.GetFree())
+	if err := ts.pageCache.ReleasePage(pg); err != nil {
+		panic(fmt.Sprintf("Error occurs when releasing page, err = %s\n", err))
+	}
+	return uids, nil
+}
+
+// insertSlottedBatch
+// 在槽式数据页中为raws中从头开始尽量多的DataItem分配相邻的空间以及新的槽位, 调用方持有页锁并且已经确认第一个DataItem可以放入
+// 先写日志(所有DataItem, 页头以及槽位数组), 再修改页, 返回分配的槽位号
+func (dm *DmImpl) insertSlottedBatch(xid, space int64, pg Page, raws [][]byte) []int64 {
+	data := pg.GetData()
+	first, lower := slotsOf(data), lowerOf(data)
+	free := lower - slotPosition(first)
+	n, size := int64(0), int64(0)
+	for n < int64(len(raws)) && size+int64(len(raws[n]))+(n+1)*SzSlot <= free {
+		size += int64(len(raws[n]))
+		n++
+	}
+	head, offset := slottedHead(data, first+n, size, dm.geo.PageLimit)
+	// DataItem从lower开始向低地址依次放置
+	items, oldItems := make([]byte, size), make([]byte, size)
+	meta := make([]byte, slotPosition(first+n))
+	copy(meta, head)
+	copy(meta[SzSlottedHead:], data[SzSlottedHead:slotPosition(first)])
+	slots := make([]int64, n)
+	position := lower
+	for i := int64(0); i < n; i++ {
+		position -= int64(len(raws[i]))
+		copy(items[position-offset:], raws[i])
+		copy(oldItems[position-offset:], raws[i])
+		SetRawInvalid(oldItems[position-offset:])
+		binary.BigEndian.PutUint16(meta[slotPosition(first+i):], uint16(position))
+		slots[i] = first + i
+	}
+	dm.redo.BatchInsertLog(getSpaceUid(space, pg.GetId(), offset), xid, oldItems, items, data[:len(meta)], meta)
+	dm.writePage(pg, items, offset)
+	dm.writePage(pg, meta, 0)
+	return slots
+}
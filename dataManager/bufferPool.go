@@ -15,4 +15,18 @@ type BufferPool interface {
 	Get(key PoolObj) (PoolObj, error) // 获取缓存,如果不在内存中，则发起IO请求
 	Release(key PoolObj) error        // 释放缓存
 	Close() error                     // 安全关闭缓冲区
+	FlushAll() error                  // 将缓存中的脏页写回数据源, 不淘汰
+	Stats() PoolStats                 // 运行状态
+}
+
+// PoolStats 缓冲区的运行状态
+type PoolStats struct {
+	Capacity int64 // 最多缓存的页数
+	Cached   int64 // 当前缓存的页数
+	Hits     int64 // 命中缓存的次数
+	Misses   int64 // 从数据源读取的次数
+	Flushes  int64 // 写回数据源的次数
+	// Evictions 引用计数归零之后移出缓存的页数
+	Evictions int64
+	Allocated int64 // 新分配的页数, 由PageCache统计
 }
@@ -0,0 +1,225 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"math/bits"
+	"os"
+	"sync"
+)
+
+// 变化页位图(changed page bitmap)
+// 每个表空间两个位图, 第pageId位表示该页写回过数据文件, 由写回路径(FlushBackToDataSource)在写入之后置位
+// backup: 上一次备份之后写回的页, 增量备份只拷贝其中的页(见backup.go)
+// scrub: 上一次校验之后写回的页, 定向校验只读取其中的页(见scrub.go)
+// 两个位图在checkpoint, 备份以及关闭时持久化到<path>.chg; 崩溃之后丢失的置位由崩溃恢复补齐,
+// 上一次持久化之后写回的页的修改都在本次运行的redo log中, 恢复时重做或撤销并再次写回
+// .chg的格式版本不一致或者无法解析时忽略, 下一次备份只能是全量备份, 下一次校验需要校验所有页
+
+const changedVersion int = 1
+
+// pageBitmap 页号从1开始, 第pageId位对应words[pageId/64]中的pageId%64位
+type pageBitmap []uint64
+
+func (b *pageBitmap) set(pageId int64) {
+	w := pageId / 64
+	for int64(len(*b)) <= w {
+		*b = append(*b, 0)
+	}
+	(*b)[w] |= 1 << uint(pageId%64)
+}
+
+func (b pageBitmap) has(pageId int64) bool {
+	w := pageId / 64
+	return w < int64(len(b)) && b[w]&(1<<uint(pageId%64)) != 0
+}
+
+func (b pageBitmap) count() int64 {
+	n := 0
+	for _, word := range b {
+		n += bits.OnesCount64(word)
+	}
+	return int64(n)
+}
+
+// pages 置位的页号, 升序
+func (b pageBitmap) pages() []int64 {
+	res := make([]int64, 0, b.count())
+	for w, word := range b {
+		for word != 0 {
+			i := bits.TrailingZeros64(word)
+			res = append(res, int64(w)*64+int64(i))
+			word &^= 1 << uint(i)
+		}
+	}
+	return res
+}
+
+func (b *pageBitmap) or(o pageBitmap) {
+	for len(*b) < len(o) {
+		*b = append(*b, 0)
+	}
+	for w, word := range o {
+		(*b)[w] |= word
+	}
+}
+
+// encode [word]8..., 大端
+func (b pageBitmap) encode() []byte {
+	raw := make([]byte, 8*len(b))
+	for w, word := range b {
+		binary.BigEndian.PutUint64(raw[8*w:], word)
+	}
+	return raw
+}
+
+func decodeBitmap(raw []byte) pageBitmap {
+	b := make(pageBitmap, len(raw)/8)
+	for w := range b {
+		b[w] = binary.BigEndian.Uint64(raw[8*w:])
+	}
+	return b
+}
+
+// changeTracker 表空间 -> 变化页位图
+type changeTracker struct {
+	lock       sync.Mutex
+	file       string
+	since      string               // 上一次备份的id, 为空时不能进行增量备份
+	backup     map[int64]pageBitmap // 上一次备份之后写回的页
+	scrub      map[int64]pageBitmap // 上一次校验之后写回的页
+	whole      map[int64]struct{}   // 下一次备份需要整体拷贝的表空间
+	backupLock sync.Mutex           // 同一时刻只进行一次备份
+	run        string               // 本次运行的id
+}
+
+// changedFile .chg的持久化格式, 位图为encode的结果
+type changedFile struct {
+	Version int
+	Since   string
+	Backup  map[int64][]byte
+	Scrub   map[int64][]byte
+	Whole   []int64
+}
+
+func loadChangeTracker(path string) *changeTracker {
+	c := &changeTracker{file: path + ChangedSuffix, backup: map[int64]pageBitmap{}, scrub: map[int64]pageBitmap{},
+		whole: map[int64]struct{}{}, run: newBackupId()}
+	raw, err := os.ReadFile(c.file)
+	if err != nil {
+		return c
+	}
+	cf := &changedFile{}
+	if err := json.Unmarshal(raw, cf); err != nil || cf.Version != changedVersion {
+		log.Printf("[Data Manager] Ignore invalid changed page file %s, next backup must be full\n", c.file)
+		return c
+	}
+	c.since = cf.Since
+	for space, raw := range cf.Backup {
+		c.backup[space] = decodeBitmap(raw)
+	}
+	for space, raw := range cf.Scrub {
+		c.scrub[space] = decodeBitmap(raw)
+	}
+	for _, space := range cf.Whole {
+		c.whole[space] = struct{}{}
+	}
+	return c
+}
+
+// mark 页写回数据文件之后调用
+func (c *changeTracker) mark(space, pageId int64) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	b, s := c.backup[space], c.scrub[space]
+	b.set(pageId)
+	s.set(pageId)
+	c.backup[space], c.scrub[space] = b, s
+}
+
+// renew 新建或者清空的表空间
+func (c *changeTracker) renew(space int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.whole[space] = struct{}{}
+	delete(c.backup, space)
+	delete(c.scrub, space)
+}
+
+// take 备份取走表空间的记录
+func (c *changeTracker) take(space int64) (pageBitmap, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	pages := c.backup[space]
+	_, whole := c.whole[space]
+	delete(c.backup, space)
+	delete(c.whole, space)
+	return pages, whole
+}
+
+// giveBack 备份失败时放回取走的记录
+func (c *changeTracker) giveBack(space int64, pages pageBitmap, whole bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	b := c.backup[space]
+	b.or(pages)
+	c.backup[space] = b
+	if whole {
+		c.whole[space] = struct{}{}
+	}
+}
+
+// takeScrub 校验取走表空间的记录
+func (c *changeTracker) takeScrub(space int64) pageBitmap {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	pages := c.scrub[space]
+	delete(c.scrub, space)
+	return pages
+}
+
+// markScrub 校验未完成或者损坏的页在下一次校验时再次检查
+func (c *changeTracker) markScrub(space int64, pages pageBitmap) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s := c.scrub[space]
+	s.or(pages)
+	c.scrub[space] = s
+}
+
+// counts 所有表空间上一次备份以及上一次校验之后写回的页数
+func (c *changeTracker) counts() (backup, scrub int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, b := range c.backup {
+		backup += b.count()
+	}
+	for _, s := range c.scrub {
+		scrub += s.count()
+	}
+	return
+}
+
+// save 写入.chg, since不为nil时同时更新上一次备份的id
+func (c *changeTracker) save(since *string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if since != nil {
+		c.since = *since
+	}
+	cf := &changedFile{Version: changedVersion, Since: c.since, Backup: map[int64][]byte{}, Scrub: map[int64][]byte{}}
+	for space, b := range c.backup {
+		cf.Backup[space] = b.encode()
+	}
+	for space, s := range c.scrub {
+		cf.Scrub[space] = s.encode()
+	}
+	for space := range c.whole {
+		cf.Whole = append(cf.Whole, space)
+	}
+	return writeJsonFile(c.file, cf)
+}
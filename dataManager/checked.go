@@ -0,0 +1,165 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"errors"
+	"myDB/dbError"
+)
+
+// 返回error的接口
+// DataManager的方法遇到错误时panic(上层保证uid合法), 嵌入式使用或者上层需要从错误中恢复时使用Checked()返回的接口:
+// 表空间不存在返回ErrorSpaceNotExist, 页超出表空间返回ErrorPageOverflow,
+// 槽位不存在, 已经清理, DataItem失效或者为转发桩时返回ErrorInvalidDataItem
+// 页校验和不一致时返回ErrorPageChecksum(解密失败时返回ErrorPageDecrypt, 见pageCipher.go), 读到校验和不一致的DataItem返回CorruptPage, 读取页的其他错误返回ErrorDataManager
+// Read/Update/Delete由DmImpl中返回error的实现(readValid, update, delete)完成, 同名的panic方法是它们的包装:
+// 检查DataItem有效与写入在同一个页锁内完成, 出错时已经释放页的引用以及页锁
+// 与DataManager的同名方法共享锁以及日志, 两套接口可以混合使用
+
+type ErrorInvalidDataItem struct{}
+type ErrorPageOverflow struct{}
+
+// ErrorDataManager 读取页失败
+type ErrorDataManager struct {
+	Reason string
+}
+
+func (err *ErrorInvalidDataItem) Error() string {
+	return "Data item is invalid or doesn't exist"
+}
+
+func (err *ErrorPageOverflow) Error() string {
+	return "Page doesn't exist in the table space"
+}
+
+func (err *ErrorDataManager) Error() string {
+	return "Data manager failed, " + err.Reason
+}
+
+// CheckedDataManager 不panic的DataManager接口
+type CheckedDataManager interface {
+	Read(uid int64) (DataItem, error)         // 当前读, 失效时返回ErrorInvalidDataItem
+	ReadSnapShot(uid int64) (DataItem, error) // 快照读, 沿转发桩读到最终的DataItem
+	Insert(xid int64, data []byte) (int64, error)
+	InsertIn(xid, space int64, data []byte) (int64, error)
+	Update(xid, uid int64, data []byte) (int64, error)
+	Delete(xid, uid int64) error
+}
+
+type checkedDm struct {
+	dm *DmImpl
+}
+
+func (dm *DmImpl) Checked() CheckedDataManager {
+	return &checkedDm{dm: dm}
+}
+
+func (c *checkedDm) Read(uid int64) (DataItem, error) {
+	return c.dm.readValid(uid)
+}
+
+func (c *checkedDm) ReadSnapShot(uid int64) (DataItem, error) {
+	return c.dm.readSnapShot(uid)
+}
+
+func (c *checkedDm) Insert(xid int64, data []byte) (int64, error) {
+	return c.InsertIn(xid, SystemSpace, data)
+}
+
+func (c *checkedDm) InsertIn(xid, space int64, data []byte) (int64, error) {
+	if _, err := c.dm.space(space); err != nil {
+		return -1, err
+	}
+	return c.dm.InsertIn(xid, space, data)
+}
+
+func (c *checkedDm) Update(xid, uid int64, data []byte) (int64, error) {
+	return c.dm.update(xid, uid, data)
+}
+
+func (c *checkedDm) Delete(xid, uid int64) error {
+	return c.dm.delete(xid, uid)
+}
+
+func (dm *DmImpl) space(space int64) (*TableSpace, error) {
+	dm.spaceLock.RLock()
+	defer dm.spaceLock.RUnlock()
+	if ts, ext := dm.spaces[space]; ext {
+		return ts, nil
+	}
+	return nil, &ErrorSpaceNotExist{}
+}
+
+// readItem 读取uid指向的DataItem(不检查有效位), 出错时不持有页的引用
+func (dm *DmImpl) readItem(uid int64) (DataItem, error) {
+	space, pageId, offset := SplitUid(uid)
+	ts, err := dm.space(space)
+	if err != nil {
+		return nil, err
+	}
+	if pageId < 1 || pageId > ts.pageCache.GetPageNumbers() || (space == SystemSpace && pageId == PageNumberDbMeta) {
+		return nil, &ErrorPageOverflow{}
+	}
+	page, err := ts.pageCache.GetPage(pageId)
+	if errors.Is(err, dbError.ErrCorruptPage) {
+		return nil, err
+	} else if err != nil {
+		return nil, &ErrorDataManager{Reason: err.Error()}
+	}
+	var data []byte
+	page.View(func(d []byte) {
+		data, err = d, validItem(d, offset)
+	})
+	var di DataItem
+	if err == nil {
+		di, err = dm.newDataItem(page, space, offset, data, locate(data, offset))
+	}
+	if err != nil {
+		_ = ts.pageCache.ReleasePage(page)
+		return nil, err
+	}
+	return di, nil
+}
+
+// readValid 同readItem, DataItem失效或者为转发桩时返回ErrorInvalidDataItem
+func (dm *DmImpl) readValid(uid int64) (DataItem, error) {
+	di, err := dm.readItem(uid)
+	if err != nil {
+		return nil, err
+	}
+	if !di.IsValid() {
+		di.Release()
+		return nil, &ErrorInvalidDataItem{}
+	}
+	return di, nil
+}
+
+// readSnapShot 同readItem, 沿转发桩读到最终的DataItem
+func (dm *DmImpl) readSnapShot(uid int64) (DataItem, error) {
+	di, err := dm.readItem(uid)
+	if err != nil {
+		return nil, err
+	}
+	di, _, err = dm.followItem(di)
+	return di, err
+}
+
+// validItem offset(槽位号或旧格式的偏移)指向页中存在的DataItem, 调用方持有页的读锁
+func validItem(data []byte, offset int64) error {
+	if isSlotted(data) {
+		if offset >= slotsOf(data) || locate(data, offset) == purgedSlot {
+			return &ErrorInvalidDataItem{}
+		}
+		return nil
+	}
+	used := int64(binary.BigEndian.Uint32(data[:SzPgUsed]))
+	if PageType(binary.BigEndian.Uint32(data[SzPgUsed:InitOffset])) != DataPage || offset < InitOffset || offset >= used {
+		return &ErrorInvalidDataItem{}
+	}
+	return nil
+}
+
+// itemError err为uid不合法, DataItem失效或者读取失败, 而不是容量限制等正常的错误
+func itemError(err error) bool {
+	return errors.As(err, new(*ErrorInvalidDataItem)) || errors.As(err, new(*ErrorPageOverflow)) ||
+		errors.As(err, new(*ErrorSpaceNotExist)) || errors.As(err, new(*ErrorDataManager)) || errors.Is(err, dbError.ErrCorruptPage)
+}
@@ -0,0 +1,56 @@
+package dataManager
+
+import (
+	"log"
+	"sort"
+)
+
+// Checkpoint
+// 同步执行: 日志刷盘(WAL) -> 所有表空间的脏页写回数据文件并刷盘 -> 记录checkpoint并刷盘 -> 持久化变化页位图(见changedPages.go)
+// 返回时checkpoint LSN之前已经写入页的修改都已经持久化到数据文件, 可以在此之后对数据库目录做文件系统快照
+// 执行期间的并发写入不保证包含在内, 需要一致的快照时调用方应当先停止写入
+func (dm *DmImpl) Checkpoint() error {
+	if dm.readOnly {
+		return &ErrorReadOnly{}
+	}
+	lsn := dm.redo.Sync()
+	if err := dm.flushSpaces(); err != nil {
+		return err
+	}
+	dm.redo.Checkpoint(lsn)
+	dm.redo.PruneUndo(dm.finished)
+	if err := dm.changes.save(nil); err != nil {
+		return err
+	}
+	log.Printf("[Data Manager] Checkpoint at lsn %d\n", lsn)
+	return nil
+}
+
+// Sync
+// 持久化屏障: 返回时之前已经返回的所有写操作的日志都已经刷盘(包括批量模式下缓存的日志)
+// flushPages为true时再将所有脏页写回数据文件并刷盘, 但不记录checkpoint
+// 供在DataManager之上自行实现批量提交的调用方使用
+func (dm *DmImpl) Sync(flushPages bool) error {
+	dm.redo.Sync()
+	if !flushPages {
+		return nil
+	}
+	return dm.flushSpaces()
+}
+
+// flushSpaces 按表空间id的顺序写回所有脏页并刷盘
+func (dm *DmImpl) flushSpaces() error {
+	dm.spaceLock.RLock()
+	spaces := make([]*TableSpace, 0, len(dm.spaces))
+	for _, ts := range dm.spaces {
+		spaces = append(spaces, ts)
+	}
+	dm.spaceLock.RUnlock()
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].id < spaces[j].id })
+	for _, ts := range spaces {
+		if err := ts.pageCache.FlushAll(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// DataItem校验和
+// 开启校验和的表空间中新写入的DataItem: [valid]1[dataSize | DIChecksum]8[data][checksum]4
+// 校验和为data的CRC32, 不包括有效位(删除和恢复只修改有效位), 每次读取DataItem时校验
+// 用于发现页写回之后才能被页级校验发现之前的内存中的数据损坏, 不一致时panic
+// 是否带校验和记录在每个DataItem中, 关闭表空间的校验和之后已经写入的DataItem仍然校验
+// 开启校验和的表空间列表保存在数据库元数据区(MetaChecksumSpaces)
+
+const (
+	DIChecksum   uint64 = 1 << 63 // dataSize的最高位, DataItem带校验和
+	SzDIChecksum int64  = 4
+)
+
+// SetChecksum 设置表空间中之后写入的DataItem是否带校验和
+func (dm *DmImpl) SetChecksum(space int64, on bool) error {
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext {
+		return &ErrorSpaceNotExist{}
+	}
+	ts.checksum.Store(on)
+	return dm.WriteMeta(MetaChecksumSpaces, dm.encodeChecksumSpaces())
+}
+
+// encodeChecksumSpaces [space]4..., 没有开启校验和的表空间时返回nil(删除section)
+func (dm *DmImpl) encodeChecksumSpaces() []byte {
+	dm.spaceLock.RLock()
+	defer dm.spaceLock.RUnlock()
+	spaces := make([]int64, 0)
+	for id, ts := range dm.spaces {
+		if ts.checksum.Load() {
+			spaces = append(spaces, id)
+		}
+	}
+	if len(spaces) == 0 {
+		return nil
+	}
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i] < spaces[j] })
+	data := make([]byte, 4*len(spaces))
+	for i, space := range spaces {
+		binary.BigEndian.PutUint32(data[4*i:], uint32(space))
+	}
+	return data
+}
+
+// loadChecksumSpaces 启动时从元数据区恢复表空间的校验和设置, 必须在loadMeta之后调用
+func (dm *DmImpl) loadChecksumSpaces() {
+	data, ext := dm.ReadMeta(MetaChecksumSpaces)
+	if !ext {
+		return
+	}
+	for i := 0; i+4 <= len(data); i += 4 {
+		if ts, ext := dm.spaces[int64(binary.BigEndian.Uint32(data[i:]))]; ext {
+			ts.checksum.Store(true)
+		}
+	}
+}
+
+// wrapRaw 按表空间的设置生成DataItem
+// 按DataManager的设置压缩, 见compression.go
+func (dm *DmImpl) wrapRaw(space int64, data []byte) []byte {
+	codec, stored := dm.compress(data)
+	return wrapCompressed(codec, stored, dm.getSpace(space).checksum.Load())
+}
+
+// WrapDataItemRawChecked
+// RAW: [valid]1[dataSize | DIChecksum]8[data][checksum]4
+func WrapDataItemRawChecked(data []byte) []byte {
+	size := int64(len(data))
+	raw := make([]byte, SzDIValid+SzDIDataSize+size+SzDIChecksum)
+	raw[0] = DIValid
+	binary.BigEndian.PutUint64(raw[SzDIValid:SzDIValid+SzDIDataSize], uint64(size)|DIChecksum)
+	copy(raw[SzDIValid+SzDIDataSize:], data)
+	binary.BigEndian.PutUint32(raw[SzDIValid+SzDIDataSize+size:], crc32.ChecksumIEEE(data))
+	return raw
+}
+
+// itemSize 解析页中position处的DataItem, 返回DATA段的长度, DataItem的总长度以及是否带校验和
+func itemSize(data []byte, position int64) (dataSize, rawSize int64, checked bool) {
+	size := binary.BigEndian.Uint64(data[position+SzDIValid : position+SzDIValid+SzDIDataSize])
+	checked = size&DIChecksum != 0
+	dataSize = int64(size & diSizeMask)
+	rawSize = SzDIValid + SzDIDataSize + dataSize
+	if checked {
+		rawSize += SzDIChecksum
+	}
+	return
+}
+
+// verifyChecksum 校验带校验和的DataItem, raw为DataItem的完整数据
+func verifyChecksum(raw []byte, uid int64) {
+	if err := itemChecksum(raw, uid); err != nil {
+		panic(fmt.Sprintf("Error occurs when reading data item %d, checksum mismatch", uid))
+	}
+}
+
+// itemChecksum 同verifyChecksum, 校验和不一致时返回CorruptPage
+func itemChecksum(raw []byte, uid int64) error {
+	start := SzDIValid + SzDIDataSize
+	end := int64(len(raw)) - SzDIChecksum
+	if crc32.ChecksumIEEE(raw[start:end]) != binary.BigEndian.Uint32(raw[end:]) {
+		space, pageId, _ := SplitUid(uid)
+		return &CorruptPage{Space: space, PageId: pageId, Reason: fmt.Sprintf("checksum mismatch of data item %d", uid)}
+	}
+	return nil
+}
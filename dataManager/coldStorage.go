@@ -0,0 +1,336 @@
+package dataManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"myDB/simulation"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 冷数据分层存储
+// 表空间的数据文件按区(extent, ExtentPages个连续的页)划分, 长时间没有访问的区可以迁移到二级目录(更便宜, 更慢的设备)中的冷文件
+// 冷文件与数据文件中页的偏移相同(稀疏文件); 页表(<数据文件>.tier)记录冷文件的路径以及位于冷文件中的区, 页的读写按区所在的位置选择文件
+// 访问时间: 按区记录最近一次获取页(包括缓存命中)的时间, 启动之后没有访问过的区按打开表空间的时间计算
+// 迁移时持有页表的写锁(期间该表空间的页读写等待): 将区从数据文件拷贝到冷文件, 冷文件刷盘, 原子地写入页表, 最后在数据文件中释放这些区(打洞, 数据文件的大小不变)
+// 崩溃发生在写入页表之前时区仍然位于数据文件, 冷文件中的拷贝被之后的迁移覆盖; 之后写回的页(包括崩溃恢复)按页表写入冷文件
+// 0号区(包含表空间头), 最后一个不完整的区以及压缩的区(见extentCompression.go)不迁移; 冷区被访问时不会自动迁回, 一个表空间只能迁移到一个二级目录
+// 启动时冷文件不存在则panic
+
+const (
+	ExtentPages int64  = 64
+	TierSuffix  string = ".tier"
+	ColdSuffix  string = ".cold"
+)
+
+type ErrorColdDirConflict struct{}
+
+func (err *ErrorColdDirConflict) Error() string {
+	return "This table space is already offloaded to another directory"
+}
+
+// TierStats 表空间的分层存储状态
+type TierStats struct {
+	Moved  int64 // 本次迁移的区数
+	Cold   int64 // 位于冷文件中的区数
+	Extent int64 // 数据文件中完整的区数
+}
+
+// tierFile 页表的持久化格式
+type tierFile struct {
+	Cold    string
+	Extents []int64
+}
+
+// pageTier 页表, 由表空间的数据源和页缓存共享
+type pageTier struct {
+	lock     sync.RWMutex   // 读写页时持有读锁, 迁移时持有写锁
+	file     string         // 页表文件
+	primary  *segmentedFile // 数据文件, 见segment.go
+	coldPath string         // 冷文件, 为空时没有迁移过
+	cold     *os.File
+	extents  map[int64]struct{} // 位于冷文件中的区
+	zip      *extentZip         // 压缩的区, 见extentCompression.go
+	space    int64
+	changes  *changeTracker // 写回数据文件的页, 见changedPages.go
+	fsm      *freeSpaceMap  // 页的剩余空间, 见freeSpaceMap.go
+	cipher   *pageCipher    // 页加密, 没有加密时为nil, 见pageCipher.go
+	geo      *Geometry      // 数据库的页大小, 见pageSize.go
+	files    *fileOptions   // 数据文件的打开方式, 见tableSpace.go
+	readOnly bool           // 只读打开数据文件以及冷文件, 见readOnly.go
+
+	accessLock sync.RWMutex // 保护access的长度
+	access     []atomic.Int64
+	opened     int64 // 打开表空间的时间
+}
+
+func extentOf(pageId int64) int64 {
+	return (pageId - 1) / ExtentPages
+}
+
+// openPageTier dataFile为表空间的数据文件
+func openPageTier(dataFile string, geo *Geometry, readOnly bool) *pageTier {
+	t := &pageTier{file: dataFile + TierSuffix, extents: map[int64]struct{}{}, opened: simulation.Now().UnixNano(), geo: geo, files: defaultFileOptions, readOnly: readOnly}
+	t.zip = openExtentZip(dataFile, t.fileMode(), geo.PageSize)
+	raw, err := os.ReadFile(t.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return t
+		}
+		panic(fmt.Sprintf("Error occurs when reading page tier %s, err = %s", t.file, err))
+	}
+	tf := &tierFile{}
+	if err := json.Unmarshal(raw, tf); err != nil {
+		panic(fmt.Sprintf("Error occurs when parsing page tier %s, err = %s", t.file, err))
+	}
+	if t.cold, err = os.OpenFile(tf.Cold, t.fileMode(), 0666); err != nil {
+		panic(fmt.Sprintf("Error occurs when opening cold file %s, err = %s", tf.Cold, err))
+	}
+	t.coldPath = tf.Cold
+	for _, extent := range tf.Extents {
+		t.extents[extent] = struct{}{}
+	}
+	log.Printf("[Data Manager] Open %d cold extents in %s\n", len(t.extents), tf.Cold)
+	return t
+}
+
+// fileMode 打开数据文件以及冷文件的模式
+func (t *pageTier) fileMode() int {
+	if t.readOnly {
+		return os.O_RDONLY
+	}
+	return os.O_RDWR
+}
+
+// fileAt 返回offset所在的页应该读写的文件, 调用方持有读锁
+func (t *pageTier) fileAt(offset int64) pageFile {
+	extent := extentOf(offset/t.geo.PageSize + 1)
+	if _, ext := t.extents[extent]; ext {
+		return t.cold
+	}
+	if t.zip.zipped(extent) {
+		return &zippedFile{zip: t.zip, extent: extent}
+	}
+	return t.primary
+}
+
+// touch 记录区的访问时间
+func (t *pageTier) touch(pageId int64) {
+	extent, now := extentOf(pageId), simulation.Now().UnixNano()
+	t.accessLock.RLock()
+	if extent < int64(len(t.access)) {
+		t.access[extent].Store(now)
+		t.accessLock.RUnlock()
+		return
+	}
+	t.accessLock.RUnlock()
+	t.accessLock.Lock()
+	defer t.accessLock.Unlock()
+	if extent >= int64(len(t.access)) {
+		access := make([]atomic.Int64, 2*extent+1)
+		for i := range t.access {
+			access[i].Store(t.access[i].Load())
+		}
+		t.access = access
+	}
+	t.access[extent].Store(now)
+}
+
+// lastAccess 区最近一次访问的时间
+func (t *pageTier) lastAccess(extent int64) int64 {
+	t.accessLock.RLock()
+	defer t.accessLock.RUnlock()
+	if extent < int64(len(t.access)) && t.access[extent].Load() > t.opened {
+		return t.access[extent].Load()
+	}
+	return t.opened
+}
+
+// offload 将数据文件中idle时间内没有访问的完整区迁移到dir中的冷文件
+func (t *pageTier) offload(dir string, idle time.Duration) (TierStats, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	size, err := t.primary.Size()
+	if err != nil {
+		return TierStats{}, err
+	}
+	stats := TierStats{Extent: size / t.geo.PageSize / ExtentPages}
+	coldPath, err := filepath.Abs(filepath.Join(dir, filepath.Base(t.primary.Name())+ColdSuffix))
+	if err != nil {
+		return stats, err
+	}
+	if t.coldPath != "" && t.coldPath != coldPath {
+		return stats, &ErrorColdDirConflict{}
+	}
+	deadline := simulation.Now().Add(-idle).UnixNano()
+	moved := make([]int64, 0)
+	for extent := int64(1); extent < stats.Extent; extent++ {
+		if _, ext := t.extents[extent]; !ext && !t.zip.zipped(extent) && t.lastAccess(extent) <= deadline {
+			moved = append(moved, extent)
+		}
+	}
+	if len(moved) > 0 {
+		if err := t.moveExtents(coldPath, moved); err != nil {
+			return stats, err
+		}
+	}
+	stats.Moved, stats.Cold = int64(len(moved)), int64(len(t.extents))
+	return stats, nil
+}
+
+// moveExtents 拷贝区, 冷文件刷盘之后写入页表, 最后释放数据文件中的区
+func (t *pageTier) moveExtents(coldPath string, moved []int64) error {
+	cold := t.cold
+	if cold == nil {
+		if err := os.MkdirAll(filepath.Dir(coldPath), 0755); err != nil {
+			return err
+		}
+		var err error
+		if cold, err = os.OpenFile(coldPath, os.O_RDWR|os.O_CREATE, 0666); err != nil {
+			return err
+		}
+	}
+	fail := func(err error) error {
+		if cold != t.cold {
+			_ = cold.Close()
+		}
+		return err
+	}
+	size := ExtentPages * t.geo.PageSize
+	buf := make([]byte, size)
+	for _, extent := range moved {
+		if _, err := t.primary.ReadAt(buf, extent*size); err != nil {
+			return fail(err)
+		}
+		if _, err := cold.WriteAt(buf, extent*size); err != nil {
+			return fail(err)
+		}
+	}
+	if err := cold.Sync(); err != nil {
+		return fail(err)
+	}
+	tf := &tierFile{Cold: coldPath, Extents: make([]int64, 0, len(t.extents)+len(moved))}
+	for extent := range t.extents {
+		tf.Extents = append(tf.Extents, extent)
+	}
+	tf.Extents = append(tf.Extents, moved...)
+	sort.Slice(tf.Extents, func(i, j int) bool { return tf.Extents[i] < tf.Extents[j] })
+	if err := writeJsonFile(t.file, tf); err != nil {
+		return fail(err)
+	}
+	t.cold, t.coldPath = cold, coldPath
+	for _, extent := range moved {
+		t.extents[extent] = struct{}{}
+		t.primary.punchHole(extent*size, size)
+	}
+	log.Printf("[Data Manager] Offload %d extents of %s to %s\n", len(moved), t.primary.Name(), coldPath)
+	return nil
+}
+
+// writeJsonFile 先写入临时文件再重命名
+func writeJsonFile(file string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(file + TmpSuffix)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(raw); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file+TmpSuffix, file)
+}
+
+// copyTo 数据文件拷贝到dst之后, 用冷文件中的区以及解压的区覆盖dst中对应的区
+func (t *pageTier) copyTo(dst string) error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if len(t.extents) == 0 && len(t.zip.extents) == 0 {
+		return nil
+	}
+	out, err := os.OpenFile(dst, os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	size := ExtentPages * t.geo.PageSize
+	buf := make([]byte, size)
+	for extent := range t.extents {
+		if _, err := t.cold.ReadAt(buf, extent*size); err != nil {
+			_ = out.Close()
+			return err
+		}
+		if _, err := out.WriteAt(buf, extent*size); err != nil {
+			_ = out.Close()
+			return err
+		}
+	}
+	for _, extent := range t.zip.zippedExtents() {
+		data, err := t.zip.read(extent)
+		if err == nil {
+			_, err = out.WriteAt(data, extent*size)
+		}
+		if err != nil {
+			_ = out.Close()
+			return err
+		}
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// remove 删除页表以及冷文件(清空表空间时)
+func (t *pageTier) remove() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.cold != nil {
+		_ = t.cold.Close()
+		_ = os.Remove(t.coldPath)
+	}
+	_ = os.Remove(t.file)
+	t.cold, t.coldPath, t.extents = nil, "", map[int64]struct{}{}
+	t.zip.remove()
+}
+
+func (t *pageTier) close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.zip.close(); err != nil {
+		return err
+	}
+	if t.cold == nil {
+		return nil
+	}
+	return t.cold.Close()
+}
+
+// OffloadCold 将表空间中idle时间内没有访问的区迁移到dir
+func (dm *DmImpl) OffloadCold(space int64, dir string, idle time.Duration) (TierStats, error) {
+	if dm.readOnly {
+		return TierStats{}, &ErrorReadOnly{}
+	}
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext || space == SystemSpace {
+		return TierStats{}, &ErrorSpaceNotExist{}
+	}
+	return ts.tier.offload(dir, idle)
+}
@@ -0,0 +1,66 @@
+package dataManager
+
+import (
+	"bytes"
+	"sync"
+)
+
+// 比较并交换(CAS)
+// UpdateIf在DataItem当前的数据等于expected时才更新, 比较与更新是原子的, 上层可以不加锁实现乐观写入
+// 同一个uid上的UpdateIf互斥(按uid分段加锁), 与不经过UpdateIf的Update不互斥, 乐观写入的数据只能通过UpdateIf修改
+// 新数据更长时uid可能改变(见Update), 之后基于旧uid的UpdateIf读到失效的DataItem, 返回ErrorCompareMismatch
+// UpdateIf原地修改数据, 乐观读取必须使用Load(持有同一个分段锁), 直接Read可能读到写了一半的数据:
+//
+//	for {
+//		old, ok := dm.Load(uid)
+//		if !ok { break }
+//		if _, err := dm.UpdateIf(xid, uid, old, next(old)); err == nil { break }
+//	}
+
+const itemLockStripes int = 64
+
+type ErrorCompareMismatch struct{}
+
+func (err *ErrorCompareMismatch) Error() string {
+	return "Data item has been modified or deleted"
+}
+
+// itemLocks 同一个DataItem上的UpdateIf以及Load互斥
+type itemLocks [itemLockStripes]sync.Mutex
+
+func (l *itemLocks) of(uid int64) *sync.Mutex {
+	return &l[uint64(uid)%uint64(itemLockStripes)]
+}
+
+// UpdateIf
+// 当前数据(不包括DataItem的头部)等于expected时更新为data, 返回新数据的地址(见Update)
+// 数据不同或者DataItem已经失效时不更新, 返回ErrorCompareMismatch
+func (dm *DmImpl) UpdateIf(xid, uid int64, expected, data []byte) (int64, error) {
+	lock := dm.itemLocks.of(uid)
+	lock.Lock()
+	defer lock.Unlock()
+	di := dm.Read(uid)
+	if di == nil {
+		return uid, &ErrorCompareMismatch{}
+	}
+	same := bytes.Equal(di.GetData(), expected)
+	di.Release()
+	if !same {
+		return uid, &ErrorCompareMismatch{}
+	}
+	return dm.Update(xid, uid, data)
+}
+
+// Load
+// 读出uid当前数据的拷贝, DataItem已经失效时返回false; 与同一个uid上的UpdateIf互斥
+func (dm *DmImpl) Load(uid int64) ([]byte, bool) {
+	lock := dm.itemLocks.of(uid)
+	lock.Lock()
+	defer lock.Unlock()
+	di := dm.Read(uid)
+	if di == nil {
+		return nil, false
+	}
+	defer di.Release()
+	return di.GetData(), true
+}
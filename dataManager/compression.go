@@ -0,0 +1,161 @@
+package dataManager
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DataItem压缩
+// OpenDataManager时通过WithCompression选择压缩算法, 之后写入的DataItem(溢出头以及转发桩除外)尝试压缩数据, 压缩之后更短时保存压缩的数据:
+// RAW: [valid]1[dataSize | codec << DICodecShift]8[compressed data]([checksum]4), dataSize为压缩之后的长度
+// dataSize的最高字节为标志字节: 校验和, 溢出头, 溢出段以及压缩算法(低5位, 0表示没有压缩)
+// 读取(Read, ReadSnapShot, ReadGuard)时透明地解压, GetData返回原来的数据, ReadGuard读压缩的数据时返回解压之后的拷贝(不是零拷贝)
+// 压缩算法记录在每个DataItem中, 关闭压缩或者更换算法之后已经写入的DataItem仍然可以读取
+// 超过一个页的数据先整体压缩, 可以放入一个页时不再写入溢出链; 否则原来的数据切分为溢出段, 每段分别压缩
+// 内置flate(标准库DEFLATE), 其他算法(snappy, zstd等)由上层在打开数据库之前通过RegisterCodec注册
+// 压缩结果必须是确定的: 回滚转发桩时重新压缩原来的数据, 长度必须与转发桩相同(见forward.go)
+
+const (
+	DICodecShift           = 56
+	DICodecMask     uint64 = 0x1f << DICodecShift
+	diSizeMask      uint64 = 1<<DICodecShift - 1 // dataSize中的长度部分
+	CodecNone       byte   = 0
+	CodecFlate      byte   = 1
+	MaxCodec        byte   = 0x1f
+	MinCompressSize int    = 64 // 更短的数据不压缩
+)
+
+// Codec 压缩算法, 必须可以并发调用
+type Codec interface {
+	Name() string
+	Compress(data []byte) []byte
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	codecLock sync.RWMutex
+	codecs    = map[byte]Codec{CodecFlate: &flateCodec{}}
+)
+
+// RegisterCodec 注册编号为id(1..31)的压缩算法, 同一编号的算法会被覆盖, 已经写入的数据按编号解压
+func RegisterCodec(id byte, codec Codec) {
+	if id == CodecNone || id > MaxCodec {
+		panic(fmt.Sprintf("Error occurs when registering codec, invalid codec id %d", id))
+	}
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	codecs[id] = codec
+}
+
+func codecById(id byte) Codec {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	return codecs[id]
+}
+
+// Option OpenDataManager的选项
+type Option func(dm *DmImpl)
+
+// WithCompression 之后写入的DataItem使用名为name的压缩算法, 算法没有注册时打开数据库panic
+func WithCompression(name string) Option {
+	return func(dm *DmImpl) {
+		codecLock.RLock()
+		defer codecLock.RUnlock()
+		for id, codec := range codecs {
+			if codec.Name() == name {
+				dm.codec = id
+				return
+			}
+		}
+		panic(fmt.Sprintf("Error occurs when opening data manager, compression codec %s is not registered", name))
+	}
+}
+
+// codecOf raw中记录的压缩算法
+func codecOf(raw []byte) byte {
+	return byte((binary.BigEndian.Uint64(raw[SzDIValid:SzDIValid+SzDIDataSize]) & DICodecMask) >> DICodecShift)
+}
+
+// compress 按DataManager的设置压缩data, 不压缩时返回CodecNone以及data
+func (dm *DmImpl) compress(data []byte) (byte, []byte) {
+	if dm.codec == CodecNone || len(data) < MinCompressSize {
+		return CodecNone, data
+	}
+	if compressed := codecById(dm.codec).Compress(data); len(compressed) < len(data) {
+		return dm.codec, compressed
+	}
+	return CodecNone, data
+}
+
+// wrapCompressed 包装codec压缩之后的数据stored
+func wrapCompressed(codec byte, stored []byte, checked bool) []byte {
+	raw := WrapDataItemRaw(stored)
+	if checked {
+		raw = WrapDataItemRawChecked(stored)
+	}
+	if codec != CodecNone {
+		size := binary.BigEndian.Uint64(raw[SzDIValid : SzDIValid+SzDIDataSize])
+		binary.BigEndian.PutUint64(raw[SzDIValid:SzDIValid+SzDIDataSize], size|uint64(codec)<<DICodecShift)
+	}
+	return raw
+}
+
+// decompress 解压uid处codec压缩的数据, 失败时panic(数据损坏或者算法没有注册)
+func decompress(codec byte, data []byte, uid int64) []byte {
+	c := codecById(codec)
+	if c == nil {
+		panic(fmt.Sprintf("Error occurs when reading data item %d, compression codec %d is not registered", uid, codec))
+	}
+	ret, err := c.Decompress(data)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when decompressing data item %d, err = %s", uid, err))
+	}
+	return ret
+}
+
+// compressedItem 压缩的DataItem, GetData返回解压之后的数据, 其他操作作用于压缩的数据本身
+type compressedItem struct {
+	*DataItemImpl
+	codec byte
+}
+
+func (ci *compressedItem) GetData() []byte {
+	return decompress(ci.codec, ci.DataItemImpl.GetData(), ci.uid)
+}
+
+func (ci *compressedItem) GetDataLength() int64 {
+	return int64(len(ci.GetData()))
+}
+
+// flateCodec 标准库DEFLATE, BestSpeed
+type flateCodec struct {
+	writers sync.Pool
+}
+
+func (c *flateCodec) Name() string {
+	return "flate"
+}
+
+func (c *flateCodec) Compress(data []byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	w, _ := c.writers.Get().(*flate.Writer)
+	if w == nil {
+		w, _ = flate.NewWriter(buf, flate.BestSpeed)
+	} else {
+		w.Reset(buf)
+	}
+	_, _ = w.Write(data)
+	_ = w.Close()
+	c.writers.Put(w)
+	return buf.Bytes()
+}
+
+func (c *flateCodec) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return io.ReadAll(r)
+}
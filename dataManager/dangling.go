@@ -0,0 +1,54 @@
+package dataManager
+
+import (
+	"log"
+	"sort"
+)
+
+// 悬空引用
+// 索引等上层模块保存的uid指向的DataItem可能已经失效(例如删除之后索引项没有及时摘除)
+// 上层通过ReadRef读取自己保存的引用, 读到失效的DataItem时记录该uid, 由上层调用TakeDangling之后延迟摘除
+// 同一个uid在被取走之前只记录一次
+
+type danglingRefs struct {
+	pending      map[int64]struct{}
+	total        int64           // 累计记录的悬空引用数
+	forwarded    map[int64]int64 // 经过转发桩的引用, 见forward.go
+	forwardTotal int64
+}
+
+// ReadRef
+// 与Read相同, DataItem失效时返回nil, 同时记录uid为悬空引用
+// DataItem为转发桩时返回最终的DataItem, 同时记录转发
+func (dm *DmImpl) ReadRef(uid int64) DataItem {
+	di := dm.Read(uid)
+	if di == nil {
+		target, forwarded := dm.follow(dm.doRead(uid))
+		if forwarded && target.IsValid() {
+			dm.noteForward(uid, target.GetUid())
+			return target
+		}
+		target.Release()
+		dm.danglingLock.Lock()
+		if _, ext := dm.dangling.pending[uid]; !ext {
+			dm.dangling.pending[uid] = struct{}{}
+			dm.dangling.total += 1
+			log.Printf("[Data Manager] Dangling reference to invalid data item %d\n", uid)
+		}
+		dm.danglingLock.Unlock()
+	}
+	return di
+}
+
+// TakeDangling 取走所有尚未处理的悬空引用(按uid排序)
+func (dm *DmImpl) TakeDangling() []int64 {
+	dm.danglingLock.Lock()
+	defer dm.danglingLock.Unlock()
+	uids := make([]int64, 0, len(dm.dangling.pending))
+	for uid := range dm.dangling.pending {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	dm.dangling.pending = map[int64]struct{}{}
+	return uids
+}
@@ -20,21 +20,24 @@ type DataItem interface {
 	SetValid()
 	GetPage() Page
 	GetUid() int64
+	GetOffset() int64          // DataItem在页中的偏移, 槽式数据页中与uid中的offset(槽位号)不同
+	GetForward() (int64, bool) // 转发桩指向的uid
 	Release()
 	Update(newRaw []byte)
 }
 
 // DataItemImpl
-// RAW: [valid]1[dataSize]8[data]
+// RAW: [valid]1[dataSize]8[data], 开启校验和时见checksum.go
 // raw是Page[offset:offset+raw_length]的一段切片，修改raw将直接修改page上的数据
 // 因为上层（VM）确保了事物之间的隔离性即，两个事物不会并发操作同一个DataItem, 因此对dataItem的修改操作不用加锁
 // 且DataManager的PageCtl模块确保了在添加(Append)操作时不会同时操作一个DataItem（uid）
 // **** 将数据返回给上层时，必须深拷贝，禁止上层对Page中的数据进行修改
 type DataItemImpl struct {
-	page Page // BufferPool中的页, 当前raw位于哪个页
-	uid  int64
-	dm   DataManager
-	raw  []byte
+	page   Page // BufferPool中的页, 当前raw位于哪个页
+	uid    int64
+	offset int64 // raw在页中的偏移
+	dm     DataManager
+	raw    []byte
 }
 
 const (
@@ -45,12 +48,13 @@ const (
 )
 
 func NewDataItem(raw []byte, dm DataManager,
-	page Page, uid int64) DataItem {
+	page Page, uid, offset int64) DataItem {
 	return &DataItemImpl{
-		page: page,
-		uid:  uid,
-		dm:   dm,
-		raw:  raw,
+		page:   page,
+		uid:    uid,
+		offset: offset,
+		dm:     dm,
+		raw:    raw,
 	}
 }
 
@@ -68,7 +72,7 @@ func (di *DataItemImpl) GetData() []byte {
 
 func (di *DataItemImpl) GetDataLength() int64 {
 	length := di.raw[SzDIValid : SzDIValid+SzDIDataSize]
-	return int64(binary.BigEndian.Uint64(length))
+	return int64(binary.BigEndian.Uint64(length) & diSizeMask)
 }
 
 // GetRaw
@@ -84,6 +88,10 @@ func (di *DataItemImpl) GetUid() int64 {
 	return di.uid
 }
 
+func (di *DataItemImpl) GetOffset() int64 {
+	return di.offset
+}
+
 // Release
 // Data Manager层不能Release，确保其被上层模块调用
 func (di *DataItemImpl) Release() {
@@ -1,11 +1,15 @@
 package dataManager
 
 import (
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"myDB/dbError"
+	"myDB/simulation"
 	. "myDB/transactions"
 	"sync"
+	"time"
 )
 
 // DataManager 管理PageCache(BufferPool+Data Source), Page Control, RedoLog
@@ -15,21 +19,101 @@ const PageNumberDbMeta int64 = 1
 
 type DataManager interface {
 	Read(uid int64) DataItem
+	ReadRef(uid int64) DataItem     // 读取上层保存的引用, 失效时返回nil并记录悬空引用
+	TakeDangling() []int64          // 取走记录的悬空引用, 由上层延迟摘除
+	TakeForwarded() map[int64]int64 // 取走ReadRef经过的转发桩(旧uid -> 新uid), 由上层延迟改写
 	ReadSnapShot(uid int64) DataItem
-	Update(xid, uid int64, data []byte) int64
-	Insert(xid int64, data []byte) int64
+	NewReadGuard() ReadGuard // 零拷贝读, 读出的数据在Done之前有效
+	Update(xid, uid int64, data []byte) (int64, error)
+	UpdateIf(xid, uid int64, expected, data []byte) (int64, error) // 当前数据等于expected时才更新(CAS)
+	Load(uid int64) ([]byte, bool)                                 // 与UpdateIf互斥地读出数据的拷贝, 用作UpdateIf的expected
+	Insert(xid int64, data []byte) (int64, error)
+	InsertIn(xid, space int64, data []byte) (int64, error)                 // 向指定表空间插入数据
+	InsertAvoid(xid, space int64, data []byte, avoid int64) (int64, error) // 插入到表空间中avoid之外的页(在线迁移)
+	InsertPacked(xid, space int64, data []byte) (int64, error)             // 同InsertIn, 忽略表空间的填充因子(批量导入)
+	InsertBatch(xid int64, items [][]byte) ([]int64, error)                // 批量插入到尽量少的页, 每个页只记录一条日志, 见batchInsert.go
+	InsertBatchIn(xid, space int64, items [][]byte) ([]int64, error)       // 同InsertBatch, 插入到指定表空间
 	Delete(xid, uid int64)
-	Recover(xid, uid int64) // 回复删除(set valid)
+	Recover(xid, uid int64)                // 回复删除(set valid)
+	Forward(xid, uid, newUid int64)        // 迁移之后将旧的DataItem改写为转发桩, 见forward.go
+	Unforward(xid, uid int64, data []byte) // 回滚Forward, data为原来的数据
+	Purge(xid int64, uids []int64) int     // 回收已经失效的DataItem占用的空间, 见purge.go
 	Release(id DataItem)
 	Close()
+	Checked() CheckedDataManager // 返回error而不是panic的接口, 见checked.go
+
+	BeginBatch(xid int64) // 批量模式, xid的redo log不再逐条刷盘
+	EndBatch(xid int64)   // 结束批量模式并刷盘
+
+	CreateSpace() (int64, error)               // 创建表空间
+	ExportSpace(space int64, dst string) error // 导出表空间数据文件
+	AttachSpace(src string) (int64, error)     // 挂载外部表空间数据文件
+
+	Status() DmStatus                             // 运行状态
+	Stats() DmStats                               // 累计计数器, 见stats.go
+	TakeLogBytes(xid int64) int64                 // xid上次调用之后写入的redo log字节数
+	ReportReplica(name string, lsn int64)         // 记录副本已经应用到的redo log LSN
+	CheckHealth(timeout time.Duration) error      // 日志可写并且缓冲区没有停滞
+	Checkpoint() error                            // 将所有脏页写回数据文件, 日志刷盘并记录checkpoint
+	Sync(flushPages bool) error                   // 持久化屏障, 之前返回的写操作的日志刷盘, flushPages时同时写回脏页
+	VerifyFreeSpace(sample int) (int, int)        // 校验并修正空闲空间表, sample <= 0时全部校验, 返回检查以及修正的记录数
+	SetChecksum(space int64, on bool) error       // 表空间中之后写入的DataItem是否带校验和
+	SetFillFactor(space int64, percent int) error // 表空间之后插入时的填充因子
+	SetUnlogged(space int64) error                // 表空间之后的修改不记录redo log, 崩溃之后清空, 见unlogged.go
+	TakeTruncated() []int64                       // 取走启动时清空的不记录日志的表空间
+	// ReclaimPages 回收space中reachable之外的非空数据页(孤儿页), 返回孤儿页的页号, dryRun时只返回
+	ReclaimPages(xid, space int64, reachable map[int64]struct{}, dryRun bool) []int64
+	PageEvents(space int64, top int) (SpaceEvents, error) // 页事件统计以及事件最多的top个页
+	SpaceSize(space int64) (SpaceSize, error)             // 表空间的磁盘占用, 见spaceSize.go
+	// OffloadCold 将表空间中idle时间内没有访问的区迁移到二级目录dir, 见coldStorage.go
+	OffloadCold(space int64, dir string, idle time.Duration) (TierStats, error)
+	// CompressCold 压缩表空间中idle时间内没有访问的区, 访问时自动解压, 见extentCompression.go
+	CompressCold(space int64, idle time.Duration) (CompressStats, error)
+	// Backup 备份到dir, base为基准备份的目录(为空时全量备份), logs为上层的日志文件, 见backup.go
+	Backup(dir, base string, logs []string) (BackupStats, error)
+	// BackupTo 将在线物理拷贝写入w, 见backupStream.go
+	BackupTo(w io.Writer, logs []string) (BackupStats, error)
+	Scrub(all bool) (ScrubStats, error) // 校验上一次校验之后写回的页(all时为所有页), 见scrub.go
+	// SamplePages 随机选择表空间中约percent%的页, 返回其中有效的DataItem, 见sample.go
+	SamplePages(space int64, percent int, seed int64) (PageSample, error)
+	// Vacuum 整理表空间中所有的槽式数据页, 清理reclaim返回true的失效DataItem, 见vacuum.go
+	Vacuum(xid, space int64, reclaim func(uid int64) bool) (VacuumStats, error)
+
+	Geometry() Geometry // 页大小以及由它决定的常量, 见pageSize.go
+
+	ReadMeta(section MetaSection) ([]byte, bool)      // 读取数据库元数据区的section
+	WriteMeta(section MetaSection, data []byte) error // 写入(data为nil时删除)数据库元数据区的section
 }
 
 type DmImpl struct {
-	pageCache          PageCache
-	pageCtl            PageCtl
+	spaces             map[int64]*TableSpace // 表空间(包括系统表空间)
+	spaceLock          sync.RWMutex          // 保护spaces
+	path               string
+	memory             int64
+	maxSize            int64 // 数据库大小上限(字节)，0表示不限制
 	redo               Log
 	transactionManager TransactionManager
-	metaPage           Page // 数据库元数据页(直到dataManager关闭不会被换出)
+	metaPage           Page                   // 数据库元数据页(直到dataManager关闭不会被换出)
+	readers            sync.WaitGroup         // 未结束的ReadGuard
+	meta               map[MetaSection][]byte // 元数据区的所有section
+	metaPages          int                    // 元数据区占用的页数
+	metaLock           sync.Mutex             // 保护meta
+	dangling           danglingRefs           // 上层读到的悬空引用
+	danglingLock       sync.Mutex             // 保护dangling
+	pageLocks          pageLocks              // 槽式数据页的空间分配
+	itemLocks          itemLocks              // UpdateIf以及Load, 见compareAndSwap.go
+	truncated          []int64                // 启动时清空的不记录日志的表空间, 见unlogged.go
+	changes            *changeTracker         // 写回数据文件的页, 见changedPages.go
+	codec              byte                   // 新写入的DataItem的压缩算法, 见compression.go
+	readOnly           bool                   // 只读模式, 见readOnly.go
+	items              itemCounters           // 见stats.go
+	recovery           time.Duration          // 启动时崩溃恢复的耗时
+	pageSize           int64                  // WithPageSize, 打开之后为数据库的页大小, 见pageSize.go
+	geo                *Geometry              // 页大小以及由它决定的常量, 见pageSize.go
+	keys               KeyProvider            // 页加密的密钥来源, 见pageCipher.go
+	cipher             *pageCipher            // 没有加密时为nil
+	identity           []byte                 // 数据库标识, 之前的版本创建的数据库为nil, 见pageCipher.go
+	files              fileOptions            // 数据文件的打开方式, 见tableSpace.go
 }
 
 // ReadSnapShot
@@ -37,7 +121,11 @@ type DmImpl struct {
 // 一定不会返回nil
 // 应用场景：快照读
 func (dm *DmImpl) ReadSnapShot(uid int64) DataItem {
-	return dm.doRead(uid)
+	di, err := dm.readSnapShot(uid)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when reading data item %d, %s", uid, err))
+	}
+	return di
 }
 
 // Read
@@ -45,99 +133,237 @@ func (dm *DmImpl) ReadSnapShot(uid int64) DataItem {
 // 当DataItem失效时，返回nil
 // 应用场景：当前读
 func (dm *DmImpl) Read(uid int64) DataItem {
-	di := dm.doRead(uid)
-	if !di.IsValid() {
-		di.Release()
+	di, err := dm.readValid(uid)
+	if errors.As(err, new(*ErrorInvalidDataItem)) {
 		return nil
+	} else if err != nil {
+		panic(fmt.Sprintf("Error occurs when reading data item %d, %s", uid, err))
 	}
 	return di
 }
 
 func (dm *DmImpl) doRead(uid int64) DataItem {
-	pageId, offset := uidTrans(uid)
-	if page, err := dm.pageCache.GetPage(pageId); err != nil {
-		panic(fmt.Sprintf("Error occurs when getting pages, err = %s", err))
-	} else {
-		item := dm.getDataItem(page, offset)
-		return item
+	di, err := dm.readItem(uid)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when reading data item %d, %s", uid, err))
 	}
+	return di
 }
 
 // Update
 // 更新数据
 // 尝试更新失效的或者不存在的数据时，panic
-// 更新的数据长度小于，原地更新，否则将当前DataItem设置为无效，并且新插入一个DataItem
+// 更新的数据长度小于，原地更新
+// 否则如果DataItem位于槽式数据页并且页中空间足够(或者整理页之后足够), 在页内移动, uid不变
+// 否则新插入一个DataItem, 当前DataItem改写为指向它的转发桩
 // 返回新数据的地址
+// 新数据超过一个页时先写入新的溢出链, 按溢出头更新(见overflow.go)
+// 需要插入新数据但是超出容量限制时返回error, 原数据保持不变
 // 上层模块保证其操作的安全性（VersionManager）
-func (dm *DmImpl) Update(xid, uid int64, data []byte) int64 {
-	di := dm.Read(uid)
-	if di == nil {
-		panic("Error occurs when updating data item, this data item is invalid")
+func (dm *DmImpl) Update(xid, uid int64, data []byte) (int64, error) {
+	newUid, err := dm.update(xid, uid, data)
+	if itemError(err) {
+		panic(fmt.Sprintf("Error occurs when updating data item %d, %s", uid, err))
+	}
+	return newUid, err
+}
+
+// update 同Update, uid不合法或者DataItem失效时返回error(见checked.go)
+func (dm *DmImpl) update(xid, uid int64, data []byte) (int64, error) {
+	newRaw, err := dm.storedRaw(xid, spaceOf(uid), data) // record -> dataItem
+	if err != nil {
+		return -1, err
+	}
+	if done, err := dm.updateInPage(xid, uid, newRaw); err != nil || done {
+		return uid, err
+	}
+	// INSERT 新数据与旧数据位于同一个表空间
+	// 先插入，插入失败时不删除旧数据
+	// 可以使用填充因子预留的空间
+	newUid, err := dm.insertRaw(xid, spaceOf(uid), newRaw, -1, false)
+	if err != nil {
+		return -1, err
+	}
+	// 旧的DataItem改写为转发桩
+	dm.Forward(xid, uid, newUid)
+	dm.getSpace(spaceOf(uid)).events.split(PageOf(uid))
+	return newUid, nil
+}
+
+// updateInPage 持有页锁检查DataItem有效之后原地更新或者在页内移动, 返回是否完成
+func (dm *DmImpl) updateInPage(xid, uid int64, newRaw []byte) (bool, error) {
+	unlock := dm.lockItemPage(uid)
+	defer unlock()
+	di, err := dm.readValid(uid)
+	if err != nil {
+		return false, err
 	}
 	defer di.Release()
 	oldRaw := di.GetRaw()
-	newRaw := WrapDataItemRaw(data) // record -> dataItem
-	var ret int64
 	if len(oldRaw) >= len(newRaw) {
 		// 原地更新
 		// LOG FIRST
-		dm.redo.UpdateLog(uid, xid, oldRaw, newRaw)
+		dm.redo.UpdateLog(logUid(di), xid, oldRaw, newRaw)
 		di.Update(newRaw)
-		ret = uid
-	} else {
-		// DELETE
-		dm.Delete(xid, uid)
-		// INSERT
-		ret = dm.Insert(xid, data)
+		return true, nil
 	}
-	return ret
+	return dm.relocate(xid, di, newRaw), nil
+}
+
+// lockItemPage 获取uid所在页的页锁, 写入DataItem期间页不会被整理
+func (dm *DmImpl) lockItemPage(uid int64) func() {
+	space, pageId, _ := SplitUid(uid)
+	lock := dm.pageLocks.of(space, pageId)
+	lock.Lock()
+	return lock.Unlock
 }
 
 // Insert
-// 申请向Page Cache插入一段数据
+// 向系统表空间插入数据
+func (dm *DmImpl) Insert(xid int64, data []byte) (int64, error) {
+	return dm.InsertIn(xid, SystemSpace, data)
+}
+
+// InsertIn
+// 申请向space表空间的Page Cache插入一段数据
 // log first and insert next
-// return uid(pageId, offset)
+// return uid(pageId, space, offset)
 // pageCtl的Select方法确保了对page进行Append操作的安全性
-func (dm *DmImpl) Insert(xid int64, data []byte) int64 {
+// 需要申请新页但是超出容量限制时，返回ErrorDatabaseFull/ErrorDiskFull
+func (dm *DmImpl) InsertIn(xid, space int64, data []byte) (int64, error) {
+	return dm.insertIn(xid, space, data, -1, true)
+}
+
+// InsertAvoid
+// 同InsertIn, 不会选择avoid页
+func (dm *DmImpl) InsertAvoid(xid, space int64, data []byte, avoid int64) (int64, error) {
+	return dm.insertIn(xid, space, data, avoid, true)
+}
+
+// InsertPacked
+// 同InsertIn, 不在页中保留填充因子的空闲空间
+func (dm *DmImpl) InsertPacked(xid, space int64, data []byte) (int64, error) {
+	return dm.insertIn(xid, space, data, -1, false)
+}
+
+// insertIn fill时按表空间的填充因子在页中保留空闲空间
+// 超过一个页的数据写入溢出链, 插入溢出头(见overflow.go)
+func (dm *DmImpl) insertIn(xid, space int64, data []byte, avoid int64, fill bool) (int64, error) {
 	// wrap
-	raw := WrapDataItemRaw(data)
+	raw, err := dm.storedRaw(xid, space, data)
+	if err != nil {
+		return -1, err
+	}
+	return dm.insertRaw(xid, space, raw, avoid, fill)
+}
+
+// insertRaw 插入包装好的DataItem
+func (dm *DmImpl) insertRaw(xid, space int64, raw []byte, avoid int64, fill bool) (int64, error) {
+	ts := dm.getSpace(space)
 	length := int64(len(raw))
-	if length > MaxFreeSize {
-		// 暂不支持跨页存储
-		panic("Error occurs when inserting data, err = data length overflow\n")
-	}
-	// find a free page by page Ctl(locks)
-	pi := dm.pageCtl.Select(length)
-	var pageId int64
-	// if necessarily, create a new page
-	if pi == nil {
-		pageId = dm.pageCache.NewPage(DataPage)
-	} else {
-		pageId = pi.PageId
+	reserve := int64(0)
+	if fill {
+		// 空页至少可以放入一个DataItem
+		reserve = ts.reserve()
+		if length+reserve > dm.geo.MaxItemSize {
+			reserve = dm.geo.MaxItemSize - length
+		}
 	}
-	pg, err := dm.pageCache.GetPage(pageId)
+	pg, lock, err := dm.choosePage(space, length, reserve, avoid)
 	if err != nil {
-		panic(fmt.Sprintf("Error occurs when getting page, err = %s", err))
+		return -1, err
+	}
+	defer lock.Unlock()
+	var uid int64
+	if isSlotted(pg.GetData()) {
+		uid = getSpaceUid(space, pg.GetId(), dm.insertSlotted(xid, space, pg, raw))
+	} else {
+		uid = dm.appendData(xid, space, pg, raw)
 	}
+	ts.events.insert(pg.GetId())
+	dm.items.inserted.Add(1)
+	// update pageCtl
+	ts.pageCtl.AddPageInfo(pg.GetId(), pg.GetFree())
+	// release
+	if err := ts.pageCache.ReleasePage(pg); err != nil {
+		panic(fmt.Sprintf("Error occurs when releasing page, err = %s\n", err))
+	}
+	return uid, nil
+}
+
+// choosePage
+// 选择(必要时新建)一个空闲空间至少为length(槽式数据页再加一个槽位)加reserve的页, 跳过avoid
+// 返回时已经持有页锁, 调用方写入之后释放页锁和页, 并将页放回空闲空间表
+func (dm *DmImpl) choosePage(space, length, reserve, avoid int64) (Page, *sync.Mutex, error) {
+	ts := dm.getSpace(space)
+	for {
+		// find a free page by page Ctl(locks)
+		pi := ts.pageCtl.Select(length + SzSlot + reserve)
+		if pi != nil && pi.PageId == avoid {
+			// 重新选择, 选择结束之后放回空闲空间表
+			defer ts.pageCtl.AddPageInfo(pi.PageId, pi.Available)
+			continue
+		}
+		var pageId int64
+		// if necessarily, create a new page
+		if pi == nil {
+			if err := dm.checkQuota(dm.geo.PageSize); err != nil {
+				return nil, nil, err
+			}
+			if ts.pageCache.GetPageNumbers() >= MaxPageId {
+				return nil, nil, &ErrorPageIdOverflow{}
+			}
+			pageId = ts.pageCache.NewPage(SlottedPage)
+			ts.events.allocate()
+		} else {
+			pageId = pi.PageId
+		}
+		page, err := ts.pageCache.GetPage(pageId)
+		if pi != nil && errors.Is(err, dbError.ErrCorruptPage) {
+			// 由FSM载入的空闲空间表中可能有之后损坏的页, 与PageCtl.Init相同不再用于插入
+			log.Printf("[Data Manager] Skip corrupt page, %s\n", err)
+			continue
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Error occurs when getting page, err = %s", err))
+		}
+		// 同一个页上的DataItem可能正在页内移动
+		lock := dm.pageLocks.of(space, pageId)
+		lock.Lock()
+		need := length
+		if isSlotted(page.GetData()) {
+			need += SzSlot
+		}
+		if page.GetFree() < need+reserve {
+			// 空闲空间表与页头不一致, 按页头修正后重新选择
+			log.Printf("[Data Manager] Free space of page %d drifts, recorded %d, actual %d\n", pageId, pi.Available, page.GetFree())
+			ts.pageCtl.AddPageInfo(pageId, page.GetFree())
+			lock.Unlock()
+			if err := ts.pageCache.ReleasePage(page); err != nil {
+				panic(fmt.Sprintf("Error occurs when releasing page, err = %s\n", err))
+			}
+			continue
+		}
+		return page, lock, nil
+	}
+}
+
+// appendData 旧格式的数据页, 追加到页末尾
+func (dm *DmImpl) appendData(xid, space int64, pg Page, raw []byte) int64 {
 	offset := pg.GetUsed()
 	// LOG FIRST
-	dm.redo.InsertLog(getUid(pg.GetId(), offset), xid, raw)
+	uid := getSpaceUid(space, pg.GetId(), offset)
+	dm.redo.InsertLog(uid, xid, raw)
 	// update page data
 	if err := pg.Append(raw); err != nil {
 		panic(fmt.Sprintf("Error occurs when updating page, err = %s\n", err))
 	}
 	log.Printf("[Data Manager LINE 131] finish append %d %d\n", pg.GetId(), offset)
-	// update pageCtl
-	dm.pageCtl.AddPageInfo(pg.GetId(), pg.GetFree())
-	// release
-	if err := dm.pageCache.ReleasePage(pg); err != nil {
-		panic(fmt.Sprintf("Error occurs when releasing page, err = %s\n", err))
-	}
-	return getUid(pg.GetId(), offset)
+	return uid
 }
 
 func (dm *DmImpl) Release(di DataItem) {
-	if err := dm.pageCache.ReleasePage(di.GetPage()); err != nil {
+	if err := dm.getSpace(spaceOf(di.GetUid())).pageCache.ReleasePage(di.GetPage()); err != nil {
 		panic(err)
 	}
 }
@@ -146,106 +372,198 @@ func (dm *DmImpl) Release(di DataItem) {
 // 删除一个DataItem(set invalid)
 // 对于已经删除的DI，不进行任何操作
 func (dm *DmImpl) Delete(xid, uid int64) {
-	di := dm.Read(uid)
-	if di != nil {
-		defer di.Release()
-		// LOG FIRST
-		oldRaw := di.GetRaw()
-		newRaw := make([]byte, len(oldRaw))
-		copy(newRaw, oldRaw)
-		SetRawInvalid(newRaw)
-		dm.redo.UpdateLog(uid, xid, oldRaw, newRaw)
-		di.SetInvalid()
+	if dm.readOnly {
+		panic(&ErrorReadOnly{})
+	}
+	if err := dm.delete(xid, uid); err != nil && !errors.As(err, new(*ErrorInvalidDataItem)) {
+		panic(fmt.Sprintf("Error occurs when deleting data item %d, %s", uid, err))
 	}
 }
 
+// delete 持有页锁检查DataItem有效之后置为无效, DataItem失效时返回ErrorInvalidDataItem
+func (dm *DmImpl) delete(xid, uid int64) error {
+	if dm.readOnly {
+		return &ErrorReadOnly{}
+	}
+	defer dm.lockItemPage(uid)()
+	di, err := dm.readValid(uid)
+	if err != nil {
+		return err
+	}
+	defer di.Release()
+	// LOG FIRST
+	oldRaw := di.GetRaw()
+	newRaw := make([]byte, len(oldRaw))
+	copy(newRaw, oldRaw)
+	SetRawInvalid(newRaw)
+	dm.redo.UpdateLog(logUid(di), xid, oldRaw, newRaw)
+	di.SetInvalid()
+	dm.items.deleted.Add(1)
+	dm.items.invalidated.Add(1)
+	return nil
+}
+
 // Recover
 // 恢复已经删除的DataItem (set valid)
 // 对于已经valid的DI，不进行任何操作
 func (dm *DmImpl) Recover(xid, uid int64) {
-	pageId, offset := uidTrans(uid)
-	if page, err := dm.pageCache.GetPage(pageId); err != nil {
-		panic(fmt.Sprintf("Error occurs when getting pages, err = %s", err))
-	} else {
-		di := dm.getDataItem(page, offset)
-		if !di.IsValid() {
-			// LOG FIRST
-			oldRaw := di.GetRaw()
-			newRaw := make([]byte, len(oldRaw))
-			copy(newRaw, oldRaw)
-			SetRawValid(newRaw)
-			dm.redo.UpdateLog(uid, xid, oldRaw, newRaw)
-			di.SetValid()
-		}
-		di.Release()
+	defer dm.lockItemPage(uid)()
+	di := dm.doRead(uid)
+	if !di.IsValid() {
+		// LOG FIRST
+		oldRaw := di.GetRaw()
+		newRaw := make([]byte, len(oldRaw))
+		copy(newRaw, oldRaw)
+		SetRawValid(newRaw)
+		dm.redo.UpdateLog(logUid(di), xid, oldRaw, newRaw)
+		di.SetValid()
 	}
+	di.Release()
+}
+
+func (dm *DmImpl) BeginBatch(xid int64) {
+	dm.redo.BeginBatch(xid)
+}
+
+func (dm *DmImpl) EndBatch(xid int64) {
+	dm.redo.EndBatch(xid)
 }
 
 func (dm *DmImpl) Close() {
+	if dm.readOnly {
+		dm.closeReadOnly()
+		return
+	}
+	// ReadGuard引用的页必须在关闭PageCache之前释放
+	dm.readers.Wait()
 	dm.transactionManager.Close()
 	dm.redo.Close()
+	dm.saveFreeSpaceMaps()
+	system := dm.getSpace(SystemSpace)
 	dm.metaPage.UpdateVersion()
-	if err := dm.pageCache.ReleasePage(dm.metaPage); err != nil {
+	dm.metaPage.SetDirty(true) // 版本号写回之后才认为是正常退出
+	if err := system.pageCache.ReleasePage(dm.metaPage); err != nil {
 		panic(fmt.Sprintf("Error occurs when releasing db meta page, err = %s", err))
 	}
-	dm.pageCache.Close()
+	dm.spaceLock.Lock()
+	defer dm.spaceLock.Unlock()
+	for _, ts := range dm.spaces {
+		ts.pageCache.Close()
+	}
+	if err := dm.changes.save(nil); err != nil {
+		log.Printf("[Data Manager] Error occurs when saving changed pages, err = %s\n", err)
+	}
 }
 
 func (dm *DmImpl) init() {
-	if metaPage, err := dm.pageCache.GetPage(PageNumberDbMeta); err != nil {
+	system := dm.getSpace(SystemSpace)
+	if metaPage, err := system.pageCache.GetPage(PageNumberDbMeta); err != nil {
 		panic(err)
 	} else {
 		dm.metaPage = metaPage
 	}
 	// 数据恢复
-	if !dm.metaPage.CheckInitVersion() {
-		dm.redo.CrashRecover(dm.pageCache, dm.transactionManager)
+	crashed := !dm.metaPage.CheckInitVersion()
+	if crashed {
+		start := simulation.Now()
+		dm.redo.CrashRecover(dm.getOrOpenSpace, dm.transactionManager)
+		dm.recovery = simulation.Now().Sub(start)
 	}
 	// 重置日志文件
 	dm.redo.ResetLog()
 	// 初始化版本号
 	dm.metaPage.InitVersion()
-	dm.pageCache.DoFlush(dm.metaPage)
+	dm.recordPageSize()
+	dm.recordEncryption()
+	dm.recordChecksum()
+	dm.recordIdentity()
+	system.pageCache.DoFlush(dm.metaPage)
+	dm.loadMeta()
+	dm.loadUnloggedSpaces(crashed)
+	dm.loadChecksumSpaces()
+	dm.loadFillFactors()
+	dm.loadFreeSpaceMaps(crashed)
 	log.Printf("[Data Manager] Initialze page cache\n")
-	dm.pageCtl.Init(dm.pageCache)
+	for _, ts := range dm.spaces {
+		dm.initPageCtl(ts)
+	}
 }
 
 // getDataItem
 // get DataItem from the dataManger by the page
-func (dm *DmImpl) getDataItem(page Page, offset int64) DataItem {
+// offset为uid中的offset, 槽式数据页中为槽位号
+func (dm *DmImpl) getDataItem(page Page, space, offset int64) DataItem {
 	// start from the offset of data
-	data := page.GetData()
-	// RAW [valid]1[size]8[data]
-	dataSize := int64(binary.BigEndian.Uint64(data[offset+SzDIValid : offset+SzDIValid+SzDIDataSize]))
-	raw := data[offset : offset+SzDIValid+SzDIDataSize+dataSize]
-	uid := getUid(page.GetId(), offset)
-	// raw直接引用给DataItem
-	return NewDataItem(raw, dm, page, uid)
-}
-
-// uid 高32位为pageId, 低32位为offset
-func uidTrans(uid int64) (pageId, offset int64) {
-	offset = uid & ((1 << 32) - 1)
-	uid >>= 32
-	pageId = uid & ((1 << 32) - 1)
-	return
+	data, position := page.Locate(offset)
+	di, err := dm.newDataItem(page, space, offset, data, position)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when reading data item, %s", err))
+	}
+	return di
 }
 
-func getUid(pageId, offset int64) int64 {
-	return (pageId << 32) | offset
+// newDataItem data为页的数据, position为DataItem在页中的位置; 带校验和的DataItem校验和不一致时返回CorruptPage
+func (dm *DmImpl) newDataItem(page Page, space, offset int64, data []byte, position int64) (DataItem, error) {
+	// RAW [valid]1[size]8[data]([checksum]4)
+	_, rawSize, checked := itemSize(data, position)
+	raw := data[position : position+rawSize]
+	uid := getSpaceUid(space, page.GetId(), offset)
+	if checked && raw[0] != DIForward {
+		if err := itemChecksum(raw, uid); err != nil {
+			return nil, err
+		}
+	}
+	// raw直接引用给DataItem
+	di := NewDataItem(raw, dm, page, uid, position)
+	if raw[0] != DIForward && isOverflow(raw) {
+		return &overflowItem{DataItemImpl: di.(*DataItemImpl), dm: dm}, nil
+	}
+	if codec := codecOf(raw); raw[0] != DIForward && codec != CodecNone {
+		return &compressedItem{DataItemImpl: di.(*DataItemImpl), codec: codec}, nil
+	}
+	return di, nil
 }
 
-func OpenDataManager(path string, memory int64, tm TransactionManager) DataManager {
-	pc := NewPageCacheRefCountFileSystemImpl(uint32(memory/PageSize), path, &sync.Mutex{})
-	pageCtl := NewPageCtl(pc)
-	redo := OpenRedoLog(path, &sync.Mutex{})
+// Open 打开(不存在时创建)path中的数据库
+// 页大小(WithPageSize)或者密钥(WithEncryption)与数据库不一致, 以及段大小(WithSegmentSize)不合法时返回错误, 此时没有打开任何文件
+func Open(path string, memory, maxSize int64, tm TransactionManager, opts ...Option) (DataManager, error) {
 	dm := &DmImpl{
-		pageCache:          pc,
-		pageCtl:            pageCtl,
-		redo:               redo,
+		spaces:             map[int64]*TableSpace{},
+		path:               path,
+		memory:             memory,
+		maxSize:            maxSize,
 		transactionManager: tm,
+		dangling:           danglingRefs{pending: map[int64]struct{}{}, forwarded: map[int64]int64{}},
+	}
+	for _, opt := range opts {
+		opt(dm)
+	}
+	if err := dm.openCipher(); err != nil {
+		return nil, err
+	}
+	if err := dm.openGeometry(); err != nil {
+		return nil, err
+	}
+	if err := dm.openSegmentSize(); err != nil {
+		return nil, err
+	}
+	redo := OpenRedoLog(path, &sync.Mutex{})
+	dm.redo = &unloggedFilter{Log: redo, dm: dm}
+	dm.changes = loadChangeTracker(path)
+	dm.spaces[SystemSpace] = openTableSpace(path, SystemSpace, memory, redo.Flush, dm.changes, dm.cipher, dm.geo, &dm.files, false)
+	for _, space := range listTableSpaces(path) {
+		dm.spaces[space] = openTableSpace(path, space, memory, redo.Flush, dm.changes, dm.cipher, dm.geo, &dm.files, false)
 	}
 	dm.init()
 	log.Printf("[Data Manager] Initialize data manager\n")
+	return dm, nil
+}
+
+// OpenDataManager 同Open, 打开失败时panic
+func OpenDataManager(path string, memory, maxSize int64, tm TransactionManager, opts ...Option) DataManager {
+	dm, err := Open(path, memory, maxSize, tm, opts...)
+	if err != nil {
+		panic(err)
+	}
 	return dm
 }
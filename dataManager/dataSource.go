@@ -2,7 +2,9 @@ package dataManager
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"myDB/simulation"
 	"os"
 	"sync"
 )
@@ -12,14 +14,19 @@ type DataSource interface {
 	FlushBackToDataSource(obj PoolObj) error
 	Truncate(size int64) error
 	Close() error
+	Sync() error // 刷盘
 	GetDataLength() int64
 }
 
 // FileSystemDataSource
 
 type FileSystemDataSource struct {
-	file *os.File
+	file *segmentedFile
 	lock *sync.Mutex
+	wal  func()    // 写回页之前调用, 可以为nil
+	tier *pageTier // 页所在的文件(数据文件或者冷文件), 见coldStorage.go
+	// 双写缓冲, 没有开启时为nil, 见doubleWrite.go
+	dblwr *doubleWrite
 }
 
 const (
@@ -31,26 +38,55 @@ type FileSystemObj interface {
 	GetOffset() int64
 }
 
-func NewFileSystemDataSource(path string, lock *sync.Mutex) DataSource {
-	f, err := os.OpenFile(path+FileSuffix, os.O_RDWR, 0666)
+func NewFileSystemDataSource(path string, lock *sync.Mutex, wal func()) DataSource {
+	return newFileSystemDataSource(path, lock, wal, openPageTier(path+FileSuffix, defaultGeometry, false))
+}
+
+func newFileSystemDataSource(path string, lock *sync.Mutex, wal func(), tier *pageTier) DataSource {
+	f, err := openSegmentedFile(path+FileSuffix, tier.geo.PageSize, tier.files, tier.readOnly)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			f, err = os.Create(path + FileSuffix)
-			if err != nil {
-				panic(err)
-			}
-		} else {
-			panic(err)
-		}
+		panic(err)
 	}
 	log.Printf("[Data Manager] Open source file\n")
+	tier.primary = f
 	fsd := &FileSystemDataSource{
 		file: f,
 		lock: lock,
+		wal:  wal,
+		tier: tier,
+	}
+	if !tier.readOnly {
+		if err := fsd.openDoubleWrite(); err != nil {
+			panic(fmt.Sprintf("Error occurs when opening double write file of %s, err = %s", f.Name(), err))
+		}
 	}
 	return fsd
 }
 
+// openDoubleWrite 修复双写文件中记录的不完整的页, 开启双写时清空并打开双写文件, 否则删除
+func (ch *FileSystemDataSource) openDoubleWrite() error {
+	restored, err := restoreDoubleWrite(ch.file.Name(), ch.tier)
+	if err != nil {
+		return err
+	}
+	if restored > 0 {
+		if err := ch.syncFiles(); err != nil {
+			return err
+		}
+		log.Printf("[Data Manager] Restore %d torn pages of %s from double write file\n", restored, ch.file.Name())
+	}
+	if !ch.tier.files.doubleWrite {
+		if err := os.Remove(ch.file.Name() + DoubleWriteSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if ch.dblwr, err = openDoubleWrite(ch.file.Name()); err != nil {
+		return err
+	}
+	return ch.dblwr.reset()
+}
+
 // GetFromDataSource
 // 缓存未命中的执行逻辑
 // 从文件系统中读取, 返回读到的字节数组
@@ -62,10 +98,39 @@ func (ch *FileSystemDataSource) GetFromDataSource(obj PoolObj) ([]byte, error) {
 	}
 	offset, size := fso.GetOffset(), fso.GetDataSize()
 	buf := make([]byte, size)
-	_, err := ch.file.ReadAt(buf, offset)
+	// 压缩的区在访问时解压, 见extentCompression.go
+	if err := ch.tier.inflate(offset); err != nil {
+		return nil, err
+	}
+	ch.tier.lock.RLock()
+	defer ch.tier.lock.RUnlock()
+	_, err := ch.tier.fileAt(offset).ReadAt(buf, offset)
 	if err != nil {
 		return nil, err
 	}
+	// 校验页校验和, 见pageChecksum.go
+	pageId := offset/ch.tier.geo.PageSize + 1
+	stamped, err := ch.tier.geo.verifyPage(ch.file.Name(), pageId, buf)
+	if err != nil {
+		repaired, err := ch.tier.geo.repairPage(err.(*ErrorPageChecksum), buf)
+		if err != nil {
+			return nil, err
+		}
+		// 只读模式下修复的页不写回
+		if ch.tier.readOnly {
+			return repaired, nil
+		}
+		if err := ch.writePage(pageId, offset, ch.tier.encodePage(pageId, repaired)); err != nil {
+			return nil, err
+		}
+		ch.tier.fsm.record(pageId, repaired)
+		return repaired, nil
+	}
+	// 解密, 见pageCipher.go
+	if err := ch.tier.decodePage(pageId, buf, stamped); err != nil {
+		return nil, err
+	}
+	ch.tier.fsm.record(pageId, buf)
 	return buf, nil
 }
 
@@ -77,21 +142,89 @@ func (ch *FileSystemDataSource) FlushBackToDataSource(obj PoolObj) error {
 	if !ok {
 		panic("File System Data Source illegal param\n")
 	}
+	if ch.tier.readOnly {
+		return &ErrorReadOnly{}
+	}
+	// WAL: 先写日志
+	if ch.wal != nil {
+		ch.wal()
+	}
+	if err := simulation.Fault("page.flush"); err != nil {
+		return err
+	}
+	if err := ch.tier.inflate(fso.GetOffset()); err != nil {
+		return err
+	}
 	obj.Lock()
 	defer obj.Unlock()
-	_, err := ch.file.WriteAt(fso.GetData(), fso.GetOffset())
+	ch.tier.lock.RLock()
+	defer ch.tier.lock.RUnlock()
+	pageId := fso.GetOffset()/ch.tier.geo.PageSize + 1
+	if err := ch.writePage(pageId, fso.GetOffset(), ch.tier.encodePage(pageId, fso.GetData())); err != nil {
+		return err
+	}
+	ch.tier.changes.mark(ch.tier.space, pageId)
+	ch.tier.fsm.record(pageId, fso.GetData())
+	return nil
+}
+
+// writePage 写入带校验和(以及加密)的页, 开启双写时先写入双写文件, 调用方持有页表的读锁
+func (ch *FileSystemDataSource) writePage(pageId, offset int64, page []byte) error {
+	if ch.dblwr != nil {
+		if err := ch.dblwr.write(pageId, page, ch.syncFiles); err != nil {
+			return err
+		}
+	}
+	_, err := ch.tier.fileAt(offset).WriteAt(page, offset)
 	return err
 }
 
 func (ch *FileSystemDataSource) Truncate(size int64) error {
-	return ch.file.Truncate(size)
+	if err := ch.file.Truncate(size); err != nil {
+		return err
+	}
+	// 截断的页不能再从双写文件恢复
+	if ch.dblwr != nil {
+		if err := ch.Sync(); err != nil {
+			return err
+		}
+		return ch.dblwr.reset()
+	}
+	return nil
 }
 
 func (ch *FileSystemDataSource) Close() error {
+	if ch.dblwr != nil {
+		if err := ch.Sync(); err != nil {
+			return err
+		}
+		if err := ch.dblwr.remove(); err != nil {
+			return err
+		}
+	}
+	if err := ch.tier.close(); err != nil {
+		return err
+	}
 	return ch.file.Close()
 }
 
+func (ch *FileSystemDataSource) Sync() error {
+	ch.tier.lock.RLock()
+	defer ch.tier.lock.RUnlock()
+	return ch.syncFiles()
+}
+
+// syncFiles 数据文件以及冷文件刷盘, 调用方持有页表的读锁
+func (ch *FileSystemDataSource) syncFiles() error {
+	if ch.tier.cold != nil {
+		if err := ch.tier.cold.Sync(); err != nil {
+			return err
+		}
+	}
+	return ch.file.Sync()
+}
+
 func (ch *FileSystemDataSource) GetDataLength() int64 {
-	stat, _ := ch.file.Stat()
-	return stat.Size()
+	size, _ := ch.file.Size()
+	return size
 }
@@ -0,0 +1,128 @@
+package dataManager
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"unsafe"
+)
+
+// 数据文件的文件后端
+// 默认通过OS页缓存读写数据文件, 页同时缓存在PageCache以及OS页缓存中(双重缓存), 大量写回堆积在OS缓存中时刷盘的耗时不可预测
+// WithFileBackend(Direct)打开的数据库的数据文件(包括段)使用O_DIRECT读写, 页只缓存在PageCache中, 数据库占用的内存由缓冲池的大小决定
+// O_DIRECT要求缓冲区地址, 偏移以及长度按DirectIOAlign对齐: 页大小至少4K, 整页的读写只在缓冲区没有对齐时拷贝到对齐的缓冲区,
+// 没有对齐的读写(很少)读出覆盖它的对齐区间之后拷贝或者修改再写回; 文件系统不支持O_DIRECT(例如tmpfs)时退化为通过OS页缓存读写
+// DataSync之后数据文件刷盘使用fdatasync, 不刷新与读取数据无关的文件元数据(修改时间等); 非linux平台忽略这两个选项
+// 只作用于数据文件, redo log, undo log以及冷文件, 双写文件等仍然通过OS页缓存读写; 与双写一样属于每个数据库
+
+const DirectIOAlign int64 = 4096
+
+// FileBackend 数据文件的读写方式
+type FileBackend struct {
+	Direct   bool // O_DIRECT, 绕过OS页缓存
+	DataSync bool // 刷盘使用fdatasync
+}
+
+// WithFileBackend 数据库的数据文件的读写方式
+func WithFileBackend(backend FileBackend) Option {
+	return func(dm *DmImpl) {
+		dm.files.backend = backend
+	}
+}
+
+// openDataFile 按文件后端打开数据文件(或者段), direct为是否请求O_DIRECT, 返回是否使用O_DIRECT
+func openDataFile(name string, mode int, direct bool) (*os.File, bool, error) {
+	if !direct || directFlag == 0 {
+		f, err := os.OpenFile(name, mode, 0666)
+		return f, false, err
+	}
+	f, err := os.OpenFile(name, mode|directFlag, 0666)
+	if err == nil {
+		return f, true, nil
+	}
+	if !errors.Is(err, errDirectUnsupported) {
+		return nil, false, err
+	}
+	log.Printf("[Data Manager] O_DIRECT isn't supported for %s, use buffered IO\n", name)
+	f, err = os.OpenFile(name, mode, 0666)
+	return f, false, err
+}
+
+// alignedBuffer 起始地址按DirectIOAlign对齐的缓冲区
+func alignedBuffer(size int64) []byte {
+	buf := make([]byte, size+DirectIOAlign)
+	shift := int64(uintptr(unsafe.Pointer(&buf[0]))) & (DirectIOAlign - 1)
+	if shift != 0 {
+		shift = DirectIOAlign - shift
+	}
+	return buf[shift : shift+size]
+}
+
+func isAligned(buf []byte, offset int64) bool {
+	return len(buf) > 0 && int64(uintptr(unsafe.Pointer(&buf[0])))&(DirectIOAlign-1) == 0 &&
+		offset&(DirectIOAlign-1) == 0 && int64(len(buf))&(DirectIOAlign-1) == 0
+}
+
+// alignedRange 覆盖[offset, offset + length)的对齐区间
+func alignedRange(offset int64, length int) (int64, int64) {
+	start := offset &^ (DirectIOAlign - 1)
+	end := (offset + int64(length) + DirectIOAlign - 1) &^ (DirectIOAlign - 1)
+	return start, end - start
+}
+
+// directReadAt 从O_DIRECT打开的文件读取
+func directReadAt(f *os.File, buf []byte, offset int64) (int, error) {
+	if len(buf) == 0 || isAligned(buf, offset) {
+		return f.ReadAt(buf, offset)
+	}
+	start, size := alignedRange(offset, len(buf))
+	tmp := alignedBuffer(size)
+	n, err := f.ReadAt(tmp, start)
+	if skip := offset - start; int64(n) > skip {
+		n = copy(buf, tmp[skip:n])
+	} else {
+		n = 0
+	}
+	if n == len(buf) {
+		return n, nil
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// directWriteAt 向O_DIRECT打开的文件写入, 没有对齐时读出对齐区间, 修改之后写回, 文件的大小与直接写入相同
+func directWriteAt(f *os.File, buf []byte, offset int64) (int, error) {
+	if len(buf) == 0 || isAligned(buf, offset) {
+		return f.WriteAt(buf, offset)
+	}
+	start, size := alignedRange(offset, len(buf))
+	aligned := offset == start && int64(len(buf)) == size
+	tmp := alignedBuffer(size)
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !aligned {
+		if _, err := f.ReadAt(tmp, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+	}
+	copy(tmp[offset-start:], buf)
+	if _, err := f.WriteAt(tmp, start); err != nil {
+		return 0, err
+	}
+	// 对齐区间超出原来的文件末尾时截断
+	if start+size > stat.Size() {
+		end := offset + int64(len(buf))
+		if end < stat.Size() {
+			end = stat.Size()
+		}
+		if err := f.Truncate(end); err != nil {
+			return 0, err
+		}
+	}
+	return len(buf), nil
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package dataManager
+
+import (
+	"os"
+	"syscall"
+)
+
+const directFlag = syscall.O_DIRECT
+
+// errDirectUnsupported 文件系统不支持O_DIRECT时open返回EINVAL
+var errDirectUnsupported error = syscall.EINVAL
+
+// syncDataFile 数据文件刷盘, DataSync时使用fdatasync
+func syncDataFile(f *os.File, dataSync bool) error {
+	if !dataSync {
+		return f.Sync()
+	}
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := conn.Control(func(fd uintptr) {
+		for {
+			if serr = syscall.Fdatasync(int(fd)); serr != syscall.EINTR {
+				return
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	if serr != nil {
+		return &os.PathError{Op: "fdatasync", Path: f.Name(), Err: serr}
+	}
+	return nil
+}
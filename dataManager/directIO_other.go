@@ -0,0 +1,18 @@
+//go:build !linux
+
+package dataManager
+
+import (
+	"errors"
+	"os"
+)
+
+// 非linux平台不使用O_DIRECT
+const directFlag = 0
+
+var errDirectUnsupported = errors.New("O_DIRECT isn't supported")
+
+// syncDataFile 非linux平台忽略DataSync
+func syncDataFile(f *os.File, dataSync bool) error {
+	return f.Sync()
+}
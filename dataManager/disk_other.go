@@ -0,0 +1,8 @@
+//go:build !unix
+
+package dataManager
+
+// diskFree 非unix平台不检查磁盘剩余空间
+func diskFree(dir string) int64 {
+	return -1
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package dataManager
+
+import "syscall"
+
+// diskFree 返回dir所在文件系统的可用空间(字节)
+func diskFree(dir string) int64 {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return -1
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize)
+}
@@ -0,0 +1,148 @@
+package dataManager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"sync"
+)
+
+// 双写缓冲
+// 页写回数据文件的过程中崩溃可能留下一半新一半旧的页(torn page), 页校验和可以发现, 但是redo log以页的完整内容为前提, 无法修复
+// 开启双写(WithDoubleWrite)之后, 页写回数据文件之前先写入表空间的双写文件(<数据文件>.dblwr)并刷盘, 之后再写入原位置
+// 双写文件由DoubleWriteSlots个槽位组成, 按顺序写入: [Seq]8[PageId]8[Checksum]4[Page]PageSize, 校验和覆盖槽位中其余的内容
+// 槽位循环使用, 重新使用槽位之前先把数据文件刷盘, 因此双写文件中保存了所有可能没有落盘的页
+// 打开表空间时(崩溃恢复之前)检查双写文件: 每个页取序号最大的完整副本, 数据文件中的页校验失败, 不完整或者没有校验和并且与副本不同时用副本覆盖,
+// 之后数据文件刷盘并清空双写文件; 正常关闭以及截断数据文件时同样清空
+// 每次写回多一次写入以及fsync, 默认关闭; 关闭时打开表空间仍然检查已有的双写文件, 只读打开时不检查
+
+const (
+	DoubleWriteSuffix string = ".dblwr"
+	DoubleWriteSlots  int64  = 128
+	SzDoubleWriteHead int64  = 20
+)
+
+// WithDoubleWrite 数据库的表空间是否使用双写缓冲
+func WithDoubleWrite(enabled bool) Option {
+	return func(dm *DmImpl) {
+		dm.files.doubleWrite = enabled
+	}
+}
+
+type doubleWrite struct {
+	lock sync.Mutex
+	file *os.File
+	next int64 // 下一个写入的槽位
+	seq  int64
+}
+
+func openDoubleWrite(dataFile string) (*doubleWrite, error) {
+	f, err := os.OpenFile(dataFile+DoubleWriteSuffix, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &doubleWrite{file: f}, nil
+}
+
+func doubleWriteSlotSize(pageSize int64) int64 {
+	return SzDoubleWriteHead + pageSize
+}
+
+func doubleWriteChecksum(slot []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(slot[:16]), crc32.IEEETable, slot[SzDoubleWriteHead:])
+}
+
+// write 写入页(带页校验和)的副本并刷盘, 槽位用完时先调用sync把数据文件刷盘
+func (d *doubleWrite) write(pageId int64, page []byte, sync func() error) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.next == DoubleWriteSlots {
+		if err := sync(); err != nil {
+			return err
+		}
+		d.next = 0
+	}
+	d.seq++
+	size := doubleWriteSlotSize(int64(len(page)))
+	slot := make([]byte, size)
+	binary.BigEndian.PutUint64(slot, uint64(d.seq))
+	binary.BigEndian.PutUint64(slot[8:], uint64(pageId))
+	copy(slot[SzDoubleWriteHead:], page)
+	binary.BigEndian.PutUint32(slot[16:], doubleWriteChecksum(slot))
+	if _, err := d.file.WriteAt(slot, d.next*size); err != nil {
+		return err
+	}
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+	d.next++
+	return nil
+}
+
+// reset 清空双写文件, 调用方保证数据文件已经刷盘
+func (d *doubleWrite) reset() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.file.Truncate(0); err != nil {
+		return err
+	}
+	d.next = 0
+	return d.file.Sync()
+}
+
+// remove 关闭并删除双写文件, 调用方保证数据文件已经刷盘
+func (d *doubleWrite) remove() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(d.file.Name())
+}
+
+// restoreDoubleWrite 用双写文件中的副本修复数据文件dataFile中不完整的页, 返回修复的页数
+func restoreDoubleWrite(dataFile string, tier *pageTier) (int, error) {
+	raw, err := os.ReadFile(dataFile + DoubleWriteSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	size := doubleWriteSlotSize(tier.geo.PageSize)
+	latest, seqs := map[int64][]byte{}, map[int64]uint64{}
+	for offset := int64(0); offset+size <= int64(len(raw)); offset += size {
+		slot := raw[offset : offset+size]
+		// 写入槽位时崩溃, 对应的页还没有开始写入数据文件
+		if binary.BigEndian.Uint32(slot[16:]) != doubleWriteChecksum(slot) {
+			continue
+		}
+		seq, pageId := binary.BigEndian.Uint64(slot), int64(binary.BigEndian.Uint64(slot[8:]))
+		if seq > seqs[pageId] {
+			latest[pageId], seqs[pageId] = slot[SzDoubleWriteHead:], seq
+		}
+	}
+	restored := 0
+	current := make([]byte, tier.geo.PageSize)
+	for pageId, page := range latest {
+		offset := (pageId - 1) * tier.geo.PageSize
+		file := tier.fileAt(offset)
+		if n, _ := file.ReadAt(current, offset); n == len(current) && intactPage(tier.geo, pageId, current, page) {
+			continue
+		}
+		if _, err := file.WriteAt(page, offset); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// intactPage 数据文件中的页是否完整, 没有校验和的页与副本相同时认为完整
+func intactPage(geo *Geometry, pageId int64, current, page []byte) bool {
+	if stamped, err := geo.checkStamp("", pageId, current); err != nil || stamped {
+		return err == nil
+	}
+	return bytes.Equal(current, page)
+}
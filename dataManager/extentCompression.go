@@ -0,0 +1,352 @@
+package dataManager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"myDB/simulation"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 按温度自动压缩区
+// 数据文件中idle时间内没有访问的完整区(访问时间见coldStorage.go)整体压缩之后追加到压缩文件(<数据文件>.z), 之后在数据文件中释放该区(打洞)
+// 压缩索引(<数据文件>.zidx)记录压缩算法以及每个压缩区在压缩文件中的位置, 长度和校验和
+// 压缩时持有页表的写锁: 压缩文件刷盘之后原子地写入压缩索引, 最后释放数据文件中的区; 崩溃发生在写入索引之前时区仍然位于数据文件, 追加的内容在打开时截掉
+// 缓存未命中以及写回压缩区中的页时先解压整个区(持有页表的写锁): 写回数据文件并刷盘之后从索引中删除, 压缩文件中的空间打洞释放, 没有压缩区时清空压缩文件
+// 备份, 导出以及校验读取压缩区时解压(最近解压的区缓存一份), 不写回数据文件; 只读打开时同样只解压不写回
+// 0号区, 最后一个不完整的区以及冷区(见coldStorage.go)不压缩, 压缩区不迁移到冷文件; 压缩之后节省不到一个页的区不压缩
+
+const (
+	ZipSuffix      string = ".z"
+	ZipIndexSuffix string = ".zidx"
+)
+
+type ErrorExtentCompressed struct{}
+
+func (err *ErrorExtentCompressed) Error() string {
+	return "Extent is compressed, decompress it before writing"
+}
+
+type ErrorZipChecksum struct {
+	File   string
+	Extent int64
+}
+
+func (err *ErrorZipChecksum) Error() string {
+	return fmt.Sprintf("Compressed extent %d of %s is corrupt", err.Extent, err.File)
+}
+
+// CompressStats 表空间的区压缩状态
+type CompressStats struct {
+	Compressed int64 // 本次压缩的区数
+	Extents    int64 // 压缩的区数
+	Bytes      int64 // 压缩的区解压之后的字节数
+	Stored     int64 // 压缩的区在压缩文件中的字节数
+}
+
+// zippedExtent 压缩区在压缩文件中的位置
+type zippedExtent struct {
+	Offset int64
+	Length int64
+	Crc    uint32
+}
+
+// zipIndex 压缩索引的持久化格式
+type zipIndex struct {
+	Codec   byte
+	Extents map[int64]zippedExtent
+}
+
+type extentZip struct {
+	name    string // 数据文件
+	file    *os.File
+	codec   byte
+	extent  int64 // 一个区的字节数
+	extents map[int64]zippedExtent
+	end     int64 // 压缩文件的末尾
+
+	cacheLock sync.Mutex // 保护最近解压的区
+	cached    int64
+	cache     []byte
+}
+
+// openExtentZip 读取数据文件dataFile的压缩索引, 没有索引时不打开压缩文件
+func openExtentZip(dataFile string, mode int, pageSize int64) *extentZip {
+	z := &extentZip{name: dataFile, codec: CodecFlate, extent: ExtentPages * pageSize, extents: map[int64]zippedExtent{}, cached: -1}
+	raw, err := os.ReadFile(dataFile + ZipIndexSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return z
+	} else if err != nil {
+		panic(fmt.Sprintf("Error occurs when reading compressed index %s, err = %s", dataFile+ZipIndexSuffix, err))
+	}
+	index := &zipIndex{}
+	if err := json.Unmarshal(raw, index); err != nil {
+		panic(fmt.Sprintf("Error occurs when parsing compressed index %s, err = %s", dataFile+ZipIndexSuffix, err))
+	}
+	if codecById(index.Codec) == nil {
+		panic(fmt.Sprintf("Error occurs when opening compressed index %s, codec %d isn't registered", dataFile+ZipIndexSuffix, index.Codec))
+	}
+	if z.file, err = os.OpenFile(dataFile+ZipSuffix, mode, 0666); err != nil {
+		panic(fmt.Sprintf("Error occurs when opening compressed file %s, err = %s", dataFile+ZipSuffix, err))
+	}
+	z.codec, z.extents = index.Codec, index.Extents
+	if z.extents == nil {
+		z.extents = map[int64]zippedExtent{}
+	}
+	for _, ze := range z.extents {
+		if ze.Offset+ze.Length > z.end {
+			z.end = ze.Offset + ze.Length
+		}
+	}
+	// 截掉写入索引之前崩溃留下的内容
+	if mode != os.O_RDONLY {
+		if err := z.file.Truncate(z.end); err != nil {
+			panic(fmt.Sprintf("Error occurs when truncating compressed file %s, err = %s", dataFile+ZipSuffix, err))
+		}
+	}
+	log.Printf("[Data Manager] Open %d compressed extents in %s\n", len(z.extents), dataFile+ZipSuffix)
+	return z
+}
+
+func (z *extentZip) zipped(extent int64) bool {
+	_, ext := z.extents[extent]
+	return ext
+}
+
+// read 解压区, 调用方持有页表的锁
+func (z *extentZip) read(extent int64) ([]byte, error) {
+	z.cacheLock.Lock()
+	defer z.cacheLock.Unlock()
+	if z.cached == extent {
+		return z.cache, nil
+	}
+	ze := z.extents[extent]
+	raw := make([]byte, ze.Length)
+	if _, err := z.file.ReadAt(raw, ze.Offset); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(raw) != ze.Crc {
+		return nil, &ErrorZipChecksum{File: z.name + ZipSuffix, Extent: extent}
+	}
+	data, err := codecById(z.codec).Decompress(raw)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != z.extent {
+		return nil, &ErrorZipChecksum{File: z.name + ZipSuffix, Extent: extent}
+	}
+	z.cached, z.cache = extent, data
+	return data, nil
+}
+
+// forget 区不再压缩时丢弃缓存
+func (z *extentZip) forget(extent int64) {
+	z.cacheLock.Lock()
+	defer z.cacheLock.Unlock()
+	if z.cached == extent {
+		z.cached, z.cache = -1, nil
+	}
+}
+
+// save 原子地写入压缩索引
+func (z *extentZip) save() error {
+	return writeJsonFile(z.name+ZipIndexSuffix, &zipIndex{Codec: z.codec, Extents: z.extents})
+}
+
+// stats 压缩区的数量以及大小
+func (z *extentZip) stats() CompressStats {
+	stats := CompressStats{Extents: int64(len(z.extents)), Bytes: int64(len(z.extents)) * z.extent}
+	for _, ze := range z.extents {
+		stats.Stored += ze.Length
+	}
+	return stats
+}
+
+// zippedFile 压缩区中的页, 只能读取
+type zippedFile struct {
+	zip    *extentZip
+	extent int64
+}
+
+func (f *zippedFile) ReadAt(buf []byte, offset int64) (int, error) {
+	data, err := f.zip.read(f.extent)
+	if err != nil {
+		return 0, err
+	}
+	return copy(buf, data[offset-f.extent*f.zip.extent:]), nil
+}
+
+func (f *zippedFile) WriteAt([]byte, int64) (int, error) {
+	return 0, &ErrorExtentCompressed{}
+}
+
+// compress 压缩数据文件中idle时间内没有访问的完整区
+func (t *pageTier) compress(idle time.Duration) (CompressStats, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	size, err := t.primary.Size()
+	if err != nil {
+		return CompressStats{}, err
+	}
+	deadline := simulation.Now().Add(-idle).UnixNano()
+	candidates := make([]int64, 0)
+	for extent := int64(1); extent < size/t.geo.PageSize/ExtentPages; extent++ {
+		if _, cold := t.extents[extent]; !cold && !t.zip.zipped(extent) && t.lastAccess(extent) <= deadline {
+			candidates = append(candidates, extent)
+		}
+	}
+	compressed := 0
+	if len(candidates) > 0 {
+		if compressed, err = t.zipExtents(candidates); err != nil {
+			return CompressStats{}, err
+		}
+	}
+	stats := t.zip.stats()
+	stats.Compressed = int64(compressed)
+	return stats, nil
+}
+
+// zipExtents 压缩区并追加到压缩文件, 压缩文件刷盘之后写入索引, 最后释放数据文件中的区, 返回压缩的区数
+func (t *pageTier) zipExtents(candidates []int64) (int, error) {
+	z := t.zip
+	if z.file == nil {
+		f, err := os.OpenFile(z.name+ZipSuffix, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return 0, err
+		}
+		z.file, z.end = f, 0
+	}
+	codec := codecById(z.codec)
+	size := ExtentPages * t.geo.PageSize
+	buf := make([]byte, size)
+	zipped, end := map[int64]zippedExtent{}, z.end
+	for _, extent := range candidates {
+		if _, err := t.primary.ReadAt(buf, extent*size); err != nil {
+			return 0, err
+		}
+		raw := codec.Compress(buf)
+		if int64(len(raw)) > size-t.geo.PageSize {
+			continue
+		}
+		if _, err := z.file.WriteAt(raw, end); err != nil {
+			return 0, err
+		}
+		zipped[extent] = zippedExtent{Offset: end, Length: int64(len(raw)), Crc: crc32.ChecksumIEEE(raw)}
+		end += int64(len(raw))
+	}
+	if len(zipped) == 0 {
+		return 0, nil
+	}
+	if err := z.file.Sync(); err != nil {
+		return 0, err
+	}
+	for extent, ze := range zipped {
+		z.extents[extent] = ze
+	}
+	if err := z.save(); err != nil {
+		for extent := range zipped {
+			delete(z.extents, extent)
+		}
+		return 0, err
+	}
+	z.end = end
+	for extent := range zipped {
+		t.primary.punchHole(extent*size, size)
+	}
+	log.Printf("[Data Manager] Compress %d extents of %s\n", len(zipped), t.primary.Name())
+	return len(zipped), nil
+}
+
+// inflate offset所在的区被压缩时解压到数据文件, 只读打开时不解压
+func (t *pageTier) inflate(offset int64) error {
+	extent := extentOf(offset/t.geo.PageSize + 1)
+	t.lock.RLock()
+	zipped := t.zip.zipped(extent)
+	t.lock.RUnlock()
+	if !zipped || t.readOnly {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.zip.zipped(extent) {
+		return nil
+	}
+	z := t.zip
+	data, err := z.read(extent)
+	if err != nil {
+		return err
+	}
+	size := ExtentPages * t.geo.PageSize
+	if _, err := t.primary.WriteAt(data, extent*size); err != nil {
+		return err
+	}
+	if err := t.primary.Sync(); err != nil {
+		return err
+	}
+	ze := z.extents[extent]
+	delete(z.extents, extent)
+	if err := z.save(); err != nil {
+		z.extents[extent] = ze
+		return err
+	}
+	z.forget(extent)
+	if len(z.extents) == 0 {
+		z.end = 0
+		if err := z.file.Truncate(0); err != nil {
+			return err
+		}
+	} else {
+		punchHole(z.file, ze.Offset, ze.Length)
+	}
+	log.Printf("[Data Manager] Decompress extent %d of %s on access\n", extent, t.primary.Name())
+	return nil
+}
+
+// zippedExtents 压缩区, 按区号排序
+func (z *extentZip) zippedExtents() []int64 {
+	res := make([]int64, 0, len(z.extents))
+	for extent := range z.extents {
+		res = append(res, extent)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// remove 删除压缩文件以及压缩索引(清空表空间时)
+func (z *extentZip) remove() {
+	if z.file != nil {
+		_ = z.file.Close()
+	}
+	_ = os.Remove(z.name + ZipSuffix)
+	_ = os.Remove(z.name + ZipIndexSuffix)
+	z.file, z.end, z.extents = nil, 0, map[int64]zippedExtent{}
+	z.cacheLock.Lock()
+	z.cached, z.cache = -1, nil
+	z.cacheLock.Unlock()
+}
+
+func (z *extentZip) close() error {
+	if z.file == nil {
+		return nil
+	}
+	return z.file.Close()
+}
+
+// CompressCold 压缩表空间中idle时间内没有访问的区
+func (dm *DmImpl) CompressCold(space int64, idle time.Duration) (CompressStats, error) {
+	if dm.readOnly {
+		return CompressStats{}, &ErrorReadOnly{}
+	}
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext || space == SystemSpace {
+		return CompressStats{}, &ErrorSpaceNotExist{}
+	}
+	return ts.tier.compress(idle)
+}
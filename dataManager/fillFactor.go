@@ -0,0 +1,86 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// 填充因子(fill factor)
+// 表空间的填充因子为百分比, 新插入的DataItem只放入插入之后已用空间不超过PageSize*fillFactor/100的页
+// 剩余的空间留给页中变长的DataItem在Update时页内移动(uid不变), 避免删除之后重新插入
+// Update需要迁移DataItem时可以使用预留的空间; 单个DataItem超过空页的预留上限时只要求能够放入空页
+// 默认为100(不预留), 其他取值的表空间保存在数据库元数据区(MetaFillFactors)
+
+const (
+	DefaultFillFactor = 100
+	MinFillFactor     = 10
+)
+
+type ErrorInvalidFillFactor struct{}
+
+func (err *ErrorInvalidFillFactor) Error() string {
+	return "Fill factor must be in 10..100"
+}
+
+// SetFillFactor 设置表空间之后插入时的填充因子
+func (dm *DmImpl) SetFillFactor(space int64, percent int) error {
+	if percent < MinFillFactor || percent > DefaultFillFactor {
+		return &ErrorInvalidFillFactor{}
+	}
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext {
+		return &ErrorSpaceNotExist{}
+	}
+	ts.fillFactor.Store(int32(percent))
+	return dm.WriteMeta(MetaFillFactors, dm.encodeFillFactors())
+}
+
+// FillFactor 表空间的填充因子
+func (ts *TableSpace) FillFactor() int {
+	if ff := ts.fillFactor.Load(); ff != 0 {
+		return int(ff)
+	}
+	return DefaultFillFactor
+}
+
+// reserve 插入时页中需要保留的空闲空间
+func (ts *TableSpace) reserve() int64 {
+	return ts.tier.geo.PageSize * int64(DefaultFillFactor-ts.FillFactor()) / DefaultFillFactor
+}
+
+// encodeFillFactors ([space]4[fillFactor]4)..., 所有表空间都为默认值时返回nil(删除section)
+func (dm *DmImpl) encodeFillFactors() []byte {
+	dm.spaceLock.RLock()
+	defer dm.spaceLock.RUnlock()
+	spaces := make([]int64, 0)
+	for id, ts := range dm.spaces {
+		if ts.FillFactor() != DefaultFillFactor {
+			spaces = append(spaces, id)
+		}
+	}
+	if len(spaces) == 0 {
+		return nil
+	}
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i] < spaces[j] })
+	data := make([]byte, 8*len(spaces))
+	for i, space := range spaces {
+		binary.BigEndian.PutUint32(data[8*i:], uint32(space))
+		binary.BigEndian.PutUint32(data[8*i+4:], uint32(dm.spaces[space].FillFactor()))
+	}
+	return data
+}
+
+// loadFillFactors 启动时从元数据区恢复表空间的填充因子, 必须在loadMeta之后调用
+func (dm *DmImpl) loadFillFactors() {
+	data, ext := dm.ReadMeta(MetaFillFactors)
+	if !ext {
+		return
+	}
+	for i := 0; i+8 <= len(data); i += 8 {
+		if ts, ext := dm.spaces[int64(binary.BigEndian.Uint32(data[i:]))]; ext {
+			ts.fillFactor.Store(int32(binary.BigEndian.Uint32(data[i+4:])))
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+)
+
+// 转发桩(forwarding stub)
+// Update需要把DataItem迁移到其他页时(以及上层的在线迁移), 旧的DataItem不再置为无效, 而是改写为指向新uid的转发桩:
+// RAW: [DIForward]1[dataSize]8[newUid]8[...], dataSize与原来的DataItem相同(包括标志字节), 占用的空间不变, 撤销时原样恢复
+// 快照读(ReadSnapShot, ReadGuard)以及ReadRef沿转发桩读到最终的DataItem, 持有旧uid的读者和上层保存的引用仍然可以解析
+// 当前读(Read)把转发桩视为无效的DataItem, 写入总是使用新的uid
+// ReadRef经过转发桩时记录旧uid -> 新uid, 由上层调用TakeForwarded之后延迟改写自己保存的引用
+// 转发桩与失效的DataItem一样由purge回收, 数据长度小于8字节的DataItem不能改写为转发桩, 仍然置为无效
+
+const (
+	DIForward   byte  = 2
+	SzForwardTo int64 = 8
+)
+
+// GetForward 转发桩指向的uid
+func (di *DataItemImpl) GetForward() (int64, bool) {
+	if di.raw[0] != DIForward {
+		return 0, false
+	}
+	start := SzDIValid + SzDIDataSize
+	return int64(binary.BigEndian.Uint64(di.raw[start : start+SzForwardTo])), true
+}
+
+// Forward
+// 将uid处的DataItem改写为指向newUid的转发桩, 不能改写时置为无效
+func (dm *DmImpl) Forward(xid, uid, newUid int64) {
+	defer dm.lockItemPage(uid)()
+	di := dm.Read(uid)
+	if di == nil {
+		return
+	}
+	defer di.Release()
+	oldRaw := di.GetRaw()
+	stub := make([]byte, len(oldRaw))
+	copy(stub, oldRaw)
+	if size, _, _ := itemSize(oldRaw, 0); size < SzForwardTo {
+		SetRawInvalid(stub)
+	} else {
+		stub[0] = DIForward
+		binary.BigEndian.PutUint64(stub[SzDIValid+SzDIDataSize:], uint64(newUid))
+	}
+	// LOG FIRST
+	dm.redo.UpdateLog(logUid(di), xid, oldRaw, stub)
+	di.Update(stub)
+	dm.items.invalidated.Add(1)
+}
+
+// Unforward
+// 回滚Forward: 用原来的数据data恢复uid处的转发桩; 已经置为无效时与Recover相同
+func (dm *DmImpl) Unforward(xid, uid int64, data []byte) {
+	unlock := dm.lockItemPage(uid)
+	di := dm.doRead(uid)
+	if _, ext := di.GetForward(); !ext {
+		di.Release()
+		unlock()
+		dm.Recover(xid, uid)
+		return
+	}
+	defer unlock()
+	defer di.Release()
+	stub := di.GetRaw()
+	raw := WrapDataItemRaw(data)
+	_, _, checked := itemSize(stub, 0)
+	if isOverflow(stub) {
+		// 溢出头的转发桩保留了溢出链, 按原来的数据长度恢复溢出头
+		start := SzDIValid + SzDIDataSize + SzForwardTo
+		first := int64(binary.BigEndian.Uint64(stub[start : start+8]))
+		raw = wrapOverflowHead(int64(len(data)), first, checked)
+	} else if codec := codecOf(stub); codec != CodecNone {
+		// 压缩的数据重新压缩(压缩结果是确定的)
+		raw = wrapCompressed(codec, codecById(codec).Compress(data), checked)
+	} else if checked {
+		raw = WrapDataItemRawChecked(data)
+	}
+	if len(raw) != len(stub) {
+		panic("Error occurs when restoring forwarded data item, data length mismatch")
+	}
+	// LOG FIRST
+	dm.redo.UpdateLog(logUid(di), xid, stub, raw)
+	di.Update(raw)
+}
+
+// follow 沿转发桩读到最终的DataItem, 返回最终的DataItem以及是否经过了转发桩
+func (dm *DmImpl) follow(di DataItem) (DataItem, bool) {
+	di, forwarded, err := dm.followItem(di)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when following forward stub, %s", err))
+	}
+	return di, forwarded
+}
+
+// followItem 同follow, 读取失败时返回error, 此时不持有任何DataItem
+func (dm *DmImpl) followItem(di DataItem) (DataItem, bool, error) {
+	forwarded := false
+	for {
+		next, ext := di.GetForward()
+		if !ext {
+			return di, forwarded, nil
+		}
+		di.Release()
+		var err error
+		if di, err = dm.readItem(next); err != nil {
+			return nil, forwarded, err
+		}
+		forwarded = true
+	}
+}
+
+// TakeForwarded 取走ReadRef经过的转发桩, 旧uid -> 新uid
+func (dm *DmImpl) TakeForwarded() map[int64]int64 {
+	dm.danglingLock.Lock()
+	defer dm.danglingLock.Unlock()
+	forwarded := dm.dangling.forwarded
+	dm.dangling.forwarded = map[int64]int64{}
+	return forwarded
+}
+
+// noteForward 记录ReadRef经过的转发桩, 同一个uid在被取走之前只记录一次
+func (dm *DmImpl) noteForward(uid, newUid int64) {
+	dm.danglingLock.Lock()
+	defer dm.danglingLock.Unlock()
+	if _, ext := dm.dangling.forwarded[uid]; !ext {
+		dm.dangling.forwarded[uid] = newUid
+		dm.dangling.forwardTotal += 1
+		log.Printf("[Data Manager] Reference %d is forwarded to %d\n", uid, newUid)
+	}
+}
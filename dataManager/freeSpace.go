@@ -0,0 +1,25 @@
+package dataManager
+
+import (
+	"log"
+	"sort"
+)
+
+// VerifyFreeSpace
+// 依次校验每个表空间的空闲空间表(见PageCtl.Verify), 返回检查以及修正的记录数
+// 空闲空间表启动时由FSM(见freeSpaceMap.go)载入或者由页头重建, 运行期间可以周期性地抽样校验
+func (dm *DmImpl) VerifyFreeSpace(sample int) (checked, corrected int) {
+	dm.spaceLock.RLock()
+	spaces := make([]*TableSpace, 0, len(dm.spaces))
+	for _, ts := range dm.spaces {
+		spaces = append(spaces, ts)
+	}
+	dm.spaceLock.RUnlock()
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].id < spaces[j].id })
+	for _, ts := range spaces {
+		c1, c2 := ts.pageCtl.Verify(sample)
+		checked, corrected = checked+c1, corrected+c2
+	}
+	log.Printf("[Data Manager] Verify free space, checked %d pages, corrected %d\n", checked, corrected)
+	return
+}
@@ -0,0 +1,265 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+)
+
+// 持久化的空闲空间表(FSM)
+// PageCtl只保存在内存中, 启动时逐页读出数据文件重建(PageCtl.Init), 数据文件较大时启动很慢
+// 每个表空间在内存中记录每个页最近一次读出或写回数据文件时的剩余空间(非数据页为0), 随页的读写懒更新
+// 正常关闭时所有脏页写回之后, 将记录写入表空间中的FSM页, 并在元数据区MetaFreeSpaceMaps中记录FSM页链表的第一页以及覆盖的页数
+// FSM页: [Used]4[PageType]4[NextPage]8[Free]2[Free]2..., 按链表顺序依次为1号页开始的每个页的剩余空间
+// MetaFreeSpaceMaps: ([Space]8[FirstPage]8[Pages]8)..., Pages为0表示FSM已经失效
+// 启动时覆盖的页数与数据文件一致的FSM直接载入PageCtl, 之后立即将Pages置为0, 只有上一次正常关闭写入的FSM会被使用
+// 崩溃之后, 没有FSM(新建, 挂载或者旧版本的表空间)以及FSM与数据文件不一致时回退到逐页扫描
+// FSM页不记录redo log; 链表在之后的关闭时复用, 页数增加时在末尾追加
+
+const (
+	FreeSpaceMapPage PageType = 1<<0 | 1<<21 // FSM页, 与元数据页相同不是数据页
+
+	SzFsmNext  int64 = 8
+	SzFsmEntry int64 = 2
+	SzFsmMeta  int64 = 24
+)
+
+type ErrorMalformedFreeSpaceMap struct{}
+
+func (err *ErrorMalformedFreeSpaceMap) Error() string {
+	return "Malformed free space map"
+}
+
+type freeSpaceMap struct {
+	lock   sync.Mutex
+	free   []uint16 // free[i]为i+1号页的剩余空间
+	limit  int64    // 页的内容末尾(PageLimit)
+	head   int64    // FSM页链表的第一页, 0表示没有
+	loaded bool     // 由FSM页载入, 不需要扫描
+	// 所有页的剩余空间之和, 见spaceSize.go
+	total int64
+}
+
+// record 页读出或者写回之后记录剩余空间
+func (fsm *freeSpaceMap) record(pageId int64, data []byte) {
+	if fsm == nil || int64(len(data)) < InitOffset {
+		return
+	}
+	free := uint16(0)
+	if PageType(binary.BigEndian.Uint32(data[SzPgUsed:InitOffset]))&DataPage != 0 {
+		free = uint16(fsm.limit - int64(binary.BigEndian.Uint32(data[:SzPgUsed])))
+	}
+	fsm.lock.Lock()
+	defer fsm.lock.Unlock()
+	for int64(len(fsm.free)) < pageId {
+		fsm.free = append(fsm.free, 0)
+	}
+	fsm.total += int64(free) - int64(fsm.free[pageId-1])
+	fsm.free[pageId-1] = free
+}
+
+// freeBytes 所有页的剩余空间之和
+func (fsm *freeSpaceMap) freeBytes() int64 {
+	fsm.lock.Lock()
+	defer fsm.lock.Unlock()
+	return fsm.total
+}
+
+// snapshot 返回前pages个页的剩余空间
+func (fsm *freeSpaceMap) snapshot(pages int64) []uint16 {
+	fsm.lock.Lock()
+	defer fsm.lock.Unlock()
+	free := make([]uint16, pages)
+	copy(free, fsm.free)
+	return free
+}
+
+// loadFreeSpaceMaps
+// 启动时读出每个表空间的FSM, 之后将元数据区中的FSM置为失效, 必须在loadMeta以及loadUnloggedSpaces之后, 初始化PageCtl之前调用
+// crashed时只保留链表用于之后的关闭
+func (dm *DmImpl) loadFreeSpaceMaps(crashed bool) {
+	data, ext := dm.ReadMeta(MetaFreeSpaceMaps)
+	if !ext {
+		return
+	}
+	for i := int64(0); i+SzFsmMeta <= int64(len(data)); i += SzFsmMeta {
+		space := int64(binary.BigEndian.Uint64(data[i:]))
+		head := int64(binary.BigEndian.Uint64(data[i+8:]))
+		pages := int64(binary.BigEndian.Uint64(data[i+16:]))
+		ts, ext := dm.spaces[space]
+		if !ext {
+			continue
+		}
+		ts.fsm.head = head
+		binary.BigEndian.PutUint64(data[i+16:], 0)
+		if crashed || pages == 0 || pages != ts.pageCache.GetPageNumbers() {
+			continue
+		}
+		if free, ok := readFreeSpaceMap(ts.pageCache, head, pages, dm.geo.FsmPageSlots); ok {
+			ts.fsm.lock.Lock()
+			ts.fsm.free, ts.fsm.loaded = free, true
+			ts.fsm.total = 0
+			for _, f := range free {
+				ts.fsm.total += int64(f)
+			}
+			ts.fsm.lock.Unlock()
+		}
+	}
+	if err := dm.WriteMeta(MetaFreeSpaceMaps, data); err != nil {
+		panic(err)
+	}
+}
+
+// readFreeSpaceMap 沿链表读出pages个页的剩余空间, 链表不完整时返回false
+func readFreeSpaceMap(pc PageCache, head, pages, slots int64) ([]uint16, bool) {
+	free := make([]uint16, 0, pages)
+	for next := head; int64(len(free)) < pages; {
+		if next <= 0 || next > pc.GetPageNumbers() {
+			return nil, false
+		}
+		page, err := pc.GetPage(next)
+		if err != nil {
+			log.Printf("[Data Manager] Error occurs when reading free space map, err = %s\n", err)
+			return nil, false
+		}
+		data := page.GetData()
+		ok := page.GetPageType() == FreeSpaceMapPage
+		if ok {
+			next = int64(binary.BigEndian.Uint64(data[InitOffset:]))
+			for j := int64(0); j < slots && int64(len(free)) < pages; j++ {
+				free = append(free, binary.BigEndian.Uint16(data[InitOffset+SzFsmNext+j*SzFsmEntry:]))
+			}
+		}
+		if err := pc.ReleasePage(page); err != nil {
+			panic(err)
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	return free, true
+}
+
+// initPageCtl FSM有效时直接载入, 否则逐页扫描
+func (dm *DmImpl) initPageCtl(ts *TableSpace) {
+	if !ts.fsm.loaded {
+		ts.pageCtl.Init(ts.pageCache)
+		return
+	}
+	for i, free := range ts.fsm.snapshot(ts.pageCache.GetPageNumbers()) {
+		if pageId := int64(i + 1); pageId != PageNumberDbMeta && free > 0 {
+			ts.pageCtl.AddPageInfo(pageId, int64(free))
+		}
+	}
+	log.Printf("[Data Manager] Load free space map of table space %d\n", ts.id)
+}
+
+// saveFreeSpaceMaps
+// 关闭时将所有表空间的脏页写回之后写入FSM, 出错的表空间下一次启动时逐页扫描
+func (dm *DmImpl) saveFreeSpaceMaps() {
+	dm.spaceLock.RLock()
+	spaces := make([]*TableSpace, 0, len(dm.spaces))
+	for _, ts := range dm.spaces {
+		spaces = append(spaces, ts)
+	}
+	dm.spaceLock.RUnlock()
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].id < spaces[j].id })
+	data := make([]byte, 0, SzFsmMeta*int64(len(spaces)))
+	for _, ts := range spaces {
+		pages, err := dm.writeFreeSpaceMap(ts)
+		if err != nil {
+			log.Printf("[Data Manager] Error occurs when saving free space map of table space %d, err = %s\n", ts.id, err)
+			pages = 0
+		}
+		entry := make([]byte, SzFsmMeta)
+		binary.BigEndian.PutUint64(entry, uint64(ts.id))
+		binary.BigEndian.PutUint64(entry[8:], uint64(ts.fsm.head))
+		binary.BigEndian.PutUint64(entry[16:], uint64(pages))
+		data = append(data, entry...)
+	}
+	if err := dm.WriteMeta(MetaFreeSpaceMaps, data); err != nil {
+		log.Printf("[Data Manager] Error occurs when saving free space maps, err = %s\n", err)
+	}
+}
+
+// writeFreeSpaceMap 写回脏页之后写入FSM页, 返回覆盖的页数
+// 复用已有的链表, 不够时在末尾追加新的FSM页(追加的页同样被覆盖)
+func (dm *DmImpl) writeFreeSpaceMap(ts *TableSpace) (int64, error) {
+	pc := ts.pageCache
+	if err := pc.FlushAll(); err != nil {
+		return 0, err
+	}
+	chain, err := freeSpaceMapChain(pc, ts.fsm.head)
+	if err != nil {
+		return 0, err
+	}
+	slots := dm.geo.FsmPageSlots
+	for int64(len(chain))*slots < pc.GetPageNumbers() {
+		chain = append(chain, pc.NewPage(FreeSpaceMapPage))
+	}
+	ts.fsm.head = chain[0]
+	pages := pc.GetPageNumbers()
+	free := ts.fsm.snapshot(pages)
+	for i, pageId := range chain {
+		first := int64(i) * slots
+		entries := pages - first
+		if entries < 0 {
+			entries = 0
+		} else if entries > slots {
+			entries = slots
+		}
+		body := make([]byte, SzFsmNext+entries*SzFsmEntry)
+		if i+1 < len(chain) {
+			binary.BigEndian.PutUint64(body, uint64(chain[i+1]))
+		}
+		for j := int64(0); j < entries; j++ {
+			binary.BigEndian.PutUint16(body[SzFsmNext+j*SzFsmEntry:], free[first+j])
+		}
+		page, err := pc.GetPage(pageId)
+		if err != nil {
+			return 0, err
+		}
+		err = page.Update(body, InitOffset)
+		if err == nil {
+			pc.DoFlush(page)
+		}
+		if rerr := pc.ReleasePage(page); err == nil {
+			err = rerr
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return pages, nil
+}
+
+// freeSpaceMapChain 返回head开始的FSM页, head无效时(例如崩溃之后重建的表空间)返回空链表
+func freeSpaceMapChain(pc PageCache, head int64) ([]int64, error) {
+	chain := make([]int64, 0)
+	seen := map[int64]struct{}{}
+	for next := head; next > 0 && next <= pc.GetPageNumbers(); {
+		if _, ext := seen[next]; ext {
+			return nil, &ErrorMalformedFreeSpaceMap{}
+		}
+		page, err := pc.GetPage(next)
+		if errors.As(err, new(*ErrorPageChecksum)) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		isMap := page.GetPageType() == FreeSpaceMapPage
+		following := int64(binary.BigEndian.Uint64(page.GetData()[InitOffset:]))
+		if err := pc.ReleasePage(page); err != nil {
+			return nil, err
+		}
+		if !isMap {
+			break
+		}
+		seen[next] = struct{}{}
+		chain = append(chain, next)
+		next = following
+	}
+	return chain, nil
+}
@@ -0,0 +1,58 @@
+package dataManager
+
+import (
+	"myDB/simulation"
+	"time"
+)
+
+// 健康检查
+// 1. redo log可写: 获取日志的锁并对日志文件刷盘, 刷盘失败(例如磁盘只读或者已满)时返回ErrorLogNotWritable
+// 2. 缓冲区没有停滞: 依次获取每个表空间缓冲区的锁, 缓冲区已满(之后的缺页会失败)时返回ErrorBufferPoolFull
+// 以上检查在timeout之内没有完成(锁被长时间持有或者IO阻塞)时返回ErrorHealthTimeout, 检查本身的goroutine会继续等待
+
+type ErrorLogNotWritable struct{}
+type ErrorBufferPoolFull struct{}
+type ErrorHealthTimeout struct{}
+
+func (err *ErrorLogNotWritable) Error() string {
+	return "Redo log is not writable"
+}
+
+func (err *ErrorBufferPoolFull) Error() string {
+	return "Buffer pool is full"
+}
+
+func (err *ErrorHealthTimeout) Error() string {
+	return "Health check timeout, the log or buffer pool is stalled"
+}
+
+func (dm *DmImpl) CheckHealth(timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- dm.checkHealth()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-simulation.After(timeout):
+		return &ErrorHealthTimeout{}
+	}
+}
+
+func (dm *DmImpl) checkHealth() error {
+	if err := dm.redo.Check(); err != nil {
+		return &ErrorLogNotWritable{}
+	}
+	dm.spaceLock.RLock()
+	spaces := make([]*TableSpace, 0, len(dm.spaces))
+	for _, ts := range dm.spaces {
+		spaces = append(spaces, ts)
+	}
+	dm.spaceLock.RUnlock()
+	for _, ts := range spaces {
+		if stats := ts.pageCache.Stats(); stats.Cached >= stats.Capacity {
+			return &ErrorBufferPoolFull{}
+		}
+	}
+	return nil
+}
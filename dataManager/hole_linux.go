@@ -0,0 +1,18 @@
+//go:build linux
+
+package dataManager
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	fallocKeepSize  = 0x01
+	fallocPunchHole = 0x02
+)
+
+// punchHole 释放文件中[offset, offset + size)占用的磁盘空间, 文件大小不变, 失败时忽略
+func punchHole(file *os.File, offset, size int64) {
+	_ = syscall.Fallocate(int(file.Fd()), fallocKeepSize|fallocPunchHole, offset, size)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package dataManager
+
+import "os"
+
+// punchHole 非linux平台不释放数据文件中已经迁移的区
+func punchHole(file *os.File, offset, size int64) {}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"myDB/simulation"
 	"myDB/transactions"
 	"os"
+	"sort"
 	"sync"
 )
 
@@ -20,19 +22,57 @@ import (
 type Log interface {
 	UpdateLog(uid, xid int64, oldRaw, raw []byte)
 	InsertLog(uid, xid int64, raw []byte)
+	RedoOnlyLog(uid, xid int64, oldRaw, raw []byte) // 崩溃恢复时总是重做, 不撤销(槽式数据页的页头以及新分配的槽位)
+	// BatchInsertLog 一个槽式数据页上的批量插入: 相邻的DataItem可撤销, 页头以及槽位数组只重做, 见batchInsert.go
+	BatchInsertLog(uid, xid int64, oldItems, items, oldMeta, meta []byte)
 	log(data []byte) // 记录下一条log
 	Close()
 	Next() []byte // 迭代器获得下一条log data
 	ResetLog()
-	CrashRecover(pc PageCache, tm transactions.TransactionManager) // 崩溃恢复
+	CrashRecover(spaces SpaceResolver, tm transactions.TransactionManager) // 崩溃恢复
+	BeginBatch(xid int64)                                                  // xid的日志不再逐条刷盘
+	EndBatch(xid int64)                                                    // 结束批量模式, 将未刷盘的日志刷入磁盘
+	Flush()                                                                // 将缓存的批量日志写入文件(不刷盘)
+	Sync() int64                                                           // 将缓存的日志写入文件并刷盘, 返回已经刷盘的LSN
+	Checkpoint(lsn int64)                                                  // 记录一个checkpoint(lsn之前的日志修改的页已经写回数据文件)并刷盘
+	Stats() LogStats
+	TakeBytes(xid int64) int64            // xid上次调用之后记录的日志字节数
+	ReportReplica(name string, lsn int64) // 记录副本已经应用到的LSN, lsn < 0 时移除该副本
+	Check() error                         // 日志文件是否可以刷盘
+	// HasUndo 页上是否有未结束的事物写过可撤销日志
+	HasUndo(space, pageId int64, finished func(xid int64) bool) bool
+	PruneUndo(finished func(xid int64) bool) // 移除已经结束的事物
+	// Backup 持有日志的锁, 刷盘之后调用copy拷贝日志文件, lsn为已经写入文件的日志长度
+	Backup(copy func(file *os.File, lsn int64) error) error
 }
 
+// LogStats redo log的运行状态, LSN为日志在文件中的偏移量
+type LogStats struct {
+	Lsn        int64        // 已经记录的日志(包括缓存在内存中的批量日志)
+	FlushedLsn int64        // 已经写入文件
+	SyncedLsn  int64        // 已经刷盘
+	Batches    int          // 处于批量模式的事物数
+	Coalesced  int64        // 批量模式下合并到上一条日志的更新日志数
+	Checkpoint int64        // 最近一次checkpoint的LSN, 0表示没有checkpoint
+	Replicas   []ReplicaLsn // 按名称排序
+}
+
+// ReplicaLsn 副本已经应用的LSN, 由副本(或者日志传输程序)上报, 本库不实现复制
+type ReplicaLsn struct {
+	Name       string
+	AppliedLsn int64
+}
+
+// SpaceResolver 崩溃恢复时根据表空间id获得对应的PageCache
+type SpaceResolver func(space int64) PageCache
+
 const (
 	SEED       int64  = 131
 	MOD        int64  = 998244353
 	LogSuffix  string = "_redo.log"
 	SzCheckSum int64  = 8
 	SzData     int64  = 4
+	MaxPending int64  = 1 << 20 // 批量模式下缓存的日志上限(字节)
 )
 
 type RedoLog struct {
@@ -41,14 +81,40 @@ type RedoLog struct {
 	lock         *sync.Mutex
 	offset       int64 // current pointer used for iterator
 	writePointer int64
+	batches      map[int64]struct{} // 处于批量模式的事物
+	unsynced     bool               // 是否有已写入但未刷盘的日志
+	pending      [][]byte           // 批量模式下尚未写入文件的日志, 每条日志为 [Size, CheckSum] 和 [Data] 两段
+	pendingSize  int64
+	syncPointer  int64                        // 已经刷盘的位置
+	xidBytes     map[int64]int64              // xid -> 记录的日志字节数, 由TakeBytes取走
+	checkpoint   int64                        // 最近一次checkpoint的LSN
+	replicas     map[string]int64             // 副本 -> 已经应用的LSN
+	undoPages    map[int64]map[int64]struct{} // 页 -> 在页上写过可撤销日志的事物, 见reorganize.go
+	prevCheckSum int64                        // 最后一条缓存的日志之前的checkSum, 用于合并日志
+	coalesced    int64
 }
 
 func (redo *RedoLog) UpdateLog(uid, xid int64, oldRaw, raw []byte) {
 	pageId, offset := uidTrans(uid)
-	updateLog := wrapUpdateLog(xid, pageId, offset, int64(len(oldRaw)), oldRaw, raw)
+	updateLog := wrapUpdateLog(xid, getPageKey(spaceOf(uid), pageId), offset, int64(len(oldRaw)), oldRaw, raw)
 	redo.log(updateLog)
 }
 
+// RedoOnlyLog
+// uid中的offset为页内偏移
+func (redo *RedoLog) RedoOnlyLog(uid, xid int64, oldRaw, raw []byte) {
+	pageId, offset := uidTrans(uid)
+	redoOnlyLog := wrapLog(REDOONLY, xid, getPageKey(spaceOf(uid), pageId), offset, oldRaw, raw)
+	redo.log(redoOnlyLog)
+}
+
+// BatchInsertLog
+// uid中的offset为DataItem的页内偏移, 页头以及槽位数组从页的开头记录
+func (redo *RedoLog) BatchInsertLog(uid, xid int64, oldItems, items, oldMeta, meta []byte) {
+	pageId, offset := uidTrans(uid)
+	redo.log(wrapBatchInsertLog(xid, getPageKey(spaceOf(uid), pageId), offset, oldItems, items, oldMeta, meta))
+}
+
 func (redo *RedoLog) InsertLog(uid, xid int64, raw []byte) {
 	pageId, offset := uidTrans(uid)
 	// Insert 本质 INVALID -> VALID
@@ -56,7 +122,7 @@ func (redo *RedoLog) InsertLog(uid, xid int64, raw []byte) {
 	copy(oldRaw, raw)
 	oldRaw = SetRawInvalid(oldRaw)
 	log.Printf("[REDO LOG line 55] PREPARE TO INSERT A LOG %d %d %d %d\n", xid, pageId, offset, len(oldRaw))
-	insertLog := wrapUpdateLog(xid, pageId, offset, int64(len(oldRaw)), oldRaw, raw)
+	insertLog := wrapUpdateLog(xid, getPageKey(spaceOf(uid), pageId), offset, int64(len(oldRaw)), oldRaw, raw)
 	redo.log(insertLog)
 }
 
@@ -64,35 +130,207 @@ func (redo *RedoLog) InsertLog(uid, xid int64, raw []byte) {
 // [Size]4[CheckSum]8[Data] -> log raw format
 // Must flush the wrapped data and then update the checkSum of the redo log file
 // 先写log,最后更新checkSum
+// 批量模式下日志先缓存在内存中, 之后与其他日志一起通过一次writev写入文件, 不拼接成新的buffer
 func (redo *RedoLog) log(data []byte) {
+	simulation.Yield("redo.log")
 	redo.lock.Lock()
 	defer redo.lock.Unlock()
-	logWrap := wrapLog(data)
-	// write(append)
-	if _, err := redo.file.WriteAt(logWrap, redo.writePointer); err != nil {
+	if _, ext := redo.batches[getXid(data)]; ext && redo.coalesce(data) {
+		return
+	}
+	redo.pending = append(redo.pending, wrapLogHeader(data), data)
+	redo.pendingSize += SzData + SzCheckSum + int64(len(data))
+	redo.xidBytes[getXid(data)] += SzData + SzCheckSum + int64(len(data))
+	redo.noteUndo(data)
+	redo.prevCheckSum = redo.checkSum
+	redo.checkSum = calcCheckSum(redo.checkSum, data)
+	log.Printf("[REDO LOG LINE 80] Log a new redo log, current checkSum = %d, dataLength = %d\n", redo.checkSum, len(data)) // PACK
+	if _, ext := redo.batches[getXid(data)]; ext {
+		// 批量模式, 推迟到EndBatch时刷盘
+		redo.unsynced = true
+		if redo.pendingSize >= MaxPending {
+			redo.flushPending()
+		}
+	} else {
+		// 之前缓存的批量日志与当前日志一起写入
+		redo.flushPending()
+		redo.sync()
+		redo.unsynced = false
+	}
+}
+
+// coalesce
+// 批量事物反复原地更新同一个DataItem时, 与上一条缓存(尚未写入文件)的日志合并为一条:
+// 两条日志属于同一个事物, 都是更新日志, 位置相同, 长度不变, 并且后一条的旧值就是前一条的新值
+// 合并之后的日志旧值为前一条的旧值, 新值为后一条的新值, 长度与前一条相同, 重做以及撤销的结果与两条日志相同
+// 页写回数据文件之前(WAL)缓存的日志全部写入文件, 因此只有页被引用(没有换出)期间的连续更新可以合并
+// 必须持有redo的锁
+func (redo *RedoLog) coalesce(data []byte) bool {
+	n := len(redo.pending)
+	if n == 0 || getOperationType(data) != UPDATE {
+		return false
+	}
+	last := redo.pending[n-1]
+	if getOperationType(last) != UPDATE || getXid(last) != getXid(data) {
+		return false
+	}
+	xid, pageKey, offset, _, oldRaw, raw := parseUpdateLog(data)
+	_, lastPageKey, lastOffset, _, lastOldRaw, lastRaw := parseUpdateLog(last)
+	if pageKey != lastPageKey || offset != lastOffset || len(raw) != len(oldRaw) || !bytes.Equal(oldRaw, lastRaw) {
+		return false
+	}
+	merged := wrapLog(UPDATE, xid, pageKey, offset, lastOldRaw, raw)
+	redo.pending[n-2], redo.pending[n-1] = wrapLogHeader(merged), merged
+	redo.checkSum = calcCheckSum(redo.prevCheckSum, merged)
+	redo.coalesced++
+	return true
+}
+
+// flushPending
+// 一次writev写入所有缓存的日志, 最后更新checkSum
+func (redo *RedoLog) flushPending() {
+	if len(redo.pending) == 0 {
+		return
+	}
+	if err := simulation.Fault("redo.write"); err != nil {
 		panic(fmt.Sprintf("Error occurs when writing redo log, err = %s", err))
 	}
-	redo.writePointer += int64(len(logWrap))
-	// finally update the checkSum
-	nextCheckSum := calcCheckSum(redo.checkSum, data)
-	buffer := bytes.NewBuffer([]byte{})
-	_ = binary.Write(buffer, binary.BigEndian, nextCheckSum)
-	if _, err := redo.file.WriteAt(buffer.Bytes(), 0); err != nil {
+	if err := writeVectorAt(redo.file, redo.pending, redo.writePointer); err != nil {
 		panic(fmt.Sprintf("Error occurs when writing redo log, err = %s", err))
 	}
-	dataLen := int64(binary.BigEndian.Uint32(logWrap[:SzData]))
-	tmp := make([]byte, SzCheckSum)
-	_, _ = redo.file.ReadAt(tmp, 0)
-	log.Printf("[REDO LOG LINE 80] Log a new redo log, current checkSum = %d, %d, dataLength = %d\n", nextCheckSum, int64(binary.BigEndian.Uint64(tmp)), dataLen) // PACK
+	redo.writePointer += redo.pendingSize
+	redo.pending, redo.pendingSize = nil, 0
+	buffer := make([]byte, SzCheckSum)
+	binary.BigEndian.PutUint64(buffer, uint64(redo.checkSum))
+	if _, err := redo.file.WriteAt(buffer, 0); err != nil {
+		panic(fmt.Sprintf("Error occurs when writing redo log, err = %s", err))
+	}
+}
+
+// sync 刷盘, 必须持有redo的锁
+func (redo *RedoLog) sync() {
 	_ = redo.file.Sync()
-	read := make([]byte, SzData)
-	_, _ = redo.file.ReadAt(read, 8)
-	redo.checkSum = nextCheckSum
+	redo.syncPointer = redo.writePointer
+}
+
+func (redo *RedoLog) TakeBytes(xid int64) int64 {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	n := redo.xidBytes[xid]
+	delete(redo.xidBytes, xid)
+	return n
+}
+
+func (redo *RedoLog) Stats() LogStats {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	stats := LogStats{
+		Lsn:        redo.writePointer + redo.pendingSize,
+		FlushedLsn: redo.writePointer,
+		SyncedLsn:  redo.syncPointer,
+		Batches:    len(redo.batches),
+		Coalesced:  redo.coalesced,
+		Checkpoint: redo.checkpoint,
+	}
+	for name, lsn := range redo.replicas {
+		stats.Replicas = append(stats.Replicas, ReplicaLsn{Name: name, AppliedLsn: lsn})
+	}
+	sort.Slice(stats.Replicas, func(i, j int) bool { return stats.Replicas[i].Name < stats.Replicas[j].Name })
+	return stats
+}
+
+// Check 不写入新的日志
+func (redo *RedoLog) Check() error {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	return redo.file.Sync()
+}
+
+// ReportReplica
+// LSN为日志文件中的偏移量, 日志被重置(ResetLog)之后副本需要重新上报
+func (redo *RedoLog) ReportReplica(name string, lsn int64) {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	if lsn < 0 {
+		delete(redo.replicas, name)
+		return
+	}
+	redo.replicas[name] = lsn
+}
+
+// Flush
+// WAL: 页写回数据源之前必须先写入描述这个页的日志
+func (redo *RedoLog) Flush() {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	redo.flushPending()
+}
+
+// Sync
+// 批量模式下缓存的日志也一起刷盘
+func (redo *RedoLog) Sync() int64 {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	redo.flushPending()
+	redo.sync()
+	redo.unsynced = false
+	return redo.syncPointer
+}
+
+func (redo *RedoLog) Backup(copy func(file *os.File, lsn int64) error) error {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	redo.flushPending()
+	redo.sync()
+	redo.unsynced = false
+	return copy(redo.file, redo.syncPointer)
+}
+
+// Checkpoint
+// [CHECKPOINT]4[SuperXID]8[Lsn]8
+// checkpoint记录只用于诊断, 崩溃恢复时跳过
+func (redo *RedoLog) Checkpoint(lsn int64) {
+	data := wrapCheckpointLog(lsn)
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	redo.pending = append(redo.pending, wrapLogHeader(data), data)
+	redo.pendingSize += SzData + SzCheckSum + int64(len(data))
+	redo.checkSum = calcCheckSum(redo.checkSum, data)
+	redo.flushPending()
+	redo.sync()
+	redo.unsynced = false
+	redo.checkpoint = lsn
+}
+
+// BeginBatch
+// 批量模式下xid的日志只写入内存/OS缓存, 由EndBatch统一写入并刷盘, 连续的原地更新合并为一条日志(coalesce)
+// 其他事物的日志仍然逐条刷盘(同时会刷入之前未刷盘的批量日志)
+// 上层必须保证在事物提交之前调用EndBatch
+func (redo *RedoLog) BeginBatch(xid int64) {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	redo.batches[xid] = struct{}{}
+}
+
+func (redo *RedoLog) EndBatch(xid int64) {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	if _, ext := redo.batches[xid]; !ext {
+		return
+	}
+	delete(redo.batches, xid)
+	if redo.unsynced {
+		redo.flushPending()
+		redo.sync()
+		redo.unsynced = false
+	}
 }
 
 func (redo *RedoLog) Close() {
 	redo.lock.Lock()
 	defer redo.lock.Unlock()
+	redo.flushPending()
+	redo.sync()
 	if err := redo.file.Close(); err != nil {
 		panic(err)
 	}
@@ -122,6 +360,10 @@ func (redo *RedoLog) ResetLog() {
 		panic(fmt.Sprintf("Error occurs when reseting redo log, err : %s\n", err))
 	}
 	redo.writePointer = SzCheckSum
+	redo.syncPointer = SzCheckSum
+	redo.checkpoint = 0
+	redo.checkSum = 0
+	redo.pending, redo.pendingSize = nil, 0
 	buf := make([]byte, SzCheckSum)
 	_, _ = redo.file.ReadAt(buf, 0)
 	log.Printf("[REDO LOG LINE 120] RESET LOG CHECKSUM = %d\n", int64(binary.BigEndian.Uint64(buf)))
@@ -211,6 +453,11 @@ func (redo *RedoLog) nextUnlock() (data []byte) {
 // Data format of LOG RAW [Size]4[CheckSum]8[Data]
 // Data format of updateLog [LogType]4[XID]8[PageId]8[Offset]8[OldRawLength]8[OldRaw][NewRaw]
 // Data format of insertLog [LogType]4[XID]8[PageId]8[Offset]8[Raw]
+// Data format of checkpointLog [LogType]4[XID]8[Lsn]8
+// Data format of redoOnlyLog 与updateLog相同, 无论事物是否完成都会按日志顺序重做, 不会被撤销
+// Data format of batchInsertLog [LogType]4[XID]8[PageId]8[Offset]8[ItemsLength]8[MetaLength]8[OldItems][Items][OldMeta][Meta]
+// batchInsertLog 按日志顺序重做(DataItem以及从页开头的页头和槽位数组), 事物未完成时只撤销DataItem
+// PageId 高32位为表空间id, 低32位为表空间中的页号(见getPageKey)
 // XID -> transaction id XID must also be updated first before updating the data
 
 type OperationType int32
@@ -226,11 +473,15 @@ func NewTransactionMap() TransactionMap {
 const (
 	UPDATE      OperationType = 0 // INSERT and DELETE is essentially a UPDATE operation
 	INSERT      OperationType = 1 // unnecessary
+	CHECKPOINT  OperationType = 2
+	REDOONLY    OperationType = 3
+	BATCHINSERT OperationType = 4
 	SzOpt       int           = 4
 	SzXid       int           = 8
 	SzPageId    int           = 8
 	SzOffset    int           = 8
 	SzRawLength int           = 8
+	SzLsn       int           = 8
 	REDO        RecoveryType  = 0
 	UNDO        RecoveryType  = 1
 )
@@ -240,68 +491,88 @@ const (
 // no lock
 // undo all the transaction if not finished
 // redo all the transaction if finished
-func (redo *RedoLog) CrashRecover(pc PageCache, tm transactions.TransactionManager) {
+// 重做按日志顺序进行(不同事物的日志可能修改同一个页头), 之后撤销未完成的事物
+func (redo *RedoLog) CrashRecover(spaces SpaceResolver, tm transactions.TransactionManager) {
 	log.Printf("Recoving Data...\n")
 	// remove Tail
 	redo.init()
-	toRedo, toUndo := NewTransactionMap(), NewTransactionMap()
+	var toRedo [][]byte
+	toUndo := NewTransactionMap()
 	redo.reset()
-	var maxPageId int64 = 1
+	maxPageId := map[int64]int64{SystemSpace: 1} // 每个表空间的最大页号
 	for {
 		nextLog := redo.nextUnlock() // log data
 		if nextLog == nil {
 			break
 		}
-		x, pi, offset, oldRawLength, _, _ := parseUpdateLog(nextLog)
+		if isCheckpointLog(nextLog) {
+			continue
+		}
+		// 日志不记录页大小, 按最大的页检查边界, 写入页时再按数据库的页大小检查
+		records, err := parseRedoRecords(nextLog, MaxPageSize)
+		if err != nil {
+			panic(fmt.Sprintf("Error occurs when recovering data, err = %s\n", err))
+		}
+		x, pi, offset, oldRawLength := records[0].Xid, records[0].PageKey, records[0].Offset, len(records[0].OldRaw)
 		xid := getXid(nextLog)
 		pageId := getPageId(nextLog)
 		xStatus := tm.Status(xid)
-		if xStatus&(1<<transactions.FINISH) == 0 {
-			// undo 撤销
+		if getOperationType(nextLog) == REDOONLY {
+			toRedo = append(toRedo, nextLog)
+		} else if xStatus&(1<<transactions.FINISH) == 0 {
+			// undo 撤销, 批量插入的页头以及槽位数组仍然需要重做
 			log.Printf("[REDO LOG LINE 253] RECOVER NEXT LOG RAW UNDO %d %d %d %d\n", x, pi, offset, oldRawLength)
+			if getOperationType(nextLog) == BATCHINSERT {
+				toRedo = append(toRedo, nextLog)
+			}
 			toUndo[xid] = append(toUndo[xid], nextLog)
 		} else {
 			// redo 重做
 			log.Printf("[REDO LOG LINE 253] RECOVER NEXT LOG RAW REDO %d %d %d %d\n", x, pi, offset, oldRawLength)
-			toRedo[xid] = append(toRedo[xid], nextLog)
+			toRedo = append(toRedo, nextLog)
 		}
-		if pageId > maxPageId {
-			maxPageId = pageId
+		space, pageNumber := pageKeyTrans(pageId)
+		if pageNumber > maxPageId[space] {
+			maxPageId[space] = pageNumber
 		}
 	}
 	// set ds size if needed
-	if err := pc.SetDsSize(maxPageId); err != nil {
-		panic("Error occurs when truncating page cache\n")
+	for space, pageNumber := range maxPageId {
+		if err := spaces(space).SetDsSize(pageNumber); err != nil {
+			panic("Error occurs when truncating page cache\n")
+		}
 	}
 	log.Printf("Recovering redo\n")
-	redoRecovery(toRedo, pc)
+	redoRecovery(toRedo, spaces)
 	log.Printf("Recovering undo\n")
-	undoRecovery(toUndo, pc, tm)
+	undoRecovery(toUndo, spaces, tm)
 	log.Printf("Recovery finish\n")
 }
 
 // redo
-// 对所有完成的事物(FINISH)进行正序重新执行
-func redoRecovery(tx TransactionMap, pc PageCache) {
-	for _, logs := range tx {
-		for _, lg := range logs {
-			opt := getOperationType(lg)
-			if opt == UPDATE {
-				doUpdateRecovery(lg, pc, REDO)
-			}
+// 对所有完成的事物(FINISH)的日志以及所有REDOONLY日志按日志顺序重新执行
+func redoRecovery(logs [][]byte, spaces SpaceResolver) {
+	for _, lg := range logs {
+		opt := getOperationType(lg)
+		if opt == UPDATE || opt == REDOONLY {
+			doUpdateRecovery(lg, spaces, REDO)
+		} else if opt == BATCHINSERT {
+			doBatchInsertRecovery(lg, spaces, REDO)
 		}
 	}
 }
 
 // undo
 // 对所有崩溃时未完成的事物(ACTIVE)进行倒序回滚
-func undoRecovery(tx TransactionMap, pc PageCache, tm transactions.TransactionManager) {
+func undoRecovery(tx TransactionMap, spaces SpaceResolver, tm transactions.TransactionManager) {
 	for xid, logs := range tx {
 		length := len(logs)
 		for i := length - 1; i >= 0; i-- {
 			opt := getOperationType(logs[i])
 			if opt == UPDATE {
-				doUpdateRecovery(logs[i], pc, UNDO)
+				doUpdateRecovery(logs[i], spaces, UNDO)
+			} else if opt == BATCHINSERT {
+				doBatchInsertRecovery(logs[i], spaces, UNDO)
 			}
 		}
 		// set aborted
@@ -333,8 +604,10 @@ func undoRecovery(tx TransactionMap, pc PageCache, tm transactions.TransactionMa
 //}
 
 // doUpdateRecovery 执行更新恢复操作
-func doUpdateRecovery(data []byte, pc PageCache, opt RecoveryType) {
-	_, pageId, offset, _, oldRaw, newRaw := parseUpdateLog(data)
+func doUpdateRecovery(data []byte, spaces SpaceResolver, opt RecoveryType) {
+	_, pageKey, offset, _, oldRaw, newRaw := parseUpdateLog(data)
+	space, pageId := pageKeyTrans(pageKey)
+	pc := spaces(space)
 	if pg, err := pc.GetPage(pageId); err != nil {
 		panic(fmt.Sprintf("Error occurs when getting page, err = %s\n", err))
 	} else {
@@ -355,6 +628,32 @@ func doUpdateRecovery(data []byte, pc PageCache, opt RecoveryType) {
 	}
 }
 
+// doBatchInsertRecovery
+// REDO 写入DataItem以及页头和槽位数组, UNDO 只写入无效的DataItem, 页头以及分配的槽位保留
+func doBatchInsertRecovery(data []byte, spaces SpaceResolver, opt RecoveryType) {
+	_, pageKey, offset, oldItems, items, _, meta := parseBatchInsertLog(data)
+	space, pageId := pageKeyTrans(pageKey)
+	pc := spaces(space)
+	pg, err := pc.GetPage(pageId)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when getting page, err = %s\n", err))
+	}
+	if opt == REDO {
+		err = pg.Update(items, offset)
+		if err == nil {
+			err = pg.Update(meta, 0)
+		}
+	} else {
+		err = pg.Update(oldItems, offset)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when recoving data, err = %s\n", err))
+	}
+	if err = pc.ReleasePage(pg); err != nil {
+		panic(fmt.Sprintf("Error occurs when releasing page, err = %s\n", err))
+	}
+}
+
 // Create / Init(Load) Redo Log
 
 func CreateRedoLog(path string, lock *sync.Mutex) Log {
@@ -372,6 +671,9 @@ func CreateRedoLog(path string, lock *sync.Mutex) Log {
 		file:     file,
 		checkSum: 0,
 		lock:     lock,
+		batches:  make(map[int64]struct{}),
+		xidBytes: make(map[int64]int64),
+		replicas: make(map[string]int64),
 	}
 	redoLog.reset()
 	return redoLog
@@ -385,8 +687,11 @@ func OpenRedoLog(path string, lock *sync.Mutex) Log {
 		panic(err)
 	}
 	redoLog := &RedoLog{
-		file: file,
-		lock: lock,
+		file:     file,
+		lock:     lock,
+		batches:  make(map[int64]struct{}),
+		xidBytes: make(map[int64]int64),
+		replicas: make(map[string]int64),
 	}
 	log.Printf("[Data Manager] Open redo log\n")
 	return redoLog
@@ -403,24 +708,25 @@ func calcCheckSum(checkSum int64, data []byte) int64 {
 	return (next + checkSum) % MOD
 }
 
-// 将size...checkSum...data 包装成一条log
-func wrapLog(data []byte) []byte {
-	checkSum := calcCheckSum(0, data)
-	size := len(data)
-	buffer1 := bytes.NewBuffer([]byte{})
-	_ = binary.Write(buffer1, binary.BigEndian, int32(size))
-	buffer2 := bytes.NewBuffer([]byte{})
-	_ = binary.Write(buffer2, binary.BigEndian, checkSum)
-	// [size]4[checkSum]8[data]
-	ret := make([]byte, SzCheckSum+SzData+int64(len(data)))
-	copy(ret[:SzData], buffer1.Bytes())
-	copy(ret[SzData:SzCheckSum+SzData], buffer2.Bytes())
-	copy(ret[SzCheckSum+SzData:], data)
-	return ret
+// wrapLogHeader 一条log的头部 [size]4[checkSum]8, 之后为data
+func wrapLogHeader(data []byte) []byte {
+	header := make([]byte, SzData+SzCheckSum)
+	binary.BigEndian.PutUint32(header[:SzData], uint32(len(data)))
+	binary.BigEndian.PutUint64(header[SzData:], uint64(calcCheckSum(0, data)))
+	return header
 }
 
 // Operation Parser
 
+// getPageKey redo log中记录的页标识 [space]32[pageId]32
+func getPageKey(space, pageId int64) int64 {
+	return (space << 32) | pageId
+}
+
+func pageKeyTrans(key int64) (space, pageId int64) {
+	return key >> 32, key & ((1 << 32) - 1)
+}
+
 func getOperationType(data []byte) OperationType {
 	return OperationType(binary.BigEndian.Uint32(data[0:SzOpt]))
 }
@@ -455,17 +761,64 @@ func getPageId(data []byte) int64 {
 
 // [UPDATE]4[xid]8[pageId]8[offset]8[oldLength]8[oldRaw][newRaw]
 func wrapUpdateLog(xid, pageId, offset, oldRawLength int64, oldRaw, newRaw []byte) []byte {
+	return wrapLog(UPDATE, xid, pageId, offset, oldRaw[:oldRawLength], newRaw)
+}
+
+// wrapLog [opt]4[xid]8[pageId]8[offset]8[oldLength]8[oldRaw][newRaw]
+func wrapLog(opt OperationType, xid, pageId, offset int64, oldRaw, newRaw []byte) []byte {
 	buffer := bytes.NewBuffer(make([]byte, 0))
-	_ = binary.Write(buffer, binary.BigEndian, int32(UPDATE))
+	_ = binary.Write(buffer, binary.BigEndian, int32(opt))
 	_ = binary.Write(buffer, binary.BigEndian, xid)
 	_ = binary.Write(buffer, binary.BigEndian, pageId)
 	_ = binary.Write(buffer, binary.BigEndian, offset)
-	_ = binary.Write(buffer, binary.BigEndian, oldRawLength)
+	_ = binary.Write(buffer, binary.BigEndian, int64(len(oldRaw)))
 	_ = binary.Write(buffer, binary.BigEndian, oldRaw)
 	_ = binary.Write(buffer, binary.BigEndian, newRaw)
 	return buffer.Bytes()
 }
 
+// wrapBatchInsertLog [BATCHINSERT]4[xid]8[pageId]8[offset]8[itemsLength]8[metaLength]8[oldItems][items][oldMeta][meta]
+func wrapBatchInsertLog(xid, pageId, offset int64, oldItems, items, oldMeta, meta []byte) []byte {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	_ = binary.Write(buffer, binary.BigEndian, int32(BATCHINSERT))
+	_ = binary.Write(buffer, binary.BigEndian, xid)
+	_ = binary.Write(buffer, binary.BigEndian, pageId)
+	_ = binary.Write(buffer, binary.BigEndian, offset)
+	_ = binary.Write(buffer, binary.BigEndian, int64(len(items)))
+	_ = binary.Write(buffer, binary.BigEndian, int64(len(meta)))
+	_ = binary.Write(buffer, binary.BigEndian, oldItems[:len(items)])
+	_ = binary.Write(buffer, binary.BigEndian, items)
+	_ = binary.Write(buffer, binary.BigEndian, oldMeta[:len(meta)])
+	_ = binary.Write(buffer, binary.BigEndian, meta)
+	return buffer.Bytes()
+}
+
+// parseBatchInsertLog 调用方保证长度合法, 见parseRedoRecords
+func parseBatchInsertLog(data []byte) (xid, pageId, offset int64, oldItems, items, oldMeta, meta []byte) {
+	xid, pageId = getXid(data), getPageId(data)
+	data = data[SzOpt+SzXid+SzPageId:]
+	offset = int64(binary.BigEndian.Uint64(data[:SzOffset]))
+	itemsLength := int64(binary.BigEndian.Uint64(data[SzOffset : SzOffset+SzRawLength]))
+	metaLength := int64(binary.BigEndian.Uint64(data[SzOffset+SzRawLength : SzOffset+2*SzRawLength]))
+	data = data[SzOffset+2*SzRawLength:]
+	oldItems, items = data[:itemsLength], data[itemsLength:2*itemsLength]
+	data = data[2*itemsLength:]
+	oldMeta, meta = data[:metaLength], data[metaLength:2*metaLength]
+	return
+}
+
+func wrapCheckpointLog(lsn int64) []byte {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	_ = binary.Write(buffer, binary.BigEndian, int32(CHECKPOINT))
+	_ = binary.Write(buffer, binary.BigEndian, transactions.SuperXID)
+	_ = binary.Write(buffer, binary.BigEndian, lsn)
+	return buffer.Bytes()
+}
+
+func isCheckpointLog(data []byte) bool {
+	return len(data) == SzOpt+SzXid+SzLsn && getOperationType(data) == CHECKPOINT
+}
+
 func parseUpdateLog(data []byte) (xid, pageId, offset, oldRawLength int64, oldRaw, newRaw []byte) {
 	data = data[SzOpt:]
 	xid = int64(binary.BigEndian.Uint64(data[0:SzXid]))
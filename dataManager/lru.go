@@ -19,3 +19,13 @@ func (l *LruBufferPool) Close() error {
 	//TODO implement me
 	panic("implement me")
 }
+
+func (l *LruBufferPool) FlushAll() error {
+	//TODO implement me
+	panic("implement me")
+}
+
+func (l *LruBufferPool) Stats() PoolStats {
+	//TODO implement me
+	panic("implement me")
+}
@@ -0,0 +1,190 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// 数据库元数据区
+// 系统表空间的1号页(DbMeta)之后可以链接任意多个元数据扩展页, 所有页的数据段按链表顺序拼接为一个字节流
+// 1号页: [Used]4[PageType]4 ... [VersionOn]8[VersionOff]8[NextPage]8[Data...]
+// 扩展页: [Used]4[PageType]4[NextPage]8[Data...]
+// 字节流: [SectionCount]4 ([SectionType]4[Length]4[Data])...
+// 旧版本的1号页在版本号之后全部为0, 视为没有任何section
+// 元数据区不记录redo log, 每次写入后直接写回数据文件, 跨页的写入不是原子的
+
+type MetaSection int32
+
+const (
+	MetaCheckpoint     MetaSection = 1 // checkpoint信息
+	MetaFeatures       MetaSection = 2 // 特性开关
+	MetaSpaces         MetaSection = 3 // 表空间列表
+	MetaCounters       MetaSection = 4 // 计数器
+	MetaChecksumSpaces MetaSection = 5 // 开启DataItem校验和的表空间
+	MetaFillFactors    MetaSection = 6 // 填充因子不是默认值的表空间
+	MetaUnloggedSpaces MetaSection = 7 // 不记录日志的表空间
+	MetaFreeSpaceMaps  MetaSection = 8 // 表空间的FSM页, 见freeSpaceMap.go
+
+	MetaAreaOffset int64 = VcOff + VcOffset // 1号页中元数据区的起始位置
+	SzMetaNext     int64 = 8
+	SzMetaCount    int64 = 4
+	SzMetaType     int64 = 4
+	SzMetaLength   int64 = 4
+)
+
+type ErrorMalformedMeta struct{}
+
+func (err *ErrorMalformedMeta) Error() string {
+	return "Malformed database metadata area"
+}
+
+// ReadMeta 返回section的数据(拷贝), 不存在时返回false
+func (dm *DmImpl) ReadMeta(section MetaSection) ([]byte, bool) {
+	dm.metaLock.Lock()
+	defer dm.metaLock.Unlock()
+	data, ext := dm.meta[section]
+	if !ext {
+		return nil, false
+	}
+	ret := make([]byte, len(data))
+	copy(ret, data)
+	return ret, true
+}
+
+// WriteMeta 写入section并写回数据文件, data为nil时删除section
+// 元数据区不够时在链表末尾追加扩展页
+func (dm *DmImpl) WriteMeta(section MetaSection, data []byte) error {
+	if dm.readOnly {
+		return &ErrorReadOnly{}
+	}
+	dm.metaLock.Lock()
+	defer dm.metaLock.Unlock()
+	if data == nil {
+		delete(dm.meta, section)
+	} else {
+		buf := make([]byte, len(data))
+		copy(buf, data)
+		dm.meta[section] = buf
+	}
+	return dm.flushMeta()
+}
+
+// loadMeta 启动时沿链表读出整个元数据区, 必须在崩溃恢复之后调用
+func (dm *DmImpl) loadMeta() {
+	pc := dm.getSpace(SystemSpace).pageCache
+	stream := make([]byte, 0, dm.geo.PageSize)
+	page, start, pages := dm.metaPage, MetaAreaOffset, 1
+	for {
+		data := page.GetData()
+		next := int64(binary.BigEndian.Uint64(data[start : start+SzMetaNext]))
+		stream = append(stream, data[start+SzMetaNext:dm.geo.PageLimit]...)
+		if page != dm.metaPage {
+			if err := pc.ReleasePage(page); err != nil {
+				panic(fmt.Sprintf("Error occurs when releasing meta page, err = %s", err))
+			}
+		}
+		if next == 0 {
+			break
+		}
+		p, err := pc.GetPage(next)
+		if err != nil {
+			panic(fmt.Sprintf("Error occurs when getting meta page, err = %s", err))
+		}
+		page, start, pages = p, InitOffset, pages+1
+	}
+	meta, err := decodeMetaSections(stream)
+	if err != nil {
+		panic(err)
+	}
+	dm.meta, dm.metaPages = meta, pages
+}
+
+// flushMeta 将所有section按类型排序后重新写入元数据区, 必须持有metaLock
+// 多余的扩展页保留在链表中, 之后元数据增长时继续使用
+func (dm *DmImpl) flushMeta() error {
+	pc := dm.getSpace(SystemSpace).pageCache
+	stream := encodeMetaSections(dm.meta)
+	page, start, pages := dm.metaPage, MetaAreaOffset, 1
+	for {
+		data := page.GetData()
+		next := int64(binary.BigEndian.Uint64(data[start : start+SzMetaNext]))
+		size := dm.geo.PageLimit - start - SzMetaNext
+		if int64(len(stream)) < size {
+			size = int64(len(stream))
+		}
+		if int64(len(stream)) > size && next == 0 {
+			next = pc.NewPage(DbMetaExtPage)
+			buf := make([]byte, SzMetaNext)
+			binary.BigEndian.PutUint64(buf, uint64(next))
+			if err := page.Update(buf, start); err != nil {
+				return err
+			}
+		}
+		if err := page.Update(stream[:size], start+SzMetaNext); err != nil {
+			return err
+		}
+		pc.DoFlush(page)
+		stream = stream[size:]
+		if page != dm.metaPage {
+			if err := pc.ReleasePage(page); err != nil {
+				return err
+			}
+		}
+		if len(stream) == 0 {
+			break
+		}
+		p, err := pc.GetPage(next)
+		if err != nil {
+			return err
+		}
+		page, start, pages = p, InitOffset, pages+1
+	}
+	if pages > dm.metaPages {
+		dm.metaPages = pages
+	}
+	return nil
+}
+
+func encodeMetaSections(meta map[MetaSection][]byte) []byte {
+	sections := make([]MetaSection, 0, len(meta))
+	for section := range meta {
+		sections = append(sections, section)
+	}
+	sort.Slice(sections, func(i, j int) bool { return sections[i] < sections[j] })
+	stream := make([]byte, SzMetaCount)
+	binary.BigEndian.PutUint32(stream, uint32(len(sections)))
+	for _, section := range sections {
+		header := make([]byte, SzMetaType+SzMetaLength)
+		binary.BigEndian.PutUint32(header[:SzMetaType], uint32(section))
+		binary.BigEndian.PutUint32(header[SzMetaType:], uint32(len(meta[section])))
+		stream = append(stream, header...)
+		stream = append(stream, meta[section]...)
+	}
+	return stream
+}
+
+func decodeMetaSections(stream []byte) (map[MetaSection][]byte, error) {
+	meta := make(map[MetaSection][]byte)
+	if int64(len(stream)) < SzMetaCount {
+		return nil, &ErrorMalformedMeta{}
+	}
+	count := int64(binary.BigEndian.Uint32(stream[:SzMetaCount]))
+	pointer := SzMetaCount
+	for i := int64(0); i < count; i++ {
+		if pointer+SzMetaType+SzMetaLength > int64(len(stream)) {
+			return nil, &ErrorMalformedMeta{}
+		}
+		section := MetaSection(binary.BigEndian.Uint32(stream[pointer : pointer+SzMetaType]))
+		length := int64(binary.BigEndian.Uint32(stream[pointer+SzMetaType : pointer+SzMetaType+SzMetaLength]))
+		pointer += SzMetaType + SzMetaLength
+		if length > int64(len(stream))-pointer {
+			return nil, &ErrorMalformedMeta{}
+		}
+		data := make([]byte, length)
+		copy(data, stream[pointer:pointer+length])
+		meta[section] = data
+		pointer += length
+	}
+	return meta, nil
+}
@@ -0,0 +1,86 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+)
+
+// 孤儿页回收
+// 表空间中的数据页可能不再被任何记录引用(例如崩溃前申请但没有链接到表中, 回滚的建表留下的表空间), 其中的空间永远不会被复用
+// 上层从目录出发计算每个表空间中可达的页, 其余非空的数据页为孤儿页: 所有槽位置为已清理(见purge.go), 空间放回空闲空间表
+// 槽位号不复用, 之后的插入分配新的槽位; 旧格式的数据页转换为空的槽式数据页
+// 页头以及槽位的修改只重做不撤销(REDOONLY), 页中原有的DataItem不再能通过uid访问
+// 可达的页上的溢出头引用的溢出段所在的页同样可达(见overflow.go), 不再被引用的溢出段作为孤儿页回收
+// 上层保证回收期间没有其他事物访问该表空间
+
+// ReclaimPages
+// 回收space中reachable之外的非空数据页, 返回孤儿页的页号(升序); dryRun时只返回不修改
+func (dm *DmImpl) ReclaimPages(xid, space int64, reachable map[int64]struct{}, dryRun bool) []int64 {
+	ts := dm.getSpace(space)
+	orphans := make([]int64, 0)
+	chunks := dm.overflowPages(space, reachable)
+	pn := ts.pageCache.GetPageNumbers()
+	for pageId := int64(1); pageId <= pn; pageId++ {
+		if pageId == PageNumberDbMeta {
+			continue
+		}
+		if _, ext := reachable[pageId]; ext {
+			continue
+		}
+		if _, ext := chunks[pageId]; ext {
+			continue
+		}
+		page, err := ts.pageCache.GetPage(pageId)
+		if err != nil {
+			panic(fmt.Sprintf("Error occurs when getting pages, err = %s\n", err))
+		}
+		lock := dm.pageLocks.of(space, pageId)
+		lock.Lock()
+		if isOrphan(page) {
+			orphans = append(orphans, pageId)
+			if !dryRun {
+				dm.resetPage(xid, space, page)
+				ts.pageCtl.Reset(pageId, page.GetFree())
+			}
+		}
+		lock.Unlock()
+		if err = ts.pageCache.ReleasePage(page); err != nil {
+			panic(fmt.Sprintf("Error occurs when releasing pages, err = %s\n", err))
+		}
+	}
+	if len(orphans) > 0 {
+		log.Printf("[Data Manager] Find %d orphan pages in table space %d, dry run %t\n", len(orphans), space, dryRun)
+	}
+	return orphans
+}
+
+// isOrphan 页是不可达时需要回收的数据页(已经为空的页不需要回收)
+func isOrphan(page Page) bool {
+	data := page.GetData()
+	if isSlotted(data) {
+		for slot := int64(0); slot < slotsOf(data); slot++ {
+			if locate(data, slot) != purgedSlot {
+				return true
+			}
+		}
+		return false
+	}
+	return page.GetPageType() == DataPage && page.GetUsed() > InitOffset
+}
+
+// resetPage 清理所有槽位(旧格式的数据页转换为空的槽式数据页), 调用方持有页锁
+func (dm *DmImpl) resetPage(xid, space int64, page Page) {
+	data := page.GetData()
+	slots := int64(0)
+	if isSlotted(data) {
+		slots = slotsOf(data)
+	}
+	head := make([]byte, slotPosition(slots))
+	binary.BigEndian.PutUint32(head[:SzPgUsed], uint32(slotPosition(slots)))
+	binary.BigEndian.PutUint32(head[SzPgUsed:InitOffset], uint32(SlottedPage))
+	binary.BigEndian.PutUint16(head[InitOffset:InitOffset+SzSlots], uint16(slots))
+	binary.BigEndian.PutUint16(head[InitOffset+SzSlots:SlotArrayStart], uint16(dm.geo.PageLimit))
+	dm.redo.RedoOnlyLog(getSpaceUid(space, page.GetId(), 0), xid, data[:len(head)], head)
+	dm.writePage(page, head, 0)
+}
@@ -0,0 +1,174 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 跨页存储(溢出链)
+// 包装之后超过MaxItemSize的数据不再整体写入一个页: 数据切分为若干段, 每段作为一个普通的DataItem(溢出段)插入同一个表空间,
+// 段之间按uid组成单向链表, 原来的位置只写入一个很小的溢出头:
+// 溢出头 RAW: [valid]1[SzOverflowHead | DIOverflow]8[totalSize]8[firstChunk]8(开启校验和时见checksum.go)
+// 溢出段 DATA: [nextChunk]8[data], 最后一段的nextChunk为0, 每段几乎占满一个页; dataSize中带DIChunk标记(块采样时跳过, 见sample.go)
+// 溢出头与普通的DataItem一样参与有效位, 原地更新, 页内移动以及转发桩, uid的语义不变;
+// 读取(Read, ReadSnapShot, ReadGuard)时沿链表拼出完整的数据, 总是深拷贝(ReadGuard读大数据时不是零拷贝)
+// 溢出段写入之后不再修改: 更新时写入新的链表, 溢出头改为指向新的链表, 旧的链表保留给回滚以及崩溃恢复(撤销溢出头的修改之后仍然指向它)
+// 溢出段与溢出头都按普通的插入/更新记录redo log, 崩溃恢复时与其他DataItem一样重做或撤销
+// 不再被任何溢出头引用的段由孤儿页回收(ReclaimPages)回收: 可达的页上所有溢出头(包括无效的头以及转发桩)引用的段都视为可达
+
+const (
+	DIOverflow     uint64 = 1 << 62 // dataSize的次高位, DataItem为溢出头
+	DIChunk        uint64 = 1 << 61 // DataItem为溢出段
+	SzOverflowHead int64  = 16
+	SzOverflowNext int64  = 8
+)
+
+// overflowItem 溢出头, GetData返回拼接之后的完整数据, 其他操作作用于溢出头本身
+type overflowItem struct {
+	*DataItemImpl
+	dm *DmImpl
+}
+
+func (oi *overflowItem) GetData() []byte {
+	return oi.dm.readOverflow(oi.DataItemImpl.GetData())
+}
+
+func (oi *overflowItem) GetDataLength() int64 {
+	return int64(binary.BigEndian.Uint64(oi.DataItemImpl.GetData()))
+}
+
+// isOverflow raw为溢出头(或者由溢出头改写的转发桩)
+func isOverflow(raw []byte) bool {
+	return binary.BigEndian.Uint64(raw[SzDIValid:SzDIValid+SzDIDataSize])&DIOverflow != 0
+}
+
+// isChunk raw为溢出段
+func isChunk(raw []byte) bool {
+	return binary.BigEndian.Uint64(raw[SzDIValid:SzDIValid+SzDIDataSize])&DIChunk != 0
+}
+
+// storedRaw 按表空间的设置包装data, 超过一个页时先写入溢出链, 返回溢出头
+func (dm *DmImpl) storedRaw(xid, space int64, data []byte) ([]byte, error) {
+	if dm.readOnly {
+		return nil, &ErrorReadOnly{}
+	}
+	raw := dm.wrapRaw(space, data)
+	if int64(len(raw)) <= dm.geo.MaxItemSize {
+		return raw, nil
+	}
+	first, err := dm.writeOverflow(xid, space, data)
+	if err != nil {
+		return nil, err
+	}
+	return wrapOverflowHead(int64(len(data)), first, dm.getSpace(space).checksum.Load()), nil
+}
+
+// wrapOverflowHead 指向first开始的溢出链的溢出头, total为完整数据的长度
+func wrapOverflowHead(total, first int64, checked bool) []byte {
+	head := make([]byte, SzOverflowHead)
+	binary.BigEndian.PutUint64(head, uint64(total))
+	binary.BigEndian.PutUint64(head[8:], uint64(first))
+	raw := WrapDataItemRaw(head)
+	if checked {
+		raw = WrapDataItemRawChecked(head)
+	}
+	size := binary.BigEndian.Uint64(raw[SzDIValid : SzDIValid+SzDIDataSize])
+	binary.BigEndian.PutUint64(raw[SzDIValid:SzDIValid+SzDIDataSize], size|DIOverflow)
+	return raw
+}
+
+// writeOverflow 从最后一段开始插入溢出段, 返回第一段的uid
+// 插入失败时已经插入的段不再被引用, 由孤儿页回收
+func (dm *DmImpl) writeOverflow(xid, space int64, data []byte) (int64, error) {
+	next, chunkSize := int64(0), dm.geo.overflowChunk
+	for end := int64(len(data)); end > 0; {
+		start := (end - 1) / chunkSize * chunkSize
+		chunk := make([]byte, SzOverflowNext+end-start)
+		binary.BigEndian.PutUint64(chunk, uint64(next))
+		copy(chunk[SzOverflowNext:], data[start:end])
+		raw := dm.wrapRaw(space, chunk)
+		size := binary.BigEndian.Uint64(raw[SzDIValid : SzDIValid+SzDIDataSize])
+		binary.BigEndian.PutUint64(raw[SzDIValid:SzDIValid+SzDIDataSize], size|DIChunk)
+		uid, err := dm.insertRaw(xid, space, raw, -1, false)
+		if err != nil {
+			return 0, err
+		}
+		next, end = uid, start
+	}
+	return next, nil
+}
+
+// readOverflow 沿溢出头head中的链表读出完整的数据
+func (dm *DmImpl) readOverflow(head []byte) []byte {
+	total := int64(binary.BigEndian.Uint64(head))
+	next := int64(binary.BigEndian.Uint64(head[8:]))
+	data := make([]byte, 0, total)
+	for next != 0 {
+		di := dm.doRead(next)
+		chunk := di.GetData()
+		di.Release()
+		next = int64(binary.BigEndian.Uint64(chunk))
+		data = append(data, chunk[SzOverflowNext:]...)
+	}
+	if int64(len(data)) != total {
+		panic(fmt.Sprintf("Error occurs when reading overflow chain, read %d of %d bytes", len(data), total))
+	}
+	return data
+}
+
+// overflowPages reachable中的页上的溢出头引用的所有溢出段所在的页
+func (dm *DmImpl) overflowPages(space int64, reachable map[int64]struct{}) map[int64]struct{} {
+	ts := dm.getSpace(space)
+	res := make(map[int64]struct{})
+	firsts := make([]int64, 0)
+	for pageId := range reachable {
+		if pageId < 1 || pageId > ts.pageCache.GetPageNumbers() {
+			continue
+		}
+		page, err := ts.pageCache.GetPage(pageId)
+		if err != nil {
+			panic(fmt.Sprintf("Error occurs when getting pages, err = %s\n", err))
+		}
+		page.View(func(data []byte) {
+			forEachItem(data, func(data []byte, position int64) {
+				if isOverflow(data[position:]) {
+					start := position + SzDIValid + SzDIDataSize + 8
+					firsts = append(firsts, int64(binary.BigEndian.Uint64(data[start:start+8])))
+				}
+			})
+		})
+		if err = ts.pageCache.ReleasePage(page); err != nil {
+			panic(fmt.Sprintf("Error occurs when releasing pages, err = %s\n", err))
+		}
+	}
+	for _, next := range firsts {
+		for next != 0 {
+			res[PageOf(next)] = struct{}{}
+			di := dm.doRead(next)
+			next = int64(binary.BigEndian.Uint64(di.GetData()))
+			di.Release()
+		}
+	}
+	return res
+}
+
+// forEachItem 页中的每个DataItem(不包括已经清理的槽位)
+func forEachItem(data []byte, fn func(data []byte, position int64)) {
+	if isSlotted(data) {
+		for slot := int64(0); slot < slotsOf(data); slot++ {
+			if position := locate(data, slot); position != purgedSlot {
+				fn(data, position)
+			}
+		}
+		return
+	}
+	if PageType(binary.BigEndian.Uint32(data[SzPgUsed:InitOffset])) != DataPage {
+		return
+	}
+	used := int64(binary.BigEndian.Uint32(data[:SzPgUsed]))
+	for position := InitOffset; position < used; {
+		fn(data, position)
+		_, rawSize, _ := itemSize(data, position)
+		position += rawSize
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"reflect"
 	"sync"
+	"sync/atomic"
 )
 
 // Page
@@ -22,6 +23,8 @@ type Page interface {
 	SetUsed(used int32)
 	GetFree() int64
 	GetPageType() PageType
+	Locate(offset int64) ([]byte, int64) // 解析槽位, 与页内的插入互斥
+	View(fn func(data []byte))           // 持有读锁访问页的数据
 	IsMetaPage() bool
 	IsDataPage() bool
 }
@@ -32,28 +35,29 @@ type PageType int32
 const (
 	DbMetaPage    PageType = 1<<0 | 1<<15
 	TableMetaPage PageType = 1<<0 | 1<<16
+	DbMetaExtPage PageType = 1<<0 | 1<<19 // 数据库元数据区的扩展页
 	IndexPage     PageType = 1<<1 | 1<<17
 	RecordPage    PageType = 1<<1 | 1<<18
 	DataPage      PageType = 1 << 1
+	SlottedPage   PageType = 1<<1 | 1<<20 // 槽式数据页, 见slottedPage.go
 	MetaPage      PageType = 1 << 0
 
 	VcOn     = 100
 	VcOffset = 8
 	VcOff    = VcOn + VcOffset
 
-	PageSize    int64 = 8192 // 8K bytes
-	SzPgUsed    int64 = 4
-	SzPageType  int64 = 4
-	MaxFreeSize       = PageSize - SzPgUsed - SzPageType // 数据页面的最大使用空间
-	InitOffset        = SzPgUsed + SzPageType
+	SzPgUsed   int64 = 4
+	SzPageType int64 = 4
+	InitOffset       = SzPgUsed + SzPageType
 )
 
 type PageImpl struct {
-	lock   sync.RWMutex // 保护data和dirty字段
-	data   []byte
+	lock   sync.RWMutex           // 保护页内容的原地修改以及dirty字段
+	data   atomic.Pointer[[]byte] // 整理以及清理时整页替换, 无锁读取
 	dirty  bool
 	pageId int64
 	pc     PageCache // 每个Page组合一个PageCache，可以在操作页面时对页面缓存进行操作
+	geo    *Geometry // 页大小在打开数据库时决定, 页的内容不超过PageLimit, 见pageSize.go
 }
 
 // Page结构 [Used Space]4[Page Type]4[Data...]
@@ -83,21 +87,37 @@ func (p *PageImpl) GetId() int64 {
 }
 
 func (p *PageImpl) GetData() []byte {
-	return p.data
+	return *p.data.Load()
+}
+
+// Locate 页的数据以及uid中的offset(槽位号或旧格式的偏移)对应的DataItem在页中的偏移
+// 槽式数据页的插入以及页内移动持有写锁原地修改页头和槽位数组, 读者持有读锁解析槽位
+func (p *PageImpl) Locate(offset int64) ([]byte, int64) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	data := p.GetData()
+	return data, locate(data, offset)
+}
+
+// View 持有读锁访问页的数据, 用于解析页头以及槽位数组
+func (p *PageImpl) View(fn func(data []byte)) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	fn(p.GetData())
 }
 
 func (p *PageImpl) GetOffset() int64 {
-	return (p.pageId - 1) * PageSize
+	return (p.pageId - 1) * p.geo.PageSize
 }
 
 func (p *PageImpl) GetDataSize() int64 {
-	return PageSize
+	return p.geo.PageSize
 }
 
 func (p *PageImpl) SetData(data []byte) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
-	p.data = data
+	p.data.Store(&data)
 }
 
 // 数据库元数据页管理
@@ -106,29 +126,32 @@ func (p *PageImpl) SetData(data []byte) {
 // 启动检查，检查进程上次退出是否是意外退出
 // 如果是意外退出，则上层需要执行恢复数据的逻辑
 func (p *PageImpl) CheckInitVersion() bool {
+	data := p.GetData()
 	if p.GetPageType() != DbMetaPage {
 		panic("Invalid page type when executing version checking\n")
 	}
-	v1, v2 := p.data[VcOn:VcOn+VcOffset], p.data[VcOff:VcOff+VcOffset]
+	v1, v2 := data[VcOn:VcOn+VcOffset], data[VcOff:VcOff+VcOffset]
 	return reflect.DeepEqual(v1, v2)
 }
 
 // InitVersion 初始化版本号, 仅当系统启动时调用
 func (p *PageImpl) InitVersion() {
+	data := p.GetData()
 	if p.GetPageType() != DbMetaPage {
 		panic("Invalid page type when executing version checking\n")
 	}
-	if _, err := rand.Read(p.data[VcOn : VcOn+VcOffset]); err != nil {
+	if _, err := rand.Read(data[VcOn : VcOn+VcOffset]); err != nil {
 		panic("Error happen when initializing version\n")
 	}
 }
 
 // UpdateVersion 更新包版本号, 仅当系统正常退出时调用
 func (p *PageImpl) UpdateVersion() {
+	data := p.GetData()
 	if p.GetPageType() != DbMetaPage {
 		panic("Invalid page type when executing version checking\n")
 	}
-	copy(p.data[VcOff:VcOff+VcOffset], p.data[VcOn:VcOn+VcOffset])
+	copy(data[VcOff:VcOff+VcOffset], data[VcOn:VcOn+VcOffset])
 }
 
 // 普通页管理
@@ -145,16 +168,17 @@ func (e *ErrorPageOverFlow) Error() string {
 func (p *PageImpl) Append(toAdd []byte) error {
 	p.Lock()
 	defer p.Unlock()
-	tmp := p.data[:SzPgUsed]
+	data := p.GetData()
+	tmp := data[:SzPgUsed]
 	used, length := int64(binary.BigEndian.Uint32(tmp)), int64(len(toAdd))
 	log.Printf("[PAGE LINE 148] APPEND PAGE %d %d, LEN: %d\n", p.pageId, used, length)
-	if length+used > PageSize {
+	if length+used > p.geo.PageLimit {
 		return &ErrorPageOverFlow{}
 	}
-	copy(p.data[used:used+length], toAdd)
+	copy(data[used:used+length], toAdd)
 	buf := bytes.NewBuffer([]byte{})
 	_ = binary.Write(buf, binary.BigEndian, int32(used+length))
-	copy(p.data[:SzPgUsed], buf.Bytes())
+	copy(data[:SzPgUsed], buf.Bytes())
 	log.Printf("[PAGE LINE 158] APPEND PAGE %d, USED: %d\n", p.pageId, used+length)
 	p.dirty = true
 	return nil
@@ -162,20 +186,22 @@ func (p *PageImpl) Append(toAdd []byte) error {
 
 // Update 更新数据页的数据
 // 用于redo log恢复操作
+// 槽式数据页的Used由页头的日志维护, 不随写入的位置改变
 func (p *PageImpl) Update(toUp []byte, offset int64) error {
 	p.Lock()
 	defer p.Unlock()
+	data := p.GetData()
 	length := int64(len(toUp))
-	if length+offset > PageSize {
+	if length+offset > p.geo.PageLimit {
 		return &ErrorPageOverFlow{}
 	}
-	copy(p.data[offset:offset+length], toUp)
-	buf := p.data[:SzPgUsed]
+	copy(data[offset:offset+length], toUp)
+	buf := data[:SzPgUsed]
 	currentLength := int64(binary.BigEndian.Uint32(buf))
-	if length+offset > currentLength {
+	if length+offset > currentLength && !isSlotted(data) {
 		buffer := bytes.NewBuffer([]byte{})
 		_ = binary.Write(buffer, binary.BigEndian, int32(length+offset))
-		copy(p.data[:SzPgUsed], buffer.Bytes())
+		copy(data[:SzPgUsed], buffer.Bytes())
 	}
 	p.dirty = true
 	return nil
@@ -184,27 +210,33 @@ func (p *PageImpl) Update(toUp []byte, offset int64) error {
 func (p *PageImpl) GetUsed() int64 {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
-	buf := p.data[:SzPgUsed]
+	data := p.GetData()
+	buf := data[:SzPgUsed]
 	return int64(binary.BigEndian.Uint32(buf))
 }
 
 func (p *PageImpl) SetUsed(used int32) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
+	data := p.GetData()
 	buf := bytes.NewBuffer([]byte{})
 	_ = binary.Write(buf, binary.BigEndian, used)
-	copy(p.data[:SzPgUsed], buf.Bytes())
+	copy(data[:SzPgUsed], buf.Bytes())
 }
 
 func (p *PageImpl) GetFree() int64 {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
-	buf := p.data[:SzPgUsed]
-	return PageSize - int64(binary.BigEndian.Uint32(buf))
+	data := p.GetData()
+	buf := data[:SzPgUsed]
+	return p.geo.PageLimit - int64(binary.BigEndian.Uint32(buf))
 }
 
 func (p *PageImpl) GetPageType() PageType {
-	buf := p.data[SzPgUsed : SzPgUsed+SzPageType]
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	data := p.GetData()
+	buf := data[SzPgUsed : SzPgUsed+SzPageType]
 	return PageType(binary.BigEndian.Uint32(buf))
 }
 
@@ -213,5 +245,5 @@ func (p *PageImpl) IsMetaPage() bool {
 }
 
 func (p *PageImpl) IsDataPage() bool {
-	return p.GetPageType()&(1<<1) == 1
+	return p.GetPageType()&(1<<1) != 0
 }
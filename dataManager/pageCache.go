@@ -26,6 +26,8 @@ type PageCache interface {
 	GetPageNumbers() int64
 	Close()
 	DoFlush(page Page) // 直接刷新到数据源
+	FlushAll() error   // 将所有脏页写回数据源并刷盘
+	Stats() PoolStats
 }
 
 // Implementation
@@ -39,11 +41,12 @@ type PageCacheImpl struct {
 	ds          DataSource   // only used for NewPage-> doFlush method
 	lock        *sync.Mutex  // protect the NewPage/ GetPage/ ReleasePage, the only global lock of the page cache system
 	pageNumbers atomic.Int64 // the total page numbers in the DS
+	tier        *pageTier    // 记录区的访问时间, 见coldStorage.go
+	allocated   atomic.Int64 // NewPage新建的页数
 }
 
+// Close BufferPool与PageCache共用同一把锁, 由BufferPool加锁
 func (p *PageCacheImpl) Close() {
-	p.lock.Lock()
-	defer p.lock.Unlock()
 	if err := p.pool.Close(); err != nil {
 		panic(err)
 	}
@@ -59,6 +62,7 @@ func (p *PageCacheImpl) NewPage(pt PageType) int64 {
 	defer p.lock.Unlock()
 	newPage := defaultPageFactory.newPage(p.ds, p.pageNumbers.Load()+1, p, pt)
 	p.pageNumbers.Add(1)
+	p.allocated.Add(1)
 	p.DoFlush(newPage)
 	return p.pageNumbers.Load()
 }
@@ -70,6 +74,7 @@ func (p *PageCacheImpl) GetPage(pageId int64) (Page, error) {
 	if !p.checkKeyValid(pageId) {
 		panic("Invalid page id\n")
 	}
+	p.tier.touch(pageId)
 	// 组装空Page
 	page := defaultPageFactory.newPage(p.ds, pageId, p, -1)
 	if result, err := p.pool.Get(page); err != nil {
@@ -81,9 +86,8 @@ func (p *PageCacheImpl) GetPage(pageId int64) (Page, error) {
 }
 
 // ReleasePage 释放对Page的引用，用于内存淘汰
+// 并发安全由BufferPool实现
 func (p *PageCacheImpl) ReleasePage(page Page) error {
-	p.lock.Lock()
-	defer p.lock.Unlock()
 	return p.pool.Release(page)
 }
 
@@ -104,13 +108,27 @@ func (p *PageCacheImpl) GetPageNumbers() int64 {
 
 // This method is only in file System
 func (p *PageCacheImpl) getPageOffset(pageId int64) int64 {
-	return (pageId - 1) * PageSize
+	return (pageId - 1) * p.tier.geo.PageSize
 }
 
 func (p *PageCacheImpl) checkKeyValid(pageId int64) bool {
 	return pageId <= p.pageNumbers.Load() && pageId > 0
 }
 
+// FlushAll 并发安全由BufferPool实现
+func (p *PageCacheImpl) FlushAll() error {
+	if err := p.pool.FlushAll(); err != nil {
+		return err
+	}
+	return p.ds.Sync()
+}
+
+func (p *PageCacheImpl) Stats() PoolStats {
+	stats := p.pool.Stats()
+	stats.Allocated = p.allocated.Load()
+	return stats
+}
+
 // DoFlush
 // must take the lock first(private method)
 // flush the page into data source, any error will panic
@@ -132,28 +150,38 @@ type pageFactoryImpl struct{}
 // 工厂方法
 // extensible
 func (p pageFactoryImpl) newPage(ds DataSource, pageId int64, pc PageCache, pageType PageType) Page {
-	switch ds.(type) {
+	switch ds := ds.(type) {
 	case *FileSystemDataSource:
-		data := make([]byte, PageSize)
+		geo := ds.tier.geo
+		data := make([]byte, geo.PageSize)
 		buf := bytes.NewBuffer([]byte{})
 		_ = binary.Write(buf, binary.BigEndian, int32(InitOffset))
 		copy(data[0:SzPgUsed], buf.Bytes())
 		buf = bytes.NewBuffer([]byte{})
 		_ = binary.Write(buf, binary.BigEndian, int32(pageType))
 		copy(data[SzPgUsed:SzPgUsed+SzPageType], buf.Bytes())
-		return &PageImpl{
-			pageId: pageId, dirty: false, pc: pc, data: data,
+		if pageType == SlottedPage {
+			initSlottedPage(data, geo.PageLimit)
 		}
+		page := &PageImpl{
+			pageId: pageId, dirty: false, pc: pc, geo: geo,
+		}
+		page.data.Store(&data)
+		return page
 	default:
 		panic("Invalid dataSource type\n")
 	}
 }
 
-func NewPageCacheRefCountFileSystemImpl(maxRecourse uint32, path string, lock *sync.Mutex) PageCache {
-	this := &PageCacheImpl{lock: lock}
-	ds := NewFileSystemDataSource(path, lock)
+func NewPageCacheRefCountFileSystemImpl(maxRecourse uint32, path string, lock *sync.Mutex, wal func()) PageCache {
+	return newPageCache(maxRecourse, path, lock, wal, openPageTier(path+FileSuffix, defaultGeometry, false))
+}
+
+func newPageCache(maxRecourse uint32, path string, lock *sync.Mutex, wal func(), tier *pageTier) PageCache {
+	this := &PageCacheImpl{lock: lock, tier: tier}
+	ds := newFileSystemDataSource(path, lock, wal, tier)
 	length := ds.GetDataLength()
-	this.pageNumbers.Store(length / PageSize)
+	this.pageNumbers.Store(length / tier.geo.PageSize)
 	this.ds = ds
 	bufferPool := NewRefCountBufferPool(maxRecourse, ds, lock)
 	this.pool = bufferPool
@@ -0,0 +1,192 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"myDB/dbError"
+	"os"
+	"sync/atomic"
+)
+
+// 页校验和
+// 页写回数据文件时写入校验和, 写入页的拷贝, 从数据文件读入页时校验并清除校验和, 内存中的页, 日志以及恢复都不受影响
+// 页校验和的格式记录在系统表空间1号页(DbMeta)中(位于加密方式之后), 打开数据库时决定, 记录在Geometry中:
+// 1. ChecksumCrc32(新建的数据库): 每个页的末尾保留SzPageTrailer字节, 写入页号以及页中之前的内容的CRC32,
+// 同时在数据文件中的PageType最高字节设置格式标志(PageFormatFlag, 页类型不超过24位, 内存中总为0);
+// 带格式标志的页总是校验, 没有格式标志的页只能是全0的页(分配之后尚未写回), 否则视为校验失败
+// 2. ChecksumFolded(之前的版本创建的数据库, 记录为0): 页没有保留字节, 校验和为CRC32折叠的16位, 写入页头Used字段的高2字节,
+// 0表示没有校验和(计算结果为0时记为1), 没有校验和的页不校验
+// 页号参与计算, 写入错误位置的页同样校验失败
+// 校验失败时调用修复函数(SetPageRepair), 修复函数返回的页代替读入的页并立即写回数据文件(修复函数保证其内容与日志一致),
+// 没有修复函数或者修复失败时读页返回ErrorPageChecksum; 崩溃恢复时同样校验, 因此修复函数需要在打开数据库之前设置
+// 页校验(scrub), 双写以及备份同样检查校验和
+
+const (
+	ChecksumFolded       int32 = 0
+	ChecksumCrc32        int32 = 1
+	SzPageChecksum       int64 = 2 // ChecksumFolded的校验和
+	SzPageTrailer        int64 = 4 // ChecksumCrc32的校验和
+	PageFormatFlag       byte  = 0x40
+	ChecksumFormatOffset       = EncryptionOffset + SzCipherMode + SzKeyCheck
+	SzChecksumFormat     int64 = 4
+)
+
+type ErrorPageChecksum struct {
+	File     string // 表空间的数据文件
+	PageId   int64
+	Stored   uint32
+	Computed uint32
+}
+
+func (err *ErrorPageChecksum) Error() string {
+	return fmt.Sprintf("Page %d in %s is corrupt, page checksum mismatch, stored %08x, computed %08x", err.PageId, err.File, err.Stored, err.Computed)
+}
+
+func (err *ErrorPageChecksum) Is(target error) bool {
+	return target == dbError.ErrCorruptPage
+}
+
+// PageRepair 修复数据文件file中校验失败的页, data为读入的内容, 返回修复之后的页(不含校验和)
+type PageRepair func(file string, pageId int64, data []byte) ([]byte, error)
+
+var pageRepair atomic.Pointer[PageRepair]
+
+// SetPageRepair 设置校验失败的页的修复函数, 进程中所有数据库共享, nil表示不修复
+func SetPageRepair(fn PageRepair) {
+	if fn == nil {
+		pageRepair.Store(nil)
+		return
+	}
+	pageRepair.Store(&fn)
+}
+
+func pageCrc(pageId int64, data []byte) uint32 {
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], uint64(pageId))
+	return crc32.Update(crc32.ChecksumIEEE(id[:]), crc32.IEEETable, data)
+}
+
+func foldedChecksum(pageId int64, data []byte) uint32 {
+	crc := pageCrc(pageId, data[SzPageChecksum:])
+	if sum := uint16(crc) ^ uint16(crc>>16); sum != 0 {
+		return uint32(sum)
+	}
+	return 1
+}
+
+// stamp 原地写入校验和, page为写回数据文件的拷贝
+func (g *Geometry) stamp(pageId int64, page []byte) {
+	if g.Checksum == ChecksumFolded {
+		binary.BigEndian.PutUint16(page, uint16(foldedChecksum(pageId, page)))
+		return
+	}
+	trailer := g.PageSize - SzPageTrailer
+	page[SzPgUsed] |= PageFormatFlag
+	binary.BigEndian.PutUint32(page[trailer:], pageCrc(pageId, page[:trailer]))
+}
+
+// checkStamp 检查从数据文件读入的页的校验和, 返回页是否带校验和
+func (g *Geometry) checkStamp(file string, pageId int64, page []byte) (bool, error) {
+	if g.Checksum == ChecksumFolded {
+		stored := uint32(binary.BigEndian.Uint16(page))
+		if stored == 0 {
+			return false, nil
+		}
+		if computed := foldedChecksum(pageId, page); computed != stored {
+			return true, &ErrorPageChecksum{File: file, PageId: pageId, Stored: stored, Computed: computed}
+		}
+		return true, nil
+	}
+	trailer := g.PageSize - SzPageTrailer
+	stored, computed := binary.BigEndian.Uint32(page[trailer:]), pageCrc(pageId, page[:trailer])
+	if page[SzPgUsed]&PageFormatFlag == 0 {
+		if zeroPage(page) {
+			return false, nil
+		}
+		return false, &ErrorPageChecksum{File: file, PageId: pageId, Stored: stored, Computed: computed}
+	}
+	if computed != stored {
+		return true, &ErrorPageChecksum{File: file, PageId: pageId, Stored: stored, Computed: computed}
+	}
+	return true, nil
+}
+
+// clearStamp 清除校验和以及格式标志
+func (g *Geometry) clearStamp(page []byte) {
+	if g.Checksum == ChecksumFolded {
+		binary.BigEndian.PutUint16(page, 0)
+		return
+	}
+	page[SzPgUsed] &^= PageFormatFlag
+	binary.BigEndian.PutUint32(page[g.PageSize-SzPageTrailer:], 0)
+}
+
+// verifyPage 校验从数据文件读入的页并清除校验和, 返回页是否带校验和
+func (g *Geometry) verifyPage(file string, pageId int64, data []byte) (bool, error) {
+	stamped, err := g.checkStamp(file, pageId, data)
+	if err != nil {
+		return stamped, err
+	}
+	if stamped {
+		g.clearStamp(data)
+	}
+	return stamped, nil
+}
+
+// repairPage 调用修复函数, 成功时返回修复之后的页
+func (g *Geometry) repairPage(corrupt *ErrorPageChecksum, data []byte) ([]byte, error) {
+	fn := pageRepair.Load()
+	if fn == nil {
+		return nil, corrupt
+	}
+	repaired, err := (*fn)(corrupt.File, corrupt.PageId, data)
+	if err != nil || len(repaired) != len(data) {
+		log.Printf("[Data Manager] Fail to repair page %d in %s, err = %v\n", corrupt.PageId, corrupt.File, err)
+		return nil, corrupt
+	}
+	log.Printf("[Data Manager] Repair page %d in %s\n", corrupt.PageId, corrupt.File)
+	g.clearStamp(repaired)
+	return repaired, nil
+}
+
+func zeroPage(page []byte) bool {
+	for _, b := range page {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// storedChecksum 从数据文件读取记录的校验和格式, 数据文件不存在或者为空时为新建的数据库(ChecksumCrc32)
+func storedChecksum(path string) (int32, error) {
+	file, err := os.Open(path + FileSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ChecksumCrc32, nil
+		}
+		return ChecksumFolded, err
+	}
+	defer file.Close()
+	buf := make([]byte, SzChecksumFormat)
+	if n, _ := file.ReadAt(buf, ChecksumFormatOffset); int64(n) < SzChecksumFormat {
+		return ChecksumCrc32, nil
+	}
+	switch format := int32(binary.BigEndian.Uint32(buf)); format {
+	case ChecksumFolded, ChecksumCrc32:
+		return format, nil
+	default:
+		return ChecksumFolded, fmt.Errorf("unknown page checksum format %d in %s", format, path)
+	}
+}
+
+// recordChecksum 在DbMeta页中记录校验和格式, 随DbMeta页写回
+func (dm *DmImpl) recordChecksum() {
+	buf := make([]byte, SzChecksumFormat)
+	binary.BigEndian.PutUint32(buf, uint32(dm.geo.Checksum))
+	if err := dm.metaPage.Update(buf, ChecksumFormatOffset); err != nil {
+		panic(fmt.Sprintf("Error occurs when recording page checksum format, err = %s", err))
+	}
+}
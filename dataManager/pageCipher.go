@@ -0,0 +1,301 @@
+package dataManager
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"myDB/dbError"
+	"os"
+)
+
+// 页加密(静态数据加密)
+// 创建数据库时通过WithEncryption传入密钥来源(KeyProvider), 之后页在写回数据文件时用AES-GCM加密, 从数据文件读入时解密, 内存中的页为明文
+// 加密的数据库每个页的末尾另外保留SzPageCipher字节(页的内容不超过PageLimit):
+// 数据文件中的页: [Used]4[PageType]4[密文]PageLimit-8[Tag]16[Nonce]12[Checksum]4
+// 页头不加密, 页号, 页头, 表空间id以及数据库标识作为附加数据参与认证, 每次写回使用新的随机nonce:
+// 页放到其他位置, 其他表空间或者其他数据库(即使使用相同的密钥), 以及页头被修改时解密失败
+// 数据库标识为创建数据库时生成的随机数, 记录在DbMeta中(位于页校验和格式之后); 之前的版本创建的数据库没有标识(记录为0), 附加数据只有页号以及页头
+// 页与表空间绑定, 因此加密的数据库不能挂载(AttachSpace)其他表空间的数据文件, 返回ErrorEncryptedAttach
+// 页校验和(见pageChecksum.go)在加密之后计算, 覆盖密文, 因此双写, 备份, 区压缩等直接读写数据文件的功能不需要密钥; 页校验(scrub)解密之后检查
+// 系统表空间的1号页(DbMeta)不加密, 记录加密方式以及密钥校验值([Cipher]4[KeyCheck]8, 位于页大小之后), 打开数据库时在读取任何页之前校验密钥:
+// 密钥校验值为HMAC-SHA256(key, KeyCheckLabel)的前8字节, 与GCM的认证子密钥无关(CipherAesGcmHmac)
+// 之前的版本(CipherAesGcm)记录全0块的密文, 即GHASH子密钥H的前64位; 打开时按旧的方式校验, 之后改写为新的校验值
+// 密钥不一致时Open返回ErrorEncryptionKey, 加密的数据库没有密钥或者没有加密的数据库传入密钥时返回ErrorEncryptionMismatch
+// 没有校验和的页(全0的页)不解密; 解密失败视为损坏的页(与校验和不一致相同)
+// 保留字节与页大小一样记录在每个数据库的Geometry中(见pageSize.go), 同一进程中可以同时打开加密以及没有加密的数据库
+// 只加密数据文件中的页, redo log, undo log以及其他文件不加密
+
+const (
+	CipherNone       int32 = 0
+	CipherAesGcm     int32 = 1 // 之前的版本, 密钥校验值为全0块的密文
+	CipherAesGcmHmac int32 = 2
+	KeyCheckLabel          = "mydb-page-key-check"
+	SzPageTag        int64 = 16
+	SzPageNonce      int64 = 12
+	SzPageCipher           = SzPageTag + SzPageNonce
+	EncryptionOffset       = PageSizeOffset + SzPageSizeRecord
+	SzCipherMode     int64 = 4
+	SzKeyCheck       int64 = 8
+	DbIdentityOffset       = ChecksumFormatOffset + SzChecksumFormat
+	SzDbIdentity     int64 = 8
+)
+
+// KeyProvider 页加密的密钥来源(密钥文件, KMS等), 打开数据库时调用一次
+type KeyProvider interface {
+	PageKey() ([]byte, error) // 16, 24或者32字节的AES密钥
+}
+
+// StaticKey 固定的密钥
+type StaticKey []byte
+
+func (k StaticKey) PageKey() ([]byte, error) {
+	return k, nil
+}
+
+type ErrorEncryptionKey struct{}
+
+func (err *ErrorEncryptionKey) Error() string {
+	return "Encryption key doesn't match the database"
+}
+
+type ErrorEncryptionMismatch struct {
+	Encrypted bool // 数据库是否加密
+}
+
+func (err *ErrorEncryptionMismatch) Error() string {
+	if err.Encrypted {
+		return "Database is encrypted, a key provider is required"
+	}
+	return "Database isn't encrypted, it can't be opened with a key provider"
+}
+
+type ErrorEncryptedAttach struct{}
+
+func (err *ErrorEncryptedAttach) Error() string {
+	return "Encrypted database can't attach table space files, pages are bound to their table space"
+}
+
+type ErrorPageDecrypt struct {
+	File   string
+	PageId int64
+}
+
+func (err *ErrorPageDecrypt) Error() string {
+	return fmt.Sprintf("Page %d in %s is corrupt, decryption fails", err.PageId, err.File)
+}
+
+func (err *ErrorPageDecrypt) Is(target error) bool {
+	return target == dbError.ErrCorruptPage
+}
+
+// WithEncryption 创建数据库时开启页加密, 打开已经加密的数据库时必须传入相同的密钥
+func WithEncryption(keys KeyProvider) Option {
+	return func(dm *DmImpl) {
+		dm.keys = keys
+	}
+}
+
+type pageCipher struct {
+	aead     cipher.AEAD
+	block    cipher.Block
+	check    []byte // 密钥校验值
+	identity []byte // 数据库标识, 之前的版本创建的数据库为nil
+}
+
+func newPageCipher(keys KeyProvider, identity []byte) (*pageCipher, error) {
+	key, err := keys.PageKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 密钥校验值: 与加密无关的HMAC派生
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(KeyCheckLabel))
+	return &pageCipher{aead: aead, block: block, check: mac.Sum(nil)[:SzKeyCheck], identity: identity}, nil
+}
+
+// legacyCheck 之前的版本(CipherAesGcm)的密钥校验值: 全0块的密文, 只用于打开旧的数据库
+func (c *pageCipher) legacyCheck() []byte {
+	check := make([]byte, aes.BlockSize)
+	c.block.Encrypt(check, make([]byte, aes.BlockSize))
+	return check[:SzKeyCheck]
+}
+
+// covers 页是否加密
+func (c *pageCipher) covers(space, pageId int64) bool {
+	return c != nil && !(space == SystemSpace && pageId == PageNumberDbMeta)
+}
+
+// aad 附加数据: 页号以及校验和之后的页头(加密时尚未写入校验和, 解密时已经清除), 之后为表空间id以及数据库标识
+func (c *pageCipher) aad(space, pageId int64, page []byte) []byte {
+	aad := make([]byte, 8, 16+InitOffset+SzDbIdentity)
+	binary.BigEndian.PutUint64(aad, uint64(pageId))
+	aad = append(aad, page[SzPageChecksum:InitOffset]...)
+	if c.identity == nil {
+		return aad
+	}
+	aad = binary.BigEndian.AppendUint64(aad, uint64(space))
+	return append(aad, c.identity...)
+}
+
+// seal 加密页的拷贝, limit为页的内容的上限, 之后依次为Tag以及Nonce
+func (c *pageCipher) seal(space, pageId int64, data []byte, limit int64) []byte {
+	page := make([]byte, len(data))
+	copy(page, data[:limit])
+	nonce := page[limit+SzPageTag : limit+SzPageCipher]
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("Error occurs when generating page nonce, err = %s", err))
+	}
+	c.aead.Seal(page[InitOffset:InitOffset], nonce, page[InitOffset:limit], c.aad(space, pageId, page))
+	return page
+}
+
+// open 原地解密从数据文件读入(已经清除校验和)的页, 保留字节清0
+func (c *pageCipher) open(file string, space, pageId int64, page []byte, limit int64) error {
+	nonce := make([]byte, SzPageNonce)
+	copy(nonce, page[limit+SzPageTag:limit+SzPageCipher])
+	if _, err := c.aead.Open(page[InitOffset:InitOffset], nonce, page[InitOffset:limit+SzPageTag], c.aad(space, pageId, page)); err != nil {
+		return &ErrorPageDecrypt{File: file, PageId: pageId}
+	}
+	for i := limit; i < int64(len(page)); i++ {
+		page[i] = 0
+	}
+	return nil
+}
+
+// encodePage 写回数据文件的内容: 加密(表空间加密时)并带校验和的拷贝
+func (t *pageTier) encodePage(pageId int64, data []byte) []byte {
+	var page []byte
+	if t.cipher.covers(t.space, pageId) {
+		page = t.cipher.seal(t.space, pageId, data, t.geo.PageLimit)
+	} else {
+		page = make([]byte, len(data))
+		copy(page, data)
+	}
+	t.geo.stamp(pageId, page)
+	return page
+}
+
+// decodePage 解密通过校验的页, stamped为读入时是否带校验和
+func (t *pageTier) decodePage(pageId int64, page []byte, stamped bool) error {
+	if !stamped || !t.cipher.covers(t.space, pageId) {
+		return nil
+	}
+	return t.cipher.open(t.primary.Name(), t.space, pageId, page, t.geo.PageLimit)
+}
+
+// storedEncryption 从数据文件读取记录的加密方式以及密钥校验值, 数据文件不存在或者为空时返回false
+func storedEncryption(path string) (int32, []byte, bool, error) {
+	file, err := os.Open(path + FileSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return CipherNone, nil, false, nil
+		}
+		return CipherNone, nil, false, err
+	}
+	defer file.Close()
+	buf := make([]byte, SzCipherMode+SzKeyCheck)
+	if n, _ := file.ReadAt(buf, EncryptionOffset); n < len(buf) {
+		return CipherNone, nil, false, nil
+	}
+	return int32(binary.BigEndian.Uint32(buf)), buf[SzCipherMode:], true, nil
+}
+
+// storedIdentity 从数据文件读取记录的数据库标识, 数据文件不存在或者为空时生成新的标识, 没有标识时返回nil
+func storedIdentity(path string) ([]byte, error) {
+	identity := make([]byte, SzDbIdentity)
+	file, err := os.Open(path + FileSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer file.Close()
+		if n, _ := file.ReadAt(identity, DbIdentityOffset); int64(n) == SzDbIdentity {
+			if zeroPage(identity) {
+				return nil, nil
+			}
+			return identity, nil
+		}
+	}
+	if _, err := rand.Read(identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// openCipher 打开数据库之前校验密钥并读取数据库标识, 必须在openGeometry之前调用
+func (dm *DmImpl) openCipher() error {
+	identity, err := storedIdentity(dm.path)
+	if err != nil {
+		return err
+	}
+	dm.identity = identity
+	mode, check, ext, err := storedEncryption(dm.path)
+	if err != nil {
+		return err
+	}
+	if !ext {
+		if dm.keys != nil {
+			dm.cipher, err = newPageCipher(dm.keys, identity)
+		}
+		return err
+	}
+	switch {
+	case mode == CipherNone && dm.keys != nil:
+		return &ErrorEncryptionMismatch{}
+	case mode != CipherNone && dm.keys == nil:
+		return &ErrorEncryptionMismatch{Encrypted: true}
+	case mode == CipherNone:
+		return nil
+	case mode != CipherAesGcm && mode != CipherAesGcmHmac:
+		return fmt.Errorf("unknown cipher %d in %s", mode, dm.path)
+	}
+	c, err := newPageCipher(dm.keys, identity)
+	if err != nil {
+		return err
+	}
+	expected := c.check
+	if mode == CipherAesGcm {
+		expected = c.legacyCheck()
+	}
+	if !bytes.Equal(expected, check) {
+		return &ErrorEncryptionKey{}
+	}
+	dm.cipher = c
+	return nil
+}
+
+// recordEncryption 在DbMeta页中记录加密方式以及密钥校验值, 随DbMeta页写回; 旧的校验值被覆盖
+func (dm *DmImpl) recordEncryption() {
+	if dm.cipher == nil {
+		return
+	}
+	buf := make([]byte, SzCipherMode+SzKeyCheck)
+	binary.BigEndian.PutUint32(buf, uint32(CipherAesGcmHmac))
+	copy(buf[SzCipherMode:], dm.cipher.check)
+	if err := dm.metaPage.Update(buf, EncryptionOffset); err != nil {
+		panic(fmt.Sprintf("Error occurs when recording encryption, err = %s", err))
+	}
+}
+
+// recordIdentity 在DbMeta页中记录数据库标识, 随DbMeta页写回
+func (dm *DmImpl) recordIdentity() {
+	if dm.identity == nil {
+		return
+	}
+	if err := dm.metaPage.Update(dm.identity, DbIdentityOffset); err != nil {
+		panic(fmt.Sprintf("Error occurs when recording database identity, err = %s", err))
+	}
+}
@@ -1,9 +1,12 @@
 package dataManager
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	. "myDB/dataStructure"
+	"myDB/dbError"
 	"sync"
 )
 
@@ -14,6 +17,8 @@ type PageCtl interface {
 	Select(need int64) *PageInfo
 	AddPageInfo(pageId, available int64)
 	Init(pc PageCache)
+	Verify(sample int) (checked, corrected int) // 校验空闲空间表与页头是否一致并修正
+	Reset(pageId, available int64)              // 删除pageId已有的记录之后重新添加(回收的页)
 }
 
 type PageInfo struct {
@@ -24,22 +29,23 @@ type PageInfo struct {
 const (
 	THRESHOLD     int64 = 128
 	TinyTHRESHOLD       = THRESHOLD / 4
-	INTERVALS           = PageSize / THRESHOLD //
-	OMITTED       int64 = 8                    // 剩余空间小于8的内存页都会被弃用
+	OMITTED       int64 = 8 // 剩余空间小于8的内存页都会被弃用
 )
 
 // PageCtlImpl
 // 将每个区间拆分成64个小区间
 type PageCtlImpl struct {
-	free     [INTERVALS]*LinkedList // [32,127], [127,255]... (链表)
-	locks    [INTERVALS]sync.Mutex
+	free     []*LinkedList // [32,127], [127,255]... (链表), 页大小/THRESHOLD个
+	locks    []sync.Mutex
 	tiny     *SkipList // 剩余空间<32Bytes且>=8的页(跳表)
 	tinyLock sync.Mutex
 	pc       PageCache
+	pageSize int64
 }
 
-func NewPageCtl(pc PageCache) PageCtl {
-	var pi [INTERVALS]*LinkedList
+func NewPageCtl(pc PageCache, pageSize int64) PageCtl {
+	intervals := pageSize / THRESHOLD
+	pi := make([]*LinkedList, intervals)
 	f := func(a any, b any) int {
 		x, y := a.(*PageInfo).Available, b.(*PageInfo).Available
 		if x == y {
@@ -50,10 +56,10 @@ func NewPageCtl(pc PageCache) PageCtl {
 			return 1
 		}
 	}
-	for i := int64(0); i < INTERVALS; i++ {
+	for i := int64(0); i < intervals; i++ {
 		pi[i] = NewLinkedList(f)
 	}
-	ctl := &PageCtlImpl{free: pi, tiny: NewSkipList(f), pc: pc}
+	ctl := &PageCtlImpl{free: pi, locks: make([]sync.Mutex, intervals), tiny: NewSkipList(f), pc: pc, pageSize: pageSize}
 	return ctl
 }
 
@@ -64,7 +70,7 @@ func (pi *PageCtlImpl) Select(need int64) *PageInfo {
 	if need <= 0 {
 		panic("Illegal page cache application operation\n")
 	}
-	if need > PageSize {
+	if need > pi.pageSize {
 		panic("Applying for overflowed page size\n")
 	}
 	var intervalNum int64
@@ -79,10 +85,11 @@ func (pi *PageCtlImpl) Select(need int64) *PageInfo {
 	} else {
 		intervalNum = need / THRESHOLD
 	}
-	if intervalNum != INTERVALS-1 {
+	intervals := int64(len(pi.free))
+	if intervalNum != intervals-1 {
 		intervalNum += 1
 	}
-	for ; intervalNum < INTERVALS; intervalNum += 1 {
+	for ; intervalNum < intervals; intervalNum += 1 {
 		if result := pi.selectAndRemove(need, intervalNum); result != nil {
 			return result
 		}
@@ -132,14 +139,17 @@ func (pi *PageCtlImpl) AddPageInfo(pageId int64, available int64) {
 }
 
 // Init 初始化PageCtlImpl
-// 将所有页都读入buffer, 并更新free spaces
+// 将所有页都读入buffer, 并更新free spaces, 跳过校验和不一致的页
 func (pi *PageCtlImpl) Init(pc PageCache) {
 	pn := pc.GetPageNumbers()
 	for i := int64(1); i <= pn; i++ {
 		if i == PageNumberDbMeta {
 			continue
 		}
-		if p, err := pc.GetPage(i); err != nil {
+		if p, err := pc.GetPage(i); errors.Is(err, dbError.ErrCorruptPage) {
+			// 校验失败的页不用于插入, 读取其中的数据时返回错误
+			log.Printf("[DataManager] Skip corrupt page, %s\n", err)
+		} else if err != nil {
 			panic(fmt.Sprintf("Error occurs when getting pages, err = %s\n", err))
 		} else {
 			if p.IsDataPage() {
@@ -152,3 +162,73 @@ func (pi *PageCtlImpl) Init(pc PageCache) {
 	}
 	log.Printf("[DataManager] Initialize page control\n")
 }
+
+// Reset
+// 删除free中pageId的记录之后以available重新添加, 避免同一个页出现多条记录
+// tiny中的记录无法按页号删除, 保留; 被选中时页中的空间大于记录的空间, 不影响插入
+func (pi *PageCtlImpl) Reset(pageId, available int64) {
+	for i := range pi.free {
+		pi.locks[i].Lock()
+		entries := make([]*PageInfo, 0)
+		for v := pi.free[i].RemoveFirst(); v != nil; v = pi.free[i].RemoveFirst() {
+			if info := v.(*PageInfo); info.PageId != pageId {
+				entries = append(entries, info)
+			}
+		}
+		for _, info := range entries {
+			pi.free[i].AddLast(info)
+		}
+		pi.locks[i].Unlock()
+	}
+	pi.AddPageInfo(pageId, available)
+}
+
+// Verify
+// 将空闲空间表中记录的可用空间与页头(Used)比较, 修正不一致的记录, 页已经不是数据页时删除记录
+// sample <= 0 时检查所有记录, 否则随机抽样sample条记录
+// tiny中的页剩余空间不足TinyTHRESHOLD, 不参与校验
+// 校验期间被取出的记录暂时不能被Select选中, Insert会改为申请新页
+func (pi *PageCtlImpl) Verify(sample int) (checked, corrected int) {
+	entries := make([]*PageInfo, 0)
+	for i := range pi.free {
+		pi.locks[i].Lock()
+		for v := pi.free[i].RemoveFirst(); v != nil; v = pi.free[i].RemoveFirst() {
+			entries = append(entries, v.(*PageInfo))
+		}
+		pi.locks[i].Unlock()
+	}
+	check := make([]bool, len(entries))
+	if sample <= 0 || sample >= len(entries) {
+		for j := range check {
+			check[j] = true
+		}
+	} else {
+		for _, j := range rand.Perm(len(entries))[:sample] {
+			check[j] = true
+		}
+	}
+	for j, info := range entries {
+		if check[j] {
+			checked += 1
+			p, err := pi.pc.GetPage(info.PageId)
+			if err != nil {
+				panic(fmt.Sprintf("Error occurs when getting pages, err = %s\n", err))
+			}
+			available, isData := p.GetFree(), p.IsDataPage()
+			if err = pi.pc.ReleasePage(p); err != nil {
+				panic(fmt.Sprintf("Error occurs when releasing pages, err = %s\n", err))
+			}
+			if !isData {
+				corrected += 1
+				continue
+			}
+			if available != info.Available {
+				log.Printf("[DataManager] Free space of page %d drifts, recorded %d, actual %d\n", info.PageId, info.Available, available)
+				corrected += 1
+				info.Available = available
+			}
+		}
+		pi.AddPageInfo(info.PageId, info.Available)
+	}
+	return
+}
@@ -0,0 +1,117 @@
+package dataManager
+
+import (
+	"sort"
+	"sync"
+)
+
+// 页事件统计
+// 记录每个表空间的页分配, 插入, 溢出以及分裂次数, 用于找出插入热点(选择更合适的填充因子)
+// 溢出: 变长的Update在页中的连续空闲空间不足(整理页之后可能仍然在页内移动, 见reorganize.go)
+// 分裂: 溢出之后记录迁移到其他页(旧的uid留下转发桩, 见forward.go), 堆表没有B+树, 记录的迁移相当于页分裂
+// 每个表空间最多记录MaxTrackedPages个页的计数, 超过时淘汰事件最少的页; 统计只保存在内存中
+
+const MaxTrackedPages = 1024
+
+type PageEvents struct {
+	PageId    int64
+	Inserts   int64
+	Overflows int64
+	Splits    int64
+}
+
+func (p *PageEvents) total() int64 {
+	return p.Inserts + p.Overflows + p.Splits
+}
+
+// SpaceEvents 表空间的事件统计, Hot为事件最多的页(降序)
+type SpaceEvents struct {
+	Space       int64
+	Allocations int64
+	Inserts     int64
+	Overflows   int64
+	Splits      int64
+	Hot         []PageEvents
+}
+
+type spaceEvents struct {
+	lock   sync.Mutex
+	totals SpaceEvents
+	pages  map[int64]*PageEvents
+}
+
+func newSpaceEvents(space int64) *spaceEvents {
+	return &spaceEvents{totals: SpaceEvents{Space: space}, pages: map[int64]*PageEvents{}}
+}
+
+// page 持有锁
+func (e *spaceEvents) page(pageId int64) *PageEvents {
+	p := e.pages[pageId]
+	if p == nil {
+		if len(e.pages) >= MaxTrackedPages {
+			var coldest *PageEvents
+			for _, candidate := range e.pages {
+				if coldest == nil || candidate.total() < coldest.total() {
+					coldest = candidate
+				}
+			}
+			delete(e.pages, coldest.PageId)
+		}
+		p = &PageEvents{PageId: pageId}
+		e.pages[pageId] = p
+	}
+	return p
+}
+
+func (e *spaceEvents) allocate() {
+	e.lock.Lock()
+	e.totals.Allocations += 1
+	e.lock.Unlock()
+}
+
+func (e *spaceEvents) insert(pageId int64) {
+	e.lock.Lock()
+	e.totals.Inserts += 1
+	e.page(pageId).Inserts += 1
+	e.lock.Unlock()
+}
+
+func (e *spaceEvents) overflow(pageId int64) {
+	e.lock.Lock()
+	e.totals.Overflows += 1
+	e.page(pageId).Overflows += 1
+	e.lock.Unlock()
+}
+
+func (e *spaceEvents) split(pageId int64) {
+	e.lock.Lock()
+	e.totals.Splits += 1
+	e.page(pageId).Splits += 1
+	e.lock.Unlock()
+}
+
+// PageEvents 表空间的事件统计以及事件最多的top个页
+func (dm *DmImpl) PageEvents(space int64, top int) (SpaceEvents, error) {
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext {
+		return SpaceEvents{}, &ErrorSpaceNotExist{}
+	}
+	e := ts.events
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	ret := e.totals
+	ret.Hot = make([]PageEvents, 0, len(e.pages))
+	for _, p := range e.pages {
+		ret.Hot = append(ret.Hot, *p)
+	}
+	sort.Slice(ret.Hot, func(i, j int) bool {
+		a, b := ret.Hot[i], ret.Hot[j]
+		return a.total() > b.total() || a.total() == b.total() && a.PageId < b.PageId
+	})
+	if len(ret.Hot) > top {
+		ret.Hot = ret.Hot[:top]
+	}
+	return ret, nil
+}
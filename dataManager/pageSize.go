@@ -0,0 +1,138 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// 页大小
+// 创建数据库时可以选择4K/8K/16K/32K的页(WithPageSize), 大页适合宽行, 小页减少写放大; 默认8K
+// 页大小记录在系统表空间1号页(DbMeta)的页头之后([Used]4[PageType]4[PageSize]4), 0表示旧版本创建的8K数据库
+// 打开已有的数据库时从数据文件读取页大小, WithPageSize与记录的页大小不一致时Open返回ErrorPageSizeMismatch
+// 页大小以及由它决定的常量(MaxItemSize, FsmPageSlots等)记录在每个数据库的Geometry中, 同一进程中可以同时打开不同页大小的数据库
+
+const (
+	DefaultPageSize  int64 = 8192 // 8K bytes
+	MinPageSize      int64 = 4096
+	MaxPageSize      int64 = 32768 // 页内偏移以及剩余空间保存为16位
+	PageSizeOffset         = InitOffset
+	SzPageSizeRecord int64 = 4
+)
+
+type ErrorInvalidPageSize struct{}
+
+func (err *ErrorInvalidPageSize) Error() string {
+	return "Page size must be 4K, 8K, 16K or 32K"
+}
+
+type ErrorPageSizeMismatch struct {
+	Stored     int64
+	Configured int64
+}
+
+func (err *ErrorPageSizeMismatch) Error() string {
+	return fmt.Sprintf("Page size mismatch, database uses %d bytes pages, configured %d", err.Stored, err.Configured)
+}
+
+// Geometry 由页大小, 页校验和的格式以及页末尾的保留字节(见pageChecksum.go, pageCipher.go)决定的常量
+// 打开数据库时决定, 每个数据库(DmImpl)一份, 由它的表空间, 页缓存以及页共享, 之后不再改变
+type Geometry struct {
+	PageSize      int64
+	PageLimit     int64 // 页的内容不超过PageLimit, 之后为页加密以及页校验和的保留字节
+	Checksum      int32 // 页校验和的格式
+	MaxItemSize   int64 // 一个DataItem的最大长度, 见slottedPage.go
+	FsmPageSlots  int64 // 每个FSM页记录的页数, 见freeSpaceMap.go
+	DiskReserve   int64 // 磁盘的保留空间, 见quota.go
+	overflowChunk int64 // 一个溢出段中的数据长度, 见overflow.go
+}
+
+// defaultGeometry 没有加密以及保留字节的8K页, 用于不属于任何数据库的页缓存以及数据源
+var defaultGeometry = newGeometry(DefaultPageSize, ChecksumFolded, false)
+
+func newGeometry(size int64, checksum int32, encrypted bool) *Geometry {
+	g := &Geometry{PageSize: size, PageLimit: size, Checksum: checksum}
+	if checksum == ChecksumCrc32 {
+		g.PageLimit -= SzPageTrailer
+	}
+	if encrypted {
+		g.PageLimit -= SzPageCipher
+	}
+	g.MaxItemSize = g.PageLimit - SzSlottedHead - SzSlot
+	g.FsmPageSlots = (g.PageLimit - InitOffset - SzFsmNext) / SzFsmEntry
+	g.DiskReserve = 256 * size
+	g.overflowChunk = g.MaxItemSize - SzDIValid - SzDIDataSize - SzDIChecksum - SzOverflowNext
+	return g
+}
+
+// WithPageSize 创建数据库时使用的页大小, 已有的数据库必须与记录的页大小一致
+func WithPageSize(size int64) Option {
+	return func(dm *DmImpl) {
+		dm.pageSize = size
+	}
+}
+
+func validPageSize(size int64) bool {
+	return size >= MinPageSize && size <= MaxPageSize && size&(size-1) == 0
+}
+
+// storedPageSize 从数据文件读取记录的页大小, 数据文件不存在或者为空时返回false
+func storedPageSize(path string) (int64, bool, error) {
+	file, err := os.Open(path + FileSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	defer file.Close()
+	buf := make([]byte, SzPageSizeRecord)
+	if n, _ := file.ReadAt(buf, PageSizeOffset); int64(n) < SzPageSizeRecord {
+		return 0, false, nil
+	}
+	if size := int64(binary.BigEndian.Uint32(buf)); size != 0 {
+		return size, true, nil
+	}
+	return DefaultPageSize, true, nil
+}
+
+// openGeometry 打开数据库之前决定数据库的页大小, 必须在openCipher之后调用
+func (dm *DmImpl) openGeometry() error {
+	size := dm.pageSize
+	if size != 0 && !validPageSize(size) {
+		return &ErrorInvalidPageSize{}
+	}
+	stored, ext, err := storedPageSize(dm.path)
+	if err != nil {
+		return err
+	} else if ext && size != 0 && size != stored {
+		return &ErrorPageSizeMismatch{Stored: stored, Configured: size}
+	} else if ext {
+		size = stored
+	} else if size == 0 {
+		size = DefaultPageSize
+	}
+	if !validPageSize(size) {
+		return &ErrorInvalidPageSize{}
+	}
+	checksum, err := storedChecksum(dm.path)
+	if err != nil {
+		return err
+	}
+	dm.pageSize, dm.geo = size, newGeometry(size, checksum, dm.cipher != nil)
+	return nil
+}
+
+// recordPageSize 在DbMeta页中记录页大小, 随DbMeta页写回
+func (dm *DmImpl) recordPageSize() {
+	buf := make([]byte, SzPageSizeRecord)
+	binary.BigEndian.PutUint32(buf, uint32(dm.geo.PageSize))
+	if err := dm.metaPage.Update(buf, PageSizeOffset); err != nil {
+		panic(fmt.Sprintf("Error occurs when recording page size, err = %s", err))
+	}
+}
+
+// Geometry 数据库的页大小以及由它决定的常量
+func (dm *DmImpl) Geometry() Geometry {
+	return *dm.geo
+}
@@ -0,0 +1,98 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// 清理(purge)
+// 删除或者迁移之后失效的DataItem(以及转发桩)仍然占用页中的空间, 上层确认没有事物还能访问它们之后调用Purge回收
+// 只处理槽式数据页: 被清理的槽位置为0(槽位号不复用, uid不变), 其余DataItem紧凑地移动到页尾, 之前页内移动留下的旧数据一并回收
+// 整理在页的副本上进行, 完成后替换页的数据(Page.SetData, 原子地替换数据的指针): 正在零拷贝读的读者继续引用旧的数据, 不受影响
+// 调用方保证期间没有其他写入者原地修改该页上的DataItem(持有表锁), 页的整理记录为整页的REDOONLY日志
+
+const purgedSlot int64 = 0 // 已经清理的槽位
+
+// Purge
+// 清理uids中已经失效的DataItem, 返回清理的个数; 有效的DataItem, 旧格式的数据页以及已经清理的槽位被跳过
+func (dm *DmImpl) Purge(xid int64, uids []int64) int {
+	pages := make(map[[2]int64]map[int64]struct{})
+	for _, uid := range uids {
+		space, pageId, slot := SplitUid(uid)
+		key := [2]int64{space, pageId}
+		if pages[key] == nil {
+			pages[key] = make(map[int64]struct{})
+		}
+		pages[key][slot] = struct{}{}
+	}
+	keys := make([][2]int64, 0, len(pages))
+	for key := range pages {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
+	purged := 0
+	for _, key := range keys {
+		purged += dm.purgePage(xid, key[0], key[1], pages[key])
+	}
+	return purged
+}
+
+func (dm *DmImpl) purgePage(xid, space, pageId int64, slots map[int64]struct{}) int {
+	ts := dm.getSpace(space)
+	page, err := ts.pageCache.GetPage(pageId)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when getting pages, err = %s\n", err))
+	}
+	defer func() {
+		if err := ts.pageCache.ReleasePage(page); err != nil {
+			panic(fmt.Sprintf("Error occurs when releasing pages, err = %s\n", err))
+		}
+	}()
+	lock := dm.pageLocks.of(space, pageId)
+	lock.Lock()
+	defer lock.Unlock()
+	data := page.GetData()
+	if !isSlotted(data) {
+		return 0
+	}
+	compacted, purged := compactSlotted(data, slots, dm.geo.PageLimit)
+	if purged == 0 {
+		return 0
+	}
+	limit := dm.geo.PageLimit
+	dm.redo.RedoOnlyLog(getSpaceUid(space, pageId, 0), xid, data[:limit], compacted[:limit])
+	page.SetData(compacted)
+	page.SetDirty(true)
+	ts.pageCtl.Reset(pageId, page.GetFree())
+	return purged
+}
+
+// compactSlotted 清理slots中失效的DataItem并整理页, 返回新的页以及清理的个数, limit为页的内容末尾(PageLimit)
+func compactSlotted(data []byte, slots map[int64]struct{}, limit int64) ([]byte, int) {
+	n := slotsOf(data)
+	compacted := make([]byte, len(data))
+	copy(compacted, data[:slotPosition(n)])
+	lower, purged := limit, 0
+	for slot := int64(0); slot < n; slot++ {
+		position := slotPosition(slot)
+		offset := int64(binary.BigEndian.Uint16(data[position : position+SzSlot]))
+		if offset == purgedSlot {
+			continue
+		}
+		if _, ext := slots[slot]; ext && (data[offset] == DIInvalid || data[offset] == DIForward) {
+			copy(compacted[position:position+SzSlot], encodeSlot(purgedSlot))
+			purged += 1
+			continue
+		}
+		_, rawSize, _ := itemSize(data, offset)
+		lower -= rawSize
+		copy(compacted[lower:lower+rawSize], data[offset:offset+rawSize])
+		copy(compacted[position:position+SzSlot], encodeSlot(lower))
+	}
+	binary.BigEndian.PutUint32(compacted[:SzPgUsed], uint32(slotPosition(n)+limit-lower))
+	binary.BigEndian.PutUint16(compacted[InitOffset+SzSlots:SlotArrayStart], uint16(lower))
+	return compacted, purged
+}
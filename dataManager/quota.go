@@ -0,0 +1,55 @@
+package dataManager
+
+import (
+	"myDB/dbError"
+	"path/filepath"
+)
+
+// 数据库容量限制
+// maxSize 所有表空间数据文件大小之和的上限(字节), 0表示不限制
+// 数据库所在磁盘的剩余空间小于DiskReserve(256个页, 见pageSize.go)时，同样拒绝新的分配
+// 只有申请新页或者新的表空间文件时进行检查，读取、原地更新、删除以及回滚不受影响
+
+type ErrorDatabaseFull struct{}
+type ErrorDiskFull struct{}
+
+func (err *ErrorDatabaseFull) Error() string {
+	return "Database size exceeds the configured maximum size"
+}
+
+func (err *ErrorDiskFull) Error() string {
+	return "No space left on the disk"
+}
+
+func (err *ErrorDatabaseFull) Is(target error) bool {
+	return target == dbError.ErrDiskFull
+}
+
+func (err *ErrorDiskFull) Is(target error) bool {
+	return target == dbError.ErrDiskFull
+}
+
+// checkQuota
+// 检查是否可以再分配size字节
+// 调用方不能持有spaceLock
+func (dm *DmImpl) checkQuota(size int64) error {
+	if dm.maxSize > 0 && dm.size()+size > dm.maxSize {
+		return &ErrorDatabaseFull{}
+	}
+	// free < 0 表示无法获取磁盘剩余空间
+	if free := diskFree(filepath.Dir(dm.path)); free >= 0 && free-size < dm.geo.DiskReserve {
+		return &ErrorDiskFull{}
+	}
+	return nil
+}
+
+// size 所有表空间数据文件的大小
+func (dm *DmImpl) size() int64 {
+	dm.spaceLock.RLock()
+	defer dm.spaceLock.RUnlock()
+	var size int64 = 0
+	for _, ts := range dm.spaces {
+		size += ts.pageCache.GetPageNumbers() * dm.geo.PageSize
+	}
+	return size
+}
@@ -0,0 +1,100 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ReadGuard 零拷贝读
+// DataItem.GetData 每次读取都会深拷贝数据, ReadGuard返回的切片直接引用BufferPool中的页
+// 读过的页在Done之前一直被引用(pin), 不会被换出或复用, 因此返回的切片在Done之前有效
+// 同一个页只会pin一次, 扫描同一个页上的多条数据时不需要重复获取页
+// 返回的切片只读, 禁止修改; 调用Done之后禁止继续使用读出的切片
+// 数据原地更新的并发安全与DataItem相同, 由上层(VM)保证
+// 一个ReadGuard只能被一个goroutine使用
+type ReadGuard interface {
+	Read(uid int64) ([]byte, bool) // DataItem中的DATA段以及有效位
+	Done()                         // 释放所有引用的页
+}
+
+type pinnedPage struct {
+	space int64
+	page  Page
+}
+
+type readGuardImpl struct {
+	dm     *DmImpl
+	pinned map[int64]*pinnedPage // spaceUid(offset = 0) -> page
+	last   *pinnedPage           // 最近读过的页, 顺序扫描时避免查表
+	done   bool
+}
+
+// NewReadGuard 开始一次零拷贝读
+// DataManager关闭时会等待所有ReadGuard结束
+func (dm *DmImpl) NewReadGuard() ReadGuard {
+	dm.readers.Add(1)
+	return &readGuardImpl{dm: dm, pinned: map[int64]*pinnedPage{}}
+}
+
+// Read
+// 不校验有效位, 与ReadSnapShot相同, 沿转发桩读到最终的DataItem
+// 溢出头返回拼接之后的数据的拷贝, 压缩的数据返回解压之后的拷贝
+func (g *readGuardImpl) Read(uid int64) ([]byte, bool) {
+	if g.done {
+		panic("Error occurs when reading data item, read guard is done")
+	}
+	for {
+		data, offset := g.locate(uid)
+		if data[offset] != DIForward {
+			start := offset + SzDIValid + SzDIDataSize
+			size, rawSize, checked := itemSize(data, offset)
+			if checked {
+				verifyChecksum(data[offset:offset+rawSize], uid)
+			}
+			if isOverflow(data[offset:]) {
+				return g.dm.readOverflow(data[start : start+size]), data[offset] == DIValid
+			}
+			if codec := codecOf(data[offset:]); codec != CodecNone {
+				return decompress(codec, data[start:start+size], uid), data[offset] == DIValid
+			}
+			return data[start : start+size : start+size], data[offset] == DIValid
+		}
+		start := offset + SzDIValid + SzDIDataSize
+		uid = int64(binary.BigEndian.Uint64(data[start : start+SzForwardTo]))
+	}
+}
+
+// locate pin uid所在的页, 返回页的数据以及DataItem在页中的偏移
+func (g *readGuardImpl) locate(uid int64) ([]byte, int64) {
+	pageId, offset := uidTrans(uid)
+	space := spaceOf(uid)
+	pin := g.last
+	if pin == nil || pin.space != space || pin.page.GetId() != pageId {
+		key := getSpaceUid(space, pageId, 0)
+		if pin = g.pinned[key]; pin == nil {
+			page, err := g.dm.getSpace(space).pageCache.GetPage(pageId)
+			if err != nil {
+				panic(fmt.Sprintf("Error occurs when getting pages, err = %s", err))
+			}
+			pin = &pinnedPage{space: space, page: page}
+			g.pinned[key] = pin
+		}
+		g.last = pin
+	}
+	// RAW [valid]1[size]8[data]([checksum]4)
+	return pin.page.Locate(offset)
+}
+
+func (g *readGuardImpl) Done() {
+	if g.done {
+		return
+	}
+	g.done = true
+	for _, pin := range g.pinned {
+		if err := g.dm.getSpace(pin.space).pageCache.ReleasePage(pin.page); err != nil {
+			panic(err)
+		}
+	}
+	g.pinned, g.last = nil, nil
+	g.dm.readers.Done()
+}
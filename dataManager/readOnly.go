@@ -0,0 +1,113 @@
+package dataManager
+
+import (
+	"fmt"
+	"log"
+	"myDB/transactions"
+	"os"
+)
+
+// 只读模式
+// 用于在数据库运行时(或者数据库的拷贝上)检查数据, 例如备份以及调试工具, 不影响正在运行的数据库
+// 数据文件(以及冷文件)只读打开, 不存在时panic; 不打开redo log, 不做崩溃恢复, 不重置日志, 不写入元数据页的版本号以及元数据区
+// 数据库未正常关闭(包括正在运行)时读到的是数据文件中已经写回的页, 尚未写回的修改(只在日志中)不可见
+// Insert/Update等修改数据的接口返回ErrorReadOnly, Delete等没有返回值的修改panic(与其他错误相同), 记录redo log的操作同样panic
+// 不初始化空闲空间表, 不保存FSM以及写回的页, Close只释放页缓存
+
+type ErrorReadOnly struct{}
+
+func (err *ErrorReadOnly) Error() string {
+	return "Data manager is opened read-only"
+}
+
+// OpenDataManagerReadOnly 以只读模式打开path中的数据库, 加密的数据库需要WithEncryption
+func OpenDataManagerReadOnly(path string, memory int64, opts ...Option) DataManager {
+	if stat, err := os.Stat(path + FileSuffix); err != nil || stat.Size() < MinPageSize {
+		panic(fmt.Sprintf("Error occurs when opening data manager read-only, %s isn't a database", path))
+	}
+	dm := &DmImpl{
+		spaces:   map[int64]*TableSpace{},
+		path:     path,
+		memory:   memory,
+		redo:     readOnlyLog{},
+		dangling: danglingRefs{pending: map[int64]struct{}{}, forwarded: map[int64]int64{}},
+		changes:  loadChangeTracker(path),
+		readOnly: true,
+	}
+	for _, opt := range opts {
+		opt(dm)
+	}
+	if err := dm.openCipher(); err != nil {
+		panic(err)
+	}
+	if err := dm.openGeometry(); err != nil {
+		panic(err)
+	}
+	if err := dm.openSegmentSize(); err != nil {
+		panic(err)
+	}
+	dm.spaces[SystemSpace] = openTableSpace(path, SystemSpace, memory, nil, dm.changes, dm.cipher, dm.geo, &dm.files, true)
+	for _, space := range listTableSpaces(path) {
+		dm.spaces[space] = openTableSpace(path, space, memory, nil, dm.changes, dm.cipher, dm.geo, &dm.files, true)
+	}
+	system := dm.getSpace(SystemSpace)
+	metaPage, err := system.pageCache.GetPage(PageNumberDbMeta)
+	if err != nil {
+		panic(err)
+	}
+	dm.metaPage = metaPage
+	if !dm.metaPage.CheckInitVersion() {
+		log.Printf("[Data Manager] Database isn't closed normally, changes only in redo log are invisible\n")
+	}
+	dm.loadMeta()
+	dm.loadChecksumSpaces()
+	dm.loadFillFactors()
+	log.Printf("[Data Manager] Initialize read-only data manager\n")
+	return dm
+}
+
+// closeReadOnly 只读模式下的Close
+func (dm *DmImpl) closeReadOnly() {
+	dm.readers.Wait()
+	if err := dm.getSpace(SystemSpace).pageCache.ReleasePage(dm.metaPage); err != nil {
+		panic(fmt.Sprintf("Error occurs when releasing db meta page, err = %s", err))
+	}
+	dm.spaceLock.Lock()
+	defer dm.spaceLock.Unlock()
+	for _, ts := range dm.spaces {
+		ts.pageCache.Close()
+	}
+}
+
+// readOnlyLog 只读模式下的redo log, 记录日志时panic
+type readOnlyLog struct{}
+
+func (readOnlyLog) UpdateLog(uid, xid int64, oldRaw, raw []byte)   { panic(&ErrorReadOnly{}) }
+func (readOnlyLog) InsertLog(uid, xid int64, raw []byte)           { panic(&ErrorReadOnly{}) }
+func (readOnlyLog) RedoOnlyLog(uid, xid int64, oldRaw, raw []byte) { panic(&ErrorReadOnly{}) }
+func (readOnlyLog) log(data []byte)                                { panic(&ErrorReadOnly{}) }
+func (readOnlyLog) Close()                                         {}
+func (readOnlyLog) Next() []byte                                   { return nil }
+func (readOnlyLog) ResetLog()                                      { panic(&ErrorReadOnly{}) }
+func (readOnlyLog) CrashRecover(spaces SpaceResolver, tm transactions.TransactionManager) {
+	panic(&ErrorReadOnly{})
+}
+func (readOnlyLog) BatchInsertLog(uid, xid int64, oldItems, items, oldMeta, meta []byte) {
+	panic(&ErrorReadOnly{})
+}
+func (readOnlyLog) BeginBatch(xid int64)                    {}
+func (readOnlyLog) EndBatch(xid int64)                      {}
+func (readOnlyLog) Flush()                                  {}
+func (readOnlyLog) Sync() int64                             { return 0 }
+func (readOnlyLog) Checkpoint(lsn int64)                    { panic(&ErrorReadOnly{}) }
+func (readOnlyLog) Stats() LogStats                         { return LogStats{} }
+func (readOnlyLog) TakeBytes(xid int64) int64               { return 0 }
+func (readOnlyLog) ReportReplica(name string, lsn int64)    {}
+func (readOnlyLog) Check() error                            { return &ErrorReadOnly{} }
+func (readOnlyLog) PruneUndo(finished func(xid int64) bool) {}
+func (readOnlyLog) HasUndo(space, pageId int64, finished func(xid int64) bool) bool {
+	return false
+}
+func (readOnlyLog) Backup(copy func(file *os.File, lsn int64) error) error {
+	return &ErrorReadOnly{}
+}
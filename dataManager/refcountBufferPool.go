@@ -2,25 +2,28 @@ package dataManager
 
 import (
 	"sync"
-	"time"
 )
 
 // RefCountBufferPoolImpl 基于RefCount 实现BufferPool
 type RefCountBufferPoolImpl struct {
 	cache       map[int64]PoolObj
 	refCount    map[int64]uint32
-	caching     map[int64]struct{} // 正在进行IO请求的key
-	maxRecourse uint32             // bufferPool最大支持的缓存cacheId个数,来源于系统配置(默认16384)
-	count       uint32             // 目前内存中的cacheId个数
+	caching     map[int64]chan struct{} // 正在进行IO请求的key, IO完成时关闭通道
+	maxRecourse uint32                  // bufferPool最大支持的缓存cacheId个数,来源于系统配置(默认16384)
+	count       uint32                  // 目前内存中的cacheId个数
 	ds          DataSource
 	lock        *sync.Mutex // 与PageCache共用一把锁
+	hits        int64
+	misses      int64
+	flushes     int64
+	evictions   int64
 }
 
 func NewRefCountBufferPool(maxRecourse uint32, ds DataSource, lock *sync.Mutex) BufferPool {
 	return &RefCountBufferPoolImpl{
 		cache:       map[int64]PoolObj{},
 		refCount:    map[int64]uint32{},
-		caching:     map[int64]struct{}{},
+		caching:     map[int64]chan struct{}{},
 		maxRecourse: maxRecourse,
 		count:       0,
 		ds:          ds,
@@ -32,13 +35,17 @@ func (p *RefCountBufferPoolImpl) Get(obj PoolObj) (PoolObj, error) {
 	p.lock.Lock()
 	key := obj.GetId()
 	for true {
-		if _, ext := p.caching[key]; ext {
-			time.Sleep(10 * time.Millisecond)
+		if wait, ext := p.caching[key]; ext {
+			// 等待其他goroutine读取该页时释放锁, 否则读取完成之后无法放入缓存
+			p.lock.Unlock()
+			<-wait
+			p.lock.Lock()
 			continue
 		}
 		// already in cache
 		if obj, ext := p.cache[key]; ext {
 			p.refCount[key] += 1
+			p.hits += 1
 			p.lock.Unlock()
 			return obj, nil
 		} else {
@@ -51,7 +58,9 @@ func (p *RefCountBufferPoolImpl) Get(obj PoolObj) (PoolObj, error) {
 		panic("Buffer pool out of memory\n")
 	}
 	p.count += 1
-	p.caching[key] = struct{}{}
+	p.misses += 1
+	wait := make(chan struct{})
+	p.caching[key] = wait
 	p.lock.Unlock()
 	// get from datasource
 	data, err := p.ds.GetFromDataSource(obj)
@@ -59,12 +68,14 @@ func (p *RefCountBufferPoolImpl) Get(obj PoolObj) (PoolObj, error) {
 		p.lock.Lock()
 		p.count -= 1
 		delete(p.caching, key)
+		close(wait)
 		p.lock.Unlock()
 		return nil, err
 	}
 	// put to cache
 	p.lock.Lock()
 	delete(p.caching, key)
+	close(wait)
 	p.refCount[key] += 1
 	obj.SetData(data)
 	p.cache[key] = obj
@@ -73,6 +84,13 @@ func (p *RefCountBufferPoolImpl) Get(obj PoolObj) (PoolObj, error) {
 }
 
 func (p *RefCountBufferPoolImpl) Release(obj PoolObj) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.release(obj)
+}
+
+// release 调用者持有锁
+func (p *RefCountBufferPoolImpl) release(obj PoolObj) error {
 	key := obj.GetId()
 	count, ext := p.refCount[key]
 	if !ext {
@@ -84,10 +102,12 @@ func (p *RefCountBufferPoolImpl) Release(obj PoolObj) error {
 			if err := p.ds.FlushBackToDataSource(obj); err != nil {
 				return err
 			}
+			p.flushes += 1
 		}
 		delete(p.refCount, key)
 		delete(p.cache, key)
 		p.count -= 1
+		p.evictions += 1
 	} else {
 		p.refCount[key] = count
 	}
@@ -103,6 +123,7 @@ func (p *RefCountBufferPoolImpl) Close() error {
 			if err := p.ds.FlushBackToDataSource(obj); err != nil {
 				return err
 			}
+			p.flushes += 1
 		}
 		delete(p.cache, key)
 		delete(p.refCount, key)
@@ -111,6 +132,51 @@ func (p *RefCountBufferPoolImpl) Close() error {
 	return nil
 }
 
+// FlushAll
+// 先引用所有缓存的页, 防止写回期间被淘汰, 之后在锁外写回脏页
+// 写回之后页仍然是脏页, 淘汰时会再次写回
+func (p *RefCountBufferPoolImpl) FlushAll() error {
+	p.lock.Lock()
+	objs := make([]PoolObj, 0, len(p.cache))
+	for key, obj := range p.cache {
+		p.refCount[key] += 1
+		objs = append(objs, obj)
+	}
+	p.lock.Unlock()
+	var err error
+	for _, obj := range objs {
+		if err == nil && obj.IsDirty() {
+			if err = p.ds.FlushBackToDataSource(obj); err == nil {
+				p.lock.Lock()
+				p.flushes += 1
+				p.lock.Unlock()
+			}
+		}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, obj := range objs {
+		if e := p.release(obj); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (p *RefCountBufferPoolImpl) Stats() PoolStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return PoolStats{
+		Capacity: int64(p.maxRecourse),
+		Cached:   int64(p.count),
+		Hits:     p.hits,
+		Misses:   p.misses,
+		Flushes:  p.flushes,
+
+		Evictions: p.evictions,
+	}
+}
+
 // Debug only for debug
 func (p *RefCountBufferPoolImpl) Debug() {
 	/*log.Println("Ref count cache")
@@ -0,0 +1,83 @@
+package dataManager
+
+import (
+	"log"
+	"myDB/transactions"
+)
+
+// 页内整理(reorganize)
+// 变长的Update在页中的连续空闲空间不足时, 如果页中的碎片(页内移动以及清理之前留下的旧数据)足够, 先整理页再在页内移动, uid不变
+// 整理与purge相同(compactSlotted, 不清理任何槽位): 在副本上进行, 记录为整页的REDOONLY日志
+// 崩溃恢复按日志中的页内偏移撤销未完成的事物, 因此页上有未完成事物(包括当前事物)的可撤销日志时不能整理
+// redo log记录每个页上写过可撤销日志的事物, 整理时检查这些事物都已经结束(提交或回滚)
+// 写入DataItem的操作(Update, Delete, Recover)持有页锁, 整理期间没有写入者引用旧的页数据
+// 读者不持有页锁: 页的数据通过原子指针替换, 读者读到整理之前或者之后的完整的页, 已经读出的切片继续引用旧的数据
+
+// noteUndo 记录页上写过可撤销日志的事物, 持有redo的锁
+func (redo *RedoLog) noteUndo(data []byte) {
+	if isCheckpointLog(data) || getOperationType(data) == REDOONLY {
+		return
+	}
+	if redo.undoPages == nil {
+		redo.undoPages = make(map[int64]map[int64]struct{})
+	}
+	key := getPageId(data)
+	if redo.undoPages[key] == nil {
+		redo.undoPages[key] = make(map[int64]struct{})
+	}
+	redo.undoPages[key][getXid(data)] = struct{}{}
+}
+
+// HasUndo 页上是否有未结束的事物写过可撤销日志, 已经结束的事物被移除
+func (redo *RedoLog) HasUndo(space, pageId int64, finished func(xid int64) bool) bool {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	key := getPageKey(space, pageId)
+	for xid := range redo.undoPages[key] {
+		if !finished(xid) {
+			return true
+		}
+		delete(redo.undoPages[key], xid)
+	}
+	delete(redo.undoPages, key)
+	return false
+}
+
+// PruneUndo 移除已经结束的事物, checkpoint时调用
+func (redo *RedoLog) PruneUndo(finished func(xid int64) bool) {
+	redo.lock.Lock()
+	defer redo.lock.Unlock()
+	for key, xids := range redo.undoPages {
+		for xid := range xids {
+			if finished(xid) {
+				delete(xids, xid)
+			}
+		}
+		if len(xids) == 0 {
+			delete(redo.undoPages, key)
+		}
+	}
+}
+
+func (dm *DmImpl) finished(xid int64) bool {
+	return dm.transactionManager.Status(xid)&(1<<transactions.FINISH) != 0
+}
+
+// reorganize 整理槽式数据页使连续空闲空间至少为need, 返回是否整理, 调用方持有页锁并且更新空闲空间表
+func (dm *DmImpl) reorganize(xid, space int64, pg Page, need int64) bool {
+	data := pg.GetData()
+	if dm.redo.HasUndo(space, pg.GetId(), dm.finished) {
+		return false
+	}
+	compacted, _ := compactSlotted(data, nil, dm.geo.PageLimit)
+	if lowerOf(compacted)-slotPosition(slotsOf(compacted)) < need {
+		return false
+	}
+	// 页末尾的保留字节不属于页的内容, 不记录日志
+	limit := dm.geo.PageLimit
+	dm.redo.RedoOnlyLog(getSpaceUid(space, pg.GetId(), 0), xid, data[:limit], compacted[:limit])
+	pg.SetData(compacted)
+	pg.SetDirty(true)
+	log.Printf("[Data Manager] Reorganize page %d in table space %d, free %d -> %d\n", pg.GetId(), space, lowerOf(data)-slotPosition(slotsOf(data)), pg.GetFree())
+	return true
+}
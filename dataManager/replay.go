@@ -0,0 +1,173 @@
+package dataManager
+
+import (
+	"encoding/binary"
+)
+
+// ReplayLogBytes
+// 在内存中对一个redo log文件的内容执行崩溃恢复, 不依赖文件以及PageCache
+// 与CrashRecover相同: 去除未写完的tail并校验checkSum, 已完成的事物以及REDOONLY日志按日志顺序重做, 未完成的事物倒序撤销
+// 返回恢复后被修改过的页(pageKey -> pageSize字节的页数据, 初始内容全部为0)
+// 日志不完整或者不合法时返回ErrorMalformedLog而不是panic, 可用于fuzz
+
+type ErrorMalformedLog struct{}
+
+func (err *ErrorMalformedLog) Error() string {
+	return "Malformed redo log"
+}
+
+// RedoRecord 一条解析后的更新日志
+type RedoRecord struct {
+	Xid      int64
+	PageKey  int64 // [space]32[pageId]32
+	Offset   int64
+	OldRaw   []byte
+	NewRaw   []byte
+	RedoOnly bool // REDOONLY日志, 总是重做
+}
+
+func ReplayLogBytes(data []byte, pageSize int64, committed func(xid int64) bool) (map[int64][]byte, error) {
+	records, err := parseLogBytes(data, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	pages := make(map[int64][]byte)
+	apply := func(rc *RedoRecord, raw []byte) {
+		page, ext := pages[rc.PageKey]
+		if !ext {
+			page = make([]byte, pageSize)
+			pages[rc.PageKey] = page
+		}
+		copy(page[rc.Offset:], raw)
+	}
+	toUndo := make(map[int64][]*RedoRecord)
+	var undoOrder []int64
+	for _, rc := range records {
+		if rc.RedoOnly || committed(rc.Xid) {
+			apply(rc, rc.NewRaw)
+		} else {
+			if _, ext := toUndo[rc.Xid]; !ext {
+				undoOrder = append(undoOrder, rc.Xid)
+			}
+			toUndo[rc.Xid] = append(toUndo[rc.Xid], rc)
+		}
+	}
+	for _, xid := range undoOrder {
+		logs := toUndo[xid]
+		for i := len(logs) - 1; i >= 0; i-- {
+			apply(logs[i], logs[i].OldRaw)
+		}
+	}
+	return pages, nil
+}
+
+// ParseLogBytes 解析redo log文件的内容 [CheckSum]8 [Size]4[CheckSum]8[Data]...
+// 最后一条不完整的日志视为上次崩溃时未写完的tail, 与removeTail相同
+func ParseLogBytes(data []byte) ([]*RedoRecord, error) {
+	return parseLogBytes(data, MaxPageSize)
+}
+
+// parseLogBytes 修改的范围必须位于pageSize字节的页之内
+func parseLogBytes(data []byte, pageSize int64) ([]*RedoRecord, error) {
+	if int64(len(data)) < SzCheckSum {
+		return nil, &ErrorMalformedLog{}
+	}
+	checkSum := int64(binary.BigEndian.Uint64(data[:SzCheckSum]))
+	var checkedCheckSum int64 = 0
+	var records []*RedoRecord
+	offset := SzCheckSum
+	total := int64(len(data))
+	for offset+SzData+SzCheckSum <= total {
+		dataSize := int64(binary.BigEndian.Uint32(data[offset : offset+SzData]))
+		start := offset + SzData + SzCheckSum
+		if dataSize > total-start {
+			break
+		}
+		logData := data[start : start+dataSize]
+		if int64(binary.BigEndian.Uint64(data[offset+SzData:start])) != calcCheckSum(0, logData) {
+			return nil, &ErrorMalformedLog{}
+		}
+		checkedCheckSum = calcCheckSum(checkedCheckSum, logData)
+		offset = start + dataSize
+		if isCheckpointLog(logData) {
+			continue
+		}
+		rcs, err := parseRedoRecords(logData, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rcs...)
+	}
+	if checkedCheckSum != checkSum {
+		return nil, &ErrorMalformedLog{}
+	}
+	return records, nil
+}
+
+// parseRedoRecord 带边界检查的parseUpdateLog, 修改的范围必须位于pageSize字节的页之内
+func parseRedoRecord(data []byte, pageSize int64) (*RedoRecord, error) {
+	header := int64(SzOpt + SzXid + SzPageId + SzOffset + SzRawLength)
+	if int64(len(data)) < header || (getOperationType(data) != UPDATE && getOperationType(data) != REDOONLY) {
+		return nil, &ErrorMalformedLog{}
+	}
+	rest := int64(len(data)) - header
+	oldRawLength := int64(binary.BigEndian.Uint64(data[header-int64(SzRawLength) : header]))
+	if oldRawLength < 0 || oldRawLength > rest {
+		return nil, &ErrorMalformedLog{}
+	}
+	xid, pageKey, offset, _, oldRaw, newRaw := parseUpdateLog(data)
+	if offset < 0 || offset > pageSize || int64(len(oldRaw)) > pageSize-offset || int64(len(newRaw)) > pageSize-offset {
+		return nil, &ErrorMalformedLog{}
+	}
+	return &RedoRecord{Xid: xid, PageKey: pageKey, Offset: offset, OldRaw: oldRaw, NewRaw: newRaw,
+		RedoOnly: getOperationType(data) == REDOONLY}, nil
+}
+
+// parseRedoRecords 带边界检查地解析一条日志
+// 批量插入日志拆分为两条: DataItem(可撤销)以及从页开头的页头和槽位数组(RedoOnly), 重放结果与一条日志相同
+func parseRedoRecords(data []byte, pageSize int64) ([]*RedoRecord, error) {
+	if int64(len(data)) < int64(SzOpt) || getOperationType(data) != BATCHINSERT {
+		rc, err := parseRedoRecord(data, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		return []*RedoRecord{rc}, nil
+	}
+	header := int64(SzOpt + SzXid + SzPageId + SzOffset + 2*SzRawLength)
+	if int64(len(data)) < header {
+		return nil, &ErrorMalformedLog{}
+	}
+	itemsLength := int64(binary.BigEndian.Uint64(data[header-int64(2*SzRawLength) : header-int64(SzRawLength)]))
+	metaLength := int64(binary.BigEndian.Uint64(data[header-int64(SzRawLength) : header]))
+	rest := int64(len(data)) - header
+	if itemsLength < 0 || metaLength < 0 || itemsLength > rest/2 || metaLength > rest/2 || 2*(itemsLength+metaLength) != rest {
+		return nil, &ErrorMalformedLog{}
+	}
+	xid, pageKey, offset, oldItems, items, oldMeta, meta := parseBatchInsertLog(data)
+	if offset < 0 || offset > pageSize || itemsLength > pageSize-offset || metaLength > pageSize {
+		return nil, &ErrorMalformedLog{}
+	}
+	return []*RedoRecord{
+		{Xid: xid, PageKey: pageKey, Offset: offset, OldRaw: oldItems, NewRaw: items},
+		{Xid: xid, PageKey: pageKey, Offset: 0, OldRaw: oldMeta, NewRaw: meta, RedoOnly: true},
+	}, nil
+}
+
+// EncodeLogBytes 将records编码为一个redo log文件的内容, 用于生成fuzz语料
+func EncodeLogBytes(records []*RedoRecord) []byte {
+	var checkSum int64 = 0
+	body := make([]byte, 0)
+	for _, rc := range records {
+		opt := UPDATE
+		if rc.RedoOnly {
+			opt = REDOONLY
+		}
+		data := wrapLog(opt, rc.Xid, rc.PageKey, rc.Offset, rc.OldRaw, rc.NewRaw)
+		checkSum = calcCheckSum(checkSum, data)
+		body = append(body, wrapLogHeader(data)...)
+		body = append(body, data...)
+	}
+	header := make([]byte, SzCheckSum)
+	binary.BigEndian.PutUint64(header, uint64(checkSum))
+	return append(header, body...)
+}
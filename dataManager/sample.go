@@ -0,0 +1,101 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// 块采样
+// SamplePages从表空间中随机选择约percent%的页(至少一个, 按页号顺序读取), 返回选中的页上有效的DataItem的uid
+// 上层(ANALYZE)只读取选中的页, 用其中的行外推整个表的统计信息
+// 不包括失效的DataItem, 转发桩(迁移之后的行在新的位置被采样)以及溢出段(DIChunk, 溢出头代表整条数据)
+// 旧版本写入的溢出段没有标记, 可能被选中, 由上层按数据格式排除
+// 读取每个页时持有页锁, 但是不阻止之后的修改, 结果只用于统计
+
+type ErrorInvalidSample struct{}
+
+func (err *ErrorInvalidSample) Error() string {
+	return "Sample percent must be in 1..100"
+}
+
+type PageSample struct {
+	Pages   int64 // 表空间中的数据页数(不包括元数据页)
+	Sampled int64 // 选中的页数
+	Uids    []int64
+}
+
+// SamplePages seed相同时选中相同的页
+func (dm *DmImpl) SamplePages(space int64, percent int, seed int64) (PageSample, error) {
+	if percent < 1 || percent > 100 {
+		return PageSample{}, &ErrorInvalidSample{}
+	}
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext {
+		return PageSample{}, &ErrorSpaceNotExist{}
+	}
+	pageIds := make([]int64, 0)
+	for pageId := int64(1); pageId <= ts.pageCache.GetPageNumbers(); pageId++ {
+		if pageId != PageNumberDbMeta {
+			pageIds = append(pageIds, pageId)
+		}
+	}
+	sample := PageSample{Pages: int64(len(pageIds)), Uids: make([]int64, 0)}
+	if len(pageIds) == 0 {
+		return sample, nil
+	}
+	n := (len(pageIds)*percent + 99) / 100
+	chosen := make([]int64, 0, n)
+	for _, i := range rand.New(rand.NewSource(seed)).Perm(len(pageIds))[:n] {
+		chosen = append(chosen, pageIds[i])
+	}
+	sort.Slice(chosen, func(i, j int) bool { return chosen[i] < chosen[j] })
+	for _, pageId := range chosen {
+		page, err := ts.pageCache.GetPage(pageId)
+		if err != nil {
+			return PageSample{}, err
+		}
+		lock := dm.pageLocks.of(space, pageId)
+		lock.Lock()
+		for _, offset := range sampledItems(page.GetData()) {
+			sample.Uids = append(sample.Uids, getSpaceUid(space, pageId, offset))
+		}
+		lock.Unlock()
+		if err = ts.pageCache.ReleasePage(page); err != nil {
+			panic(fmt.Sprintf("Error occurs when releasing pages, err = %s\n", err))
+		}
+		sample.Sampled++
+	}
+	return sample, nil
+}
+
+// sampledItems 页中有效的DataItem在uid中的offset(槽位号或旧格式的偏移)
+func sampledItems(data []byte) []int64 {
+	offsets := make([]int64, 0)
+	sampled := func(position int64) bool {
+		return data[position] == DIValid && !isChunk(data[position:])
+	}
+	if isSlotted(data) {
+		for slot := int64(0); slot < slotsOf(data); slot++ {
+			if position := locate(data, slot); position != purgedSlot && sampled(position) {
+				offsets = append(offsets, slot)
+			}
+		}
+		return offsets
+	}
+	if PageType(binary.BigEndian.Uint32(data[SzPgUsed:InitOffset])) != DataPage {
+		return offsets
+	}
+	used := int64(binary.BigEndian.Uint32(data[:SzPgUsed]))
+	for position := InitOffset; position < used; {
+		if sampled(position) {
+			offsets = append(offsets, position)
+		}
+		_, rawSize, _ := itemSize(data, position)
+		position += rawSize
+	}
+	return offsets
+}
@@ -0,0 +1,185 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"myDB/dbError"
+	"sort"
+)
+
+// 页校验(scrub)
+// 读取数据文件中的页(不经过缓冲区, 即崩溃之后会被重新读入的内容), 检查页结构以及带校验和的DataItem:
+// 页头的Used在页内; 槽式数据页的槽位数组与Lower不重叠, 每个槽位指向Lower之后的完整DataItem;
+// 旧格式数据页从页头开始依次排列的DataItem恰好到Used结束; 有效位只能是DIInvalid, DIValid或DIForward
+// 元数据页只检查Used, 全0的页(分配之后尚未写回)跳过; 带校验和的页先检查校验和(见pageChecksum.go)
+// 定向校验(all为false)只读取上一次校验之后写回的页(见changedPages.go), 全量校验读取所有页
+// 损坏的页记录在结果中, 并且在下一次定向校验时再次检查; 读取单个页时持有页表的写锁, 期间该页所在表空间的页读写等待
+
+// CorruptPage 校验失败的页
+type CorruptPage struct {
+	Space  int64
+	PageId int64
+	Reason string
+}
+
+func (c *CorruptPage) Error() string {
+	return fmt.Sprintf("Page %d in table space %d is corrupt, %s", c.PageId, c.Space, c.Reason)
+}
+
+func (c *CorruptPage) Is(target error) bool {
+	return target == dbError.ErrCorruptPage
+}
+
+// ScrubStats 一次校验的结果
+type ScrubStats struct {
+	Pages   int64 // 读取的页数
+	Items   int64 // 检查的DataItem数
+	Corrupt []*CorruptPage
+}
+
+// Scrub 校验所有表空间中上一次校验之后写回的页, all为true时校验所有页
+func (dm *DmImpl) Scrub(all bool) (ScrubStats, error) {
+	dm.spaceLock.RLock()
+	spaces := make([]*TableSpace, 0, len(dm.spaces))
+	for _, ts := range dm.spaces {
+		spaces = append(spaces, ts)
+	}
+	dm.spaceLock.RUnlock()
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].id < spaces[j].id })
+	stats := ScrubStats{Corrupt: make([]*CorruptPage, 0)}
+	for _, ts := range spaces {
+		pages := dm.changes.takeScrub(ts.id)
+		if err := ts.tier.scrub(ts.id, pages, all, &stats); err != nil {
+			dm.changes.markScrub(ts.id, pages)
+			return stats, err
+		}
+	}
+	for _, c := range stats.Corrupt {
+		log.Printf("[Data Manager] Scrub found corrupt page %d in table space %d, %s\n", c.PageId, c.Space, c.Reason)
+		var again pageBitmap
+		again.set(c.PageId)
+		dm.changes.markScrub(c.Space, again)
+	}
+	log.Printf("[Data Manager] Scrub %d pages, %d data items, %d corrupt\n", stats.Pages, stats.Items, len(stats.Corrupt))
+	return stats, nil
+}
+
+// scrub 校验表空间数据文件中的页(all)或者pages中的页
+func (t *pageTier) scrub(space int64, pages pageBitmap, all bool, stats *ScrubStats) error {
+	t.lock.RLock()
+	size, err := t.primary.Size()
+	t.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	total := size / t.geo.PageSize
+	ids := pages.pages()
+	if all {
+		ids = make([]int64, 0, total)
+		for pageId := int64(1); pageId <= total; pageId++ {
+			ids = append(ids, pageId)
+		}
+	}
+	buf := make([]byte, t.geo.PageSize)
+	for _, pageId := range ids {
+		if pageId > total {
+			continue
+		}
+		offset := (pageId - 1) * t.geo.PageSize
+		t.lock.Lock()
+		_, err = t.fileAt(offset).ReadAt(buf, offset)
+		t.lock.Unlock()
+		if err != nil {
+			return err
+		}
+		items, reason := int64(0), ""
+		if stamped, err := t.geo.verifyPage(t.primary.Name(), pageId, buf); err != nil {
+			reason = "page checksum mismatch"
+		} else if err := t.decodePage(pageId, buf, stamped); err != nil {
+			reason = "page decryption fails"
+		} else {
+			items, reason = checkPage(buf, t.geo.PageLimit)
+		}
+		stats.Pages += 1
+		stats.Items += items
+		if reason != "" {
+			stats.Corrupt = append(stats.Corrupt, &CorruptPage{Space: space, PageId: pageId, Reason: reason})
+		}
+	}
+	return nil
+}
+
+// checkPage 检查一个页, 返回检查的DataItem数以及损坏的原因(没有损坏时为空), limit为页的内容末尾(PageLimit)
+func checkPage(data []byte, limit int64) (int64, string) {
+	used := int64(binary.BigEndian.Uint32(data[:SzPgUsed]))
+	pt := PageType(binary.BigEndian.Uint32(data[SzPgUsed:InitOffset]))
+	switch {
+	case used == 0 && pt == 0:
+		return 0, ""
+	case used < InitOffset || used > limit:
+		return 0, fmt.Sprintf("used %d out of page", used)
+	case pt&MetaPage != 0:
+		return 0, ""
+	case pt == SlottedPage:
+		return checkSlotted(data, used, limit)
+	case pt == DataPage:
+		var items int64
+		for position := InitOffset; position < used; items++ {
+			end, reason := checkItem(data, position, used)
+			if reason != "" {
+				return items, fmt.Sprintf("data item at %d: %s", position, reason)
+			}
+			position = end
+		}
+		return items, ""
+	default:
+		return 0, fmt.Sprintf("unknown page type %d", pt)
+	}
+}
+
+func checkSlotted(data []byte, used, limit int64) (int64, string) {
+	slots, lower := slotsOf(data), lowerOf(data)
+	if slotPosition(slots) > lower || lower > limit || used < slotPosition(slots) {
+		return 0, fmt.Sprintf("slots %d overlap lower %d", slots, lower)
+	}
+	var items int64
+	for slot := int64(0); slot < slots; slot++ {
+		position := slotPosition(slot)
+		offset := int64(binary.BigEndian.Uint16(data[position : position+SzSlot]))
+		if offset == purgedSlot {
+			continue
+		}
+		if offset < lower {
+			return items, fmt.Sprintf("slot %d points to %d before lower %d", slot, offset, lower)
+		}
+		if _, reason := checkItem(data, offset, limit); reason != "" {
+			return items, fmt.Sprintf("data item in slot %d: %s", slot, reason)
+		}
+		items++
+	}
+	return items, ""
+}
+
+// checkItem 检查position处到limit之前的DataItem, 返回DataItem的结束位置
+func checkItem(data []byte, position, limit int64) (int64, string) {
+	if position+SzDIValid+SzDIDataSize > limit {
+		return 0, "truncated header"
+	}
+	valid := data[position]
+	if valid != DIInvalid && valid != DIValid && valid != DIForward {
+		return 0, fmt.Sprintf("invalid flag %d", valid)
+	}
+	dataSize, rawSize, checked := itemSize(data, position)
+	if dataSize < 0 || dataSize > limit || position+rawSize > limit {
+		return 0, fmt.Sprintf("size %d out of page", dataSize)
+	}
+	if checked && valid != DIForward {
+		start, end := position+SzDIValid+SzDIDataSize, position+rawSize-SzDIChecksum
+		if crc32.ChecksumIEEE(data[start:end]) != binary.BigEndian.Uint32(data[end:]) {
+			return 0, "checksum mismatch"
+		}
+	}
+	return position + rawSize, ""
+}
@@ -0,0 +1,368 @@
+package dataManager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 分段数据文件
+// 表空间的数据文件可以按固定大小切分为多个段文件, 数据库的大小不再受单个文件(文件系统)大小的限制
+// 0号段为数据文件本身(<数据文件>), n号段为<数据文件>.seg<n>, 页的偏移(pageId-1)*PageSize在段内的偏移为offset % 段大小
+// 段大小在创建数据文件时决定(WithSegmentSize, 默认1GB), 记录在<数据文件>.segs中; 没有该文件的数据文件(旧版本创建或者挂载的表空间)不分段
+// 段大小为区大小(ExtentPages个页)的整数倍, 页以及区不会跨越段; 写入超过最后一个段时创建新的段, 中间的段扩展为完整大小(稀疏)
+// 导出以及备份时拼接为一个不分段的文件
+// 数据文件以及段按文件后端(见directIO.go)打开, 使用O_DIRECT时通过readFile/writeFile读写
+
+const (
+	SegmentSuffix      string = ".seg"
+	SegmentMetaSuffix  string = ".segs"
+	DefaultSegmentSize int64  = 1 << 30
+)
+
+type ErrorInvalidSegmentSize struct{}
+
+func (err *ErrorInvalidSegmentSize) Error() string {
+	return "Segment size must be a positive multiple of the extent size"
+}
+
+// WithSegmentSize 数据库新建的数据文件的段大小, 必须为区大小的整数倍, 否则Open返回ErrorInvalidSegmentSize
+func WithSegmentSize(size int64) Option {
+	return func(dm *DmImpl) {
+		dm.files.segmentSize = size
+	}
+}
+
+// openSegmentSize 打开数据库之前检查段大小, 必须在openGeometry之后调用
+func (dm *DmImpl) openSegmentSize() error {
+	if dm.files.segmentSize == 0 {
+		dm.files.segmentSize = DefaultSegmentSize
+	}
+	if size := dm.files.segmentSize; size < 0 || size%(ExtentPages*dm.geo.PageSize) != 0 {
+		return &ErrorInvalidSegmentSize{}
+	}
+	return nil
+}
+
+// pageFile 页所在的文件, 数据文件(segmentedFile)或者冷文件
+type pageFile interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// segmentMeta 段信息的持久化格式
+type segmentMeta struct {
+	Size int64
+}
+
+type segmentedFile struct {
+	name     string
+	size     int64 // 段大小, 0表示不分段
+	mode     int
+	direct   bool         // 使用O_DIRECT读写
+	dataSync bool         // 刷盘使用fdatasync
+	lock     sync.RWMutex // 保护files
+	files    []*os.File
+}
+
+// openSegmentedFile 按files中的文件后端打开(不存在并且不是只读时创建)数据文件name以及它的所有段, 新建的数据文件使用files中的段大小
+func openSegmentedFile(name string, pageSize int64, files *fileOptions, readOnly bool) (*segmentedFile, error) {
+	sf := &segmentedFile{name: name, mode: os.O_RDWR}
+	if readOnly {
+		sf.mode = os.O_RDONLY
+	}
+	sf.dataSync = files.backend.DataSync
+	first, direct, err := openDataFile(name, sf.mode, files.backend.Direct)
+	if errors.Is(err, os.ErrNotExist) && !readOnly {
+		// 新的数据文件, 先记录段大小
+		size := files.segmentSize
+		if size%(ExtentPages*pageSize) != 0 {
+			return nil, &ErrorInvalidSegmentSize{}
+		}
+		if err := writeJsonFile(name+SegmentMetaSuffix, &segmentMeta{Size: size}); err != nil {
+			return nil, err
+		}
+		sf.size = size
+		if first, direct, err = openDataFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, files.backend.Direct); err != nil {
+			return nil, err
+		}
+		sf.files, sf.direct = []*os.File{first}, direct
+		return sf, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sf.files, sf.direct = []*os.File{first}, direct
+	if raw, err := os.ReadFile(name + SegmentMetaSuffix); err == nil {
+		meta := &segmentMeta{}
+		if err := json.Unmarshal(raw, meta); err != nil {
+			_ = first.Close()
+			return nil, fmt.Errorf("invalid segment file %s, err = %s", name+SegmentMetaSuffix, err)
+		}
+		sf.size = meta.Size
+	} else if !errors.Is(err, os.ErrNotExist) {
+		_ = first.Close()
+		return nil, err
+	}
+	for n := 1; sf.size > 0; n++ {
+		f, err := sf.openSegment(n, sf.mode)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		} else if err != nil {
+			_ = sf.Close()
+			return nil, err
+		}
+		sf.files = append(sf.files, f)
+	}
+	return sf, nil
+}
+
+// openSegment 与0号段使用相同的读写方式打开n号段
+func (sf *segmentedFile) openSegment(n int, mode int) (*os.File, error) {
+	if sf.direct {
+		return os.OpenFile(segmentName(sf.name, n), mode|directFlag, 0666)
+	}
+	return os.OpenFile(segmentName(sf.name, n), mode, 0666)
+}
+
+func segmentName(name string, n int) string {
+	if n == 0 {
+		return name
+	}
+	return name + SegmentSuffix + strconv.Itoa(n)
+}
+
+// isSegmentFile 是否为数据文件的段或者段信息(不包括0号段)
+func isSegmentFile(file string) bool {
+	return strings.Contains(file, FileSuffix+SegmentSuffix)
+}
+
+// removeDataFile 删除数据文件以及它的段, 双写文件和压缩文件
+func removeDataFile(name string) error {
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	for n := 1; ; n++ {
+		if err := os.Remove(segmentName(name, n)); errors.Is(err, os.ErrNotExist) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	for _, suffix := range []string{SegmentMetaSuffix, DoubleWriteSuffix, ZipSuffix, ZipIndexSuffix} {
+		if err := os.Remove(name + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sf *segmentedFile) Name() string {
+	return sf.name
+}
+
+// locate offset所在的段以及段内偏移, 以及该段中从offset开始最多可以读写的字节数
+func (sf *segmentedFile) locate(offset int64, length int) (int, int64, int) {
+	if sf.size == 0 {
+		return 0, offset, length
+	}
+	n, rel := int(offset/sf.size), offset%sf.size
+	if remain := sf.size - rel; int64(length) > remain {
+		length = int(remain)
+	}
+	return n, rel, length
+}
+
+func (sf *segmentedFile) ReadAt(buf []byte, offset int64) (int, error) {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	read := 0
+	for read < len(buf) {
+		n, rel, length := sf.locate(offset+int64(read), len(buf)-read)
+		if n >= len(sf.files) {
+			return read, io.EOF
+		}
+		r, err := sf.readFile(sf.files[n], buf[read:read+length], rel)
+		read += r
+		if err != nil && (err != io.EOF || n == len(sf.files)-1) {
+			return read, err
+		}
+		if r < length {
+			// 中间的段扩展为完整大小, 不会读到末尾
+			return read, io.ErrUnexpectedEOF
+		}
+	}
+	return read, nil
+}
+
+func (sf *segmentedFile) WriteAt(buf []byte, offset int64) (int, error) {
+	written := 0
+	for written < len(buf) {
+		n, rel, length := sf.locate(offset+int64(written), len(buf)-written)
+		f, err := sf.segment(n)
+		if err != nil {
+			return written, err
+		}
+		w, err := sf.writeFile(f, buf[written:written+length], rel)
+		written += w
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (sf *segmentedFile) readFile(f *os.File, buf []byte, offset int64) (int, error) {
+	if sf.direct {
+		return directReadAt(f, buf, offset)
+	}
+	return f.ReadAt(buf, offset)
+}
+
+func (sf *segmentedFile) writeFile(f *os.File, buf []byte, offset int64) (int, error) {
+	if sf.direct {
+		return directWriteAt(f, buf, offset)
+	}
+	return f.WriteAt(buf, offset)
+}
+
+// segment 返回n号段, 不存在时创建n号段以及之前的段
+func (sf *segmentedFile) segment(n int) (*os.File, error) {
+	sf.lock.RLock()
+	if n < len(sf.files) {
+		f := sf.files[n]
+		sf.lock.RUnlock()
+		return f, nil
+	}
+	sf.lock.RUnlock()
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	for len(sf.files) <= n {
+		// 之后的段存在时, 之前的段为完整大小
+		if err := sf.files[len(sf.files)-1].Truncate(sf.size); err != nil {
+			return nil, err
+		}
+		f, err := sf.openSegment(len(sf.files), sf.mode|os.O_CREATE)
+		if err != nil {
+			return nil, err
+		}
+		sf.files = append(sf.files, f)
+	}
+	return sf.files[n], nil
+}
+
+// Size 数据文件(所有段)的大小
+func (sf *segmentedFile) Size() (int64, error) {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	last := len(sf.files) - 1
+	stat, err := sf.files[last].Stat()
+	if err != nil {
+		return 0, err
+	}
+	return int64(last)*sf.size + stat.Size(), nil
+}
+
+// Truncate 删除size之后的段并截断最后一个段
+func (sf *segmentedFile) Truncate(size int64) error {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	n, rel := 0, size
+	if sf.size > 0 && size > 0 {
+		n, rel = int((size-1)/sf.size), (size-1)%sf.size+1
+	}
+	for len(sf.files)-1 > n {
+		last := len(sf.files) - 1
+		if err := sf.files[last].Close(); err != nil {
+			return err
+		}
+		if err := os.Remove(segmentName(sf.name, last)); err != nil {
+			return err
+		}
+		sf.files = sf.files[:last]
+	}
+	for i := len(sf.files); i <= n; i++ {
+		if err := sf.files[i-1].Truncate(sf.size); err != nil {
+			return err
+		}
+		f, err := sf.openSegment(i, sf.mode|os.O_CREATE)
+		if err != nil {
+			return err
+		}
+		sf.files = append(sf.files, f)
+	}
+	return sf.files[n].Truncate(rel)
+}
+
+func (sf *segmentedFile) Sync() error {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	for _, f := range sf.files {
+		if err := syncDataFile(f, sf.dataSync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sf *segmentedFile) Close() error {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	var err error
+	for _, f := range sf.files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// punchHole 释放[offset, offset + size)占用的磁盘空间, 见hole_linux.go
+func (sf *segmentedFile) punchHole(offset, size int64) {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	for size > 0 {
+		n, rel, length := sf.locate(offset, int(size))
+		if n >= len(sf.files) {
+			return
+		}
+		punchHole(sf.files[n], rel, int64(length))
+		offset, size = offset+int64(length), size-int64(length)
+	}
+}
+
+// exportTo 将所有段拼接为一个不分段的文件dst
+func (sf *segmentedFile) exportTo(dst string) error {
+	size, err := sf.Size()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, ExtentPages*DefaultPageSize)
+	for offset := int64(0); offset < size && err == nil; offset += int64(len(buf)) {
+		chunk := buf
+		if remain := size - offset; remain < int64(len(chunk)) {
+			chunk = chunk[:remain]
+		}
+		if _, err = sf.ReadAt(chunk, offset); err == nil {
+			_, err = out.WriteAt(chunk, offset)
+		}
+	}
+	if err == nil {
+		err = out.Truncate(size)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
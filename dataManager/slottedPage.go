@@ -0,0 +1,160 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// 槽式数据页(SlottedPage)
+// [Used]4[PageType]4[Slots]2[Lower]2[Slot 0]2[Slot 1]2...(空闲空间)...[DataItem]...[DataItem]
+// 槽位数组从页头向后增长, DataItem从页尾向前增长, Lower为最前面一个DataItem的位置
+// 槽位中保存DataItem在页中的偏移, uid中的offset为槽位号, DataItem在页内移动时uid不变
+// Used = 页头 + 槽位数组 + DataItem占用的空间, 空闲空间为槽位数组与Lower之间的连续区域
+// 旧版本创建的数据页(DataPage)按原来的方式追加, uid中的offset为DataItem在页中的偏移
+// 插入以及页内移动持有页的写锁(Page.Update)原地修改页头和槽位数组, 读者通过Page.Locate持有读锁解析槽位
+//
+// 日志: DataItem以及移动时的槽位按普通的更新日志记录; 页头以及新分配的槽位只重做不撤销(REDOONLY),
+// 回滚插入时槽位仍然保留, 指向被置为无效的DataItem, 与旧格式中回滚插入之后空间不回收相同
+
+const (
+	SzSlots         int64 = 2
+	SzLower         int64 = 2
+	SzSlot          int64 = 2
+	SlotArrayStart        = InitOffset + SzSlots + SzLower // 第一个槽位的位置
+	SzSlottedHead         = SlotArrayStart                 // 页头(包括Used和PageType)
+	pageLockStripes int   = 64                             // 页锁的分段数
+)
+
+// pageLocks 同一个页上的插入以及移动DataItem(分配空间, 修改页头和槽位)互斥
+type pageLocks [pageLockStripes]sync.Mutex
+
+func (l *pageLocks) of(space, pageId int64) *sync.Mutex {
+	return &l[(space*31+pageId)%int64(pageLockStripes)]
+}
+
+func isSlotted(data []byte) bool {
+	return PageType(binary.BigEndian.Uint32(data[SzPgUsed:SzPgUsed+SzPageType])) == SlottedPage
+}
+
+// initSlottedPage 空的槽式数据页, DataItem从页的内容末尾limit(PageLimit)向前放置
+func initSlottedPage(data []byte, limit int64) {
+	binary.BigEndian.PutUint32(data[:SzPgUsed], uint32(SzSlottedHead))
+	binary.BigEndian.PutUint16(data[InitOffset:InitOffset+SzSlots], 0)
+	binary.BigEndian.PutUint16(data[InitOffset+SzSlots:SlotArrayStart], uint16(limit))
+}
+
+func slotsOf(data []byte) int64 {
+	return int64(binary.BigEndian.Uint16(data[InitOffset : InitOffset+SzSlots]))
+}
+
+func lowerOf(data []byte) int64 {
+	return int64(binary.BigEndian.Uint16(data[InitOffset+SzSlots : SlotArrayStart]))
+}
+
+func slotPosition(slot int64) int64 {
+	return SlotArrayStart + slot*SzSlot
+}
+
+// locate 返回uid中的offset(槽位号或旧格式的偏移)对应的DataItem在页中的偏移
+func locate(data []byte, offset int64) int64 {
+	if !isSlotted(data) {
+		return offset
+	}
+	if offset >= slotsOf(data) {
+		panic("Error occurs when locating data item, slot doesn't exist")
+	}
+	position := slotPosition(offset)
+	return int64(binary.BigEndian.Uint16(data[position : position+SzSlot]))
+}
+
+// slottedHead 分配size字节之后的页头, slots为分配之后的槽位数, limit为页的内容末尾(PageLimit)
+func slottedHead(data []byte, slots, size, limit int64) (head []byte, offset int64) {
+	offset = lowerOf(data) - size
+	head = make([]byte, SzSlottedHead)
+	copy(head[SzPgUsed:InitOffset], data[SzPgUsed:InitOffset])
+	binary.BigEndian.PutUint32(head[:SzPgUsed], uint32(SlotArrayStart+slots*SzSlot+limit-offset))
+	binary.BigEndian.PutUint16(head[InitOffset:InitOffset+SzSlots], uint16(slots))
+	binary.BigEndian.PutUint16(head[InitOffset+SzSlots:], uint16(offset))
+	return
+}
+
+// logUid 日志中记录DataItem在页中的实际位置
+func logUid(di DataItem) int64 {
+	space, pageId, _ := SplitUid(di.GetUid())
+	return getSpaceUid(space, pageId, di.GetOffset())
+}
+
+func encodeSlot(offset int64) []byte {
+	buf := make([]byte, SzSlot)
+	binary.BigEndian.PutUint16(buf, uint16(offset))
+	return buf
+}
+
+// insertSlotted
+// 在槽式数据页中分配一个新的槽位以及raw的空间, 调用方持有页锁并且已经确认空闲空间足够
+// 先写日志(DataItem, 槽位, 页头), 再修改页, 返回槽位号
+func (dm *DmImpl) insertSlotted(xid, space int64, pg Page, raw []byte) int64 {
+	data := pg.GetData()
+	slot := slotsOf(data)
+	head, offset := slottedHead(data, slot+1, int64(len(raw)), dm.geo.PageLimit)
+	oldRaw := make([]byte, len(raw))
+	copy(oldRaw, raw)
+	SetRawInvalid(oldRaw)
+	position := slotPosition(slot)
+	dm.redo.UpdateLog(getSpaceUid(space, pg.GetId(), offset), xid, oldRaw, raw)
+	dm.redo.RedoOnlyLog(getSpaceUid(space, pg.GetId(), position), xid, data[position:position+SzSlot], encodeSlot(offset))
+	dm.redo.RedoOnlyLog(getSpaceUid(space, pg.GetId(), 0), xid, data[:SzSlottedHead], head)
+	dm.writePage(pg, raw, offset)
+	dm.writePage(pg, encodeSlot(offset), position)
+	dm.writePage(pg, head, 0)
+	return slot
+}
+
+// relocate
+// 空闲空间不足时记录页溢出
+// DataItem位于槽式数据页并且页中的空闲空间足够(必要时先整理页, 见reorganize.go)时, 将其移动到页内新分配的空间并写入raw, 返回是否移动
+// 调用方持有页锁
+func (dm *DmImpl) relocate(xid int64, di DataItem, raw []byte) bool {
+	pg := di.GetPage()
+	space, _, slot := SplitUid(di.GetUid())
+	if !isSlotted(pg.GetData()) {
+		dm.getSpace(space).events.overflow(pg.GetId())
+		return false
+	}
+	reorganized := false
+	if pg.GetFree() < int64(len(raw)) {
+		dm.getSpace(space).events.overflow(pg.GetId())
+		if reorganized = dm.reorganize(xid, space, pg, int64(len(raw))); !reorganized {
+			return false
+		}
+	}
+	dm.moveSlotted(xid, space, pg, slot, raw)
+	if reorganized {
+		dm.getSpace(space).pageCtl.Reset(pg.GetId(), pg.GetFree())
+	}
+	return true
+}
+
+// moveSlotted
+// 将slot对应的DataItem移动到页中新分配的空间并写入raw, uid不变, 原来的DataItem保持不变
+// 调用方持有页锁并且已经确认空闲空间足够
+func (dm *DmImpl) moveSlotted(xid, space int64, pg Page, slot int64, raw []byte) {
+	data := pg.GetData()
+	head, offset := slottedHead(data, slotsOf(data), int64(len(raw)), dm.geo.PageLimit)
+	position := slotPosition(slot)
+	oldRaw := make([]byte, len(raw))
+	copy(oldRaw, data[offset:offset+int64(len(raw))])
+	dm.redo.UpdateLog(getSpaceUid(space, pg.GetId(), offset), xid, oldRaw, raw)
+	dm.redo.UpdateLog(getSpaceUid(space, pg.GetId(), position), xid, data[position:position+SzSlot], encodeSlot(offset))
+	dm.redo.RedoOnlyLog(getSpaceUid(space, pg.GetId(), 0), xid, data[:SzSlottedHead], head)
+	dm.writePage(pg, raw, offset)
+	dm.writePage(pg, encodeSlot(offset), position)
+	dm.writePage(pg, head, 0)
+}
+
+func (dm *DmImpl) writePage(pg Page, raw []byte, offset int64) {
+	if err := pg.Update(raw, offset); err != nil {
+		panic(fmt.Sprintf("Error occurs when updating page, err = %s\n", err))
+	}
+}
@@ -0,0 +1,42 @@
+package dataManager
+
+// 表空间的磁盘占用
+// 分配: 数据文件中的页数 * PageSize, 随新页的分配增长(数据文件不会缩小, 清空的表空间重建数据文件)
+// 已使用: 分配的字节数减去页的剩余空间, 剩余空间由空闲空间表(见freeSpaceMap.go)在页读出以及写回时增量维护, 非数据页按整页计算
+// 没有写回过的新页按整页计算; 迁移到冷文件的区(见coldStorage.go)以及压缩的区同样计入分配, 另外单独统计
+
+type SpaceSize struct {
+	Space     int64
+	Pages     int64
+	Allocated int64 // 分配的字节数
+	Used      int64 // 页中已使用的字节数
+	Cold      int64 // 位于冷文件中的字节数, 包含在Allocated中
+	Zipped    int64 // 压缩的区解压之后的字节数, 包含在Allocated中, 见extentCompression.go
+	Stored    int64 // 压缩的区在压缩文件中的字节数
+}
+
+// size 表空间当前的磁盘占用
+func (ts *TableSpace) size() SpaceSize {
+	pages := ts.pageCache.GetPageNumbers()
+	size := SpaceSize{Space: ts.id, Pages: pages, Allocated: pages * ts.tier.geo.PageSize}
+	if size.Used = size.Allocated - ts.fsm.freeBytes(); size.Used < 0 {
+		size.Used = 0
+	}
+	ts.tier.lock.RLock()
+	size.Cold = int64(len(ts.tier.extents)) * ExtentPages * ts.tier.geo.PageSize
+	zip := ts.tier.zip.stats()
+	size.Zipped, size.Stored = zip.Bytes, zip.Stored
+	ts.tier.lock.RUnlock()
+	return size
+}
+
+// SpaceSize 表空间的磁盘占用
+func (dm *DmImpl) SpaceSize(space int64) (SpaceSize, error) {
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext {
+		return SpaceSize{}, &ErrorSpaceNotExist{}
+	}
+	return ts.size(), nil
+}
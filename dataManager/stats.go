@@ -0,0 +1,65 @@
+package dataManager
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 运行统计
+// Stats返回DataManager打开之后的累计计数器, 用于调整OpenDataManager的缓冲区大小以及发现频繁换页的负载
+// 缓冲区: 命中, 未命中(从数据文件读取), 淘汰(引用计数归零之后移出缓存, 不包括关闭), 写回以及新分配的页, 为所有表空间之和
+// 淘汰与未命中接近并且持续增长说明缓冲区太小
+// DataItem: 插入(包括溢出链中的数据块以及更新时迁移到其他页的新DataItem), 删除(Delete置为无效),
+// 失效(删除以及更新迁移之后改写为转发桩的旧DataItem, 即当前读不再可见的DataItem)
+// redo log写入的字节数(包括缓存在内存中的批量日志), 启动时崩溃恢复的耗时(正常启动为0)
+// 计数器不持久化, 重新打开之后从0开始
+
+type DmStats struct {
+	Pool        PoolStats
+	Inserted    int64
+	Deleted     int64
+	Invalidated int64
+	LogBytes    int64
+	Recovery    time.Duration
+}
+
+// itemCounters DataItem的计数器
+type itemCounters struct {
+	inserted    atomic.Int64
+	deleted     atomic.Int64
+	invalidated atomic.Int64
+}
+
+func (dm *DmImpl) Stats() DmStats {
+	dm.spaceLock.RLock()
+	spaces := make([]*TableSpace, 0, len(dm.spaces))
+	for _, ts := range dm.spaces {
+		spaces = append(spaces, ts)
+	}
+	dm.spaceLock.RUnlock()
+	stats := DmStats{
+		Inserted:    dm.items.inserted.Load(),
+		Deleted:     dm.items.deleted.Load(),
+		Invalidated: dm.items.invalidated.Load(),
+		Recovery:    dm.recovery,
+	}
+	for _, ts := range spaces {
+		stats.Pool.add(ts.pageCache.Stats())
+	}
+	if lsn := dm.redo.Stats().Lsn; lsn > SzCheckSum {
+		// 日志文件以checkSum开始, 启动时重置
+		stats.LogBytes = lsn - SzCheckSum
+	}
+	return stats
+}
+
+// add 累加另一个缓冲区的统计
+func (s *PoolStats) add(other PoolStats) {
+	s.Capacity += other.Capacity
+	s.Cached += other.Cached
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Flushes += other.Flushes
+	s.Evictions += other.Evictions
+	s.Allocated += other.Allocated
+}
@@ -0,0 +1,64 @@
+package dataManager
+
+import (
+	"sort"
+)
+
+// DmStatus DataManager的运行状态, 用于诊断
+
+type SpaceStatus struct {
+	Space int64
+	Pages int64 // 数据文件中的页数
+	Used  int64 // 页中已使用的字节数, 见spaceSize.go
+	Pool  PoolStats
+	// FillFactor 插入时的填充因子
+	FillFactor int
+	Unlogged   bool // 不记录redo log
+}
+
+type DmStatus struct {
+	Spaces          []*SpaceStatus // 按表空间id排序
+	Pool            PoolStats      // 所有表空间的缓冲区之和
+	Redo            LogStats
+	MetaPages       int   // 数据库元数据区占用的页数
+	DanglingPending int   // 尚未处理的悬空引用数
+	DanglingTotal   int64 // 累计记录的悬空引用数
+	ForwardPending  int   // 尚未改写的经过转发桩的引用数
+	ForwardTotal    int64
+	ChangedPages    int64 // 上一次备份之后写回的页数
+	UnscrubbedPages int64 // 上一次校验之后写回的页数
+}
+
+func (dm *DmImpl) TakeLogBytes(xid int64) int64 {
+	return dm.redo.TakeBytes(xid)
+}
+
+func (dm *DmImpl) ReportReplica(name string, lsn int64) {
+	dm.redo.ReportReplica(name, lsn)
+}
+
+func (dm *DmImpl) Status() DmStatus {
+	dm.spaceLock.RLock()
+	spaces := make([]*TableSpace, 0, len(dm.spaces))
+	for _, ts := range dm.spaces {
+		spaces = append(spaces, ts)
+	}
+	dm.spaceLock.RUnlock()
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].id < spaces[j].id })
+	status := DmStatus{Redo: dm.redo.Stats()}
+	dm.metaLock.Lock()
+	status.MetaPages = dm.metaPages
+	dm.metaLock.Unlock()
+	dm.danglingLock.Lock()
+	status.DanglingPending, status.DanglingTotal = len(dm.dangling.pending), dm.dangling.total
+	status.ForwardPending, status.ForwardTotal = len(dm.dangling.forwarded), dm.dangling.forwardTotal
+	dm.danglingLock.Unlock()
+	status.ChangedPages, status.UnscrubbedPages = dm.changes.counts()
+	for _, ts := range spaces {
+		stats := ts.pageCache.Stats()
+		size := ts.size()
+		status.Spaces = append(status.Spaces, &SpaceStatus{Space: ts.id, Pages: size.Pages, Used: size.Used, Pool: stats, FillFactor: ts.FillFactor(), Unlogged: ts.unlogged.Load()})
+		status.Pool.add(stats)
+	}
+	return status
+}
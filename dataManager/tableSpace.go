@@ -0,0 +1,247 @@
+package dataManager
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// TableSpace 表空间
+// 每个表空间对应一个数据文件，拥有独立的PageCache和PageCtl
+// 0号表空间为系统表空间(path.fds), 存放数据库元数据以及未指定表空间的数据
+// n号表空间对应的数据文件为 path_ts<n>.fds, 每个表(及其索引)存放在独立的表空间中
+// 表空间的1号页与系统表空间相同，为元数据页(表空间头)
+// 数据文件可以切分为多个段文件, 见segment.go
+// 双写缓冲防止写回时崩溃留下不完整的页, 见doubleWrite.go
+
+const (
+	SystemSpace    int64  = 0
+	MaxSpaceId     int64  = (1 << 16) - 1
+	SpaceFileInfix string = "_ts"
+)
+
+type TableSpace struct {
+	id         int64
+	file       string
+	pageCache  PageCache
+	pageCtl    PageCtl
+	checksum   atomic.Bool  // 新写入的DataItem是否带校验和
+	fillFactor atomic.Int32 // 插入时的填充因子, 0表示默认值
+	events     *spaceEvents // 页事件统计, 见pageEvents.go
+	unlogged   atomic.Bool  // 修改不记录redo log, 见unlogged.go
+	tier       *pageTier    // 冷数据分层存储, 见coldStorage.go
+	// 持久化的空闲空间表, 见freeSpaceMap.go
+	fsm *freeSpaceMap
+}
+
+// fileOptions 数据文件的打开方式, 每个数据库一份, 由Option设置
+type fileOptions struct {
+	doubleWrite bool        // 见doubleWrite.go
+	segmentSize int64       // 新建的数据文件的段大小, 见segment.go
+	backend     FileBackend // 见directIO.go
+}
+
+// defaultFileOptions 用于不属于任何数据库的页缓存以及数据源
+var defaultFileOptions = &fileOptions{segmentSize: DefaultSegmentSize}
+
+type ErrorSpaceNotExist struct{}
+type ErrorSpaceOverflow struct{}
+
+func (err *ErrorSpaceNotExist) Error() string {
+	return "Table space doesn't exist"
+}
+
+func (err *ErrorSpaceOverflow) Error() string {
+	return "Too many table spaces"
+}
+
+func spaceFile(path string, space int64) string {
+	if space == SystemSpace {
+		return path
+	}
+	return path + SpaceFileInfix + strconv.FormatInt(space, 10)
+}
+
+// openTableSpace 打开(不存在时创建)一个表空间
+// 不初始化PageCtl, 由DataManager在崩溃恢复之后初始化
+// wal在页写回数据文件之前调用(写入缓存的redo log)
+// changes记录写回数据文件的页, cipher为页加密(见pageCipher.go), geo为数据库的页大小(见pageSize.go), files为数据文件的打开方式
+// readOnly时只读打开数据文件, 见readOnly.go
+func openTableSpace(path string, space int64, memory int64, wal func(), changes *changeTracker, cipher *pageCipher, geo *Geometry, files *fileOptions, readOnly bool) *TableSpace {
+	file := spaceFile(path, space)
+	tier := openPageTier(file+FileSuffix, geo, readOnly)
+	fsm := &freeSpaceMap{limit: geo.PageLimit}
+	tier.space, tier.changes, tier.fsm, tier.cipher, tier.files = space, changes, fsm, cipher, files
+	pc := newPageCache(uint32(memory/geo.PageSize), file, &sync.Mutex{}, wal, tier)
+	return &TableSpace{
+		id:        space,
+		file:      file + FileSuffix,
+		pageCache: pc,
+		pageCtl:   NewPageCtl(pc, geo.PageSize),
+		events:    newSpaceEvents(space),
+		tier:      tier,
+		fsm:       fsm,
+	}
+}
+
+// listTableSpaces 扫描数据库目录，返回所有非系统表空间的id
+func listTableSpaces(path string) []int64 {
+	files, err := filepath.Glob(path + SpaceFileInfix + "*" + FileSuffix)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when listing table spaces, err = %s", err))
+	}
+	spaces := make([]int64, 0)
+	prefix := path + SpaceFileInfix
+	for _, f := range files {
+		id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(f, prefix), FileSuffix), 10, 64)
+		if err != nil || id <= SystemSpace || id > MaxSpaceId {
+			continue
+		}
+		spaces = append(spaces, id)
+	}
+	return spaces
+}
+
+// getSpace 获取表空间, 不存在时panic
+func (dm *DmImpl) getSpace(space int64) *TableSpace {
+	dm.spaceLock.RLock()
+	defer dm.spaceLock.RUnlock()
+	if ts, ext := dm.spaces[space]; ext {
+		return ts
+	}
+	panic(fmt.Sprintf("Error occurs when getting table space %d, it doesn't exist", space))
+}
+
+// getOrOpenSpace
+// 仅用于崩溃恢复，redo log中可能记录了数据文件已经被删除的表空间
+func (dm *DmImpl) getOrOpenSpace(space int64) PageCache {
+	dm.spaceLock.Lock()
+	defer dm.spaceLock.Unlock()
+	if ts, ext := dm.spaces[space]; ext {
+		return ts.pageCache
+	}
+	ts := openTableSpace(dm.path, space, dm.memory, dm.redo.Flush, dm.changes, dm.cipher, dm.geo, &dm.files, false)
+	dm.spaces[space] = ts
+	return ts.pageCache
+}
+
+// CreateSpace 创建一个新的表空间，返回表空间id
+func (dm *DmImpl) CreateSpace() (int64, error) {
+	if dm.readOnly {
+		return -1, &ErrorReadOnly{}
+	}
+	// 新的表空间文件包含一个元数据页
+	if err := dm.checkQuota(dm.geo.PageSize); err != nil {
+		return -1, err
+	}
+	dm.spaceLock.Lock()
+	defer dm.spaceLock.Unlock()
+	space := dm.nextSpace()
+	if space > MaxSpaceId {
+		return -1, &ErrorSpaceOverflow{}
+	}
+	ts := openTableSpace(dm.path, space, dm.memory, dm.redo.Flush, dm.changes, dm.cipher, dm.geo, &dm.files, false)
+	ts.pageCtl.Init(ts.pageCache)
+	dm.spaces[space] = ts
+	dm.changes.renew(space)
+	log.Printf("[Data Manager] Create table space %d\n", space)
+	return space, nil
+}
+
+// ExportSpace
+// 将表空间的数据文件拷贝到dst
+// 调用方需要保证导出期间没有事物修改该表空间(持有表锁)
+func (dm *DmImpl) ExportSpace(space int64, dst string) error {
+	if space == SystemSpace {
+		return &ErrorSpaceNotExist{}
+	}
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext {
+		return &ErrorSpaceNotExist{}
+	}
+	if err := ts.tier.primary.exportTo(dst); err != nil {
+		return err
+	}
+	return ts.tier.copyTo(dst)
+}
+
+// AttachSpace
+// 将外部的表空间文件拷贝到数据库目录中，作为一个新的表空间挂载
+// 返回新的表空间id
+func (dm *DmImpl) AttachSpace(src string) (int64, error) {
+	if dm.readOnly {
+		return -1, &ErrorReadOnly{}
+	}
+	if dm.cipher != nil {
+		return -1, &ErrorEncryptedAttach{}
+	}
+	stat, err := os.Stat(src)
+	if err != nil {
+		return -1, err
+	}
+	if err := dm.checkQuota(stat.Size()); err != nil {
+		return -1, err
+	}
+	dm.spaceLock.Lock()
+	defer dm.spaceLock.Unlock()
+	space := dm.nextSpace()
+	if space > MaxSpaceId {
+		return -1, &ErrorSpaceOverflow{}
+	}
+	file := spaceFile(dm.path, space) + FileSuffix
+	// 先拷贝到临时文件再重命名，避免崩溃时留下不完整的表空间文件
+	if err := copyFile(src, file+TmpSuffix); err != nil {
+		return -1, err
+	}
+	if err := os.Rename(file+TmpSuffix, file); err != nil {
+		return -1, err
+	}
+	ts := openTableSpace(dm.path, space, dm.memory, dm.redo.Flush, dm.changes, dm.cipher, dm.geo, &dm.files, false)
+	ts.pageCtl.Init(ts.pageCache)
+	dm.spaces[space] = ts
+	dm.changes.renew(space)
+	log.Printf("[Data Manager] Attach table space %d from %s\n", space, src)
+	return space, nil
+}
+
+// nextSpace 必须持有spaceLock
+func (dm *DmImpl) nextSpace() int64 {
+	next := SystemSpace + 1
+	for id := range dm.spaces {
+		if id >= next {
+			next = id + 1
+		}
+	}
+	return next
+}
+
+const TmpSuffix string = ".tmp"
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
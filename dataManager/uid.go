@@ -0,0 +1,73 @@
+package dataManager
+
+// uid 数据(DataItem)的地址
+// [PageId]32[Space]16[Offset]16
+// 系统表空间的id为0，因此系统表空间中的uid与旧格式(高32位pageId, 低32位offset)兼容
+// uid必须为正数(上层用0和-1表示不存在), 因此每个表空间最多MaxPageId个页(8K页时16T, 32K页时64T), 数据库最多MaxSpaceId个表空间
+// 页内offset(槽式数据页中为槽位号) < MaxPageSize(32K), 16位足够
+// 不采用48位页号/16位槽位的格式: 表空间id占用了offset与pageId之间的16位, 48位页号没有表空间id的位置;
+// 并且改变格式需要重写所有已经存储的uid(索引, 版本链, 表的元数据, 日志), 没有可靠的迁移方法
+// 因此uid的格式保持不变, 不需要迁移, 单个数据库超过一个表空间容量的数据通过多个表空间存放; 页号用尽时Insert返回ErrorPageIdOverflow
+// 所有uid的编码与解析都必须通过本文件中的函数, redo log中的页标识见getPageKey
+
+const (
+	SzUidOffset int64 = 16
+	SzUidSpace  int64 = 16
+	SzUidPage   int64 = 32
+	MaxPageId   int64 = (1 << (SzUidPage - 1)) - 1
+	MaxOffset   int64 = (1 << SzUidOffset) - 1
+)
+
+type ErrorPageIdOverflow struct{}
+
+func (err *ErrorPageIdOverflow) Error() string {
+	return "Table space reaches the max number of pages"
+}
+
+func uidTrans(uid int64) (pageId, offset int64) {
+	offset = uid & MaxOffset
+	pageId = (uid >> (SzUidOffset + SzUidSpace)) & ((1 << SzUidPage) - 1)
+	return
+}
+
+func spaceOf(uid int64) int64 {
+	return (uid >> SzUidOffset) & MaxSpaceId
+}
+
+func getSpaceUid(space, pageId, offset int64) int64 {
+	return (pageId << (SzUidOffset + SzUidSpace)) | (space << SzUidOffset) | offset
+}
+
+// SplitUid 返回uid所在的表空间, 页号以及页内偏移
+func SplitUid(uid int64) (space, pageId, offset int64) {
+	pageId, offset = uidTrans(uid)
+	return spaceOf(uid), pageId, offset
+}
+
+// MakeUid SplitUid的逆操作
+func MakeUid(space, pageId, offset int64) int64 {
+	return getSpaceUid(space, pageId, offset)
+}
+
+// SpaceOf 返回uid所在的表空间
+func SpaceOf(uid int64) int64 {
+	return spaceOf(uid)
+}
+
+// PageKeyOf 返回uid所在的页(表空间 + 页号), 同一个页中的uid返回相同的值
+func PageKeyOf(uid int64) int64 {
+	pageId, _ := uidTrans(uid)
+	return getSpaceUid(spaceOf(uid), pageId, 0)
+}
+
+// PageOf 返回uid所在的页
+func PageOf(uid int64) int64 {
+	pageId, _ := uidTrans(uid)
+	return pageId
+}
+
+// MoveUid 将uid移动到表空间space(pageId和offset不变)
+func MoveUid(uid, space int64) int64 {
+	pageId, offset := uidTrans(uid)
+	return getSpaceUid(space, pageId, offset)
+}
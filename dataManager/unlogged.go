@@ -0,0 +1,138 @@
+package dataManager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// 不记录日志的表空间(UNLOGGED)
+// 表空间中DataItem的修改不写redo log(也就不参与崩溃恢复), 页仍然按原来的方式缓存以及写回
+// 正常关闭时脏页全部写回, 重新打开之后数据完整; 崩溃之后表空间中的数据不再可信, 恢复时清空(重建数据文件)
+// 事物回滚是逻辑的(按uid), 不依赖redo log; 清空的表空间由上层在启动时取走(TakeTruncated)并重置引用它们的元数据
+// 只能在表空间创建之后, 写入任何数据之前设置; 不记录日志的表空间列表保存在数据库元数据区(MetaUnloggedSpaces)
+
+type ErrorUnloggedSystemSpace struct{}
+
+func (err *ErrorUnloggedSystemSpace) Error() string {
+	return "System table space must be logged"
+}
+
+// SetUnlogged 表空间之后的修改不再记录redo log
+func (dm *DmImpl) SetUnlogged(space int64) error {
+	if space == SystemSpace {
+		return &ErrorUnloggedSystemSpace{}
+	}
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext {
+		return &ErrorSpaceNotExist{}
+	}
+	ts.unlogged.Store(true)
+	return dm.WriteMeta(MetaUnloggedSpaces, dm.encodeUnloggedSpaces())
+}
+
+// TakeTruncated 取走启动时(崩溃恢复之后)清空的表空间
+func (dm *DmImpl) TakeTruncated() []int64 {
+	dm.spaceLock.Lock()
+	defer dm.spaceLock.Unlock()
+	truncated := dm.truncated
+	dm.truncated = nil
+	return truncated
+}
+
+// encodeUnloggedSpaces [space]4..., 没有不记录日志的表空间时返回nil(删除section)
+func (dm *DmImpl) encodeUnloggedSpaces() []byte {
+	dm.spaceLock.RLock()
+	defer dm.spaceLock.RUnlock()
+	spaces := make([]int64, 0)
+	for id, ts := range dm.spaces {
+		if ts.unlogged.Load() {
+			spaces = append(spaces, id)
+		}
+	}
+	if len(spaces) == 0 {
+		return nil
+	}
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i] < spaces[j] })
+	data := make([]byte, 4*len(spaces))
+	for i, space := range spaces {
+		binary.BigEndian.PutUint32(data[4*i:], uint32(space))
+	}
+	return data
+}
+
+// loadUnloggedSpaces 启动时从元数据区恢复不记录日志的表空间, 崩溃之后清空它们
+// 必须在loadMeta之后, 初始化PageCtl以及载入表空间的其他设置之前调用
+func (dm *DmImpl) loadUnloggedSpaces(crashed bool) {
+	data, ext := dm.ReadMeta(MetaUnloggedSpaces)
+	if !ext {
+		return
+	}
+	for i := 0; i+4 <= len(data); i += 4 {
+		space := int64(binary.BigEndian.Uint32(data[i:]))
+		ts, ext := dm.spaces[space]
+		if !ext {
+			continue
+		}
+		if crashed {
+			ts = dm.truncateSpace(ts)
+		}
+		ts.unlogged.Store(true)
+	}
+}
+
+// truncateSpace 重建表空间的数据文件, 只保留表空间头
+func (dm *DmImpl) truncateSpace(ts *TableSpace) *TableSpace {
+	ts.pageCache.Close()
+	ts.tier.remove()
+	if err := removeDataFile(ts.file); err != nil {
+		panic(fmt.Sprintf("Error occurs when truncating table space %d, err = %s", ts.id, err))
+	}
+	truncated := openTableSpace(dm.path, ts.id, dm.memory, dm.redo.Flush, dm.changes, dm.cipher, dm.geo, &dm.files, false)
+	dm.spaces[ts.id] = truncated
+	dm.changes.renew(ts.id)
+	dm.truncated = append(dm.truncated, ts.id)
+	log.Printf("[Data Manager] Truncate unlogged table space %d after crash\n", ts.id)
+	return truncated
+}
+
+// logged uid所在的表空间是否记录redo log
+func (dm *DmImpl) logged(uid int64) bool {
+	dm.spaceLock.RLock()
+	defer dm.spaceLock.RUnlock()
+	ts, ext := dm.spaces[SpaceOf(uid)]
+	return !ext || !ts.unlogged.Load()
+}
+
+// unloggedFilter 丢弃不记录日志的表空间中的修改, 其余操作交给redo log
+type unloggedFilter struct {
+	Log
+	dm *DmImpl
+}
+
+func (f *unloggedFilter) UpdateLog(uid, xid int64, oldRaw, raw []byte) {
+	if f.dm.logged(uid) {
+		f.Log.UpdateLog(uid, xid, oldRaw, raw)
+	}
+}
+
+func (f *unloggedFilter) InsertLog(uid, xid int64, raw []byte) {
+	if f.dm.logged(uid) {
+		f.Log.InsertLog(uid, xid, raw)
+	}
+}
+
+func (f *unloggedFilter) RedoOnlyLog(uid, xid int64, oldRaw, raw []byte) {
+	if f.dm.logged(uid) {
+		f.Log.RedoOnlyLog(uid, xid, oldRaw, raw)
+	}
+}
+
+func (f *unloggedFilter) BatchInsertLog(uid, xid int64, oldItems, items, oldMeta, meta []byte) {
+	if f.dm.logged(uid) {
+		f.Log.BatchInsertLog(uid, xid, oldItems, items, oldMeta, meta)
+	}
+}
@@ -0,0 +1,93 @@
+package dataManager
+
+import (
+	"fmt"
+)
+
+// 整理(vacuum)
+// 清理(purge.go)只处理上层提交时记录的失效DataItem, 记录只保存在内存中: 重启之前没有清理的, 以及回滚的插入留下的DataItem不会被回收
+// Vacuum按页号顺序扫描整个表空间, 清理所有失效并且reclaim(uid)返回true的DataItem(不包括转发桩和溢出段), 由上层保证没有事物还能访问它们
+// 与purge相同, 只整理槽式数据页: 被清理的槽位置为0, 其余DataItem紧凑地移动到页尾, 槽位号不变, 因此uid不变, 索引以及行链表不需要修改
+// 整理之后的空闲空间写回空闲空间表; 旧格式的数据页中DataItem的uid为页内偏移, 整理会改变uid, 因此跳过(可以通过defragment迁移其中的行)
+// 每个页在页锁内整理, 记录为整页的REDOONLY日志
+
+type VacuumStats struct {
+	Pages     int64 // 扫描的页数
+	Compacted int64 // 整理的页数
+	Items     int64 // 清理的DataItem
+	Bytes     int64 // 回收的字节数
+	Skipped   int64 // 有失效DataItem但是没有整理的旧格式数据页
+}
+
+// Vacuum
+// 整理space中的所有数据页, reclaim在持有页锁时调用, 不能访问DataManager
+func (dm *DmImpl) Vacuum(xid, space int64, reclaim func(uid int64) bool) (VacuumStats, error) {
+	if dm.readOnly {
+		return VacuumStats{}, &ErrorReadOnly{}
+	}
+	dm.spaceLock.RLock()
+	ts, ext := dm.spaces[space]
+	dm.spaceLock.RUnlock()
+	if !ext {
+		return VacuumStats{}, &ErrorSpaceNotExist{}
+	}
+	stats := VacuumStats{}
+	for pageId := int64(1); pageId <= ts.pageCache.GetPageNumbers(); pageId++ {
+		if pageId == PageNumberDbMeta {
+			continue
+		}
+		stats.Pages++
+		dm.vacuumPage(xid, space, pageId, reclaim, &stats)
+	}
+	return stats, nil
+}
+
+func (dm *DmImpl) vacuumPage(xid, space, pageId int64, reclaim func(uid int64) bool, stats *VacuumStats) {
+	ts := dm.getSpace(space)
+	page, err := ts.pageCache.GetPage(pageId)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when getting pages, err = %s\n", err))
+	}
+	defer func() {
+		if err := ts.pageCache.ReleasePage(page); err != nil {
+			panic(fmt.Sprintf("Error occurs when releasing pages, err = %s\n", err))
+		}
+	}()
+	lock := dm.pageLocks.of(space, pageId)
+	lock.Lock()
+	defer lock.Unlock()
+	data := page.GetData()
+	if !isSlotted(data) {
+		invalid := false
+		forEachItem(data, func(data []byte, position int64) {
+			invalid = invalid || data[position] == DIInvalid
+		})
+		if invalid {
+			stats.Skipped++
+		}
+		return
+	}
+	slots := make(map[int64]struct{})
+	for slot := int64(0); slot < slotsOf(data); slot++ {
+		position := locate(data, slot)
+		if position == purgedSlot || data[position] != DIInvalid || isChunk(data[position:]) {
+			continue
+		}
+		if reclaim(getSpaceUid(space, pageId, slot)) {
+			slots[slot] = struct{}{}
+		}
+	}
+	if len(slots) == 0 {
+		return
+	}
+	free := page.GetFree()
+	compacted, purged := compactSlotted(data, slots, dm.geo.PageLimit)
+	limit := dm.geo.PageLimit
+	dm.redo.RedoOnlyLog(getSpaceUid(space, pageId, 0), xid, data[:limit], compacted[:limit])
+	page.SetData(compacted)
+	page.SetDirty(true)
+	ts.pageCtl.Reset(pageId, page.GetFree())
+	stats.Compacted++
+	stats.Items += int64(purged)
+	stats.Bytes += page.GetFree() - free
+}
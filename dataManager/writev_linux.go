@@ -0,0 +1,66 @@
+//go:build linux
+
+package dataManager
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const maxIovec int = 1024 // IOV_MAX
+
+// writeVectorAt 通过pwritev将bufs依次写入文件的offset处
+// 每次系统调用最多写入maxIovec段, 处理部分写入
+func writeVectorAt(file *os.File, bufs [][]byte, offset int64) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	iovecs := make([]syscall.Iovec, 0, len(bufs))
+	for _, buf := range bufs {
+		if len(buf) == 0 {
+			continue
+		}
+		iovec := syscall.Iovec{Base: &buf[0]}
+		iovec.SetLen(len(buf))
+		iovecs = append(iovecs, iovec)
+	}
+	for len(iovecs) > 0 {
+		count := len(iovecs)
+		if count > maxIovec {
+			count = maxIovec
+		}
+		var n uintptr
+		var errno syscall.Errno
+		if err := conn.Control(func(fd uintptr) {
+			n, _, errno = syscall.Syscall6(syscall.SYS_PWRITEV, fd,
+				uintptr(unsafe.Pointer(&iovecs[0])), uintptr(count), uintptr(offset), uintptr(offset>>32), 0)
+		}); err != nil {
+			return err
+		}
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		offset += int64(n)
+		// 跳过已经写完的段
+		written := int(n)
+		for written > 0 && written >= int(iovecs[0].Len) {
+			written -= int(iovecs[0].Len)
+			iovecs = iovecs[1:]
+		}
+		if written > 0 {
+			rest := unsafe.Slice(iovecs[0].Base, iovecs[0].Len)[written:]
+			iovecs[0].Base = &rest[0]
+			iovecs[0].SetLen(len(rest))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package dataManager
+
+import "os"
+
+// writeVectorAt 非linux平台依次写入每一段, 不拼接
+func writeVectorAt(file *os.File, bufs [][]byte, offset int64) error {
+	for _, buf := range bufs {
+		if _, err := file.WriteAt(buf, offset); err != nil {
+			return err
+		}
+		offset += int64(len(buf))
+	}
+	return nil
+}
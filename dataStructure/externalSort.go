@@ -0,0 +1,357 @@
+package util
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ExternalSorter 外部排序
+// 数据在内存中累积，超过内存预算时将排好序的数据块(run)写入临时文件
+// Sort时对内存中的数据以及所有run进行多路归并，返回有序迭代器
+// 每条数据为一行 []string
+// run file format: [FieldNumber]4 [Length]8[Field]...
+// 并行排序: 内存中的数据切分为workers段, 每段由一个goroutine排序, 之后归并为一个有序的run
+// 内存在查询的MemoryBudget中占用, 预算不足时溢出; 预算不限制时超过排序器自身的内存预算溢出, run由SpillManager管理(见memory.go)
+
+const (
+	DefaultSortMemory int64 = 4 << 20 // 默认内存预算 4M
+	MinParallelRows   int   = 1024    // 数据少于该行数时不并行排序
+	MinRunRows        int   = 64      // 查询的内存预算不足时, 内存中至少累积该行数再溢出, 避免产生大量很小的run
+)
+
+type ExternalSorter struct {
+	less    func(a, b []string) bool
+	budget  int64 // 内存预算(字节), 查询的内存预算不限制时使用
+	mem     *MemoryBudget
+	used    int64 // 在mem中占用的内存
+	buffer  [][]string
+	runs    []string // 临时文件
+	workers int      // 排序的worker数
+}
+
+type SortIterator interface {
+	Next() ([]string, error) // 迭代结束时返回 nil, nil
+	Close()                  // 删除临时文件
+}
+
+// NewExternalSorter budget <= 0 时使用默认内存预算, dir为空时使用系统临时目录
+func NewExternalSorter(less func(a, b []string) bool, budget int64, dir string) *ExternalSorter {
+	return NewParallelExternalSorter(less, budget, dir, 1)
+}
+
+// NewParallelExternalSorter workers个goroutine并行排序每个run, less必须是并发安全的
+func NewParallelExternalSorter(less func(a, b []string) bool, budget int64, dir string, workers int) *ExternalSorter {
+	if budget <= 0 {
+		budget = DefaultSortMemory
+	}
+	return NewBudgetSorter(less, NewMemoryBudget(budget, NewSpillManager(dir, 0)), workers)
+}
+
+// NewBudgetSorter 在查询的内存预算mem中排序, run写入mem的溢出文件管理器
+func NewBudgetSorter(less func(a, b []string) bool, mem *MemoryBudget, workers int) *ExternalSorter {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ExternalSorter{
+		less:    less,
+		budget:  DefaultSortMemory,
+		mem:     mem,
+		buffer:  make([][]string, 0),
+		runs:    make([]string, 0),
+		workers: workers,
+	}
+}
+
+func (s *ExternalSorter) Add(row []string) error {
+	s.buffer = append(s.buffer, row)
+	size := RowSize(row)
+	reserved := s.mem.Reserve(size)
+	if reserved {
+		s.used += size
+	}
+	if (!reserved && len(s.buffer) >= MinRunRows) || (!s.mem.Limited() && s.used > s.budget) {
+		return s.spill()
+	}
+	return nil
+}
+
+// Sort
+// 调用后不能再Add
+func (s *ExternalSorter) Sort() (SortIterator, error) {
+	s.sortBuffer()
+	if len(s.runs) == 0 {
+		return &memoryIterator{rows: s.buffer, mem: s.mem, used: s.used}, nil
+	}
+	if len(s.buffer) > 0 {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+	it := &mergeIterator{less: s.less, files: s.runs, spill: s.mem.Spill()}
+	for i, run := range s.runs {
+		f, err := os.Open(run)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		it.readers = append(it.readers, f)
+		r := &runReader{id: i, reader: bufio.NewReader(f)}
+		if err := r.advance(); err != nil {
+			it.Close()
+			return nil, err
+		}
+		if r.row != nil {
+			it.heap.items = append(it.heap.items, r)
+		}
+	}
+	it.heap.less = s.less
+	heap.Init(&it.heap)
+	return it, nil
+}
+
+// Close 删除临时文件并释放内存, 用于Sort之前出错的情况
+func (s *ExternalSorter) Close() {
+	for _, run := range s.runs {
+		s.mem.Spill().Remove(run)
+	}
+	s.mem.Release(s.used)
+	s.used = 0
+}
+
+// spill 将内存中的数据排序后写入一个run
+func (s *ExternalSorter) spill() error {
+	s.sortBuffer()
+	f, err := s.mem.Spill().Create()
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+	var size int64
+	for _, row := range s.buffer {
+		size += encodedSize(row)
+	}
+	if err := s.mem.Spill().Grow(f.Name(), size); err != nil {
+		_ = f.Close()
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, row := range s.buffer {
+		if err := writeRow(w, row); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.buffer = make([][]string, 0)
+	s.mem.Release(s.used)
+	s.used = 0
+	return f.Close()
+}
+
+// sortBuffer 稳定排序内存中的数据
+func (s *ExternalSorter) sortBuffer() {
+	workers := s.workers
+	if n := len(s.buffer) / MinParallelRows; n < workers {
+		workers = n
+	}
+	if workers <= 1 {
+		sort.SliceStable(s.buffer, func(i, j int) bool { return s.less(s.buffer[i], s.buffer[j]) })
+		return
+	}
+	// 每段连续的数据由一个worker排序
+	segments := make([][][]string, workers)
+	size := (len(s.buffer) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for i := range segments {
+		start, end := i*size, (i+1)*size
+		if end > len(s.buffer) {
+			end = len(s.buffer)
+		}
+		segments[i] = s.buffer[start:end]
+		wg.Add(1)
+		go func(seg [][]string) {
+			defer wg.Done()
+			sort.SliceStable(seg, func(i, j int) bool { return s.less(seg[i], seg[j]) })
+		}(segments[i])
+	}
+	wg.Wait()
+	// 多路归并, 相等的数据取编号小的段, 保持稳定
+	h := &runHeap{less: s.less, items: make([]*runReader, 0, workers)}
+	for i, seg := range segments {
+		if len(seg) > 0 {
+			h.items = append(h.items, &runReader{id: i, row: seg[0]})
+		}
+	}
+	heap.Init(h)
+	pos := make([]int, workers)
+	merged := make([][]string, 0, len(s.buffer))
+	for h.Len() > 0 {
+		top := h.items[0]
+		merged = append(merged, top.row)
+		if pos[top.id] += 1; pos[top.id] < len(segments[top.id]) {
+			top.row = segments[top.id][pos[top.id]]
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	s.buffer = merged
+}
+
+// RowSize 一行在内存中占用的字节数(估计)
+func RowSize(row []string) int64 {
+	size := int64(24) // slice header
+	for _, field := range row {
+		size += int64(len(field)) + 16
+	}
+	return size
+}
+
+// encodedSize 行在run中的字节数
+func encodedSize(row []string) int64 {
+	size := int64(4)
+	for _, field := range row {
+		size += int64(8 + len(field))
+	}
+	return size
+}
+
+func writeRow(w io.Writer, row []string) error {
+	if err := binary.Write(w, binary.BigEndian, int32(len(row))); err != nil {
+		return err
+	}
+	for _, field := range row {
+		if err := binary.Write(w, binary.BigEndian, int64(len(field))); err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(field)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRow 文件结束时返回 nil, nil
+func readRow(r io.Reader) ([]string, error) {
+	var fieldNum int32
+	if err := binary.Read(r, binary.BigEndian, &fieldNum); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	row := make([]string, fieldNum)
+	for i := range row {
+		var length int64
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		row[i] = string(buf)
+	}
+	return row, nil
+}
+
+// iterators
+
+type memoryIterator struct {
+	rows [][]string
+	pos  int
+	mem  *MemoryBudget
+	used int64 // Close时释放
+}
+
+func (it *memoryIterator) Next() ([]string, error) {
+	if it.pos >= len(it.rows) {
+		return nil, nil
+	}
+	it.pos += 1
+	return it.rows[it.pos-1], nil
+}
+
+func (it *memoryIterator) Close() {
+	it.mem.Release(it.used)
+	it.used = 0
+}
+
+type runReader struct {
+	id     int // run编号, 相等的数据按run编号保持稳定
+	reader io.Reader
+	row    []string
+}
+
+func (r *runReader) advance() error {
+	row, err := readRow(r.reader)
+	r.row = row
+	return err
+}
+
+type runHeap struct {
+	items []*runReader
+	less  func(a, b []string) bool
+}
+
+func (h runHeap) Len() int { return len(h.items) }
+func (h runHeap) Less(i, j int) bool {
+	if h.less(h.items[i].row, h.items[j].row) {
+		return true
+	}
+	if h.less(h.items[j].row, h.items[i].row) {
+		return false
+	}
+	return h.items[i].id < h.items[j].id
+}
+func (h runHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *runHeap) Push(x any)   { h.items = append(h.items, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+	return item
+}
+
+type mergeIterator struct {
+	less    func(a, b []string) bool
+	heap    runHeap
+	files   []string
+	readers []*os.File
+	spill   *SpillManager
+}
+
+func (it *mergeIterator) Next() ([]string, error) {
+	if it.heap.Len() == 0 {
+		return nil, nil
+	}
+	top := it.heap.items[0]
+	row := top.row
+	if err := top.advance(); err != nil {
+		return nil, err
+	}
+	if top.row == nil {
+		heap.Pop(&it.heap)
+	} else {
+		heap.Fix(&it.heap, 0)
+	}
+	return row, nil
+}
+
+func (it *mergeIterator) Close() {
+	for _, f := range it.readers {
+		_ = f.Close()
+	}
+	for _, file := range it.files {
+		it.spill.Remove(file)
+	}
+}
@@ -0,0 +1,151 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 查询内存管理
+// MemoryBudget 一个查询的内存预算, 由查询中的所有算子(排序, 哈希, 聚合)共享, 算子占用内存之前先Reserve
+// 预算不足时可以溢出的算子(外部排序)将数据写入溢出文件并释放内存, 不能溢出的算子返回错误, 一个大查询不会耗尽进程的内存
+// SpillManager 溢出文件管理, 由所有查询共享: 溢出文件位于同一目录, 记录当前的文件数以及字节数, 超过上限时拒绝溢出
+// 打开时清理目录中之前遗留的溢出文件(崩溃时没有删除)
+
+type ErrorSpillLimit struct{}
+
+func (err *ErrorSpillLimit) Error() string {
+	return "Spill files exceed the limit"
+}
+
+type MemoryBudget struct {
+	lock  sync.Mutex
+	limit int64 // <= 0 表示不限制
+	used  int64
+	peak  int64
+	spill *SpillManager
+}
+
+// NewMemoryBudget limit <= 0 时不限制, spill为nil时溢出到系统临时目录
+func NewMemoryBudget(limit int64, spill *SpillManager) *MemoryBudget {
+	if spill == nil {
+		spill = NewSpillManager("", 0)
+	}
+	return &MemoryBudget{limit: limit, spill: spill}
+}
+
+// Reserve 在预算之内时占用n字节并返回true
+func (b *MemoryBudget) Reserve(n int64) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.limit > 0 && b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	if b.used > b.peak {
+		b.peak = b.used
+	}
+	return true
+}
+
+func (b *MemoryBudget) Release(n int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.used -= n
+}
+
+// Limited 是否有内存上限
+func (b *MemoryBudget) Limited() bool {
+	return b.limit > 0
+}
+
+// Peak 占用内存的峰值
+func (b *MemoryBudget) Peak() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.peak
+}
+
+func (b *MemoryBudget) Spill() *SpillManager {
+	return b.spill
+}
+
+type SpillStats struct {
+	Files      int64 // 当前的溢出文件数
+	Bytes      int64 // 当前溢出文件的字节数
+	TotalBytes int64 // 累计写入溢出文件的字节数
+}
+
+type SpillManager struct {
+	lock  sync.Mutex
+	dir   string // 为空时使用系统临时目录
+	limit int64  // 溢出文件的总字节数上限, <= 0 表示不限制
+	files map[string]int64
+	total int64
+}
+
+// NewSpillManager dir不为空时创建目录并删除其中遗留的溢出文件
+func NewSpillManager(dir string, limit int64) *SpillManager {
+	if dir != "" {
+		_ = os.MkdirAll(dir, 0755)
+		if stale, err := filepath.Glob(filepath.Join(dir, "spill_*")); err == nil {
+			for _, name := range stale {
+				_ = os.Remove(name)
+			}
+		}
+	}
+	return &SpillManager{dir: dir, limit: limit, files: map[string]int64{}}
+}
+
+// SetLimit 溢出文件的总字节数上限, <= 0 表示不限制
+func (m *SpillManager) SetLimit(limit int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.limit = limit
+}
+
+// Create 创建一个溢出文件
+func (m *SpillManager) Create() (*os.File, error) {
+	f, err := os.CreateTemp(m.dir, "spill_*")
+	if err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	m.files[f.Name()] = 0
+	m.lock.Unlock()
+	return f, nil
+}
+
+// Grow 溢出文件name写入了n字节, 超过上限时返回ErrorSpillLimit
+func (m *SpillManager) Grow(name string, n int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.limit > 0 && m.bytes()+n > m.limit {
+		return &ErrorSpillLimit{}
+	}
+	m.files[name] += n
+	m.total += n
+	return nil
+}
+
+// Remove 删除溢出文件
+func (m *SpillManager) Remove(name string) {
+	_ = os.Remove(name)
+	m.lock.Lock()
+	delete(m.files, name)
+	m.lock.Unlock()
+}
+
+func (m *SpillManager) Stats() SpillStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return SpillStats{Files: int64(len(m.files)), Bytes: m.bytes(), TotalBytes: m.total}
+}
+
+func (m *SpillManager) bytes() int64 {
+	var size int64
+	for _, n := range m.files {
+		size += n
+	}
+	return size
+}
@@ -27,6 +27,7 @@ func NewSkipList(f func(any, any) int) *SkipList {
 	return &SkipList{
 		root: &skipListNode{struct{}{},
 			[maxLevel]*skipListNode{}},
+		compareFunction: f,
 	}
 }
 
@@ -44,7 +45,7 @@ func (list *SkipList) Add(target any) {
 	ans := list.find(target)
 	newNode := &skipListNode{target, [maxLevel]*skipListNode{}}
 	for i := 0; i < maxLevel; i++ {
-		newNode.next[i] = ans[i]
+		newNode.next[i] = ans[i].next[i]
 		ans[i].next[i] = newNode
 		if rand.Intn(2) == 0 {
 			break
@@ -54,10 +55,10 @@ func (list *SkipList) Add(target any) {
 
 func (list *SkipList) Remove(target any) {
 	ans := list.find(target)
-	if ans[0].next[0] != nil && list.compareFunction(ans[0].next[0].val, target) == 0 {
+	if node := ans[0].next[0]; node != nil && list.compareFunction(node.val, target) == 0 {
 		for i := 0; i < maxLevel; i++ {
-			if ans[i].next[i] != nil && list.compareFunction(ans[0].next[0].val, target) == 0 {
-				ans[i].next[i] = ans[i].next[i].next[i]
+			if ans[i].next[i] == node {
+				ans[i].next[i] = node.next[i]
 			} else {
 				break
 			}
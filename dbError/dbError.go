@@ -0,0 +1,37 @@
+package dbError
+
+import "errors"
+
+// 错误分类
+// 各层返回的具体错误(ErrorXxx)保持不变, 仍然可以用errors.As取出; 同一类失败的错误实现Is方法, 与下面的分类相等
+// 应用用errors.Is(err, dbError.ErrLockTimeout)判断失败的类别, 不需要知道错误由哪一层产生
+// ErrDuplicateKey  名字(表, 数据库, 游标, 定时事件)已经存在
+// ErrLockTimeout   等待锁超时, 事物已经回滚
+// ErrDeadlock      检测到死锁, 事物已经回滚
+// ErrSerialization 事物读到的版本与当前版本冲突(例如schema已经改变), 事物必须回滚
+// ErrCorruptPage   页校验失败(scrub发现的CorruptPage, 读页时的ErrorPageChecksum)
+// ErrDiskFull      超过数据库容量限制或者磁盘剩余空间不足
+// ErrLockTimeout, ErrDeadlock以及ErrSerialization之后可以重新执行整个事物(见Retryable)
+
+// Class 错误的类别
+type Class struct {
+	name string
+}
+
+func (c *Class) Error() string {
+	return c.name
+}
+
+var (
+	ErrDuplicateKey  = &Class{"duplicate key"}
+	ErrLockTimeout   = &Class{"lock wait timeout"}
+	ErrDeadlock      = &Class{"deadlock"}
+	ErrSerialization = &Class{"serialization failure"}
+	ErrCorruptPage   = &Class{"corrupt page"}
+	ErrDiskFull      = &Class{"disk full"}
+)
+
+// Retryable 回滚之后重新执行整个事物可能成功
+func Retryable(err error) bool {
+	return errors.Is(err, ErrLockTimeout) || errors.Is(err, ErrDeadlock) || errors.Is(err, ErrSerialization)
+}
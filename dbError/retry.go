@@ -0,0 +1,42 @@
+package dbError
+
+import (
+	"context"
+	"math/rand"
+	"myDB/simulation"
+	"time"
+)
+
+// 自动重试
+// Retry执行attempt, 返回可以重试的错误(死锁, 锁等待超时, 序列化失败, 见Retryable)时在退避之后重新执行
+// 退避从RetryBackoff开始每次翻倍, 不超过MaxRetryBackoff, 并随机缩短至一半以内, 避免冲突的事物同时重试
+// 最多重试MaxRetries次, 之后返回最后一次的错误; ctx取消时不再重试, 返回ctx.Err()
+// attempt负责在一个新的事物中执行并在失败时回滚, 见kv.RunInTransaction以及executor.RunInTransaction
+
+const (
+	MaxRetries      int           = 10
+	RetryBackoff    time.Duration = 5 * time.Millisecond
+	MaxRetryBackoff time.Duration = 500 * time.Millisecond
+)
+
+func Retry(ctx context.Context, attempt func() error) error {
+	backoff := RetryBackoff
+	for retry := 0; ; retry++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := attempt()
+		if err == nil || !Retryable(err) || retry == MaxRetries {
+			return err
+		}
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-simulation.After(wait):
+		}
+		if backoff *= 2; backoff > MaxRetryBackoff {
+			backoff = MaxRetryBackoff
+		}
+	}
+}
@@ -1,15 +1,16 @@
 package debug
 
-import "log"
+import (
+	"log"
+	"myDB/dataManager"
+)
 
 func UidTrans(uid int64) (pageId, offset int64) {
-	offset = uid & ((1 << 32) - 1)
-	uid >>= 32
-	pageId = uid & ((1 << 32) - 1)
+	_, pageId, offset = dataManager.SplitUid(uid)
 	log.Printf("[Data Manager] UID TRANS LOCATE AT %d %d\n", pageId, offset)
 	return
 }
 
 func GetUid(pageId, offset int64) int64 {
-	return (pageId << 32) | offset
+	return dataManager.MakeUid(dataManager.SystemSpace, pageId, offset)
 }
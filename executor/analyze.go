@@ -0,0 +1,51 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 采样统计
+// analyze <table> [sample <percent>]
+// 块采样表中约percent%(默认tableManager.DefaultSamplePercent)的页, 更新表的统计信息, 见tableManager/analyze.go
+// 事物之外执行时使用独立的短事物
+// 每个字段返回一行: 字段名, 估计的行数, 估计的不同值的个数, 样本中的最小值和最大值, 选中的页数/表空间的页数
+
+func parseAnalyze(args []string) (*tableManager.Analyze, error) {
+	if len(args) != 2 && (len(args) != 4 || strings.ToUpper(args[2]) != "SAMPLE") {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	analyze := &tableManager.Analyze{TbName: args[1]}
+	if len(args) == 4 {
+		percent, err := strconv.Atoi(strings.TrimSuffix(args[3], "%"))
+		if err != nil || percent < 1 || percent > 100 {
+			return nil, &ErrorRequestArgNumber{}
+		}
+		analyze.Percent = percent
+	}
+	return analyze, nil
+}
+
+func (db *NtDB) analyze(xid int64, analyze *tableManager.Analyze) ([]*tableManager.ResponseObject, error) {
+	if xid == -1 {
+		xid = db.storageEngine.Begin()
+		defer db.storageEngine.Commit(xid)
+	}
+	stats, err := db.storageEngine.Analyze(xid, analyze)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*tableManager.ResponseObject, 0)
+	for j, title := range []string{"field", "rows", "distinct", "min", "max", "sampled_pages"} {
+		res = append(res, &tableManager.ResponseObject{Payload: title, RowId: 0, ColId: j})
+	}
+	pages := strconv.FormatInt(stats.SampledPages, 10) + "/" + strconv.FormatInt(stats.Pages, 10)
+	for i, column := range stats.Columns {
+		row := []string{column.Field, strconv.FormatInt(stats.Rows, 10), strconv.FormatInt(column.Distinct, 10), column.Min, column.Max, pages}
+		for j, value := range row {
+			res = append(res, &tableManager.ResponseObject{Payload: value, RowId: i + 1, ColId: j})
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,29 @@
+package executor
+
+import (
+	"myDB/exporter"
+	"myDB/simulation"
+)
+
+// ExecuteArrow
+// 在会话session中执行select, 结果以Arrow RecordBatch的形式返回
+// 列类型由基表字段决定, 类型未知的列编码为utf8
+func (db *NtDB) ExecuteArrow(session *Session, xid int64, args []string) (int64, *exporter.ArrowTable, error) {
+	if _, ok := db.parseSelect(args); !ok {
+		return xid, nil, &ErrorInvalidEntity{}
+	}
+	start := simulation.Now()
+	db.storageEngine.BeginStatement(xid)
+	rel, err := db.selectToRelation(session, xid, args, map[string]*relation{})
+	db.endStatement(session, xid, args, simulation.Now().Sub(start))
+	db.auditStatement(session, xid, args, err)
+	if err != nil {
+		return xid, nil, err
+	}
+	fields := make([]*exporter.Column, len(rel.columns))
+	for i, name := range rel.columns {
+		fields[i] = exportColumn(name, rel.types[i])
+	}
+	table, err := exporter.NewArrowTable(fields, rel.rows, exporter.DefaultBatchSize)
+	return xid, table, err
+}
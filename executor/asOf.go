@@ -0,0 +1,47 @@
+package executor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 时间旅行查询
+// select <field>... from <table> as of <timestamp> [where ...]
+// timestamp为RFC3339格式(2006-01-02T15:04:05Z07:00)或者Unix时间戳(秒)
+// 只能查询保留时间之内的时间点, 见versionManager/timeTravel.go
+
+type ErrorInvalidAsOf struct{}
+
+func (err *ErrorInvalidAsOf) Error() string {
+	return "Invalid as of clause"
+}
+
+// splitAsOf 将FROM <table>之后的AS OF子句分离出来, 没有AS OF子句时返回零值
+func splitAsOf(args []string) ([]string, time.Time, error) {
+	for i := 2; i+1 < len(args); i++ {
+		if strings.ToUpper(args[i]) != "AS" || strings.ToUpper(args[i+1]) != "OF" || strings.ToUpper(args[i-2]) != "FROM" {
+			continue
+		}
+		if i+2 >= len(args) {
+			return nil, time.Time{}, &ErrorInvalidAsOf{}
+		}
+		at, err := parseTimestamp(args[i+2])
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		rest := append(append([]string{}, args[:i]...), args[i+3:]...)
+		return rest, at, nil
+	}
+	return args, time.Time{}, nil
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return at, nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil && sec > 0 {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, &ErrorInvalidAsOf{}
+}
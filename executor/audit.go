@@ -0,0 +1,251 @@
+package executor
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"myDB/simulation"
+	"myDB/tableManager"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 审计日志
+// 开启审计后, 每条语句执行结束时追加一条记录: 时间, 用户, 客户端地址, 数据库, 事物, 语句, 访问的对象(目录中的表名等), 错误
+// 记录为一行json, 按顺序编号, 每条记录包含上一条记录的hash(Prev)以及本条记录的hash(Hash = sha256(Prev为已知值, Hash为空时的json))
+// 修改, 删除或者插入任意一条记录都会破坏hash链, 打开或者读取审计日志时校验整个文件
+// 截断文件尾部无法仅凭文件本身发现, 上层可以定期将Head()保存到其他位置
+// 文件只能追加写入, 同一个文件只能由一个执行器打开
+// 语句中的值会原样写入审计日志, 包括加密字段的值
+
+type ErrorAuditTampered struct{}
+
+func (err *ErrorAuditTampered) Error() string {
+	return "Audit log is tampered"
+}
+
+type AuditRecord struct {
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Client    string    `json:"client"`
+	Database  string    `json:"database"`
+	Xid       int64     `json:"xid"`
+	Statement string    `json:"statement"`
+	Objects   []string  `json:"objects"`
+	Error     string    `json:"error"`
+	Prev      string    `json:"prev"`
+	Hash      string    `json:"hash"`
+}
+
+// digest Hash为空时的json的sha256
+func (r *AuditRecord) digest() (string, error) {
+	hash := r.Hash
+	r.Hash = ""
+	raw, err := json.Marshal(r)
+	r.Hash = hash
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditFilter 读取审计日志时按表或者用户过滤, 空字符串表示不过滤
+type AuditFilter struct {
+	Table string // 目录中的表名
+	User  string
+}
+
+func (f *AuditFilter) match(r *AuditRecord) bool {
+	if f == nil {
+		return true
+	}
+	if f.User != "" && f.User != r.User {
+		return false
+	}
+	if f.Table == "" {
+		return true
+	}
+	for _, object := range r.Objects {
+		if object == f.Table {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadAuditLog 校验path的hash链, 返回满足filter的记录
+// 文件不存在时返回空; hash链被破坏时返回ErrorAuditTampered
+func ReadAuditLog(path string, filter *AuditFilter) ([]*AuditRecord, error) {
+	records := make([]*AuditRecord, 0)
+	_, err := scanAuditLog(path, func(r *AuditRecord) {
+		if filter.match(r) {
+			records = append(records, r)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// scanAuditLog 按顺序校验每条记录并调用fn, 返回最后一条记录
+func scanAuditLog(path string, fn func(r *AuditRecord)) (*AuditRecord, error) {
+	last := &AuditRecord{}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return last, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		r := &AuditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, &ErrorAuditTampered{}
+		}
+		hash, err := r.digest()
+		if err != nil {
+			return nil, err
+		}
+		if r.Seq != last.Seq+1 || r.Prev != last.Hash || r.Hash != hash {
+			return nil, &ErrorAuditTampered{}
+		}
+		fn(r)
+		last = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return last, nil
+}
+
+type AuditLog struct {
+	lock sync.Mutex
+	file *os.File
+	last *AuditRecord // 只使用Seq和Hash
+}
+
+// OpenAuditLog 校验已有的记录之后以追加方式打开path
+func OpenAuditLog(path string) (*AuditLog, error) {
+	last, err := scanAuditLog(path, func(*AuditRecord) {})
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: file, last: last}, nil
+}
+
+// Head 最后一条记录的编号以及hash
+func (a *AuditLog) Head() (int64, string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.last.Seq, a.last.Hash
+}
+
+func (a *AuditLog) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.file.Close()
+}
+
+// append 填充Seq, Prev, Hash之后写入一行
+func (a *AuditLog) append(r *AuditRecord) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	r.Seq, r.Prev = a.last.Seq+1, a.last.Hash
+	hash, err := r.digest()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(append(raw, '\n')); err != nil {
+		return err
+	}
+	a.last = r
+	return nil
+}
+
+// SetAuditLog 开启审计, audit为nil时关闭
+func (db *NtDB) SetAuditLog(audit *AuditLog) {
+	db.audit.Store(audit)
+}
+
+// auditStatement 语句执行结束之后写入审计日志
+func (db *NtDB) auditStatement(session *Session, xid int64, args []string, err error) {
+	audit := db.audit.Load()
+	if audit == nil {
+		return
+	}
+	r := &AuditRecord{
+		Time:      simulation.Now().UTC(),
+		User:      session.User,
+		Client:    session.Client,
+		Database:  session.Database,
+		Xid:       xid,
+		Statement: strings.Join(args, " "),
+		Objects:   db.auditObjects(session.Database, args),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := audit.append(r); err != nil {
+		log.Printf("[Audit] Failed to write audit record %s: %s\n", r.Statement, err)
+	}
+}
+
+// auditObjects 语句访问的对象, 只在开启审计时重新解析语句
+func (db *NtDB) auditObjects(database string, args []string) []string {
+	_, entity, err := db.parser.ParseRequest(args)
+	if err != nil || len(entity) == 0 {
+		return nil
+	}
+	if err := db.resolveEntity(database, entity[0]); err != nil {
+		return nil
+	}
+	switch e := entity[0].(type) {
+	case *tableManager.Select:
+		return []string{e.TbName}
+	case *tableManager.Update:
+		return []string{e.TName}
+	case *tableManager.Insert:
+		return []string{e.TbName}
+	case *tableManager.Delete:
+		return []string{e.TName}
+	case *tableManager.Create:
+		return []string{e.TbName}
+	case *tableManager.Export:
+		return []string{e.TbName}
+	case *tableManager.Attach:
+		return []string{e.TbName}
+	case *tableManager.Flashback:
+		return []string{e.TbName}
+	case *CreateDatabase:
+		return []string{e.Name}
+	case *UseDatabase:
+		return []string{e.Name}
+	case *CreateView:
+		if name, err := db.resolveTable(database, e.Name); err == nil {
+			return []string{name}
+		}
+	case *RefreshView:
+		if name, err := db.resolveTable(database, e.Name); err == nil {
+			return []string{name}
+		}
+	}
+	return nil
+}
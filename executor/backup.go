@@ -0,0 +1,51 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 在线备份
+// backup to <dir> [incremental from <base dir>]
+// 全量备份拷贝所有数据文件; 增量备份只拷贝基准备份(必须是最近一次备份)之后写回数据文件的页, 见dataManager/backup.go
+// 不属于当前事物, 可以在事物中执行; 返回备份的id, 基准的id, redo LSN, 拷贝的页数以及字节数
+// 恢复: 数据库关闭时调用dataManager.RestoreBackup依次恢复全量备份以及增量备份
+
+type Backup struct {
+	Dir  string
+	Base string // 为空时全量备份
+}
+
+func parseBackup(args []string) (*Backup, error) {
+	if (len(args) != 3 && len(args) != 6) || strings.ToUpper(args[1]) != "TO" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	backup := &Backup{Dir: args[2]}
+	if len(args) == 6 {
+		if strings.ToUpper(args[3]) != "INCREMENTAL" || strings.ToUpper(args[4]) != "FROM" {
+			return nil, &ErrorRequestArgNumber{}
+		}
+		backup.Base = args[5]
+	}
+	return backup, nil
+}
+
+func (db *NtDB) backup(backup *Backup) ([]*tableManager.ResponseObject, error) {
+	stats, err := db.storageEngine.Backup(backup.Dir, backup.Base)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*tableManager.ResponseObject, 0, 10)
+	for j, title := range []string{"id", "base", "lsn", "pages", "bytes"} {
+		res = append(res, &tableManager.ResponseObject{Payload: title, RowId: 0, ColId: j})
+	}
+	values := []string{stats.Id, stats.Base, strconv.FormatInt(stats.Lsn, 10), strconv.FormatInt(stats.Pages, 10), strconv.FormatInt(stats.Bytes, 10)}
+	if stats.Base == "" {
+		values[1] = "-"
+	}
+	for j, value := range values {
+		res = append(res, &tableManager.ResponseObject{Payload: value, RowId: 1, ColId: j})
+	}
+	return res, nil
+}
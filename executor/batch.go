@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 批量执行预编译语句
+// 一条带占位符的DML语句配合多组参数执行, 所有参数组在同一个事物中执行
+// 执行期间事物的日志不逐条刷盘, 结束时只刷盘一次, 用于批量导入
+// 协议格式: executemany <语句token数n> <语句token>...(n个) <参数>...
+// 参数按组排列, 每组的参数个数等于语句中占位符的个数
+
+const Placeholder string = "?"
+
+type ErrorInvalidBatch struct{}
+
+func (err *ErrorInvalidBatch) Error() string {
+	return "Invalid batch statement or parameters"
+}
+
+// ParseExecuteMany 解析executemany协议消息, 返回语句和参数组
+func ParseExecuteMany(args []string) ([]string, [][]string, error) {
+	if len(args) < 3 || strings.ToUpper(args[0]) != "EXECUTEMANY" {
+		return nil, nil, &ErrorRequestArgNumber{}
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 || n > len(args)-2 {
+		return nil, nil, &ErrorRequestArgNumber{}
+	}
+	stmt, rest := args[2:2+n], args[2+n:]
+	count := countPlaceholders(stmt)
+	if count == 0 || len(rest) == 0 || len(rest)%count != 0 {
+		return nil, nil, &ErrorInvalidBatch{}
+	}
+	params := make([][]string, 0, len(rest)/count)
+	for i := 0; i < len(rest); i += count {
+		params = append(params, rest[i:i+count])
+	}
+	return stmt, params, nil
+}
+
+// ExecuteMany
+// xid事物在会话session中对每组参数执行一次stmt
+// 遇到错误时立即返回, 上层必须回滚事物
+// 语句带有RETURNING时合并所有参数组的结果
+func (db *NtDB) ExecuteMany(session *Session, xid int64, stmt []string, params [][]string) (int64, []*tableManager.ResponseObject, error) {
+	if xid == -1 {
+		return xid, nil, &ErrorIllegalOperation{}
+	}
+	if len(stmt) == 0 {
+		return xid, nil, &ErrorInvalidBatch{}
+	}
+	switch strings.ToUpper(stmt[0]) {
+	case "INSERT", "UPDATE", "DELETE":
+	default:
+		return xid, nil, &ErrorInvalidBatch{}
+	}
+	count := countPlaceholders(stmt)
+	for _, param := range params {
+		if len(param) != count {
+			return xid, nil, &ErrorInvalidBatch{}
+		}
+	}
+	db.storageEngine.BeginBatch(xid)
+	defer db.storageEngine.EndBatch(xid)
+	var response []*tableManager.ResponseObject
+	for _, param := range params {
+		_, ret, err := db.ExecuteSession(session, xid, bindParams(stmt, param))
+		if err != nil {
+			return xid, nil, err
+		}
+		response = mergeResponse(response, ret)
+	}
+	return xid, response, nil
+}
+
+func countPlaceholders(stmt []string) int {
+	count := 0
+	for _, token := range stmt {
+		if token == Placeholder {
+			count += 1
+		}
+	}
+	return count
+}
+
+// bindParams 按顺序将占位符替换为参数
+func bindParams(stmt, param []string) []string {
+	args := make([]string, len(stmt))
+	next := 0
+	for i, token := range stmt {
+		if token == Placeholder {
+			args[i] = param[next]
+			next += 1
+		} else {
+			args[i] = token
+		}
+	}
+	return args
+}
+
+// mergeResponse 将ret的数据行追加到response之后, 只保留第一个标题行
+func mergeResponse(response, ret []*tableManager.ResponseObject) []*tableManager.ResponseObject {
+	if len(ret) == 0 {
+		return response
+	}
+	if len(response) == 0 {
+		return ret
+	}
+	offset := response[len(response)-1].RowId
+	for _, obj := range ret {
+		if obj.RowId == 0 {
+			continue
+		}
+		response = append(response, &tableManager.ResponseObject{
+			Payload: obj.Payload,
+			RowId:   obj.RowId + offset,
+			ColId:   obj.ColId,
+		})
+	}
+	return response
+}
@@ -0,0 +1,208 @@
+package executor
+
+import (
+	"bufio"
+	"errors"
+	"hash/crc32"
+	"io"
+	"myDB/tableManager"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 批量导入
+// load <table> from <file> [batch <n>]
+// 文件每行为一行数据, 字段值(不包括主键)以制表符分隔, 行按文件中的顺序导入
+// 每批n行在独立的事物中导入(日志只刷盘一次), 同一个事物中在系统表sys_bulk_loads记录进度: 已经导入的文件偏移, 行数以及这段文件的CRC32
+// 导入中断(出错或者崩溃)之后再次执行同一条语句从记录的偏移继续, 继续之前校验文件前缀的CRC32, 文件被修改过时返回ErrorBulkLoadSourceChanged
+// 全部导入之后删除进度; 不能在事物中执行
+
+const (
+	BulkLoadTable        string = "sys_bulk_loads"
+	DefaultBulkLoadBatch        = 1000
+)
+
+type ErrorBulkLoadSourceChanged struct{}
+
+func (err *ErrorBulkLoadSourceChanged) Error() string {
+	return "Input file has changed since the interrupted bulk load"
+}
+
+type BulkLoad struct {
+	TbName string
+	File   string
+	Batch  int
+}
+
+// bulkProgress 已经导入的文件前缀
+type bulkProgress struct {
+	offset   int64
+	rows     int64
+	checksum uint32
+}
+
+// parseBulkLoad args[0] == LOAD
+func parseBulkLoad(args []string) (*BulkLoad, error) {
+	if (len(args) != 4 && len(args) != 6) || strings.ToUpper(args[2]) != "FROM" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	load := &BulkLoad{TbName: args[1], File: args[3], Batch: DefaultBulkLoadBatch}
+	if len(args) == 6 {
+		n, err := strconv.Atoi(args[5])
+		if strings.ToUpper(args[4]) != "BATCH" || err != nil || n <= 0 {
+			return nil, &ErrorInvalidEntity{}
+		}
+		load.Batch = n
+	}
+	return load, nil
+}
+
+// bulkLoad 返回本次导入的行数以及继续导入时之前已经导入的行数
+func (db *NtDB) bulkLoad(session *Session, xid int64, load *BulkLoad) ([]*tableManager.ResponseObject, error) {
+	if xid != -1 {
+		return nil, &ErrorIllegalOperation{}
+	}
+	name, err := db.resolveTable(session.Database, load.TbName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(load.File)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	job := name + " " + load.File
+	progress, err := db.readBulkProgress(job)
+	if err != nil {
+		return nil, err
+	}
+	resumed := progress.rows
+	// 校验已经导入的部分没有被修改
+	prefix := crc32.NewIEEE()
+	if _, err := io.CopyN(prefix, file, progress.offset); err != nil || prefix.Sum32() != progress.checksum {
+		return nil, &ErrorBulkLoadSourceChanged{}
+	}
+	reader := bufio.NewReader(file)
+	for done := false; !done; {
+		rows := make([][]string, 0, load.Batch)
+		consumed := int64(0)
+		checksum := progress.checksum
+		for len(rows) < load.Batch {
+			line, err := reader.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			consumed += int64(len(line))
+			checksum = crc32.Update(checksum, crc32.IEEETable, []byte(line))
+			if line = strings.TrimRight(line, "\r\n"); line != "" {
+				rows = append(rows, strings.Split(line, "\t"))
+			}
+			if err != nil {
+				done = true
+				break
+			}
+		}
+		next := &bulkProgress{offset: progress.offset + consumed, rows: progress.rows + int64(len(rows)), checksum: checksum}
+		if err := db.loadBatch(name, job, rows, next, done); err != nil {
+			return nil, err
+		}
+		progress = next
+	}
+	return []*tableManager.ResponseObject{
+		{Payload: "table", RowId: 0, ColId: 0},
+		{Payload: "rows", RowId: 0, ColId: 1},
+		{Payload: "resumed", RowId: 0, ColId: 2},
+		{Payload: load.TbName, RowId: 1, ColId: 0},
+		{Payload: strconv.FormatInt(progress.rows-resumed, 10), RowId: 1, ColId: 1},
+		{Payload: strconv.FormatInt(resumed, 10), RowId: 1, ColId: 2},
+	}, nil
+}
+
+// loadBatch 在独立的事物中导入一批行并记录进度, 最后一批删除进度
+func (db *NtDB) loadBatch(name, job string, rows [][]string, progress *bulkProgress, done bool) error {
+	xid := db.storageEngine.Begin()
+	db.storageEngine.BeginBatch(xid)
+	err := db.doLoadBatch(xid, name, job, rows, progress, done)
+	db.storageEngine.EndBatch(xid)
+	if err != nil {
+		db.storageEngine.Abort(xid)
+		db.results.discard(xid)
+		db.commitHooks.discard(xid)
+		return err
+	}
+	db.storageEngine.Commit(xid)
+	db.results.commit(xid)
+	db.commitHooks.commit(xid)
+	return nil
+}
+
+func (db *NtDB) doLoadBatch(xid int64, name, job string, rows [][]string, progress *bulkProgress, done bool) error {
+	if len(rows) > 0 {
+		if _, err := db.storageEngine.BulkInsert(xid, name, rows); err != nil {
+			return err
+		}
+	}
+	if !db.hasSystemTable(xid, BulkLoadTable) {
+		create := &tableManager.Create{
+			TbName: BulkLoadTable,
+			Fields: []*tableManager.FieldCreate{
+				{FName: "job", FType: "string"},
+				{FName: "offset", FType: "int64"},
+				{FName: "rows", FType: "int64"},
+				{FName: "checksum", FType: "int64"},
+			},
+		}
+		if err := db.storageEngine.Create(xid, create); err != nil {
+			return err
+		}
+	}
+	del := &tableManager.Delete{
+		TName: BulkLoadTable,
+		Where: &tableManager.Where{Compare: &tableManager.Compare{FieldName: "job", CompareTo: "=", Value: job}},
+	}
+	if _, err := db.storageEngine.Delete(xid, del); err != nil {
+		return err
+	}
+	if done {
+		return nil
+	}
+	insert := &tableManager.Insert{TbName: BulkLoadTable, Values: []string{
+		job,
+		strconv.FormatInt(progress.offset, 10),
+		strconv.FormatInt(progress.rows, 10),
+		strconv.FormatInt(int64(progress.checksum), 10),
+	}}
+	_, err := db.storageEngine.Insert(xid, insert)
+	return err
+}
+
+// readBulkProgress 没有进度时从文件开头导入
+func (db *NtDB) readBulkProgress(job string) (*bulkProgress, error) {
+	xid := db.storageEngine.Begin()
+	defer db.storageEngine.Commit(xid)
+	progress := &bulkProgress{}
+	if !db.hasSystemTable(xid, BulkLoadTable) {
+		return progress, nil
+	}
+	sel := &tableManager.Select{
+		TbName: BulkLoadTable,
+		FNames: []string{"offset", "rows", "checksum"},
+		Where:  &tableManager.Where{Compare: &tableManager.Compare{FieldName: "job", CompareTo: "=", Value: job}},
+	}
+	res, err := db.storageEngine.Select(xid, sel)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]int64, 0, 3)
+	for _, obj := range res {
+		if obj.RowId != 0 {
+			v, _ := strconv.ParseInt(obj.Payload, 10, 64)
+			values = append(values, v)
+		}
+	}
+	if len(values) == 3 {
+		progress.offset, progress.rows, progress.checksum = values[0], values[1], uint32(values[2])
+	}
+	return progress, nil
+}
@@ -0,0 +1,163 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// 提交钩子
+// 嵌入式使用时, 应用注册的钩子在每个修改过表的事物提交之后收到该事物修改的表, 用于精确地使应用自己的缓存失效, 不需要解析变更流
+// 修改来自变更流(tableManager/changeStream.go): insert, update, delete, flashback, 计数器以及批量导入; swap报告为整表修改
+// 注册时keys为true的钩子同时收到每个表被修改的行的主键(ID, 去重并升序), 不需要主键的钩子不承担这部分开销
+// 钩子在提交返回之前按注册顺序同步调用, 应当尽快返回; 回滚的事物以及没有修改任何表的事物不报告
+// 只记录注册之后的修改, 之前开始的事物可能只报告一部分表; 记录时没有钩子要求主键的修改对要求主键的钩子报告为整表修改
+
+type TableChange struct {
+	Table string  // 目录中的表名
+	Keys  []int64 // 被修改的行的主键, 钩子不要求主键或者整表修改时为nil
+	All   bool    // 整张表的内容都可能改变(swap)
+}
+
+type CommitChanges struct {
+	Xid    int64
+	Tables []*TableChange // 按表名排序
+}
+
+type CommitHook func(changes *CommitChanges)
+
+type commitHookEntry struct {
+	hook CommitHook
+	keys bool
+}
+
+type pendingTable struct {
+	keys    map[int64]struct{}
+	all     bool
+	partial bool // 有的修改没有记录主键(当时没有钩子要求主键), 对要求主键的钩子报告为整表修改
+}
+
+type commitHooks struct {
+	lock    sync.Mutex
+	hooks   []*commitHookEntry
+	pending map[int64]map[string]*pendingTable // xid -> 表名 -> 修改
+}
+
+func newCommitHooks() *commitHooks {
+	return &commitHooks{pending: map[int64]map[string]*pendingTable{}}
+}
+
+// OnCommit 注册提交钩子, 返回注销钩子的函数
+func (db *NtDB) OnCommit(hook CommitHook, keys bool) func() {
+	h := db.commitHooks
+	entry := &commitHookEntry{hook: hook, keys: keys}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.hooks = append(h.hooks, entry)
+	return func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		for i, e := range h.hooks {
+			if e == entry {
+				h.hooks = append(h.hooks[:i:i], h.hooks[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// capture 变更流的sink, 没有值的变更(swap)为整表修改
+func (h *commitHooks) capture(change *tableManager.Change) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.hooks) == 0 {
+		return
+	}
+	tables := h.pending[change.Xid]
+	if tables == nil {
+		tables = map[string]*pendingTable{}
+		h.pending[change.Xid] = tables
+	}
+	table := tables[change.TbName]
+	if table == nil {
+		table = &pendingTable{}
+		tables[change.TbName] = table
+	}
+	if table.all {
+		return
+	}
+	if !h.wantKeys() {
+		table.partial = true
+		return
+	}
+	values := change.New
+	if values == nil {
+		values = change.Old
+	}
+	if len(values) == 0 {
+		table.all, table.keys = true, nil
+		return
+	}
+	key, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		table.all, table.keys = true, nil
+		return
+	}
+	if table.keys == nil {
+		table.keys = map[int64]struct{}{}
+	}
+	table.keys[key] = struct{}{}
+}
+
+// wantKeys 是否有钩子要求主键, 必须持有锁
+func (h *commitHooks) wantKeys() bool {
+	for _, e := range h.hooks {
+		if e.keys {
+			return true
+		}
+	}
+	return false
+}
+
+// commit xid提交之后调用钩子
+func (h *commitHooks) commit(xid int64) {
+	h.lock.Lock()
+	tables := h.pending[xid]
+	delete(h.pending, xid)
+	hooks := append([]*commitHookEntry(nil), h.hooks...)
+	h.lock.Unlock()
+	if len(tables) == 0 || len(hooks) == 0 {
+		return
+	}
+	withKeys := &CommitChanges{Xid: xid}
+	withoutKeys := &CommitChanges{Xid: xid}
+	for name, table := range tables {
+		change := &TableChange{Table: name, All: table.all || table.partial}
+		if !change.All && len(table.keys) > 0 {
+			change.Keys = make([]int64, 0, len(table.keys))
+			for key := range table.keys {
+				change.Keys = append(change.Keys, key)
+			}
+			sort.Slice(change.Keys, func(i, j int) bool { return change.Keys[i] < change.Keys[j] })
+		}
+		withKeys.Tables = append(withKeys.Tables, change)
+		withoutKeys.Tables = append(withoutKeys.Tables, &TableChange{Table: name, All: table.all})
+	}
+	for _, changes := range []*CommitChanges{withKeys, withoutKeys} {
+		sort.Slice(changes.Tables, func(i, j int) bool { return changes.Tables[i].Table < changes.Tables[j].Table })
+	}
+	for _, e := range hooks {
+		if e.keys {
+			e.hook(withKeys)
+		} else {
+			e.hook(withoutKeys)
+		}
+	}
+}
+
+func (h *commitHooks) discard(xid int64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.pending, xid)
+}
@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"myDB/exporter"
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// COPY 将表或查询结果导出为Parquet文件
+// copy <table> to <file> [rowgroup <n>]
+// copy ( select ... ) to <file> [rowgroup <n>]
+// 列类型: INT32 -> INT32, INT64 -> INT64, JSON -> BYTE_ARRAY(JSON), 其他 -> BYTE_ARRAY(UTF8)
+
+type Copy struct {
+	TbName       string   // 导出整张表
+	Query        []string // 导出查询结果
+	File         string
+	RowGroupSize int // 每个RowGroup的行数, 0表示默认值
+}
+
+type ErrorInvalidCopy struct{}
+
+func (err *ErrorInvalidCopy) Error() string {
+	return "Invalid copy statement"
+}
+
+// parseCopy args[0] == COPY
+func parseCopy(args []string) (*Copy, error) {
+	cp := &Copy{}
+	pos := 1
+	if len(args) > 1 && args[1] == "(" {
+		end := -1
+		for i := len(args) - 1; i > 1; i-- {
+			if args[i] == ")" {
+				end = i
+				break
+			}
+		}
+		if end == -1 || end == 2 {
+			return nil, &ErrorInvalidCopy{}
+		}
+		cp.Query = args[2:end]
+		pos = end + 1
+	} else if len(args) > 1 {
+		cp.TbName = args[1]
+		pos = 2
+	}
+	rest := args[pos:]
+	if (len(rest) != 2 && len(rest) != 4) || strings.ToUpper(rest[0]) != "TO" {
+		return nil, &ErrorInvalidCopy{}
+	}
+	cp.File = rest[1]
+	if len(rest) == 4 {
+		n, err := strconv.Atoi(rest[3])
+		if strings.ToUpper(rest[2]) != "ROWGROUP" || err != nil || n <= 0 {
+			return nil, &ErrorInvalidCopy{}
+		}
+		cp.RowGroupSize = n
+	}
+	return cp, nil
+}
+
+// copyToParquet 查询结果在内存中物化之后写入文件
+func (db *NtDB) copyToParquet(session *Session, xid int64, cp *Copy) error {
+	query := cp.Query
+	if query == nil {
+		name, err := db.resolveTable(session.Database, cp.TbName)
+		if err != nil {
+			return err
+		}
+		fields, err := db.storageEngine.Describe(xid, name)
+		if err != nil {
+			return err
+		}
+		query = []string{"select"}
+		for _, f := range fields {
+			query = append(query, f.GetName())
+		}
+		query = append(query, "from", cp.TbName)
+	}
+	if sel, ok := db.parseSelect(query); !ok || isWindowQuery(sel.FNames) {
+		return &ErrorInvalidCopy{}
+	}
+	rel, err := db.selectToRelation(session, xid, query, map[string]*relation{})
+	if err != nil {
+		return err
+	}
+	columns := make([]*exporter.Column, len(rel.columns))
+	for i, name := range rel.columns {
+		columns[i] = exportColumn(name, rel.types[i])
+	}
+	writer, err := exporter.NewParquetWriter(cp.File, columns, cp.RowGroupSize)
+	if err != nil {
+		return err
+	}
+	for _, row := range rel.rows {
+		if err := writer.Write(row); err != nil {
+			_ = writer.Close()
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func exportColumn(name string, fType tableManager.FieldType) *exporter.Column {
+	switch fType {
+	case tableManager.INT32:
+		return &exporter.Column{Name: name, Type: exporter.Int32, Converted: exporter.ConvertedNone}
+	case tableManager.INT64:
+		return &exporter.Column{Name: name, Type: exporter.Int64, Converted: exporter.ConvertedNone}
+	case tableManager.JSON:
+		return &exporter.Column{Name: name, Type: exporter.ByteArray, Converted: exporter.ConvertedJson}
+	default:
+		return &exporter.Column{Name: name, Type: exporter.ByteArray, Converted: exporter.ConvertedUtf8}
+	}
+}
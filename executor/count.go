@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+)
+
+// 行数
+// select count(*) from <table>
+// approximate_count为off时在当前事物中扫描表的主键计数(精确)
+// 为on时返回表的近似行数(见tableManager/rowCount.go), 不扫描表, 也不需要事物; 包括当前事物未提交的插入和删除
+// 外部表总是返回文件中的行数
+
+const VarApproximateCount string = "approximate_count"
+
+type CountRows struct {
+	TbName string
+}
+
+func (db *NtDB) countRows(session *Session, xid int64, count *CountRows) ([]*tableManager.ResponseObject, error) {
+	var n int64
+	if ft := db.foreign.get(count.TbName); ft != nil {
+		rel, err := ft.scan()
+		if err != nil {
+			return nil, err
+		}
+		n = int64(len(rel.rows))
+	} else if db.variable(session, VarApproximateCount) == "on" {
+		var err error
+		if n, err = db.storageEngine.EstimateRows(xid, count.TbName); err != nil {
+			return nil, err
+		}
+	} else {
+		if xid == -1 {
+			return nil, &ErrorIllegalOperation{}
+		}
+		rows, err := db.storageEngine.Select(xid, &tableManager.Select{
+			TbName: count.TbName,
+			FNames: []string{tableManager.PrimaryKeyCol},
+			Where:  &tableManager.Where{},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if row.RowId > 0 {
+				n++
+			}
+		}
+	}
+	return []*tableManager.ResponseObject{
+		{Payload: "count", RowId: 0, ColId: 0},
+		{Payload: strconv.FormatInt(n, 10), RowId: 1, ColId: 0},
+	}, nil
+}
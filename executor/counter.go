@@ -0,0 +1,250 @@
+package executor
+
+import (
+	"errors"
+	"myDB/storageEngine"
+	"myDB/tableManager"
+	"myDB/versionManager"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 热点行计数器
+// increment <table> <field> [by <n>] [where <field> <op> <value>]
+// 计数器(点赞数, 库存等)的增量更新, 并发的普通update在表锁上排队, 每个事物持有表锁直到提交, 形成护航
+// increment不属于当前事物: 同一个表的增量请求进入队列, 队首的请求成为leader, 取出队列中所有请求作为一批,
+// 在一个独立的事物中只获取一次表锁, 按请求顺序合并每一行的增量, 每一行只写一次, 提交之后唤醒这一批的所有请求
+// leader执行期间到达的请求组成下一批, 由其中第一个请求继续执行; 请求的条件按批次开始时的值判断
+// 每个请求返回匹配的行(ID, 字段)在它的增量之后的值; 增量提交之后立即生效, 当前事物回滚时不撤销(与序列相同)
+// 字段必须是整数类型; 某个请求的条件或字段无效时只有这个请求失败, 写入或提交失败时整批失败
+// 批次的事物等待表锁的时间不超过会话的lock_timeout(为0时为CounterLockTimeout), 避免与持有表锁的当前事物互相等待
+
+const CounterLockTimeout = 10 * time.Second
+
+type ErrorInvalidCounter struct{}
+
+func (err *ErrorInvalidCounter) Error() string {
+	return "Counter field must be an integer"
+}
+
+type Increment struct {
+	TbName string
+	FName  string
+	Delta  int64
+	Where  *tableManager.Where // nil则更新所有行
+}
+
+type incrementRequest struct {
+	inc  *Increment
+	lead chan bool // true: 成为下一批的leader, false: 已经完成
+	res  []*tableManager.ResponseObject
+	err  error
+}
+
+type counterQueue struct {
+	pending []*incrementRequest
+	running bool
+}
+
+// counterBatcher 表 -> 增量请求队列
+type counterBatcher struct {
+	lock       sync.Mutex
+	queues     map[string]*counterQueue
+	increments int64
+	batches    int64
+}
+
+func newCounterBatcher() *counterBatcher {
+	return &counterBatcher{queues: map[string]*counterQueue{}}
+}
+
+// join 加入队列, 队列空闲时返回true, 调用者成为leader
+func (b *counterBatcher) join(req *incrementRequest) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.increments += 1
+	queue := b.queues[req.inc.TbName]
+	if queue == nil {
+		queue = &counterQueue{}
+		b.queues[req.inc.TbName] = queue
+	}
+	queue.pending = append(queue.pending, req)
+	if queue.running {
+		return false
+	}
+	queue.running = true
+	return true
+}
+
+// take 取出队列中的所有请求
+func (b *counterBatcher) take(tbName string) []*incrementRequest {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.batches += 1
+	queue := b.queues[tbName]
+	batch := queue.pending
+	queue.pending = nil
+	return batch
+}
+
+// handoff 一批执行完成之后, 由下一批的第一个请求继续执行, 没有请求时队列空闲
+func (b *counterBatcher) handoff(tbName string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	queue := b.queues[tbName]
+	if len(queue.pending) == 0 {
+		delete(b.queues, tbName)
+		return
+	}
+	queue.pending[0].lead <- true
+}
+
+func (b *counterBatcher) metrics() []storageEngine.Metric {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return []storageEngine.Metric{
+		{Name: "counter_increments", Value: b.increments},
+		{Name: "counter_batches", Value: b.batches},
+	}
+}
+
+// parseIncrement increment <table> <field> [by <n>] [where <field> <op> <value>]
+func parseIncrement(args []string) (*Increment, error) {
+	if len(args) < 3 {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	inc := &Increment{TbName: args[1], FName: args[2], Delta: 1}
+	args = args[3:]
+	if len(args) >= 2 && strings.ToUpper(args[0]) == "BY" {
+		delta, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, &ErrorInvalidEntity{}
+		}
+		inc.Delta = delta
+		args = args[2:]
+	}
+	if len(args) == 4 && strings.ToUpper(args[0]) == "WHERE" {
+		inc.Where = &tableManager.Where{Compare: &tableManager.Compare{FieldName: args[1], CompareTo: args[2], Value: args[3]}}
+		args = args[4:]
+	}
+	if len(args) != 0 {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	return inc, nil
+}
+
+// increment 加入表的队列, 等待所在的批次提交
+func (db *NtDB) increment(session *Session, inc *Increment) ([]*tableManager.ResponseObject, error) {
+	if db.isView(inc.TbName) {
+		return nil, &ErrorModifyView{}
+	}
+	if inc.FName == tableManager.PrimaryKeyCol {
+		return nil, &ErrorInvalidCounter{}
+	}
+	req := &incrementRequest{inc: inc, lead: make(chan bool, 1)}
+	lead := db.counters.join(req)
+	if !lead {
+		lead = <-req.lead
+	}
+	if lead {
+		db.applyIncrements(session, db.counters.take(inc.TbName))
+		db.counters.handoff(inc.TbName)
+	}
+	return req.res, req.err
+}
+
+// applyIncrements 在一个独立的事物中执行一批增量, 完成之后唤醒除自己之外的请求
+func (db *NtDB) applyIncrements(session *Session, batch []*incrementRequest) {
+	opts := db.transactionOptions(session)
+	if opts.LockTimeout == 0 {
+		opts.LockTimeout = CounterLockTimeout
+	}
+	xid := db.storageEngine.BeginWith(opts)
+	err := db.mergeIncrements(xid, batch)
+	if err == nil {
+		err = db.commit(xid)
+	} else {
+		db.abort(xid)
+	}
+	for i, req := range batch {
+		if err != nil {
+			req.res, req.err = nil, err
+		}
+		if i > 0 {
+			req.lead <- false
+		}
+	}
+}
+
+// mergeIncrements 按请求顺序合并每一行每个字段的增量, 最后每个字段只更新一次
+func (db *NtDB) mergeIncrements(xid int64, batch []*incrementRequest) error {
+	type cell struct {
+		id    string
+		field string
+	}
+	values := map[cell]int64{}
+	cells := make([]cell, 0)
+	for _, req := range batch {
+		sel := &tableManager.Select{
+			TbName:        req.inc.TbName,
+			FNames:        []string{tableManager.PrimaryKeyCol, req.inc.FName},
+			ReadForUpdate: true,
+			Where:         req.inc.Where,
+		}
+		rows, err := db.storageEngine.Select(xid, sel)
+		if err != nil {
+			// 等待表锁超时或者死锁时事物已经回滚
+			var timeout *versionManager.ErrorLockTimeout
+			var deadlock *versionManager.DeadLockError
+			if errors.As(err, &timeout) || errors.As(err, &deadlock) {
+				return err
+			}
+			req.err = err
+			continue
+		}
+		// 结果按行排列, 每行为ID以及字段的值
+		res, current := rows[:2:2], make([]int64, 0, len(rows)/2)
+		for i := 2; i+1 < len(rows); i += 2 {
+			value, err := strconv.ParseInt(rows[i+1].Payload, 10, 64)
+			if err != nil {
+				req.err = &ErrorInvalidCounter{}
+				break
+			}
+			current = append(current, value)
+		}
+		if req.err != nil {
+			continue
+		}
+		for i, value := range current {
+			id := rows[2*i+2]
+			c := cell{id: id.Payload, field: req.inc.FName}
+			if merged, ext := values[c]; ext {
+				value = merged
+			} else {
+				cells = append(cells, c)
+			}
+			value += req.inc.Delta
+			values[c] = value
+			res = append(res, id, &tableManager.ResponseObject{Payload: strconv.FormatInt(value, 10), RowId: id.RowId, ColId: 1})
+		}
+		req.res = res
+	}
+	tbName := batch[0].inc.TbName
+	for _, c := range cells {
+		upd := &tableManager.Update{
+			TName:    tbName,
+			FName:    c.field,
+			ToUpdate: strconv.FormatInt(values[c], 10),
+			Where:    &tableManager.Where{Compare: &tableManager.Compare{FieldName: tableManager.PrimaryKeyCol, CompareTo: "=", Value: c.id}},
+		}
+		if _, err := db.storageEngine.Update(xid, upd); err != nil {
+			return err
+		}
+	}
+	if len(cells) > 0 {
+		db.notifyTable(xid, tbName, "update")
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 公用表表达式(CTE)
+// with [recursive] <name> as [materialized|not materialized] ( <select> [union [all] <select>] ) [, <name> as (...)] <select>
+// 1. 物化：CTE的查询只执行一次，结果保存在内存中，之后的CTE以及主查询可以 select ... from <name>
+// 2. 内联：只有一个非递归CTE，其查询为单表的普通查询，并且与主查询最多只有一个where子句时，
+//    主查询被改写为对基表的查询，不进行物化(materialized可以强制物化)
+// 3. 递归：union之后的递归查询通过 where <field> = <name>.<column> 引用上一轮的结果，
+//    对上一轮的每一行执行一次递归查询，直到没有新的行
+//    union 会去掉已经出现过的行(可以处理环)，union all 不去重，超过MaxCteIterations轮时报错
+
+const MaxCteIterations int = 100
+
+type With struct {
+	Recursive bool
+	Ctes      []*Cte
+	Query     []string // 主查询
+}
+
+type Cte struct {
+	Name         string
+	Materialized int      // 0 由执行器决定 1 强制物化 -1 尽量内联
+	Anchor       []string // 非递归部分
+	Recursive    []string // union之后的部分, nil表示没有
+	UnionAll     bool
+}
+
+type ErrorInvalidCte struct{}
+type ErrorCteRecursionLimit struct{}
+
+func (err *ErrorInvalidCte) Error() string {
+	return "Invalid common table expression"
+}
+
+func (err *ErrorCteRecursionLimit) Error() string {
+	return "Recursive query exceeds the max iterations"
+}
+
+// relation 物化的CTE, 也用于外部表(见foreignTable.go)以及join的输入
+type relation struct {
+	columns []string
+	types   []tableManager.FieldType // INVALID 表示类型未知
+	rows    [][]string
+}
+
+// parseWith args[0] == WITH
+func parseWith(args []string) (*With, error) {
+	with := &With{Ctes: make([]*Cte, 0)}
+	pos := 1
+	upper := func(i int) string {
+		if i < len(args) {
+			return strings.ToUpper(args[i])
+		}
+		return ""
+	}
+	if upper(pos) == "RECURSIVE" {
+		with.Recursive = true
+		pos += 1
+	}
+	for {
+		if pos >= len(args) || upper(pos+1) != "AS" {
+			return nil, &ErrorInvalidCte{}
+		}
+		cte := &Cte{Name: args[pos]}
+		pos += 2
+		if upper(pos) == "MATERIALIZED" {
+			cte.Materialized = 1
+			pos += 1
+		} else if upper(pos) == "NOT" && upper(pos+1) == "MATERIALIZED" {
+			cte.Materialized = -1
+			pos += 2
+		}
+		if upper(pos) != "(" {
+			return nil, &ErrorInvalidCte{}
+		}
+		// 匹配括号
+		depth, end := 0, -1
+		for i := pos; i < len(args) && end == -1; i++ {
+			if args[i] == "(" {
+				depth += 1
+			} else if args[i] == ")" {
+				if depth -= 1; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end == -1 {
+			return nil, &ErrorInvalidCte{}
+		}
+		body := args[pos+1 : end]
+		cte.Anchor = body
+		for i, token := range body {
+			if strings.ToUpper(token) == "UNION" {
+				cte.Anchor = body[:i]
+				cte.Recursive = body[i+1:]
+				if len(cte.Recursive) > 0 && strings.ToUpper(cte.Recursive[0]) == "ALL" {
+					cte.UnionAll = true
+					cte.Recursive = cte.Recursive[1:]
+				}
+				break
+			}
+		}
+		if len(cte.Anchor) == 0 || (cte.Recursive != nil && len(cte.Recursive) == 0) {
+			return nil, &ErrorInvalidCte{}
+		}
+		with.Ctes = append(with.Ctes, cte)
+		pos = end + 1
+		if pos < len(args) && args[pos] == "," {
+			pos += 1
+			continue
+		}
+		break
+	}
+	with.Query = args[pos:]
+	if len(with.Query) == 0 || strings.ToUpper(with.Query[0]) != "SELECT" {
+		return nil, &ErrorInvalidCte{}
+	}
+	return with, nil
+}
+
+// executeWith
+func (db *NtDB) executeWith(session *Session, xid int64, with *With) ([]*tableManager.ResponseObject, error) {
+	if query, ok := db.inlineWith(with); ok {
+		_, ret, err := db.ExecuteSession(session, xid, query)
+		return ret, err
+	}
+	relations := make(map[string]*relation, len(with.Ctes))
+	for _, cte := range with.Ctes {
+		if _, ext := relations[cte.Name]; ext {
+			return nil, &ErrorInvalidCte{}
+		}
+		rel, err := db.materialize(session, xid, cte, with.Recursive, relations)
+		if err != nil {
+			return nil, err
+		}
+		relations[cte.Name] = rel
+	}
+	return db.selectRelation(session, xid, with.Query, relations)
+}
+
+// inlineWith 尝试将主查询改写为对基表的查询
+func (db *NtDB) inlineWith(with *With) ([]string, bool) {
+	if len(with.Ctes) != 1 || with.Recursive {
+		return nil, false
+	}
+	cte := with.Ctes[0]
+	if cte.Materialized == 1 || cte.Recursive != nil {
+		return nil, false
+	}
+	body, ok := db.parseSelect(cte.Anchor)
+	if !ok || isWindowQuery(body.FNames) || body.TbName == cte.Name {
+		return nil, false
+	}
+	main, ok := db.parseSelect(with.Query)
+	if !ok || main.TbName != cte.Name || isWindowQuery(main.FNames) {
+		return nil, false
+	}
+	hasWhere := func(sel *tableManager.Select) bool { return sel.Where != nil && sel.Where.Compare != nil }
+	if hasWhere(body) && hasWhere(main) {
+		return nil, false
+	}
+	columns := make(map[string]struct{}, len(body.FNames))
+	for _, f := range body.FNames {
+		columns[f] = struct{}{}
+	}
+	for _, f := range main.FNames {
+		if _, ext := columns[f]; !ext {
+			return nil, false
+		}
+	}
+	query := append([]string{"SELECT"}, main.FNames...)
+	query = append(query, "FROM", body.TbName)
+	where := main.Where
+	if hasWhere(body) {
+		where = body.Where
+	}
+	if hasWhere(&tableManager.Select{Where: where}) {
+		query = append(query, "WHERE", where.Compare.FieldName, where.Compare.CompareTo, where.Compare.Value)
+	}
+	return query, true
+}
+
+// materialize 执行CTE的查询并保存结果
+func (db *NtDB) materialize(session *Session, xid int64, cte *Cte, recursive bool, relations map[string]*relation) (*relation, error) {
+	rel, err := db.selectToRelation(session, xid, cte.Anchor, relations)
+	if err != nil {
+		return nil, err
+	}
+	if cte.Recursive == nil {
+		return rel, nil
+	}
+	if !recursive {
+		return nil, &ErrorInvalidCte{}
+	}
+	// 递归部分: where <field> = <name>.<column>
+	reference := -1
+	column := -1
+	for i, token := range cte.Recursive {
+		if strings.HasPrefix(token, cte.Name+Separator) {
+			name := strings.TrimPrefix(token, cte.Name+Separator)
+			for j, c := range rel.columns {
+				if c == name {
+					reference, column = i, j
+				}
+			}
+		}
+	}
+	if reference == -1 {
+		return nil, &ErrorInvalidCte{}
+	}
+	// 物化的结果以及去重的哈希表在语句的内存预算中占用内存
+	mem := db.queryBudget(session)
+	seen := make(map[string]struct{})
+	if !cte.UnionAll {
+		rows := make([][]string, 0, len(rel.rows))
+		for _, row := range rel.rows {
+			if key := strings.Join(row, "\x00"); !hasKey(seen, key) {
+				if err := reserveRow(mem, row); err != nil {
+					return nil, err
+				}
+				seen[key] = struct{}{}
+				rows = append(rows, row)
+			}
+		}
+		rel.rows = rows
+	}
+	working := rel.rows
+	for iteration := 0; len(working) > 0; iteration++ {
+		if iteration >= MaxCteIterations {
+			return nil, &ErrorCteRecursionLimit{}
+		}
+		next := make([][]string, 0)
+		for _, row := range working {
+			query := append([]string{}, cte.Recursive...)
+			query[reference] = row[column]
+			res, err := db.selectToRelation(session, xid, query, relations)
+			if err != nil {
+				return nil, err
+			}
+			if len(res.columns) != len(rel.columns) {
+				return nil, &ErrorInvalidCte{}
+			}
+			for _, r := range res.rows {
+				if !cte.UnionAll {
+					key := strings.Join(r, "\x00")
+					if hasKey(seen, key) {
+						continue
+					}
+					seen[key] = struct{}{}
+				}
+				if err := reserveRow(mem, r); err != nil {
+					return nil, err
+				}
+				next = append(next, r)
+			}
+		}
+		rel.rows = append(rel.rows, next...)
+		working = next
+	}
+	return rel, nil
+}
+
+func hasKey(m map[string]struct{}, key string) bool {
+	_, ext := m[key]
+	return ext
+}
+
+// selectToRelation 执行一个select(基表或者已经物化的CTE), 结果转换为relation
+func (db *NtDB) selectToRelation(session *Session, xid int64, query []string, relations map[string]*relation) (*relation, error) {
+	res, err := db.selectRelation(session, xid, query, relations)
+	if err != nil {
+		return nil, err
+	}
+	rel := responseRelation(res)
+	// 基表字段的类型
+	if sel, ok := db.parseSelect(query); ok {
+		if _, ext := relations[sel.TbName]; ext {
+			source := relations[sel.TbName]
+			for i, c := range rel.columns {
+				for j, s := range source.columns {
+					if c == s {
+						rel.types[i] = source.types[j]
+					}
+				}
+			}
+		} else if name, err := db.resolveTable(session.Database, sel.TbName); err == nil {
+			if ft := db.foreign.get(name); ft != nil {
+				for i, c := range rel.columns {
+					for j, s := range ft.columns {
+						if c == s {
+							rel.types[i] = ft.types[j]
+						}
+					}
+				}
+			} else if fields, err := db.storageEngine.Describe(xid, name); err == nil {
+				for i, c := range rel.columns {
+					for _, f := range fields {
+						if f.GetName() == c {
+							rel.types[i] = f.GetFType()
+						}
+					}
+				}
+			}
+		}
+	}
+	return rel, nil
+}
+
+// responseRelation 将select的结果转换为relation, 类型未知
+func responseRelation(res []*tableManager.ResponseObject) *relation {
+	rel := &relation{columns: make([]string, 0), rows: make([][]string, 0)}
+	for _, r := range res {
+		if r.RowId == 0 {
+			rel.columns = append(rel.columns, r.Payload)
+			continue
+		}
+		if r.RowId > len(rel.rows) {
+			rel.rows = append(rel.rows, make([]string, len(rel.columns)))
+		}
+		rel.rows[r.RowId-1][r.ColId] = r.Payload
+	}
+	rel.types = make([]tableManager.FieldType, len(rel.columns))
+	return rel
+}
+
+// selectRelation 执行一个select, from 已经物化的CTE时在内存中执行
+func (db *NtDB) selectRelation(session *Session, xid int64, query []string, relations map[string]*relation) ([]*tableManager.ResponseObject, error) {
+	sel, ok := db.parseSelect(query)
+	if !ok {
+		return nil, &ErrorInvalidCte{}
+	}
+	rel, ext := relations[sel.TbName]
+	if !ext {
+		_, ret, err := db.ExecuteSession(session, xid, query)
+		return ret, err
+	}
+	if isWindowQuery(sel.FNames) {
+		return nil, &ErrorInvalidCte{}
+	}
+	return scanRelation(rel, sel)
+}
+
+// scanRelation 在内存中对relation执行select
+func scanRelation(rel *relation, sel *tableManager.Select) ([]*tableManager.ResponseObject, error) {
+	var ext bool
+	index := make(map[string]int, len(rel.columns))
+	for i, c := range rel.columns {
+		index[c] = i
+	}
+	target := make([]int, len(sel.FNames))
+	for i, f := range sel.FNames {
+		if target[i], ext = index[f]; !ext {
+			return nil, &tableManager.ErrorFieldNotExist{}
+		}
+	}
+	where := -1
+	if sel.Where != nil && sel.Where.Compare != nil {
+		if where, ext = index[sel.Where.Compare.FieldName]; !ext {
+			return nil, &tableManager.ErrorInvalidFieldName{}
+		}
+	}
+	ret := make([]*tableManager.ResponseObject, 0)
+	for colId, f := range sel.FNames {
+		ret = append(ret, &tableManager.ResponseObject{Payload: f, RowId: 0, ColId: colId})
+	}
+	rowId := 1
+	for _, row := range rel.rows {
+		if where != -1 && !matchCompare(compareValues(rel.types[where], row[where], sel.Where.Compare.Value), sel.Where.Compare.CompareTo) {
+			continue
+		}
+		for colId, i := range target {
+			ret = append(ret, &tableManager.ResponseObject{Payload: row[i], RowId: rowId, ColId: colId})
+		}
+		rowId += 1
+	}
+	return ret, nil
+}
+
+// parseSelect 解析select语句, 不解析表名
+func (db *NtDB) parseSelect(query []string) (*tableManager.Select, bool) {
+	cmd, entity, err := db.parser.ParseRequest(query)
+	if err != nil || cmd != SELECT {
+		return nil, false
+	}
+	sel, ok := entity[0].(*tableManager.Select)
+	return sel, ok
+}
+
+// compareValues 类型未知时，两个值都是整数则按整数比较，否则按字符串比较
+func compareValues(fType tableManager.FieldType, a, b string) int {
+	if fType == tableManager.INVALID {
+		fType = tableManager.STRING
+		if _, err := strconv.ParseInt(a, 10, 64); err == nil {
+			if _, err := strconv.ParseInt(b, 10, 64); err == nil {
+				fType = tableManager.INT64
+			}
+		}
+	}
+	return tableManager.DefaultFieldFactory.GetCompareFunction(fType)(a, b)
+}
+
+func matchCompare(c int, compareTo string) bool {
+	switch compareTo {
+	case "=":
+		return c == 0
+	case ">":
+		return c > 0
+	case "<":
+		return c < 0
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package executor
+
+import (
+	"myDB/dbError"
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 服务端游标
+// declare <name> cursor for select ... | fetch [<n>] from <name> | close <name>
+// 游标属于声明它的事物, 不能在事物之外声明, 事物提交或者回滚时关闭; 同一个事物中游标的名字不能重复
+// fetch每次读出之后最多n行(默认DefaultFetchSize), 读完之后只返回标题; 服务端只保存扫描的位置, 不物化整个结果集
+// 结果与声明时执行select相同, 不受之后其他事物提交的影响(见tableManager/cursor.go); 不支持窗口函数以及AS OF查询
+
+const DefaultFetchSize = 100
+
+type ErrorCursorAlreadyExist struct{}
+type ErrorCursorNotExist struct{}
+
+func (err *ErrorCursorAlreadyExist) Error() string {
+	return "This cursor is already declared"
+}
+
+func (err *ErrorCursorAlreadyExist) Is(target error) bool {
+	return target == dbError.ErrDuplicateKey
+}
+
+func (err *ErrorCursorNotExist) Error() string {
+	return "Cursor doesn't exist"
+}
+
+type DeclareCursor struct {
+	Name   string
+	Select *tableManager.Select
+}
+
+type FetchCursor struct {
+	Name  string
+	Count int
+}
+
+type CloseCursor struct {
+	Name string
+}
+
+// cursorRegistry 事物 -> 游标名 -> 游标
+type cursorRegistry struct {
+	lock    sync.Mutex
+	cursors map[int64]map[string]*tableManager.Cursor
+}
+
+func newCursorRegistry() *cursorRegistry {
+	return &cursorRegistry{cursors: map[int64]map[string]*tableManager.Cursor{}}
+}
+
+func (r *cursorRegistry) get(xid int64, name string) *tableManager.Cursor {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.cursors[xid][name]
+}
+
+func (r *cursorRegistry) add(xid int64, name string, cursor *tableManager.Cursor) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.cursors[xid] == nil {
+		r.cursors[xid] = map[string]*tableManager.Cursor{}
+	}
+	if _, ext := r.cursors[xid][name]; ext {
+		return false
+	}
+	r.cursors[xid][name] = cursor
+	return true
+}
+
+func (r *cursorRegistry) remove(xid int64, name string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ext := r.cursors[xid][name]; !ext {
+		return false
+	}
+	delete(r.cursors[xid], name)
+	return true
+}
+
+// closeAll 事物结束时关闭所有游标
+func (r *cursorRegistry) closeAll(xid int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.cursors, xid)
+}
+
+// parseDeclareCursor declare <name> cursor for select ...
+func (parser *TrieParser) parseDeclareCursor(args []string) (*DeclareCursor, error) {
+	if len(args) < 5 || strings.ToUpper(args[2]) != "CURSOR" || strings.ToUpper(args[3]) != "FOR" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	cmd, entity, err := parser.ParseRequest(args[4:])
+	if err != nil {
+		return nil, err
+	}
+	if cmd != SELECT {
+		return nil, &ErrorInvalidEntity{}
+	}
+	sel, ok := entity[0].(*tableManager.Select)
+	if !ok {
+		return nil, &ErrorInvalidEntity{}
+	}
+	return &DeclareCursor{Name: args[1], Select: sel}, nil
+}
+
+// parseFetchCursor fetch [<n>] from <name>
+func parseFetchCursor(args []string) (*FetchCursor, error) {
+	fetch := &FetchCursor{Count: DefaultFetchSize}
+	if len(args) == 4 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return nil, &ErrorInvalidEntity{}
+		}
+		fetch.Count = n
+		args = append(args[:1:1], args[2:]...)
+	}
+	if len(args) != 3 || strings.ToUpper(args[1]) != "FROM" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	fetch.Name = args[2]
+	return fetch, nil
+}
+
+func (db *NtDB) declareCursor(session *Session, xid int64, declare *DeclareCursor) error {
+	if xid == -1 {
+		return &ErrorIllegalOperation{}
+	}
+	if isWindowQuery(declare.Select.FNames) {
+		return &tableManager.ErrorCursorUnsupported{}
+	}
+	if err := db.resolveEntity(session.Database, declare.Select); err != nil {
+		return err
+	}
+	cursor, err := db.storageEngine.OpenCursor(xid, declare.Select)
+	if err != nil {
+		return err
+	}
+	if !db.cursors.add(xid, declare.Name, cursor) {
+		return &ErrorCursorAlreadyExist{}
+	}
+	return nil
+}
+
+func (db *NtDB) fetchCursor(xid int64, fetch *FetchCursor) ([]*tableManager.ResponseObject, error) {
+	cursor := db.cursors.get(xid, fetch.Name)
+	if cursor == nil {
+		return nil, &ErrorCursorNotExist{}
+	}
+	return db.storageEngine.Fetch(xid, cursor, fetch.Count)
+}
+
+func (db *NtDB) closeCursor(xid int64, cls *CloseCursor) error {
+	if !db.cursors.remove(xid, cls.Name) {
+		return &ErrorCursorNotExist{}
+	}
+	return nil
+}
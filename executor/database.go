@@ -0,0 +1,289 @@
+package executor
+
+import (
+	"log"
+	"myDB/dbError"
+	"myDB/tableManager"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 逻辑数据库(命名空间)
+// 同一个存储引擎中的所有表共享一个目录(catalog)和表空间, 逻辑数据库只是表名前缀
+// 默认数据库(default)中的表不带前缀，其他数据库db中的表在目录中的名字为 db.table
+// 名字解析规则：
+// 1. 带限定名的表 db.table 直接解析到数据库db(跨库访问)
+// 2. 不带限定名的表解析到当前会话所在的数据库(USE)
+// 所有数据库记录在默认数据库的系统表sys_databases中
+// CREATE DATABASE 在事物提交之后才对其他会话可见, 回滚则不留下数据库; 未提交的名字被预留, 并发创建同名数据库时后者失败
+// 范围: 每个数据库独立的目录/表空间以及数据库级别的权限不在这里实现, 服务器尚无用户体系, 任何会话都可以访问所有数据库
+
+const (
+	DefaultDatabase string = "default"
+	DatabaseTable   string = "sys_databases"
+	Separator       string = "."
+)
+
+type CreateDatabase struct {
+	Name string
+}
+
+type UseDatabase struct {
+	Name string
+}
+
+type ErrorDatabaseNotExist struct{}
+type ErrorDatabaseAlreadyExist struct{}
+type ErrorInvalidDatabaseName struct{}
+
+func (err *ErrorDatabaseNotExist) Error() string {
+	return "Database doesn't exist"
+}
+
+func (err *ErrorDatabaseAlreadyExist) Error() string {
+	return "This database is already created"
+}
+
+func (err *ErrorDatabaseAlreadyExist) Is(target error) bool {
+	return target == dbError.ErrDuplicateKey
+}
+
+func (err *ErrorInvalidDatabaseName) Error() string {
+	return "Invalid database name"
+}
+
+// createDatabase
+// 在xid事物中向sys_databases插入一条记录, 提交之后发布(xid == -1 时立即发布)
+// 检查名字与插入记录都持有dbLock, 名字在事物结束之前预留在creating中
+func (db *NtDB) createDatabase(xid int64, name string) error {
+	if name == "" || strings.Contains(name, Separator) {
+		return &ErrorInvalidDatabaseName{}
+	}
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+	if _, ext := db.databases[name]; ext || name == DefaultDatabase {
+		return &ErrorDatabaseAlreadyExist{}
+	}
+	if _, ext := db.creating[name]; ext {
+		return &ErrorDatabaseAlreadyExist{}
+	}
+	if !db.hasSystemTable(xid, DatabaseTable) {
+		create := &tableManager.Create{
+			TbName: DatabaseTable,
+			Fields: []*tableManager.FieldCreate{{FName: "name", FType: "string"}},
+		}
+		if err := db.storageEngine.Create(xid, create); err != nil {
+			return err
+		}
+	}
+	if _, err := db.storageEngine.Insert(xid, &tableManager.Insert{TbName: DatabaseTable, Values: []string{name}}); err != nil {
+		return err
+	}
+	if xid == -1 {
+		db.databases[name] = struct{}{}
+		return nil
+	}
+	db.creating[name] = xid
+	db.afterCommit(xid, func() {
+		db.dbLock.Lock()
+		defer db.dbLock.Unlock()
+		delete(db.creating, name)
+		db.databases[name] = struct{}{}
+	})
+	return nil
+}
+
+// discardDatabases xid回滚, 释放其预留的名字
+func (db *NtDB) discardDatabases(xid int64) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+	for name, x := range db.creating {
+		if x == xid {
+			delete(db.creating, name)
+		}
+	}
+}
+
+// showDatabases 展示所有逻辑数据库
+func (db *NtDB) showDatabases() []*tableManager.ResponseObject {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+	res := []*tableManager.ResponseObject{{Payload: "database", RowId: 0, ColId: 0}}
+	res = append(res, &tableManager.ResponseObject{Payload: DefaultDatabase, RowId: 1, ColId: 0})
+	names := make([]string, 0, len(db.databases))
+	for name := range db.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rowId := 2
+	for _, name := range names {
+		res = append(res, &tableManager.ResponseObject{Payload: name, RowId: rowId, ColId: 0})
+		rowId += 1
+	}
+	return res
+}
+
+// showEngineStatus 状态报告的每一行作为结果的一行
+func (db *NtDB) showEngineStatus() []*tableManager.ResponseObject {
+	res := []*tableManager.ResponseObject{{Payload: "status", RowId: 0, ColId: 0}}
+	lines := strings.Split(strings.TrimRight(db.storageEngine.Status(), "\n"), "\n")
+	for i, line := range lines {
+		res = append(res, &tableManager.ResponseObject{Payload: line, RowId: i + 1, ColId: 0})
+	}
+	return res
+}
+
+// showMetrics 每个指标一行
+func (db *NtDB) showMetrics() []*tableManager.ResponseObject {
+	res := []*tableManager.ResponseObject{{Payload: "name", RowId: 0, ColId: 0}, {Payload: "value", RowId: 0, ColId: 1}}
+	metrics := db.storageEngine.Metrics()
+	metrics = append(metrics, db.spillMetrics()...)
+	metrics = append(metrics, db.results.metrics()...)
+	metrics = append(metrics, db.counters.metrics()...)
+	metrics = append(metrics, db.points.metrics()...)
+	for i, metric := range metrics {
+		res = append(res,
+			&tableManager.ResponseObject{Payload: metric.Name, RowId: i + 1, ColId: 0},
+			&tableManager.ResponseObject{Payload: strconv.FormatInt(metric.Value, 10), RowId: i + 1, ColId: 1})
+	}
+	return res
+}
+
+// ReportReplica 复制由外部实现, 副本(或者日志传输程序)定期上报已经应用的LSN
+func (db *NtDB) ReportReplica(name string, lsn int64) {
+	db.storageEngine.ReportReplica(name, lsn)
+}
+
+func (db *NtDB) CheckHealth(timeout time.Duration) error {
+	return db.storageEngine.CheckHealth(timeout)
+}
+
+func (db *NtDB) SetRetention(retention time.Duration) {
+	db.storageEngine.SetRetention(retention)
+}
+
+func (db *NtDB) hasDatabase(name string) bool {
+	if name == DefaultDatabase {
+		return true
+	}
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+	_, ext := db.databases[name]
+	return ext
+}
+
+// resolveTable
+// 将会话中的表名解析为目录中的表名
+func (db *NtDB) resolveTable(database, name string) (string, error) {
+	if index := strings.Index(name, Separator); index != -1 {
+		database, name = name[:index], name[index+1:]
+	}
+	if !db.hasDatabase(database) {
+		return "", &ErrorDatabaseNotExist{}
+	}
+	if database == DefaultDatabase {
+		return name, nil
+	}
+	return database + Separator + name, nil
+}
+
+// resolveEntity
+// 解析实体类中的表名
+func (db *NtDB) resolveEntity(database string, entity any) error {
+	var err error
+	switch e := entity.(type) {
+	case *tableManager.Select:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	case *tableManager.Update:
+		e.TName, err = db.resolveTable(database, e.TName)
+	case *tableManager.Insert:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	case *tableManager.Delete:
+		e.TName, err = db.resolveTable(database, e.TName)
+	case *tableManager.Create:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	case *tableManager.Export:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	case *tableManager.Attach:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	case *tableManager.Flashback:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	case *tableManager.Swap:
+		if e.TbName, err = db.resolveTable(database, e.TbName); err == nil {
+			e.With, err = db.resolveTable(database, e.With)
+		}
+	case *Increment:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	case *Join:
+		if e.Left, err = db.resolveTable(database, e.Left); err == nil {
+			e.Right, err = db.resolveTable(database, e.Right)
+		}
+	case *CountRows:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	case *tableManager.Analyze:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	case *Offload:
+		e.TbName, err = db.resolveTable(database, e.TbName)
+	}
+	return err
+}
+
+// filterTables
+// SHOW 只展示当前数据库中的表
+func filterTables(database string, tables []*tableManager.ResponseObject) []*tableManager.ResponseObject {
+	res := make([]*tableManager.ResponseObject, 0)
+	rowId := 0
+	for _, t := range tables {
+		name := t.Payload
+		if t.RowId != 0 {
+			index := strings.Index(name, Separator)
+			if database == DefaultDatabase && index != -1 {
+				continue
+			}
+			if database != DefaultDatabase {
+				if index == -1 || name[:index] != database {
+					continue
+				}
+				name = name[index+1:]
+			}
+		}
+		res = append(res, &tableManager.ResponseObject{Payload: name, RowId: rowId, ColId: t.ColId})
+		rowId += 1
+	}
+	return res
+}
+
+func (db *NtDB) hasSystemTable(xid int64, name string) bool {
+	tables, err := db.storageEngine.Show(xid)
+	if err != nil {
+		return false
+	}
+	for _, t := range tables {
+		if t.RowId != 0 && t.Payload == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDatabases
+// 启动时载入所有逻辑数据库
+func (db *NtDB) loadDatabases() {
+	xid := db.storageEngine.Begin()
+	defer db.storageEngine.Commit(xid)
+	if !db.hasSystemTable(xid, DatabaseTable) {
+		return
+	}
+	rows, err := db.storageEngine.Select(xid, &tableManager.Select{TbName: DatabaseTable, FNames: []string{"name"}})
+	if err != nil {
+		panic(err)
+	}
+	for _, row := range rows {
+		if row.RowId != 0 {
+			db.databases[row.Payload] = struct{}{}
+		}
+	}
+	log.Printf("[Executor] Load %d databases\n", len(db.databases))
+}
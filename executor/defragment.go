@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 碎片整理
+// defragment <table> page <pageId>
+// 将表中位于pageId页的行在线迁移到其他页, 每一行在独立的短事物中迁移, 不能在事物中执行
+
+type Defragment struct {
+	TbName string
+	PageId int64
+}
+
+func parseDefragment(args []string) (*Defragment, error) {
+	if len(args) != 4 || strings.ToUpper(args[2]) != "PAGE" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	pageId, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || pageId <= 0 {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	return &Defragment{TbName: args[1], PageId: pageId}, nil
+}
+
+// defragment 返回迁移的行数
+func (db *NtDB) defragment(session *Session, xid int64, defrag *Defragment) ([]*tableManager.ResponseObject, error) {
+	if xid != -1 {
+		return nil, &ErrorIllegalOperation{}
+	}
+	name, err := db.resolveTable(session.Database, defrag.TbName)
+	if err != nil {
+		return nil, err
+	}
+	moved, err := db.storageEngine.MigratePage(name, defrag.PageId)
+	if err != nil {
+		return nil, err
+	}
+	return []*tableManager.ResponseObject{
+		{Payload: "moved", RowId: 0, ColId: 0},
+		{Payload: strconv.FormatInt(moved, 10), RowId: 1, ColId: 0},
+	}, nil
+}
@@ -0,0 +1,276 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"myDB/simulation"
+	"myDB/tableManager"
+	"myDB/versionManager"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 逻辑导出
+// dump [<table> ...] to <path> [format sql | csv] [decrypt]
+// 导出当前数据库中的表(不指定时为所有用户表, 不包括系统表以及物化视图)
+// sql: path为一个文件, 每个表为一条create语句以及每行一条insert语句, 可以逐行执行恢复; 字符串值包含空白或为空时无法表示, 返回ErrorUndumpableValue
+// csv: path为一个目录, 每个表一个<table>.csv, 第一行为字段名; 文件头写入目录中的DumpHeaderFile
+// 所有表在同一个可重复读事物(快照)中读取, 导出期间其他事物的写入不可见, 导出的表之间互相一致
+// 文件头记录数据库, 快照创建之后的redo LSN(快照中的所有提交都在这个LSN之前)以及导出时间
+// 不属于当前事物(当前事物未提交的修改不导出), 可以在事物中执行; 不导出主键, 引擎, 填充因子等表选项
+// 导出的值为明文, 导出的表有加密字段(见tableManager/encryption.go)时返回ErrorEncryptedDump;
+// 指定decrypt时导出加密字段的明文, 文件头中注明, 由调用者负责保护导出的文件
+
+const (
+	DumpFormatSql  string = "sql"
+	DumpFormatCsv  string = "csv"
+	DumpHeaderFile string = "header"
+)
+
+type ErrorUndumpableValue struct{}
+type ErrorEncryptedDump struct{}
+
+func (err *ErrorUndumpableValue) Error() string {
+	return "Value with blanks can not be dumped as sql, use csv format"
+}
+
+func (err *ErrorEncryptedDump) Error() string {
+	return "Table has encrypted fields, dump with decrypt to export them as plaintext"
+}
+
+type Dump struct {
+	Tables  []string // 为空时导出所有表
+	Path    string
+	Format  string
+	Decrypt bool // 导出加密字段的明文
+}
+
+func parseDump(args []string) (*Dump, error) {
+	to := -1
+	for i := 1; i < len(args); i++ {
+		if strings.ToUpper(args[i]) == "TO" {
+			to = i
+			break
+		}
+	}
+	decrypt := len(args) > 0 && strings.ToUpper(args[len(args)-1]) == "DECRYPT"
+	if decrypt {
+		args = args[:len(args)-1]
+	}
+	if to == -1 || (len(args) != to+2 && len(args) != to+4) {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	dump := &Dump{Tables: args[1:to], Path: args[to+1], Format: DumpFormatSql, Decrypt: decrypt}
+	if len(args) == to+4 {
+		format := strings.ToLower(args[to+3])
+		if strings.ToUpper(args[to+2]) != "FORMAT" || (format != DumpFormatSql && format != DumpFormatCsv) {
+			return nil, &ErrorInvalidEntity{}
+		}
+		dump.Format = format
+	}
+	return dump, nil
+}
+
+// dumpTable 快照中一个表的字段以及所有行
+type dumpTable struct {
+	name   string // 会话中的表名
+	fields []tableManager.Field
+	rows   [][]string
+}
+
+// dump 在独立的可重复读事物中读取所有表之后写入文件, 返回每个表的行数以及快照的LSN
+func (db *NtDB) dump(session *Session, dump *Dump) ([]*tableManager.ResponseObject, error) {
+	opts := db.transactionOptions(session)
+	opts.Level = versionManager.ReadRepeatable
+	xid := db.storageEngine.BeginWith(opts)
+	lsn := db.redoLsn()
+	tables, err := db.readSnapshot(session, xid, dump.Tables, dump.Decrypt)
+	db.abort(xid)
+	if err != nil {
+		return nil, err
+	}
+	header := []string{
+		"-- myDB logical dump",
+		"-- database " + session.Database,
+		"-- snapshot lsn " + strconv.FormatInt(lsn, 10),
+		"-- time " + simulation.Now().Format(time.RFC3339),
+	}
+	if dump.Decrypt {
+		header = append(header, "-- encrypted fields are exported as plaintext")
+	}
+	if dump.Format == DumpFormatCsv {
+		err = writeCsvDump(dump.Path, header, tables)
+	} else {
+		err = writeSqlDump(dump.Path, header, tables)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*tableManager.ResponseObject, 0, 3*(len(tables)+1))
+	for j, title := range []string{"table", "rows", "lsn"} {
+		res = append(res, &tableManager.ResponseObject{Payload: title, RowId: 0, ColId: j})
+	}
+	for i, tb := range tables {
+		for j, value := range []string{tb.name, strconv.Itoa(len(tb.rows)), strconv.FormatInt(lsn, 10)} {
+			res = append(res, &tableManager.ResponseObject{Payload: value, RowId: i + 1, ColId: j})
+		}
+	}
+	return res, nil
+}
+
+// readSnapshot 读出names(为空时为当前数据库中的所有用户表)的字段以及所有行, decrypt为false时不读取有加密字段的表
+func (db *NtDB) readSnapshot(session *Session, xid int64, names []string, decrypt bool) ([]*dumpTable, error) {
+	if len(names) == 0 {
+		all, err := db.storageEngine.Show(xid)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range filterTables(session.Database, all) {
+			if t.RowId != 0 && !strings.HasPrefix(t.Payload, "sys_") {
+				names = append(names, t.Payload)
+			}
+		}
+	}
+	tables := make([]*dumpTable, 0, len(names))
+	for _, name := range names {
+		tbName, err := db.resolveTable(session.Database, name)
+		if err != nil {
+			return nil, err
+		}
+		if db.isView(tbName) {
+			continue
+		}
+		fields, err := db.storageEngine.Describe(xid, tbName)
+		if err != nil {
+			return nil, err
+		}
+		tb := &dumpTable{name: name}
+		fNames := make([]string, 0, len(fields))
+		for _, f := range fields {
+			if f.GetDataKey() != nil && !decrypt {
+				return nil, &ErrorEncryptedDump{}
+			}
+			if f.GetName() != tableManager.PrimaryKeyCol {
+				tb.fields = append(tb.fields, f)
+				fNames = append(fNames, f.GetName())
+			}
+		}
+		res, err := db.storageEngine.Select(xid, &tableManager.Select{TbName: tbName, FNames: fNames})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range responseRows(res) {
+			values := make([]string, len(fNames))
+			for j, f := range fNames {
+				values[j] = row[f]
+			}
+			tb.rows = append(tb.rows, values)
+		}
+		tables = append(tables, tb)
+	}
+	return tables, nil
+}
+
+// redoLsn 当前的redo LSN, 见storageEngine/metrics.go
+func (db *NtDB) redoLsn() int64 {
+	for _, m := range db.storageEngine.Metrics() {
+		if m.Name == "redo_lsn" {
+			return m.Value
+		}
+	}
+	return -1
+}
+
+// writeSqlDump 先写入临时文件, 完成之后重命名
+func writeSqlDump(path string, header []string, tables []*dumpTable) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = writeSqlTables(w, header, tables)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writeSqlTables(w io.Writer, header []string, tables []*dumpTable) error {
+	for _, line := range header {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	for _, tb := range tables {
+		columns := make([]string, len(tb.fields))
+		for j, f := range tb.fields {
+			columns[j] = f.GetName() + " " + typeName(f.GetFType())
+			if f.GetDataKey() != nil {
+				columns[j] += " encrypted"
+			} else if f.IsIndexed() {
+				columns[j] += " indexed"
+			}
+		}
+		if _, err := fmt.Fprintf(w, "create %s { %s }\n", tb.name, strings.Join(columns, " , ")); err != nil {
+			return err
+		}
+		for _, row := range tb.rows {
+			for _, value := range row {
+				if value == "" || strings.ContainsAny(value, " \t\r\n") {
+					return &ErrorUndumpableValue{}
+				}
+			}
+			if _, err := fmt.Fprintf(w, "insert %s values %s\n", tb.name, strings.Join(row, " ")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeCsvDump 目录中每个表一个csv文件以及文件头
+func writeCsvDump(dir string, header []string, tables []*dumpTable) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, DumpHeaderFile), []byte(strings.Join(header, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	for _, tb := range tables {
+		f, err := os.Create(filepath.Join(dir, tb.name+".csv"))
+		if err != nil {
+			return err
+		}
+		w := csv.NewWriter(f)
+		names := make([]string, len(tb.fields))
+		for j, field := range tb.fields {
+			names[j] = field.GetName()
+		}
+		_ = w.Write(names)
+		_ = w.WriteAll(tb.rows)
+		err = w.Error()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
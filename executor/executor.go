@@ -1,44 +1,171 @@
 package executor
 
 import (
+	"context"
 	"log"
+	util "myDB/dataStructure"
+	"myDB/exporter"
+	"myDB/simulation"
 	"myDB/storageEngine"
 	"myDB/tableManager"
 	"myDB/versionManager"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Executor interface {
-	Execute(xid int64, args []string) (int64, []*tableManager.ResponseObject, error)
+	Execute(xid int64, args []string) (int64, []*tableManager.ResponseObject, error)                    // 在默认数据库中执行
+	ExecuteIn(database string, xid int64, args []string) (int64, []*tableManager.ResponseObject, error) // 在逻辑数据库database中执行
+	ExecuteSession(session *Session, xid int64, args []string) (int64, []*tableManager.ResponseObject, error)
+	ExecuteMany(session *Session, xid int64, stmt []string, params [][]string) (int64, []*tableManager.ResponseObject, error) // 批量执行预编译语句
+	ExecuteArrow(session *Session, xid int64, args []string) (int64, *exporter.ArrowTable, error)                             // 执行select, 返回Arrow格式的结果
+	CloseListener(l *Listener)                                                                                                // 会话结束时退订所有频道
+	Schedule(name, spec string, job EventJob) error                                                                           // 注册定期运行的Go回调
+	RunEvents(now time.Time) int                                                                                              // 运行到期的事件
+	ReapIdleTransactions(now time.Time) int                                                                                   // 回滚空闲超时的事物
+	SetAuditLog(audit *AuditLog)                                                                                              // 开启或者关闭审计日志
+	ReportReplica(name string, lsn int64)                                                                                     // 副本上报已经应用的redo log LSN, lsn < 0 时移除
+	CheckHealth(timeout time.Duration) error                                                                                  // 存储层的健康检查(日志可写, 缓冲区没有停滞)
+	SetRetention(retention time.Duration)                                                                                     // 时间旅行查询(AS OF)的保留时间, 失效的DataItem超过保留时间之后才清理
+	Autocommit(session *Session) bool                                                                                         // 会话中事物之外的语句是否自动提交
+	SetSpillLimit(limit int64)                                                                                                // 查询溢出文件的总字节数上限, 0表示不限制
+	SetVacuumInterval(interval time.Duration)                                                                                 // 后台整理所有表的间隔, 0表示停止
+	SetColdCompression(idle time.Duration)                                                                                    // 自动压缩idle时间内没有访问的区, 访问时解压, 0表示停止
+	OnCommit(hook CommitHook, keys bool) func()                                                                               // 注册提交钩子, 返回注销函数, 见commitHook.go
+	RunInTransaction(ctx context.Context, fn func(xid int64) error) error                                                     // 在事物中执行fn, 可以重试的错误自动重试, 见retry.go
 }
 
 // CommandType 用于路由
 type CommandType int64
 
 const (
-	BEGIN   CommandType = 0x01
-	COMMIT  CommandType = 0x02
-	ABORT   CommandType = 0x03
-	SHOW    CommandType = 0x04
-	CREATE  CommandType = 0x05
-	INSERT  CommandType = 0x06
-	SELECT  CommandType = 0x07
-	UPDATE  CommandType = 0x08
-	DELETE  CommandType = 0x09
-	INVALID CommandType = 0xff
+	BEGIN       CommandType = 0x01
+	COMMIT      CommandType = 0x02
+	ABORT       CommandType = 0x03
+	SHOW        CommandType = 0x04
+	CREATE      CommandType = 0x05
+	INSERT      CommandType = 0x06
+	SELECT      CommandType = 0x07
+	UPDATE      CommandType = 0x08
+	DELETE      CommandType = 0x09
+	CREATEDB    CommandType = 0x0a
+	USE         CommandType = 0x0b
+	SHOWDB      CommandType = 0x0c
+	EXPORT      CommandType = 0x0d
+	ATTACH      CommandType = 0x0e
+	WITH        CommandType = 0x0f
+	COPY        CommandType = 0x10
+	SHOWENG     CommandType = 0x11
+	SHOWSTATS   CommandType = 0x12
+	FLASHBACK   CommandType = 0x13
+	DEFRAG      CommandType = 0x14
+	LISTEN      CommandType = 0x15
+	NOTIFY      CommandType = 0x16
+	CREATEEVT   CommandType = 0x17
+	DROPEVT     CommandType = 0x18
+	SHOWEVTS    CommandType = 0x19
+	CREATEMV    CommandType = 0x1a
+	REFRESHMV   CommandType = 0x1b
+	SHOWMETRICS CommandType = 0x1c
+	RECLAIM     CommandType = 0x1d
+	SHOWHOT     CommandType = 0x1e
+	LOAD        CommandType = 0x1f
+	SETVAR      CommandType = 0x20
+	SHOWVARS    CommandType = 0x21
+	DECLARE     CommandType = 0x22
+	FETCH       CommandType = 0x23
+	CLOSE       CommandType = 0x24
+	INCREMENT   CommandType = 0x25
+	OFFLOAD     CommandType = 0x26
+	DUMP        CommandType = 0x27
+	BACKUP      CommandType = 0x28
+	SCRUB       CommandType = 0x29
+	SWAP        CommandType = 0x2a
+	COUNT       CommandType = 0x2b
+	ANALYZE     CommandType = 0x2c
+	CREATEFT    CommandType = 0x2d
+	DROPFT      CommandType = 0x2e
+	JOIN        CommandType = 0x2f
+	VACUUM      CommandType = 0x30
+	IMPORT      CommandType = 0x31
+	SHOWSIZE    CommandType = 0x32
+	INVALID     CommandType = 0xff
 )
 
 type NtDB struct {
 	parser        Parser
 	storageEngine storageEngine.StorageEngine
+	databases     map[string]struct{} // 逻辑数据库(不包括默认数据库)
+	creating      map[string]int64    // 未提交的CREATE DATABASE, 名字 -> xid
+	dbLock        sync.RWMutex        // 保护databases, creating
+	notifier      *notifier
+	scheduler     *eventScheduler
+	views         *viewRegistry
+	foreign       *foreignRegistry   // 外部表, 见foreignTable.go
+	hooks         map[int64][]func() // 事物提交之后执行的回调, 见transaction.go
+	hookLock      sync.Mutex
+	audit         atomic.Pointer[AuditLog] // nil则不记录审计日志
+	globals       *globalVariables
+	cursors       *cursorRegistry
+	spill         *util.SpillManager // 查询的溢出文件, 见memory.go
+	results       *resultCache
+	counters      *counterBatcher
+	points        *pointSelects // 主键点查的语句模板, 见pointSelect.go
+	reaper        *idleReaper   // 事物空闲超时, 见timeout.go
+	commitHooks   *commitHooks
 }
 
-// Execute 向存储引擎请求 xid事物执行指令
-// response 可能返回nil
+// Execute 在默认数据库中执行指令
 func (db *NtDB) Execute(xid int64, args []string) (int64, []*tableManager.ResponseObject, error) {
+	return db.ExecuteIn(DefaultDatabase, xid, args)
+}
+
+// ExecuteIn 在逻辑数据库database中执行指令
+func (db *NtDB) ExecuteIn(database string, xid int64, args []string) (int64, []*tableManager.ResponseObject, error) {
+	return db.ExecuteSession(&Session{Database: database}, xid, args)
+}
+
+// ExecuteSession 向存储引擎请求 xid事物在会话session中执行指令
+// response 可能返回nil
+func (db *NtDB) ExecuteSession(session *Session, xid int64, args []string) (int64, []*tableManager.ResponseObject, error) {
+	start := simulation.Now()
+	outer := db.beginQuery(session)
+	if outer {
+		defer func() { session.memory = nil }()
+		if err := db.beginStatement(session, xid); err != nil {
+			db.auditStatement(session, xid, args, err)
+			return xid, nil, err
+		}
+	}
+	x, response, err := db.execute(session, xid, args)
+	if !isShowStats(args) {
+		db.endStatement(session, xid, args, simulation.Now().Sub(start))
+	}
+	if outer {
+		db.endStatementIdle(session, x)
+	}
+	db.auditStatement(session, x, args, err)
+	return x, response, err
+}
+
+func (db *NtDB) execute(session *Session, xid int64, args []string) (int64, []*tableManager.ResponseObject, error) {
+	database := session.Database
+	if ret, ok, err := db.selectPoint(session, xid, args); ok {
+		return xid, ret, err
+	}
 	cmd, entity, err := db.parser.ParseRequest(args)
 	if err != nil {
 		return xid, nil, err
 	}
+	if !db.hasDatabase(database) {
+		return xid, nil, &ErrorDatabaseNotExist{}
+	}
+	if len(entity) > 0 {
+		if err := db.resolveEntity(database, entity[0]); err != nil {
+			return xid, nil, err
+		}
+	}
 	switch cmd {
 	case BEGIN:
 		{
@@ -46,7 +173,10 @@ func (db *NtDB) Execute(xid int64, args []string) (int64, []*tableManager.Respon
 			if xid != -1 {
 				return xid, nil, &ErrorRequestArgNumber{}
 			}
-			x := db.storageEngine.Begin()
+			opts := db.transactionOptions(session)
+			x := db.storageEngine.BeginWith(opts)
+			db.reaper.begin(x)
+			db.results.begin(x, opts.Level == versionManager.ReadRepeatable)
 			return x, nil, nil
 		}
 	case COMMIT:
@@ -54,27 +184,210 @@ func (db *NtDB) Execute(xid int64, args []string) (int64, []*tableManager.Respon
 			if xid == -1 {
 				return xid, nil, &ErrorIllegalOperation{}
 			}
-			db.storageEngine.Commit(xid)
+			if err := db.commit(xid); err != nil {
+				return xid, nil, err
+			}
 		}
 	case ABORT:
 		{
 			if xid == -1 {
 				return xid, nil, &ErrorIllegalOperation{}
 			}
-			db.storageEngine.Abort(xid)
+			db.abort(xid)
 		}
 	case SHOW:
 		{
 			ret, err := db.storageEngine.Show(xid)
+			if err != nil {
+				return xid, nil, err
+			}
+			return xid, filterTables(database, ret), nil
+		}
+	case SHOWDB:
+		{
+			return xid, db.showDatabases(), nil
+		}
+	case SHOWENG:
+		{
+			return xid, db.showEngineStatus(), nil
+		}
+	case SHOWSTATS:
+		{
+			return xid, showStats(session), nil
+		}
+	case SHOWEVTS:
+		{
+			return xid, db.showEvents(), nil
+		}
+	case SHOWVARS:
+		{
+			return xid, db.showVariables(session), nil
+		}
+	case DECLARE:
+		{
+			declare, ok := entity[0].(*DeclareCursor)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.declareCursor(session, xid, declare)
+		}
+	case FETCH:
+		{
+			fetch, ok := entity[0].(*FetchCursor)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.fetchCursor(xid, fetch)
+			return xid, ret, err
+		}
+	case CLOSE:
+		{
+			cls, ok := entity[0].(*CloseCursor)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.closeCursor(xid, cls)
+		}
+	case OFFLOAD:
+		{
+			off, ok := entity[0].(*Offload)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.offload(off)
+			return xid, ret, err
+		}
+	case BACKUP:
+		{
+			backup, ok := entity[0].(*Backup)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.backup(backup)
+			return xid, ret, err
+		}
+	case SCRUB:
+		{
+			scrub, ok := entity[0].(*Scrub)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.scrub(scrub)
+			return xid, ret, err
+		}
+	case DUMP:
+		{
+			dump, ok := entity[0].(*Dump)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.dump(session, dump)
+			return xid, ret, err
+		}
+	case INCREMENT:
+		{
+			inc, ok := entity[0].(*Increment)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.increment(session, inc)
+			return xid, ret, err
+		}
+	case SETVAR:
+		{
+			set, ok := entity[0].(*SetVariable)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.setVariable(session, xid, set)
+		}
+	case SHOWMETRICS:
+		{
+			return xid, db.showMetrics(), nil
+		}
+	case SHOWHOT:
+		{
+			show, ok := entity[0].(*ShowHotspots)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.showHotspots(session, show)
+			return xid, ret, err
+		}
+	case SHOWSIZE:
+		{
+			show, ok := entity[0].(*ShowSizes)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.showSizes(session, show)
 			return xid, ret, err
 		}
+	case CREATEEVT:
+		{
+			cre, ok := entity[0].(*CreateEvent)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.createEvent(session, xid, cre)
+		}
+	case DROPEVT:
+		{
+			drop, ok := entity[0].(*DropEvent)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.dropEvent(xid, drop)
+		}
+	case CREATEDB:
+		{
+			cre, ok := entity[0].(*CreateDatabase)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.createDatabase(xid, cre.Name)
+		}
+	case USE:
+		{
+			// 只检查数据库是否存在, 会话状态由上层维护
+			use, ok := entity[0].(*UseDatabase)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			if !db.hasDatabase(use.Name) {
+				return xid, nil, &ErrorDatabaseNotExist{}
+			}
+		}
 	case SELECT:
 		{
 			sel, ok := entity[0].(*tableManager.Select)
 			if !ok {
 				return xid, nil, &ErrorInvalidEntity{}
 			}
-			ret, err := db.storageEngine.Select(xid, sel)
+			if ft := db.foreign.get(sel.TbName); ft != nil {
+				ret, err := db.selectForeign(ft, sel)
+				return xid, ret, err
+			}
+			db.learnPoint(session, args, sel)
+			ret, err := db.selectCached(session, xid, args, sel)
+			return xid, ret, err
+		}
+	case JOIN:
+		{
+			j, ok := entity[0].(*Join)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.join(session, xid, j)
+			return xid, ret, err
+		}
+	case WITH:
+		{
+			with, ok := entity[0].(*With)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.executeWith(session, xid, with)
 			return xid, ret, err
 		}
 	case UPDATE:
@@ -83,8 +396,17 @@ func (db *NtDB) Execute(xid int64, args []string) (int64, []*tableManager.Respon
 			if !ok {
 				return xid, nil, &ErrorInvalidEntity{}
 			}
-			er := db.storageEngine.Update(xid, upd)
-			return xid, nil, er
+			if db.isView(upd.TName) {
+				return xid, nil, &ErrorModifyView{}
+			}
+			if db.isForeign(upd.TName) {
+				return xid, nil, &ErrorModifyForeignTable{}
+			}
+			ret, er := db.storageEngine.Update(xid, upd)
+			if er == nil {
+				db.notifyTable(xid, upd.TName, "update")
+			}
+			return xid, ret, er
 		}
 	case INSERT:
 		{
@@ -92,8 +414,17 @@ func (db *NtDB) Execute(xid int64, args []string) (int64, []*tableManager.Respon
 			if !ok {
 				return xid, nil, &ErrorInvalidEntity{}
 			}
-			er := db.storageEngine.Insert(xid, ins)
-			return xid, nil, er
+			if db.isView(ins.TbName) {
+				return xid, nil, &ErrorModifyView{}
+			}
+			if db.isForeign(ins.TbName) {
+				return xid, nil, &ErrorModifyForeignTable{}
+			}
+			ret, er := db.storageEngine.Insert(xid, ins)
+			if er == nil {
+				db.notifyTable(xid, ins.TbName, "insert")
+			}
+			return xid, ret, er
 		}
 	case DELETE:
 		{
@@ -101,8 +432,17 @@ func (db *NtDB) Execute(xid int64, args []string) (int64, []*tableManager.Respon
 			if !ok {
 				return xid, nil, &ErrorInvalidEntity{}
 			}
-			er := db.storageEngine.Delete(xid, del)
-			return xid, nil, er
+			if db.isView(del.TName) {
+				return xid, nil, &ErrorModifyView{}
+			}
+			if db.isForeign(del.TName) {
+				return xid, nil, &ErrorModifyForeignTable{}
+			}
+			ret, er := db.storageEngine.Delete(xid, del)
+			if er == nil {
+				db.notifyTable(xid, del.TName, "delete")
+			}
+			return xid, ret, er
 		}
 	case CREATE:
 		{
@@ -110,9 +450,172 @@ func (db *NtDB) Execute(xid int64, args []string) (int64, []*tableManager.Respon
 			if !ok {
 				return xid, nil, &ErrorInvalidEntity{}
 			}
+			if db.isForeign(cre.TbName) {
+				return xid, nil, &tableManager.ErrorTableAlreadyExist{}
+			}
 			er := db.storageEngine.Create(xid, cre)
 			return xid, nil, er
 		}
+	case CREATEFT:
+		{
+			cre, ok := entity[0].(*CreateForeign)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.createForeign(session, xid, cre)
+		}
+	case DROPFT:
+		{
+			drop, ok := entity[0].(*DropForeign)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.dropForeign(session, xid, drop)
+		}
+	case EXPORT:
+		{
+			exp, ok := entity[0].(*tableManager.Export)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			er := db.storageEngine.Export(xid, exp)
+			return xid, nil, er
+		}
+	case ATTACH:
+		{
+			att, ok := entity[0].(*tableManager.Attach)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			er := db.storageEngine.Attach(xid, att)
+			return xid, nil, er
+		}
+	case FLASHBACK:
+		{
+			fb, ok := entity[0].(*tableManager.Flashback)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			if db.isView(fb.TbName) {
+				return xid, nil, &ErrorModifyView{}
+			}
+			er := db.storageEngine.Flashback(xid, fb)
+			if er == nil {
+				db.notifyTable(xid, fb.TbName, "flashback")
+			}
+			return xid, nil, er
+		}
+	case ANALYZE:
+		{
+			analyze, ok := entity[0].(*tableManager.Analyze)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.analyze(xid, analyze)
+			return xid, ret, err
+		}
+	case COUNT:
+		{
+			count, ok := entity[0].(*CountRows)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.countRows(session, xid, count)
+			return xid, ret, err
+		}
+	case SWAP:
+		{
+			swap, ok := entity[0].(*tableManager.Swap)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.swap(xid, swap)
+		}
+	case DEFRAG:
+		{
+			defrag, ok := entity[0].(*Defragment)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.defragment(session, xid, defrag)
+			return xid, ret, err
+		}
+	case VACUUM:
+		{
+			vacuum, ok := entity[0].(*Vacuum)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.vacuum(session, xid, vacuum)
+			return xid, ret, err
+		}
+	case LOAD:
+		{
+			load, ok := entity[0].(*BulkLoad)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.bulkLoad(session, xid, load)
+			return xid, ret, err
+		}
+	case IMPORT:
+		{
+			imp, ok := entity[0].(*MysqlImport)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.importMysql(session, xid, imp)
+			return xid, ret, err
+		}
+	case RECLAIM:
+		{
+			reclaim, ok := entity[0].(*Reclaim)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			ret, err := db.reclaim(xid, reclaim)
+			return xid, ret, err
+		}
+	case LISTEN:
+		{
+			listen, ok := entity[0].(*Listen)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.listen(session, listen)
+		}
+	case NOTIFY:
+		{
+			notify, ok := entity[0].(*Notify)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			db.notifier.notify(xid, notify.Channel, notify.Payload)
+		}
+	case CREATEMV:
+		{
+			cre, ok := entity[0].(*CreateView)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.createView(session, xid, cre)
+		}
+	case REFRESHMV:
+		{
+			refresh, ok := entity[0].(*RefreshView)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.refreshView(session, xid, refresh)
+		}
+	case COPY:
+		{
+			cp, ok := entity[0].(*Copy)
+			if !ok {
+				return xid, nil, &ErrorInvalidEntity{}
+			}
+			return xid, nil, db.copyToParquet(session, xid, cp)
+		}
 	default:
 		{
 			return xid, nil, &ErrorInvalidEntity{}
@@ -121,13 +624,58 @@ func (db *NtDB) Execute(xid int64, args []string) (int64, []*tableManager.Respon
 	return xid, nil, nil
 }
 
-func NewExecutor(path string, memory int64, level versionManager.IsolationLevel) Executor {
+// selectQuery 执行select, 包括窗口函数
+func (db *NtDB) selectQuery(session *Session, xid int64, sel *tableManager.Select) ([]*tableManager.ResponseObject, error) {
+	sel.MaxMemory = db.queryMemory(session)
+	sel.Parallel = session.Parallel
+	if isWindowQuery(sel.FNames) {
+		return db.selectWindow(session, xid, sel)
+	}
+	return db.storageEngine.Select(xid, sel)
+}
+
+// NewExecutor maxSize 数据库大小上限(字节), 0表示不限制, opts为打开TableManager的选项, 打开失败时panic
+func NewExecutor(path string, memory, maxSize int64, level versionManager.IsolationLevel, opts ...tableManager.Option) Executor {
+	db, err := OpenExecutor(path, memory, maxSize, level, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// OpenExecutor 同NewExecutor, 选项(例如主密钥)不合法或者数据库打开失败时返回错误
+func OpenExecutor(path string, memory, maxSize int64, level versionManager.IsolationLevel, opts ...tableManager.Option) (Executor, error) {
+	se, err := storageEngine.OpenStorageEngine(path, memory, maxSize, level, opts...)
+	if err != nil {
+		return nil, err
+	}
 	db := &NtDB{
 		parser:        NewTrieParser(),
-		storageEngine: storageEngine.NewStorageEngine(path, memory, level),
+		storageEngine: se,
+		databases:     map[string]struct{}{},
+		creating:      map[string]int64{},
+		notifier:      newNotifier(),
+		views:         newViewRegistry(),
+		foreign:       newForeignRegistry(),
+		hooks:         map[int64][]func(){},
+		globals:       newGlobalVariables(level),
+		cursors:       newCursorRegistry(),
+		spill:         util.NewSpillManager(path+SpillDirSuffix, 0),
+		results:       newResultCache(ResultCacheCapacity),
+		counters:      newCounterBatcher(),
+		points:        newPointSelects(),
+		commitHooks:   newCommitHooks(),
 	}
+	db.scheduler = newEventScheduler(func(now time.Time) { db.RunEvents(now) })
+	db.reaper = newIdleReaper(func(now time.Time) { db.ReapIdleTransactions(now) })
+	db.loadDatabases()
+	db.loadEvents()
+	db.loadViews()
+	db.loadForeignTables()
+	db.loadVariables()
+	db.storageEngine.SetChangeSink(db.captureChange)
 	log.Printf("[Executor] Start executor\n")
-	return db
+	return db, nil
 }
 
 type ErrorIllegalOperation struct{}
@@ -0,0 +1,28 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strings"
+)
+
+// 闪回
+// flashback <table> to <timestamp> [where <field> <op> <value>]
+// timestamp的格式与AS OF相同, 见asOf.go
+
+func parseFlashback(args []string) (*tableManager.Flashback, error) {
+	if (len(args) != 4 && len(args) != 8) || strings.ToUpper(args[2]) != "TO" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	at, err := parseTimestamp(args[3])
+	if err != nil {
+		return nil, err
+	}
+	fb := &tableManager.Flashback{TbName: args[1], AsOf: at}
+	if len(args) == 8 {
+		if strings.ToUpper(args[4]) != "WHERE" {
+			return nil, &ErrorRequestArgNumber{}
+		}
+		fb.Where = &tableManager.Where{Compare: &tableManager.Compare{FieldName: args[5], CompareTo: args[6], Value: args[7]}}
+	}
+	return fb, nil
+}
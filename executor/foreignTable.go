@@ -0,0 +1,395 @@
+package executor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"myDB/exporter"
+	"myDB/tableManager"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 外部表
+// create foreign table <name> { <field> <type> , ... } from <file> [format csv|parquet] [header]
+// drop foreign table <name>
+// 外部表把一个外部文件按照声明的字段注册为表, 数据不导入数据库, 读取时扫描文件
+// 1. 格式: 没有format时按扩展名判断, .parquet为Parquet(见exporter/parquetReader.go), 其他为CSV
+//    CSV的列按顺序对应字段, header表示跳过第一行; Parquet的列按列名对应字段
+// 2. 读取: 文件扫描为内存中的relation(见cte.go), 按文件的修改时间和大小缓存
+//    select, count(*)以及CTE中的用法与普通表相同, 可以与普通表join(见join.go); 值不符合字段类型时返回ErrorInvalidForeignData
+// 3. 外部表只读, insert/update/delete返回ErrorModifyForeignTable
+// 定义记录在默认数据库的系统表sys_foreign_tables中, 创建和删除在事物提交之后生效
+
+const (
+	ForeignTable  string = "sys_foreign_tables"
+	FormatCsv     string = "csv"
+	FormatParquet string = "parquet"
+)
+
+type ErrorInvalidForeignTable struct{}
+type ErrorForeignTableNotExist struct{}
+type ErrorModifyForeignTable struct{}
+type ErrorInvalidForeignData struct{}
+
+func (err *ErrorInvalidForeignTable) Error() string {
+	return "Invalid foreign table"
+}
+
+func (err *ErrorForeignTableNotExist) Error() string {
+	return "Foreign table doesn't exist"
+}
+
+func (err *ErrorModifyForeignTable) Error() string {
+	return "Foreign table is read only"
+}
+
+func (err *ErrorInvalidForeignData) Error() string {
+	return "Foreign data doesn't match the table definition"
+}
+
+type CreateForeign struct {
+	Name   string
+	Fields []*tableManager.FieldCreate
+	File   string
+	Format string
+	Header bool // CSV的第一行为列名
+}
+
+type DropForeign struct {
+	Name string
+}
+
+type foreignTable struct {
+	name    string // 目录中的名字
+	file    string
+	format  string
+	header  bool
+	columns []string
+	types   []tableManager.FieldType
+
+	lock    sync.Mutex
+	cache   *relation
+	modTime time.Time
+	size    int64
+}
+
+type foreignRegistry struct {
+	lock   sync.Mutex
+	tables map[string]*foreignTable
+}
+
+func newForeignRegistry() *foreignRegistry {
+	return &foreignRegistry{tables: map[string]*foreignTable{}}
+}
+
+func (r *foreignRegistry) get(name string) *foreignTable {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.tables[name]
+}
+
+func (r *foreignRegistry) put(ft *foreignTable) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.tables[ft.name] = ft
+}
+
+func (r *foreignRegistry) remove(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.tables, name)
+}
+
+// parseCreateForeign args[0] == CREATE, args[1] == FOREIGN
+func parseCreateForeign(args []string) (*CreateForeign, error) {
+	if len(args) < 9 || strings.ToUpper(args[2]) != "TABLE" || args[4] != "{" {
+		return nil, &ErrorInvalidForeignTable{}
+	}
+	cre := &CreateForeign{Name: args[3], Fields: make([]*tableManager.FieldCreate, 0)}
+	end := -1
+	for i := 5; i < len(args); i++ {
+		if args[i] == "}" {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return nil, &ErrorInvalidForeignTable{}
+	}
+	// <field> <type> [, <field> <type>]...
+	for i := 5; i < end; i += 3 {
+		if i+1 >= end || (i+2 < end && args[i+2] != ",") {
+			return nil, &ErrorInvalidForeignTable{}
+		}
+		cre.Fields = append(cre.Fields, &tableManager.FieldCreate{FName: args[i], FType: args[i+1]})
+	}
+	rest := args[end+1:]
+	if len(cre.Fields) == 0 || len(rest) < 2 || strings.ToUpper(rest[0]) != "FROM" {
+		return nil, &ErrorInvalidForeignTable{}
+	}
+	cre.File = rest[1]
+	rest = rest[2:]
+	if len(rest) >= 2 && strings.ToUpper(rest[0]) == "FORMAT" {
+		cre.Format = strings.ToLower(rest[1])
+		rest = rest[2:]
+	}
+	if len(rest) == 1 && strings.ToUpper(rest[0]) == "HEADER" {
+		cre.Header = true
+		rest = rest[1:]
+	}
+	if cre.Format == "" {
+		cre.Format = FormatCsv
+		if strings.HasSuffix(strings.ToLower(cre.File), "."+FormatParquet) {
+			cre.Format = FormatParquet
+		}
+	}
+	if len(rest) > 0 || (cre.Format != FormatCsv && cre.Format != FormatParquet) || (cre.Header && cre.Format != FormatCsv) {
+		return nil, &ErrorInvalidForeignTable{}
+	}
+	return cre, nil
+}
+
+func newForeignTable(name string, cre *CreateForeign) (*foreignTable, error) {
+	ft := &foreignTable{name: name, file: cre.File, format: cre.Format, header: cre.Header}
+	seen := map[string]struct{}{}
+	for _, f := range cre.Fields {
+		fType, err := tableManager.TransToFieldType(f.FType)
+		if err != nil {
+			return nil, err
+		}
+		if _, ext := seen[f.FName]; ext || f.FName == tableManager.PrimaryKeyCol {
+			return nil, &tableManager.ErrorInvalidFieldName{}
+		}
+		seen[f.FName] = struct{}{}
+		ft.columns = append(ft.columns, f.FName)
+		ft.types = append(ft.types, fType)
+	}
+	return ft, nil
+}
+
+// definition 写入sys_foreign_tables的定义, 载入时重新解析
+func (ft *foreignTable) definition() string {
+	args := []string{"create", "foreign", "table", ft.name, "{"}
+	for i, c := range ft.columns {
+		if i > 0 {
+			args = append(args, ",")
+		}
+		args = append(args, c, typeName(ft.types[i]))
+	}
+	args = append(args, "}", "from", ft.file, "format", ft.format)
+	if ft.header {
+		args = append(args, "header")
+	}
+	return strings.Join(args, " ")
+}
+
+// scan 返回文件中的所有行, 文件没有变化时使用缓存
+func (ft *foreignTable) scan() (*relation, error) {
+	info, err := os.Stat(ft.file)
+	if err != nil {
+		return nil, err
+	}
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	if ft.cache != nil && ft.modTime.Equal(info.ModTime()) && ft.size == info.Size() {
+		return ft.cache, nil
+	}
+	var rows [][]string
+	if ft.format == FormatParquet {
+		rows, err = ft.readParquet()
+	} else {
+		rows, err = ft.readCsv()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for i, value := range row {
+			if !validForeignValue(ft.types[i], value) {
+				return nil, &ErrorInvalidForeignData{}
+			}
+		}
+	}
+	ft.cache = &relation{columns: ft.columns, types: ft.types, rows: rows}
+	ft.modTime, ft.size = info.ModTime(), info.Size()
+	log.Printf("[Executor] Scan foreign table %s, %d rows from %s\n", ft.name, len(rows), ft.file)
+	return ft.cache, nil
+}
+
+func (ft *foreignTable) readCsv() ([][]string, error) {
+	file, err := os.Open(ft.file)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = len(ft.columns)
+	rows := make([][]string, 0)
+	for first := true; ; first = false {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if errors.Is(err, csv.ErrFieldCount) {
+			return nil, &ErrorInvalidForeignData{}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !first || !ft.header {
+			rows = append(rows, row)
+		}
+	}
+}
+
+func (ft *foreignTable) readParquet() ([][]string, error) {
+	columns, data, err := exporter.ReadParquet(ft.file)
+	if err != nil {
+		return nil, err
+	}
+	// 字段 -> 文件中的列
+	index := make([]int, len(ft.columns))
+	for i, c := range ft.columns {
+		index[i] = -1
+		for j, col := range columns {
+			if col.Name == c {
+				index[i] = j
+			}
+		}
+		if index[i] == -1 {
+			return nil, &ErrorInvalidForeignData{}
+		}
+	}
+	rows := make([][]string, len(data))
+	for r, values := range data {
+		rows[r] = make([]string, len(index))
+		for i, j := range index {
+			rows[r][i] = values[j]
+		}
+	}
+	return rows, nil
+}
+
+func validForeignValue(fType tableManager.FieldType, value string) bool {
+	switch fType {
+	case tableManager.INT32:
+		_, err := strconv.ParseInt(value, 10, 32)
+		return err == nil
+	case tableManager.INT64:
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case tableManager.JSON:
+		return json.Valid([]byte(value))
+	}
+	return true
+}
+
+// createForeign 在xid事物中写入sys_foreign_tables, 提交之后生效
+func (db *NtDB) createForeign(session *Session, xid int64, cre *CreateForeign) error {
+	if xid == -1 {
+		return &ErrorIllegalOperation{}
+	}
+	name, err := db.resolveTable(session.Database, cre.Name)
+	if err != nil {
+		return err
+	}
+	if db.foreign.get(name) != nil || db.hasSystemTable(xid, name) {
+		return &tableManager.ErrorTableAlreadyExist{}
+	}
+	ft, err := newForeignTable(name, cre)
+	if err != nil {
+		return err
+	}
+	// 创建时检查文件是否可以读取
+	if _, err := ft.scan(); err != nil {
+		return err
+	}
+	if !db.hasSystemTable(xid, ForeignTable) {
+		sys := &tableManager.Create{
+			TbName: ForeignTable,
+			Fields: []*tableManager.FieldCreate{{FName: "name", FType: "string"}, {FName: "definition", FType: "string"}},
+		}
+		if err := db.storageEngine.Create(xid, sys); err != nil {
+			return err
+		}
+	}
+	if _, err := db.storageEngine.Insert(xid, &tableManager.Insert{TbName: ForeignTable, Values: []string{name, ft.definition()}}); err != nil {
+		return err
+	}
+	db.afterCommit(xid, func() { db.foreign.put(ft) })
+	return nil
+}
+
+// dropForeign 在xid事物中删除定义, 提交之后生效
+func (db *NtDB) dropForeign(session *Session, xid int64, drop *DropForeign) error {
+	if xid == -1 {
+		return &ErrorIllegalOperation{}
+	}
+	name, err := db.resolveTable(session.Database, drop.Name)
+	if err != nil {
+		return err
+	}
+	if db.foreign.get(name) == nil {
+		return &ErrorForeignTableNotExist{}
+	}
+	del := &tableManager.Delete{
+		TName: ForeignTable,
+		Where: &tableManager.Where{Compare: &tableManager.Compare{FieldName: "name", CompareTo: "=", Value: name}},
+	}
+	if _, err := db.storageEngine.Delete(xid, del); err != nil {
+		return err
+	}
+	db.afterCommit(xid, func() { db.foreign.remove(name) })
+	return nil
+}
+
+// selectForeign 在内存中对外部表执行select, 不需要事物
+func (db *NtDB) selectForeign(ft *foreignTable, sel *tableManager.Select) ([]*tableManager.ResponseObject, error) {
+	if isWindowQuery(sel.FNames) || !sel.AsOf.IsZero() {
+		return nil, &ErrorIllegalOperation{}
+	}
+	rel, err := ft.scan()
+	if err != nil {
+		return nil, err
+	}
+	return scanRelation(rel, sel)
+}
+
+// isForeign 外部表只读
+func (db *NtDB) isForeign(name string) bool {
+	return db.foreign.get(name) != nil
+}
+
+// loadForeignTables
+// 启动时载入sys_foreign_tables中的所有外部表, 文件在第一次读取时扫描
+func (db *NtDB) loadForeignTables() {
+	xid := db.storageEngine.Begin()
+	defer db.storageEngine.Commit(xid)
+	if !db.hasSystemTable(xid, ForeignTable) {
+		return
+	}
+	res, err := db.storageEngine.Select(xid, &tableManager.Select{TbName: ForeignTable, FNames: []string{"name", "definition"}})
+	if err != nil {
+		panic(err)
+	}
+	for _, row := range responseRows(res) {
+		cre, err := parseCreateForeign(strings.Fields(row["definition"]))
+		if err != nil {
+			log.Printf("[Executor] Skip foreign table %s with invalid definition\n", row["name"])
+			continue
+		}
+		ft, err := newForeignTable(row["name"], cre)
+		if err != nil {
+			log.Printf("[Executor] Skip foreign table %s, %s\n", row["name"], err)
+			continue
+		}
+		db.foreign.put(ft)
+	}
+	log.Printf("[Executor] Load %d foreign tables\n", len(db.foreign.tables))
+}
@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 插入热点报告
+// show hotspots [<table>]
+// 每个表一行汇总(page为total: 分配的页数以及插入, 溢出, 分裂次数), 之后是事件最多的页, 统计自数据库启动开始
+// 溢出多的页适合降低表的填充因子(create ... fillfactor <percent>), 插入集中在少数页时考虑更换键
+
+const DefaultHotPages = 5
+
+type ShowHotspots struct {
+	TbName string // 为空时展示当前数据库中的所有表
+}
+
+func isShowHotspots(args []string) bool {
+	return (len(args) == 2 || len(args) == 3) && strings.ToUpper(args[0]) == "SHOW" && strings.ToUpper(args[1]) == "HOTSPOTS"
+}
+
+func parseShowHotspots(args []string) *ShowHotspots {
+	show := &ShowHotspots{}
+	if len(args) == 3 {
+		show.TbName = args[2]
+	}
+	return show
+}
+
+func (db *NtDB) showHotspots(session *Session, show *ShowHotspots) ([]*tableManager.ResponseObject, error) {
+	name := ""
+	if show.TbName != "" {
+		resolved, err := db.resolveTable(session.Database, show.TbName)
+		if err != nil {
+			return nil, err
+		}
+		name = resolved
+	}
+	tables, err := db.storageEngine.Hotspots(name, DefaultHotPages)
+	if err != nil {
+		return nil, err
+	}
+	title := []string{"table", "page", "allocations", "inserts", "overflows", "splits"}
+	res := make([]*tableManager.ResponseObject, 0)
+	for j, column := range title {
+		res = append(res, &tableManager.ResponseObject{Payload: column, RowId: 0, ColId: j})
+	}
+	rowId := 1
+	appendRow := func(values ...string) {
+		for j, value := range values {
+			res = append(res, &tableManager.ResponseObject{Payload: value, RowId: rowId, ColId: j})
+		}
+		rowId += 1
+	}
+	format := func(n int64) string {
+		return strconv.FormatInt(n, 10)
+	}
+	for _, tb := range tables {
+		tbName := tb.Table
+		if index := strings.Index(tbName, Separator); session.Database == DefaultDatabase && index != -1 ||
+			session.Database != DefaultDatabase && (index == -1 || tbName[:index] != session.Database) {
+			continue
+		} else if index != -1 {
+			tbName = tbName[index+1:]
+		}
+		appendRow(tbName, "total", format(tb.Allocations), format(tb.Inserts), format(tb.Overflows), format(tb.Splits))
+		for _, page := range tb.Hot {
+			appendRow(tbName, format(page.PageId), "-", format(page.Inserts), format(page.Overflows), format(page.Splits))
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,223 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 等值连接
+// select <table>.<field> ... from <left> join <right> on <left>.<field> = <right>.<field> [where <table>.<field> <op> <value>]
+// 字段名以表名(与from中的写法相同)限定, 返回的列名与select中的写法相同
+// 两张表分别扫描为relation: 外部表直接读取文件, 普通表在当前事物中快照读(需要事物), where条件下推到所在的表
+// 以右表建立哈希表(占用语句的内存预算), 按左表的顺序输出匹配的行
+// 连接字段都是整数时按整数比较, 否则按字符串比较
+
+type Join struct {
+	FNames     []string
+	Left       string // 目录中的名字
+	Right      string
+	LeftAlias  string // 语句中的写法, 用于限定字段
+	RightAlias string
+	LeftKey    string
+	RightKey   string
+	Where      *tableManager.Compare // nil则没有where子句
+}
+
+type ErrorInvalidJoin struct{}
+
+func (err *ErrorInvalidJoin) Error() string {
+	return "Invalid join"
+}
+
+// isJoin select语句中包含join
+func isJoin(args []string) bool {
+	for _, arg := range args {
+		if strings.ToUpper(arg) == "JOIN" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseJoin args[0] == SELECT
+func parseJoin(args []string) (*Join, error) {
+	from := -1
+	for i, arg := range args {
+		if strings.ToUpper(arg) == "FROM" {
+			from = i
+			break
+		}
+	}
+	if from < 2 || len(args) < from+8 || strings.ToUpper(args[from+2]) != "JOIN" ||
+		strings.ToUpper(args[from+4]) != "ON" || args[from+6] != "=" {
+		return nil, &ErrorInvalidJoin{}
+	}
+	j := &Join{FNames: args[1:from], LeftAlias: args[from+1], RightAlias: args[from+3]}
+	j.Left, j.Right = j.LeftAlias, j.RightAlias
+	if j.LeftAlias == j.RightAlias {
+		return nil, &ErrorInvalidJoin{}
+	}
+	// on条件的两边可以交换
+	left, right := args[from+5], args[from+7]
+	if table, _ := splitQualified(left); table == j.RightAlias {
+		left, right = right, left
+	}
+	if table, _ := splitQualified(left); table != j.LeftAlias {
+		return nil, &ErrorInvalidJoin{}
+	}
+	if table, _ := splitQualified(right); table != j.RightAlias {
+		return nil, &ErrorInvalidJoin{}
+	}
+	j.LeftKey, j.RightKey = left, right
+	for _, f := range j.FNames {
+		if table, _ := splitQualified(f); table != j.LeftAlias && table != j.RightAlias {
+			return nil, &ErrorInvalidJoin{}
+		}
+	}
+	rest := args[from+8:]
+	if len(rest) > 0 {
+		if len(rest) != 4 || strings.ToUpper(rest[0]) != "WHERE" {
+			return nil, &ErrorInvalidJoin{}
+		}
+		if table, _ := splitQualified(rest[1]); table != j.LeftAlias && table != j.RightAlias {
+			return nil, &ErrorInvalidJoin{}
+		}
+		j.Where = &tableManager.Compare{FieldName: rest[1], CompareTo: rest[2], Value: rest[3]}
+	}
+	return j, nil
+}
+
+// splitQualified <table>.<field>, 表名可能包含数据库名, 按最后一个分隔符拆分
+func splitQualified(name string) (string, string) {
+	index := strings.LastIndex(name, Separator)
+	if index == -1 {
+		return "", name
+	}
+	return name[:index], name[index+1:]
+}
+
+// join
+func (db *NtDB) join(session *Session, xid int64, j *Join) ([]*tableManager.ResponseObject, error) {
+	left, err := db.joinInput(session, xid, j.Left, j.LeftAlias, j.Where)
+	if err != nil {
+		return nil, err
+	}
+	right, err := db.joinInput(session, xid, j.Right, j.RightAlias, j.Where)
+	if err != nil {
+		return nil, err
+	}
+	column := func(rel *relation, qualified string) int {
+		_, field := splitQualified(qualified)
+		for i, c := range rel.columns {
+			if c == field {
+				return i
+			}
+		}
+		return -1
+	}
+	lk, rk := column(left, j.LeftKey), column(right, j.RightKey)
+	if lk == -1 || rk == -1 {
+		return nil, &tableManager.ErrorInvalidFieldName{}
+	}
+	// 输出的每一列: 来自左表(true)或者右表, 以及列号
+	fromLeft := make([]bool, len(j.FNames))
+	target := make([]int, len(j.FNames))
+	for i, f := range j.FNames {
+		table, _ := splitQualified(f)
+		fromLeft[i] = table == j.LeftAlias
+		if fromLeft[i] {
+			target[i] = column(left, f)
+		} else {
+			target[i] = column(right, f)
+		}
+		if target[i] == -1 {
+			return nil, &tableManager.ErrorFieldNotExist{}
+		}
+	}
+	numeric := isInteger(left.types[lk]) && isInteger(right.types[rk])
+	mem := db.queryBudget(session)
+	hash := make(map[string][]int, len(right.rows))
+	for i, row := range right.rows {
+		if err := reserveRow(mem, row); err != nil {
+			return nil, err
+		}
+		key := joinKey(row[rk], numeric)
+		hash[key] = append(hash[key], i)
+	}
+	ret := make([]*tableManager.ResponseObject, 0)
+	for colId, f := range j.FNames {
+		ret = append(ret, &tableManager.ResponseObject{Payload: f, RowId: 0, ColId: colId})
+	}
+	rowId := 1
+	for _, row := range left.rows {
+		for _, r := range hash[joinKey(row[lk], numeric)] {
+			for colId, i := range target {
+				value := right.rows[r][i]
+				if fromLeft[colId] {
+					value = row[i]
+				}
+				ret = append(ret, &tableManager.ResponseObject{Payload: value, RowId: rowId, ColId: colId})
+			}
+			rowId += 1
+		}
+	}
+	return ret, nil
+}
+
+// joinInput 扫描连接的一张表, where条件属于这张表时下推
+func (db *NtDB) joinInput(session *Session, xid int64, name, alias string, where *tableManager.Compare) (*relation, error) {
+	sel := &tableManager.Select{TbName: name, Where: &tableManager.Where{}}
+	if where != nil {
+		if table, field := splitQualified(where.FieldName); table == alias {
+			sel.Where.Compare = &tableManager.Compare{FieldName: field, CompareTo: where.CompareTo, Value: where.Value}
+		}
+	}
+	if ft := db.foreign.get(name); ft != nil {
+		rel, err := ft.scan()
+		if err != nil {
+			return nil, err
+		}
+		sel.FNames = rel.columns
+		res, err := scanRelation(rel, sel)
+		if err != nil {
+			return nil, err
+		}
+		filtered := responseRelation(res)
+		filtered.types = rel.types
+		return filtered, nil
+	}
+	if xid == -1 {
+		return nil, &ErrorIllegalOperation{}
+	}
+	fields, err := db.storageEngine.Describe(xid, name)
+	if err != nil {
+		return nil, err
+	}
+	types := make([]tableManager.FieldType, 0, len(fields))
+	for _, f := range fields {
+		sel.FNames = append(sel.FNames, f.GetName())
+		types = append(types, f.GetFType())
+	}
+	res, err := db.selectQuery(session, xid, sel)
+	if err != nil {
+		return nil, err
+	}
+	rel := responseRelation(res)
+	rel.types = types
+	return rel, nil
+}
+
+func isInteger(fType tableManager.FieldType) bool {
+	return fType == tableManager.INT32 || fType == tableManager.INT64
+}
+
+// joinKey 整数统一为十进制表示
+func joinKey(value string, numeric bool) string {
+	if numeric {
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return strconv.FormatInt(v, 10)
+		}
+	}
+	return value
+}
@@ -0,0 +1,706 @@
+package executor
+
+import (
+	"log"
+	"myDB/tableManager"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 物化视图
+// create materialized view <name> as select <item>... from <table> [where <field> <op> <value>] [group by <field>]
+// refresh materialized view <name>
+// item := <field> | count(*) | count(<field>) | sum(<field>) | min(<field>) | max(<field>)
+// 视图的结果保存在同名的表中, 通过普通的select读取, 列名为字段名以及 count, sum_<field>, min_<field>, max_<field>
+// 视图的定义记录在默认数据库的系统表sys_views中, 创建视图的事物提交之后开始维护
+// 1. 手动刷新: refresh在当前事物中删除视图表中的所有行(持有视图表的表锁), 当前读基表, 重新写入结果
+// 2. 增量维护: 只包含分组字段, count以及sum的聚合视图(分组视图必须包含count), 由变更流(tableManager/changeStream.go)驱动
+//    事物中对基表的修改暂存在事物中, 提交之前在同一个事物中按分组合并:
+//    每个分组删除旧的结果行(当前读, 持有视图表的表锁), 加上增量之后写入新的结果行, 分组的count为0时不再写入
+//    视图与基表在同一个事物中提交, 维护失败时事物回滚
+// 其他视图只能手动刷新; 视图表只能通过维护和刷新修改
+// 创建视图的事物提交之前, 其他事物对基表的修改不会被维护, 需要refresh
+
+const ViewTable string = "sys_views"
+
+type ErrorInvalidView struct{}
+type ErrorViewNotExist struct{}
+type ErrorModifyView struct{}
+
+func (err *ErrorInvalidView) Error() string {
+	return "Invalid materialized view"
+}
+
+func (err *ErrorViewNotExist) Error() string {
+	return "Materialized view doesn't exist"
+}
+
+func (err *ErrorModifyView) Error() string {
+	return "Materialized view can only be modified by refresh"
+}
+
+type CreateView struct {
+	Name  string
+	Query []string // select ...
+}
+
+type RefreshView struct {
+	Name string
+}
+
+type viewItem struct {
+	column   string
+	field    string // 普通字段或者聚合函数的参数, count(*)时为空
+	function string // 大写函数名, 普通字段时为空
+}
+
+type view struct {
+	name        string   // 目录中的名字
+	base        string   // 基表在目录中的名字
+	query       []string // 定义, 基表为目录中的名字
+	items       []*viewItem
+	where       *tableManager.Compare
+	groupBy     string
+	types       map[string]tableManager.FieldType // 基表字段的类型
+	aggregate   bool
+	incremental bool
+}
+
+type viewRegistry struct {
+	lock    sync.Mutex
+	views   map[string]*view
+	pending map[int64][]*tableManager.Change // 事物中对增量维护视图的基表的修改
+}
+
+func newViewRegistry() *viewRegistry {
+	return &viewRegistry{views: map[string]*view{}, pending: map[int64][]*tableManager.Change{}}
+}
+
+func (r *viewRegistry) get(name string) *view {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.views[name]
+}
+
+// capture 变更流的sink
+func (r *viewRegistry) capture(change *tableManager.Change) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, v := range r.views {
+		if v.incremental && v.base == change.TbName {
+			r.pending[change.Xid] = append(r.pending[change.Xid], change)
+			return
+		}
+	}
+}
+
+// take 取出xid暂存的修改以及需要维护的视图(按名字排序)
+func (r *viewRegistry) take(xid int64) ([]*tableManager.Change, []*view) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	changes := r.pending[xid]
+	delete(r.pending, xid)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	bases := map[string]struct{}{}
+	for _, change := range changes {
+		bases[change.TbName] = struct{}{}
+	}
+	views := make([]*view, 0)
+	for _, v := range r.views {
+		if _, ext := bases[v.base]; ext && v.incremental {
+			views = append(views, v)
+		}
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].name < views[j].name })
+	return changes, views
+}
+
+func (r *viewRegistry) discard(xid int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.pending, xid)
+}
+
+// parseCreateView create materialized view <name> as select ...
+func parseCreateView(args []string) (*CreateView, error) {
+	if len(args) < 9 || strings.ToUpper(args[2]) != "VIEW" || strings.ToUpper(args[4]) != "AS" || strings.ToUpper(args[5]) != "SELECT" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	return &CreateView{Name: args[3], Query: args[5:]}, nil
+}
+
+// parseViewQuery select <item>... from <table> [where <field> <op> <value>] [group by <field>]
+func parseViewQuery(query []string) (*view, int, error) {
+	from := -1
+	for i := 1; i < len(query); i++ {
+		if strings.ToUpper(query[i]) == "FROM" {
+			from = i
+			break
+		}
+	}
+	if from <= 1 || from == len(query)-1 {
+		return nil, -1, &ErrorInvalidView{}
+	}
+	v := &view{base: query[from+1], query: query}
+	tokens := tokenizeWindow(query[1:from])
+	for pos := 0; pos < len(tokens); pos++ {
+		if tokens[pos] == "," {
+			continue
+		}
+		if pos+1 >= len(tokens) || tokens[pos+1] != "(" {
+			v.items = append(v.items, &viewItem{column: tokens[pos], field: tokens[pos]})
+			continue
+		}
+		if pos+3 >= len(tokens) || tokens[pos+3] != ")" {
+			return nil, -1, &ErrorInvalidView{}
+		}
+		item := &viewItem{function: strings.ToUpper(tokens[pos]), field: tokens[pos+2]}
+		switch {
+		case item.function == "COUNT":
+			item.column = "count"
+			if item.field == "*" {
+				item.field = ""
+			}
+		case item.function == "SUM" || item.function == "MIN" || item.function == "MAX":
+			item.column = strings.ToLower(item.function) + "_" + item.field
+		default:
+			return nil, -1, &ErrorInvalidView{}
+		}
+		v.items = append(v.items, item)
+		pos += 3
+	}
+	rest := query[from+2:]
+	if len(rest) >= 4 && strings.ToUpper(rest[0]) == "WHERE" {
+		v.where = &tableManager.Compare{FieldName: rest[1], CompareTo: rest[2], Value: rest[3]}
+		rest = rest[4:]
+	}
+	if len(rest) == 3 && strings.ToUpper(rest[0]) == "GROUP" && strings.ToUpper(rest[1]) == "BY" {
+		v.groupBy = rest[2]
+		rest = rest[3:]
+	}
+	if len(rest) != 0 {
+		return nil, -1, &ErrorInvalidView{}
+	}
+	return v, from + 1, nil
+}
+
+// newView fields为基表的所有字段
+func newView(name string, query []string, fields []tableManager.Field) (*view, error) {
+	v, _, err := parseViewQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	v.name = name
+	v.types = map[string]tableManager.FieldType{}
+	for _, field := range fields {
+		v.types[field.GetName()] = field.GetFType()
+	}
+	has := func(field string) bool {
+		_, ext := v.types[field]
+		return ext
+	}
+	columns := map[string]struct{}{tableManager.PrimaryKeyCol: {}}
+	hasCount, groupSelected := false, false
+	v.incremental = true
+	for _, item := range v.items {
+		if _, ext := columns[item.column]; ext {
+			return nil, &ErrorInvalidView{}
+		}
+		columns[item.column] = struct{}{}
+		if item.field != "" && !has(item.field) {
+			return nil, &ErrorInvalidView{}
+		}
+		switch item.function {
+		case "":
+			groupSelected = groupSelected || item.field == v.groupBy
+		case "COUNT":
+			v.aggregate, hasCount = true, true
+		case "SUM":
+			if t := v.types[item.field]; t != tableManager.INT32 && t != tableManager.INT64 {
+				return nil, &ErrorInvalidView{}
+			}
+			v.aggregate = true
+		default:
+			v.aggregate, v.incremental = true, false
+		}
+	}
+	if v.groupBy != "" {
+		if !has(v.groupBy) || !groupSelected {
+			return nil, &ErrorInvalidView{}
+		}
+		v.aggregate = true
+	}
+	if v.aggregate {
+		// 聚合视图中的普通字段只能是分组字段
+		for _, item := range v.items {
+			if item.function == "" && item.field != v.groupBy {
+				return nil, &ErrorInvalidView{}
+			}
+		}
+	}
+	if v.where != nil {
+		switch v.where.CompareTo {
+		case "=", ">", "<", ">=", "<=":
+		default:
+			return nil, &ErrorInvalidView{}
+		}
+		if !has(v.where.FieldName) {
+			return nil, &ErrorInvalidView{}
+		}
+	}
+	v.incremental = v.incremental && v.aggregate && (hasCount || v.groupBy == "")
+	return v, nil
+}
+
+// columnType 视图列的类型
+func (v *view) columnType(item *viewItem) tableManager.FieldType {
+	switch item.function {
+	case "COUNT", "SUM":
+		return tableManager.INT64
+	}
+	return v.types[item.field]
+}
+
+func (v *view) columns() []string {
+	ret := make([]string, len(v.items))
+	for i, item := range v.items {
+		ret[i] = item.column
+	}
+	return ret
+}
+
+// match values为基表一行中每个字段的值
+func (v *view) match(values map[string]string) bool {
+	if v.where == nil {
+		return true
+	}
+	compare := tableManager.DefaultFieldFactory.GetCompareFunction(v.types[v.where.FieldName])(values[v.where.FieldName], v.where.Value)
+	switch v.where.CompareTo {
+	case "=":
+		return compare == 0
+	case ">":
+		return compare == 1
+	case "<":
+		return compare == -1
+	case ">=":
+		return compare >= 0
+	default:
+		return compare <= 0
+	}
+}
+
+// aggState 一个分组的聚合值, 与items一一对应
+type aggState struct {
+	count  int64
+	values []int64  // count, sum
+	bounds []string // min, max
+	seen   bool
+}
+
+func (v *view) newState() *aggState {
+	return &aggState{values: make([]int64, len(v.items)), bounds: make([]string, len(v.items))}
+}
+
+// accumulate sign为-1时撤销一行, min, max只能累加
+func (v *view) accumulate(s *aggState, values map[string]string, sign int64) error {
+	s.count += sign
+	for i, item := range v.items {
+		switch item.function {
+		case "COUNT":
+			s.values[i] += sign
+		case "SUM":
+			n, err := strconv.ParseInt(values[item.field], 10, 64)
+			if err != nil {
+				return err
+			}
+			s.values[i] += sign * n
+		case "MIN", "MAX":
+			if !s.seen {
+				s.bounds[i] = values[item.field]
+				continue
+			}
+			compare := tableManager.DefaultFieldFactory.GetCompareFunction(v.types[item.field])(values[item.field], s.bounds[i])
+			if (item.function == "MIN" && compare < 0) || (item.function == "MAX" && compare > 0) {
+				s.bounds[i] = values[item.field]
+			}
+		}
+	}
+	s.seen = true
+	return nil
+}
+
+// merge 将增量delta合并到s中
+func (v *view) merge(s, delta *aggState) {
+	s.count += delta.count
+	for i := range v.items {
+		s.values[i] += delta.values[i]
+	}
+}
+
+// restore 由视图表中的一行(列名 -> 值)恢复分组的聚合值
+func (v *view) restore(row map[string]string) (*aggState, error) {
+	s := v.newState()
+	for i, item := range v.items {
+		if item.function == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(row[item.column], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		s.values[i] = n
+		if item.function == "COUNT" {
+			s.count = n
+		}
+	}
+	return s, nil
+}
+
+// result 分组key的结果行
+func (v *view) result(key string, s *aggState) []string {
+	ret := make([]string, len(v.items))
+	for i, item := range v.items {
+		switch item.function {
+		case "":
+			ret[i] = key
+		case "COUNT", "SUM":
+			ret[i] = strconv.FormatInt(s.values[i], 10)
+		default:
+			ret[i] = s.bounds[i]
+		}
+	}
+	return ret
+}
+
+// groupKey 没有group by时所有行在同一个分组
+func (v *view) groupKey(values map[string]string) string {
+	if v.groupBy == "" {
+		return ""
+	}
+	return values[v.groupBy]
+}
+
+func (v *view) sortKeys(keys []string) {
+	if v.groupBy == "" {
+		return
+	}
+	compare := tableManager.DefaultFieldFactory.GetCompareFunction(v.types[v.groupBy])
+	sort.Slice(keys, func(i, j int) bool { return compare(keys[i], keys[j]) < 0 })
+}
+
+// responseRows 将结果按行转换为 列名 -> 值
+func responseRows(res []*tableManager.ResponseObject) []map[string]string {
+	titles := map[int]string{}
+	rows := make([]map[string]string, 0)
+	for _, r := range res {
+		if r.RowId == 0 {
+			titles[r.ColId] = r.Payload
+			continue
+		}
+		for len(rows) < r.RowId {
+			rows = append(rows, map[string]string{})
+		}
+		rows[r.RowId-1][titles[r.ColId]] = r.Payload
+	}
+	return rows
+}
+
+// computeView 当前读基表, 返回视图的所有结果行
+func (db *NtDB) computeView(xid int64, v *view) ([][]string, error) {
+	fields := make([]string, 0)
+	needed := map[string]struct{}{}
+	for _, field := range append([]string{v.groupBy}, v.sourceFields()...) {
+		if _, ext := needed[field]; !ext && field != "" {
+			needed[field] = struct{}{}
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		fields = append(fields, tableManager.PrimaryKeyCol)
+	}
+	sel := &tableManager.Select{TbName: v.base, FNames: fields, ReadForUpdate: true}
+	if v.where != nil {
+		sel.Where = &tableManager.Where{Compare: v.where}
+	}
+	res, err := db.storageEngine.Select(xid, sel)
+	if err != nil {
+		return nil, err
+	}
+	rows := responseRows(res)
+	ret := make([][]string, 0)
+	if !v.aggregate {
+		for _, row := range rows {
+			values := make([]string, len(v.items))
+			for i, item := range v.items {
+				values[i] = row[item.field]
+			}
+			ret = append(ret, values)
+		}
+		return ret, nil
+	}
+	groups := map[string]*aggState{}
+	keys := make([]string, 0)
+	if v.groupBy == "" {
+		groups[""], keys = v.newState(), append(keys, "")
+	}
+	for _, row := range rows {
+		key := v.groupKey(row)
+		if groups[key] == nil {
+			groups[key] = v.newState()
+			keys = append(keys, key)
+		}
+		if err := v.accumulate(groups[key], row, 1); err != nil {
+			return nil, err
+		}
+	}
+	v.sortKeys(keys)
+	for _, key := range keys {
+		ret = append(ret, v.result(key, groups[key]))
+	}
+	return ret, nil
+}
+
+// sourceFields 聚合函数的参数以及普通字段
+func (v *view) sourceFields() []string {
+	ret := make([]string, 0, len(v.items))
+	for _, item := range v.items {
+		ret = append(ret, item.field)
+	}
+	return ret
+}
+
+// createView 在xid事物中创建视图表, 写入sys_views并填充结果
+func (db *NtDB) createView(session *Session, xid int64, cre *CreateView) error {
+	if xid == -1 {
+		return &ErrorIllegalOperation{}
+	}
+	name, err := db.resolveTable(session.Database, cre.Name)
+	if err != nil {
+		return err
+	}
+	parsed, baseAt, err := parseViewQuery(cre.Query)
+	if err != nil {
+		return err
+	}
+	base, err := db.resolveTable(session.Database, parsed.base)
+	if err != nil {
+		return err
+	}
+	if db.views.get(base) != nil || base == name {
+		return &ErrorInvalidView{}
+	}
+	query := append([]string{}, cre.Query...)
+	query[baseAt] = base
+	fields, err := db.storageEngine.Describe(xid, base)
+	if err != nil {
+		return err
+	}
+	v, err := newView(name, query, fields)
+	if err != nil {
+		return err
+	}
+	create := &tableManager.Create{TbName: name, Fields: make([]*tableManager.FieldCreate, 0, len(v.items))}
+	for _, item := range v.items {
+		create.Fields = append(create.Fields, &tableManager.FieldCreate{FName: item.column, FType: typeName(v.columnType(item))})
+	}
+	if err := db.storageEngine.Create(xid, create); err != nil {
+		return err
+	}
+	if !db.hasSystemTable(xid, ViewTable) {
+		sys := &tableManager.Create{
+			TbName: ViewTable,
+			Fields: []*tableManager.FieldCreate{{FName: "name", FType: "string"}, {FName: "definition", FType: "string"}},
+		}
+		if err := db.storageEngine.Create(xid, sys); err != nil {
+			return err
+		}
+	}
+	if _, err := db.storageEngine.Insert(xid, &tableManager.Insert{TbName: ViewTable, Values: []string{name, strings.Join(query, " ")}}); err != nil {
+		return err
+	}
+	if err := db.fillView(xid, v); err != nil {
+		return err
+	}
+	db.afterCommit(xid, func() {
+		db.views.lock.Lock()
+		defer db.views.lock.Unlock()
+		db.views.views[v.name] = v
+	})
+	return nil
+}
+
+// refreshView 在xid事物中重新计算视图
+func (db *NtDB) refreshView(session *Session, xid int64, refresh *RefreshView) error {
+	if xid == -1 {
+		return &ErrorIllegalOperation{}
+	}
+	name, err := db.resolveTable(session.Database, refresh.Name)
+	if err != nil {
+		return err
+	}
+	v := db.views.get(name)
+	if v == nil {
+		return &ErrorViewNotExist{}
+	}
+	// 先删除视图表中的所有行, 持有视图表的表锁之后当前读基表
+	if _, err := db.storageEngine.Delete(xid, &tableManager.Delete{TName: v.name}); err != nil {
+		return err
+	}
+	return db.fillView(xid, v)
+}
+
+func (db *NtDB) fillView(xid int64, v *view) error {
+	rows, err := db.computeView(xid, v)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err := db.storageEngine.Insert(xid, &tableManager.Insert{TbName: v.name, Values: row}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maintainViews 将xid对基表的修改按分组合并到增量维护的视图中
+func (db *NtDB) maintainViews(xid int64) error {
+	changes, views := db.views.take(xid)
+	for _, v := range views {
+		deltas := map[string]*aggState{}
+		keys := make([]string, 0)
+		apply := func(values []string, fields []tableManager.Field, sign int64) error {
+			if values == nil {
+				return nil
+			}
+			row := make(map[string]string, len(fields))
+			for i, field := range fields {
+				row[field.GetName()] = values[i]
+			}
+			if !v.match(row) {
+				return nil
+			}
+			key := v.groupKey(row)
+			if deltas[key] == nil {
+				deltas[key] = v.newState()
+				keys = append(keys, key)
+			}
+			return v.accumulate(deltas[key], row, sign)
+		}
+		for _, change := range changes {
+			if change.TbName != v.base {
+				continue
+			}
+			if err := apply(change.Old, change.Fields, -1); err != nil {
+				return err
+			}
+			if err := apply(change.New, change.Fields, 1); err != nil {
+				return err
+			}
+		}
+		v.sortKeys(keys)
+		for _, key := range keys {
+			if err := db.applyDelta(xid, v, key, deltas[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyDelta 删除分组key的旧结果行(当前读), 合并增量之后写入新的结果行
+func (db *NtDB) applyDelta(xid int64, v *view, key string, delta *aggState) error {
+	changed := delta.count != 0
+	for _, value := range delta.values {
+		changed = changed || value != 0
+	}
+	if !changed {
+		return nil
+	}
+	del := &tableManager.Delete{TName: v.name, Returning: v.columns()}
+	if v.groupBy != "" {
+		del.Where = &tableManager.Where{Compare: &tableManager.Compare{FieldName: v.groupBy, CompareTo: "=", Value: key}}
+	}
+	res, err := db.storageEngine.Delete(xid, del)
+	if err != nil {
+		return err
+	}
+	current := v.newState()
+	if rows := responseRows(res); len(rows) > 0 {
+		if current, err = v.restore(rows[0]); err != nil {
+			return err
+		}
+	}
+	v.merge(current, delta)
+	if v.groupBy != "" && current.count <= 0 {
+		return nil
+	}
+	_, err = db.storageEngine.Insert(xid, &tableManager.Insert{TbName: v.name, Values: v.result(key, current)})
+	return err
+}
+
+// references name为视图或者视图的基表
+func (r *viewRegistry) references(name string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, v := range r.views {
+		if v.name == name || v.base == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isView 视图表只能通过维护和刷新修改
+func (db *NtDB) isView(name string) bool {
+	return db.views.get(name) != nil
+}
+
+func typeName(t tableManager.FieldType) string {
+	switch t {
+	case tableManager.INT32:
+		return "int32"
+	case tableManager.INT64:
+		return "int64"
+	case tableManager.JSON:
+		return "json"
+	}
+	return "string"
+}
+
+// loadViews
+// 启动时载入sys_views中的所有视图
+func (db *NtDB) loadViews() {
+	xid := db.storageEngine.Begin()
+	defer db.storageEngine.Commit(xid)
+	if !db.hasSystemTable(xid, ViewTable) {
+		return
+	}
+	res, err := db.storageEngine.Select(xid, &tableManager.Select{TbName: ViewTable, FNames: []string{"name", "definition"}})
+	if err != nil {
+		panic(err)
+	}
+	for _, row := range responseRows(res) {
+		query := strings.Fields(row["definition"])
+		parsed, _, err := parseViewQuery(query)
+		if err != nil {
+			log.Printf("[Executor] Skip materialized view %s with invalid definition\n", row["name"])
+			continue
+		}
+		fields, err := db.storageEngine.Describe(xid, parsed.base)
+		if err != nil {
+			log.Printf("[Executor] Skip materialized view %s, %s\n", row["name"], err)
+			continue
+		}
+		v, err := newView(row["name"], query, fields)
+		if err != nil {
+			log.Printf("[Executor] Skip materialized view %s, %s\n", row["name"], err)
+			continue
+		}
+		db.views.views[v.name] = v
+	}
+	log.Printf("[Executor] Load %d materialized views\n", len(db.views.views))
+}
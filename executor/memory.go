@@ -0,0 +1,55 @@
+package executor
+
+import (
+	util "myDB/dataStructure"
+	"myDB/storageEngine"
+	"myDB/tableManager"
+)
+
+// 查询内存管理
+// 每条语句使用一个内存预算(见dataStructure/memory.go), 语句内部执行的查询(CTE, 窗口函数)共享这个预算
+// 上限为会话的查询内存(sort_memory以及资源组的限制, 见variables.go), 0表示不限制
+// 窗口函数的排序在预算不足时溢出到磁盘; CTE物化的结果以及去重的哈希表不能溢出, 超过预算时返回ErrorOutOfQueryMemory
+// 溢出文件位于<path>.spill目录, 由所有查询共享, 启动时清理
+
+const SpillDirSuffix string = ".spill"
+
+// beginQuery 为会话的当前语句创建内存预算, 已经在语句中时(内部执行的查询)返回false
+func (db *NtDB) beginQuery(session *Session) bool {
+	if session.memory != nil {
+		return false
+	}
+	session.memory = util.NewMemoryBudget(db.queryMemory(session), db.spill)
+	return true
+}
+
+// queryBudget 会话当前语句的内存预算, 不在语句中时使用一个新的预算
+func (db *NtDB) queryBudget(session *Session) *util.MemoryBudget {
+	if session.memory != nil {
+		return session.memory
+	}
+	return util.NewMemoryBudget(db.queryMemory(session), db.spill)
+}
+
+// reserveRow 在预算中占用一行, 超过预算时返回ErrorOutOfQueryMemory
+func reserveRow(mem *util.MemoryBudget, row []string) error {
+	if !mem.Reserve(util.RowSize(row)) {
+		return &tableManager.ErrorOutOfQueryMemory{}
+	}
+	return nil
+}
+
+// SetSpillLimit 所有查询的溢出文件的总字节数上限, 0表示不限制
+func (db *NtDB) SetSpillLimit(limit int64) {
+	db.spill.SetLimit(limit)
+}
+
+// spillMetrics 溢出文件的统计, 见showMetrics
+func (db *NtDB) spillMetrics() []storageEngine.Metric {
+	stats := db.spill.Stats()
+	return []storageEngine.Metric{
+		{Name: "spill_files", Value: stats.Files},
+		{Name: "spill_bytes", Value: stats.Bytes},
+		{Name: "spill_bytes_total", Value: stats.TotalBytes},
+	}
+}
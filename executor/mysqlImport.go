@@ -0,0 +1,702 @@
+package executor
+
+import (
+	"encoding/hex"
+	"myDB/tableManager"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 从mysqldump导入
+// import mysql <file> [batch <n>]
+// 解析mysqldump的输出: CREATE TABLE创建表, INSERT(包括多行的extended insert以及带字段列表的complete insert)导入数据
+// 注释, 条件注释(/*!...*/), DELIMITER, SET, LOCK TABLES, DROP TABLE等其他语句忽略
+// 类型映射: tinyint, smallint, mediumint, int, year, bool为int32(int unsigned为int64), bigint为int64(bigint unsigned为string), json为json, 其他类型为string
+// 单字段的PRIMARY KEY, UNIQUE KEY, KEY标记为indexed, 其他约束, 默认值, 自增以及表选项不导入; 字段名不能为主键名ID
+// myDB没有NULL, NULL导入为字段类型的零值("", 0, null)并在结果中计数
+// 没有CREATE TABLE的表(--no-create-info)导入到当前数据库中已经存在的同名表
+// 每个表创建于独立的事物中, 数据与load相同每批n行在独立的事物中经过批量插入路径导入; 不能在事物中执行
+// 出错时已经导入的表和批次不回滚, 不支持断点继续; 文件整个读入内存, 面向小型应用的迁移
+
+type ErrorInvalidMysqlDump struct{}
+
+func (err *ErrorInvalidMysqlDump) Error() string {
+	return "Invalid or unsupported statement in mysqldump file"
+}
+
+type MysqlImport struct {
+	File  string
+	Batch int
+}
+
+// mysqlTable 导入的表, columns不包括主键
+type mysqlTable struct {
+	name    string
+	columns []string
+	types   []string
+	rows    int64
+	nulls   int64
+	pending [][]string
+}
+
+// parseMysqlImport args[0] == IMPORT
+func parseMysqlImport(args []string) (*MysqlImport, error) {
+	if (len(args) != 3 && len(args) != 5) || strings.ToUpper(args[1]) != "MYSQL" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	imp := &MysqlImport{File: args[2], Batch: DefaultBulkLoadBatch}
+	if len(args) == 5 {
+		n, err := strconv.Atoi(args[4])
+		if strings.ToUpper(args[3]) != "BATCH" || err != nil || n <= 0 {
+			return nil, &ErrorInvalidEntity{}
+		}
+		imp.Batch = n
+	}
+	return imp, nil
+}
+
+// importMysql 返回每个表导入的行数以及其中的NULL个数
+func (db *NtDB) importMysql(session *Session, xid int64, imp *MysqlImport) ([]*tableManager.ResponseObject, error) {
+	if xid != -1 {
+		return nil, &ErrorIllegalOperation{}
+	}
+	data, err := os.ReadFile(imp.File)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := splitMysqlStatements(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var order []*mysqlTable
+	tables := map[string]*mysqlTable{}
+	var current *mysqlTable
+	flush := func() error {
+		if current == nil || len(current.pending) == 0 {
+			return nil
+		}
+		err := db.importBatch(current.name, current.pending)
+		current.pending = nil
+		return err
+	}
+	for _, stmt := range statements {
+		head := stmt
+		if len(head) > 32 {
+			head = head[:32]
+		}
+		words := strings.Fields(strings.ToUpper(head))
+		switch {
+		case len(words) >= 2 && words[0] == "CREATE" && words[1] == "TABLE":
+			create, err := parseMysqlCreate(stmt)
+			if err != nil {
+				return nil, err
+			}
+			if create.TbName, err = db.resolveTable(session.Database, create.TbName); err != nil {
+				return nil, err
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			tb, err := db.importCreate(create)
+			if err != nil {
+				return nil, err
+			}
+			tables[tb.name] = tb
+			order = append(order, tb)
+		case len(words) >= 1 && (words[0] == "INSERT" || words[0] == "REPLACE"):
+			name, columns, rows, err := parseMysqlInsert(stmt)
+			if err != nil {
+				return nil, err
+			}
+			if name, err = db.resolveTable(session.Database, name); err != nil {
+				return nil, err
+			}
+			tb, ext := tables[name]
+			if !ext {
+				if tb, err = db.importExisting(name); err != nil {
+					return nil, err
+				}
+				tables[name] = tb
+				order = append(order, tb)
+			}
+			if tb != current {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				current = tb
+			}
+			for _, row := range rows {
+				values, err := tb.convert(columns, row)
+				if err != nil {
+					return nil, err
+				}
+				tb.pending = append(tb.pending, values)
+				tb.rows++
+				if len(tb.pending) >= imp.Batch {
+					if err := flush(); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	res := []*tableManager.ResponseObject{
+		{Payload: "table", RowId: 0, ColId: 0},
+		{Payload: "rows", RowId: 0, ColId: 1},
+		{Payload: "nulls", RowId: 0, ColId: 2},
+	}
+	for i, tb := range order {
+		res = append(res,
+			&tableManager.ResponseObject{Payload: tb.name, RowId: i + 1, ColId: 0},
+			&tableManager.ResponseObject{Payload: strconv.FormatInt(tb.rows, 10), RowId: i + 1, ColId: 1},
+			&tableManager.ResponseObject{Payload: strconv.FormatInt(tb.nulls, 10), RowId: i + 1, ColId: 2},
+		)
+	}
+	return res, nil
+}
+
+// importCreate 在独立的事物中创建表
+func (db *NtDB) importCreate(create *tableManager.Create) (*mysqlTable, error) {
+	if db.isForeign(create.TbName) {
+		return nil, &tableManager.ErrorTableAlreadyExist{}
+	}
+	xid := db.storageEngine.Begin()
+	if err := db.storageEngine.Create(xid, create); err != nil {
+		db.storageEngine.Abort(xid)
+		return nil, err
+	}
+	db.storageEngine.Commit(xid)
+	// Create在字段列表中加入了主键
+	tb := &mysqlTable{name: create.TbName}
+	for _, fc := range create.Fields {
+		if fc.FName != tableManager.PrimaryKeyCol {
+			tb.columns = append(tb.columns, fc.FName)
+			tb.types = append(tb.types, fc.FType)
+		}
+	}
+	return tb, nil
+}
+
+// importExisting dump中没有CREATE TABLE时使用已经存在的表
+func (db *NtDB) importExisting(name string) (*mysqlTable, error) {
+	xid := db.storageEngine.Begin()
+	defer db.storageEngine.Commit(xid)
+	fields, err := db.storageEngine.Describe(xid, name)
+	if err != nil {
+		return nil, err
+	}
+	tb := &mysqlTable{name: name}
+	for _, f := range fields {
+		if f.GetName() != tableManager.PrimaryKeyCol {
+			tb.columns = append(tb.columns, f.GetName())
+			tb.types = append(tb.types, typeName(f.GetFType()))
+		}
+	}
+	return tb, nil
+}
+
+// importBatch 在独立的事物中批量插入一批行
+func (db *NtDB) importBatch(name string, rows [][]string) error {
+	xid := db.storageEngine.Begin()
+	db.storageEngine.BeginBatch(xid)
+	_, err := db.storageEngine.BulkInsert(xid, name, rows)
+	db.storageEngine.EndBatch(xid)
+	if err != nil {
+		db.storageEngine.Abort(xid)
+		db.results.discard(xid)
+		db.commitHooks.discard(xid)
+		return err
+	}
+	db.storageEngine.Commit(xid)
+	db.results.commit(xid)
+	db.commitHooks.commit(xid)
+	return nil
+}
+
+// mysqlValue INSERT中的一个值, null为NULL
+type mysqlValue struct {
+	text string
+	null bool
+}
+
+// convert 按表的字段顺序排列一行的值, columns为INSERT的字段列表(为空时为表的所有字段)
+// 没有出现在字段列表中的字段以及NULL为零值
+func (tb *mysqlTable) convert(columns []string, row []mysqlValue) ([]string, error) {
+	values := make([]string, len(tb.columns))
+	set := make([]bool, len(tb.columns))
+	if len(columns) == 0 {
+		if len(row) != len(tb.columns) {
+			return nil, &tableManager.ErrorInvalidFieldCount{}
+		}
+		for i := range row {
+			set[i] = true
+		}
+	} else {
+		if len(row) != len(columns) {
+			return nil, &tableManager.ErrorInvalidFieldCount{}
+		}
+		reordered := make([]mysqlValue, len(tb.columns))
+		for i, column := range columns {
+			j := indexOf(tb.columns, column)
+			if j == -1 {
+				return nil, &ErrorInvalidMysqlDump{}
+			}
+			reordered[j], set[j] = row[i], true
+		}
+		row = reordered
+	}
+	for i, value := range row {
+		if !set[i] || value.null {
+			if set[i] {
+				tb.nulls++
+			}
+			switch tb.types[i] {
+			case "int32", "int64":
+				values[i] = "0"
+			case "json":
+				values[i] = "null"
+			}
+			continue
+		}
+		values[i] = value.text
+	}
+	return values, nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitMysqlStatements 按分号(或DELIMITER指定的分隔符)切分语句, 去掉注释以及条件注释
+func splitMysqlStatements(data string) ([]string, error) {
+	var statements []string
+	var stmt strings.Builder
+	delimiter, blank := ";", true
+	for i := 0; i < len(data); {
+		// DELIMITER只出现在语句开头, 到行尾为止
+		if blank && hasPrefixFold(data[i:], "DELIMITER ") {
+			end := strings.IndexByte(data[i:], '\n')
+			if end == -1 {
+				end = len(data) - i
+			}
+			if delimiter = strings.TrimSpace(data[i+len("DELIMITER ") : i+end]); delimiter == "" {
+				return nil, &ErrorInvalidMysqlDump{}
+			}
+			stmt.Reset()
+			i += end
+			continue
+		}
+		c := data[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end, err := skipQuoted(data, i)
+			if err != nil {
+				return nil, err
+			}
+			stmt.WriteString(data[i:end])
+			i, blank = end, false
+		case c == '#' || strings.HasPrefix(data[i:], "-- ") || strings.HasPrefix(data[i:], "--\n"):
+			end := strings.IndexByte(data[i:], '\n')
+			if end == -1 {
+				end = len(data) - i
+			}
+			i += end
+		case strings.HasPrefix(data[i:], "/*"):
+			end := strings.Index(data[i+2:], "*/")
+			if end == -1 {
+				return nil, &ErrorInvalidMysqlDump{}
+			}
+			stmt.WriteByte(' ')
+			i += end + 4
+		case strings.HasPrefix(data[i:], delimiter):
+			if s := strings.TrimSpace(stmt.String()); s != "" {
+				statements = append(statements, s)
+			}
+			stmt.Reset()
+			i, blank = i+len(delimiter), true
+		default:
+			stmt.WriteByte(c)
+			blank = blank && unicode.IsSpace(rune(c))
+			i++
+		}
+	}
+	if s := strings.TrimSpace(stmt.String()); s != "" {
+		statements = append(statements, s)
+	}
+	return statements, nil
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// skipQuoted 返回从data[start]开始的引号字符串(或标识符)之后的位置, 支持反斜杠转义以及重复引号
+func skipQuoted(data string, start int) (int, error) {
+	quote := data[start]
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(data) && data[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, &ErrorInvalidMysqlDump{}
+}
+
+// mysqlScanner 语句中的词法分析
+type mysqlScanner struct {
+	s   string
+	pos int
+}
+
+func (sc *mysqlScanner) skipSpace() {
+	for sc.pos < len(sc.s) && unicode.IsSpace(rune(sc.s[sc.pos])) {
+		sc.pos++
+	}
+}
+
+func (sc *mysqlScanner) peek() byte {
+	sc.skipSpace()
+	if sc.pos >= len(sc.s) {
+		return 0
+	}
+	return sc.s[sc.pos]
+}
+
+// word 读取一个不带引号的词(关键字, 数字等)
+func (sc *mysqlScanner) word() string {
+	sc.skipSpace()
+	start := sc.pos
+	for sc.pos < len(sc.s) && !strings.ContainsRune(" \t\r\n(),;'\"`", rune(sc.s[sc.pos])) {
+		sc.pos++
+	}
+	return sc.s[start:sc.pos]
+}
+
+// keyword 下一个词为kw(不区分大小写)时读取并返回true
+func (sc *mysqlScanner) keyword(kw string) bool {
+	pos := sc.pos
+	if strings.EqualFold(sc.word(), kw) {
+		return true
+	}
+	sc.pos = pos
+	return false
+}
+
+// identifier 读取一个标识符, 支持反引号以及db.table形式(返回table)
+func (sc *mysqlScanner) identifier() (string, error) {
+	var name string
+	for {
+		if sc.peek() == '`' {
+			end, err := skipQuoted(sc.s, sc.pos)
+			if err != nil {
+				return "", err
+			}
+			name = strings.ReplaceAll(sc.s[sc.pos+1:end-1], "``", "`")
+			sc.pos = end
+		} else {
+			word := sc.word()
+			if index := strings.LastIndexByte(word, '.'); index != -1 {
+				word = word[index+1:]
+			}
+			name = word
+		}
+		if sc.pos < len(sc.s) && sc.s[sc.pos] == '.' {
+			sc.pos++
+			continue
+		}
+		break
+	}
+	if name == "" {
+		return "", &ErrorInvalidMysqlDump{}
+	}
+	return name, nil
+}
+
+// group 读取括号中的内容(不包括最外层括号), 按最外层的逗号切分
+func (sc *mysqlScanner) group() ([]string, error) {
+	if sc.peek() != '(' {
+		return nil, &ErrorInvalidMysqlDump{}
+	}
+	var parts []string
+	depth, start := 0, sc.pos+1
+	for i := sc.pos; i < len(sc.s); i++ {
+		switch sc.s[i] {
+		case '\'', '"', '`':
+			end, err := skipQuoted(sc.s, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end - 1
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				parts = append(parts, strings.TrimSpace(sc.s[start:i]))
+				sc.pos = i + 1
+				return parts, nil
+			}
+		case ',':
+			if depth == 1 {
+				parts = append(parts, strings.TrimSpace(sc.s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return nil, &ErrorInvalidMysqlDump{}
+}
+
+// parseMysqlCreate CREATE TABLE [IF NOT EXISTS] name ( definitions ) options
+func parseMysqlCreate(stmt string) (*tableManager.Create, error) {
+	sc := &mysqlScanner{s: stmt}
+	sc.keyword("CREATE")
+	sc.keyword("TABLE")
+	if sc.keyword("IF") && !(sc.keyword("NOT") && sc.keyword("EXISTS")) {
+		return nil, &ErrorInvalidMysqlDump{}
+	}
+	name, err := sc.identifier()
+	if err != nil {
+		return nil, err
+	}
+	definitions, err := sc.group()
+	if err != nil {
+		return nil, err
+	}
+	create := &tableManager.Create{TbName: name}
+	var keys []string
+	for _, def := range definitions {
+		ds := &mysqlScanner{s: def}
+		switch strings.ToUpper(ds.word()) {
+		case "PRIMARY", "UNIQUE", "KEY", "INDEX":
+			// 单字段的索引, 前缀长度(`a`(10))忽略
+			for ds.peek() != '(' && ds.peek() != 0 {
+				if _, err := ds.identifier(); err != nil {
+					return nil, err
+				}
+			}
+			columns, err := ds.group()
+			if err != nil {
+				return nil, err
+			}
+			if len(columns) == 1 {
+				column, err := (&mysqlScanner{s: columns[0]}).identifier()
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, column)
+			}
+		case "CONSTRAINT", "FOREIGN", "FULLTEXT", "SPATIAL", "CHECK":
+		default:
+			ds.pos = 0
+			column, err := ds.identifier()
+			if err != nil {
+				return nil, err
+			}
+			typ := strings.ToUpper(ds.word())
+			if ds.peek() == '(' {
+				if _, err := ds.group(); err != nil {
+					return nil, err
+				}
+			}
+			unsigned := ds.keyword("UNSIGNED")
+			create.Fields = append(create.Fields, &tableManager.FieldCreate{FName: column, FType: mysqlType(typ, unsigned)})
+		}
+	}
+	if len(create.Fields) == 0 {
+		return nil, &ErrorInvalidMysqlDump{}
+	}
+	for _, key := range keys {
+		for _, fc := range create.Fields {
+			if fc.FName == key {
+				fc.Indexed = "indexed"
+			}
+		}
+	}
+	return create, nil
+}
+
+// mysqlType MySQL类型对应的字段类型
+func mysqlType(typ string, unsigned bool) string {
+	switch typ {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "YEAR", "BOOL", "BOOLEAN":
+		return "int32"
+	case "INT", "INTEGER":
+		if unsigned {
+			return "int64"
+		}
+		return "int32"
+	case "BIGINT":
+		if unsigned {
+			return "string"
+		}
+		return "int64"
+	case "JSON":
+		return "json"
+	}
+	return "string"
+}
+
+// parseMysqlInsert INSERT [IGNORE] INTO name [(columns)] VALUES (...), (...)
+// 返回表名, 字段列表(没有时为空)以及每一行的值
+func parseMysqlInsert(stmt string) (string, []string, [][]mysqlValue, error) {
+	sc := &mysqlScanner{s: stmt}
+	if !sc.keyword("INSERT") && !sc.keyword("REPLACE") {
+		return "", nil, nil, &ErrorInvalidMysqlDump{}
+	}
+	sc.keyword("IGNORE")
+	sc.keyword("INTO")
+	name, err := sc.identifier()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var columns []string
+	if sc.peek() == '(' {
+		group, err := sc.group()
+		if err != nil {
+			return "", nil, nil, err
+		}
+		for _, column := range group {
+			if column, err = (&mysqlScanner{s: column}).identifier(); err != nil {
+				return "", nil, nil, err
+			}
+			columns = append(columns, column)
+		}
+	}
+	if !sc.keyword("VALUES") && !sc.keyword("VALUE") {
+		return "", nil, nil, &ErrorInvalidMysqlDump{}
+	}
+	var rows [][]mysqlValue
+	for {
+		if sc.peek() != '(' {
+			return "", nil, nil, &ErrorInvalidMysqlDump{}
+		}
+		sc.pos++
+		var row []mysqlValue
+		for {
+			value, err := sc.value()
+			if err != nil {
+				return "", nil, nil, err
+			}
+			row = append(row, value)
+			if c := sc.peek(); c == ',' {
+				sc.pos++
+			} else if c == ')' {
+				sc.pos++
+				break
+			} else {
+				return "", nil, nil, &ErrorInvalidMysqlDump{}
+			}
+		}
+		rows = append(rows, row)
+		if sc.peek() != ',' {
+			break
+		}
+		sc.pos++
+	}
+	if sc.peek() != 0 {
+		return "", nil, nil, &ErrorInvalidMysqlDump{}
+	}
+	return name, columns, rows, nil
+}
+
+// value 读取一个值: 字符串(可以带_charset前缀), NULL, 数字, 0x或X'...'十六进制, b'...'位串
+func (sc *mysqlScanner) value() (mysqlValue, error) {
+	c := sc.peek()
+	if c == '\'' || c == '"' {
+		return sc.quoted()
+	}
+	word := sc.word()
+	upper := strings.ToUpper(word)
+	switch {
+	case word == "":
+		return mysqlValue{}, &ErrorInvalidMysqlDump{}
+	case upper == "NULL":
+		return mysqlValue{null: true}, nil
+	case strings.HasPrefix(word, "_") && (sc.peek() == '\'' || sc.peek() == '"'):
+		return sc.quoted()
+	case (upper == "X" || upper == "B") && sc.peek() == '\'':
+		quoted, err := sc.quoted()
+		if err != nil {
+			return mysqlValue{}, err
+		}
+		if upper == "X" {
+			return hexValue(quoted.text)
+		}
+		bits, err := strconv.ParseUint(quoted.text, 2, 64)
+		if err != nil {
+			return mysqlValue{}, &ErrorInvalidMysqlDump{}
+		}
+		return mysqlValue{text: strconv.FormatUint(bits, 10)}, nil
+	case strings.HasPrefix(upper, "0X"):
+		return hexValue(word[2:])
+	}
+	return mysqlValue{text: word}, nil
+}
+
+func hexValue(digits string) (mysqlValue, error) {
+	raw, err := hex.DecodeString(digits)
+	if err != nil {
+		return mysqlValue{}, &ErrorInvalidMysqlDump{}
+	}
+	return mysqlValue{text: string(raw)}, nil
+}
+
+// quoted 读取一个引号字符串并处理转义
+func (sc *mysqlScanner) quoted() (mysqlValue, error) {
+	sc.skipSpace()
+	end, err := skipQuoted(sc.s, sc.pos)
+	if err != nil {
+		return mysqlValue{}, err
+	}
+	quote, body := sc.s[sc.pos], sc.s[sc.pos+1:end-1]
+	sc.pos = end
+	var text strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == quote {
+			// 重复的引号
+			i++
+		} else if c == '\\' && i+1 < len(body) {
+			i++
+			switch body[i] {
+			case '0':
+				c = 0
+			case 'b':
+				c = '\b'
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'Z':
+				c = 26
+			case '%', '_':
+				// LIKE中的转义保留反斜杠
+				text.WriteByte('\\')
+				c = body[i]
+			default:
+				c = body[i]
+			}
+		}
+		text.WriteByte(c)
+	}
+	return mysqlValue{text: text.String()}, nil
+}
@@ -0,0 +1,225 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 变更通知(LISTEN/NOTIFY)
+// listen <channel> | listen table <table>   订阅命名频道或者表的变更
+// unlisten <channel> | unlisten table <table>
+// notify <channel> [payload]               向命名频道发送通知
+// 对表执行insert, update, delete(以及flashback)成功之后, 自动向表的频道发送通知, payload为操作类型
+// 事物中的通知暂存在事物中, 提交之后按发送顺序投递, 回滚则丢弃; 同一事物中相同的通知只投递一次
+// 不在事物中执行的notify立即投递
+// 投递不会阻塞提交: 订阅者的缓冲区已满时丢弃通知并计数, 订阅者发现Dropped增加时应当使缓存整体失效
+
+const (
+	DefaultListenerBuffer = 64
+	TableChannelPrefix    = "table:" // 表的频道名为 table:<目录中的表名>
+)
+
+type ErrorNoListener struct{}
+
+func (err *ErrorNoListener) Error() string {
+	return "Session can not receive notifications"
+}
+
+type Notification struct {
+	Channel string
+	Payload string
+	Xid     int64 // 发送通知的事物, 不在事物中发送时为-1
+}
+
+// Listener 会话接收通知的句柄, 由上层创建并放入Session
+type Listener struct {
+	C        chan *Notification
+	dropped  int64
+	channels map[string]struct{} // 由notifier的锁保护
+}
+
+func NewListener(size int) *Listener {
+	if size <= 0 {
+		size = DefaultListenerBuffer
+	}
+	return &Listener{C: make(chan *Notification, size), channels: map[string]struct{}{}}
+}
+
+// Dropped 因为缓冲区已满而丢弃的通知数
+func (l *Listener) Dropped() int64 {
+	return atomic.LoadInt64(&l.dropped)
+}
+
+func (l *Listener) deliver(n *Notification) {
+	select {
+	case l.C <- n:
+	default:
+		atomic.AddInt64(&l.dropped, 1)
+	}
+}
+
+type notifier struct {
+	lock        sync.Mutex
+	subscribers map[string]map[*Listener]struct{}
+	pending     map[int64][]*Notification // 事物中尚未提交的通知
+}
+
+func newNotifier() *notifier {
+	return &notifier{
+		subscribers: map[string]map[*Listener]struct{}{},
+		pending:     map[int64][]*Notification{},
+	}
+}
+
+func (n *notifier) listen(l *Listener, channel string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.subscribers[channel] == nil {
+		n.subscribers[channel] = map[*Listener]struct{}{}
+	}
+	n.subscribers[channel][l] = struct{}{}
+	l.channels[channel] = struct{}{}
+}
+
+func (n *notifier) unlisten(l *Listener, channel string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.remove(l, channel)
+}
+
+// close 退订所有频道并关闭l.C
+func (n *notifier) close(l *Listener) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if l.channels == nil {
+		return
+	}
+	for channel := range l.channels {
+		n.remove(l, channel)
+	}
+	l.channels = nil
+	close(l.C)
+}
+
+func (n *notifier) remove(l *Listener, channel string) {
+	delete(l.channels, channel)
+	if subs := n.subscribers[channel]; subs != nil {
+		delete(subs, l)
+		if len(subs) == 0 {
+			delete(n.subscribers, channel)
+		}
+	}
+}
+
+// notify xid == -1 时立即投递
+func (n *notifier) notify(xid int64, channel, payload string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	notification := &Notification{Channel: channel, Payload: payload, Xid: xid}
+	if xid == -1 {
+		n.deliver(notification)
+		return
+	}
+	for _, queued := range n.pending[xid] {
+		if queued.Channel == channel && queued.Payload == payload {
+			return
+		}
+	}
+	n.pending[xid] = append(n.pending[xid], notification)
+}
+
+// commit 投递xid暂存的通知
+func (n *notifier) commit(xid int64) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for _, notification := range n.pending[xid] {
+		n.deliver(notification)
+	}
+	delete(n.pending, xid)
+}
+
+func (n *notifier) abort(xid int64) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	delete(n.pending, xid)
+}
+
+func (n *notifier) deliver(notification *Notification) {
+	for l := range n.subscribers[notification.Channel] {
+		l.deliver(notification)
+	}
+}
+
+// Listen 订阅或者退订
+type Listen struct {
+	Channel  string
+	IsTable  bool // Channel为表名
+	Unlisten bool
+}
+
+type Notify struct {
+	Channel string
+	Payload string
+}
+
+// parseListen listen <channel> | listen table <table>
+func parseListen(args []string) (*Listen, error) {
+	unlisten := strings.ToUpper(args[0]) == "UNLISTEN"
+	if len(args) == 3 && strings.ToUpper(args[1]) == "TABLE" {
+		return &Listen{Channel: args[2], IsTable: true, Unlisten: unlisten}, nil
+	}
+	if len(args) != 2 || strings.HasPrefix(args[1], TableChannelPrefix) {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	return &Listen{Channel: args[1], Unlisten: unlisten}, nil
+}
+
+// parseNotify notify <channel> [payload...]
+func parseNotify(args []string) (*Notify, error) {
+	if len(args) < 2 || strings.HasPrefix(args[1], TableChannelPrefix) {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	return &Notify{Channel: args[1], Payload: strings.Join(args[2:], " ")}, nil
+}
+
+func (db *NtDB) listen(session *Session, listen *Listen) error {
+	if session.Listener == nil {
+		return &ErrorNoListener{}
+	}
+	channel := listen.Channel
+	if listen.IsTable {
+		name, err := db.resolveTable(session.Database, listen.Channel)
+		if err != nil {
+			return err
+		}
+		channel = TableChannelPrefix + name
+	}
+	if listen.Unlisten {
+		db.notifier.unlisten(session.Listener, channel)
+	} else {
+		db.notifier.listen(session.Listener, channel)
+	}
+	return nil
+}
+
+// notifyTable 表的变更通知, tbName为目录中的表名
+func (db *NtDB) notifyTable(xid int64, tbName, operation string) {
+	db.notifier.notify(xid, TableChannelPrefix+tbName, operation)
+}
+
+// CloseListener 会话结束时退订所有频道, 之后l.C被关闭
+func (db *NtDB) CloseListener(l *Listener) {
+	db.notifier.close(l)
+}
+
+// NotificationResponse 上层推送通知时使用的格式, 与查询结果相同
+func NotificationResponse(n *Notification) []*tableManager.ResponseObject {
+	title := []string{"channel", "payload"}
+	res := make([]*tableManager.ResponseObject, 0, 4)
+	for j, value := range append(title, n.Channel, n.Payload) {
+		res = append(res, &tableManager.ResponseObject{Payload: value, RowId: j / len(title), ColId: j % len(title)})
+	}
+	return res
+}
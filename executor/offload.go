@@ -0,0 +1,54 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 冷数据迁移
+// offload <table> to <dir> [idle <duration>]
+// 将表中超过idle(默认DefaultColdIdle)没有访问的区迁移到二级目录dir(更便宜, 更慢的存储), 之后仍然可以正常读写, 见dataManager/coldStorage.go
+// 不属于当前事物, 可以在事物中执行; 返回本次迁移的区数, 位于二级目录中的区数以及表空间的区数
+
+const DefaultColdIdle = 24 * time.Hour
+
+type Offload struct {
+	TbName string
+	Dir    string
+	Idle   time.Duration
+}
+
+func parseOffload(args []string) (*Offload, error) {
+	if (len(args) != 4 && len(args) != 6) || strings.ToUpper(args[2]) != "TO" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	off := &Offload{TbName: args[1], Dir: args[3], Idle: DefaultColdIdle}
+	if len(args) == 6 {
+		if strings.ToUpper(args[4]) != "IDLE" {
+			return nil, &ErrorRequestArgNumber{}
+		}
+		idle, err := time.ParseDuration(args[5])
+		if err != nil || idle < 0 {
+			return nil, &ErrorInvalidEntity{}
+		}
+		off.Idle = idle
+	}
+	return off, nil
+}
+
+func (db *NtDB) offload(off *Offload) ([]*tableManager.ResponseObject, error) {
+	stats, err := db.storageEngine.OffloadCold(off.TbName, off.Dir, off.Idle)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*tableManager.ResponseObject, 0, 6)
+	for j, title := range []string{"moved", "cold", "extents"} {
+		res = append(res, &tableManager.ResponseObject{Payload: title, RowId: 0, ColId: j})
+	}
+	for j, value := range []int64{stats.Moved, stats.Cold, stats.Extent} {
+		res = append(res, &tableManager.ResponseObject{Payload: strconv.FormatInt(value, 10), RowId: 1, ColId: j})
+	}
+	return res, nil
+}
@@ -3,6 +3,7 @@ package executor
 import (
 	"log"
 	"myDB/tableManager"
+	"strconv"
 	"strings"
 )
 
@@ -43,11 +44,36 @@ func (parser *TrieParser) ParseRequest(args []string) (CommandType, []any, error
 	}
 	query := strings.ToUpper(args[0])
 	entity := make([]any, 0)
+	var returning []string
+	if query == "INSERT" || query == "UPDATE" || query == "DELETE" {
+		// ... returning <field1> <field2> ...
+		var err error
+		if args, returning, err = splitReturning(args); err != nil {
+			return cmd, nil, err
+		}
+	}
 	switch query {
 	case "SELECT":
 		{
+			// select count(*) from <table>
+			if len(args) == 4 && strings.ToUpper(args[1]) == "COUNT(*)" && strings.ToUpper(args[2]) == "FROM" {
+				return COUNT, []any{&CountRows{TbName: args[3]}}, nil
+			}
+			// select <table>.<field> ... from <left> join <right> on ...
+			if isJoin(args) {
+				j, err := parseJoin(args)
+				if err != nil {
+					return cmd, nil, err
+				}
+				return JOIN, []any{j}, nil
+			}
 			cmd = SELECT
 			sel := &tableManager.Select{}
+			// select ... from <table> as of <timestamp> ...
+			var err error
+			if args, sel.AsOf, err = splitAsOf(args); err != nil {
+				return cmd, nil, err
+			}
 			where := &tableManager.Where{}
 			sel.Where = where
 			entity = append(entity, sel, where)
@@ -55,7 +81,7 @@ func (parser *TrieParser) ParseRequest(args []string) (CommandType, []any, error
 	case "UPDATE":
 		{
 			cmd = UPDATE
-			update := &tableManager.Update{}
+			update := &tableManager.Update{Returning: returning}
 			where := &tableManager.Where{}
 			update.Where = where
 			entity = append(entity, update, where)
@@ -63,26 +89,336 @@ func (parser *TrieParser) ParseRequest(args []string) (CommandType, []any, error
 	case "INSERT":
 		{
 			cmd = INSERT
-			insert := &tableManager.Insert{}
+			insert := &tableManager.Insert{Returning: returning}
 			entity = append(entity, insert)
 		}
 	case "DELETE":
 		{
 			cmd = DELETE
-			del := &tableManager.Delete{}
+			del := &tableManager.Delete{Returning: returning}
 			where := &tableManager.Where{}
 			del.Where = where
 			entity = append(entity, del, where)
 		}
 	case "CREATE":
 		{
+			// create database <name>
+			if len(args) == 3 && strings.ToUpper(args[1]) == "DATABASE" {
+				return CREATEDB, []any{&CreateDatabase{Name: args[2]}}, nil
+			}
+			// create materialized view <name> as select ...
+			if len(args) > 2 && strings.ToUpper(args[1]) == "MATERIALIZED" {
+				cre, err := parseCreateView(args)
+				if err != nil {
+					return cmd, nil, err
+				}
+				return CREATEMV, []any{cre}, nil
+			}
+			// create foreign table <name> { ... } from <file> ...
+			if len(args) > 2 && strings.ToUpper(args[1]) == "FOREIGN" {
+				cre, err := parseCreateForeign(args)
+				if err != nil {
+					return cmd, nil, err
+				}
+				return CREATEFT, []any{cre}, nil
+			}
+			// create event <name> every <duration> | cron <schedule> do <statement>
+			if len(args) > 3 && strings.ToUpper(args[1]) == "EVENT" && args[2] != "{" {
+				cre, err := parseCreateEvent(args)
+				if err != nil {
+					return cmd, nil, err
+				}
+				return CREATEEVT, []any{cre}, nil
+			}
 			cmd = CREATE
 			cre := &tableManager.Create{}
+			// create <table name> {...} [engine <engine name>] [fillfactor <percent>] [unlogged] [checksum]
+			if n := len(args); n >= 4 && strings.ToUpper(args[n-1]) == "CHECKSUM" {
+				cre.Checksum = true
+				args = args[:n-1]
+			}
+			if n := len(args); n >= 4 && strings.ToUpper(args[n-1]) == "UNLOGGED" {
+				cre.Unlogged = true
+				args = args[:n-1]
+			}
+			if n := len(args); n >= 5 && strings.ToUpper(args[n-2]) == "FILLFACTOR" {
+				ff, err := strconv.Atoi(args[n-1])
+				if err != nil {
+					return cmd, nil, &ErrorInvalidEntity{}
+				}
+				cre.FillFactor = ff
+				args = args[:n-2]
+			}
+			if n := len(args); n >= 5 && args[n-3] == "}" && strings.ToUpper(args[n-2]) == "ENGINE" {
+				cre.Engine = args[n-1]
+				args = args[:n-2]
+			}
 			cre.Fields = make([]*tableManager.FieldCreate, 0)
 			entity = append(entity, cre)
 		}
+	case "USE":
+		{
+			// use <database>
+			if len(args) != 2 {
+				return cmd, nil, &ErrorRequestArgNumber{}
+			}
+			return USE, []any{&UseDatabase{Name: args[1]}}, nil
+		}
+	case "EXPORT":
+		{
+			// export <table> to <dir>
+			if len(args) != 4 || strings.ToUpper(args[2]) != "TO" {
+				return cmd, nil, &ErrorRequestArgNumber{}
+			}
+			return EXPORT, []any{&tableManager.Export{TbName: args[1], Dir: args[3]}}, nil
+		}
+	case "ATTACH":
+		{
+			// attach <table> from <dir>
+			if len(args) != 4 || strings.ToUpper(args[2]) != "FROM" {
+				return cmd, nil, &ErrorRequestArgNumber{}
+			}
+			return ATTACH, []any{&tableManager.Attach{TbName: args[1], Dir: args[3]}}, nil
+		}
+	case "FLASHBACK":
+		{
+			// flashback <table> to <timestamp> [where <field> <op> <value>]
+			fb, err := parseFlashback(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return FLASHBACK, []any{fb}, nil
+		}
+	case "ANALYZE":
+		{
+			// analyze <table> [sample <percent>]
+			analyze, err := parseAnalyze(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return ANALYZE, []any{analyze}, nil
+		}
+	case "SWAP":
+		{
+			// swap table <a> with <b>
+			if len(args) != 5 || strings.ToUpper(args[1]) != "TABLE" || strings.ToUpper(args[3]) != "WITH" {
+				return cmd, nil, &ErrorRequestArgNumber{}
+			}
+			return SWAP, []any{&tableManager.Swap{TbName: args[2], With: args[4]}}, nil
+		}
+	case "DEFRAGMENT":
+		{
+			// defragment <table> page <pageId>
+			defrag, err := parseDefragment(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return DEFRAG, []any{defrag}, nil
+		}
+	case "VACUUM":
+		{
+			// vacuum <table>
+			if len(args) != 2 {
+				return cmd, nil, &ErrorRequestArgNumber{}
+			}
+			return VACUUM, []any{&Vacuum{TbName: args[1]}}, nil
+		}
+	case "LOAD":
+		{
+			// load <table> from <file> [batch <n>]
+			load, err := parseBulkLoad(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return LOAD, []any{load}, nil
+		}
+	case "IMPORT":
+		{
+			// import mysql <file> [batch <n>]
+			imp, err := parseMysqlImport(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return IMPORT, []any{imp}, nil
+		}
+	case "DECLARE":
+		{
+			// declare <name> cursor for select ...
+			declare, err := parser.parseDeclareCursor(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return DECLARE, []any{declare}, nil
+		}
+	case "FETCH":
+		{
+			// fetch [<n>] from <name>
+			fetch, err := parseFetchCursor(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return FETCH, []any{fetch}, nil
+		}
+	case "CLOSE":
+		{
+			// close <name>
+			if len(args) != 2 {
+				return cmd, nil, &ErrorRequestArgNumber{}
+			}
+			return CLOSE, []any{&CloseCursor{Name: args[1]}}, nil
+		}
+	case "OFFLOAD":
+		{
+			// offload <table> to <dir> [idle <duration>]
+			off, err := parseOffload(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return OFFLOAD, []any{off}, nil
+		}
+	case "BACKUP":
+		{
+			// backup to <dir> [incremental from <base dir>]
+			backup, err := parseBackup(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return BACKUP, []any{backup}, nil
+		}
+	case "SCRUB":
+		{
+			// scrub [all]
+			scrub, err := parseScrub(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return SCRUB, []any{scrub}, nil
+		}
+	case "DUMP":
+		{
+			// dump [<table> ...] to <path> [format sql | csv] [decrypt]
+			dump, err := parseDump(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return DUMP, []any{dump}, nil
+		}
+	case "INCREMENT":
+		{
+			// increment <table> <field> [by <n>] [where <field> <op> <value>]
+			inc, err := parseIncrement(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return INCREMENT, []any{inc}, nil
+		}
+	case "SET":
+		{
+			// set [global | session] <name> = <value>
+			set, err := parseSetVariable(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return SETVAR, []any{set}, nil
+		}
+	case "RECLAIM":
+		{
+			// reclaim orphans [dryrun]
+			reclaim, err := parseReclaim(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return RECLAIM, []any{reclaim}, nil
+		}
+	case "LISTEN", "UNLISTEN":
+		{
+			// listen <channel> | listen table <table>
+			listen, err := parseListen(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return LISTEN, []any{listen}, nil
+		}
+	case "NOTIFY":
+		{
+			// notify <channel> [payload]
+			notify, err := parseNotify(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return NOTIFY, []any{notify}, nil
+		}
+	case "REFRESH":
+		{
+			// refresh materialized view <name>
+			if len(args) != 4 || strings.ToUpper(args[1]) != "MATERIALIZED" || strings.ToUpper(args[2]) != "VIEW" {
+				return cmd, nil, &ErrorRequestArgNumber{}
+			}
+			return REFRESHMV, []any{&RefreshView{Name: args[3]}}, nil
+		}
+	case "DROP":
+		{
+			// drop foreign table <name>
+			if len(args) == 4 && strings.ToUpper(args[1]) == "FOREIGN" && strings.ToUpper(args[2]) == "TABLE" {
+				return DROPFT, []any{&DropForeign{Name: args[3]}}, nil
+			}
+			// drop event <name>
+			if len(args) != 3 || strings.ToUpper(args[1]) != "EVENT" {
+				return cmd, nil, &ErrorRequestArgNumber{}
+			}
+			return DROPEVT, []any{&DropEvent{Name: args[2]}}, nil
+		}
+	case "WITH":
+		{
+			// with [recursive] <name> as ( ... ) select ...
+			with, err := parseWith(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return WITH, []any{with}, nil
+		}
+	case "COPY":
+		{
+			// copy <table> | ( select ... ) to <file> [rowgroup <n>]
+			cp, err := parseCopy(args)
+			if err != nil {
+				return cmd, nil, err
+			}
+			return COPY, []any{cp}, nil
+		}
 	default:
 		{
+			// show databases
+			if len(args) == 2 && query == "SHOW" && strings.ToUpper(args[1]) == "DATABASES" {
+				return SHOWDB, nil, nil
+			}
+			if isShowStats(args) {
+				return SHOWSTATS, nil, nil
+			}
+			// show events
+			if len(args) == 2 && query == "SHOW" && strings.ToUpper(args[1]) == "EVENTS" {
+				return SHOWEVTS, nil, nil
+			}
+			// show variables
+			if len(args) == 2 && query == "SHOW" && strings.ToUpper(args[1]) == "VARIABLES" {
+				return SHOWVARS, nil, nil
+			}
+			// show metrics
+			if len(args) == 2 && query == "SHOW" && strings.ToUpper(args[1]) == "METRICS" {
+				return SHOWMETRICS, nil, nil
+			}
+			// show hotspots [<table>]
+			if isShowHotspots(args) {
+				return SHOWHOT, []any{parseShowHotspots(args)}, nil
+			}
+			// show sizes [<table>]
+			if isShowSizes(args) {
+				return SHOWSIZE, []any{parseShowSizes(args)}, nil
+			}
+			// show engine status
+			if len(args) == 3 && query == "SHOW" && strings.ToUpper(args[1]) == "ENGINE" && strings.ToUpper(args[2]) == "STATUS" {
+				return SHOWENG, nil, nil
+			}
 			if len(args) == 1 {
 				for command, value := range parser.commands {
 					if command == query {
@@ -101,6 +437,28 @@ func (parser *TrieParser) ParseRequest(args []string) (CommandType, []any, error
 	return cmd, entity, nil
 }
 
+// ParseSQL 将一条以空白分隔的语句解析为指令以及实体
+// 任何输入都不会panic, 不合法的语句返回error, 可用于fuzz
+func ParseSQL(sql string) (CommandType, []any, error) {
+	return defaultParser.ParseRequest(strings.Fields(sql))
+}
+
+var defaultParser = NewTrieParser()
+
+// splitReturning 将DML语句末尾的RETURNING子句分离出来
+// 没有RETURNING子句时返回的字段列表为nil
+func splitReturning(args []string) ([]string, []string, error) {
+	for i := len(args) - 1; i > 0; i-- {
+		if strings.ToUpper(args[i]) == "RETURNING" {
+			if i == len(args)-1 {
+				return nil, nil, &ErrorRequestArgNumber{}
+			}
+			return args[:i], args[i+1:], nil
+		}
+	}
+	return args, nil, nil
+}
+
 func NewTrieParser() Parser {
 	commands := map[string]CommandType{}
 	commands["SHOW"] = SHOW
@@ -143,7 +501,7 @@ func buildSelectTrie() *Trie {
 	return trie
 }
 
-// update <table> set <field> = <value> [[where <field> compare <value> ]]
+// update <table> set <field> = <value> [[where <field> compare <value> ]] [[returning <field> ...]]
 func buildUpdateTrie() *Trie {
 	trie := &Trie{
 		root: &Node{0, 0, "", map[string]*Node{}},
@@ -165,7 +523,7 @@ func buildUpdateTrie() *Trie {
 	return trie
 }
 
-// insert <table> values <field> ...
+// insert <table> values <field> ... [[returning <field> ...]]
 func buildInsertTrie() *Trie {
 	trie := &Trie{
 		root: &Node{0, 0, "", map[string]*Node{}},
@@ -181,7 +539,7 @@ func buildInsertTrie() *Trie {
 	return trie
 }
 
-// delete <table> [[where <> compare <>]]
+// delete <table> [[where <> compare <>]] [[returning <field> ...]]
 func buildDeleteTrie() *Trie {
 	trie := &Trie{
 		root: &Node{0, 0, "", map[string]*Node{}},
@@ -195,7 +553,7 @@ func buildDeleteTrie() *Trie {
 	return trie
 }
 
-// create <table name> {fName fType indexed, fName fType indexed ...}
+// create <table name> {fName fType indexed, fName fType indexed ...} [engine <engine name>]
 func buildCreateTrie() *Trie {
 	trie := &Trie{
 		root: &Node{0, 0, "", map[string]*Node{}},
@@ -339,6 +697,9 @@ func packQueryEntity(args []string, entity any) error {
 				if len(args) == 2 {
 					create.Fields = append(create.Fields,
 						&tableManager.FieldCreate{FName: args[0], FType: args[1]})
+				} else if strings.ToUpper(args[2]) == "ENCRYPTED" {
+					create.Fields = append(create.Fields,
+						&tableManager.FieldCreate{FName: args[0], FType: args[1], Encrypted: true})
 				} else {
 					create.Fields = append(create.Fields,
 						&tableManager.FieldCreate{FName: args[0], FType: args[1], Indexed: args[2]})
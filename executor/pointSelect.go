@@ -0,0 +1,101 @@
+package executor
+
+import (
+	"myDB/storageEngine"
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 主键点查的快速路径
+// select <field> ... from <table> where ID = <key>在第一次执行时正常解析, 之后以逻辑数据库 + 去掉<key>的语句文本为key缓存解析得到的Select(语句模板)
+// 命中模板时跳过解析, 结果缓存以及执行计划, 直接按主键读出一行并投影(见tableManager/pointLookup.go)
+// as of, for update, 窗口函数以及外部表的查询不缓存模板; 会话开启了结果缓存时仍然走正常的路径
+// 模板只记录表名和字段, 表被删除或重建之后在执行时报错或读到新的表; 模板数超过PointSelectCapacity时清空
+
+const PointSelectCapacity int = 1024
+
+type pointSelects struct {
+	lock      sync.RWMutex
+	templates map[string]*tableManager.Select
+	hits      atomic.Int64
+	misses    atomic.Int64
+}
+
+func newPointSelects() *pointSelects {
+	return &pointSelects{templates: map[string]*tableManager.Select{}}
+}
+
+// pointTemplate 语句是否形如select ... from <table> where ID = <key>, 返回去掉<key>的语句文本以及key
+func pointTemplate(args []string) (string, int64, bool) {
+	n := len(args)
+	if n < 7 || !strings.EqualFold(args[0], "SELECT") || !strings.EqualFold(args[n-4], "WHERE") ||
+		args[n-3] != tableManager.PrimaryKeyCol || args[n-2] != "=" {
+		return "", 0, false
+	}
+	key, err := strconv.ParseInt(args[n-1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.Join(args[:n-1], " "), key, true
+}
+
+func (p *pointSelects) get(key string) *tableManager.Select {
+	p.lock.RLock()
+	sel := p.templates[key]
+	p.lock.RUnlock()
+	if sel != nil {
+		p.hits.Add(1)
+	} else {
+		p.misses.Add(1)
+	}
+	return sel
+}
+
+func (p *pointSelects) put(key string, sel *tableManager.Select) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.templates) >= PointSelectCapacity {
+		p.templates = map[string]*tableManager.Select{}
+	}
+	p.templates[key] = &tableManager.Select{TbName: sel.TbName, FNames: sel.FNames}
+}
+
+// metrics 语句模板的统计, 见showMetrics
+func (p *pointSelects) metrics() []storageEngine.Metric {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return []storageEngine.Metric{
+		{Name: "point_select_templates", Value: int64(len(p.templates))},
+		{Name: "point_select_hits", Value: p.hits.Load()},
+		{Name: "point_select_misses", Value: p.misses.Load()},
+	}
+}
+
+// selectPoint 语句命中点查模板时按主键读出一行, 返回false时正常执行
+func (db *NtDB) selectPoint(session *Session, xid int64, args []string) ([]*tableManager.ResponseObject, bool, error) {
+	template, key, ok := pointTemplate(args)
+	if !ok {
+		return nil, false, nil
+	}
+	sel := db.points.get(session.Database + "\x00" + template)
+	if sel == nil || !db.hasDatabase(session.Database) || db.foreign.get(sel.TbName) != nil || db.variable(session, VarResultCache) == "on" {
+		return nil, false, nil
+	}
+	ret, err := db.storageEngine.SelectKey(xid, sel, key)
+	return ret, true, err
+}
+
+// learnPoint 正常执行的select可以使用快速路径时记录语句模板, sel的表名已经解析
+func (db *NtDB) learnPoint(session *Session, args []string, sel *tableManager.Select) {
+	template, _, ok := pointTemplate(args)
+	if !ok || !sel.AsOf.IsZero() || sel.ReadForUpdate || isWindowQuery(sel.FNames) || db.foreign.get(sel.TbName) != nil {
+		return
+	}
+	if sel.Where == nil || sel.Where.Compare == nil || sel.Where.Compare.FieldName != tableManager.PrimaryKeyCol || sel.Where.Compare.CompareTo != "=" {
+		return
+	}
+	db.points.put(session.Database+"\x00"+template, sel)
+}
@@ -0,0 +1,47 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 孤儿页回收
+// reclaim orphans [dryrun]
+// 回收所有表空间中不可达的数据页(见tableManager/orphanPage.go), 返回孤儿页的表空间以及页号
+// dryrun时只检查不回收; 在独立的事物中执行, 不能在事物中执行, 有其他活跃事物时失败
+
+type Reclaim struct {
+	DryRun bool
+}
+
+func parseReclaim(args []string) (*Reclaim, error) {
+	if len(args) < 2 || len(args) > 3 || strings.ToUpper(args[1]) != "ORPHANS" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	if len(args) == 3 && strings.ToUpper(args[2]) != "DRYRUN" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	return &Reclaim{DryRun: len(args) == 3}, nil
+}
+
+func (db *NtDB) reclaim(xid int64, reclaim *Reclaim) ([]*tableManager.ResponseObject, error) {
+	if xid != -1 {
+		return nil, &ErrorIllegalOperation{}
+	}
+	orphans, err := db.storageEngine.ReclaimOrphans(reclaim.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*tableManager.ResponseObject{
+		{Payload: "space", RowId: 0, ColId: 0},
+		{Payload: "page", RowId: 0, ColId: 1},
+	}
+	for i, orphan := range orphans {
+		ret = append(ret,
+			&tableManager.ResponseObject{Payload: strconv.FormatInt(orphan.Space, 10), RowId: i + 1, ColId: 0},
+			&tableManager.ResponseObject{Payload: strconv.FormatInt(orphan.PageId, 10), RowId: i + 1, ColId: 1},
+		)
+	}
+	return ret, nil
+}
@@ -0,0 +1,193 @@
+package executor
+
+import (
+	"container/list"
+	"myDB/storageEngine"
+	"myDB/tableManager"
+	"strings"
+	"sync"
+)
+
+// 查询结果缓存
+// 会话变量result_cache为on时, 缓存SELECT(包括窗口函数)的完整结果, 用于反复执行相同查询的仪表盘
+// key为表在目录中的名字 + 语句文本(参数已经绑定在语句中), 不同数据库中的同名表不会共用结果
+// 每个表有一个变更计数器: 变更流(tableManager/changeStream.go)中的修改暂存在事物中, 事物提交之后计数器加一
+// 缓存的结果记录计算之前的计数器, 计数器变化之后失效; 计算期间有事物提交时结果同样失效
+// 只在读最新提交数据的查询中使用缓存, 即读已提交的事物, 不包括可重复读的事物, 修改过该表的事物, AS OF以及FOR UPDATE查询
+// 结果超过ResultCacheMaxRows行时不缓存, 超过容量时淘汰最久未使用的结果; 缓存的结果只读, 不持久化
+
+const (
+	VarResultCache      string = "result_cache"
+	ResultCacheCapacity int    = 256
+	ResultCacheMaxRows  int    = 10000
+)
+
+type cachedResult struct {
+	key     string
+	tbName  string
+	version int64
+	rows    []*tableManager.ResponseObject
+}
+
+type resultCache struct {
+	lock          sync.Mutex
+	capacity      int
+	entries       map[string]*list.Element // key -> *cachedResult
+	lru           *list.List               // 头部为最近使用的结果
+	versions      map[string]int64         // tbName -> 变更计数器
+	pending       map[int64]map[string]struct{}
+	repeatable    map[int64]struct{} // 可重复读的事物
+	hits          int64
+	misses        int64
+	invalidations int64
+}
+
+func newResultCache(capacity int) *resultCache {
+	return &resultCache{
+		capacity:   capacity,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		versions:   map[string]int64{},
+		pending:    map[int64]map[string]struct{}{},
+		repeatable: map[int64]struct{}{},
+	}
+}
+
+// capture 变更流的sink, xid修改了change.TbName
+func (c *resultCache) capture(change *tableManager.Change) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.pending[change.Xid] == nil {
+		c.pending[change.Xid] = map[string]struct{}{}
+	}
+	c.pending[change.Xid][change.TbName] = struct{}{}
+}
+
+// begin 记录可重复读的事物
+func (c *resultCache) begin(xid int64, repeatable bool) {
+	if !repeatable {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.repeatable[xid] = struct{}{}
+}
+
+// commit xid提交之后修改过的表的计数器加一, 删除这些表的结果
+func (c *resultCache) commit(xid int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for tbName := range c.pending[xid] {
+		c.versions[tbName] += 1
+		for elem := c.lru.Front(); elem != nil; {
+			next := elem.Next()
+			if elem.Value.(*cachedResult).tbName == tbName {
+				c.remove(elem)
+				c.invalidations += 1
+			}
+			elem = next
+		}
+	}
+	delete(c.pending, xid)
+	delete(c.repeatable, xid)
+}
+
+func (c *resultCache) discard(xid int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pending, xid)
+	delete(c.repeatable, xid)
+}
+
+// usable xid读tbName时能否使用缓存
+func (c *resultCache) usable(xid int64, tbName string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ext := c.repeatable[xid]; ext {
+		return false
+	}
+	_, changed := c.pending[xid][tbName]
+	return !changed
+}
+
+// get 返回key的结果以及tbName当前的计数器, 不存在或已经失效时结果为nil
+func (c *resultCache) get(key, tbName string) ([]*tableManager.ResponseObject, int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	version := c.versions[tbName]
+	elem, ext := c.entries[key]
+	if !ext {
+		c.misses += 1
+		return nil, version
+	}
+	cached := elem.Value.(*cachedResult)
+	if cached.version != version {
+		c.remove(elem)
+		c.invalidations += 1
+		c.misses += 1
+		return nil, version
+	}
+	c.lru.MoveToFront(elem)
+	c.hits += 1
+	return append([]*tableManager.ResponseObject(nil), cached.rows...), version
+}
+
+// put version为计算结果之前tbName的计数器
+func (c *resultCache) put(key, tbName string, version int64, rows []*tableManager.ResponseObject) {
+	if len(rows) > 0 && rows[len(rows)-1].RowId > ResultCacheMaxRows {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if version != c.versions[tbName] {
+		return
+	}
+	if elem, ext := c.entries[key]; ext {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&cachedResult{key: key, tbName: tbName, version: version, rows: rows})
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *resultCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cachedResult).key)
+}
+
+// metrics 结果缓存的统计, 见showMetrics
+func (c *resultCache) metrics() []storageEngine.Metric {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return []storageEngine.Metric{
+		{Name: "result_cache_entries", Value: int64(c.lru.Len())},
+		{Name: "result_cache_hits", Value: c.hits},
+		{Name: "result_cache_misses", Value: c.misses},
+		{Name: "result_cache_invalidations", Value: c.invalidations},
+	}
+}
+
+// captureChange 变更流的sink, 交给物化视图, 结果缓存以及提交钩子
+func (db *NtDB) captureChange(change *tableManager.Change) {
+	db.views.capture(change)
+	db.results.capture(change)
+	db.commitHooks.capture(change)
+}
+
+// selectCached 会话开启了结果缓存并且查询可以使用缓存时, 先查找缓存, 不存在时执行并写入缓存
+func (db *NtDB) selectCached(session *Session, xid int64, args []string, sel *tableManager.Select) ([]*tableManager.ResponseObject, error) {
+	if db.variable(session, VarResultCache) != "on" || !sel.AsOf.IsZero() || sel.ReadForUpdate || !db.results.usable(xid, sel.TbName) {
+		return db.selectQuery(session, xid, sel)
+	}
+	key := sel.TbName + "\x00" + strings.Join(args, " ")
+	rows, version := db.results.get(key, sel.TbName)
+	if rows != nil {
+		return rows, nil
+	}
+	rows, err := db.selectQuery(session, xid, sel)
+	if err == nil {
+		db.results.put(key, sel.TbName, version, rows)
+	}
+	return rows, err
+}
@@ -0,0 +1,27 @@
+package executor
+
+import (
+	"context"
+	"myDB/dbError"
+)
+
+// 自动重试的事物(嵌入式接口)
+// RunInTransaction开启一个事物, 在其中执行fn并提交, fn返回error时回滚
+// fn或者提交返回可以重试的错误(死锁, 锁等待超时, 序列化失败)时, 回滚并在退避之后用新的事物重新执行, 重试规则见dbError.Retry
+// fn用传入的xid执行语句(Execute, ExecuteSession等), 不能自己提交或者回滚; fn可能执行多次, 不能有事物之外的副作用
+// 事物在默认数据库中开启, 使用全局的隔离级别
+
+func (db *NtDB) RunInTransaction(ctx context.Context, fn func(xid int64) error) error {
+	return dbError.Retry(ctx, func() error {
+		xid, _, err := db.Execute(-1, []string{"begin"})
+		if err != nil {
+			return err
+		}
+		if err := fn(xid); err != nil {
+			db.Execute(xid, []string{"abort"})
+			return err
+		}
+		_, _, err = db.Execute(xid, []string{"commit"})
+		return err
+	})
+}
@@ -0,0 +1,427 @@
+package executor
+
+import (
+	"log"
+	"myDB/dbError"
+	"myDB/simulation"
+	"myDB/tableManager"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 事件调度器
+// create event <name> every <duration> do <statement>
+// create event <name> cron <minute> <hour> <day> <month> <weekday> do <statement>
+// drop event <name> | show events
+// 语句事件记录在默认数据库的系统表sys_events中(名字, 调度, 所在数据库, 语句), 启动时载入, 在创建或者删除事物提交之后生效
+// Go回调通过Schedule注册, 只保存在内存中
+// 每次运行在独立的事物中执行, 出错则回滚并记录日志; 同一时刻只有一轮调度在执行, 执行时间超过周期的运行会被跳过
+// cron的每个字段支持 * , a-b 以及 /n, 日期和星期都有限制时满足其一即可(与cron相同); 时间使用本地时区
+// 语句以空格连接后保存, 值中不能包含空白字符
+
+const (
+	EventTable           string = "sys_events"
+	DefaultSchedulerTick        = time.Second
+	everyPrefix          string = "@every "
+)
+
+type ErrorInvalidSchedule struct{}
+type ErrorEventAlreadyExist struct{}
+type ErrorEventNotExist struct{}
+
+func (err *ErrorInvalidSchedule) Error() string {
+	return "Invalid event schedule"
+}
+
+func (err *ErrorEventAlreadyExist) Error() string {
+	return "This event is already created"
+}
+
+func (err *ErrorEventAlreadyExist) Is(target error) bool {
+	return target == dbError.ErrDuplicateKey
+}
+
+func (err *ErrorEventNotExist) Error() string {
+	return "Event doesn't exist"
+}
+
+// EventJob Go回调, 在事物xid中执行, 返回error时事物回滚
+type EventJob func(db Executor, xid int64) error
+
+type CreateEvent struct {
+	Name     string
+	Schedule string
+	Args     []string
+}
+
+type DropEvent struct {
+	Name string
+}
+
+// schedule 固定周期(every)或者cron表达式
+type schedule struct {
+	spec       string
+	every      time.Duration
+	fields     [5]uint64 // minute hour day month weekday, 第v位表示取值v
+	restricted [2]bool   // day, weekday 是否不为*
+}
+
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+func parseSchedule(spec string) (*schedule, error) {
+	s := &schedule{spec: spec}
+	if strings.HasPrefix(spec, everyPrefix) {
+		every, err := time.ParseDuration(strings.TrimPrefix(spec, everyPrefix))
+		if err != nil || every <= 0 {
+			return nil, &ErrorInvalidSchedule{}
+		}
+		s.every = every
+		return s, nil
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, &ErrorInvalidSchedule{}
+	}
+	for i, field := range fields {
+		bits, err := parseCronField(field, cronBounds[i][0], cronBounds[i][1])
+		if err != nil {
+			return nil, err
+		}
+		s.fields[i] = bits
+	}
+	s.restricted = [2]bool{fields[2] != "*", fields[4] != "*"}
+	// 永远不会触发的调度(例如2月31日)
+	if s.next(simulation.Now()).IsZero() {
+		return nil, &ErrorInvalidSchedule{}
+	}
+	return s, nil
+}
+
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, &ErrorInvalidSchedule{}
+			}
+			step, part = n, part[:i]
+		}
+		from, to := lo, hi
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, &ErrorInvalidSchedule{}
+			}
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, &ErrorInvalidSchedule{}
+				}
+			} else if step == 1 {
+				to = from
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, &ErrorInvalidSchedule{}
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// next after之后的下一次运行时间, 一年之内不会触发时返回零值
+func (s *schedule) next(after time.Time) time.Time {
+	if s.every > 0 {
+		return after.Add(s.every)
+	}
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	for i := 0; i < 366*24*60; i++ {
+		if s.match(t) {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+func (s *schedule) match(t time.Time) bool {
+	has := func(i, v int) bool { return s.fields[i]&(1<<uint(v)) != 0 }
+	if !has(0, t.Minute()) || !has(1, t.Hour()) || !has(3, int(t.Month())) {
+		return false
+	}
+	day, weekday := has(2, t.Day()), has(4, int(t.Weekday()))
+	if s.restricted[0] && s.restricted[1] {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+type event struct {
+	name     string
+	database string
+	schedule *schedule
+	args     []string // 语句, 为nil时执行job
+	job      EventJob
+	next     time.Time
+}
+
+type eventScheduler struct {
+	lock    sync.Mutex
+	events  map[string]*event
+	running sync.Mutex // 同一时刻只有一轮调度在执行
+	started bool
+	tick    func(now time.Time) // 后台协程每隔DefaultSchedulerTick调用一次
+}
+
+func newEventScheduler(tick func(now time.Time)) *eventScheduler {
+	return &eventScheduler{events: map[string]*event{}, tick: tick}
+}
+
+func (s *eventScheduler) has(name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ext := s.events[name]
+	return ext
+}
+
+// add 必须持有s.lock, 第一个事件加入时启动后台协程
+func (s *eventScheduler) add(e *event) {
+	e.next = e.schedule.next(simulation.Now())
+	s.events[e.name] = e
+	if !s.started {
+		s.started = true
+		go func() {
+			for {
+				<-simulation.After(DefaultSchedulerTick)
+				s.tick(simulation.Now())
+			}
+		}()
+	}
+}
+
+// due 取出到期的事件并计算下一次运行时间
+func (s *eventScheduler) due(now time.Time) []*event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := make([]*event, 0)
+	for _, e := range s.events {
+		if !e.next.IsZero() && !e.next.After(now) {
+			ret = append(ret, e)
+			e.next = e.schedule.next(now)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].name < ret[j].name })
+	return ret
+}
+
+// parseCreateEvent create event <name> every <duration> | cron <5 fields> do <statement>
+func parseCreateEvent(args []string) (*CreateEvent, error) {
+	do := -1
+	for i := 3; i < len(args); i++ {
+		if strings.ToUpper(args[i]) == "DO" {
+			do = i
+			break
+		}
+	}
+	if len(args) < 6 || do == -1 || do == len(args)-1 {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	cre := &CreateEvent{Name: args[2], Args: args[do+1:]}
+	switch strings.ToUpper(args[3]) {
+	case "EVERY":
+		if do != 5 {
+			return nil, &ErrorRequestArgNumber{}
+		}
+		cre.Schedule = everyPrefix + args[4]
+	case "CRON":
+		if do != 9 {
+			return nil, &ErrorRequestArgNumber{}
+		}
+		cre.Schedule = strings.Join(args[4:9], " ")
+	default:
+		return nil, &ErrorRequestArgNumber{}
+	}
+	return cre, nil
+}
+
+// createEvent 在xid事物中向sys_events插入一条记录
+func (db *NtDB) createEvent(session *Session, xid int64, cre *CreateEvent) error {
+	if xid == -1 {
+		return &ErrorIllegalOperation{}
+	}
+	sched, err := parseSchedule(cre.Schedule)
+	if err != nil {
+		return err
+	}
+	if db.scheduler.has(cre.Name) {
+		return &ErrorEventAlreadyExist{}
+	}
+	if !db.hasSystemTable(xid, EventTable) {
+		create := &tableManager.Create{
+			TbName: EventTable,
+			Fields: []*tableManager.FieldCreate{
+				{FName: "name", FType: "string"},
+				{FName: "schedule", FType: "string"},
+				{FName: "database", FType: "string"},
+				{FName: "statement", FType: "string"},
+			},
+		}
+		if err := db.storageEngine.Create(xid, create); err != nil {
+			return err
+		}
+	}
+	insert := &tableManager.Insert{TbName: EventTable, Values: []string{cre.Name, cre.Schedule, session.Database, strings.Join(cre.Args, " ")}}
+	if _, err := db.storageEngine.Insert(xid, insert); err != nil {
+		return err
+	}
+	e := &event{name: cre.Name, database: session.Database, schedule: sched, args: cre.Args}
+	db.afterCommit(xid, func() {
+		db.scheduler.lock.Lock()
+		defer db.scheduler.lock.Unlock()
+		db.scheduler.add(e)
+	})
+	return nil
+}
+
+// dropEvent 语句事件在xid事物中从sys_events删除, 提交之后停止调度
+func (db *NtDB) dropEvent(xid int64, drop *DropEvent) error {
+	if xid == -1 {
+		return &ErrorIllegalOperation{}
+	}
+	if !db.scheduler.has(drop.Name) {
+		return &ErrorEventNotExist{}
+	}
+	if db.hasSystemTable(xid, EventTable) {
+		del := &tableManager.Delete{
+			TName: EventTable,
+			Where: &tableManager.Where{Compare: &tableManager.Compare{FieldName: "name", CompareTo: "=", Value: drop.Name}},
+		}
+		if _, err := db.storageEngine.Delete(xid, del); err != nil {
+			return err
+		}
+	}
+	db.afterCommit(xid, func() {
+		db.scheduler.lock.Lock()
+		defer db.scheduler.lock.Unlock()
+		delete(db.scheduler.events, drop.Name)
+	})
+	return nil
+}
+
+// showEvents 所有事件以及下一次运行时间
+func (db *NtDB) showEvents() []*tableManager.ResponseObject {
+	db.scheduler.lock.Lock()
+	defer db.scheduler.lock.Unlock()
+	title := []string{"name", "schedule", "database", "statement", "next"}
+	res := make([]*tableManager.ResponseObject, 0)
+	for j, name := range title {
+		res = append(res, &tableManager.ResponseObject{Payload: name, RowId: 0, ColId: j})
+	}
+	names := make([]string, 0, len(db.scheduler.events))
+	for name := range db.scheduler.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		e := db.scheduler.events[name]
+		statement := "<callback>"
+		if e.args != nil {
+			statement = strings.Join(e.args, " ")
+		}
+		row := []string{e.name, e.schedule.spec, e.database, statement, e.next.Format(time.RFC3339)}
+		for j, value := range row {
+			res = append(res, &tableManager.ResponseObject{Payload: value, RowId: i + 1, ColId: j})
+		}
+	}
+	return res
+}
+
+// Schedule 注册Go回调, spec为 "@every <duration>" 或者5个字段的cron表达式
+// 回调在默认数据库中运行, 不会持久化
+func (db *NtDB) Schedule(name, spec string, job EventJob) error {
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	db.scheduler.lock.Lock()
+	if _, ext := db.scheduler.events[name]; ext {
+		db.scheduler.lock.Unlock()
+		return &ErrorEventAlreadyExist{}
+	}
+	db.scheduler.add(&event{name: name, database: DefaultDatabase, schedule: sched, job: job})
+	db.scheduler.lock.Unlock()
+	return nil
+}
+
+// RunEvents 运行所有在now之前到期的事件, 返回成功运行的事件数
+func (db *NtDB) RunEvents(now time.Time) int {
+	db.scheduler.running.Lock()
+	defer db.scheduler.running.Unlock()
+	succeed := 0
+	for _, e := range db.scheduler.due(now) {
+		if err := db.runEvent(e); err != nil {
+			log.Printf("[Event Scheduler] Event %s failed: %s\n", e.name, err)
+			continue
+		}
+		succeed += 1
+	}
+	return succeed
+}
+
+func (db *NtDB) runEvent(e *event) error {
+	session := &Session{Database: e.database, User: "event:" + e.name}
+	xid, _, err := db.ExecuteSession(session, -1, []string{"BEGIN"})
+	if err != nil {
+		return err
+	}
+	if e.args != nil {
+		_, _, err = db.ExecuteSession(session, xid, e.args)
+	} else {
+		err = e.job(db, xid)
+	}
+	if err != nil {
+		db.ExecuteSession(session, xid, []string{"ABORT"})
+		return err
+	}
+	_, _, err = db.ExecuteSession(session, xid, []string{"COMMIT"})
+	return err
+}
+
+// loadEvents
+// 启动时载入sys_events中的所有事件
+func (db *NtDB) loadEvents() {
+	xid := db.storageEngine.Begin()
+	defer db.storageEngine.Commit(xid)
+	if !db.hasSystemTable(xid, EventTable) {
+		return
+	}
+	rows, err := db.storageEngine.Select(xid, &tableManager.Select{TbName: EventTable, FNames: []string{"name", "schedule", "database", "statement"}})
+	if err != nil {
+		panic(err)
+	}
+	values := map[int][]string{}
+	for _, row := range rows {
+		if row.RowId != 0 {
+			values[row.RowId] = append(values[row.RowId], row.Payload)
+		}
+	}
+	db.scheduler.lock.Lock()
+	for _, value := range values {
+		sched, err := parseSchedule(value[1])
+		if err != nil {
+			log.Printf("[Event Scheduler] Skip event %s with invalid schedule %s\n", value[0], value[1])
+			continue
+		}
+		db.scheduler.add(&event{name: value[0], database: value[2], schedule: sched, args: strings.Fields(value[3])})
+	}
+	loaded := len(db.scheduler.events)
+	db.scheduler.lock.Unlock()
+	log.Printf("[Executor] Load %d events\n", loaded)
+}
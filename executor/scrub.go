@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 页校验
+// scrub [all]
+// 读取数据文件校验页结构以及DataItem的校验和, 默认只校验上一次校验之后写回的页, all时校验所有页, 见dataManager/scrub.go
+// 不属于当前事物, 可以在事物中执行; 返回读取的页数, 检查的DataItem数以及损坏的页(<space>:<page>, 没有时为-), 原因见日志
+
+type Scrub struct {
+	All bool
+}
+
+func parseScrub(args []string) (*Scrub, error) {
+	if len(args) > 2 {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	if len(args) == 2 && strings.ToUpper(args[1]) != "ALL" {
+		return nil, &ErrorInvalidEntity{}
+	}
+	return &Scrub{All: len(args) == 2}, nil
+}
+
+func (db *NtDB) scrub(scrub *Scrub) ([]*tableManager.ResponseObject, error) {
+	stats, err := db.storageEngine.Scrub(scrub.All)
+	if err != nil {
+		return nil, err
+	}
+	corrupt := make([]string, 0, len(stats.Corrupt))
+	for _, c := range stats.Corrupt {
+		corrupt = append(corrupt, strconv.FormatInt(c.Space, 10)+":"+strconv.FormatInt(c.PageId, 10))
+	}
+	if len(corrupt) == 0 {
+		corrupt = append(corrupt, "-")
+	}
+	res := make([]*tableManager.ResponseObject, 0, 6)
+	for j, title := range []string{"pages", "items", "corrupt"} {
+		res = append(res, &tableManager.ResponseObject{Payload: title, RowId: 0, ColId: j})
+	}
+	for j, value := range []string{strconv.FormatInt(stats.Pages, 10), strconv.FormatInt(stats.Items, 10), strings.Join(corrupt, ",")} {
+		res = append(res, &tableManager.ResponseObject{Payload: value, RowId: 1, ColId: j})
+	}
+	return res, nil
+}
@@ -0,0 +1,31 @@
+package executor
+
+import (
+	util "myDB/dataStructure"
+	"myDB/versionManager"
+	"time"
+)
+
+// Session 会话执行上下文
+// 由上层(网络层)维护，每条指令执行时传入
+type Session struct {
+	Database  string            // 当前会话所在的逻辑数据库
+	MaxMemory int64             // 单个查询可以使用的最大内存(字节), 0表示不限制
+	Parallel  int               // 单个查询并行扫描的worker数, <= 1 时顺序扫描
+	Stats     *SessionStats     // 不为nil时记录每条语句的执行统计(show stats)
+	SlowQuery time.Duration     // 执行时间不小于SlowQuery的语句写入慢查询日志, 0表示不记录
+	Listener  *Listener         // 不为nil时会话可以订阅频道(listen), 见notify.go
+	User      string            // 写入审计日志的用户, 由上层设置
+	Client    string            // 写入审计日志的客户端地址
+	Vars      *SessionVariables // 会话中设置的变量(set session), nil时只使用全局变量, 见variables.go
+
+	memory *util.MemoryBudget // 当前语句的内存预算, 见memory.go
+}
+
+// SessionStats 会话最近一条语句以及所在事物的执行统计
+// begin, commit, abort 以及事物之外的语句不会更新统计
+type SessionStats struct {
+	Statement   versionManager.ExecStats
+	Transaction versionManager.ExecStats // 截止到最近一条语句
+	Elapsed     time.Duration            // 最近一条语句的执行时间
+}
@@ -0,0 +1,68 @@
+package executor
+
+import (
+	"log"
+	"myDB/tableManager"
+	"myDB/versionManager"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 执行统计以及慢查询日志
+// 每条语句执行结束后结束事物的当前语句(EndStatement), 统计写入会话, 超过阈值的语句写入慢查询日志
+
+// SlowQueryLog 慢查询日志, 上层可以替换输出位置
+var SlowQueryLog = log.New(os.Stderr, "[Slow Query] ", log.LstdFlags)
+
+func (db *NtDB) endStatement(session *Session, xid int64, args []string, elapsed time.Duration) {
+	stmt, total, ok := db.storageEngine.EndStatement(xid)
+	if ok && session.Stats != nil {
+		session.Stats.Statement, session.Stats.Transaction, session.Stats.Elapsed = stmt, total, elapsed
+	}
+	if session.SlowQuery > 0 && elapsed >= session.SlowQuery {
+		SlowQueryLog.Printf("time = %s, xid = %d, rows read = %d, rows written = %d, pages touched = %d, lock wait = %s, log bytes = %d, query = %s\n",
+			elapsed, xid, stmt.RowsRead, stmt.RowsWritten, stmt.PagesTouched, stmt.LockWait, stmt.LogBytes, strings.Join(args, " "))
+	}
+}
+
+// isShowStats show stats
+func isShowStats(args []string) bool {
+	return len(args) == 2 && strings.ToUpper(args[0]) == "SHOW" && strings.ToUpper(args[1]) == "STATS"
+}
+
+// showStats 会话最近一条语句(statement)以及所在事物(transaction)的执行统计
+func showStats(session *Session) []*tableManager.ResponseObject {
+	title := []string{"scope", "rows_read", "rows_written", "pages_touched", "lock_wait", "log_bytes", "elapsed"}
+	res := make([]*tableManager.ResponseObject, 0)
+	for j, name := range title {
+		res = append(res, &tableManager.ResponseObject{Payload: name, RowId: 0, ColId: j})
+	}
+	stats := session.Stats
+	if stats == nil {
+		stats = &SessionStats{}
+	}
+	rows := [][]string{
+		append([]string{"statement"}, formatExecStats(stats.Statement)...),
+		append([]string{"transaction"}, formatExecStats(stats.Transaction)...),
+	}
+	rows[0] = append(rows[0], stats.Elapsed.String())
+	rows[1] = append(rows[1], "")
+	for i, row := range rows {
+		for j, value := range row {
+			res = append(res, &tableManager.ResponseObject{Payload: value, RowId: i + 1, ColId: j})
+		}
+	}
+	return res
+}
+
+func formatExecStats(stats versionManager.ExecStats) []string {
+	return []string{
+		strconv.FormatInt(stats.RowsRead, 10),
+		strconv.FormatInt(stats.RowsWritten, 10),
+		strconv.FormatInt(stats.PagesTouched, 10),
+		stats.LockWait.String(),
+		strconv.FormatInt(stats.LogBytes, 10),
+	}
+}
@@ -0,0 +1,34 @@
+package executor
+
+import (
+	"myDB/tableManager"
+)
+
+// 原子交换
+// swap table <a> with <b>
+// 在当前事物中交换两张表的名字, 提交之后整体生效, 见tableManager/swap.go
+// 物化视图以及视图的基表不能交换(视图按基表的修改增量维护, 交换之后的内容与定义不一致)
+// 提交之后两张表的查询结果缓存失效
+
+type ErrorSwapView struct{}
+
+func (err *ErrorSwapView) Error() string {
+	return "Materialized views and their base tables can not be swapped"
+}
+
+func (db *NtDB) swap(xid int64, swap *tableManager.Swap) error {
+	for _, name := range []string{swap.TbName, swap.With} {
+		if db.views.references(name) {
+			return &ErrorSwapView{}
+		}
+	}
+	if err := db.storageEngine.Swap(xid, swap); err != nil {
+		return err
+	}
+	for _, name := range []string{swap.TbName, swap.With} {
+		db.results.capture(&tableManager.Change{Xid: xid, TbName: name})
+		db.commitHooks.capture(&tableManager.Change{Xid: xid, TbName: name})
+		db.notifyTable(xid, name, "swap")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 表的磁盘占用
+// show sizes [<table>]
+// 每个表一行: 页数, 分配, 已使用, 剩余以及位于冷文件中的字节数, 按分配的字节数降序, 见tableManager/tableSize.go
+
+type ShowSizes struct {
+	TbName string // 为空时展示当前数据库中的所有表
+}
+
+func isShowSizes(args []string) bool {
+	return (len(args) == 2 || len(args) == 3) && strings.ToUpper(args[0]) == "SHOW" && strings.ToUpper(args[1]) == "SIZES"
+}
+
+func parseShowSizes(args []string) *ShowSizes {
+	show := &ShowSizes{}
+	if len(args) == 3 {
+		show.TbName = args[2]
+	}
+	return show
+}
+
+func (db *NtDB) showSizes(session *Session, show *ShowSizes) ([]*tableManager.ResponseObject, error) {
+	name := ""
+	if show.TbName != "" {
+		resolved, err := db.resolveTable(session.Database, show.TbName)
+		if err != nil {
+			return nil, err
+		}
+		name = resolved
+	}
+	tables, err := db.storageEngine.TableSizes(name)
+	if err != nil {
+		return nil, err
+	}
+	title := []string{"table", "pages", "allocated_bytes", "used_bytes", "free_bytes", "cold_bytes"}
+	res := make([]*tableManager.ResponseObject, 0)
+	for j, column := range title {
+		res = append(res, &tableManager.ResponseObject{Payload: column, RowId: 0, ColId: j})
+	}
+	format := func(n int64) string {
+		return strconv.FormatInt(n, 10)
+	}
+	rowId := 1
+	for _, tb := range tables {
+		tbName := tb.Table
+		if index := strings.Index(tbName, Separator); session.Database == DefaultDatabase && index != -1 ||
+			session.Database != DefaultDatabase && (index == -1 || tbName[:index] != session.Database) {
+			continue
+		} else if index != -1 {
+			tbName = tbName[index+1:]
+		}
+		values := []string{tbName, format(tb.Pages), format(tb.Allocated), format(tb.Used), format(tb.Allocated - tb.Used), format(tb.Cold)}
+		for j, value := range values {
+			res = append(res, &tableManager.ResponseObject{Payload: value, RowId: rowId, ColId: j})
+		}
+		rowId += 1
+	}
+	return res, nil
+}
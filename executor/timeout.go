@@ -0,0 +1,138 @@
+package executor
+
+import (
+	"log"
+	"myDB/simulation"
+	"sync"
+	"time"
+)
+
+// 语句超时以及事物空闲超时
+// statement_timeout: 事物中单条语句的最长执行时间(毫秒), 扫描每一行以及等待表锁时检查, 超时则回滚事物(versionManager.ErrorStatementTimeout)
+// idle_in_transaction_timeout: 事物中两条语句之间的最长空闲时间(毫秒), 超时由后台协程回滚事物, 之后该事物的语句返回ErrorIdleTransactionTimeout
+// 空闲超时防止断开或者遗忘的客户端一直持有表锁, 并且阻止清理旧版本(purge)
+// 只跟踪由BEGIN开启的事物; 空闲时间从上一条语句结束开始计算, 使用该语句所在会话中的设置
+// 后台协程在第一个设置了空闲超时的事物出现时启动, 每隔IdleCheckTick检查一次
+
+const (
+	VarStatementTimeout string = "statement_timeout"
+	VarIdleTimeout      string = "idle_in_transaction_timeout"
+	IdleCheckTick              = 100 * time.Millisecond
+)
+
+type ErrorIdleTransactionTimeout struct{}
+
+func (err *ErrorIdleTransactionTimeout) Error() string {
+	return "Idle in transaction timeout exceeded, this transaction has been rolled back"
+}
+
+type idleTransaction struct {
+	busy    bool // 正在执行语句
+	last    time.Time
+	timeout time.Duration
+}
+
+type idleReaper struct {
+	lock    sync.Mutex
+	active  map[int64]*idleTransaction
+	killed  map[int64]struct{} // 因空闲超时回滚的事物, 下一条语句返回错误
+	started bool
+	tick    func(now time.Time)
+}
+
+func newIdleReaper(tick func(now time.Time)) *idleReaper {
+	return &idleReaper{active: map[int64]*idleTransaction{}, killed: map[int64]struct{}{}, tick: tick}
+}
+
+// begin BEGIN开启的事物xid, 在BEGIN语句结束之后开始空闲
+func (r *idleReaper) begin(xid int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.active[xid] = &idleTransaction{busy: true}
+}
+
+// busy xid开始执行语句, xid已经因空闲超时回滚时返回ErrorIdleTransactionTimeout
+func (r *idleReaper) busy(xid int64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ext := r.killed[xid]; ext {
+		delete(r.killed, xid)
+		return &ErrorIdleTransactionTimeout{}
+	}
+	if t, ext := r.active[xid]; ext {
+		t.busy = true
+	}
+	return nil
+}
+
+// idle xid的语句结束, 之后空闲超过timeout(> 0)时回滚
+func (r *idleReaper) idle(xid int64, timeout time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	t, ext := r.active[xid]
+	if !ext {
+		return
+	}
+	t.busy, t.last, t.timeout = false, simulation.Now(), timeout
+	if timeout > 0 && !r.started {
+		r.started = true
+		go func() {
+			for {
+				<-simulation.After(IdleCheckTick)
+				r.tick(simulation.Now())
+			}
+		}()
+	}
+}
+
+// forget xid提交或者回滚, 空闲超时回滚的事物仍然保留在killed中直到下一条语句
+func (r *idleReaper) forget(xid int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.active, xid)
+}
+
+// expired 取出在now之前空闲超时的事物
+func (r *idleReaper) expired(now time.Time) []int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ret := make([]int64, 0)
+	for xid, t := range r.active {
+		if !t.busy && t.timeout > 0 && now.Sub(t.last) >= t.timeout {
+			ret = append(ret, xid)
+			delete(r.active, xid)
+			r.killed[xid] = struct{}{}
+		}
+	}
+	return ret
+}
+
+// ReapIdleTransactions 回滚所有在now之前空闲超时的事物, 返回回滚的事物数
+func (db *NtDB) ReapIdleTransactions(now time.Time) int {
+	xids := db.reaper.expired(now)
+	for _, xid := range xids {
+		db.abort(xid)
+		log.Printf("[Executor] Abort transaction %d, idle in transaction timeout exceeded\n", xid)
+	}
+	return len(xids)
+}
+
+// beginStatement 会话在xid中开始一条语句(不包括内部执行的查询)
+func (db *NtDB) beginStatement(session *Session, xid int64) error {
+	if xid == -1 {
+		return nil
+	}
+	if err := db.reaper.busy(xid); err != nil {
+		return err
+	}
+	db.storageEngine.BeginStatement(xid)
+	db.storageEngine.SetStatementTimeout(xid, time.Duration(db.intVariable(session, VarStatementTimeout))*time.Millisecond)
+	return nil
+}
+
+// endStatementIdle 语句结束之后xid开始空闲
+func (db *NtDB) endStatementIdle(session *Session, xid int64) {
+	if xid != -1 {
+		db.reaper.idle(xid, time.Duration(db.intVariable(session, VarIdleTimeout))*time.Millisecond)
+	}
+}
@@ -0,0 +1,52 @@
+package executor
+
+// 事物结束
+// 执行器中的状态(事件, 物化视图的定义)由DDL在事物中修改, 提交之后才生效, 回滚则丢弃
+// 事物中的通知在提交之后投递, 对物化视图基表的修改在提交之前合并到视图中(同一个事物)
+
+// afterCommit xid提交之后执行fn
+func (db *NtDB) afterCommit(xid int64, fn func()) {
+	db.hookLock.Lock()
+	defer db.hookLock.Unlock()
+	db.hooks[xid] = append(db.hooks[xid], fn)
+}
+
+// commit 事物可能已经因为死锁等原因被回滚, 此时相当于abort
+func (db *NtDB) commit(xid int64) error {
+	if _, _, active := db.storageEngine.EndStatement(xid); !active {
+		db.abort(xid)
+		return nil
+	}
+	if err := db.maintainViews(xid); err != nil {
+		db.abort(xid)
+		return err
+	}
+	db.storageEngine.Commit(xid)
+	db.reaper.forget(xid)
+	db.cursors.closeAll(xid)
+	db.results.commit(xid)
+	db.notifier.commit(xid)
+	db.hookLock.Lock()
+	hooks := db.hooks[xid]
+	delete(db.hooks, xid)
+	db.hookLock.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+	db.commitHooks.commit(xid)
+	return nil
+}
+
+func (db *NtDB) abort(xid int64) {
+	db.storageEngine.Abort(xid)
+	db.reaper.forget(xid)
+	db.cursors.closeAll(xid)
+	db.notifier.abort(xid)
+	db.views.discard(xid)
+	db.results.discard(xid)
+	db.commitHooks.discard(xid)
+	db.discardDatabases(xid)
+	db.hookLock.Lock()
+	delete(db.hooks, xid)
+	db.hookLock.Unlock()
+}
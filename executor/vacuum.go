@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"myDB/tableManager"
+	"strconv"
+	"time"
+)
+
+// 整理
+// vacuum <table>
+// 整理表所在的表空间, 回收失效DataItem占用的空间(见tableManager/vacuum.go), 返回扫描以及整理的页数, 回收的DataItem数和字节数
+// 在独立的事物中执行, 不能在事物中执行; SetVacuumInterval开启后台整理
+
+type Vacuum struct {
+	TbName string
+}
+
+func (db *NtDB) vacuum(session *Session, xid int64, vacuum *Vacuum) ([]*tableManager.ResponseObject, error) {
+	if xid != -1 {
+		return nil, &ErrorIllegalOperation{}
+	}
+	name, err := db.resolveTable(session.Database, vacuum.TbName)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := db.storageEngine.Vacuum(name)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*tableManager.ResponseObject, 0)
+	for i, column := range []string{"pages", "compacted", "items", "bytes", "skipped"} {
+		ret = append(ret, &tableManager.ResponseObject{Payload: column, RowId: 0, ColId: i})
+	}
+	for i, value := range []int64{stats.Pages, stats.Compacted, stats.Items, stats.Bytes, stats.Skipped} {
+		ret = append(ret, &tableManager.ResponseObject{Payload: strconv.FormatInt(value, 10), RowId: 1, ColId: i})
+	}
+	return ret, nil
+}
+
+// SetVacuumInterval 后台整理所有表的间隔, 0表示停止
+func (db *NtDB) SetVacuumInterval(interval time.Duration) {
+	db.storageEngine.SetVacuumInterval(interval)
+}
+
+// SetColdCompression 自动压缩所有表中idle时间内没有访问的区, 0表示停止
+func (db *NtDB) SetColdCompression(idle time.Duration) {
+	db.storageEngine.SetColdCompression(idle)
+}
@@ -0,0 +1,305 @@
+package executor
+
+import (
+	"log"
+	"myDB/tableManager"
+	"myDB/versionManager"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 会话变量以及全局变量
+// set [global | session] <name> = <value> | show variables
+// 全局变量是所有会话的默认值, 记录在默认数据库的系统表sys_variables中(名字, 值), 启动时载入, set global在事物提交之后生效
+// 会话变量保存在Session.Vars中(由上层在连接中维护, 断开之后丢弃), 立即生效, 不受事物回滚影响; 没有设置的会话变量使用全局变量
+// isolation: 之后开始的事物的隔离级别 read_committed | repeatable_read, 全局默认值为启动时的隔离级别
+// lock_timeout: 等待表锁的最长时间(毫秒), 超时则回滚事物, 0表示不限制
+// sort_memory: 单个查询(扫描, 排序, 窗口函数)可以使用的最大内存(字节), 不超过资源组的限制, 0表示只使用资源组的限制
+// autocommit: on时事物之外的语句执行之后自动提交, off时上层为其开启的事物需要显式commit
+// result_cache: on时SELECT使用查询结果缓存(见resultCache.go)
+// approximate_count: on时select count(*)返回表的近似行数, 不扫描表(见count.go)
+// statement_timeout, idle_in_transaction_timeout: 语句的最长执行时间以及事物的最长空闲时间(毫秒), 超时则回滚事物, 0表示不限制(见timeout.go)
+
+const (
+	VariableTable  string = "sys_variables"
+	VarIsolation   string = "isolation"
+	VarLockTimeout string = "lock_timeout"
+	VarSortMemory  string = "sort_memory"
+	VarAutocommit  string = "autocommit"
+)
+
+type ErrorUnknownVariable struct{}
+type ErrorInvalidVariable struct{}
+
+func (err *ErrorUnknownVariable) Error() string {
+	return "Unknown variable"
+}
+
+func (err *ErrorInvalidVariable) Error() string {
+	return "Invalid value for this variable"
+}
+
+type SetVariable struct {
+	Global bool
+	Name   string
+	Value  string
+}
+
+// SessionVariables 会话中设置的变量
+type SessionVariables struct {
+	lock   sync.Mutex
+	values map[string]string
+}
+
+func NewSessionVariables() *SessionVariables {
+	return &SessionVariables{values: map[string]string{}}
+}
+
+func (vars *SessionVariables) get(name string) (string, bool) {
+	if vars == nil {
+		return "", false
+	}
+	vars.lock.Lock()
+	defer vars.lock.Unlock()
+	value, ext := vars.values[name]
+	return value, ext
+}
+
+func (vars *SessionVariables) set(name, value string) {
+	vars.lock.Lock()
+	defer vars.lock.Unlock()
+	vars.values[name] = value
+}
+
+// variableChecks 变量 -> 校验取值, 返回规范化之后的值
+var variableChecks = map[string]func(value string) (string, bool){
+	VarIsolation:        checkIsolation,
+	VarLockTimeout:      checkNonNegative,
+	VarSortMemory:       checkNonNegative,
+	VarAutocommit:       checkSwitch,
+	VarResultCache:      checkSwitch,
+	VarStatementTimeout: checkNonNegative,
+	VarIdleTimeout:      checkNonNegative,
+	VarApproximateCount: checkSwitch,
+}
+
+func checkIsolation(value string) (string, bool) {
+	value = strings.ToLower(value)
+	return value, value == "read_committed" || value == "repeatable_read"
+}
+
+func checkNonNegative(value string) (string, bool) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	return strconv.FormatInt(n, 10), err == nil && n >= 0
+}
+
+func checkSwitch(value string) (string, bool) {
+	switch strings.ToLower(value) {
+	case "on", "true", "1":
+		return "on", true
+	case "off", "false", "0":
+		return "off", true
+	}
+	return value, false
+}
+
+// globalVariables 全局变量的当前值
+type globalVariables struct {
+	lock   sync.RWMutex
+	values map[string]string
+}
+
+func newGlobalVariables(level versionManager.IsolationLevel) *globalVariables {
+	isolation := "read_committed"
+	if level == versionManager.ReadRepeatable {
+		isolation = "repeatable_read"
+	}
+	return &globalVariables{values: map[string]string{
+		VarIsolation:        isolation,
+		VarLockTimeout:      "0",
+		VarSortMemory:       "0",
+		VarAutocommit:       "on",
+		VarResultCache:      "off",
+		VarStatementTimeout: "0",
+		VarIdleTimeout:      "0",
+		VarApproximateCount: "off",
+	}}
+}
+
+func (g *globalVariables) get(name string) string {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return g.values[name]
+}
+
+func (g *globalVariables) set(name, value string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.values[name] = value
+}
+
+// parseSetVariable set [global | session] <name> = <value>
+func parseSetVariable(args []string) (*SetVariable, error) {
+	set := &SetVariable{}
+	if len(args) == 5 {
+		switch strings.ToUpper(args[1]) {
+		case "GLOBAL":
+			set.Global = true
+		case "SESSION":
+		default:
+			return nil, &ErrorRequestArgNumber{}
+		}
+		args = args[1:]
+	}
+	if len(args) != 4 || args[2] != "=" {
+		return nil, &ErrorRequestArgNumber{}
+	}
+	set.Name, set.Value = strings.ToLower(args[1]), args[3]
+	return set, nil
+}
+
+// variable 会话中name的值, 会话没有设置时为全局变量的值
+func (db *NtDB) variable(session *Session, name string) string {
+	if value, ext := session.Vars.get(name); ext {
+		return value
+	}
+	return db.globals.get(name)
+}
+
+func (db *NtDB) intVariable(session *Session, name string) int64 {
+	n, _ := strconv.ParseInt(db.variable(session, name), 10, 64)
+	return n
+}
+
+// transactionOptions 会话开启事物时的隔离级别以及锁等待超时
+func (db *NtDB) transactionOptions(session *Session) versionManager.TransactionOptions {
+	opts := versionManager.TransactionOptions{
+		Level:       versionManager.ReadCommitted,
+		LockTimeout: time.Duration(db.intVariable(session, VarLockTimeout)) * time.Millisecond,
+	}
+	if db.variable(session, VarIsolation) == "repeatable_read" {
+		opts.Level = versionManager.ReadRepeatable
+	}
+	return opts
+}
+
+// queryMemory 会话中单个查询可以使用的最大内存, 取sort_memory与资源组限制中较小的一个
+func (db *NtDB) queryMemory(session *Session) int64 {
+	memory := db.intVariable(session, VarSortMemory)
+	if memory == 0 || (session.MaxMemory > 0 && session.MaxMemory < memory) {
+		return session.MaxMemory
+	}
+	return memory
+}
+
+// Autocommit 会话中事物之外的语句是否自动提交
+func (db *NtDB) Autocommit(session *Session) bool {
+	return db.variable(session, VarAutocommit) == "on"
+}
+
+// setVariable 会话变量立即生效; 全局变量在xid事物中写入sys_variables, 提交之后生效
+func (db *NtDB) setVariable(session *Session, xid int64, set *SetVariable) error {
+	check, ext := variableChecks[set.Name]
+	if !ext {
+		return &ErrorUnknownVariable{}
+	}
+	value, ok := check(set.Value)
+	if !ok {
+		return &ErrorInvalidVariable{}
+	}
+	if !set.Global {
+		if session.Vars == nil {
+			return &ErrorIllegalOperation{}
+		}
+		session.Vars.set(set.Name, value)
+		return nil
+	}
+	if xid == -1 {
+		return &ErrorIllegalOperation{}
+	}
+	if !db.hasSystemTable(xid, VariableTable) {
+		create := &tableManager.Create{
+			TbName: VariableTable,
+			Fields: []*tableManager.FieldCreate{
+				{FName: "name", FType: "string"},
+				{FName: "value", FType: "string"},
+			},
+		}
+		if err := db.storageEngine.Create(xid, create); err != nil {
+			return err
+		}
+	} else {
+		del := &tableManager.Delete{
+			TName: VariableTable,
+			Where: &tableManager.Where{Compare: &tableManager.Compare{FieldName: "name", CompareTo: "=", Value: set.Name}},
+		}
+		if _, err := db.storageEngine.Delete(xid, del); err != nil {
+			return err
+		}
+	}
+	insert := &tableManager.Insert{TbName: VariableTable, Values: []string{set.Name, value}}
+	if _, err := db.storageEngine.Insert(xid, insert); err != nil {
+		return err
+	}
+	db.afterCommit(xid, func() {
+		db.globals.set(set.Name, value)
+	})
+	return nil
+}
+
+// showVariables 所有变量在会话中的值以及来源(session | global)
+func (db *NtDB) showVariables(session *Session) []*tableManager.ResponseObject {
+	title := []string{"name", "value", "scope"}
+	res := make([]*tableManager.ResponseObject, 0)
+	for j, name := range title {
+		res = append(res, &tableManager.ResponseObject{Payload: name, RowId: 0, ColId: j})
+	}
+	names := make([]string, 0, len(variableChecks))
+	for name := range variableChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		value, scope := db.globals.get(name), "global"
+		if v, ext := session.Vars.get(name); ext {
+			value, scope = v, "session"
+		}
+		for j, payload := range []string{name, value, scope} {
+			res = append(res, &tableManager.ResponseObject{Payload: payload, RowId: i + 1, ColId: j})
+		}
+	}
+	return res
+}
+
+// loadVariables
+// 启动时载入sys_variables中的全局变量
+func (db *NtDB) loadVariables() {
+	xid := db.storageEngine.Begin()
+	defer db.storageEngine.Commit(xid)
+	if !db.hasSystemTable(xid, VariableTable) {
+		return
+	}
+	rows, err := db.storageEngine.Select(xid, &tableManager.Select{TbName: VariableTable, FNames: []string{"name", "value"}})
+	if err != nil {
+		panic(err)
+	}
+	values := map[int][]string{}
+	for _, row := range rows {
+		if row.RowId != 0 {
+			values[row.RowId] = append(values[row.RowId], row.Payload)
+		}
+	}
+	for _, value := range values {
+		if check, ext := variableChecks[value[0]]; ext {
+			if v, ok := check(value[1]); ok {
+				db.globals.set(value[0], v)
+				continue
+			}
+		}
+		log.Printf("[Executor] Skip invalid variable %s = %s\n", value[0], value[1])
+	}
+	log.Printf("[Executor] Load %d global variables\n", len(values))
+}
@@ -0,0 +1,477 @@
+package executor
+
+import (
+	util "myDB/dataStructure"
+	"myDB/tableManager"
+	"strconv"
+	"strings"
+)
+
+// 窗口函数
+// select <item> ... from <table> [where ...]
+// item := <field> | <func>(<args>) over ( [partition by <field>, ...] [order by <field> [asc|desc], ...] ) [as <alias>]
+// func := row_number | rank | dense_rank | lag | lead | count | sum | min | max | avg
+// lag/lead(<field> [, offset [, default]]), 聚合函数(<field>), count(*)
+// 聚合函数带order by时为累计值(包括当前行的所有peer行)，否则为整个分区的聚合值
+// 实现：先读取所有需要的字段，对每个窗口按(partition, order)进行外部排序，再按分区计算
+// 输出行的顺序与普通select相同(全表扫描的顺序)
+
+type orderKey struct {
+	field string
+	desc  bool
+}
+
+type windowItem struct {
+	name      string // 输出的列名
+	field     string // 普通字段, 窗口函数时为空
+	function  string // 大写函数名
+	args      []string
+	partition []string
+	order     []*orderKey
+}
+
+type ErrorInvalidWindow struct{}
+
+func (err *ErrorInvalidWindow) Error() string {
+	return "Invalid window function"
+}
+
+// isWindowQuery select的字段列表中包含窗口函数
+func isWindowQuery(fNames []string) bool {
+	for _, name := range fNames {
+		if strings.HasPrefix(strings.ToUpper(name), tableManager.JsonExtractFun) {
+			// json_extract(field,path) 不是窗口函数
+			continue
+		}
+		if strings.Contains(name, "(") || strings.ToUpper(name) == "OVER" {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenizeWindow 将字段列表重新切分为 标识符 ( ) ,
+func tokenizeWindow(fNames []string) []string {
+	tokens := make([]string, 0)
+	for _, name := range fNames {
+		start := 0
+		for i, c := range name {
+			if c == '(' || c == ')' || c == ',' {
+				if i > start {
+					tokens = append(tokens, name[start:i])
+				}
+				tokens = append(tokens, string(c))
+				start = i + 1
+			}
+		}
+		if start < len(name) {
+			tokens = append(tokens, name[start:])
+		}
+	}
+	return tokens
+}
+
+func parseWindowItems(fNames []string) ([]*windowItem, error) {
+	tokens := tokenizeWindow(fNames)
+	items := make([]*windowItem, 0)
+	pos := 0
+	expect := func(token string) bool {
+		if pos < len(tokens) && strings.ToUpper(tokens[pos]) == token {
+			pos += 1
+			return true
+		}
+		return false
+	}
+	for pos < len(tokens) {
+		if expect(",") {
+			continue
+		}
+		name := tokens[pos]
+		pos += 1
+		if !expect("(") {
+			items = append(items, &windowItem{name: name, field: name})
+			continue
+		}
+		item := &windowItem{function: strings.ToUpper(name), args: make([]string, 0)}
+		for pos < len(tokens) && tokens[pos] != ")" {
+			if tokens[pos] != "," {
+				item.args = append(item.args, tokens[pos])
+			}
+			pos += 1
+		}
+		if !expect(")") || !expect("OVER") || !expect("(") {
+			return nil, &ErrorInvalidWindow{}
+		}
+		item.name = strings.ToLower(name) + "(" + strings.Join(item.args, ",") + ")"
+		if expect("PARTITION") {
+			if !expect("BY") {
+				return nil, &ErrorInvalidWindow{}
+			}
+			for pos < len(tokens) && tokens[pos] != ")" && strings.ToUpper(tokens[pos]) != "ORDER" {
+				if tokens[pos] != "," {
+					item.partition = append(item.partition, tokens[pos])
+				}
+				pos += 1
+			}
+		}
+		if expect("ORDER") {
+			if !expect("BY") {
+				return nil, &ErrorInvalidWindow{}
+			}
+			for pos < len(tokens) && tokens[pos] != ")" {
+				switch strings.ToUpper(tokens[pos]) {
+				case ",":
+				case "ASC":
+					if len(item.order) == 0 {
+						return nil, &ErrorInvalidWindow{}
+					}
+				case "DESC":
+					if len(item.order) == 0 {
+						return nil, &ErrorInvalidWindow{}
+					}
+					item.order[len(item.order)-1].desc = true
+				default:
+					item.order = append(item.order, &orderKey{field: tokens[pos]})
+				}
+				pos += 1
+			}
+		}
+		if !expect(")") {
+			return nil, &ErrorInvalidWindow{}
+		}
+		if expect("AS") {
+			if pos >= len(tokens) {
+				return nil, &ErrorInvalidWindow{}
+			}
+			item.name = tokens[pos]
+			pos += 1
+		}
+		if err := checkWindowArgs(item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func checkWindowArgs(item *windowItem) error {
+	switch item.function {
+	case "ROW_NUMBER", "RANK", "DENSE_RANK":
+		if len(item.args) == 0 {
+			return nil
+		}
+	case "LAG", "LEAD":
+		if len(item.args) >= 1 && len(item.args) <= 3 {
+			if len(item.args) >= 2 {
+				if offset, err := strconv.Atoi(item.args[1]); err != nil || offset < 0 {
+					return &ErrorInvalidWindow{}
+				}
+			}
+			return nil
+		}
+	case "COUNT", "SUM", "MIN", "MAX", "AVG":
+		if len(item.args) == 1 && (item.args[0] != "*" || item.function == "COUNT") {
+			return nil
+		}
+	}
+	return &ErrorInvalidWindow{}
+}
+
+// selectWindow 执行带窗口函数的select
+func (db *NtDB) selectWindow(session *Session, xid int64, sel *tableManager.Select) ([]*tableManager.ResponseObject, error) {
+	items, err := parseWindowItems(sel.FNames)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := db.storageEngine.Describe(xid, sel.TbName)
+	if err != nil {
+		return nil, err
+	}
+	fTypes := make(map[string]tableManager.FieldType, len(fields))
+	for _, f := range fields {
+		fTypes[f.GetName()] = f.GetFType()
+	}
+	// 需要读取的字段
+	columns := make([]string, 0)
+	index := make(map[string]int)
+	need := func(name string) error {
+		if _, ext := fTypes[name]; !ext {
+			return &tableManager.ErrorFieldNotExist{}
+		}
+		if _, ext := index[name]; !ext {
+			index[name] = len(columns)
+			columns = append(columns, name)
+		}
+		return nil
+	}
+	for _, item := range items {
+		names := append([]string{}, item.partition...)
+		for _, key := range item.order {
+			names = append(names, key.field)
+		}
+		if item.field != "" {
+			names = append(names, item.field)
+		} else if len(item.args) > 0 && item.args[0] != "*" {
+			names = append(names, item.args[0])
+		}
+		for _, name := range names {
+			if err := need(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(columns) == 0 {
+		// count(*) over () 等不需要字段的查询，读取主键确定行数
+		_ = need(tableManager.PrimaryKeyCol)
+	}
+	response, err := db.storageEngine.Select(xid, &tableManager.Select{
+		TbName:        sel.TbName,
+		FNames:        columns,
+		ReadForUpdate: sel.ReadForUpdate,
+		Where:         sel.Where,
+		MaxMemory:     sel.MaxMemory,
+		Parallel:      sel.Parallel,
+	})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]string, 0)
+	for _, r := range response {
+		if r.RowId == 0 {
+			continue
+		}
+		if r.RowId > len(rows) {
+			rows = append(rows, make([]string, len(columns)))
+		}
+		rows[r.RowId-1][r.ColId] = r.Payload
+	}
+	// 计算窗口函数, 所有窗口的排序共享语句的内存预算
+	mem := db.queryBudget(session)
+	values := make([][]string, len(items))
+	for i, item := range items {
+		if item.field != "" {
+			continue
+		}
+		w := &window{item: item, rows: rows, index: index, fTypes: fTypes, values: make([]string, len(rows))}
+		if err := w.compute(mem, sel.Parallel); err != nil {
+			return nil, err
+		}
+		values[i] = w.values
+	}
+	ret := make([]*tableManager.ResponseObject, 0, (len(rows)+1)*len(items))
+	for colId, item := range items {
+		ret = append(ret, &tableManager.ResponseObject{Payload: item.name, RowId: 0, ColId: colId})
+	}
+	for rowId, row := range rows {
+		for colId, item := range items {
+			var payload string
+			if item.field != "" {
+				payload = row[index[item.field]]
+			} else {
+				payload = values[colId][rowId]
+			}
+			ret = append(ret, &tableManager.ResponseObject{Payload: payload, RowId: rowId + 1, ColId: colId})
+		}
+	}
+	return ret, nil
+}
+
+// window 一个窗口函数的计算
+type window struct {
+	item   *windowItem
+	rows   [][]string
+	index  map[string]int // 字段名 -> rows中的下标
+	fTypes map[string]tableManager.FieldType
+	values []string // 计算结果，与rows一一对应
+}
+
+func (w *window) compare(field string, a, b []string) int {
+	i := w.index[field]
+	return tableManager.DefaultFieldFactory.GetCompareFunction(w.fTypes[field])(a[i], b[i])
+}
+
+func (w *window) samePartition(a, b []string) bool {
+	for _, field := range w.item.partition {
+		if w.compare(field, a, b) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *window) peer(a, b []string) bool {
+	for _, key := range w.item.order {
+		if w.compare(key.field, a, b) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *window) less(a, b []string) bool {
+	for _, field := range w.item.partition {
+		if c := w.compare(field, a, b); c != 0 {
+			return c < 0
+		}
+	}
+	for _, key := range w.item.order {
+		if c := w.compare(key.field, a, b); c != 0 {
+			return (c < 0) != key.desc
+		}
+	}
+	return false
+}
+
+// compute 按(partition, order)外部排序后逐个分区计算
+// 排序的每一行最后追加该行在rows中的下标
+func (w *window) compute(mem *util.MemoryBudget, workers int) error {
+	sorter := util.NewBudgetSorter(w.less, mem, workers)
+	for i, row := range w.rows {
+		if err := sorter.Add(append(append([]string{}, row...), strconv.Itoa(i))); err != nil {
+			sorter.Close()
+			return err
+		}
+	}
+	it, err := sorter.Sort()
+	if err != nil {
+		sorter.Close()
+		return err
+	}
+	defer it.Close()
+	partition := make([][]string, 0)
+	for {
+		row, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil || (len(partition) > 0 && !w.samePartition(partition[0], row)) {
+			if err := w.computePartition(partition); err != nil {
+				return err
+			}
+			partition = make([][]string, 0)
+		}
+		if row == nil {
+			return nil
+		}
+		partition = append(partition, row)
+	}
+}
+
+func (w *window) computePartition(part [][]string) error {
+	pos := func(row []string) int {
+		i, _ := strconv.Atoi(row[len(row)-1])
+		return i
+	}
+	switch w.item.function {
+	case "ROW_NUMBER":
+		for i, row := range part {
+			w.values[pos(row)] = strconv.Itoa(i + 1)
+		}
+	case "RANK", "DENSE_RANK":
+		rank, dense := 0, 0
+		for i, row := range part {
+			if i == 0 || !w.peer(part[i-1], row) {
+				rank, dense = i+1, dense+1
+			}
+			if w.item.function == "RANK" {
+				w.values[pos(row)] = strconv.Itoa(rank)
+			} else {
+				w.values[pos(row)] = strconv.Itoa(dense)
+			}
+		}
+	case "LAG", "LEAD":
+		offset, def := 1, ""
+		if len(w.item.args) >= 2 {
+			offset, _ = strconv.Atoi(w.item.args[1])
+		}
+		if len(w.item.args) == 3 {
+			def = w.item.args[2]
+		}
+		if w.item.function == "LAG" {
+			offset = -offset
+		}
+		field := w.index[w.item.args[0]]
+		for i, row := range part {
+			if j := i + offset; j >= 0 && j < len(part) {
+				w.values[pos(row)] = part[j][field]
+			} else {
+				w.values[pos(row)] = def
+			}
+		}
+	default:
+		// 聚合函数, 按peer分组累计
+		agg := w.newAggregate()
+		for start := 0; start < len(part); {
+			end := start + 1
+			if len(w.item.order) == 0 {
+				end = len(part)
+			}
+			for end < len(part) && w.peer(part[start], part[end]) {
+				end += 1
+			}
+			for _, row := range part[start:end] {
+				if err := agg.add(row); err != nil {
+					return err
+				}
+			}
+			value := agg.result()
+			for _, row := range part[start:end] {
+				w.values[pos(row)] = value
+			}
+			start = end
+		}
+	}
+	return nil
+}
+
+// aggregate 窗口上的聚合函数
+type aggregate struct {
+	w     *window
+	count int64
+	sum   int64
+	best  []string // min/max
+}
+
+func (w *window) newAggregate() *aggregate {
+	return &aggregate{w: w}
+}
+
+func (agg *aggregate) add(row []string) error {
+	agg.count += 1
+	switch agg.w.item.function {
+	case "SUM", "AVG":
+		field := agg.w.item.args[0]
+		if agg.w.fTypes[field] == tableManager.STRING {
+			return &ErrorInvalidWindow{}
+		}
+		v, err := strconv.ParseInt(row[agg.w.index[field]], 10, 64)
+		if err != nil {
+			return err
+		}
+		agg.sum += v
+	case "MIN", "MAX":
+		field := agg.w.item.args[0]
+		if agg.best == nil {
+			agg.best = row
+			break
+		}
+		c := agg.w.compare(field, row, agg.best)
+		if (agg.w.item.function == "MIN" && c < 0) || (agg.w.item.function == "MAX" && c > 0) {
+			agg.best = row
+		}
+	}
+	return nil
+}
+
+func (agg *aggregate) result() string {
+	switch agg.w.item.function {
+	case "COUNT":
+		return strconv.FormatInt(agg.count, 10)
+	case "SUM":
+		return strconv.FormatInt(agg.sum, 10)
+	case "AVG":
+		return strconv.FormatFloat(float64(agg.sum)/float64(agg.count), 'f', -1, 64)
+	default:
+		return agg.best[agg.w.index[agg.w.item.args[0]]]
+	}
+}
@@ -0,0 +1,218 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+)
+
+// Arrow 结果集编码
+// 查询结果按行数切分为多个RecordBatch, 每列在内存中按Arrow的列式布局存放:
+// INT32/INT64 -> 小端定长数组, 字符串 -> int32 offsets(length+1) + 数据
+// 编码为Arrow IPC stream格式:
+// [Schema Message] [RecordBatch Message]... [EOS]
+// Message: [Continuation 0xffffffff]4 [MetadataLength]4 [Flatbuffer Message](8字节对齐) [Body]
+// EOS: [0xffffffff]4 [0]4
+// 所有列不为空(null_count = 0), validity buffer长度为0
+
+const DefaultBatchSize int = 4096
+
+const (
+	arrowContinuation uint32 = 0xffffffff
+	metadataVersionV5 int16  = 4
+	headerSchema      uint8  = 1
+	headerRecordBatch uint8  = 3
+	typeInt           uint8  = 2
+	typeUtf8          uint8  = 5
+)
+
+// ArrowColumn 一列数据, 按类型只使用其中一部分
+type ArrowColumn struct {
+	Int32s  []int32
+	Int64s  []int64
+	Offsets []int32 // 第i个字符串为 Data[Offsets[i]:Offsets[i+1]]
+	Data    []byte
+}
+
+type RecordBatch struct {
+	Length  int
+	Columns []*ArrowColumn
+}
+
+// ArrowTable 一组拥有相同schema的RecordBatch
+type ArrowTable struct {
+	Fields  []*Column // Type: Int32, Int64, ByteArray(utf8)
+	Batches []*RecordBatch
+}
+
+// Value 以字符串形式返回第batch个RecordBatch中row行col列的值
+func (t *ArrowTable) Value(batch, row, col int) string {
+	c := t.Batches[batch].Columns[col]
+	switch t.Fields[col].Type {
+	case Int32:
+		return strconv.FormatInt(int64(c.Int32s[row]), 10)
+	case Int64:
+		return strconv.FormatInt(c.Int64s[row], 10)
+	default:
+		return string(c.Data[c.Offsets[row]:c.Offsets[row+1]])
+	}
+}
+
+// NewArrowTable 将行数据按batchSize切分为RecordBatch, batchSize <= 0 时使用默认值
+func NewArrowTable(fields []*Column, rows [][]string, batchSize int) (*ArrowTable, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	table := &ArrowTable{Fields: fields, Batches: make([]*RecordBatch, 0)}
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch, err := newRecordBatch(fields, rows[start:end])
+		if err != nil {
+			return nil, err
+		}
+		table.Batches = append(table.Batches, batch)
+	}
+	return table, nil
+}
+
+func newRecordBatch(fields []*Column, rows [][]string) (*RecordBatch, error) {
+	batch := &RecordBatch{Length: len(rows), Columns: make([]*ArrowColumn, len(fields))}
+	for i, f := range fields {
+		col := &ArrowColumn{}
+		if f.Type == ByteArray {
+			col.Offsets = make([]int32, 1, len(rows)+1)
+		}
+		for _, row := range rows {
+			if len(row) != len(fields) {
+				return nil, &ErrorInvalidColumnValue{}
+			}
+			switch f.Type {
+			case Int32:
+				{
+					v, err := strconv.ParseInt(row[i], 10, 32)
+					if err != nil {
+						return nil, &ErrorInvalidColumnValue{}
+					}
+					col.Int32s = append(col.Int32s, int32(v))
+				}
+			case Int64:
+				{
+					v, err := strconv.ParseInt(row[i], 10, 64)
+					if err != nil {
+						return nil, &ErrorInvalidColumnValue{}
+					}
+					col.Int64s = append(col.Int64s, v)
+				}
+			default:
+				{
+					col.Data = append(col.Data, row[i]...)
+					col.Offsets = append(col.Offsets, int32(len(col.Data)))
+				}
+			}
+		}
+		batch.Columns[i] = col
+	}
+	return batch, nil
+}
+
+// Encode 编码为Arrow IPC stream
+func (t *ArrowTable) Encode() []byte {
+	buffer := bytes.NewBuffer([]byte{})
+	writeMessage(buffer, t.wrapSchema(), nil)
+	for _, batch := range t.Batches {
+		body, meta := t.wrapRecordBatch(batch)
+		writeMessage(buffer, meta, body)
+	}
+	_ = binary.Write(buffer, binary.LittleEndian, arrowContinuation)
+	_ = binary.Write(buffer, binary.LittleEndian, uint32(0))
+	return buffer.Bytes()
+}
+
+func writeMessage(buffer *bytes.Buffer, meta, body []byte) {
+	// 8 + metadata 按8字节对齐
+	padded := len(meta)
+	for (8+padded)%8 != 0 {
+		padded += 1
+	}
+	_ = binary.Write(buffer, binary.LittleEndian, arrowContinuation)
+	_ = binary.Write(buffer, binary.LittleEndian, uint32(padded))
+	buffer.Write(meta)
+	buffer.Write(make([]byte, padded-len(meta)))
+	buffer.Write(body)
+}
+
+// message Message 0: version, 1: header_type, 2: header, 3: bodyLength
+func wrapMessage(headerType uint8, header *fbTable, bodyLength int64) []byte {
+	msg := newTable().
+		addScalar(0, metadataVersionV5).
+		addScalar(1, headerType).
+		addChild(2, header).
+		addScalar(3, bodyLength)
+	return encodeFlatbuffer(msg)
+}
+
+// wrapSchema
+// Schema 0: endianness, 1: fields
+// Field 0: name, 1: nullable, 2: type_type, 3: type, 5: children
+// Int 0: bitWidth, 1: is_signed
+func (t *ArrowTable) wrapSchema() []byte {
+	fields := make(fbTables, len(t.Fields))
+	for i, f := range t.Fields {
+		field := newTable().addChild(0, fbString(f.Name)).addScalar(1, false)
+		switch f.Type {
+		case Int32:
+			field.addScalar(2, typeInt).addChild(3, newTable().addScalar(0, int32(32)).addScalar(1, true))
+		case Int64:
+			field.addScalar(2, typeInt).addChild(3, newTable().addScalar(0, int32(64)).addScalar(1, true))
+		default:
+			field.addScalar(2, typeUtf8).addChild(3, newTable())
+		}
+		field.addChild(5, fbTables{})
+		fields[i] = field
+	}
+	schema := newTable().addScalar(0, int16(0)).addChild(1, fields)
+	return wrapMessage(headerSchema, schema, 0)
+}
+
+// wrapRecordBatch 返回body以及消息元数据
+// RecordBatch 0: length, 1: nodes, 2: buffers
+// FieldNode {length, null_count}, Buffer {offset, length}
+// 每列的buffers: validity, values (utf8: validity, offsets, data), 每个buffer按8字节对齐
+func (t *ArrowTable) wrapRecordBatch(batch *RecordBatch) ([]byte, []byte) {
+	body := bytes.NewBuffer([]byte{})
+	nodes := bytes.NewBuffer([]byte{})
+	buffers := bytes.NewBuffer([]byte{})
+	bufferCount := 0
+	addBuffer := func(data any) {
+		offset := body.Len()
+		_ = binary.Write(body, binary.LittleEndian, data)
+		length := body.Len() - offset
+		for body.Len()%8 != 0 {
+			body.WriteByte(0)
+		}
+		_ = binary.Write(buffers, binary.LittleEndian, []int64{int64(offset), int64(length)})
+		bufferCount += 1
+	}
+	for i, f := range t.Fields {
+		col := batch.Columns[i]
+		_ = binary.Write(nodes, binary.LittleEndian, []int64{int64(batch.Length), 0})
+		addBuffer([]byte{}) // validity
+		switch f.Type {
+		case Int32:
+			addBuffer(col.Int32s)
+		case Int64:
+			addBuffer(col.Int64s)
+		default:
+			addBuffer(col.Offsets)
+			addBuffer(col.Data)
+		}
+	}
+	rb := newTable().
+		addScalar(0, int64(batch.Length)).
+		addChild(1, &fbStructs{count: len(t.Fields), data: nodes.Bytes()}).
+		addChild(2, &fbStructs{count: bufferCount, data: buffers.Bytes()})
+	return body.Bytes(), wrapMessage(headerRecordBatch, rb, int64(body.Len()))
+}
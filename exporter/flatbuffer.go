@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// flatbuffer 编码, 只实现Arrow IPC元数据需要的部分
+// 与官方实现从后向前构建不同, 这里从前向后写入: 父对象在前, 子对象(string, vector, table)在后
+// uoffset 从存放位置指向之后的子对象, table 的 soffset 指向其之前的 vtable
+// vtable: [VTableSize]2[TableSize]2[FieldOffset]2...
+// table:  [SOffset]4[Fields]... 所有table按8字节对齐
+
+type fbObject interface {
+	write(b *fbBuilder) int // 写入对象, 返回对象的位置
+}
+
+type fbField struct {
+	slot   int
+	scalar []byte   // 标量, 小端
+	child  fbObject // 引用的子对象
+}
+
+type fbTable struct {
+	fields []*fbField
+}
+
+type fbString string
+
+type fbTables []*fbTable
+
+// fbStructs 定长struct的vector, 每个元素按8字节对齐
+type fbStructs struct {
+	count int
+	data  []byte
+}
+
+type fbBuilder struct {
+	buf bytes.Buffer
+}
+
+func newTable() *fbTable {
+	return &fbTable{fields: make([]*fbField, 0)}
+}
+
+func (t *fbTable) addScalar(slot int, value any) *fbTable {
+	buffer := bytes.NewBuffer([]byte{})
+	_ = binary.Write(buffer, binary.LittleEndian, value)
+	t.fields = append(t.fields, &fbField{slot: slot, scalar: buffer.Bytes()})
+	return t
+}
+
+func (t *fbTable) addChild(slot int, child fbObject) *fbTable {
+	t.fields = append(t.fields, &fbField{slot: slot, child: child})
+	return t
+}
+
+// encodeFlatbuffer 编码以root为根的flatbuffer
+func encodeFlatbuffer(root *fbTable) []byte {
+	b := &fbBuilder{}
+	b.buf.Write(make([]byte, 4))
+	pos := root.write(b)
+	b.patch(0, pos)
+	return b.buf.Bytes()
+}
+
+func (b *fbBuilder) align(n int) {
+	for b.buf.Len()%n != 0 {
+		b.buf.WriteByte(0)
+	}
+}
+
+// patch 在at处写入指向pos的uoffset
+func (b *fbBuilder) patch(at, pos int) {
+	binary.LittleEndian.PutUint32(b.buf.Bytes()[at:], uint32(pos-at))
+}
+
+func (t *fbTable) write(b *fbBuilder) int {
+	// table内的布局, 字段按大小对齐
+	slots := 0
+	offsets := make([]int, len(t.fields))
+	size := 4 // soffset
+	for i, f := range t.fields {
+		width := 4
+		if f.child == nil {
+			width = len(f.scalar)
+		}
+		for size%width != 0 {
+			size += 1
+		}
+		offsets[i] = size
+		size += width
+		if f.slot+1 > slots {
+			slots = f.slot + 1
+		}
+	}
+	// vtable
+	b.align(2)
+	vtablePos := b.buf.Len()
+	vtable := make([]uint16, 2+slots)
+	vtable[0] = uint16(2 * len(vtable))
+	vtable[1] = uint16(size)
+	for i, f := range t.fields {
+		vtable[2+f.slot] = uint16(offsets[i])
+	}
+	_ = binary.Write(&b.buf, binary.LittleEndian, vtable)
+	// table
+	b.align(8)
+	tablePos := b.buf.Len()
+	raw := make([]byte, size)
+	binary.LittleEndian.PutUint32(raw, uint32(int32(tablePos-vtablePos)))
+	for i, f := range t.fields {
+		if f.child == nil {
+			copy(raw[offsets[i]:], f.scalar)
+		}
+	}
+	b.buf.Write(raw)
+	for i, f := range t.fields {
+		if f.child != nil {
+			pos := f.child.write(b)
+			b.patch(tablePos+offsets[i], pos)
+		}
+	}
+	return tablePos
+}
+
+func (s fbString) write(b *fbBuilder) int {
+	b.align(4)
+	pos := b.buf.Len()
+	_ = binary.Write(&b.buf, binary.LittleEndian, uint32(len(s)))
+	b.buf.WriteString(string(s))
+	b.buf.WriteByte(0)
+	return pos
+}
+
+func (v fbTables) write(b *fbBuilder) int {
+	b.align(4)
+	pos := b.buf.Len()
+	_ = binary.Write(&b.buf, binary.LittleEndian, uint32(len(v)))
+	b.buf.Write(make([]byte, 4*len(v)))
+	for i, t := range v {
+		b.patch(pos+4+4*i, t.write(b))
+	}
+	return pos
+}
+
+func (v *fbStructs) write(b *fbBuilder) int {
+	// 长度之后的元素数据按8字节对齐
+	for (b.buf.Len()+4)%8 != 0 {
+		b.buf.WriteByte(0)
+	}
+	pos := b.buf.Len()
+	_ = binary.Write(&b.buf, binary.LittleEndian, uint32(v.count))
+	b.buf.Write(v.data)
+	return pos
+}
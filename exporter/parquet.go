@@ -0,0 +1,284 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strconv"
+)
+
+// Parquet 导出
+// 文件格式: PAR1 [RowGroup]... [FileMetaData] [MetaDataLength]4 PAR1
+// 每个RowGroup中每一列写入一个数据页(DataPage V1)
+// 所有列均为REQUIRED, 不需要definition/repetition levels
+// 编码为PLAIN, 不压缩
+// PLAIN: INT32 -> 4字节小端, INT64 -> 8字节小端, BYTE_ARRAY -> [Length]4(小端)[Data]
+
+type ColumnType int32
+
+// Parquet物理类型
+const (
+	Boolean           ColumnType = 0
+	Int32             ColumnType = 1
+	Int64             ColumnType = 2
+	Float             ColumnType = 4
+	Double            ColumnType = 5
+	ByteArray         ColumnType = 6
+	FixedLenByteArray ColumnType = 7
+)
+
+// Parquet逻辑类型(ConvertedType)
+const (
+	ConvertedNone int32 = -1
+	ConvertedUtf8 int32 = 0
+	ConvertedJson int32 = 19
+)
+
+const (
+	ParquetMagic        string = "PAR1"
+	DefaultRowGroupSize int    = 1 << 16 // 每个RowGroup的行数
+	CreatedBy           string = "myDB"
+)
+
+// parquet-format 中的枚举值
+const (
+	pageTypeData       int32 = 0
+	encodingPlain      int32 = 0
+	encodingRle        int32 = 3
+	codecUncompressed  int32 = 0
+	repetitionRequired int32 = 0
+)
+
+type Column struct {
+	Name      string
+	Type      ColumnType
+	Converted int32 // ConvertedNone表示没有逻辑类型
+}
+
+type ErrorInvalidColumnValue struct{}
+
+func (err *ErrorInvalidColumnValue) Error() string {
+	return "Column value doesn't match the column type"
+}
+
+type columnChunk struct {
+	offset int64 // 数据页的位置
+	size   int64 // 页头 + 数据
+}
+
+type rowGroup struct {
+	chunks  []*columnChunk
+	numRows int64
+	size    int64
+}
+
+type ParquetWriter struct {
+	file         *os.File
+	writer       *bufio.Writer
+	columns      []*Column
+	rowGroupSize int
+	buffer       [][]string
+	rowGroups    []*rowGroup
+	offset       int64
+	numRows      int64
+}
+
+// NewParquetWriter rowGroupSize <= 0 时使用默认值
+func NewParquetWriter(path string, columns []*Column, rowGroupSize int) (*ParquetWriter, error) {
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &ParquetWriter{
+		file:         file,
+		writer:       bufio.NewWriter(file),
+		columns:      columns,
+		rowGroupSize: rowGroupSize,
+		buffer:       make([][]string, 0),
+		rowGroups:    make([]*rowGroup, 0),
+	}
+	if err := w.write([]byte(ParquetMagic)); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write 写入一行, 值与列一一对应
+func (w *ParquetWriter) Write(row []string) error {
+	if len(row) != len(w.columns) {
+		return &ErrorInvalidColumnValue{}
+	}
+	w.buffer = append(w.buffer, row)
+	if len(w.buffer) >= w.rowGroupSize {
+		return w.flushRowGroup()
+	}
+	return nil
+}
+
+// Close 写入剩余的行以及文件尾
+func (w *ParquetWriter) Close() error {
+	defer w.file.Close()
+	if len(w.buffer) > 0 {
+		if err := w.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+	footer := w.wrapFileMetaData()
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(footer)))
+	if err := w.write(length); err != nil {
+		return err
+	}
+	if err := w.write([]byte(ParquetMagic)); err != nil {
+		return err
+	}
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *ParquetWriter) write(data []byte) error {
+	n, err := w.writer.Write(data)
+	w.offset += int64(n)
+	return err
+}
+
+func (w *ParquetWriter) flushRowGroup() error {
+	group := &rowGroup{chunks: make([]*columnChunk, len(w.columns)), numRows: int64(len(w.buffer))}
+	for i, col := range w.columns {
+		data, err := encodePlain(col.Type, w.buffer, i)
+		if err != nil {
+			return err
+		}
+		header := wrapPageHeader(len(w.buffer), len(data))
+		chunk := &columnChunk{offset: w.offset, size: int64(len(header) + len(data))}
+		if err := w.write(header); err != nil {
+			return err
+		}
+		if err := w.write(data); err != nil {
+			return err
+		}
+		group.chunks[i] = chunk
+		group.size += chunk.size
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.numRows += group.numRows
+	w.buffer = make([][]string, 0)
+	return nil
+}
+
+// encodePlain PLAIN编码第i列
+func encodePlain(typ ColumnType, rows [][]string, i int) ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	for _, row := range rows {
+		switch typ {
+		case Int32:
+			{
+				v, err := strconv.ParseInt(row[i], 10, 32)
+				if err != nil {
+					return nil, &ErrorInvalidColumnValue{}
+				}
+				_ = binary.Write(buffer, binary.LittleEndian, int32(v))
+			}
+		case Int64:
+			{
+				v, err := strconv.ParseInt(row[i], 10, 64)
+				if err != nil {
+					return nil, &ErrorInvalidColumnValue{}
+				}
+				_ = binary.Write(buffer, binary.LittleEndian, v)
+			}
+		default:
+			{
+				_ = binary.Write(buffer, binary.LittleEndian, uint32(len(row[i])))
+				buffer.WriteString(row[i])
+			}
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// PageHeader
+// 1: type, 2: uncompressed_page_size, 3: compressed_page_size, 5: data_page_header
+func wrapPageHeader(numValues, size int) []byte {
+	w := newThriftWriter()
+	w.fieldI32(1, pageTypeData)
+	w.fieldI32(2, int32(size))
+	w.fieldI32(3, int32(size))
+	w.fieldStruct(5)
+	// DataPageHeader 1: num_values, 2: encoding, 3: definition_level_encoding, 4: repetition_level_encoding
+	w.fieldI32(1, int32(numValues))
+	w.fieldI32(2, encodingPlain)
+	w.fieldI32(3, encodingRle)
+	w.fieldI32(4, encodingRle)
+	w.structEnd()
+	w.structEnd()
+	return w.Bytes()
+}
+
+// FileMetaData
+// 1: version, 2: schema, 3: num_rows, 4: row_groups, 6: created_by
+func (w *ParquetWriter) wrapFileMetaData() []byte {
+	t := newThriftWriter()
+	t.fieldI32(1, 1)
+	// schema: 根节点 + 每一列
+	// SchemaElement 1: type, 3: repetition_type, 4: name, 5: num_children, 6: converted_type
+	t.fieldList(2, thriftStruct, len(w.columns)+1)
+	t.structBegin()
+	t.fieldString(4, "schema")
+	t.fieldI32(5, int32(len(w.columns)))
+	t.structEnd()
+	for _, col := range w.columns {
+		t.structBegin()
+		t.fieldI32(1, int32(col.Type))
+		t.fieldI32(3, repetitionRequired)
+		t.fieldString(4, col.Name)
+		if col.Converted != ConvertedNone {
+			t.fieldI32(6, col.Converted)
+		}
+		t.structEnd()
+	}
+	t.fieldI64(3, w.numRows)
+	// RowGroup 1: columns, 2: total_byte_size, 3: num_rows
+	t.fieldList(4, thriftStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		t.structBegin()
+		t.fieldList(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			// ColumnChunk 2: file_offset, 3: meta_data
+			t.structBegin()
+			t.fieldI64(2, chunk.offset)
+			t.fieldStruct(3)
+			// ColumnMetaData 1: type, 2: encodings, 3: path_in_schema, 4: codec, 5: num_values,
+			// 6: total_uncompressed_size, 7: total_compressed_size, 9: data_page_offset
+			t.fieldI32(1, int32(w.columns[i].Type))
+			t.fieldList(2, thriftI32, 2)
+			t.writeI32(encodingPlain)
+			t.writeI32(encodingRle)
+			t.fieldList(3, thriftBinary, 1)
+			t.writeString(w.columns[i].Name)
+			t.fieldI32(4, codecUncompressed)
+			t.fieldI64(5, group.numRows)
+			t.fieldI64(6, chunk.size)
+			t.fieldI64(7, chunk.size)
+			t.fieldI64(9, chunk.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.fieldI64(2, group.size)
+		t.fieldI64(3, group.numRows)
+		t.structEnd()
+	}
+	t.fieldString(6, CreatedBy)
+	t.structEnd()
+	return t.Bytes()
+}
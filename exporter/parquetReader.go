@@ -0,0 +1,531 @@
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Parquet 读取
+// 读取整个文件, 按RowGroup依次解码每一列, 所有值转换为字符串
+// 只支持扁平的schema(根节点的子节点都是叶子), 列可以是REQUIRED或者OPTIONAL, 不支持REPEATED
+// 数据页: DataPage V1以及V2, 编码PLAIN或者字典编码(PLAIN_DICTIONARY/RLE_DICTIONARY, 字典页为PLAIN)
+// definition levels为RLE/bit-packed混合编码, 最大值为1; 空值读取为空字符串
+// 压缩: 不压缩, SNAPPY, GZIP
+// 物理类型: BOOLEAN, INT32, INT64, FLOAT, DOUBLE, BYTE_ARRAY, FIXED_LEN_BYTE_ARRAY, 不支持INT96
+
+const (
+	pageTypeDictionary  int32 = 2
+	pageTypeDataV2      int32 = 3
+	encodingPlainDict   int32 = 2
+	encodingRleDict     int32 = 8
+	codecSnappy         int32 = 1
+	codecGzip           int32 = 2
+	repetitionOptional  int32 = 1
+	repetitionRepeated  int32 = 2
+	parquetFooterLength int   = 8 // [MetaDataLength]4 PAR1
+)
+
+type ErrorInvalidParquet struct{}
+type ErrorUnsupportedParquet struct{}
+
+func (err *ErrorInvalidParquet) Error() string {
+	return "Invalid parquet file"
+}
+
+func (err *ErrorUnsupportedParquet) Error() string {
+	return "Unsupported parquet feature"
+}
+
+// columnReader 一列在一个RowGroup中的解码状态
+type columnReader struct {
+	typ        ColumnType
+	typeLength int
+	optional   bool
+	dictionary []string
+	values     []string
+}
+
+// ReadParquet 读取path中的所有行, 值与返回的列一一对应
+func ReadParquet(path string) ([]*Column, [][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	n := len(data)
+	if n < len(ParquetMagic)+parquetFooterLength || string(data[:4]) != ParquetMagic || string(data[n-4:]) != ParquetMagic {
+		return nil, nil, &ErrorInvalidParquet{}
+	}
+	length := int(binary.LittleEndian.Uint32(data[n-8:]))
+	if length > n-len(ParquetMagic)-parquetFooterLength {
+		return nil, nil, &ErrorInvalidParquet{}
+	}
+	meta, err := (&thriftReader{data: data[n-8-length : n-8]}).readStruct()
+	if err != nil {
+		return nil, nil, &ErrorInvalidParquet{}
+	}
+	// FileMetaData 2: schema, 4: row_groups
+	schema := meta.list(2)
+	if len(schema) < 2 {
+		return nil, nil, &ErrorInvalidParquet{}
+	}
+	root, _ := schema[0].(thriftFields)
+	if root == nil || int(root.integer(5)) != len(schema)-1 {
+		return nil, nil, &ErrorUnsupportedParquet{}
+	}
+	columns := make([]*Column, 0, len(schema)-1)
+	readers := make([]*columnReader, 0, len(schema)-1)
+	for _, e := range schema[1:] {
+		// SchemaElement 1: type, 2: type_length, 3: repetition_type, 4: name, 5: num_children, 6: converted_type
+		element, _ := e.(thriftFields)
+		if element == nil || element.integer(5) > 0 || !element.has(1) || element.integer(3) == int64(repetitionRepeated) {
+			return nil, nil, &ErrorUnsupportedParquet{}
+		}
+		converted := ConvertedNone
+		if element.has(6) {
+			converted = int32(element.integer(6))
+		}
+		columns = append(columns, &Column{Name: element.str(4), Type: ColumnType(element.integer(1)), Converted: converted})
+		readers = append(readers, &columnReader{
+			typ:        ColumnType(element.integer(1)),
+			typeLength: int(element.integer(2)),
+			optional:   element.integer(3) == int64(repetitionOptional),
+		})
+	}
+	rows := make([][]string, 0, meta.integer(3))
+	for _, g := range meta.list(4) {
+		// RowGroup 1: columns, 3: num_rows
+		group, _ := g.(thriftFields)
+		if group == nil || len(group.list(1)) != len(columns) {
+			return nil, nil, &ErrorInvalidParquet{}
+		}
+		numRows := int(group.integer(3))
+		for i, c := range group.list(1) {
+			chunk, _ := c.(thriftFields)
+			if chunk == nil || chunk.fields(3) == nil {
+				return nil, nil, &ErrorUnsupportedParquet{}
+			}
+			if err := readers[i].readChunk(data, chunk.fields(3), numRows); err != nil {
+				return nil, nil, err
+			}
+		}
+		for r := 0; r < numRows; r++ {
+			row := make([]string, len(columns))
+			for i := range columns {
+				row[i] = readers[i].values[r]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return columns, rows, nil
+}
+
+// readChunk 解码一列在一个RowGroup中的所有页
+// ColumnMetaData 4: codec, 5: num_values, 7: total_compressed_size, 9: data_page_offset, 11: dictionary_page_offset
+func (c *columnReader) readChunk(data []byte, meta thriftFields, numRows int) error {
+	start := meta.integer(9)
+	if offset := meta.integer(11); meta.has(11) && offset > 0 && offset < start {
+		start = offset
+	}
+	end := start + meta.integer(7)
+	if start < int64(len(ParquetMagic)) || end > int64(len(data)) || start > end || meta.integer(5) != int64(numRows) {
+		return &ErrorInvalidParquet{}
+	}
+	codec := int32(meta.integer(4))
+	c.dictionary, c.values = nil, make([]string, 0, numRows)
+	reader := &thriftReader{data: data[:end], pos: int(start)}
+	for len(c.values) < numRows {
+		// PageHeader 1: type, 2: uncompressed_page_size, 3: compressed_page_size,
+		// 5: data_page_header, 7: dictionary_page_header, 8: data_page_header_v2
+		header, err := reader.readStruct()
+		if err != nil {
+			return &ErrorInvalidParquet{}
+		}
+		size := int(header.integer(3))
+		if size < 0 || size > len(reader.data)-reader.pos {
+			return &ErrorInvalidParquet{}
+		}
+		page := reader.data[reader.pos : reader.pos+size]
+		reader.pos += size
+		uncompressed := int(header.integer(2))
+		switch int32(header.integer(1)) {
+		case pageTypeDictionary:
+			{
+				if page, err = decompressPage(codec, page, uncompressed); err != nil {
+					return err
+				}
+				dict := header.fields(7)
+				if dict == nil || int32(dict.integer(2)) != encodingPlain && int32(dict.integer(2)) != encodingPlainDict {
+					return &ErrorUnsupportedParquet{}
+				}
+				if c.dictionary, _, err = c.decodePlain(page, int(dict.integer(1))); err != nil {
+					return err
+				}
+			}
+		case pageTypeData:
+			{
+				if page, err = decompressPage(codec, page, uncompressed); err != nil {
+					return err
+				}
+				v1 := header.fields(5)
+				if v1 == nil {
+					return &ErrorInvalidParquet{}
+				}
+				var defined []bool
+				if c.optional {
+					// [Length]4 [RLE/bit-packed]
+					if len(page) < 4 || int(binary.LittleEndian.Uint32(page)) > len(page)-4 {
+						return &ErrorInvalidParquet{}
+					}
+					n := int(binary.LittleEndian.Uint32(page))
+					if defined, err = decodeLevels(page[4:4+n], int(v1.integer(1))); err != nil {
+						return err
+					}
+					page = page[4+n:]
+				}
+				if err := c.readValues(page, int32(v1.integer(2)), int(v1.integer(1)), defined); err != nil {
+					return err
+				}
+			}
+		case pageTypeDataV2:
+			{
+				// DataPageHeaderV2 1: num_values, 4: encoding, 5: definition_levels_byte_length,
+				// 6: repetition_levels_byte_length, 7: is_compressed
+				// levels不压缩, 位于数据之前, 没有长度前缀
+				v2 := header.fields(8)
+				if v2 == nil || v2.integer(6) != 0 {
+					return &ErrorUnsupportedParquet{}
+				}
+				n := int(v2.integer(5))
+				if n < 0 || n > len(page) {
+					return &ErrorInvalidParquet{}
+				}
+				var defined []bool
+				if c.optional {
+					if defined, err = decodeLevels(page[:n], int(v2.integer(1))); err != nil {
+						return err
+					}
+				}
+				values := page[n:]
+				if v2.boolean(7, true) {
+					if values, err = decompressPage(codec, values, uncompressed-n); err != nil {
+						return err
+					}
+				}
+				if err := c.readValues(values, int32(v2.integer(4)), int(v2.integer(1)), defined); err != nil {
+					return err
+				}
+			}
+		default:
+			// 索引页等直接跳过
+		}
+		if reader.pos >= len(reader.data) && len(c.values) < numRows {
+			return &ErrorInvalidParquet{}
+		}
+	}
+	if len(c.values) != numRows {
+		return &ErrorInvalidParquet{}
+	}
+	return nil
+}
+
+// readValues 解码一个数据页中的num个值, defined为nil时所有值都不为空
+func (c *columnReader) readValues(page []byte, encoding int32, num int, defined []bool) error {
+	present := num
+	if defined != nil {
+		present = 0
+		for _, d := range defined {
+			if d {
+				present++
+			}
+		}
+	}
+	var values []string
+	var err error
+	switch encoding {
+	case encodingPlain:
+		values, _, err = c.decodePlain(page, present)
+	case encodingPlainDict, encodingRleDict:
+		{
+			if c.dictionary == nil || len(page) == 0 {
+				return &ErrorInvalidParquet{}
+			}
+			var indexes []uint64
+			if indexes, err = decodeHybrid(page[1:], int(page[0]), present); err != nil {
+				return err
+			}
+			values = make([]string, present)
+			for i, index := range indexes {
+				if index >= uint64(len(c.dictionary)) {
+					return &ErrorInvalidParquet{}
+				}
+				values[i] = c.dictionary[index]
+			}
+		}
+	default:
+		return &ErrorUnsupportedParquet{}
+	}
+	if err != nil {
+		return err
+	}
+	if defined == nil {
+		c.values = append(c.values, values...)
+		return nil
+	}
+	next := 0
+	for _, d := range defined {
+		if d {
+			c.values = append(c.values, values[next])
+			next++
+		} else {
+			c.values = append(c.values, "")
+		}
+	}
+	return nil
+}
+
+// decodePlain PLAIN解码num个值, 返回值以及使用的字节数
+func (c *columnReader) decodePlain(data []byte, num int) ([]string, int, error) {
+	values := make([]string, 0, num)
+	pos := 0
+	fixed := func(size int) ([]byte, error) {
+		if size < 0 || pos+size > len(data) {
+			return nil, &ErrorInvalidParquet{}
+		}
+		pos += size
+		return data[pos-size : pos], nil
+	}
+	for i := 0; i < num; i++ {
+		switch c.typ {
+		case Boolean:
+			{
+				// 按位存储, 低位在前
+				if i/8 >= len(data) {
+					return nil, 0, &ErrorInvalidParquet{}
+				}
+				values = append(values, strconv.FormatBool(data[i/8]>>(i%8)&1 == 1))
+				pos = (i + 8) / 8
+				continue
+			}
+		case Int32:
+			{
+				b, err := fixed(4)
+				if err != nil {
+					return nil, 0, err
+				}
+				values = append(values, strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(b))), 10))
+			}
+		case Int64:
+			{
+				b, err := fixed(8)
+				if err != nil {
+					return nil, 0, err
+				}
+				values = append(values, strconv.FormatInt(int64(binary.LittleEndian.Uint64(b)), 10))
+			}
+		case Float:
+			{
+				b, err := fixed(4)
+				if err != nil {
+					return nil, 0, err
+				}
+				values = append(values, strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 'g', -1, 32))
+			}
+		case Double:
+			{
+				b, err := fixed(8)
+				if err != nil {
+					return nil, 0, err
+				}
+				values = append(values, strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)), 'g', -1, 64))
+			}
+		case ByteArray:
+			{
+				b, err := fixed(4)
+				if err != nil {
+					return nil, 0, err
+				}
+				if b, err = fixed(int(binary.LittleEndian.Uint32(b))); err != nil {
+					return nil, 0, err
+				}
+				values = append(values, string(b))
+			}
+		case FixedLenByteArray:
+			{
+				b, err := fixed(c.typeLength)
+				if err != nil {
+					return nil, 0, err
+				}
+				values = append(values, string(b))
+			}
+		default:
+			return nil, 0, &ErrorUnsupportedParquet{}
+		}
+	}
+	return values, pos, nil
+}
+
+// decodeLevels 最大值为1的definition levels, 位宽为1
+func decodeLevels(data []byte, num int) ([]bool, error) {
+	levels, err := decodeHybrid(data, 1, num)
+	if err != nil {
+		return nil, err
+	}
+	defined := make([]bool, num)
+	for i, l := range levels {
+		defined[i] = l == 1
+	}
+	return defined, nil
+}
+
+// decodeHybrid RLE/bit-packed混合编码, 解码num个值
+// run头为varint: 最低位为0时是RLE, 重复次数为header>>1, 值占ceil(width/8)字节(小端)
+// 最低位为1时是bit-packed, 共(header>>1)*8个值, 每个值width位, 低位在前
+func decodeHybrid(data []byte, width, num int) ([]uint64, error) {
+	if width < 0 || width > 64 {
+		return nil, &ErrorInvalidParquet{}
+	}
+	values := make([]uint64, 0, num)
+	pos := 0
+	for len(values) < num {
+		header, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, &ErrorInvalidParquet{}
+		}
+		pos += n
+		if header&1 == 0 {
+			size := (width + 7) / 8
+			if pos+size > len(data) {
+				return nil, &ErrorInvalidParquet{}
+			}
+			v := uint64(0)
+			for i := 0; i < size; i++ {
+				v |= uint64(data[pos+i]) << (8 * i)
+			}
+			pos += size
+			for count := header >> 1; count > 0 && len(values) < num; count-- {
+				values = append(values, v)
+			}
+			continue
+		}
+		count := int(header>>1) * 8
+		if pos+count*width/8 > len(data) {
+			return nil, &ErrorInvalidParquet{}
+		}
+		for i := 0; i < count && len(values) < num; i++ {
+			v := uint64(0)
+			for b := 0; b < width; b++ {
+				bit := i*width + b
+				v |= uint64(data[pos+bit/8]>>(bit%8)&1) << b
+			}
+			values = append(values, v)
+		}
+		pos += count * width / 8
+	}
+	return values, nil
+}
+
+func decompressPage(codec int32, page []byte, size int) ([]byte, error) {
+	switch codec {
+	case codecUncompressed:
+		return page, nil
+	case codecSnappy:
+		return decodeSnappy(page)
+	case codecGzip:
+		{
+			reader, err := gzip.NewReader(bytes.NewReader(page))
+			if err != nil {
+				return nil, &ErrorInvalidParquet{}
+			}
+			buffer := bytes.NewBuffer(make([]byte, 0, size))
+			if _, err := io.Copy(buffer, reader); err != nil {
+				return nil, &ErrorInvalidParquet{}
+			}
+			return buffer.Bytes(), nil
+		}
+	}
+	return nil, &ErrorUnsupportedParquet{}
+}
+
+// decodeSnappy snappy块格式: [UncompressedLength]varint 之后为literal以及copy
+// tag低两位: 0 literal, 1 copy(偏移11位), 2 copy(偏移2字节), 3 copy(偏移4字节)
+func decodeSnappy(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 || length > math.MaxInt32 {
+		return nil, &ErrorInvalidParquet{}
+	}
+	dst := make([]byte, 0, length)
+	pos := n
+	for pos < len(src) {
+		tag := src[pos]
+		pos++
+		var size, offset int
+		switch tag & 3 {
+		case 0:
+			{
+				size = int(tag>>2) + 1
+				if extra := size - 60; extra > 0 {
+					// 长度占之后的1-4个字节
+					if pos+extra > len(src) {
+						return nil, &ErrorInvalidParquet{}
+					}
+					size = 0
+					for i := 0; i < extra; i++ {
+						size |= int(src[pos+i]) << (8 * i)
+					}
+					size += 1
+					pos += extra
+				}
+				if size <= 0 || pos+size > len(src) {
+					return nil, &ErrorInvalidParquet{}
+				}
+				dst = append(dst, src[pos:pos+size]...)
+				pos += size
+				continue
+			}
+		case 1:
+			{
+				if pos >= len(src) {
+					return nil, &ErrorInvalidParquet{}
+				}
+				size = 4 + int(tag>>2)&7
+				offset = int(tag&0xe0)<<3 | int(src[pos])
+				pos++
+			}
+		case 2:
+			{
+				if pos+2 > len(src) {
+					return nil, &ErrorInvalidParquet{}
+				}
+				size = int(tag>>2) + 1
+				offset = int(binary.LittleEndian.Uint16(src[pos:]))
+				pos += 2
+			}
+		case 3:
+			{
+				if pos+4 > len(src) {
+					return nil, &ErrorInvalidParquet{}
+				}
+				size = int(tag>>2) + 1
+				offset = int(binary.LittleEndian.Uint32(src[pos:]))
+				pos += 4
+			}
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, &ErrorInvalidParquet{}
+		}
+		// 可能与正在写入的部分重叠, 逐字节复制
+		from := len(dst) - offset
+		for i := 0; i < size; i++ {
+			dst = append(dst, dst[from+i])
+		}
+	}
+	if uint64(len(dst)) != length {
+		return nil, &ErrorInvalidParquet{}
+	}
+	return dst, nil
+}
@@ -0,0 +1,293 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// thrift compact protocol 编码以及解码, 只实现Parquet元数据需要的部分
+// 字段头: [delta(4bit) | type(4bit)], delta超过15时写入 [type] + zigzag(id)
+// i32/i64: zigzag varint, binary: varint长度 + 数据
+// list头: [size(4bit) | elemType(4bit)], size >= 15时写入 [0xf0 | elemType] + varint(size)
+
+const (
+	thriftTrue   byte = 1
+	thriftFalse  byte = 2
+	thriftByte   byte = 3
+	thriftI16    byte = 4
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftDouble byte = 7
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftSet    byte = 10
+	thriftMap    byte = 11
+	thriftStruct byte = 12
+)
+
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // 每层struct中上一个字段的id
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last: []int16{0}}
+}
+
+func (w *thriftWriter) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, v)
+	w.buf.Write(tmp[:n])
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) fieldHeader(id int16, typ byte) {
+	top := len(w.last) - 1
+	delta := id - w.last[top]
+	if delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.zigzag(int64(id))
+	}
+	w.last[top] = id
+}
+
+func (w *thriftWriter) fieldI32(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) fieldI64(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) fieldString(id int16, s string) {
+	w.fieldHeader(id, thriftBinary)
+	w.writeString(s)
+}
+
+// fieldStruct 开始一个struct类型的字段, 以structEnd结束
+func (w *thriftWriter) fieldStruct(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.structBegin()
+}
+
+// fieldList 开始一个list类型的字段, 之后依次写入size个元素
+func (w *thriftWriter) fieldList(id int16, elemType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		w.buf.WriteByte(0xf0 | elemType)
+		w.varint(uint64(size))
+	}
+}
+
+// structBegin list中的struct元素没有字段头, 直接调用
+func (w *thriftWriter) structBegin() {
+	w.last = append(w.last, 0)
+}
+
+func (w *thriftWriter) structEnd() {
+	w.buf.WriteByte(0) // STOP
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *thriftWriter) writeI32(v int32) {
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) writeString(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// thriftFields 解码之后的struct, 字段id -> 值
+// 整数 -> int64, binary -> []byte, bool -> bool, double -> float64, list/set -> []any, struct -> thriftFields
+// map只跳过, 不保存
+type thriftFields map[int16]any
+
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+type ErrorInvalidThrift struct{}
+
+func (err *ErrorInvalidThrift) Error() string {
+	return "Invalid thrift compact data"
+}
+
+func (r *thriftReader) readByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, &ErrorInvalidThrift{}
+	}
+	r.pos++
+	return r.data[r.pos-1], nil
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, &ErrorInvalidThrift{}
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *thriftReader) zigzag() (int64, error) {
+	v, err := r.varint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+// readStruct 读取一个struct直到STOP
+func (r *thriftReader) readStruct() (thriftFields, error) {
+	fields := thriftFields{}
+	last := int16(0)
+	for {
+		header, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if header == 0 {
+			return fields, nil
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			v, err := r.zigzag()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		last = id
+		typ := header & 0x0f
+		if typ == thriftTrue || typ == thriftFalse {
+			fields[id] = typ == thriftTrue
+			continue
+		}
+		if fields[id], err = r.readValue(typ); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *thriftReader) readValue(typ byte) (any, error) {
+	switch typ {
+	case thriftTrue, thriftFalse, thriftByte:
+		{
+			// list中的bool占一个字节
+			b, err := r.readByte()
+			return int64(b), err
+		}
+	case thriftI16, thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftDouble:
+		{
+			if r.pos+8 > len(r.data) {
+				return nil, &ErrorInvalidThrift{}
+			}
+			r.pos += 8
+			return math.Float64frombits(binary.LittleEndian.Uint64(r.data[r.pos-8:])), nil
+		}
+	case thriftBinary:
+		{
+			n, err := r.varint()
+			if err != nil || n > uint64(len(r.data)-r.pos) {
+				return nil, &ErrorInvalidThrift{}
+			}
+			r.pos += int(n)
+			return r.data[r.pos-int(n) : r.pos], nil
+		}
+	case thriftList, thriftSet:
+		{
+			header, err := r.readByte()
+			if err != nil {
+				return nil, err
+			}
+			size := uint64(header >> 4)
+			if size == 15 {
+				if size, err = r.varint(); err != nil {
+					return nil, err
+				}
+			}
+			if size > uint64(len(r.data)-r.pos) {
+				return nil, &ErrorInvalidThrift{}
+			}
+			list := make([]any, size)
+			for i := range list {
+				if list[i], err = r.readValue(header & 0x0f); err != nil {
+					return nil, err
+				}
+			}
+			return list, nil
+		}
+	case thriftMap:
+		{
+			size, err := r.varint()
+			if err != nil || size == 0 {
+				return nil, err
+			}
+			types, err := r.readByte()
+			if err != nil {
+				return nil, err
+			}
+			for i := uint64(0); i < size; i++ {
+				if _, err := r.readValue(types >> 4); err != nil {
+					return nil, err
+				}
+				if _, err := r.readValue(types & 0x0f); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		}
+	case thriftStruct:
+		return r.readStruct()
+	}
+	return nil, &ErrorInvalidThrift{}
+}
+
+// 按字段id取值, 字段不存在或者类型不符时返回零值
+
+func (f thriftFields) integer(id int16) int64 {
+	v, _ := f[id].(int64)
+	return v
+}
+
+func (f thriftFields) has(id int16) bool {
+	_, ext := f[id]
+	return ext
+}
+
+func (f thriftFields) str(id int16) string {
+	v, _ := f[id].([]byte)
+	return string(v)
+}
+
+func (f thriftFields) boolean(id int16, def bool) bool {
+	if v, ok := f[id].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (f thriftFields) list(id int16) []any {
+	v, _ := f[id].([]any)
+	return v
+}
+
+func (f thriftFields) fields(id int16) thriftFields {
+	v, _ := f[id].(thriftFields)
+	return v
+}
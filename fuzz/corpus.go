@@ -0,0 +1,102 @@
+package fuzz
+
+import (
+	"myDB/dataManager"
+	"myDB/tableManager"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// 语料生成
+// 每个入口的初始语料为合法的输入, fuzz引擎在此基础上变异
+// WriteCorpus 按go-fuzz的目录结构写出: <dir>/<入口名>/<序号>
+
+const (
+	TargetParseSQL       string = "FuzzParseSQL"
+	TargetDecodeRecord   string = "FuzzDecodeRecord"
+	TargetReplayLogBytes string = "FuzzReplayLogBytes"
+)
+
+var Targets = []string{TargetParseSQL, TargetDecodeRecord, TargetReplayLogBytes}
+
+var sqlCorpus = []string{
+	"begin",
+	"commit",
+	"abort",
+	"show databases",
+	"create database shop",
+	"use shop",
+	"create item { name string , price int64 , tag json }",
+	"create item { name string , price int32 } engine heap",
+	"insert item values apple 3",
+	"insert item values apple 3 returning ID name",
+	"select * from item",
+	"select name price from item where price > 2",
+	"select tag->color from item where tag->size = 3",
+	"select name sum(price) over (partition by name order by price) from item",
+	"update item set price = 5 where name = apple",
+	"delete item where price <= 1 returning name",
+	"with recursive r as ( select name from item ) select name from r",
+	"copy item to /tmp/item.parquet rowgroup 64",
+	"copy ( select name from item ) to /tmp/item.parquet",
+	"export item to /tmp/item",
+	"attach item from /tmp/item",
+}
+
+// Corpus 入口target的初始语料
+func Corpus(target string) [][]byte {
+	var corpus [][]byte
+	switch target {
+	case TargetParseSQL:
+		for _, sql := range sqlCorpus {
+			corpus = append(corpus, []byte(sql))
+		}
+	case TargetDecodeRecord:
+		schemas := [][]tableManager.FieldType{
+			{},
+			{tableManager.INT64, tableManager.STRING},
+			{tableManager.INT64, tableManager.INT32, tableManager.JSON},
+			{tableManager.INT32, tableManager.STRING, tableManager.STRING, tableManager.INT64},
+		}
+		values := [][]any{
+			{},
+			{int64(1), "apple"},
+			{int64(2), int32(-7), `{"color":"red"}`},
+			{int32(3), "", "pear", int64(1 << 40)},
+		}
+		for i, fTypes := range schemas {
+			raw, err := tableManager.EncodeRecord(fTypes, int64(i), int64(i+1), values[i])
+			if err != nil {
+				panic(err)
+			}
+			corpus = append(corpus, wrapRecordInput(fTypes, raw))
+		}
+	case TargetReplayLogBytes:
+		corpus = append(corpus, dataManager.EncodeLogBytes(nil))
+		committed := &dataManager.RedoRecord{Xid: 2, PageKey: 1, Offset: 8, OldRaw: []byte{0, 0}, NewRaw: []byte{1, 2}}
+		active := &dataManager.RedoRecord{Xid: 3, PageKey: 1<<32 | 2, Offset: 100, OldRaw: []byte("old"), NewRaw: []byte("new")}
+		corpus = append(corpus, dataManager.EncodeLogBytes([]*dataManager.RedoRecord{committed}))
+		corpus = append(corpus, dataManager.EncodeLogBytes([]*dataManager.RedoRecord{committed, active, committed}))
+		// 最后一条日志未写完
+		full := dataManager.EncodeLogBytes([]*dataManager.RedoRecord{committed, active})
+		corpus = append(corpus, append(full, 0, 0, 0, 9, 1))
+	}
+	return corpus
+}
+
+// WriteCorpus 写出所有入口的初始语料
+func WriteCorpus(dir string) error {
+	for _, target := range Targets {
+		path := filepath.Join(dir, target)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return err
+		}
+		for i, input := range Corpus(target) {
+			if err := os.WriteFile(filepath.Join(path, strconv.Itoa(i)), input, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
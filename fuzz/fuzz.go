@@ -0,0 +1,89 @@
+package fuzz
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/executor"
+	"myDB/tableManager"
+)
+
+// go-fuzz / oss-fuzz 入口
+// go-fuzz-build -func FuzzParseSQL myDB/fuzz
+// 返回值: 1 输入合法(优先变异), 0 输入不合法, 与go-fuzz约定相同
+// 被测函数对任何输入都不应该panic, 解析成功时检查编码/解析的往返结果
+
+func FuzzParseSQL(data []byte) int {
+	if _, _, err := executor.ParseSQL(string(data)); err != nil {
+		return 0
+	}
+	return 1
+}
+
+// FuzzDecodeRecord
+// 输入以表结构开头: [FieldNumber]1[FieldType]1..., 之后为记录数据
+func FuzzDecodeRecord(data []byte) int {
+	fTypes, raw, ok := RecordSchema(data)
+	if !ok {
+		return 0
+	}
+	row, err := tableManager.DecodeRecord(fTypes, raw)
+	if err != nil {
+		return 0
+	}
+	encoded, err := tableManager.EncodeRecord(fTypes, row.GetPrevUid(), row.GetNextUid(), row.GetValues())
+	if err != nil {
+		panic(err)
+	}
+	// DecodeRecord 忽略记录之后多余的数据, EncodeRecord的RowType总是RECORD
+	if !bytes.Equal(encoded[tableManager.SzRowType:], raw[tableManager.SzRowType:len(encoded)]) {
+		panic("record changes after decoding and encoding")
+	}
+	return 1
+}
+
+// FuzzReplayLogBytes xid为偶数的事物视为已经提交
+func FuzzReplayLogBytes(data []byte) int {
+	pages, err := dataManager.ReplayLogBytes(data, dataManager.DefaultPageSize, func(xid int64) bool { return xid%2 == 0 })
+	if err != nil {
+		return 0
+	}
+	for _, page := range pages {
+		if int64(len(page)) != dataManager.DefaultPageSize {
+			panic("page size changes after replaying redo log")
+		}
+	}
+	return 1
+}
+
+var recordFieldTypes = [4]tableManager.FieldType{
+	tableManager.INT32, tableManager.INT64, tableManager.STRING, tableManager.JSON,
+}
+
+// RecordSchema 解析FuzzDecodeRecord输入开头的表结构(最多4个字段), 返回表结构以及剩余的记录数据
+func RecordSchema(data []byte) ([]tableManager.FieldType, []byte, bool) {
+	if len(data) == 0 {
+		return nil, nil, false
+	}
+	n := int(data[0]) % 5
+	if len(data) < 1+n {
+		return nil, nil, false
+	}
+	fTypes := make([]tableManager.FieldType, n)
+	for i := 0; i < n; i++ {
+		fTypes[i] = recordFieldTypes[data[1+i]%4]
+	}
+	return fTypes, data[1+n:], true
+}
+
+// wrapRecordInput RecordSchema的逆操作
+func wrapRecordInput(fTypes []tableManager.FieldType, raw []byte) []byte {
+	input := []byte{byte(len(fTypes))}
+	for _, fType := range fTypes {
+		for i, t := range recordFieldTypes {
+			if t == fType {
+				input = append(input, byte(i))
+			}
+		}
+	}
+	return append(input, raw...)
+}
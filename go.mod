@@ -2,4 +2,4 @@ module myDB
 
 go 1.19
 
-require github.com/orcaman/concurrent-map/v2 v2.0.1 // indirect
+require github.com/orcaman/concurrent-map/v2 v2.0.1
@@ -0,0 +1,197 @@
+package kv
+
+import (
+	"bytes"
+	"myDB/storageEngine"
+	"myDB/tableManager"
+	"myDB/versionManager"
+	"sort"
+)
+
+// 键值接口
+// 不使用SQL的嵌入式有序键值存储, 数据保存在存储引擎的内部表(KvTable)中, 每个键一行
+// 所有操作在事物中执行(可重复读), DB的Get/Put/Delete/Scan各自在一个自动提交的事物中执行
+// 限制: 键没有索引(存储引擎的B+树索引尚未实现, 主键点查只支持int64的ID), 因此
+// 1. Get和Scan都是全表扫描, 代价与键的数量成正比
+// 2. Scan读出范围下界之后的所有行, 在内存中按键的字节序排序之后截取上界
+// 3. Put覆盖已有的值(删除后插入), 同样需要扫描
+// 适用于键数量较少的场景(配置, 元数据); 索引实现之后Get改为点查, Scan改为按索引顺序扫描
+// 使用结束之后调用Close, 同一个path同时只能由一个DB打开
+
+const (
+	KvTable       string = "__kv"
+	DefaultMemory int64  = 1 << 22
+	keyCol        string = "key"
+	valueCol      string = "value"
+)
+
+type ErrorTxnFinished struct{}
+
+func (err *ErrorTxnFinished) Error() string {
+	return "The transaction has been committed or aborted"
+}
+
+type Pair struct {
+	Key   []byte
+	Value []byte
+}
+
+type DB struct {
+	se storageEngine.StorageEngine
+}
+
+// Open 打开(或创建)path处的数据库
+func Open(path string) (*DB, error) {
+	db := &DB{se: storageEngine.NewStorageEngine(path, DefaultMemory, 0, versionManager.ReadRepeatable)}
+	xid := db.se.Begin()
+	if _, err := db.se.Describe(xid, KvTable); err == nil {
+		db.se.Commit(xid)
+		return db, nil
+	} else if _, ok := err.(*tableManager.ErrorTableNotExist); !ok {
+		db.se.Abort(xid)
+		return nil, err
+	}
+	create := &tableManager.Create{TbName: KvTable, Fields: []*tableManager.FieldCreate{
+		{FName: keyCol, FType: "string"}, {FName: valueCol, FType: "string"},
+	}}
+	if err := db.se.Create(xid, create); err != nil {
+		db.se.Abort(xid)
+		return nil, err
+	}
+	db.se.Commit(xid)
+	return db, nil
+}
+
+// Close 关闭数据库, 调用方保证没有未结束的事物
+func (db *DB) Close() {
+	db.se.Close()
+}
+
+// Txn 键值事物, 遇到error之后调用方必须Abort
+type Txn struct {
+	db       *DB
+	xid      int64
+	finished bool
+}
+
+func (db *DB) Begin() *Txn {
+	return &Txn{db: db, xid: db.se.Begin()}
+}
+
+// Update 在一个事物中执行fn, fn返回error时回滚, 否则提交
+func (db *DB) Update(fn func(tx *Txn) error) error {
+	tx := db.Begin()
+	if err := fn(tx); err != nil {
+		tx.Abort()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *DB) Get(key []byte) (value []byte, ok bool, err error) {
+	err = db.Update(func(tx *Txn) error {
+		value, ok, err = tx.Get(key)
+		return err
+	})
+	return
+}
+
+func (db *DB) Put(key, value []byte) error {
+	return db.Update(func(tx *Txn) error { return tx.Put(key, value) })
+}
+
+func (db *DB) Delete(key []byte) error {
+	return db.Update(func(tx *Txn) error { return tx.Delete(key) })
+}
+
+func (db *DB) Scan(start, end []byte) (pairs []Pair, err error) {
+	err = db.Update(func(tx *Txn) error {
+		pairs, err = tx.Scan(start, end)
+		return err
+	})
+	return
+}
+
+func (tx *Txn) Commit() error {
+	if tx.finished {
+		return &ErrorTxnFinished{}
+	}
+	tx.finished = true
+	tx.db.se.Commit(tx.xid)
+	return nil
+}
+
+func (tx *Txn) Abort() {
+	if !tx.finished {
+		tx.finished = true
+		tx.db.se.Abort(tx.xid)
+	}
+}
+
+// Get 快照读, 键不存在时ok为false
+func (tx *Txn) Get(key []byte) ([]byte, bool, error) {
+	pairs, err := tx.read(&tableManager.Where{Compare: &tableManager.Compare{FieldName: keyCol, CompareTo: "=", Value: string(key)}})
+	if err != nil || len(pairs) == 0 {
+		return nil, false, err
+	}
+	return pairs[0].Value, true, nil
+}
+
+func (tx *Txn) Put(key, value []byte) error {
+	if err := tx.Delete(key); err != nil {
+		return err
+	}
+	_, err := tx.db.se.Insert(tx.xid, &tableManager.Insert{TbName: KvTable, Values: []string{string(key), string(value)}})
+	return err
+}
+
+func (tx *Txn) Delete(key []byte) error {
+	if tx.finished {
+		return &ErrorTxnFinished{}
+	}
+	_, err := tx.db.se.Delete(tx.xid, &tableManager.Delete{
+		TName: KvTable,
+		Where: &tableManager.Where{Compare: &tableManager.Compare{FieldName: keyCol, CompareTo: "=", Value: string(key)}},
+	})
+	return err
+}
+
+// Scan 返回[start, end)中的所有键值对, 按键排序, start(end)为nil时不限制下界(上界)
+func (tx *Txn) Scan(start, end []byte) ([]Pair, error) {
+	var where *tableManager.Where
+	if start != nil {
+		where = &tableManager.Where{Compare: &tableManager.Compare{FieldName: keyCol, CompareTo: ">=", Value: string(start)}}
+	}
+	pairs, err := tx.read(where)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].Key, pairs[j].Key) < 0 })
+	if end != nil {
+		n := sort.Search(len(pairs), func(i int) bool { return bytes.Compare(pairs[i].Key, end) >= 0 })
+		pairs = pairs[:n]
+	}
+	return pairs, nil
+}
+
+func (tx *Txn) read(where *tableManager.Where) ([]Pair, error) {
+	if tx.finished {
+		return nil, &ErrorTxnFinished{}
+	}
+	res, err := tx.db.se.Select(tx.xid, &tableManager.Select{TbName: KvTable, FNames: []string{keyCol, valueCol}, Where: where})
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]Pair, 0)
+	for _, obj := range res {
+		if obj.RowId == 0 {
+			continue
+		}
+		if obj.ColId == 0 {
+			pairs = append(pairs, Pair{Key: []byte(obj.Payload)})
+		} else {
+			pairs[len(pairs)-1].Value = []byte(obj.Payload)
+		}
+	}
+	return pairs, nil
+}
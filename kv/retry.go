@@ -0,0 +1,17 @@
+package kv
+
+import (
+	"context"
+	"myDB/dbError"
+)
+
+// 自动重试的事物
+// RunInTransaction在一个新的事物中执行fn并提交, fn返回error时回滚
+// fn或者提交返回可以重试的错误时, 回滚并在退避之后用新的事物重新执行, 重试规则见dbError.Retry
+// fn可能执行多次, 不能有事物之外的副作用
+
+const MaxRetries = dbError.MaxRetries
+
+func (db *DB) RunInTransaction(ctx context.Context, fn func(tx *Txn) error) error {
+	return dbError.Retry(ctx, func() error { return db.Update(fn) })
+}
@@ -1,15 +1,43 @@
 package main
 
 import (
+	"encoding/hex"
+	"fmt"
 	"myDB/server/network"
 	"myDB/server/utils"
+	"myDB/tableManager"
+	"os"
 )
 
+// MasterKeyEnv 列级加密的主密钥(64位十六进制), 只从环境变量读取, 不写入配置文件
+const MasterKeyEnv = "MYDB_MASTER_KEY"
+
 func main() {
+	opts := make([]tableManager.Option, 0)
+	if key := os.Getenv(MasterKeyEnv); key != "" {
+		// 主密钥不合法时拒绝启动, 长度在打开数据库时校验
+		raw, err := hex.DecodeString(key)
+		if err != nil {
+			panic(fmt.Sprintf("[Server Config ERROR] Invalid %s: %s", MasterKeyEnv, err))
+		}
+		opts = append(opts, tableManager.WithMasterKey(raw))
+	}
+	// Health check, 在崩溃恢复之前开始监听
+	var health *network.HealthServer
+	if utils.GlobalObj.HealthPort != 0 {
+		health = network.NewHealthServer(network.DefaultHealthTimeout)
+		go func() {
+			addr := fmt.Sprintf("%s:%d", utils.GlobalObj.Host, utils.GlobalObj.HealthPort)
+			fmt.Printf("[Server] Health check server stopped:%s\n", health.Serve(addr))
+		}()
+	}
 	// Server
 	s := network.NewServer("tcp4")
 	// Database
-	db := network.NewDbRouter(utils.GlobalObj.Path, utils.GlobalObj.BufferPoolMemory, utils.GlobalObj.Iso)
+	db := network.NewDbRouter(utils.GlobalObj.Path, utils.GlobalObj.BufferPoolMemory, utils.GlobalObj.MaxDatabaseSize, utils.GlobalObj.Iso, opts...)
+	if health != nil {
+		health.SetReady(db.(network.HealthChecker))
+	}
 	s.AddRouter(network.DbRouterMsgId, db)
 	utils.GlobalObj.TcpServer = s
 	s.Serve()
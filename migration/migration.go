@@ -0,0 +1,255 @@
+package migration
+
+import (
+	"log"
+	"myDB/executor"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 在线Schema迁移
+// 按版本号顺序执行DDL/DML脚本，每个版本在一个事物中执行
+// 已执行的版本记录在系统表sys_migrations中 [version int64, name string]
+// 支持dry-run(只进行语法检查，不执行)以及回滚脚本(Down)
+// 注意：v1.0中CREATE TABLE不受事物回滚的保护，脚本失败时已创建的表会保留
+
+const (
+	SystemTable string = "sys_migrations"
+	NoTrans     int64  = -1
+)
+
+// Migration 一个版本的迁移脚本
+// Up/Down 中每个元素为一条语句, 语句内部以空格分割参数
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+type Runner interface {
+	Applied() ([]int64, error)                                            // 已执行的版本(升序)
+	Apply(ms []*Migration, dryRun bool) ([]int64, error)                  // 执行所有未执行的版本，返回本次执行(dry-run时为将要执行)的版本
+	Rollback(ms []*Migration, target int64, dryRun bool) ([]int64, error) // 回滚所有大于target的已执行版本
+}
+
+type RunnerImpl struct {
+	db     executor.Executor
+	parser executor.Parser // dry-run 语法检查
+}
+
+// error
+
+type ErrorDuplicateVersion struct{}
+type ErrorMissingDownScript struct{}
+type ErrorInvalidMigrationTable struct{}
+
+func (err *ErrorDuplicateVersion) Error() string {
+	return "Migration versions must be unique and positive"
+}
+
+func (err *ErrorMissingDownScript) Error() string {
+	return "The applied migration has no rollback script"
+}
+
+func (err *ErrorInvalidMigrationTable) Error() string {
+	return "Invalid migration system table"
+}
+
+func NewRunner(db executor.Executor) Runner {
+	return &RunnerImpl{
+		db:     db,
+		parser: executor.NewTrieParser(),
+	}
+}
+
+// Applied
+// 读取系统表，返回已执行的版本
+func (r *RunnerImpl) Applied() ([]int64, error) {
+	xid, err := r.begin()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := r.applied(xid)
+	if err != nil {
+		r.abort(xid)
+		return nil, err
+	}
+	r.commit(xid)
+	return versions, nil
+}
+
+// Apply
+// 按版本号升序执行所有尚未执行的迁移
+// 每个版本一个事物，任意语句失败则回滚该版本并返回，之前的版本保持已提交
+func (r *RunnerImpl) Apply(ms []*Migration, dryRun bool) ([]int64, error) {
+	ms, err := sortMigrations(ms)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := r.Applied()
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int64]struct{}, len(applied))
+	for _, v := range applied {
+		done[v] = struct{}{}
+	}
+	ret := make([]int64, 0)
+	for _, m := range ms {
+		if _, ext := done[m.Version]; ext {
+			continue
+		}
+		if dryRun {
+			if err := r.check(m.Up); err != nil {
+				return ret, err
+			}
+		} else {
+			record := []string{"INSERT", SystemTable, "VALUES", strconv.FormatInt(m.Version, 10), m.Name}
+			if err := r.runInTransaction(m.Up, record); err != nil {
+				return ret, err
+			}
+			log.Printf("[Migration] Apply version %d %s\n", m.Version, m.Name)
+		}
+		ret = append(ret, m.Version)
+	}
+	return ret, nil
+}
+
+// Rollback
+// 按版本号降序执行所有 > target 的已执行版本的Down脚本，并删除其版本记录
+func (r *RunnerImpl) Rollback(ms []*Migration, target int64, dryRun bool) ([]int64, error) {
+	ms, err := sortMigrations(ms)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := r.Applied()
+	if err != nil {
+		return nil, err
+	}
+	scripts := make(map[int64]*Migration, len(ms))
+	for _, m := range ms {
+		scripts[m.Version] = m
+	}
+	ret := make([]int64, 0)
+	for i := len(applied) - 1; i >= 0 && applied[i] > target; i-- {
+		m, ext := scripts[applied[i]]
+		if !ext || len(m.Down) == 0 {
+			return ret, &ErrorMissingDownScript{}
+		}
+		if dryRun {
+			if err := r.check(m.Down); err != nil {
+				return ret, err
+			}
+		} else {
+			record := []string{"DELETE", SystemTable, "WHERE", "version", "=", strconv.FormatInt(m.Version, 10)}
+			if err := r.runInTransaction(m.Down, record); err != nil {
+				return ret, err
+			}
+			log.Printf("[Migration] Roll back version %d %s\n", m.Version, m.Name)
+		}
+		ret = append(ret, m.Version)
+	}
+	return ret, nil
+}
+
+// runInTransaction
+// 在同一个事物中执行脚本以及系统表的修改
+func (r *RunnerImpl) runInTransaction(statements []string, record []string) error {
+	xid, err := r.begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range statements {
+		if _, _, err := r.db.Execute(xid, strings.Fields(stmt)); err != nil {
+			r.abort(xid)
+			return err
+		}
+	}
+	if _, _, err := r.db.Execute(xid, record); err != nil {
+		r.abort(xid)
+		return err
+	}
+	r.commit(xid)
+	return nil
+}
+
+// check dry-run 只进行语法检查
+func (r *RunnerImpl) check(statements []string) error {
+	for _, stmt := range statements {
+		if cmd, _, err := r.parser.ParseRequest(strings.Fields(stmt)); err != nil {
+			return err
+		} else if cmd == executor.INVALID {
+			return &executor.ErrorInvalidEntity{}
+		}
+	}
+	return nil
+}
+
+// applied
+// 系统表不存在时创建系统表
+func (r *RunnerImpl) applied(xid int64) ([]int64, error) {
+	_, tables, err := r.db.Execute(xid, []string{"SHOW"})
+	if err != nil {
+		return nil, err
+	}
+	exist := false
+	for _, t := range tables {
+		if t.RowId > 0 && t.Payload == SystemTable {
+			exist = true
+			break
+		}
+	}
+	if !exist {
+		create := []string{"CREATE", SystemTable, "{", "version", "int64", ",", "name", "string", "}"}
+		if _, _, err := r.db.Execute(xid, create); err != nil {
+			return nil, err
+		}
+		return []int64{}, nil
+	}
+	_, rows, err := r.db.Execute(xid, []string{"SELECT", "version", "FROM", SystemTable})
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, 0)
+	for _, row := range rows {
+		// 跳过表头
+		if row.RowId == 0 {
+			continue
+		}
+		v, err := strconv.ParseInt(row.Payload, 10, 64)
+		if err != nil {
+			return nil, &ErrorInvalidMigrationTable{}
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, nil
+}
+
+func (r *RunnerImpl) begin() (int64, error) {
+	xid, _, err := r.db.Execute(NoTrans, []string{"BEGIN"})
+	return xid, err
+}
+
+func (r *RunnerImpl) commit(xid int64) {
+	_, _, _ = r.db.Execute(xid, []string{"COMMIT"})
+}
+
+func (r *RunnerImpl) abort(xid int64) {
+	_, _, _ = r.db.Execute(xid, []string{"ABORT"})
+}
+
+// sortMigrations 按版本号升序排序并检查版本号是否重复
+func sortMigrations(ms []*Migration) ([]*Migration, error) {
+	sorted := make([]*Migration, len(ms))
+	copy(sorted, ms)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || (i > 0 && sorted[i-1].Version == m.Version) {
+			return nil, &ErrorDuplicateVersion{}
+		}
+	}
+	return sorted, nil
+}
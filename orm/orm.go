@@ -0,0 +1,402 @@
+package orm
+
+import (
+	"context"
+	"encoding/json"
+	"myDB/executor"
+	"myDB/tableManager"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 结构体映射
+// 在嵌入式接口(executor.Executor)之上按字段标签把结构体映射为表中的一行, 省去手写语句参数以及结果的转换
+// 标签: `db:"<字段名>[,json]"`, 没有标签时字段名与Go字段名相同, `db:"-"`以及未导出的字段忽略, 嵌入结构体的字段展开
+// 类型: int8, int16, int32, uint8, uint16, bool(0/1)对应int32; int, int64, uint32对应int64
+// string, []byte, float32, float64, time.Time(RFC3339Nano)对应string; 带json选项的任意类型以JSON编码, 对应json
+// 映射到主键ID的int64字段为行号: Insert不写入而是回填生成的主键, Update/Delete按它定位行
+// xid为NoTrans时每次调用在自己的事务中执行(Insert的所有行, Update的每个字段各一条语句), 出错时回滚
+// 多个调用组成一个事务时用RunInTransaction, 把回调收到的xid传给每个调用, 死锁等可以重试的错误自动重新执行整个事务
+// 值作为单独的参数传给Executor, 可以包含空白; 与直接执行语句相同, 值不能是语句中的关键字(where等)
+
+const (
+	Tag     string = "db"
+	NoTrans int64  = -1
+)
+
+type ErrorInvalidStruct struct{}
+type ErrorUnsupportedField struct{}
+type ErrorNoPrimaryKey struct{}
+type ErrorRowNotFound struct{}
+
+func (err *ErrorInvalidStruct) Error() string {
+	return "Only struct types can be mapped to tables"
+}
+
+func (err *ErrorUnsupportedField) Error() string {
+	return "Unsupported struct field type"
+}
+
+func (err *ErrorNoPrimaryKey) Error() string {
+	return "The struct has no int64 field mapped to the primary key"
+}
+
+func (err *ErrorRowNotFound) Error() string {
+	return "The row doesn't exist"
+}
+
+// column 结构体字段与表字段的映射
+type column struct {
+	name  string
+	index []int  // reflect.Value.FieldByIndex
+	fType string // int32, int64, string, json
+	json  bool
+}
+
+// Table 结构体类型T对应的表
+type Table[T any] struct {
+	db      executor.Executor
+	name    string
+	columns []*column // 不包括主键
+	key     *column   // 主键, 没有时为nil
+}
+
+// NewTable 解析T的字段, T必须是结构体
+func NewTable[T any](db executor.Executor, name string) (*Table[T], error) {
+	columns, err := columnsOf(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	t := &Table[T]{db: db, name: name}
+	for _, c := range columns {
+		if c.name == tableManager.PrimaryKeyCol {
+			t.key = c
+		} else {
+			t.columns = append(t.columns, c)
+		}
+	}
+	return t, nil
+}
+
+// columnsOf 按字段顺序返回映射的字段
+func columnsOf(typ reflect.Type) ([]*column, error) {
+	if typ.Kind() != reflect.Struct {
+		return nil, &ErrorInvalidStruct{}
+	}
+	columns := make([]*column, 0)
+	for _, f := range reflect.VisibleFields(typ) {
+		tag := f.Tag.Get(Tag)
+		if !f.IsExported() || tag == "-" || (f.Anonymous && f.Type.Kind() == reflect.Struct && tag == "") {
+			continue
+		}
+		name, option, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		c := &column{name: name, index: f.Index, json: option == "json"}
+		if c.fType = fieldType(f.Type, c.json); c.fType == "" {
+			return nil, &ErrorUnsupportedField{}
+		}
+		if name == tableManager.PrimaryKeyCol && f.Type.Kind() != reflect.Int64 {
+			return nil, &ErrorUnsupportedField{}
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// fieldType Go类型对应的字段类型, 不支持时返回""
+func fieldType(typ reflect.Type, asJson bool) string {
+	if asJson {
+		return "json"
+	}
+	if typ == timeType {
+		return "string"
+	}
+	switch typ.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Bool:
+		return "int32"
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return "int64"
+	case reflect.String, reflect.Float32, reflect.Float64:
+		return "string"
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+	}
+	return ""
+}
+
+// encode 字段值转换为语句中的参数
+func (c *column) encode(v reflect.Value) (string, error) {
+	if c.json {
+		data, err := json.Marshal(v.Interface())
+		return string(data), err
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		return string(v.Bytes()), nil
+	}
+	return "", &ErrorUnsupportedField{}
+}
+
+// decode 结果中的值写入字段
+func (c *column) decode(payload string, v reflect.Value) error {
+	if c.json {
+		return json.Unmarshal([]byte(payload), v.Addr().Interface())
+	}
+	if v.Type() == timeType {
+		if payload == "" {
+			v.Set(reflect.Zero(timeType))
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, payload)
+		if err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+		return err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(payload, 10, v.Type().Bits())
+		v.SetInt(n)
+		return err
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		n, err := strconv.ParseUint(payload, 10, v.Type().Bits())
+		v.SetUint(n)
+		return err
+	case reflect.Bool:
+		n, err := strconv.ParseInt(payload, 10, 32)
+		v.SetBool(n != 0)
+		return err
+	case reflect.Float32, reflect.Float64:
+		if payload == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(payload, v.Type().Bits())
+		v.SetFloat(f)
+		return err
+	case reflect.String:
+		v.SetString(payload)
+		return nil
+	case reflect.Slice:
+		v.SetBytes([]byte(payload))
+		return nil
+	}
+	return &ErrorUnsupportedField{}
+}
+
+// Scan
+// 将结果(第0行为字段名)中的每一行转换为T, 按字段名匹配, 结果中多余的字段忽略, 没有出现的字段为零值
+func Scan[T any](res []*tableManager.ResponseObject) ([]T, error) {
+	columns, err := columnsOf(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*column, len(columns))
+	for _, c := range columns {
+		byName[c.name] = c
+	}
+	header := map[int]*column{}
+	rows := make([]T, 0)
+	for _, obj := range res {
+		if obj.RowId == 0 {
+			if c, ext := byName[obj.Payload]; ext {
+				header[obj.ColId] = c
+			}
+			continue
+		}
+		for len(rows) < obj.RowId {
+			rows = append(rows, *new(T))
+		}
+		if c, ext := header[obj.ColId]; ext {
+			v := reflect.ValueOf(&rows[obj.RowId-1]).Elem().FieldByIndex(c.index)
+			if err := c.decode(obj.Payload, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rows, nil
+}
+
+// Where 生成where条件的参数, value按字段值相同的规则转换, 不支持的类型以JSON编码
+func Where(field, op string, value any) []string {
+	if value == nil {
+		return []string{"where", field, op, "null"}
+	}
+	c := &column{json: fieldType(reflect.TypeOf(value), false) == ""}
+	encoded, err := c.encode(reflect.ValueOf(value))
+	if err != nil {
+		encoded = ""
+	}
+	return []string{"where", field, op, encoded}
+}
+
+// Create 按结构体的字段建表, 主键由数据库生成, 不需要映射
+func (t *Table[T]) Create(xid int64) error {
+	return t.inTrans(xid, t.create)
+}
+
+func (t *Table[T]) create(xid int64) error {
+	args := []string{"create", t.name, "{"}
+	for i, c := range t.columns {
+		if i > 0 {
+			args = append(args, ",")
+		}
+		args = append(args, c.name, c.fType)
+	}
+	args = append(args, "}")
+	_, _, err := t.db.Execute(xid, args)
+	return err
+}
+
+// Insert 依次插入rows, 映射了主键时回填生成的主键
+func (t *Table[T]) Insert(xid int64, rows ...*T) error {
+	return t.inTrans(xid, func(xid int64) error {
+		return t.insert(xid, rows)
+	})
+}
+
+func (t *Table[T]) insert(xid int64, rows []*T) error {
+	for _, row := range rows {
+		v := reflect.ValueOf(row).Elem()
+		args := []string{"insert", t.name, "values"}
+		for _, c := range t.columns {
+			value, err := c.encode(v.FieldByIndex(c.index))
+			if err != nil {
+				return err
+			}
+			args = append(args, value)
+		}
+		// returning在最后, 值中的returning不会被当作关键字
+		args = append(args, "returning", tableManager.PrimaryKeyCol)
+		_, res, err := t.db.Execute(xid, args)
+		if err != nil {
+			return err
+		}
+		if t.key != nil && len(res) == 2 {
+			if err := t.key.decode(res[1].Payload, v.FieldByIndex(t.key.index)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Select 返回满足where(为空时为所有行, 可以由Where生成)的行
+func (t *Table[T]) Select(xid int64, where ...string) ([]T, error) {
+	var rows []T
+	err := t.inTrans(xid, func(xid int64) (err error) {
+		rows, err = t.query(xid, where)
+		return
+	})
+	return rows, err
+}
+
+func (t *Table[T]) query(xid int64, where []string) ([]T, error) {
+	args := []string{"select"}
+	if t.key != nil {
+		args = append(args, t.key.name)
+	}
+	for _, c := range t.columns {
+		args = append(args, c.name)
+	}
+	args = append(args, "from", t.name)
+	args = append(args, where...)
+	_, res, err := t.db.Execute(xid, args)
+	if err != nil {
+		return nil, err
+	}
+	return Scan[T](res)
+}
+
+// Update 按主键修改row对应的行的所有字段, 行不存在时返回ErrorRowNotFound
+func (t *Table[T]) Update(xid int64, row *T) error {
+	if t.key == nil {
+		return &ErrorNoPrimaryKey{}
+	}
+	v := reflect.ValueOf(row).Elem()
+	id := strconv.FormatInt(v.FieldByIndex(t.key.index).Int(), 10)
+	return t.inTrans(xid, func(xid int64) error {
+		return t.update(xid, v, id)
+	})
+}
+
+func (t *Table[T]) update(xid int64, v reflect.Value, id string) error {
+	for _, c := range t.columns {
+		value, err := c.encode(v.FieldByIndex(c.index))
+		if err != nil {
+			return err
+		}
+		args := []string{"update", t.name, "set", c.name, "=", value, "where", tableManager.PrimaryKeyCol, "=", id, "returning", tableManager.PrimaryKeyCol}
+		_, res, err := t.db.Execute(xid, args)
+		if err != nil {
+			return err
+		}
+		if len(res) < 2 {
+			return &ErrorRowNotFound{}
+		}
+	}
+	return nil
+}
+
+// inTrans xid为NoTrans时在自己的事务中执行fn, 出错时回滚
+func (t *Table[T]) inTrans(xid int64, fn func(xid int64) error) error {
+	if xid != NoTrans {
+		return fn(xid)
+	}
+	xid, _, err := t.db.Execute(NoTrans, []string{"begin"})
+	if err != nil {
+		return err
+	}
+	if err = fn(xid); err != nil {
+		t.db.Execute(xid, []string{"abort"})
+		return err
+	}
+	_, _, err = t.db.Execute(xid, []string{"commit"})
+	return err
+}
+
+// RunInTransaction 同executor.RunInTransaction, fn中的调用使用传入的xid, 可能执行多次
+func RunInTransaction(ctx context.Context, db executor.Executor, fn func(xid int64) error) error {
+	return db.RunInTransaction(ctx, fn)
+}
+
+// Delete 按主键删除row对应的行, 行不存在时返回ErrorRowNotFound
+func (t *Table[T]) Delete(xid int64, row *T) error {
+	if t.key == nil {
+		return &ErrorNoPrimaryKey{}
+	}
+	id := strconv.FormatInt(reflect.ValueOf(row).Elem().FieldByIndex(t.key.index).Int(), 10)
+	return t.inTrans(xid, func(xid int64) error {
+		_, res, err := t.db.Execute(xid, []string{"delete", t.name, "where", tableManager.PrimaryKeyCol, "=", id, "returning", tableManager.PrimaryKeyCol})
+		if err == nil && len(res) < 2 {
+			err = &ErrorRowNotFound{}
+		}
+		return err
+	})
+}
@@ -0,0 +1,79 @@
+package network
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// AdmissionControl 准入控制
+// 限制同时执行的查询数量，超出的查询进入等待队列
+// 等待队列已满的查询直接返回ErrorServerBusy, 等待超时的查询返回ErrorQueueTimeout，避免突发流量时BufferPool与锁表的争用
+// 返回错误的查询不占用执行槽位以及队列位置
+// BEGIN/COMMIT/ABORT/QUIT不受限制，保证已开启的事物总能结束并释放资源
+type AdmissionControl struct {
+	slots     chan struct{} // nil表示不限制
+	waiting   atomic.Int32  // 正在等待的查询数
+	maxQueued int32
+	timeout   time.Duration // <= 0 表示一直等待
+}
+
+type ErrorServerBusy struct{}
+type ErrorQueueTimeout struct{}
+
+func (err *ErrorServerBusy) Error() string {
+	return "Server is busy, too many concurrent queries"
+}
+
+func (err *ErrorQueueTimeout) Error() string {
+	return "Server is busy, timed out waiting in the query queue"
+}
+
+func NewAdmissionControl(maxConcurrent, maxQueued int, timeout time.Duration) *AdmissionControl {
+	ac := &AdmissionControl{
+		maxQueued: int32(maxQueued),
+		timeout:   timeout,
+	}
+	if maxConcurrent > 0 {
+		ac.slots = make(chan struct{}, maxConcurrent)
+	}
+	log.Printf("[Admission Control] Max concurrent queries = %d, max queued queries = %d\n", maxConcurrent, maxQueued)
+	return ac
+}
+
+// Acquire 获取一个执行槽位，成功后必须调用Release
+func (ac *AdmissionControl) Acquire() error {
+	if ac.slots == nil {
+		return nil
+	}
+	select {
+	case ac.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	// 排队
+	if ac.waiting.Add(1) > ac.maxQueued {
+		ac.waiting.Add(-1)
+		return &ErrorServerBusy{}
+	}
+	defer ac.waiting.Add(-1)
+	if ac.timeout <= 0 {
+		ac.slots <- struct{}{}
+		return nil
+	}
+	timer := time.NewTimer(ac.timeout)
+	defer timer.Stop()
+	select {
+	case ac.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return &ErrorQueueTimeout{}
+	}
+}
+
+func (ac *AdmissionControl) Release() {
+	if ac.slots == nil {
+		return
+	}
+	<-ac.slots
+}
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// 健康检查的HTTP接口, 用于Kubernetes的liveness/readiness探针
+// GET /livez  存活: 数据库启动(崩溃恢复)期间返回200, 之后存储层的健康检查失败时返回503
+// GET /readyz 就绪: 崩溃恢复完成并且存储层的健康检查通过时返回200, 否则返回503
+// 存储层的健康检查: redo log可以刷盘, 缓冲区没有停滞(见dataManager/health.go)
+// 健康检查的HTTP服务在数据库启动之前开始监听, 数据库启动之后通过SetReady接入
+
+const DefaultHealthTimeout = time.Second
+
+type ErrorNotReady struct{}
+
+func (err *ErrorNotReady) Error() string {
+	return "Database is starting or recovering"
+}
+
+type HealthChecker interface {
+	CheckHealth(timeout time.Duration) error
+}
+
+type HealthServer struct {
+	checker atomic.Value // HealthChecker, 崩溃恢复完成之后设置
+	timeout time.Duration
+}
+
+func NewHealthServer(timeout time.Duration) *HealthServer {
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	return &HealthServer{timeout: timeout}
+}
+
+// SetReady 数据库已经完成崩溃恢复
+func (h *HealthServer) SetReady(checker HealthChecker) {
+	h.checker.Store(&checker)
+}
+
+// Live 存活检查, 数据库尚未启动时认为存活
+func (h *HealthServer) Live() error {
+	if checker, ok := h.checker.Load().(*HealthChecker); ok {
+		return (*checker).CheckHealth(h.timeout)
+	}
+	return nil
+}
+
+// Ready 就绪检查
+func (h *HealthServer) Ready() error {
+	if checker, ok := h.checker.Load().(*HealthChecker); ok {
+		return (*checker).CheckHealth(h.timeout)
+	}
+	return &ErrorNotReady{}
+}
+
+func (h *HealthServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", probe(h.Live))
+	mux.HandleFunc("/readyz", probe(h.Ready))
+	return mux
+}
+
+// Serve 阻塞直到HTTP服务退出
+func (h *HealthServer) Serve(addr string) error {
+	return http.ListenAndServe(addr, h.Handler())
+}
+
+func probe(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	}
+}
+
+// CheckHealth DbRouter作为HealthChecker
+func (dbRouter *DbRouter) CheckHealth(timeout time.Duration) error {
+	return dbRouter.db.CheckHealth(timeout)
+}
@@ -0,0 +1,63 @@
+package network
+
+import (
+	"log"
+	"myDB/server/utils"
+	"time"
+)
+
+// ResourceGroup 资源组
+// 会话通过 SET RESOURCE_GROUP <name> 加入资源组，未设置时属于默认资源组
+// maxMemory 限制该组中单个查询可以使用的内存
+// shares 调度权重，每个资源组按权重分得最大并发查询数(至少为1)，各组独立排队
+// 因此分析型查询所在的资源组即使排满，也不会占用OLTP资源组的执行槽位
+
+const DefaultResourceGroup string = "default"
+
+type ResourceGroup struct {
+	name      string
+	maxMemory int64
+	admission *AdmissionControl
+}
+
+type ErrorResourceGroupNotExist struct{}
+
+func (err *ErrorResourceGroupNotExist) Error() string {
+	return "Resource group doesn't exist"
+}
+
+func NewResourceGroups(configs []*utils.ResourceGroupConfig, maxConcurrent, maxQueued int, timeout time.Duration) map[string]*ResourceGroup {
+	// 默认资源组一定存在
+	hasDefault := false
+	for _, c := range configs {
+		if c.Name == DefaultResourceGroup {
+			hasDefault = true
+		}
+	}
+	if !hasDefault {
+		configs = append(configs, &utils.ResourceGroupConfig{Name: DefaultResourceGroup, Shares: 1})
+	}
+	totalShares := 0
+	for _, c := range configs {
+		if c.Shares <= 0 {
+			c.Shares = 1
+		}
+		totalShares += c.Shares
+	}
+	groups := make(map[string]*ResourceGroup, len(configs))
+	for _, c := range configs {
+		concurrent := 0 // 不限制
+		if maxConcurrent > 0 {
+			if concurrent = maxConcurrent * c.Shares / totalShares; concurrent < 1 {
+				concurrent = 1
+			}
+		}
+		groups[c.Name] = &ResourceGroup{
+			name:      c.Name,
+			maxMemory: c.MaxMemory,
+			admission: NewAdmissionControl(concurrent, maxQueued, timeout),
+		}
+		log.Printf("[Resource Group] Create resource group %s, shares = %d, max memory = %d\n", c.Name, c.Shares, c.MaxMemory)
+	}
+	return groups
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"myDB/executor"
 	"myDB/server/iface"
+	"myDB/server/utils"
 	"myDB/tableManager"
 	"myDB/versionManager"
 	"strconv"
@@ -16,6 +17,14 @@ const (
 	DbRouterMsgId        = 0x3f
 	TRANS         string = "trans"
 	AUTO          string = "auto"
+	DATABASE      string = "database" // 当前会话所在的逻辑数据库
+	GROUP         string = "group"    // 当前会话所在的资源组
+	FORMAT        string = "format"   // 查询结果的编码格式
+	STATS         string = "stats"    // 会话的执行统计
+	LISTENER      string = "listener" // 会话接收通知的句柄, 在第一条listen时创建
+	VARS          string = "vars"     // 会话中设置的变量
+	FormatText    string = "TEXT"
+	FormatArrow   string = "ARROW" // select的结果编码为Arrow IPC stream, 以一个bulk string返回
 )
 
 // 路由模块，实现路由接口
@@ -35,7 +44,8 @@ func (b *BaseRouter) PostHandle(request iface.IRequest) {}
 // DbRouter 自定义Router
 type DbRouter struct {
 	BaseRouter
-	db executor.Executor
+	db     executor.Executor
+	groups map[string]*ResourceGroup // 资源组, 创建后只读
 }
 
 func (dbRouter *DbRouter) PreHandle(request iface.IRequest) {
@@ -47,6 +57,7 @@ func (dbRouter *DbRouter) DoHandle(request iface.IRequest) {
 	var (
 		err      error
 		response []*tableManager.ResponseObject
+		stream   []byte // Arrow格式的结果
 	)
 	log.Printf("[Database] Prepare to handle the requeset of connection %d", request.GetConnection().GetConnId())
 	if len(args) == 0 {
@@ -56,16 +67,34 @@ func (dbRouter *DbRouter) DoHandle(request iface.IRequest) {
 			err = dbRouter.doBegin(false, request)
 		} else if dbRouter.isAbortCommand(args) {
 			err = dbRouter.doAbort(request)
+			if request.GetConnection().HasClosed() {
+				// 连接断开时的回滚, 同时退订所有频道
+				dbRouter.closeListener(request)
+			}
 		} else if dbRouter.isCommitCommand(args) {
 			err = dbRouter.doCommit(request)
 		} else if dbRouter.isQuitCommand(args) {
 			dbRouter.doQuit(request)
+		} else if dbRouter.isRoleCommand(args) {
+			request.GetConnection().SendMessage([]byte(packString(dbRouter.role())))
+			return
+		} else if dbRouter.role() != utils.RolePrimary {
+			err = &ErrorNotPrimary{}
+		} else if dbRouter.isUseCommand(args) {
+			err = dbRouter.doUse(request)
+		} else if dbRouter.isSetGroupCommand(args) {
+			err = dbRouter.doSetGroup(request)
+		} else if dbRouter.isSetFormatCommand(args) {
+			err = dbRouter.doSetFormat(request)
 		} else {
 			if xid := request.GetConnection().GetConnectionProperty(TRANS); xid == nil || (xid).(int64) == -1 {
-				err = dbRouter.doBegin(true, request)
+				err = dbRouter.doBegin(dbRouter.db.Autocommit(dbRouter.baseSession(request)), request)
+			}
+			if err == nil && dbRouter.isArrowQuery(request) {
+				stream, err = dbRouter.doArrowQuery(request)
+			} else if err == nil {
+				response, err = dbRouter.doQuery(request)
 			}
-			xid := request.GetConnection().GetConnectionProperty(TRANS).(int64)
-			_, response, err = dbRouter.db.Execute(xid, args)
 		}
 		if err == nil {
 			log.Printf("[Database] Connection %d finish a command %s, xid = %d\n",
@@ -78,16 +107,10 @@ func (dbRouter *DbRouter) DoHandle(request iface.IRequest) {
 	if err != nil {
 		// handle error
 		dbRouter.handleError(err, request)
+	} else if stream != nil {
+		request.GetConnection().SendMessage([]byte(packBulkString(string(stream))))
 	} else if response != nil && len(response) > 0 {
-		last := response[len(response)-1]
-		row, col := last.RowId+1, last.ColId+1
-		resMsg := make([]string, 0)
-		resMsg = append(resMsg, strconv.FormatInt(int64(row), 10))
-		resMsg = append(resMsg, strconv.FormatInt(int64(col), 10))
-		for _, res := range response {
-			resMsg = append(resMsg, res.Payload)
-		}
-		request.GetConnection().SendMessage([]byte(packBulkArray(resMsg)))
+		request.GetConnection().SendMessage([]byte(packResponse(response)))
 	} else {
 		// query ok
 		request.GetConnection().SendMessage([]byte(packString(OK)))
@@ -96,7 +119,7 @@ func (dbRouter *DbRouter) DoHandle(request iface.IRequest) {
 
 func (dbRouter *DbRouter) PostHandle(request iface.IRequest) {
 	// 如果设置了自动提交，则执行结束后自动提交事物
-	if auto := request.GetConnection().GetConnectionProperty(AUTO).(bool); auto {
+	if auto, ok := request.GetConnection().GetConnectionProperty(AUTO).(bool); ok && auto {
 		// 自动提交
 		if err := dbRouter.doCommit(request); err != nil {
 			dbRouter.handleError(err, request)
@@ -120,14 +143,206 @@ func (dbRouter *DbRouter) isCommitCommand(args []string) bool {
 	return len(args) == 1 && strings.ToUpper(args[0]) == "COMMIT"
 }
 
+// isRoleCommand ROLE 返回服务器的角色, 客户端据此在多个服务器中找到主库(见client/cli_core/cluster.go)
+func (dbRouter *DbRouter) isRoleCommand(args []string) bool {
+	return len(args) == 1 && strings.ToUpper(args[0]) == "ROLE"
+}
+
+func (dbRouter *DbRouter) role() string {
+	if utils.GlobalObj.Role == "" {
+		return utils.RolePrimary
+	}
+	return utils.GlobalObj.Role
+}
+
+func (dbRouter *DbRouter) isUseCommand(args []string) bool {
+	return len(args) == 2 && strings.ToUpper(args[0]) == "USE"
+}
+
+// doUse 切换当前会话的逻辑数据库
+// 事物进行中不允许切换
+func (dbRouter *DbRouter) doUse(request iface.IRequest) error {
+	if xid := request.GetConnection().GetConnectionProperty(TRANS); xid != nil && xid.(int64) != -1 {
+		return &ErrorIllegalOperation{}
+	}
+	if _, _, err := dbRouter.db.ExecuteIn(dbRouter.currentDatabase(request), -1, request.GetArgs()); err != nil {
+		return err
+	}
+	request.GetConnection().SetConnectionProperty(DATABASE, request.GetArgs()[1])
+	return nil
+}
+
+func (dbRouter *DbRouter) isSetGroupCommand(args []string) bool {
+	return len(args) == 3 && strings.ToUpper(args[0]) == "SET" && strings.ToUpper(args[1]) == "RESOURCE_GROUP"
+}
+
+// doSetGroup 将当前会话加入资源组
+func (dbRouter *DbRouter) doSetGroup(request iface.IRequest) error {
+	name := request.GetArgs()[2]
+	if _, ext := dbRouter.groups[name]; !ext {
+		return &ErrorResourceGroupNotExist{}
+	}
+	request.GetConnection().SetConnectionProperty(GROUP, name)
+	return nil
+}
+
+// doQuery 经过会话所在资源组的准入控制后执行查询
+func (dbRouter *DbRouter) doQuery(request iface.IRequest) ([]*tableManager.ResponseObject, error) {
+	group := dbRouter.currentGroup(request)
+	if err := group.admission.Acquire(); err != nil {
+		return nil, err
+	}
+	defer group.admission.Release()
+	session := &executor.Session{
+		Database:  dbRouter.currentDatabase(request),
+		MaxMemory: group.maxMemory,
+		Parallel:  utils.GlobalObj.ScanWorkers,
+		Stats:     dbRouter.sessionStats(request),
+		SlowQuery: time.Duration(utils.GlobalObj.SlowQueryTime) * time.Millisecond,
+		Listener:  dbRouter.sessionListener(request),
+		Client:    clientAddr(request),
+		Vars:      dbRouter.sessionVariables(request),
+	}
+	xid := request.GetConnection().GetConnectionProperty(TRANS).(int64)
+	if dbRouter.isExecuteManyCommand(request.GetArgs()) {
+		stmt, params, err := executor.ParseExecuteMany(request.GetArgs())
+		if err != nil {
+			return nil, err
+		}
+		_, response, err := dbRouter.db.ExecuteMany(session, xid, stmt, params)
+		return response, err
+	}
+	_, response, err := dbRouter.db.ExecuteSession(session, xid, request.GetArgs())
+	return response, err
+}
+
+// isExecuteManyCommand executemany <n> <statement>... <params>...
+func (dbRouter *DbRouter) isExecuteManyCommand(args []string) bool {
+	return len(args) > 0 && strings.ToUpper(args[0]) == "EXECUTEMANY"
+}
+
+func (dbRouter *DbRouter) isSetFormatCommand(args []string) bool {
+	return len(args) == 3 && strings.ToUpper(args[0]) == "SET" && strings.ToUpper(args[1]) == "RESULT_FORMAT"
+}
+
+// doSetFormat 设置当前会话查询结果的编码格式 TEXT | ARROW
+func (dbRouter *DbRouter) doSetFormat(request iface.IRequest) error {
+	format := strings.ToUpper(request.GetArgs()[2])
+	if format != FormatText && format != FormatArrow {
+		return &ErrorIllegalOperation{}
+	}
+	request.GetConnection().SetConnectionProperty(FORMAT, format)
+	return nil
+}
+
+// isArrowQuery 会话使用Arrow格式时, 只有select的结果以Arrow编码
+func (dbRouter *DbRouter) isArrowQuery(request iface.IRequest) bool {
+	format, ok := request.GetConnection().GetConnectionProperty(FORMAT).(string)
+	return ok && format == FormatArrow && strings.ToUpper(request.GetArgs()[0]) == "SELECT"
+}
+
+// doArrowQuery 同doQuery, 结果编码为Arrow IPC stream
+func (dbRouter *DbRouter) doArrowQuery(request iface.IRequest) ([]byte, error) {
+	group := dbRouter.currentGroup(request)
+	if err := group.admission.Acquire(); err != nil {
+		return nil, err
+	}
+	defer group.admission.Release()
+	session := &executor.Session{
+		Database:  dbRouter.currentDatabase(request),
+		MaxMemory: group.maxMemory,
+		Parallel:  utils.GlobalObj.ScanWorkers,
+		Stats:     dbRouter.sessionStats(request),
+		SlowQuery: time.Duration(utils.GlobalObj.SlowQueryTime) * time.Millisecond,
+		Client:    clientAddr(request),
+		Vars:      dbRouter.sessionVariables(request),
+	}
+	xid := request.GetConnection().GetConnectionProperty(TRANS).(int64)
+	_, table, err := dbRouter.db.ExecuteArrow(session, xid, request.GetArgs())
+	if err != nil {
+		return nil, err
+	}
+	return table.Encode(), nil
+}
+
+func (dbRouter *DbRouter) currentGroup(request iface.IRequest) *ResourceGroup {
+	if name := request.GetConnection().GetConnectionProperty(GROUP); name != nil {
+		return dbRouter.groups[name.(string)]
+	}
+	return dbRouter.groups[DefaultResourceGroup]
+}
+
+// sessionStats 连接的执行统计, 在连接的第一条查询时创建
+func (dbRouter *DbRouter) sessionStats(request iface.IRequest) *executor.SessionStats {
+	if stats, ok := request.GetConnection().GetConnectionProperty(STATS).(*executor.SessionStats); ok {
+		return stats
+	}
+	stats := &executor.SessionStats{}
+	request.GetConnection().SetConnectionProperty(STATS, stats)
+	return stats
+}
+
+// sessionVariables 连接中设置的变量, 在连接的第一条查询时创建
+func (dbRouter *DbRouter) sessionVariables(request iface.IRequest) *executor.SessionVariables {
+	if vars, ok := request.GetConnection().GetConnectionProperty(VARS).(*executor.SessionVariables); ok {
+		return vars
+	}
+	vars := executor.NewSessionVariables()
+	request.GetConnection().SetConnectionProperty(VARS, vars)
+	return vars
+}
+
+// baseSession 只包含当前数据库以及会话变量, 用于开启事物
+func (dbRouter *DbRouter) baseSession(request iface.IRequest) *executor.Session {
+	return &executor.Session{Database: dbRouter.currentDatabase(request), Vars: dbRouter.sessionVariables(request)}
+}
+
+// sessionListener 连接接收通知的句柄, 在连接的第一条listen时创建
+// 通知在提交之后由单独的协程推送给客户端, 格式与查询结果相同, 以PushHead开头与语句的回复区分
+func (dbRouter *DbRouter) sessionListener(request iface.IRequest) *executor.Listener {
+	if listener, ok := request.GetConnection().GetConnectionProperty(LISTENER).(*executor.Listener); ok {
+		return listener
+	}
+	if strings.ToUpper(request.GetArgs()[0]) != "LISTEN" {
+		return nil
+	}
+	listener := executor.NewListener(executor.DefaultListenerBuffer)
+	request.GetConnection().SetConnectionProperty(LISTENER, listener)
+	conn := request.GetConnection()
+	go func() {
+		for n := range listener.C {
+			if conn.HasClosed() {
+				continue
+			}
+			conn.SendMessage([]byte(packPush(executor.NotificationResponse(n))))
+		}
+	}()
+	return listener
+}
+
+func (dbRouter *DbRouter) closeListener(request iface.IRequest) {
+	if listener, ok := request.GetConnection().GetConnectionProperty(LISTENER).(*executor.Listener); ok {
+		dbRouter.db.CloseListener(listener)
+		request.GetConnection().RemoveConnectionProperty(LISTENER)
+	}
+}
+
+func (dbRouter *DbRouter) currentDatabase(request iface.IRequest) string {
+	if database := request.GetConnection().GetConnectionProperty(DATABASE); database != nil {
+		return database.(string)
+	}
+	return executor.DefaultDatabase
+}
+
 func (dbRouter *DbRouter) doBegin(autoCommitted bool, request iface.IRequest) error {
 	xid := request.GetConnection().GetConnectionProperty(TRANS)
 	// 一个连接只能同时开启一个事物
 	if xid != nil && xid.(int64) != -1 {
 		return &ErrorIllegalOperation{}
 	} else {
+		// 隔离级别以及锁等待超时由会话变量决定
 		args := []string{"BEGIN"}
-		x, _, err := dbRouter.db.Execute(-1, args)
+		x, _, err := dbRouter.db.ExecuteSession(dbRouter.baseSession(request), -1, args)
 		if err != nil {
 			return err
 		}
@@ -198,10 +413,34 @@ func (dbRouter *DbRouter) abortBeforeErrorOrQuit(request iface.IRequest) {
 	}
 }
 
-func NewDbRouter(path string, memory int64, level versionManager.IsolationLevel) iface.IRouter {
+// clientAddr 写入审计日志的客户端地址
+func clientAddr(request iface.IRequest) string {
+	if addr := request.GetConnection().GetClientTcpStatus(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
+
+// NewDbRouter opts为打开TableManager的选项(例如列级加密的主密钥)
+func NewDbRouter(path string, memory, maxSize int64, level versionManager.IsolationLevel, opts ...tableManager.Option) iface.IRouter {
+	// 启动db, 选项(例如主密钥)不合法时拒绝启动
+	db, err := executor.OpenExecutor(path, memory, maxSize, level, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("Error occurs when opening database: %s", err))
+	}
+	if utils.GlobalObj.AuditLog != "" {
+		// 审计日志被篡改时拒绝启动
+		audit, err := executor.OpenAuditLog(utils.GlobalObj.AuditLog)
+		if err != nil {
+			panic(fmt.Sprintf("Error occurs when opening audit log: %s", err))
+		}
+		db.SetAuditLog(audit)
+	}
 	return &DbRouter{
 		BaseRouter: BaseRouter{"DbRouter"},
-		db:         executor.NewExecutor(path, memory, level), // 启动db
+		db:         db,
+		groups: NewResourceGroups(utils.GlobalObj.ResourceGroups, utils.GlobalObj.MaxConcurrentQueries,
+			utils.GlobalObj.MaxQueuedQueries, time.Duration(utils.GlobalObj.QueueTimeout)*time.Millisecond),
 	}
 }
 
@@ -213,6 +452,13 @@ func (err *ErrorIllegalOperation) Error() string {
 	return "Illegal Operation"
 }
 
+// ErrorNotPrimary 备库拒绝执行语句, 客户端收到之后重新寻找主库
+type ErrorNotPrimary struct{}
+
+func (err *ErrorNotPrimary) Error() string {
+	return "Not the primary server"
+}
+
 // pack response
 
 const (
@@ -221,6 +467,7 @@ const (
 	IntHead        string = ":"
 	BulkStringHead string = "$"
 	BulkArrayHead  string = "*"
+	PushHead       string = ">" // 服务器主动推送的消息(通知)
 	CRLF           string = "\r\n"
 	WELCOME        string = "+Welcome!\r\n"
 	OK             string = "Query OK!"
@@ -232,6 +479,24 @@ func packErrorMessage(msg string) string {
 	return strings.Join(str, "")
 }
 
+// packResponse 查询结果: 行数, 列数, 按行排列的各个值
+func packResponse(response []*tableManager.ResponseObject) string {
+	last := response[len(response)-1]
+	row, col := last.RowId+1, last.ColId+1
+	resMsg := make([]string, 0)
+	resMsg = append(resMsg, strconv.FormatInt(int64(row), 10))
+	resMsg = append(resMsg, strconv.FormatInt(int64(col), 10))
+	for _, res := range response {
+		resMsg = append(resMsg, res.Payload)
+	}
+	return packBulkArray(resMsg)
+}
+
+// packPush 推送的通知, 除了类型之外与packResponse相同
+func packPush(response []*tableManager.ResponseObject) string {
+	return PushHead + strings.TrimPrefix(packResponse(response), BulkArrayHead)
+}
+
 func packString(msg string) string {
 	var str = []string{StringHead, msg, CRLF}
 	return strings.Join(str, "")
@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myDB/versionManager"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+	配置文件
+	支持TOML(.toml)以及JSON(.json)两种格式, key与GlobalConfig的json标签相同, 资源组为TOML中的[[resourceGroups]]
+	配置文件的路径由环境变量MYDB_CONFIG指定, 没有指定时读取DefaultConfigFile(不存在时使用默认配置)
+	严格校验: 未知的key, 类型不匹配以及取值不合法都会返回ErrorConfig, 包含文件, 行号(TOML)以及key, 服务器拒绝启动
+*/
+
+const (
+	ConfigEnv         string = "MYDB_CONFIG"
+	DefaultConfigFile string = "../config/server_config.json"
+)
+
+type ErrorConfig struct {
+	File   string
+	Line   int // 0表示未知
+	Key    string
+	Reason string
+}
+
+func (err *ErrorConfig) Error() string {
+	var b strings.Builder
+	b.WriteString(err.File)
+	if err.Line > 0 {
+		b.WriteString(fmt.Sprintf(":%d", err.Line))
+	}
+	b.WriteString(": ")
+	if err.Key != "" {
+		b.WriteString(err.Key + ": ")
+	}
+	b.WriteString(err.Reason)
+	return b.String()
+}
+
+// Load 读取配置文件, 文件中没有出现的key保持原来的值
+// 文件不存在时返回的error满足errors.Is(err, os.ErrNotExist)
+func (g *GlobalConfig) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc, err := parseConfig(path, data)
+	if err == nil {
+		err = doc.checkKeys(reflect.TypeOf(*g), doc.root, "")
+	}
+	if err == nil {
+		err = doc.decode(g)
+	}
+	if err == nil {
+		err = g.Validate()
+	}
+	var configErr *ErrorConfig
+	if errors.As(err, &configErr) {
+		configErr.File = path
+		if configErr.Line == 0 && doc != nil {
+			configErr.Line = doc.lines[configErr.Key]
+		}
+	}
+	return err
+}
+
+func parseConfig(path string, data []byte) (*tomlDocument, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return parseToml(string(data))
+	case ".json":
+		doc := &tomlDocument{root: map[string]any{}, lines: map[string]int{}}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc.root); err != nil {
+			return nil, &ErrorConfig{Reason: err.Error()}
+		}
+		return doc, nil
+	}
+	return nil, &ErrorConfig{Reason: "unsupported config format, expect .toml or .json"}
+}
+
+// checkKeys m中的key必须是t的json标签
+func (doc *tomlDocument) checkKeys(t reflect.Type, m map[string]any, prefix string) error {
+	fields := configFields(t)
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, ext := fields[key]
+		if !ext {
+			return &ErrorConfig{Key: prefix + key, Line: doc.lines[prefix+key], Reason: "unknown key" + suggestKey(key, fields)}
+		}
+		items, ok := m[key].([]any)
+		if !ok || field.Type.Kind() != reflect.Slice {
+			continue
+		}
+		elem := field.Type.Elem()
+		if elem.Kind() == reflect.Pointer {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			continue
+		}
+		for i, item := range items {
+			if table, ok := item.(map[string]any); ok {
+				if err := doc.checkKeys(elem, table, fmt.Sprintf("%s%s[%d].", prefix, key, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// configFields json标签 -> 字段
+func configFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// suggestKey 拼写接近的key, 否则列出所有key
+func suggestKey(key string, fields map[string]reflect.StructField) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if editDistance(strings.ToLower(key), strings.ToLower(name)) <= 2 {
+			return fmt.Sprintf(", did you mean %s?", name)
+		}
+	}
+	return ", known keys: " + strings.Join(names, ", ")
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = cur[j-1] + 1
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// decode 类型不匹配时返回ErrorConfig
+func (doc *tomlDocument) decode(g *GlobalConfig) error {
+	raw, err := json.Marshal(doc.root)
+	if err != nil {
+		return &ErrorConfig{Reason: err.Error()}
+	}
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(raw, g); errors.As(err, &typeErr) {
+		return &ErrorConfig{Key: typeErr.Field, Reason: fmt.Sprintf("expect %s, got %s", typeErr.Type, typeErr.Value)}
+	} else if err != nil {
+		return &ErrorConfig{Reason: err.Error()}
+	}
+	return nil
+}
+
+// Validate 校验取值范围
+func (g *GlobalConfig) Validate() error {
+	checks := []struct {
+		key    string
+		bad    bool
+		reason string
+	}{
+		{"tcpPort", g.TcpPort <= 0 || g.TcpPort > 65535, "must be in 1..65535"},
+		{"healthPort", g.HealthPort < 0 || g.HealthPort > 65535 || g.HealthPort == g.TcpPort, "must be in 0..65535 and differ from tcpPort"},
+		{"maxConn", g.MaxConn <= 0, "must be positive"},
+		{"maxPackingSize", g.MaxPackingSize == 0, "must be positive"},
+		{"workerPoolSize", g.WorkerPoolSize == 0, "must be positive"},
+		{"bufferPoolMemory", g.BufferPoolMemory <= 0, "must be positive"},
+		{"path", g.Path == "", "must not be empty"},
+		{"maxDatabaseSize", g.MaxDatabaseSize < 0, "must not be negative, 0 means unlimited"},
+		{"maxConcurrentQueries", g.MaxConcurrentQueries < 0, "must not be negative, 0 means unlimited"},
+		{"maxQueuedQueries", g.MaxQueuedQueries < 0, "must not be negative"},
+		{"queueTimeout", g.QueueTimeout < 0, "must not be negative, 0 means waiting forever"},
+		{"scanWorkers", g.ScanWorkers < 0, "must not be negative"},
+		{"slowQueryTime", g.SlowQueryTime < 0, "must not be negative, 0 means disabled"},
+		{"role", g.Role != "" && g.Role != RolePrimary && g.Role != RoleStandby, "must be primary or standby"},
+		{"iso", g.Iso != versionManager.ReadCommitted && g.Iso != versionManager.ReadRepeatable, "must be 0 (read committed) or 1 (repeatable read)"},
+	}
+	for _, c := range checks {
+		if c.bad {
+			return &ErrorConfig{Key: c.key, Reason: c.reason}
+		}
+	}
+	names := make(map[string]struct{}, len(g.ResourceGroups))
+	for i, group := range g.ResourceGroups {
+		prefix := fmt.Sprintf("resourceGroups[%d].", i)
+		if group == nil || group.Name == "" {
+			return &ErrorConfig{Key: prefix + "name", Reason: "must not be empty"}
+		}
+		if _, ext := names[group.Name]; ext {
+			return &ErrorConfig{Key: prefix + "name", Reason: "duplicate resource group " + group.Name}
+		}
+		names[group.Name] = struct{}{}
+		if group.MaxMemory < 0 {
+			return &ErrorConfig{Key: prefix + "maxMemory", Reason: "must not be negative, 0 means unlimited"}
+		}
+		if group.Shares < 0 {
+			return &ErrorConfig{Key: prefix + "shares", Reason: "must not be negative"}
+		}
+	}
+	return nil
+}
@@ -1,7 +1,7 @@
 package utils
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"myDB/server/iface"
 	"myDB/versionManager"
@@ -14,22 +14,40 @@ import (
 */
 
 type GlobalConfig struct {
-	TcpServer        iface.IServer
-	Name             string                        `json:"name"`
-	Host             string                        `json:"host"`
-	TcpPort          int                           `json:"tcpPort"`
-	Version          string                        `json:"version"`
-	MaxConn          int                           `json:"maxConn"`        // 最大连接数
-	MaxPackingSize   uint32                        `json:"maxPackingSize"` // 当前服务器一次数据包的最大值
-	WorkerPoolSize   uint32                        `json:"workerPoolSize"` // 当前业务工作Worker池的Goroutine数量
-	BufferPoolMemory int64                         `json:"bufferPoolMemory"`
-	Path             string                        `json:"path"` // 数据库文件路径
-	Iso              versionManager.IsolationLevel // 数据库隔离级别
+	TcpServer            iface.IServer                 `json:"-"`
+	Name                 string                        `json:"name"`
+	Host                 string                        `json:"host"`
+	TcpPort              int                           `json:"tcpPort"`
+	Version              string                        `json:"version"`
+	MaxConn              int                           `json:"maxConn"`        // 最大连接数
+	MaxPackingSize       uint32                        `json:"maxPackingSize"` // 当前服务器一次数据包的最大值
+	WorkerPoolSize       uint32                        `json:"workerPoolSize"` // 当前业务工作Worker池的Goroutine数量
+	BufferPoolMemory     int64                         `json:"bufferPoolMemory"`
+	Path                 string                        `json:"path"`                 // 数据库文件路径
+	MaxDatabaseSize      int64                         `json:"maxDatabaseSize"`      // 数据库大小上限(字节), 0表示不限制
+	MaxConcurrentQueries int                           `json:"maxConcurrentQueries"` // 同时执行的最大查询数, 0表示不限制
+	MaxQueuedQueries     int                           `json:"maxQueuedQueries"`     // 等待执行的最大查询数
+	QueueTimeout         int64                         `json:"queueTimeout"`         // 查询最长排队时间(毫秒), 0表示一直等待
+	ResourceGroups       []*ResourceGroupConfig        `json:"resourceGroups"`       // 资源组
+	ScanWorkers          int                           `json:"scanWorkers"`          // 单个查询并行扫描的worker数, 0或1表示顺序扫描
+	SlowQueryTime        int64                         `json:"slowQueryTime"`        // 慢查询阈值(毫秒), 0表示不记录慢查询日志
+	AuditLog             string                        `json:"auditLog"`             // 审计日志文件, 为空表示不开启审计
+	HealthPort           int                           `json:"healthPort"`           // 健康检查HTTP接口(/livez, /readyz)的端口, 0表示不开启
+	Role                 string                        `json:"role"`                 // 服务器的角色 primary | standby, 由客户端通过ROLE命令发现主库
+	Iso                  versionManager.IsolationLevel `json:"iso"`                  // 数据库隔离级别
+}
+
+type ResourceGroupConfig struct {
+	Name      string `json:"name"`
+	MaxMemory int64  `json:"maxMemory"` // 单个查询可以使用的最大内存(字节), 0表示不限制
+	Shares    int    `json:"shares"`    // 调度权重
 }
 
 const (
 	MaxWorkerPoolSize uint32 = 32
 	DefaultFilePath   string = "./test/test"
+	RolePrimary       string = "primary"
+	RoleStandby       string = "standby" // 等待接管的服务器, 拒绝除ROLE以及QUIT之外的所有命令
 )
 
 var GlobalObj *GlobalConfig
@@ -38,19 +56,25 @@ var GlobalObj *GlobalConfig
 func init() {
 	// 默认配置
 	GlobalObj = &GlobalConfig{
-		Name:             "default_server",
-		Version:          "1.0",
-		TcpPort:          33333,
-		Host:             "0.0.0.0",
-		MaxConn:          10,
-		MaxPackingSize:   4096,
-		WorkerPoolSize:   10,
-		BufferPoolMemory: 1 << 20,
-		Path:             DefaultFilePath,
-		Iso:              1, // Default RR
+		Name:                 "default_server",
+		Version:              "1.0",
+		TcpPort:              33333,
+		Host:                 "0.0.0.0",
+		MaxConn:              10,
+		MaxPackingSize:       4096,
+		WorkerPoolSize:       10,
+		BufferPoolMemory:     1 << 20,
+		Path:                 DefaultFilePath,
+		MaxDatabaseSize:      0,
+		MaxConcurrentQueries: 0,
+		MaxQueuedQueries:     64,
+		QueueTimeout:         3000,
+		ResourceGroups:       []*ResourceGroupConfig{{Name: "default", Shares: 1}},
+		Role:                 RolePrimary,
+		Iso:                  1, // Default RR
 	}
-	// read json config
-	GlobalObj.loadFormJson()
+	// read config file
+	GlobalObj.loadConfig()
 	if GlobalObj.WorkerPoolSize > MaxWorkerPoolSize {
 		fmt.Printf("[Server Config WARNING] Server worker pool size is larger than max worker pool size,"+
 			" size is reset to %d\n", MaxWorkerPoolSize)
@@ -58,13 +82,16 @@ func init() {
 	}
 }
 
-func (g *GlobalConfig) loadFormJson() {
-	data, err := os.ReadFile("../config/server_config.json")
-	if err != nil {
-		fmt.Printf("[Server Reading Config ERROR] Reading config error:%s\n", err)
+// loadConfig 没有指定配置文件并且默认配置文件不存在时使用默认配置, 其他错误拒绝启动
+func (g *GlobalConfig) loadConfig() {
+	path := os.Getenv(ConfigEnv)
+	if path == "" {
+		path = DefaultConfigFile
 	}
-	err = json.Unmarshal(data, g)
-	if err != nil {
+	err := g.Load(path)
+	if err != nil && errors.Is(err, os.ErrNotExist) && path == DefaultConfigFile {
 		fmt.Printf("[Server Reading Config ERROR] Reading config error:%s\n", err)
+	} else if err != nil {
+		panic(fmt.Sprintf("[Server Reading Config ERROR] Invalid config %s", err))
 	}
 }
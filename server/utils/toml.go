@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+	TOML配置文件的解析, 只支持配置需要的子集:
+	key = value                 值为字符串("..."或者'...'), 整数, 浮点数, 布尔值或者单行数组
+	[table]                     之后的key属于table
+	[[array]]                   之后的key属于array中新的一个table
+	# 注释
+	不支持多行字符串, 内联表, 带点的key以及日期
+	解析结果为map[string]any, 同时记录每个key所在的行, 用于报告错误
+*/
+
+// tomlDocument 解析结果
+type tomlDocument struct {
+	root  map[string]any
+	lines map[string]int // key的路径(例如 resourceGroups[0].name) -> 行号
+}
+
+func parseToml(data string) (*tomlDocument, error) {
+	doc := &tomlDocument{root: map[string]any{}, lines: map[string]int{}}
+	current, prefix := doc.root, ""
+	for i, raw := range strings.Split(data, "\n") {
+		line := strings.TrimSpace(stripComment(raw))
+		lineNo := i + 1
+		if line == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "[["):
+			name, ok := tableName(line, "[[", "]]")
+			if !ok {
+				return nil, &ErrorConfig{Line: lineNo, Reason: "invalid array of tables " + line}
+			}
+			array, ext := doc.root[name].([]any)
+			if _, isValue := doc.root[name]; isValue && !ext {
+				return nil, &ErrorConfig{Line: lineNo, Key: name, Reason: "duplicate key"}
+			}
+			current = map[string]any{}
+			doc.root[name] = append(array, current)
+			prefix = fmt.Sprintf("%s[%d].", name, len(array))
+			doc.lines[strings.TrimSuffix(prefix, ".")] = lineNo
+		case strings.HasPrefix(line, "["):
+			name, ok := tableName(line, "[", "]")
+			if !ok {
+				return nil, &ErrorConfig{Line: lineNo, Reason: "invalid table " + line}
+			}
+			if _, ext := doc.root[name]; ext {
+				return nil, &ErrorConfig{Line: lineNo, Key: name, Reason: "duplicate key"}
+			}
+			current = map[string]any{}
+			doc.root[name] = current
+			prefix = name + "."
+			doc.lines[name] = lineNo
+		default:
+			index := strings.Index(line, "=")
+			if index == -1 {
+				return nil, &ErrorConfig{Line: lineNo, Reason: "expect key = value"}
+			}
+			key := strings.TrimSpace(line[:index])
+			if !isBareKey(key) {
+				return nil, &ErrorConfig{Line: lineNo, Key: key, Reason: "invalid key"}
+			}
+			if _, ext := current[key]; ext {
+				return nil, &ErrorConfig{Line: lineNo, Key: prefix + key, Reason: "duplicate key"}
+			}
+			value, rest, err := parseTomlValue(strings.TrimSpace(line[index+1:]))
+			if err != nil || strings.TrimSpace(rest) != "" {
+				return nil, &ErrorConfig{Line: lineNo, Key: prefix + key, Reason: "invalid value " + strings.TrimSpace(line[index+1:])}
+			}
+			current[key] = value
+			doc.lines[prefix+key] = lineNo
+		}
+	}
+	return doc, nil
+}
+
+// stripComment 去除不在字符串中的#之后的内容
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i += 1
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func tableName(line, open, close string) (string, bool) {
+	if !strings.HasSuffix(line, close) {
+		return "", false
+	}
+	name := strings.TrimSpace(line[len(open) : len(line)-len(close)])
+	return name, isBareKey(name)
+}
+
+func isBareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTomlValue 解析s开头的一个值, 返回剩余部分
+func parseTomlValue(s string) (any, string, error) {
+	invalid := fmt.Errorf("invalid value")
+	if s == "" {
+		return nil, "", invalid
+	}
+	switch s[0] {
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '"':
+				return b.String(), s[i+1:], nil
+			case '\\':
+				if i+1 == len(s) {
+					return nil, "", invalid
+				}
+				i += 1
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\':
+					b.WriteByte(s[i])
+				default:
+					return nil, "", invalid
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return nil, "", invalid
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end == -1 {
+			return nil, "", invalid
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case '[':
+		array := make([]any, 0)
+		rest := strings.TrimSpace(s[1:])
+		for {
+			if strings.HasPrefix(rest, "]") {
+				return array, rest[1:], nil
+			}
+			value, r, err := parseTomlValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			array = append(array, value)
+			rest = strings.TrimSpace(r)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", invalid
+			}
+		}
+	}
+	end := strings.IndexAny(s, ",]")
+	if end == -1 {
+		end = len(s)
+	}
+	token, rest := strings.TrimSpace(s[:end]), s[end:]
+	switch token {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	number := strings.ReplaceAll(token, "_", "")
+	if v, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return v, rest, nil
+	}
+	if v, err := strconv.ParseFloat(number, 64); err == nil {
+		return v, rest, nil
+	}
+	return nil, "", invalid
+}
@@ -0,0 +1,96 @@
+package simulation
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock 时钟
+// 数据库中需要时间的地方通过Now/Sleep/After获取, 模拟模式下替换为虚拟时钟
+
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// VirtualClock 虚拟时钟
+// 时间只在Advance或Sleep时前进, Sleep不阻塞, 直接将时钟拨快d并让出执行权
+// After返回的channel在时钟越过截止时间时触发
+type VirtualClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*virtualTimer // 按截止时间排序
+}
+
+type virtualTimer struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// NewVirtualClock 虚拟时钟从一个固定的时间开始, 保证每次模拟的时间相同
+func NewVirtualClock() *VirtualClock {
+	return &VirtualClock{now: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *VirtualClock) Sleep(d time.Duration) {
+	c.Advance(d)
+	Yield("sleep")
+}
+
+func (c *VirtualClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	timer := &virtualTimer{deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		timer.c <- c.now
+		return timer.c
+	}
+	c.timers = append(c.timers, timer)
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].deadline.Before(c.timers[j].deadline) })
+	return timer.c
+}
+
+// Advance 时钟前进d, 触发所有到期的timer
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	for len(c.timers) > 0 && !c.timers[0].deadline.After(c.now) {
+		c.timers[0].c <- c.now
+		c.timers = c.timers[1:]
+	}
+}
+
+// Now 当前时钟的时间
+func Now() time.Time {
+	return currentClock().Now()
+}
+
+func Sleep(d time.Duration) {
+	currentClock().Sleep(d)
+}
+
+func After(d time.Duration) <-chan time.Time {
+	return currentClock().After(d)
+}
+
+func currentClock() Clock {
+	if c := clock.Load(); c != nil {
+		return *c
+	}
+	return realClock{}
+}
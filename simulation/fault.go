@@ -0,0 +1,104 @@
+package simulation
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// FaultInjector 故障注入
+// 数据库在I/O之前调用Fault(故障点), 注入器按种子确定的随机数决定:
+// 返回I/O错误(ErrorInjectedIO), 或者模拟进程崩溃(panic(*Crash))
+// 崩溃之后不应该再使用当前的数据库实例, 重新打开数据库以验证恢复
+
+type ErrorInjectedIO struct {
+	Point string
+}
+
+func (err *ErrorInjectedIO) Error() string {
+	return fmt.Sprintf("Injected I/O error at %s", err.Point)
+}
+
+// Crash 模拟崩溃, 作为panic的值
+type Crash struct {
+	Point string
+}
+
+func (c *Crash) Error() string {
+	return fmt.Sprintf("Simulated crash at %s", c.Point)
+}
+
+type FaultInjector struct {
+	lock      sync.Mutex
+	rand      *rand.Rand
+	ioRate    float64 // 每次经过故障点时返回I/O错误的概率
+	crashRate float64 // 每次经过故障点时崩溃的概率
+	crashAt   int     // 第crashAt次经过故障点时崩溃, 0表示不使用
+	hits      int
+	crashed   bool
+}
+
+func NewFaultInjector(seed int64) *FaultInjector {
+	return &FaultInjector{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (f *FaultInjector) SetIORate(rate float64) *FaultInjector {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.ioRate = rate
+	return f
+}
+
+func (f *FaultInjector) SetCrashRate(rate float64) *FaultInjector {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.crashRate = rate
+	return f
+}
+
+// CrashAt 第n次经过故障点时崩溃
+func (f *FaultInjector) CrashAt(n int) *FaultInjector {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.crashAt = n
+	return f
+}
+
+// Hits 经过故障点的次数
+func (f *FaultInjector) Hits() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.hits
+}
+
+// Crashed 是否已经崩溃, 崩溃之后所有故障点都会崩溃, 避免崩溃后继续写入
+func (f *FaultInjector) Crashed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.crashed
+}
+
+func (f *FaultInjector) fault(point string) error {
+	f.lock.Lock()
+	f.hits += 1
+	// 每次都消耗相同数量的随机数, 与概率设置无关
+	ioRoll, crashRoll := f.rand.Float64(), f.rand.Float64()
+	if f.crashed || (f.crashAt > 0 && f.hits == f.crashAt) || crashRoll < f.crashRate {
+		f.crashed = true
+		f.lock.Unlock()
+		panic(&Crash{Point: point})
+	}
+	f.lock.Unlock()
+	if ioRoll < f.ioRate {
+		return &ErrorInjectedIO{Point: point}
+	}
+	return nil
+}
+
+// Fault 故障点, 没有安装故障注入器时返回nil
+func Fault(point string) error {
+	if f := faults.Load(); f != nil {
+		return f.fault(point)
+	}
+	return nil
+}
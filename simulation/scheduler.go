@@ -0,0 +1,199 @@
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Scheduler 确定性调度
+// 通过Go创建的任务在同一时刻只有一个在运行, 任务在yield点(Yield)让出执行权
+// 调度器用种子确定的随机数选择下一个运行的任务, 相同的种子得到相同的执行顺序(Trace)
+// 任务在yield点之外阻塞(例如等待另一个任务持有的锁)超过BlockTimeout时, 调度器会先运行其他任务,
+// 此时执行顺序不再确定; 所有阻塞点都是yield点时调度是确定的
+// 只有模拟任务中的Yield会让出执行权, 其他goroutine中的Yield直接返回
+
+const DefaultBlockTimeout = 50 * time.Millisecond
+
+type task struct {
+	id     int
+	name   string
+	gid    int64
+	resume chan struct{}
+}
+
+type event struct {
+	task     *task
+	finished bool
+}
+
+type Scheduler struct {
+	BlockTimeout time.Duration
+
+	rand    *rand.Rand
+	lock    sync.Mutex // 保护以下字段
+	parked  []*task    // 等待调度的任务, 按创建顺序
+	tasks   map[int64]*task
+	trace   []string
+	err     error
+	nextId  int
+	events  chan *event
+	dead    chan struct{} // 任务崩溃后关闭, 其余任务退出
+	running int           // 未结束的任务数
+}
+
+type ErrorTaskPanic struct {
+	Task  string
+	Value any
+}
+
+func (err *ErrorTaskPanic) Error() string {
+	return fmt.Sprintf("Simulation task %s panics: %v", err.Task, err.Value)
+}
+
+func NewScheduler(seed int64) *Scheduler {
+	return &Scheduler{
+		BlockTimeout: DefaultBlockTimeout,
+		rand:         rand.New(rand.NewSource(seed)),
+		tasks:        make(map[int64]*task),
+		events:       make(chan *event, 1024),
+		dead:         make(chan struct{}),
+	}
+}
+
+// Go 创建一个任务, 任务在Run之后才开始执行
+func (s *Scheduler) Go(name string, fn func()) {
+	s.lock.Lock()
+	t := &task{id: s.nextId, name: name, resume: make(chan struct{}, 1)}
+	s.nextId += 1
+	s.running += 1
+	s.lock.Unlock()
+	registered := make(chan struct{})
+	go func() {
+		t.gid = goid()
+		s.lock.Lock()
+		s.tasks[t.gid] = t
+		s.lock.Unlock()
+		close(registered)
+		s.park(t)
+		defer func() {
+			if r := recover(); r != nil {
+				s.fail(t, r)
+			}
+			s.lock.Lock()
+			delete(s.tasks, t.gid)
+			s.lock.Unlock()
+			s.events <- &event{task: t, finished: true}
+		}()
+		fn()
+	}()
+	<-registered
+}
+
+// Run 调度所有任务直到全部结束
+// 任务崩溃(Crash)时返回*Crash, 其他panic返回*ErrorTaskPanic
+func (s *Scheduler) Run() error {
+	running := make(map[int]*task) // 已经调度但还没有让出的任务
+	for {
+		s.lock.Lock()
+		if s.running == 0 || s.err != nil {
+			err := s.err
+			s.lock.Unlock()
+			return err
+		}
+		var next *task
+		if len(s.parked) > 0 {
+			i := s.rand.Intn(len(s.parked))
+			next = s.parked[i]
+			s.parked = append(s.parked[:i], s.parked[i+1:]...)
+		}
+		s.lock.Unlock()
+		if next != nil {
+			running[next.id] = next
+			next.resume <- struct{}{}
+		}
+		var timeout <-chan time.Time
+		if next != nil || len(running) == 0 {
+			timeout = time.After(s.BlockTimeout)
+		}
+		select {
+		case e := <-s.events:
+			delete(running, e.task.id)
+			if e.finished {
+				s.lock.Lock()
+				s.running -= 1
+				s.lock.Unlock()
+			}
+		case <-timeout:
+		}
+	}
+}
+
+// Trace 调度顺序: 任务名@yield点
+func (s *Scheduler) Trace() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string{}, s.trace...)
+}
+
+// park 任务进入等待队列并阻塞到被调度
+func (s *Scheduler) park(t *task) {
+	s.lock.Lock()
+	s.parked = append(s.parked, t)
+	s.lock.Unlock()
+	select {
+	case <-t.resume:
+	case <-s.dead:
+		runtime.Goexit()
+	}
+}
+
+func (s *Scheduler) yield(point string) {
+	s.lock.Lock()
+	t, ext := s.tasks[goid()]
+	if ext {
+		s.trace = append(s.trace, t.name+"@"+point)
+	}
+	s.lock.Unlock()
+	if !ext {
+		return
+	}
+	s.events <- &event{task: t}
+	s.park(t)
+}
+
+func (s *Scheduler) fail(t *task, r any) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err != nil {
+		return
+	}
+	if crash, ok := r.(*Crash); ok {
+		s.err = crash
+	} else {
+		s.err = &ErrorTaskPanic{Task: t.name, Value: r}
+	}
+	s.trace = append(s.trace, t.name+"@crash")
+	close(s.dead)
+}
+
+// Yield yield点, 模拟任务在这里让出执行权
+func Yield(point string) {
+	if s := scheduler.Load(); s != nil {
+		s.yield(point)
+	}
+}
+
+// goid 当前goroutine的id, 只在模拟模式下使用
+func goid() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// goroutine 123 [running]: ...
+	fields := bytes.Fields(buf)
+	id, _ := strconv.ParseInt(string(fields[1]), 10, 64)
+	return id
+}
@@ -0,0 +1,50 @@
+package simulation
+
+import (
+	"sync/atomic"
+)
+
+// 确定性模拟
+// 用同一个种子创建虚拟时钟, 调度器以及故障注入器, 并安装为全局实例
+// 相同的种子 + 相同的工作负载得到相同的调度顺序以及故障, 失败可以通过种子复现
+// 全局实例同一时刻只能有一个, 使用模拟模式的测试不能并行执行
+
+var (
+	clock     atomic.Pointer[Clock]
+	scheduler atomic.Pointer[Scheduler]
+	faults    atomic.Pointer[FaultInjector]
+)
+
+type Simulation struct {
+	Seed      int64
+	Clock     *VirtualClock
+	Scheduler *Scheduler
+	Faults    *FaultInjector
+}
+
+// NewSimulation 安装虚拟时钟, 调度器以及(不产生故障的)故障注入器
+func NewSimulation(seed int64) *Simulation {
+	sim := &Simulation{
+		Seed:      seed,
+		Clock:     NewVirtualClock(),
+		Scheduler: NewScheduler(seed),
+		Faults:    NewFaultInjector(seed),
+	}
+	var c Clock = sim.Clock
+	clock.Store(&c)
+	scheduler.Store(sim.Scheduler)
+	faults.Store(sim.Faults)
+	return sim
+}
+
+// Enabled 是否处于模拟模式
+func Enabled() bool {
+	return scheduler.Load() != nil
+}
+
+// Close 卸载模拟实例, 恢复真实时钟
+func (sim *Simulation) Close() {
+	clock.Store(nil)
+	scheduler.Store(nil)
+	faults.Store(nil)
+}
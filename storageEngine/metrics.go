@@ -0,0 +1,55 @@
+package storageEngine
+
+import (
+	"fmt"
+	"myDB/dataManager"
+)
+
+// 指标
+// 以gauge的形式导出redo log各个位置的LSN以及它们之间的差距, 用于对持久化以及复制的延迟告警:
+// redo_lsn              已经记录的日志(包括缓存在内存中的批量日志)
+// redo_written_lsn      已经写入日志文件
+// redo_synced_lsn       已经刷盘
+// redo_checkpoint_lsn   最近一次checkpoint
+// replica_applied_lsn   副本已经应用, 由副本通过ReportReplica上报
+// 差距(字节)为redo_lsn与其他位置之差, 持续增长说明刷盘, checkpoint或者复制跟不上写入
+// purge_backlog_items   待清理的失效DataItem, 持续增长说明清理跟不上删除
+// changed_pages         上一次备份之后写回的页, 即下一次增量备份拷贝的页数
+// unscrubbed_pages      上一次校验之后写回的页, 即下一次定向校验读取的页数
+// 指标名称参考Prometheus的格式, 副本的指标带有replica标签
+
+// Metric 一个gauge
+type Metric struct {
+	Name  string
+	Value int64
+}
+
+func (se *NtStorageEngine) Metrics() []Metric {
+	status := se.tm.Status()
+	return append(LsnMetrics(status.Dm.Redo), Metric{"purge_backlog_items", status.Purge.Backlog},
+		Metric{"changed_pages", status.Dm.ChangedPages}, Metric{"unscrubbed_pages", status.Dm.UnscrubbedPages})
+}
+
+func (se *NtStorageEngine) ReportReplica(name string, lsn int64) {
+	se.tm.ReportReplica(name, lsn)
+}
+
+// LsnMetrics redo log的LSN以及延迟
+func LsnMetrics(redo dataManager.LogStats) []Metric {
+	metrics := []Metric{
+		{"redo_lsn", redo.Lsn},
+		{"redo_written_lsn", redo.FlushedLsn},
+		{"redo_synced_lsn", redo.SyncedLsn},
+		{"redo_checkpoint_lsn", redo.Checkpoint},
+		{"redo_write_lag_bytes", redo.Lsn - redo.FlushedLsn},
+		{"redo_sync_lag_bytes", redo.Lsn - redo.SyncedLsn},
+		{"redo_checkpoint_age_bytes", redo.Lsn - redo.Checkpoint},
+	}
+	for _, replica := range redo.Replicas {
+		label := fmt.Sprintf("{replica=%q}", replica.Name)
+		metrics = append(metrics,
+			Metric{"replica_applied_lsn" + label, replica.AppliedLsn},
+			Metric{"replica_lag_bytes" + label, redo.Lsn - replica.AppliedLsn})
+	}
+	return metrics
+}
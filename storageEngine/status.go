@@ -0,0 +1,158 @@
+package storageEngine
+
+import (
+	"fmt"
+	"myDB/dataManager"
+	"myDB/simulation"
+	"myDB/tableManager"
+	"myDB/versionManager"
+	"strings"
+	"time"
+)
+
+// Status
+// 仿照InnoDB的SHOW ENGINE INNODB STATUS, 将各层的运行状态汇总为一份文本报告:
+// BUFFER POOL, LOG, TRANSACTIONS, LOCK WAITS, LATEST DETECTED DEADLOCK, PLAN CACHE
+// 各部分分别获取, 报告不是一个一致的快照
+func (se *NtStorageEngine) Status() string {
+	return FormatEngineStatus(se.tm.Status(), se.tm.PlanCacheStats(), simulation.Now())
+}
+
+func (se *NtStorageEngine) CheckHealth(timeout time.Duration) error {
+	return se.tm.CheckHealth(timeout)
+}
+
+func (se *NtStorageEngine) Close() {
+	se.tm.Close()
+}
+
+// FormatStatus 生成now时刻的状态报告, 不包含PLAN CACHE
+func FormatStatus(status versionManager.VmStatus, now time.Time) string {
+	return formatStatus(status, nil, now)
+}
+
+// FormatEngineStatus 生成now时刻包含PLAN CACHE的状态报告
+func FormatEngineStatus(status versionManager.VmStatus, plans tableManager.PlanCacheStats, now time.Time) string {
+	return formatStatus(status, &plans, now)
+}
+
+func formatStatus(status versionManager.VmStatus, plans *tableManager.PlanCacheStats, now time.Time) string {
+	r := &report{}
+	r.line("=====================================")
+	r.line("%s MYDB ENGINE STATUS", now.Format("2006-01-02 15:04:05"))
+	r.line("=====================================")
+
+	r.section("BUFFER POOL")
+	pool := status.Dm.Pool
+	r.line("Pages capacity %d, cached %d", pool.Capacity, pool.Cached)
+	hitRate := 0.0
+	if pool.Hits+pool.Misses > 0 {
+		hitRate = float64(pool.Hits) * 100 / float64(pool.Hits+pool.Misses)
+	}
+	r.line("Page hits %d, misses %d, hit rate %.2f%%", pool.Hits, pool.Misses, hitRate)
+	r.line("Pages flushed %d, evicted %d, allocated %d", pool.Flushes, pool.Evictions, pool.Allocated)
+	for _, space := range status.Dm.Spaces {
+		fill := ""
+		if space.FillFactor != dataManager.DefaultFillFactor {
+			fill = fmt.Sprintf(", fill factor %d%%", space.FillFactor)
+		}
+		if space.Unlogged {
+			fill += ", unlogged"
+		}
+		r.line("Space %d: %d pages, used %d bytes, cached %d, hits %d, misses %d, flushed %d%s",
+			space.Space, space.Pages, space.Used, space.Pool.Cached, space.Pool.Hits, space.Pool.Misses, space.Pool.Flushes, fill)
+	}
+
+	r.line("Database meta area %d pages", status.Dm.MetaPages)
+	r.line("Dangling references %d pending, %d total", status.Dm.DanglingPending, status.Dm.DanglingTotal)
+	r.line("Forwarded references %d pending, %d total", status.Dm.ForwardPending, status.Dm.ForwardTotal)
+
+	r.section("LOG")
+	redo := status.Dm.Redo
+	r.line("Log sequence number %d", redo.Lsn)
+	r.line("Log flushed up to   %d", redo.FlushedLsn)
+	r.line("Log synced up to    %d", redo.SyncedLsn)
+	r.line("Last checkpoint at  %d", redo.Checkpoint)
+	r.line("Flush lag %d bytes, sync lag %d bytes, %d batched transactions",
+		redo.Lsn-redo.FlushedLsn, redo.Lsn-redo.SyncedLsn, redo.Batches)
+	r.line("Checkpoint age %d bytes", redo.Lsn-redo.Checkpoint)
+	r.line("Coalesced %d log records in batched transactions", redo.Coalesced)
+	for _, replica := range redo.Replicas {
+		r.line("Replica %s applied up to %d, lag %d bytes", replica.Name, replica.AppliedLsn, redo.Lsn-replica.AppliedLsn)
+	}
+
+	r.section("TRANSACTIONS")
+	r.line("Next xid %d, min active xid %d", status.NextXid, status.MinActiveXid)
+	purge := status.Purge
+	r.line("Purge backlog %d data items in %d tables, purged %d", purge.Backlog, purge.Tables, purge.Purged)
+	r.line("Purge workers %d running, limit %d", purge.Running, purge.Workers)
+	// undo log不会被清理
+	r.line("Undo log %d bytes", status.UndoSize)
+	r.line("%d active transactions", len(status.Active))
+	for _, tran := range status.Active {
+		level := "READ COMMITTED"
+		if tran.Level == versionManager.ReadRepeatable {
+			level = "REPEATABLE READ"
+		}
+		line := fmt.Sprintf("---TRANSACTION %d, ACTIVE %s, %s", tran.Xid, elapsed(now, tran.Begin), level)
+		if tran.Purge {
+			line += ", PURGE"
+		}
+		if tran.Waiting != nil {
+			line += fmt.Sprintf(", LOCK WAIT %s", elapsed(now, tran.Waiting.Since))
+		}
+		r.line("%s", line)
+	}
+
+	r.section("LOCK WAITS")
+	r.line("%d transactions waiting for locks", len(status.LockWaits))
+	for _, wait := range status.LockWaits {
+		r.line("Transaction %d waits %s for table lock %d held by transaction %d",
+			wait.Xid, elapsed(now, wait.Since), wait.TbUid, wait.Owner)
+	}
+
+	r.section("LATEST DETECTED DEADLOCK")
+	if dl := status.LastDeadLock; dl == nil {
+		r.line("No deadlock detected")
+	} else {
+		r.line("%s", dl.Time.Format("2006-01-02 15:04:05"))
+		r.line("Transaction %d waiting for table lock %d held by transaction %d", dl.Xid, dl.TbUid, dl.Owner)
+		r.line("WE ROLL BACK TRANSACTION %d", dl.Xid)
+	}
+	r.line("Total deadlocks %d", status.DeadLocks)
+
+	if plans != nil {
+		r.section("PLAN CACHE")
+		r.line("Plans cached %d, capacity %d", plans.Entries, plans.Capacity)
+		hitRate := 0.0
+		if plans.Hits+plans.Misses > 0 {
+			hitRate = float64(plans.Hits) * 100 / float64(plans.Hits+plans.Misses)
+		}
+		r.line("Plan hits %d, misses %d, hit rate %.2f%%", plans.Hits, plans.Misses, hitRate)
+		r.line("Plans invalidated %d", plans.Invalidations)
+	}
+
+	r.line("=====================================")
+	r.line("END OF MYDB ENGINE STATUS")
+	r.line("=====================================")
+	return r.String()
+}
+
+type report struct {
+	strings.Builder
+}
+
+func (r *report) line(format string, args ...any) {
+	r.WriteString(fmt.Sprintf(format, args...))
+	r.WriteByte('\n')
+}
+
+func (r *report) section(title string) {
+	r.line("%s", strings.Repeat("-", len(title)))
+	r.line("%s", title)
+	r.line("%s", strings.Repeat("-", len(title)))
+}
+
+func elapsed(now, since time.Time) string {
+	return now.Sub(since).Round(time.Millisecond).String()
+}
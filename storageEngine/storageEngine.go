@@ -1,24 +1,71 @@
 package storageEngine
 
 import (
+	"io"
 	"log"
+	"myDB/dataManager"
 	"myDB/tableManager"
 	"myDB/versionManager"
 	"sync"
+	"time"
 )
 
 type StorageEngine interface {
-	Begin() int64 // 开启一个事物，返回xid
+	Begin() int64                                           // 开启一个事物，返回xid
+	BeginWith(opts versionManager.TransactionOptions) int64 // 以指定的隔离级别以及锁等待超时开启事物
 	Commit(xid int64)
 	Abort(xid int64)
+	BeginBatch(xid int64) // 批量执行, 日志不逐条刷盘
+	EndBatch(xid int64)   // 结束批量执行, 日志统一刷盘
 
 	Show(xid int64) ([]*tableManager.ResponseObject, error) // 展示DB中的所有表
 	Create(xid int64, create *tableManager.Create) error    // create table
 
-	Insert(xid int64, insert *tableManager.Insert) error                                // insert
-	Select(xid int64, sel *tableManager.Select) ([]*tableManager.ResponseObject, error) // select
-	Update(xid int64, update *tableManager.Update) error                                // update fields
-	Delete(xid int64, delete *tableManager.Delete) error
+	Insert(xid int64, insert *tableManager.Insert) ([]*tableManager.ResponseObject, error)            // insert
+	BulkInsert(xid int64, tbName string, rows [][]string) (int, error)                                // 批量导入一批行
+	Select(xid int64, sel *tableManager.Select) ([]*tableManager.ResponseObject, error)               // select
+	SelectKey(xid int64, sel *tableManager.Select, key int64) ([]*tableManager.ResponseObject, error) // 主键点查
+	OpenCursor(xid int64, sel *tableManager.Select) (*tableManager.Cursor, error)                     // 为select声明游标
+	Fetch(xid int64, cursor *tableManager.Cursor, n int) ([]*tableManager.ResponseObject, error)      // 读出游标之后最多n行
+	Update(xid int64, update *tableManager.Update) ([]*tableManager.ResponseObject, error)            // update fields
+	Delete(xid int64, delete *tableManager.Delete) ([]*tableManager.ResponseObject, error)
+
+	Describe(xid int64, tbName string) ([]tableManager.Field, error) // 表的所有字段
+	EstimateRows(xid int64, tbName string) (int64, error)            // 表的近似行数
+	// Analyze 块采样更新表的统计信息
+	Analyze(xid int64, analyze *tableManager.Analyze) (*tableManager.TableStats, error)
+
+	Export(xid int64, export *tableManager.Export) error                               // 导出表空间
+	Attach(xid int64, attach *tableManager.Attach) error                               // 挂载表空间
+	Flashback(xid int64, flashback *tableManager.Flashback) error                      // 将表(或部分行)恢复到过去某个时刻
+	Swap(xid int64, swap *tableManager.Swap) error                                     // 在事物中原子地交换两张表的名字
+	MigratePage(tbName string, pageId int64) (int64, error)                            // 在线迁移位于pageId页的行(碎片整理)
+	ReclaimOrphans(dryRun bool) ([]tableManager.OrphanPage, error)                     // 回收不可达的数据页
+	Vacuum(tbName string) (dataManager.VacuumStats, error)                             // 整理表空间, 回收失效DataItem占用的空间
+	Hotspots(tbName string, top int) ([]*tableManager.TableHotspots, error)            // 表的页事件统计以及插入热点
+	TableSizes(tbName string) ([]*tableManager.TableSize, error)                       // 表的磁盘占用
+	OffloadCold(tbName, dir string, idle time.Duration) (dataManager.TierStats, error) // 将表中长时间没有访问的区迁移到二级目录
+	Backup(dir, base string) (dataManager.BackupStats, error)                          // 在线备份, base为基准备份的目录(为空时全量备份)
+	BackupTo(w io.Writer) (dataManager.BackupStats, error)                             // 流式在线备份, 用dataManager.RestoreStream恢复
+	Scrub(all bool) (dataManager.ScrubStats, error)                                    // 校验上一次校验之后写回的页, all时为所有页
+
+	Status() string                             // 引擎运行状态报告(SHOW ENGINE STATUS)
+	Metrics() []Metric                          // 可以用于告警的指标(SHOW METRICS)
+	ReportReplica(name string, lsn int64)       // 记录副本已经应用到的redo log LSN, lsn < 0 时移除
+	CheckHealth(timeout time.Duration) error    // 日志可写并且缓冲区没有停滞
+	SetRetention(retention time.Duration)       // 时间旅行查询(SELECT ... AS OF)的保留时间
+	SetPurgeWorkers(workers int)                // 清理失效DataItem的并行度, 0表示不清理
+	SetVacuumInterval(interval time.Duration)   // 后台整理所有表的间隔, 0表示停止
+	SetColdCompression(idle time.Duration)      // 自动压缩所有表中idle时间内没有访问的区, 0表示停止
+	SetChangeSink(sink tableManager.ChangeSink) // 行级变更流(CDC)
+	// BeginStatement 开始xid的一条新语句, 读已提交时语句中的快照读共享语句开始时创建的读视图
+	BeginStatement(xid int64)
+	// EndStatement 结束xid的当前语句, 返回语句以及事物的执行统计, xid不是活跃事物时返回false
+	EndStatement(xid int64) (versionManager.ExecStats, versionManager.ExecStats, bool)
+	// SetStatementTimeout xid当前语句的最长执行时间(扫描以及等待表锁), 超时则回滚事物, 0表示不限制
+	SetStatementTimeout(xid int64, timeout time.Duration)
+	// Close 关闭存储引擎, 调用方保证没有活跃的事物, 之后不能再使用
+	Close()
 }
 
 type NtStorageEngine struct {
@@ -45,6 +92,10 @@ func (se *NtStorageEngine) Begin() int64 {
 	return se.tm.Begin()
 }
 
+func (se *NtStorageEngine) BeginWith(opts versionManager.TransactionOptions) int64 {
+	return se.tm.BeginWith(opts)
+}
+
 func (se *NtStorageEngine) Commit(xid int64) {
 	if xid == -1 {
 		return
@@ -59,6 +110,61 @@ func (se *NtStorageEngine) Abort(xid int64) {
 	se.tm.Abort(xid)
 }
 
+func (se *NtStorageEngine) BeginBatch(xid int64) {
+	if xid == -1 {
+		return
+	}
+	se.tm.BeginBatch(xid)
+}
+
+func (se *NtStorageEngine) EndBatch(xid int64) {
+	if xid == -1 {
+		return
+	}
+	se.tm.EndBatch(xid)
+}
+
+func (se *NtStorageEngine) SetRetention(retention time.Duration) {
+	se.tm.SetRetention(retention)
+}
+
+func (se *NtStorageEngine) SetPurgeWorkers(workers int) {
+	se.tm.SetPurgeWorkers(workers)
+}
+
+func (se *NtStorageEngine) SetVacuumInterval(interval time.Duration) {
+	se.tm.SetVacuumInterval(interval)
+}
+
+func (se *NtStorageEngine) SetColdCompression(idle time.Duration) {
+	se.tm.SetColdCompression(idle)
+}
+
+func (se *NtStorageEngine) SetChangeSink(sink tableManager.ChangeSink) {
+	se.tm.SetChangeSink(sink)
+}
+
+func (se *NtStorageEngine) BeginStatement(xid int64) {
+	if xid == -1 {
+		return
+	}
+	se.tm.BeginStatement(xid)
+}
+
+func (se *NtStorageEngine) EndStatement(xid int64) (versionManager.ExecStats, versionManager.ExecStats, bool) {
+	if xid == -1 {
+		return versionManager.ExecStats{}, versionManager.ExecStats{}, false
+	}
+	return se.tm.EndStatement(xid)
+}
+
+func (se *NtStorageEngine) SetStatementTimeout(xid int64, timeout time.Duration) {
+	if xid == -1 {
+		return
+	}
+	se.tm.SetStatementTimeout(xid, timeout)
+}
+
 func (se *NtStorageEngine) Show(xid int64) ([]*tableManager.ResponseObject, error) {
 	return se.tm.Show(xid)
 }
@@ -82,13 +188,20 @@ func (se *NtStorageEngine) Create(xid int64, create *tableManager.Create) error
 	return se.tm.Create(xid, create)
 }
 
-func (se *NtStorageEngine) Insert(xid int64, insert *tableManager.Insert) error {
+func (se *NtStorageEngine) Insert(xid int64, insert *tableManager.Insert) ([]*tableManager.ResponseObject, error) {
 	if insert == nil || insert.TbName == "" || insert.Values == nil {
-		return &ErrorInvalidParameter{}
+		return nil, &ErrorInvalidParameter{}
 	}
 	return se.tm.Insert(xid, insert)
 }
 
+func (se *NtStorageEngine) BulkInsert(xid int64, tbName string, rows [][]string) (int, error) {
+	if tbName == "" {
+		return 0, &ErrorInvalidParameter{}
+	}
+	return se.tm.BulkInsert(xid, tbName, rows)
+}
+
 func (se *NtStorageEngine) Select(xid int64, sel *tableManager.Select) ([]*tableManager.ResponseObject, error) {
 	if sel == nil || sel.TbName == "" || sel.FNames == nil {
 		return nil, &ErrorInvalidParameter{}
@@ -96,28 +209,160 @@ func (se *NtStorageEngine) Select(xid int64, sel *tableManager.Select) ([]*table
 	return se.tm.Read(xid, sel)
 }
 
-func (se *NtStorageEngine) Update(xid int64, update *tableManager.Update) error {
+func (se *NtStorageEngine) SelectKey(xid int64, sel *tableManager.Select, key int64) ([]*tableManager.ResponseObject, error) {
+	if sel == nil || sel.TbName == "" || sel.FNames == nil {
+		return nil, &ErrorInvalidParameter{}
+	}
+	return se.tm.ReadKey(xid, sel, key)
+}
+
+func (se *NtStorageEngine) OpenCursor(xid int64, sel *tableManager.Select) (*tableManager.Cursor, error) {
+	if sel == nil || sel.TbName == "" || sel.FNames == nil {
+		return nil, &ErrorInvalidParameter{}
+	}
+	return se.tm.OpenCursor(xid, sel)
+}
+
+func (se *NtStorageEngine) Fetch(xid int64, cursor *tableManager.Cursor, n int) ([]*tableManager.ResponseObject, error) {
+	if cursor == nil || n <= 0 {
+		return nil, &ErrorInvalidParameter{}
+	}
+	return se.tm.Fetch(xid, cursor, n)
+}
+
+func (se *NtStorageEngine) Update(xid int64, update *tableManager.Update) ([]*tableManager.ResponseObject, error) {
 	// 不可以修改主键字段的值
 	if update == nil || update.ToUpdate == "" || update.FName == "" || update.TName == "" {
-		return &ErrorInvalidParameter{}
+		return nil, &ErrorInvalidParameter{}
 	}
 	if update.FName == tableManager.PrimaryKeyCol {
-		return &ErrorInvalidParameter{}
+		return nil, &ErrorInvalidParameter{}
 	}
 	return se.tm.Update(xid, update)
 }
 
-func (se *NtStorageEngine) Delete(xid int64, delete *tableManager.Delete) error {
+func (se *NtStorageEngine) Delete(xid int64, delete *tableManager.Delete) ([]*tableManager.ResponseObject, error) {
 	if delete == nil || delete.TName == "" {
-		return &ErrorInvalidParameter{}
+		return nil, &ErrorInvalidParameter{}
 	}
 	return se.tm.Delete(xid, delete)
 }
 
-func NewStorageEngine(path string, memory int64, level versionManager.IsolationLevel) StorageEngine {
-	se := &NtStorageEngine{
-		tm: tableManager.NewTableManager(path, memory, &sync.RWMutex{}, level),
+func (se *NtStorageEngine) Describe(xid int64, tbName string) ([]tableManager.Field, error) {
+	if tbName == "" {
+		return nil, &ErrorInvalidParameter{}
+	}
+	return se.tm.Describe(xid, tbName)
+}
+
+func (se *NtStorageEngine) EstimateRows(xid int64, tbName string) (int64, error) {
+	if tbName == "" {
+		return 0, &ErrorInvalidParameter{}
+	}
+	return se.tm.EstimateRows(xid, tbName)
+}
+
+func (se *NtStorageEngine) Analyze(xid int64, analyze *tableManager.Analyze) (*tableManager.TableStats, error) {
+	if xid == -1 || analyze == nil || analyze.TbName == "" {
+		return nil, &ErrorInvalidParameter{}
+	}
+	return se.tm.Analyze(xid, analyze)
+}
+
+func (se *NtStorageEngine) Export(xid int64, export *tableManager.Export) error {
+	if xid == -1 || export == nil || export.TbName == "" || export.Dir == "" {
+		return &ErrorInvalidParameter{}
+	}
+	return se.tm.Export(xid, export)
+}
+
+func (se *NtStorageEngine) Attach(xid int64, attach *tableManager.Attach) error {
+	if xid == -1 || attach == nil || attach.TbName == "" || attach.Dir == "" {
+		return &ErrorInvalidParameter{}
+	}
+	return se.tm.Attach(xid, attach)
+}
+
+func (se *NtStorageEngine) Flashback(xid int64, flashback *tableManager.Flashback) error {
+	if xid == -1 || flashback == nil || flashback.TbName == "" || flashback.AsOf.IsZero() {
+		return &ErrorInvalidParameter{}
+	}
+	return se.tm.Flashback(xid, flashback)
+}
+
+func (se *NtStorageEngine) Swap(xid int64, swap *tableManager.Swap) error {
+	if xid == -1 || swap == nil || swap.TbName == "" || swap.With == "" {
+		return &ErrorInvalidParameter{}
+	}
+	return se.tm.Swap(xid, swap)
+}
+
+func (se *NtStorageEngine) MigratePage(tbName string, pageId int64) (int64, error) {
+	if tbName == "" || pageId <= 0 {
+		return 0, &ErrorInvalidParameter{}
+	}
+	return se.tm.MigratePage(tbName, pageId)
+}
+
+func (se *NtStorageEngine) Vacuum(tbName string) (dataManager.VacuumStats, error) {
+	if tbName == "" {
+		return dataManager.VacuumStats{}, &ErrorInvalidParameter{}
+	}
+	return se.tm.Vacuum(tbName)
+}
+
+func (se *NtStorageEngine) ReclaimOrphans(dryRun bool) ([]tableManager.OrphanPage, error) {
+	return se.tm.ReclaimOrphans(dryRun)
+}
+
+func (se *NtStorageEngine) OffloadCold(tbName, dir string, idle time.Duration) (dataManager.TierStats, error) {
+	if tbName == "" || dir == "" || idle < 0 {
+		return dataManager.TierStats{}, &ErrorInvalidParameter{}
+	}
+	return se.tm.OffloadCold(tbName, dir, idle)
+}
+
+func (se *NtStorageEngine) Backup(dir, base string) (dataManager.BackupStats, error) {
+	if dir == "" {
+		return dataManager.BackupStats{}, &ErrorInvalidParameter{}
+	}
+	return se.tm.Backup(dir, base)
+}
+
+func (se *NtStorageEngine) BackupTo(w io.Writer) (dataManager.BackupStats, error) {
+	if w == nil {
+		return dataManager.BackupStats{}, &ErrorInvalidParameter{}
+	}
+	return se.tm.BackupTo(w)
+}
+
+func (se *NtStorageEngine) Scrub(all bool) (dataManager.ScrubStats, error) {
+	return se.tm.Scrub(all)
+}
+
+func (se *NtStorageEngine) Hotspots(tbName string, top int) ([]*tableManager.TableHotspots, error) {
+	return se.tm.Hotspots(tbName, top)
+}
+
+func (se *NtStorageEngine) TableSizes(tbName string) ([]*tableManager.TableSize, error) {
+	return se.tm.TableSizes(tbName)
+}
+
+// NewStorageEngine opts为打开TableManager的选项, 打开失败时panic
+func NewStorageEngine(path string, memory, maxSize int64, level versionManager.IsolationLevel, opts ...tableManager.Option) StorageEngine {
+	se, err := OpenStorageEngine(path, memory, maxSize, level, opts...)
+	if err != nil {
+		panic(err)
 	}
-	log.Printf("[Storage Engine] Start storage engine\n")
 	return se
 }
+
+// OpenStorageEngine 同NewStorageEngine, 选项不合法时返回错误(见tableManager.OpenTableManager)
+func OpenStorageEngine(path string, memory, maxSize int64, level versionManager.IsolationLevel, opts ...tableManager.Option) (StorageEngine, error) {
+	tm, err := tableManager.OpenTableManager(path, memory, maxSize, &sync.RWMutex{}, level, opts...)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Storage Engine] Start storage engine\n")
+	return &NtStorageEngine{tm: tm}, nil
+}
@@ -0,0 +1,169 @@
+package tableManager
+
+import (
+	"log"
+	"myDB/simulation"
+	"sync"
+	"time"
+)
+
+// 采样统计(ANALYZE)
+// 块采样表空间中约Percent%的页(见VersionManager的SampleRecords), 只读取选中的页, 大表也可以频繁刷新统计信息
+// 行数按 样本行数 * 表空间的页数 / 选中的页数 估计; 每个字段的最小值, 最大值以及不同值的个数(按样本估计, 见estimateDistinct)
+// 加密字段不记录最小值和最大值
+// 统计信息保存在内存中(不持久化, 重启之后需要重新ANALYZE), 更新之后该表的执行计划失效(见planCache.go)
+// 表的近似行数(见rowCount.go)没有初始化时用估计的行数初始化
+// 只支持行保存在表自己的表空间中的引擎(heap, walonly)
+
+const DefaultSamplePercent int = 10
+
+type Analyze struct {
+	TbName  string
+	Percent int // 0时为DefaultSamplePercent
+}
+
+type ColumnStats struct {
+	Field    string
+	Distinct int64  // 估计的不同值的个数
+	Min, Max string // 样本中的最小值和最大值, 没有样本或者加密字段时为空
+}
+
+type TableStats struct {
+	Table        string
+	Rows         int64 // 估计的行数
+	Pages        int64 // 表空间中的数据页数
+	SampledPages int64
+	SampledRows  int64
+	Columns      []ColumnStats
+	At           time.Time
+}
+
+// tableStats 表uid -> 最近一次ANALYZE的结果
+type tableStats struct {
+	lock  sync.RWMutex
+	stats map[int64]*TableStats
+}
+
+func newTableStats() *tableStats {
+	return &tableStats{stats: map[int64]*TableStats{}}
+}
+
+func (s *tableStats) get(tbUid int64) *TableStats {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.stats[tbUid]
+}
+
+func (s *tableStats) set(tbUid int64, stats *TableStats) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats[tbUid] = stats
+}
+
+// Analyze 在xid的快照中采样
+func (tm *TMImpl) Analyze(xid int64, analyze *Analyze) (*TableStats, error) {
+	percent := analyze.Percent
+	if percent == 0 {
+		percent = DefaultSamplePercent
+	}
+	uid, err := tm.getTbUid(xid, analyze.TbName)
+	if err != nil {
+		return nil, err
+	}
+	record := tm.vm.Read(xid, uid)
+	if record == nil {
+		return nil, &ErrorTableNotExist{}
+	}
+	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
+	if engine := tb.GetEngine(); engine != "" && engine != HeapEngine && engine != WalOnlyEngine {
+		return nil, &ErrorUnsupportedOperationType{}
+	}
+	codecs, err := columnsOf(tb)
+	if err != nil {
+		return nil, err
+	}
+	fields := tb.GetFields()
+	samples := make([]*columnSample, len(fields))
+	for i := range samples {
+		samples[i] = &columnSample{fType: fields[i].GetFType(), values: map[string]int64{}}
+	}
+	var sampledRows int64
+	sample, err := tm.vm.SampleRecords(xid, tb.GetSpace(), percent, simulation.Now().UnixNano(), func(uid int64, data []byte) {
+		// 旧版本没有标记的溢出段按行格式解析失败
+		row, err := decodeRow(uid, codecs, data)
+		if err != nil || row.GetRType() != RECORD {
+			return
+		}
+		sampledRows++
+		for i, value := range row.GetValues() {
+			samples[i].add(value)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := &TableStats{Table: analyze.TbName, Pages: sample.Pages, SampledPages: sample.Sampled, SampledRows: sampledRows, At: simulation.Now()}
+	if sample.Sampled > 0 {
+		stats.Rows = sampledRows * sample.Pages / sample.Sampled
+	}
+	for i, field := range fields {
+		column := ColumnStats{Field: field.GetName(), Distinct: samples[i].estimateDistinct(sampledRows, stats.Rows)}
+		if field.GetDataKey() == nil {
+			column.Min, column.Max = samples[i].min, samples[i].max
+		}
+		stats.Columns = append(stats.Columns, column)
+	}
+	tm.stats.set(uid, stats)
+	tm.rows.init(uid, stats.Rows)
+	tm.plans.invalidate(analyze.TbName)
+	log.Printf("[Table Manager] Analyze table %s, sample %d of %d pages, %d rows, estimate %d rows\n",
+		analyze.TbName, sample.Sampled, sample.Pages, sampledRows, stats.Rows)
+	return stats, nil
+}
+
+// columnSample 一个字段在样本中的取值
+type columnSample struct {
+	fType    FieldType
+	values   map[string]int64 // 取值 -> 出现次数
+	min, max string
+}
+
+func (c *columnSample) add(value any) {
+	key, err := fieldValueToString(c.fType, value)
+	if err != nil {
+		return
+	}
+	first := len(c.values) == 0
+	c.values[key]++
+	compare := DefaultFieldFactory.GetCompareFunction(c.fType)
+	if first || compare(key, c.min) < 0 {
+		c.min = key
+	}
+	if first || compare(key, c.max) > 0 {
+		c.max = key
+	}
+}
+
+// estimateDistinct
+// 由n行样本估计total行中不同值的个数(Haas-Stokes的Duj1估计): n*d / (n - f1 + f1*n/total)
+// d为样本中不同值的个数, f1为样本中只出现一次的值的个数; 结果在d与total之间
+func (c *columnSample) estimateDistinct(n, total int64) int64 {
+	d := int64(len(c.values))
+	if n == 0 || total <= n {
+		return d
+	}
+	var f1 int64
+	for _, count := range c.values {
+		if count == 1 {
+			f1++
+		}
+	}
+	estimate := int64(float64(n*d) / (float64(n-f1) + float64(f1)*float64(n)/float64(total)))
+	if estimate < d {
+		return d
+	}
+	if estimate > total {
+		return total
+	}
+	return estimate
+}
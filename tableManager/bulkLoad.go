@@ -0,0 +1,102 @@
+package tableManager
+
+// 批量导入
+// 一批行在同一个事物中插入, 只加一次表锁, 表的元数据(第一行的uid, 主键计数器)在最后更新一次
+// 支持BulkInserter的引擎直接构建数据页, 其他引擎逐行插入
+
+// BulkInserter 支持批量插入的引擎, rows中每一行的values[0]为已经分配的主键
+type BulkInserter interface {
+	InsertMany(xid int64, tb Table, rows [][]any) error
+}
+
+// BulkInsert
+// 向tbName插入一批行(字段值不包括主键), 返回插入的行数
+func (tm *TMImpl) BulkInsert(xid int64, tbName string, rows [][]string) (int, error) {
+	uid, err := tm.getTbUid(xid, tbName)
+	if err != nil {
+		return 0, err
+	}
+	tb, engine, err := tm.tableForInsert(xid, uid)
+	if err != nil {
+		return 0, err
+	}
+	bulk, ok := engine.(BulkInserter)
+	if !ok {
+		for i, row := range rows {
+			if _, err := tm.Insert(xid, &Insert{TbName: tbName, Values: row}); err != nil {
+				return i, err
+			}
+		}
+		return len(rows), nil
+	}
+	fields := tb.GetFields()
+	values := make([][]any, len(rows))
+	for i, row := range rows {
+		if len(row) != len(fields)-1 {
+			return 0, &ErrorInvalidFieldCount{}
+		}
+		values[i] = make([]any, len(fields))
+		values[i][0] = tb.GetPrimaryKey() + int64(i)
+		for j, value := range row {
+			if values[i][j+1], err = traverseStringToValue(fields[j+1].GetFType(), value); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := bulk.InsertMany(xid, tb, values); err != nil {
+		return 0, err
+	}
+	for _, row := range values {
+		tm.emitChange(xid, tb, nil, row)
+	}
+	tm.vm.AddRows(xid, 0, int64(len(rows)))
+	return len(rows), nil
+}
+
+// InsertMany
+// 行按顺序插入到链表头部, 一批行通过一次批量插入填满数据页(忽略填充因子)
+// 插入之后原地补写(Rewrite)同一批新插入的行之间的指针, 只有原来的第一行产生新版本
+func (h *heapEngine) InsertMany(xid int64, tb Table, rows [][]any) error {
+	first := tb.GetFirstRecordUid()
+	raws := make([][]byte, len(rows))
+	for i, values := range rows {
+		raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, int64(0), int64(0), values)
+		if err != nil {
+			return err
+		}
+		raws[i] = raw
+	}
+	uids, err := h.vm.InsertBatch(xid, raws, tb.GetUid(), tb.GetSpace())
+	if err != nil {
+		return err
+	}
+	for i, uid := range uids {
+		// 后插入的行位于链表的前面
+		prev, next := int64(0), first
+		if i+1 < len(uids) {
+			prev = uids[i+1]
+		}
+		if i > 0 {
+			next = uids[i-1]
+		}
+		if prev == 0 && next == 0 {
+			continue
+		}
+		raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, prev, next, rows[i])
+		if err != nil {
+			return err
+		}
+		if err := h.vm.Rewrite(xid, uid, tb.GetUid(), raw); err != nil {
+			return err
+		}
+	}
+	if len(uids) > 0 {
+		if first != 0 {
+			if err := h.setPrev(xid, tb, first, uids[0]); err != nil {
+				return err
+			}
+		}
+		first = uids[len(uids)-1]
+	}
+	return UpdateTableMeta(h.vm, xid, tb, first, tb.GetPrimaryKey()+int64(len(rows)))
+}
@@ -0,0 +1,108 @@
+package tableManager
+
+import (
+	"myDB/dbError"
+	"myDB/versionManager"
+)
+
+// 版本化的目录
+// 表的元数据是一条MVCC记录: 创建表的事物提交之前其他事物看不到这张表, 回滚之后任何事物都看不到
+// tables记录每个表名的所有版本(表元数据的uid, 按创建顺序), 按表名查找时返回对事物可见的最新版本
+// schema版本为表的字段列表(字段元数据的uid), 事物使用快照读到的schema版本:
+// DML当前读表的元数据(主键计数器, 行链表头)时, 字段与快照不同则返回ErrorSchemaChanged, 事物执行过程中不会看到新的schema
+// DDL在元数据表(MetaDataTbUid)上加锁直到事物结束, 同一时刻只有一个事物修改目录, 修改在提交时整体生效
+
+type ErrorSchemaChanged struct{}
+
+func (err *ErrorSchemaChanged) Error() string {
+	return "The table structure differs from the version visible to this transaction"
+}
+
+func (err *ErrorSchemaChanged) Is(target error) bool {
+	return target == dbError.ErrSerialization
+}
+
+// getTbUid 返回对xid可见的tbName的最新版本
+func (tm *TMImpl) getTbUid(xid int64, tbName string) (int64, error) {
+	tm.lock.RLock()
+	versions := append([]int64(nil), tm.tables[tbName]...)
+	tm.lock.RUnlock()
+	for i := len(versions) - 1; i >= 0; i-- {
+		if tm.vm.Read(xid, versions[i]) != nil {
+			return versions[i], nil
+		}
+	}
+	return -1, &ErrorTableNotExist{}
+}
+
+// lockCatalog
+// DDL之前调用, 在元数据表上加锁之后当前读tbName的所有版本
+// 已经提交(或者由xid创建)的版本存在时返回ErrorTableAlreadyExist, 回滚的版本从目录中删除
+func (tm *TMImpl) lockCatalog(xid int64, tbName string) error {
+	if err := tm.vm.LockTable(xid, versionManager.MetaDataTbUid); err != nil {
+		return err
+	}
+	tm.lock.RLock()
+	versions := append([]int64(nil), tm.tables[tbName]...)
+	tm.lock.RUnlock()
+	for _, uid := range versions {
+		record, err := tm.vm.ReadForUpdate(xid, uid, versionManager.MetaDataTbUid)
+		if err != nil {
+			return err
+		}
+		if record != nil {
+			return &ErrorTableAlreadyExist{}
+		}
+		tm.removeVersion(tbName, uid)
+	}
+	return nil
+}
+
+func (tm *TMImpl) removeVersion(tbName string, uid int64) {
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+	versions := tm.tables[tbName]
+	for i := range versions {
+		if versions[i] == uid {
+			tm.tables[tbName] = append(versions[:i:i], versions[i+1:]...)
+			break
+		}
+	}
+	if len(tm.tables[tbName]) == 0 {
+		delete(tm.tables, tbName)
+	}
+	delete(tm.tableUid, uid)
+}
+
+// lockTable 当前读表的元数据(获取表锁), 表的schema版本必须与xid快照读到的相同
+func (tm *TMImpl) lockTable(xid, uid int64) (Table, error) {
+	snapshot := tm.vm.Read(xid, uid)
+	if snapshot == nil {
+		return nil, &ErrorTableNotExist{}
+	}
+	record, err := tm.vm.ReadForUpdate(xid, uid, uid)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, &ErrorTableNotExist{}
+	}
+	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
+	if !sameSchema(tb, DefaultTableFactory.NewTable(uid, snapshot.GetData(), tm)) {
+		return nil, &ErrorSchemaChanged{}
+	}
+	return tb, nil
+}
+
+func sameSchema(a, b Table) bool {
+	fa, fb := a.GetFields(), b.GetFields()
+	if len(fa) != len(fb) {
+		return false
+	}
+	for i := range fa {
+		if fa[i].GetUid() != fb[i].GetUid() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package tableManager
+
+// 变更流(CDC)
+// 每一行被insert, update, delete(包括flashback的修改)之后, TM把这一行修改前后的值交给ChangeSink
+// 变更在事物中产生, 事物最终提交还是回滚由上层根据xid判断
+// sink在持有表锁时同步调用, 不能再访问TM; 值以字符串表示, 与select的结果相同
+
+type ChangeOp int
+
+const (
+	ChangeInsert ChangeOp = 1
+	ChangeUpdate ChangeOp = 2
+	ChangeDelete ChangeOp = 3
+)
+
+type Change struct {
+	Xid    int64
+	TbName string
+	Op     ChangeOp
+	Fields []Field
+	Old    []string // insert时为nil
+	New    []string // delete时为nil
+}
+
+type ChangeSink func(change *Change)
+
+// SetChangeSink sink为nil时关闭变更流
+func (tm *TMImpl) SetChangeSink(sink ChangeSink) {
+	if sink == nil {
+		tm.sink.Store(nil)
+		return
+	}
+	tm.sink.Store(&sink)
+}
+
+// emitChange old, values为nil分别表示插入和删除
+// 同时累计近似行数的增量(见rowCount.go)
+func (tm *TMImpl) emitChange(xid int64, tb Table, old, values []any) {
+	switch {
+	case old == nil:
+		tm.rows.record(xid, tb.GetUid(), 1)
+	case values == nil:
+		tm.rows.record(xid, tb.GetUid(), -1)
+	}
+	sink := tm.sink.Load()
+	if sink == nil {
+		return
+	}
+	change := &Change{Xid: xid, TbName: tb.GetName(), Fields: tb.GetFields(), Op: ChangeUpdate}
+	switch {
+	case old == nil:
+		change.Op = ChangeInsert
+	case values == nil:
+		change.Op = ChangeDelete
+	}
+	change.Old, change.New = changeValues(tb, old), changeValues(tb, values)
+	(*sink)(change)
+}
+
+func changeValues(tb Table, values []any) []string {
+	if values == nil {
+		return nil
+	}
+	ret := make([]string, len(values))
+	for i, field := range tb.GetFields() {
+		ret[i], _ = fieldValueToString(field.GetFType(), values[i])
+	}
+	return ret
+}
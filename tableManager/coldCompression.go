@@ -0,0 +1,90 @@
+package tableManager
+
+import (
+	"log"
+	"myDB/dataManager"
+	"myDB/simulation"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 按温度自动压缩
+// SetColdCompression(idle > 0)之后每隔idle检查一次所有表所在的表空间, 压缩idle时间内没有访问的区, 0表示停止
+// 区在最后一次访问之后idle到2 * idle之间被压缩, 再次访问时自动解压; 压缩文件以及解压见dataManager/extentCompression.go
+// 系统表空间中的表不压缩, 多个表共享的表空间只压缩一次
+
+type compressWorker struct {
+	lock    sync.Mutex
+	idle    time.Duration
+	stop    chan struct{}
+	running sync.WaitGroup // 后台协程退出, 见Close
+}
+
+// SetColdCompression 自动压缩的空闲时间, 0表示停止
+func (tm *TMImpl) SetColdCompression(idle time.Duration) {
+	w := tm.compress
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+	w.idle = idle
+	if idle <= 0 {
+		return
+	}
+	w.stop = make(chan struct{})
+	w.running.Add(1)
+	go func(stop chan struct{}) {
+		defer w.running.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-simulation.After(idle):
+				tm.compressAll(idle, stop)
+			}
+		}
+	}(w.stop)
+}
+
+// compressAll 依次压缩所有表所在的表空间, stop关闭时停止
+func (tm *TMImpl) compressAll(idle time.Duration, stop chan struct{}) {
+	tm.lock.RLock()
+	uids := make([]int64, 0, len(tm.tableUid))
+	for uid := range tm.tableUid {
+		uids = append(uids, uid)
+	}
+	tm.lock.RUnlock()
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	spaces := map[int64]struct{}{}
+	xid := tm.vm.Begin()
+	for _, uid := range uids {
+		if record := tm.vm.Read(xid, uid); record != nil {
+			spaces[DefaultTableFactory.NewTable(uid, record.GetData(), tm).GetSpace()] = struct{}{}
+		}
+	}
+	tm.vm.Commit(xid)
+	var compressed, stored int64
+	for space := range spaces {
+		if space == dataManager.SystemSpace {
+			continue
+		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		stats, err := tm.vm.CompressCold(space, idle)
+		if err != nil {
+			log.Printf("[Table Manager] Skip compressing table space %d: %s\n", space, err)
+			continue
+		}
+		compressed += stats.Compressed
+		stored += stats.Stored
+	}
+	if compressed > 0 {
+		log.Printf("[Table Manager] Background compression compresses %d extents, %d bytes stored compressed\n", compressed, stored)
+	}
+}
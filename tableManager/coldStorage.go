@@ -0,0 +1,35 @@
+package tableManager
+
+import (
+	"myDB/dataManager"
+	"time"
+)
+
+// 冷数据分层存储
+// 将表所在的表空间中长时间没有访问的区迁移到二级目录, 页表以及读写见dataManager/coldStorage.go
+// 系统表空间中的表(以及系统表)不能迁移
+
+type ErrorNotOffloadable struct{}
+
+func (err *ErrorNotOffloadable) Error() string {
+	return "Tables in the system table space can't be offloaded"
+}
+
+// OffloadCold 快照读出表所在的表空间, 不持有表锁, 迁移期间该表空间的页读写等待
+func (tm *TMImpl) OffloadCold(tbName, dir string, idle time.Duration) (dataManager.TierStats, error) {
+	xid := tm.vm.Begin()
+	defer tm.vm.Commit(xid)
+	uid, err := tm.getTbUid(xid, tbName)
+	if err != nil {
+		return dataManager.TierStats{}, err
+	}
+	record := tm.vm.Read(xid, uid)
+	if record == nil {
+		return dataManager.TierStats{}, &ErrorTableNotExist{}
+	}
+	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
+	if tb.GetSpace() == dataManager.SystemSpace {
+		return dataManager.TierStats{}, &ErrorNotOffloadable{}
+	}
+	return tm.vm.OffloadCold(tb.GetSpace(), dir, idle)
+}
@@ -0,0 +1,90 @@
+package tableManager
+
+import (
+	"myDB/versionManager"
+)
+
+// 游标
+// 声明时创建读视图并读出表的元数据, 之后每次Fetch沿行链表从上次停下的位置继续读取, 只在内存中保存下一行的uid
+// 结果与声明时执行一次select相同(见VersionManager的ReadWithView), 服务端不物化整个结果集
+// 只支持快照读, 不支持当前读, 时间旅行查询以及并行扫描; 引擎需要实现CursorScanner
+// 游标属于声明它的事物, 事物结束之后不能再使用
+
+type ErrorCursorUnsupported struct{}
+
+func (err *ErrorCursorUnsupported) Error() string {
+	return "Cursor is not supported by this query or storage engine"
+}
+
+// CursorScanner 支持游标的引擎
+type CursorScanner interface {
+	// ScanFrom 使用读视图rv从uid开始沿行链表快照读出最多n行, 返回读出的行以及下一行的uid(0表示结束)
+	ScanFrom(xid int64, tb Table, rv *versionManager.ReadView, uid int64, n int) ([]Row, int64, error)
+}
+
+// Cursor 游标的扫描状态, 同一时刻只能被一个Fetch使用
+type Cursor struct {
+	xid     int64
+	tb      Table
+	scanner CursorScanner
+	plan    *vectorPlan
+	rv      *versionManager.ReadView
+	fNames  []string
+	next    int64 // 下一行的uid, 0表示已经读完
+}
+
+// OpenCursor
+// 在xid事物中为快照读sel声明游标
+func (tm *TMImpl) OpenCursor(xid int64, sel *Select) (*Cursor, error) {
+	if sel.ReadForUpdate || !sel.AsOf.IsZero() {
+		return nil, &ErrorCursorUnsupported{}
+	}
+	uid, err := tm.getTbUid(xid, sel.TbName)
+	if err != nil {
+		return nil, err
+	}
+	rv := tm.vm.CreateReadView(xid)
+	record := tm.vm.ReadWithView(xid, uid, rv)
+	if record == nil {
+		return nil, &ErrorTableNotExist{}
+	}
+	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
+	engine, err := tm.engineOf(tb)
+	if err != nil {
+		return nil, err
+	}
+	scanner, ok := engine.(CursorScanner)
+	if !ok {
+		return nil, &ErrorCursorUnsupported{}
+	}
+	plan, err := tm.compilePlan(tb, sel)
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor{xid: xid, tb: tb, scanner: scanner, plan: plan, rv: rv, fNames: sel.FNames, next: tb.GetFirstRecordUid()}, nil
+}
+
+// Fetch
+// 读出游标之后最多n行匹配where条件的行, 读完之后只返回标题
+func (tm *TMImpl) Fetch(xid int64, cursor *Cursor, n int) ([]*ResponseObject, error) {
+	if cursor.xid != xid {
+		return nil, &ErrorCursorUnsupported{}
+	}
+	values := make([][]string, 0)
+	for cursor.next != 0 && len(values) < n {
+		rows, next, err := cursor.scanner.ScanFrom(xid, cursor.tb, cursor.rv, cursor.next, n-len(values))
+		if err != nil {
+			return nil, err
+		}
+		tm.vm.AddRows(xid, int64(len(rows)), 0)
+		values = append(values, cursor.plan.execute(rows)...)
+		cursor.next = next
+	}
+	response := tm.wrapTableResponseTitle(cursor.fNames)
+	for i, row := range values {
+		for j, value := range row {
+			response = append(response, &ResponseObject{Payload: value, RowId: i + 1, ColId: j})
+		}
+	}
+	return response, nil
+}
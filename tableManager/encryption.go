@@ -0,0 +1,236 @@
+package tableManager
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+)
+
+// 列级加密
+// 建表时标记为encrypted的字段, 值在行编解码时使用AES-256-GCM加密, 数据文件, redo日志以及导出的表空间中都不包含明文
+// 加密字段的值存储为 [length]8[nonce|ciphertext], 明文为字段值的普通编码
+// 表uid, 字段名以及行的主键(第一个字段ID的编码)作为附加数据参与认证, 密文换到其他行, 其他字段或者其他表时解密失败;
+// 挂载(Attach)时表uid改变, 按导出时记录的表uid解密之后重新加密
+// 每张表生成一个随机的数据密钥, 数据密钥被主密钥加密(wrap)之后保存在该表每个加密字段的元数据中, 导出时随元数据一起导出
+// 主密钥不落盘, 由上层在打开TableManager时通过WithMasterKey传入, 每个TableManager一份; 主密钥不合法时OpenTableManager返回ErrorInvalidMasterKey;
+// 没有主密钥时不能创建加密字段, 读写加密字段时返回(或panic)ErrorNoMasterKey
+// 更换主密钥需要重新wrap所有数据密钥, 尚未实现
+
+const (
+	SzDataKey   = 32 // AES-256
+	SzMasterKey = 32
+)
+
+type ErrorNoMasterKey struct{}
+type ErrorInvalidMasterKey struct{}
+type ErrorDecryptField struct{}
+
+func (err *ErrorNoMasterKey) Error() string {
+	return "Master key is not set, encrypted fields are unavailable"
+}
+
+func (err *ErrorInvalidMasterKey) Error() string {
+	return "Master key must be 32 bytes"
+}
+
+func (err *ErrorDecryptField) Error() string {
+	return "Failed to decrypt field, the master key or data is wrong"
+}
+
+type keyring struct {
+	lock   sync.RWMutex
+	master cipher.AEAD
+	keys   map[string]cipher.AEAD // wrapped data key -> 数据密钥
+}
+
+func newKeyring() *keyring {
+	return &keyring{keys: map[string]cipher.AEAD{}}
+}
+
+// WithMasterKey 列级加密的主密钥, 在OpenTableManager中校验
+func WithMasterKey(key []byte) Option {
+	return func(tm *TMImpl) {
+		tm.masterKey = key
+	}
+}
+
+// openKeyring 设置WithMasterKey传入的主密钥, 之后不再保留原始的主密钥
+func (tm *TMImpl) openKeyring() error {
+	if tm.masterKey == nil {
+		return nil
+	}
+	defer func() { tm.masterKey = nil }()
+	return tm.ring.setMaster(tm.masterKey)
+}
+
+func (tm *TMImpl) keys() *keyring {
+	return tm.ring
+}
+
+// setMaster 设置主密钥, 更换主密钥之后已缓存的数据密钥失效
+func (ring *keyring) setMaster(key []byte) error {
+	if len(key) != SzMasterKey {
+		return &ErrorInvalidMasterKey{}
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	ring.master = aead
+	ring.keys = map[string]cipher.AEAD{}
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newDataKey 生成数据密钥并返回被主密钥加密之后的结果
+func (ring *keyring) newDataKey() ([]byte, error) {
+	ring.lock.RLock()
+	master := ring.master
+	ring.lock.RUnlock()
+	if master == nil {
+		return nil, &ErrorNoMasterKey{}
+	}
+	key := make([]byte, SzDataKey)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return seal(master, key, nil)
+}
+
+// dataCipher 解开被主密钥加密的数据密钥
+func (ring *keyring) dataCipher(wrapped []byte) (cipher.AEAD, error) {
+	ring.lock.RLock()
+	aead, master := ring.keys[string(wrapped)], ring.master
+	ring.lock.RUnlock()
+	if aead != nil {
+		return aead, nil
+	}
+	if master == nil {
+		return nil, &ErrorNoMasterKey{}
+	}
+	key, err := open(master, wrapped, nil)
+	if err != nil {
+		return nil, err
+	}
+	if aead, err = newAEAD(key); err != nil {
+		return nil, err
+	}
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	if ring.master == master {
+		ring.keys[string(wrapped)] = aead
+	}
+	return aead, nil
+}
+
+// seal 返回 [nonce|ciphertext]
+func seal(aead cipher.AEAD, plain, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, &ErrorDecryptField{}
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, &ErrorDecryptField{}
+	}
+	return plain, nil
+}
+
+// columnCodec 行编解码时一个字段的编码方式, aead不为nil时该字段加密
+type columnCodec struct {
+	fType FieldType
+	aead  cipher.AEAD
+	scope []byte // 附加数据中行的主键之前的部分 [tbUid]8[nameLength]8[name]
+}
+
+// aad 加密字段的附加数据, rowKey为行的第一个字段(主键)的编码
+func (c columnCodec) aad(rowKey []byte) []byte {
+	aad := make([]byte, 0, len(c.scope)+len(rowKey))
+	return append(append(aad, c.scope...), rowKey...)
+}
+
+func plainColumns(fTypes []FieldType) []columnCodec {
+	columns := make([]columnCodec, len(fTypes))
+	for i, fType := range fTypes {
+		columns[i] = columnCodec{fType: fType}
+	}
+	return columns
+}
+
+func columnsOf(tb Table) ([]columnCodec, error) {
+	return columnsAs(tb, tb.GetUid())
+}
+
+// columnsAs 按表uid为tbUid时的附加数据解密, 用于挂载导出的表
+func columnsAs(tb Table, tbUid int64) ([]columnCodec, error) {
+	ring := tb.(*TableImpl).tm.keys()
+	fields := tb.GetFields()
+	columns := make([]columnCodec, len(fields))
+	for i, field := range fields {
+		columns[i].fType = field.GetFType()
+		if key := field.GetDataKey(); key != nil {
+			aead, err := ring.dataCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			columns[i].aead = aead
+			scope := bytes.NewBuffer(make([]byte, 0, 16+len(field.GetName())))
+			_ = binary.Write(scope, binary.BigEndian, tbUid)
+			_ = binary.Write(scope, binary.BigEndian, int64(len(field.GetName())))
+			scope.WriteString(field.GetName())
+			columns[i].scope = scope.Bytes()
+		}
+	}
+	return columns, nil
+}
+
+// encryptValue 加密之后的存储格式 [length]8[nonce|ciphertext]
+func encryptValue(c columnCodec, rowKey []byte, value any) ([]byte, error) {
+	plain, err := fieldValueToBytes(c.fType, value)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(c.aead, plain, c.aad(rowKey))
+	if err != nil {
+		return nil, err
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, SzVariableLength+int64(len(sealed))))
+	_ = binary.Write(buffer, binary.BigEndian, int64(len(sealed)))
+	buffer.Write(sealed)
+	return buffer.Bytes(), nil
+}
+
+func decryptValue(c columnCodec, rowKey, sealed []byte) (any, error) {
+	plain, err := open(c.aead, sealed, c.aad(rowKey))
+	if err != nil {
+		return nil, err
+	}
+	if length := FTypeLength[c.fType]; length == VARIABLE {
+		if int64(len(plain)) < SzVariableLength {
+			return nil, &ErrorMalformedRecord{}
+		}
+		plain = plain[SzVariableLength:]
+	} else if int64(len(plain)) != length {
+		return nil, &ErrorMalformedRecord{}
+	}
+	return getFTypeValue(c.fType, plain)
+}
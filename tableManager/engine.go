@@ -0,0 +1,85 @@
+package tableManager
+
+import (
+	"myDB/versionManager"
+)
+
+// TableEngine 表级存储引擎
+// 决定一张表的行如何组织(堆表链表, LSM...)
+// 事物(锁, MVCC, 日志)由VersionManager提供, SQL层与所有引擎共享
+// 除Open之外, 调用方已经持有表锁(当前读表的元数据)
+// 遇到error时上层必须回滚事物
+type TableEngine interface {
+	Name() string
+	Open(tb Table) error // 数据库启动或创建表时打开表
+	// Insert 插入一行, values[0]为主键(tb.GetPrimaryKey())
+	// 引擎需要将表的主键计数器持久化为tb.GetPrimaryKey()+1(UpdateTableMeta)
+	Insert(xid int64, tb Table, values []any) (int64, error)
+	ReadByKey(xid int64, tb Table, key int64) (Row, error)                    // 按主键快照读, 不存在时返回nil, nil
+	Scan(xid int64, tb Table, forUpdate bool, maxMemory int64) ([]Row, error) // 全表扫描, 超过maxMemory(> 0)时返回ErrorOutOfQueryMemory
+	Update(xid int64, tb Table, row Row, values []any) error                  // 将Scan得到的row修改为values
+	Delete(xid int64, tb Table, row Row) error                                // 删除Scan得到的row
+	CreateIndex(xid int64, tb Table, field Field) error
+}
+
+// RowMigrator 支持在线迁移行的引擎(碎片整理)
+type RowMigrator interface {
+	// Migrate 将uid处的行迁移到同一表空间的其他页并改写指向它的引用, 返回新的uid; 行已经失效时返回0
+	Migrate(xid int64, tb Table, uid int64) (int64, error)
+}
+
+// EngineFactory 引擎在打开数据库时创建, 与TableManager共享VersionManager
+type EngineFactory func(vm versionManager.VersionManager) TableEngine
+
+const HeapEngine string = "heap" // 默认引擎
+
+// engineFactories 必须在打开数据库之前注册(init)
+var engineFactories = map[string]EngineFactory{
+	HeapEngine:    NewHeapEngine,
+	WalOnlyEngine: NewWalOnlyEngine,
+}
+
+type ErrorEngineNotExist struct{}
+
+func (err *ErrorEngineNotExist) Error() string {
+	return "Storage engine doesn't exist"
+}
+
+// RegisterEngine 注册一个表级存储引擎, 同名的引擎会被覆盖
+func RegisterEngine(name string, factory EngineFactory) {
+	engineFactories[name] = factory
+}
+
+// UpdateTableMeta
+// 修改表的第一条记录以及主键计数器, 其他元数据不变
+// 表的元数据长度不变, 一定原地更新
+func UpdateTableMeta(vm versionManager.VersionManager, xid int64, tb Table, firstRecordUid, primaryKey int64) error {
+	raw := DefaultTableFactory.WrapTableRaw(tb.GetName(), tb.GetNextUid(), tb.GetFields(), firstRecordUid, primaryKey, tb.GetSpace(), tb.GetEngine())
+	newUid, err := vm.Update(xid, tb.GetUid(), tb.GetUid(), raw)
+	if err != nil {
+		return err
+	}
+	if newUid != tb.GetUid() {
+		panic("Fatal Error occurs when updating table metadata raw")
+	}
+	return nil
+}
+
+// engineOf 表使用的引擎, 旧版本创建的表使用默认引擎
+func (tm *TMImpl) engineOf(tb Table) (TableEngine, error) {
+	name := tb.GetEngine()
+	if name == "" {
+		name = HeapEngine
+	}
+	if engine, ext := tm.engines[name]; ext {
+		return engine, nil
+	}
+	return nil, &ErrorEngineNotExist{}
+}
+
+func (tm *TMImpl) openEngines() {
+	tm.engines = make(map[string]TableEngine, len(engineFactories))
+	for name, factory := range engineFactories {
+		tm.engines[name] = factory(tm.vm)
+	}
+}
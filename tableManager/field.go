@@ -47,6 +47,9 @@ func init() {
 			return -1
 		}
 	}
+	m[JSON] = func(a any, b any) int {
+		return compareJsonValue(a.(string), b.(string))
+	}
 	DefaultFieldFactory = &FieldImplFactory{
 		compareFunctionMap: m,
 	}
@@ -54,6 +57,7 @@ func init() {
 	FTypeLength[INT32] = 4
 	FTypeLength[INT64] = 8
 	FTypeLength[STRING] = VARIABLE // 变长字段
+	FTypeLength[JSON] = VARIABLE
 }
 
 type Field interface {
@@ -62,14 +66,16 @@ type Field interface {
 	GetName() string
 	SetTable(tb Table)
 	IsIndexed() bool
+	GetDataKey() []byte // 加密字段被主密钥加密的数据密钥, 不加密时为nil
 }
 
 // FieldImpl
-// [FieldMask]4[FieldName][TypeName]8[IndexUid]8
+// [FieldMask]4[FieldName][TypeName]8[IndexUid]8([DataKeyLength]8[DataKey])
 // [FieldName] -> [StringLength]8[StringData]...
 // IndexUid 索引根结点
 // Field的raw和table信息无关
 // 如果这个字段没有建立索引，则indexUid = 0
+// 加密字段在末尾追加被主密钥加密的数据密钥, 不加密的字段没有这一部分
 
 type FieldType int64
 
@@ -83,6 +89,7 @@ const (
 	INT32     FieldType = 1 // [4 Bytes]
 	INT64     FieldType = 2 // [8 Bytes]
 	STRING    FieldType = 3 // [StringLength]8[StringData]
+	JSON      FieldType = 4 // [Length]8[JsonData] 压缩后的JSON文本
 )
 
 type FieldImpl struct {
@@ -92,6 +99,7 @@ type FieldImpl struct {
 	fieldType FieldType
 	indexUid  int64
 	index     indexManager.Index
+	dataKey   []byte
 }
 
 func (f *FieldImpl) GetUid() int64 {
@@ -114,6 +122,10 @@ func (f *FieldImpl) IsIndexed() bool {
 	return f.indexUid != 0
 }
 
+func (f *FieldImpl) GetDataKey() []byte {
+	return f.dataKey
+}
+
 const (
 	SzFieldType      int64 = 8
 	SzVariableLength int64 = 8
@@ -122,7 +134,7 @@ const (
 
 type FieldFactory interface {
 	NewField(tb Table, uid int64, raw []byte, im indexManager.IndexManager) Field
-	WrapFieldRaw(fName string, fType FieldType, indexUid int64) []byte
+	WrapFieldRaw(fName string, fType FieldType, indexUid int64, dataKey []byte) []byte
 	GetCompareFunction(fType FieldType) func(any, any) int
 }
 
@@ -155,6 +167,11 @@ func (f *FieldImplFactory) NewField(tb Table, uid int64, raw []byte, im indexMan
 	fieldType := FieldType(binary.BigEndian.
 		Uint64(raw[SzVariableLength+fieldNameLength : SzVariableLength+fieldNameLength+SzFieldType]))
 	indexUid := int64(binary.BigEndian.Uint64(raw[SzVariableLength+fieldNameLength+SzFieldType:]))
+	var dataKey []byte
+	if rest := raw[SzVariableLength+fieldNameLength+SzFieldType+SzIndexUid:]; int64(len(rest)) >= SzVariableLength {
+		keyLength := int64(binary.BigEndian.Uint64(rest[:SzVariableLength]))
+		dataKey = rest[SzVariableLength : SzVariableLength+keyLength]
+	}
 	var index indexManager.Index
 	if indexUid != 0 {
 		index = im.LoadIndex(indexUid)
@@ -166,6 +183,7 @@ func (f *FieldImplFactory) NewField(tb Table, uid int64, raw []byte, im indexMan
 		fieldType: fieldType,
 		indexUid:  indexUid,
 		index:     index,
+		dataKey:   dataKey,
 	}
 }
 
@@ -177,13 +195,17 @@ var DefaultFieldFactory FieldFactory
 
 // utils
 
-func (f *FieldImplFactory) WrapFieldRaw(fName string, fType FieldType, indexUid int64) []byte {
+func (f *FieldImplFactory) WrapFieldRaw(fName string, fType FieldType, indexUid int64, dataKey []byte) []byte {
 	buffer := bytes.NewBuffer([]byte{})
 	_ = binary.Write(buffer, binary.BigEndian, FieldMask)
 	_ = binary.Write(buffer, binary.BigEndian, int64(len(fName)))
 	_ = binary.Write(buffer, binary.BigEndian, []byte(fName))
 	_ = binary.Write(buffer, binary.BigEndian, int64(fType))
 	_ = binary.Write(buffer, binary.BigEndian, indexUid)
+	if dataKey != nil {
+		_ = binary.Write(buffer, binary.BigEndian, int64(len(dataKey)))
+		_ = binary.Write(buffer, binary.BigEndian, dataKey)
+	}
 	log.Printf("[FIELD LINE 182] WRAP FIELD: %s\n", string(buffer.Bytes()))
 	return buffer.Bytes()
 }
@@ -203,6 +225,8 @@ func TransToFieldType(typeStr string) (FieldType, error) {
 		return INT64, nil
 	case "STRING":
 		return STRING, nil
+	case "JSON":
+		return JSON, nil
 	default:
 		return INVALID, &ErrorInvalidFType{}
 	}
@@ -235,7 +259,7 @@ func getFTypeValue(fType FieldType, raw []byte) (any, error) {
 		{
 			return int64(binary.BigEndian.Uint64(raw)), nil
 		}
-	case STRING:
+	case STRING, JSON:
 		{
 			return string(raw), nil
 		}
@@ -269,7 +293,7 @@ func fieldValueToBytes(fType FieldType, value any) ([]byte, error) {
 				_ = binary.Write(buffer, binary.BigEndian, v)
 			}
 		}
-	case STRING:
+	case STRING, JSON:
 		{
 			if s, available := value.(string); !available {
 				return nil, &ErrorValueNotMatch{}
@@ -300,7 +324,7 @@ func fieldValueToString(fType FieldType, value any) (string, error) {
 				return strconv.FormatInt(v, 10), nil
 			}
 		}
-	case STRING:
+	case STRING, JSON:
 		{
 			if s, available := value.(string); !available {
 				return "", &ErrorValueNotMatch{}
@@ -334,6 +358,10 @@ func traverseStringToValue(fType FieldType, value string) (any, error) {
 		{
 			return value, nil
 		}
+	case JSON:
+		{
+			return compactJson(value)
+		}
 	}
 	return nil, &ErrorFTypeInvalid{}
 }
@@ -0,0 +1,132 @@
+package tableManager
+
+import (
+	"time"
+)
+
+// 闪回
+// 将表(或者满足where条件的行)恢复到过去某个时刻的状态, 不需要整库的时间点恢复
+// 过去时刻的数据通过时间旅行查询(AS OF)沿undo log中的版本链读出, 只能恢复保留时间之内的时刻
+// 以主键识别行, 对满足where条件(过去或者现在满足)的每一行:
+// 过去存在而现在不存在 -> 以原来的主键重新插入; 现在存在而过去不存在 -> 删除; 值不同 -> 修改为过去的值
+// 所有修改在xid中执行, 与普通的DML相同, 提交之后生效
+
+type Flashback struct {
+	TbName string
+	AsOf   time.Time
+	Where  *Where // nil则恢复整张表
+}
+
+// Flashback
+// 持有表锁, 上层必须确保在遇到error时回滚
+func (tm *TMImpl) Flashback(xid int64, flashback *Flashback) error {
+	uid, err := tm.getTbUid(xid, flashback.TbName)
+	if err != nil {
+		return err
+	}
+	tb, err := tm.lockTable(xid, uid)
+	if err != nil {
+		return err
+	}
+	engine, err := tm.engineOf(tb)
+	if err != nil {
+		return err
+	}
+	if err := tm.checkWhereCondition(tb, flashback.Where); err != nil {
+		return err
+	}
+	past, err := tm.readAsOf(xid, tb, engine, flashback.AsOf)
+	if err != nil {
+		return err
+	}
+	current, err := engine.Scan(xid, tb, true, 0)
+	if err != nil {
+		return err
+	}
+	// 需要恢复的主键, 按过去, 现在的顺序
+	pastRows, currentRows := rowsByKey(past), rowsByKey(current)
+	keys := make([]int64, 0)
+	selected := map[int64]struct{}{}
+	for _, rows := range [][]Row{past, current} {
+		for _, row := range rows {
+			key := row.GetValues()[0].(int64)
+			if _, ext := selected[key]; !ext && matchWhereCondition(row, tb, flashback.Where) {
+				selected[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+	var written int64 = 0
+	for _, key := range keys {
+		pastRow, currentRow := pastRows[key], currentRows[key]
+		if pastRow != nil && currentRow != nil && sameValues(pastRow.GetValues(), currentRow.GetValues()) {
+			continue
+		}
+		// 每次修改之后表的元数据(第一条记录, 主键计数器)可能变化, 重新当前读
+		if tb, err = tm.lockTable(xid, uid); err != nil {
+			return err
+		}
+		var old, values []any
+		switch {
+		case currentRow == nil:
+			values = pastRow.GetValues()
+			_, err = engine.Insert(xid, tb, values)
+		case pastRow == nil:
+			old = currentRow.GetValues()
+			err = engine.Delete(xid, tb, currentRow)
+		default:
+			old, values = currentRow.GetValues(), pastRow.GetValues()
+			err = engine.Update(xid, tb, currentRow, values)
+		}
+		if err != nil {
+			return err
+		}
+		tm.emitChange(xid, tb, old, values)
+		written += 1
+	}
+	tm.vm.AddRows(xid, int64(len(past)+len(current)), written)
+	return nil
+}
+
+// readAsOf 读出表在at时刻的所有行, 表的字段必须与当前相同
+func (tm *TMImpl) readAsOf(xid int64, tb Table, engine TableEngine, at time.Time) ([]Row, error) {
+	if err := tm.vm.BeginAsOf(xid, at); err != nil {
+		return nil, err
+	}
+	defer tm.vm.EndAsOf(xid)
+	record := tm.vm.Read(xid, tb.GetUid())
+	if record == nil {
+		return nil, &ErrorTableNotExist{}
+	}
+	pastTb := DefaultTableFactory.NewTable(tb.GetUid(), record.GetData(), tm)
+	fields, pastFields := tb.GetFields(), pastTb.GetFields()
+	if len(fields) != len(pastFields) {
+		return nil, &ErrorSchemaChanged{}
+	}
+	for i := range fields {
+		if fields[i].GetName() != pastFields[i].GetName() || fields[i].GetFType() != pastFields[i].GetFType() {
+			return nil, &ErrorSchemaChanged{}
+		}
+	}
+	return engine.Scan(xid, pastTb, false, 0)
+}
+
+func rowsByKey(rows []Row) map[int64]Row {
+	ret := make(map[int64]Row, len(rows))
+	for _, row := range rows {
+		ret[row.GetValues()[0].(int64)] = row
+	}
+	return ret
+}
+
+func sameValues(a, b []any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
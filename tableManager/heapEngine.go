@@ -0,0 +1,277 @@
+package tableManager
+
+import (
+	"myDB/dataManager"
+	"myDB/versionManager"
+)
+
+// heapEngine 默认引擎
+// 表的所有行组织成双向链表, 表的元数据中记录第一行的uid, 新插入的行位于链表头部
+// 行修改后长度增加时会被迁移到新的位置, 需要改写相邻行(或表的元数据)的指针
+// 主键 -> uid的目录用于主键点查, 见pointLookup.go
+
+type heapEngine struct {
+	vm   versionManager.VersionManager
+	keys *keyDirectory
+}
+
+// NewHeapEngine 其他引擎可以在默认引擎的基础上扩展
+func NewHeapEngine(vm versionManager.VersionManager) TableEngine {
+	return &heapEngine{vm: vm, keys: newKeyDirectory()}
+}
+
+func (h *heapEngine) Name() string {
+	return HeapEngine
+}
+
+func (h *heapEngine) Open(tb Table) error {
+	return nil
+}
+
+func (h *heapEngine) Insert(xid int64, tb Table, values []any) (int64, error) {
+	raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, int64(0), tb.GetFirstRecordUid(), values)
+	if err != nil {
+		return -1, err
+	}
+	uid, err := h.vm.InsertIn(xid, raw, tb.GetUid(), tb.GetSpace())
+	if err != nil {
+		return -1, err
+	}
+	if tb.GetFirstRecordUid() != 0 {
+		if err := h.setPrev(xid, tb, tb.GetFirstRecordUid(), uid); err != nil {
+			return -1, err
+		}
+	}
+	// 当前事物一定已经获取表锁, 这个Update和上面的Insert一定是原子的
+	if err := UpdateTableMeta(h.vm, xid, tb, uid, tb.GetPrimaryKey()+1); err != nil {
+		return -1, err
+	}
+	h.keys.put(tb.GetUid(), values[0].(int64), uid)
+	return uid, nil
+}
+
+// ReadByKey
+// 先快照读目录中记录的uid, 不可见或者主键不一致时扫描全表并重建目录
+func (h *heapEngine) ReadByKey(xid int64, tb Table, key int64) (Row, error) {
+	if uid, ext := h.keys.get(tb.GetUid(), key); ext {
+		// 删除的行快照读到失效的版本
+		if record := h.vm.Read(xid, uid); record != nil && record.IsValid() {
+			if row := DefaultRowFactory.NewRow(uid, tb, record.GetData()); row.GetValues()[0] == key {
+				return row, nil
+			}
+		}
+	}
+	rows, err := h.Scan(xid, tb, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	h.keys.fill(tb.GetUid(), rows)
+	for _, row := range rows {
+		if row.GetValues()[0] == key {
+			return row, nil
+		}
+	}
+	return nil, nil
+}
+
+// Scan
+// 快照读时使用零拷贝读, 行在NewRow中解析(拷贝)为values, 之后不再引用页
+func (h *heapEngine) Scan(xid int64, tb Table, forUpdate bool, maxMemory int64) ([]Row, error) {
+	uid := tb.GetFirstRecordUid()
+	var ret []Row
+	var memory int64 = 0
+	var guard dataManager.ReadGuard
+	if !forUpdate {
+		guard = h.vm.NewReadGuard()
+		defer guard.Done()
+	}
+	for uid != 0 {
+		if err := h.vm.CheckStatement(xid); err != nil {
+			return nil, err
+		}
+		var record versionManager.Record
+		if forUpdate {
+			rc, err := h.vm.ReadForUpdate(xid, uid, tb.GetUid())
+			if err != nil {
+				return nil, err
+			}
+			record = rc
+		} else {
+			record = h.vm.ReadIn(xid, uid, guard)
+		}
+		if memory += int64(len(record.GetData())); maxMemory > 0 && memory > maxMemory {
+			return nil, &ErrorOutOfQueryMemory{}
+		}
+		row := DefaultRowFactory.NewRow(uid, tb, record.GetData())
+		ret = append(ret, row)
+		uid = row.GetNextUid()
+	}
+	return ret, nil
+}
+
+// ScanChunks
+// 沿行链表快照读出每一行的数据, 相邻的行位于不超过ScanChunkPages个页时属于同一个块
+func (h *heapEngine) ScanChunks(xid int64, tb Table, maxMemory int64, chunks chan<- *ScanChunk) error {
+	uid := tb.GetFirstRecordUid()
+	var memory int64 = 0
+	chunk := &ScanChunk{}
+	pages, lastPage := 0, int64(-1)
+	for uid != 0 {
+		if err := h.vm.CheckStatement(xid); err != nil {
+			return err
+		}
+		data := h.vm.Read(xid, uid).GetData()
+		if memory += int64(len(data)); maxMemory > 0 && memory > maxMemory {
+			return &ErrorOutOfQueryMemory{}
+		}
+		if page := dataManager.PageOf(uid); page != lastPage {
+			if pages == ScanChunkPages {
+				chunks <- chunk
+				chunk = &ScanChunk{Index: chunk.Index + 1}
+				pages = 0
+			}
+			pages, lastPage = pages+1, page
+		}
+		chunk.Uids = append(chunk.Uids, uid)
+		chunk.Raws = append(chunk.Raws, data)
+		uid = nextUidOf(data)
+	}
+	if len(chunk.Uids) > 0 {
+		chunks <- chunk
+	}
+	return nil
+}
+
+// ScanFrom
+// 使用游标的读视图沿行链表读出最多n行, 旧版本中的指针仍然指向读视图中的下一行
+func (h *heapEngine) ScanFrom(xid int64, tb Table, rv *versionManager.ReadView, uid int64, n int) ([]Row, int64, error) {
+	rows := make([]Row, 0, n)
+	for uid != 0 && len(rows) < n {
+		record := h.vm.ReadWithView(xid, uid, rv)
+		if record == nil {
+			return rows, 0, nil
+		}
+		row := DefaultRowFactory.NewRow(uid, tb, record.GetData())
+		rows = append(rows, row)
+		uid = row.GetNextUid()
+	}
+	return rows, uid, nil
+}
+
+// Update
+// 重新读出row, 之前的修改可能已经改写了它的指针
+func (h *heapEngine) Update(xid int64, tb Table, row Row, values []any) error {
+	current, err := h.readRow(xid, tb, row.GetUid())
+	if err != nil {
+		return err
+	}
+	raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, current.GetPrevUid(), current.GetNextUid(), values)
+	if err != nil {
+		return err
+	}
+	newUid, err := h.vm.Update(xid, current.GetUid(), tb.GetUid(), raw)
+	if err != nil {
+		return err
+	}
+	if newUid == current.GetUid() {
+		return nil
+	}
+	h.keys.put(tb.GetUid(), values[0].(int64), newUid)
+	return h.relink(xid, tb, current, newUid)
+}
+
+// Migrate
+// 在线迁移: 行原样迁移到同一表空间的其他页, 行已经失效(被删除或者迁移)时返回0
+func (h *heapEngine) Migrate(xid int64, tb Table, uid int64) (int64, error) {
+	record, err := h.vm.ReadForUpdate(xid, uid, tb.GetUid())
+	if err != nil || record == nil {
+		return 0, err
+	}
+	current := DefaultRowFactory.NewRow(uid, tb, record.GetData())
+	newUid, err := h.vm.Relocate(xid, uid, tb.GetUid())
+	if err != nil {
+		return 0, err
+	}
+	h.keys.put(tb.GetUid(), current.GetValues()[0].(int64), newUid)
+	return newUid, h.relink(xid, tb, current, newUid)
+}
+
+// relink current迁移到newUid之后, 改写相邻行(或表的元数据)的指针
+func (h *heapEngine) relink(xid int64, tb Table, current Row, newUid int64) error {
+	if current.GetPrevUid() != 0 {
+		if err := h.setNext(xid, tb, current.GetPrevUid(), newUid); err != nil {
+			return err
+		}
+	} else if err := UpdateTableMeta(h.vm, xid, tb, newUid, tb.GetPrimaryKey()); err != nil {
+		return err
+	}
+	if current.GetNextUid() != 0 {
+		return h.setPrev(xid, tb, current.GetNextUid(), newUid)
+	}
+	return nil
+}
+
+func (h *heapEngine) Delete(xid int64, tb Table, row Row) error {
+	current, err := h.readRow(xid, tb, row.GetUid())
+	if err != nil {
+		return err
+	}
+	if err := h.vm.Delete(xid, current.GetUid(), tb.GetUid()); err != nil {
+		return err
+	}
+	if current.GetPrevUid() != 0 {
+		if err := h.setNext(xid, tb, current.GetPrevUid(), current.GetNextUid()); err != nil {
+			return err
+		}
+	} else if err := UpdateTableMeta(h.vm, xid, tb, current.GetNextUid(), tb.GetPrimaryKey()); err != nil {
+		return err
+	}
+	if current.GetNextUid() != 0 {
+		return h.setPrev(xid, tb, current.GetNextUid(), current.GetPrevUid())
+	}
+	return nil
+}
+
+func (h *heapEngine) CreateIndex(xid int64, tb Table, field Field) error {
+	return &ErrorUnsupportedOperationType{}
+}
+
+func (h *heapEngine) readRow(xid int64, tb Table, uid int64) (Row, error) {
+	record, err := h.vm.ReadForUpdate(xid, uid, tb.GetUid())
+	if err != nil {
+		return nil, err
+	}
+	return DefaultRowFactory.NewRow(uid, tb, record.GetData()), nil
+}
+
+func (h *heapEngine) setPrev(xid int64, tb Table, uid, prev int64) error {
+	row, err := h.readRow(xid, tb, uid)
+	if err != nil {
+		return err
+	}
+	return h.rewriteLinks(xid, tb, row, prev, row.GetNextUid())
+}
+
+func (h *heapEngine) setNext(xid int64, tb Table, uid, next int64) error {
+	row, err := h.readRow(xid, tb, uid)
+	if err != nil {
+		return err
+	}
+	return h.rewriteLinks(xid, tb, row, row.GetPrevUid(), next)
+}
+
+// rewriteLinks 行的长度不变, 一定原地更新
+func (h *heapEngine) rewriteLinks(xid int64, tb Table, row Row, prev, next int64) error {
+	raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, prev, next, row.GetValues())
+	if err != nil {
+		return err
+	}
+	newUid, err := h.vm.Update(xid, row.GetUid(), tb.GetUid(), raw)
+	if err != nil {
+		return err
+	}
+	if newUid != row.GetUid() {
+		panic("Fatal Error occurs when updating record raw")
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package tableManager
+
+import (
+	"myDB/dataManager"
+	"sort"
+)
+
+// 插入热点报告
+// 按表汇总表空间的页事件(分配, 插入, 溢出, 分裂, 见dataManager/pageEvents.go), 并列出事件最多的页
+// 快照读出对报告可见的表; 系统表空间由多个表共享, 其中的表不参与统计
+
+type TableHotspots struct {
+	Table string
+	dataManager.SpaceEvents
+}
+
+// Hotspots 在独立的事物中执行, tbName为空时返回所有表(按表名排序), 每个表最多列出top个页
+func (tm *TMImpl) Hotspots(tbName string, top int) ([]*TableHotspots, error) {
+	xid := tm.vm.Begin()
+	defer tm.vm.Commit(xid)
+	names := []string{tbName}
+	if tbName == "" {
+		tm.lock.RLock()
+		names = make([]string, 0, len(tm.tables))
+		for name := range tm.tables {
+			names = append(names, name)
+		}
+		tm.lock.RUnlock()
+		sort.Strings(names)
+	}
+	ret := make([]*TableHotspots, 0)
+	for _, name := range names {
+		uid, err := tm.getTbUid(xid, name)
+		if err != nil {
+			if tbName != "" {
+				return nil, err
+			}
+			continue
+		}
+		tb := DefaultTableFactory.NewTable(uid, tm.vm.Read(xid, uid).GetData(), tm)
+		if tb.GetSpace() == dataManager.SystemSpace {
+			continue
+		}
+		events, err := tm.vm.PageEvents(tb.GetSpace(), top)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &TableHotspots{Table: name, SpaceEvents: events})
+	}
+	return ret, nil
+}
@@ -0,0 +1,202 @@
+package tableManager
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// JSON 字段
+// 以压缩(去除空白)后的JSON文本存储, 存储格式与STRING相同 [Length]8[Data]
+// 插入和修改时校验JSON是否合法
+// 路径表达式, 可用于SELECT和WHERE:
+// <field>-><path>                 返回路径对应的JSON文本
+// <field>->><path>                返回去掉引号的值
+// json_extract(<field>,<path>)    同 ->
+// path 以$开头, .key 访问对象成员, [n] 访问数组元素, 例如 $.tags[0].name
+// 路径不存在时返回null
+
+const (
+	JsonNull       string = "null"
+	JsonExtractFun string = "JSON_EXTRACT("
+)
+
+type ErrorInvalidJson struct{}
+type ErrorInvalidJsonPath struct{}
+
+func (err *ErrorInvalidJson) Error() string {
+	return "Invalid json value"
+}
+
+func (err *ErrorInvalidJsonPath) Error() string {
+	return "Invalid json path expression"
+}
+
+// jsonExpr 对JSON字段的路径提取
+type jsonExpr struct {
+	field   string
+	path    []any // string -> 对象成员, int -> 数组下标
+	unquote bool
+}
+
+// column 查询的列, 普通字段或JSON路径表达式
+type column struct {
+	target int // 字段下标
+	expr   *jsonExpr
+}
+
+// toString 返回该列在values中对应的值
+func (c *column) toString(tb Table, values []any) string {
+	value, _ := fieldValueToString(tb.GetFields()[c.target].GetFType(), values[c.target])
+	if c.expr != nil {
+		return c.expr.extract(value)
+	}
+	return value
+}
+
+// compactJson 校验并压缩JSON文本
+func compactJson(value string) (string, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	if err := json.Compact(buffer, []byte(value)); err != nil {
+		return "", &ErrorInvalidJson{}
+	}
+	return buffer.String(), nil
+}
+
+// parseJsonExpr
+// name不是JSON路径表达式时返回nil, nil
+func parseJsonExpr(name string) (*jsonExpr, error) {
+	var field, path string
+	unquote := false
+	if strings.HasPrefix(strings.ToUpper(name), JsonExtractFun) && strings.HasSuffix(name, ")") {
+		args := strings.Split(name[len(JsonExtractFun):len(name)-1], ",")
+		if len(args) != 2 {
+			return nil, &ErrorInvalidJsonPath{}
+		}
+		field, path = args[0], args[1]
+	} else if i := strings.Index(name, "->>"); i > 0 {
+		field, path, unquote = name[:i], name[i+3:], true
+	} else if i := strings.Index(name, "->"); i > 0 {
+		field, path = name[:i], name[i+2:]
+	} else {
+		return nil, nil
+	}
+	steps, err := parseJsonPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonExpr{field: field, path: steps, unquote: unquote}, nil
+}
+
+func parseJsonPath(path string) ([]any, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, &ErrorInvalidJsonPath{}
+	}
+	steps := make([]any, 0)
+	path = path[1:]
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			{
+				end := strings.IndexAny(path[1:], ".[")
+				if end == -1 {
+					end = len(path) - 1
+				}
+				if end == 0 {
+					return nil, &ErrorInvalidJsonPath{}
+				}
+				steps = append(steps, path[1:end+1])
+				path = path[end+1:]
+			}
+		case '[':
+			{
+				end := strings.IndexByte(path, ']')
+				if end == -1 {
+					return nil, &ErrorInvalidJsonPath{}
+				}
+				index, err := strconv.Atoi(path[1:end])
+				if err != nil || index < 0 {
+					return nil, &ErrorInvalidJsonPath{}
+				}
+				steps = append(steps, index)
+				path = path[end+1:]
+			}
+		default:
+			return nil, &ErrorInvalidJsonPath{}
+		}
+	}
+	return steps, nil
+}
+
+// extract 从JSON文本doc中按路径提取
+func (e *jsonExpr) extract(doc string) string {
+	raw := json.RawMessage(doc)
+	for _, step := range e.path {
+		switch key := step.(type) {
+		case string:
+			{
+				obj := make(map[string]json.RawMessage)
+				if err := json.Unmarshal(raw, &obj); err != nil {
+					return JsonNull
+				}
+				next, ext := obj[key]
+				if !ext {
+					return JsonNull
+				}
+				raw = next
+			}
+		case int:
+			{
+				arr := make([]json.RawMessage, 0)
+				if err := json.Unmarshal(raw, &arr); err != nil || key >= len(arr) {
+					return JsonNull
+				}
+				raw = arr[key]
+			}
+		}
+	}
+	if e.unquote {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+	}
+	return string(raw)
+}
+
+// compareJsonValue 两个值都是数字时按数值比较, 否则按字符串比较
+func compareJsonValue(a, b string) int {
+	na, errA := strconv.ParseFloat(a, 64)
+	nb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		if na > nb {
+			return 1
+		} else if na < nb {
+			return -1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// resolveColumn 根据列名(字段名或JSON路径表达式)查找字段
+func resolveColumn(tb Table, name string) (*column, error) {
+	expr, err := parseJsonExpr(name)
+	if err != nil {
+		return nil, err
+	}
+	fName := name
+	if expr != nil {
+		fName = expr.field
+	}
+	for i, field := range tb.GetFields() {
+		if field.GetName() == fName {
+			if expr != nil && field.GetFType() != JSON {
+				return nil, &ErrorInvalidJsonPath{}
+			}
+			return &column{target: i, expr: expr}, nil
+		}
+	}
+	return nil, &ErrorFieldNotExist{}
+}
@@ -0,0 +1,98 @@
+package tableManager
+
+import (
+	"log"
+	"myDB/dataManager"
+)
+
+// 在线页迁移(碎片整理)
+// 将表中位于某个页的所有行迁移到同一表空间的其他页, 迁移期间表仍然可以读写
+// 先快照读出位于该页的行, 之后每一行在一个独立的短事物中迁移: 获取表锁, 迁移, 改写指向它的指针(相邻行或表的元数据), 提交
+// 写操作最多等待迁移一行的时间; 快照读不加锁, 旧的读视图沿旧指针仍然可以读到已经失效的旧DataItem
+// 迁移之后页上的DataItem都已经失效, 页中的空间在孤儿页回收(见orphanPage.go)时回收
+
+type ErrorNotMigratable struct{}
+
+func (err *ErrorNotMigratable) Error() string {
+	return "The storage engine of this table doesn't support migrating rows"
+}
+
+// MigratePage
+// 在独立的事物中执行, 调用方不能持有该表的锁, 返回迁移的行数
+func (tm *TMImpl) MigratePage(tbName string, pageId int64) (int64, error) {
+	uids, err := tm.rowsOnPage(tbName, pageId)
+	if err != nil {
+		return 0, err
+	}
+	var moved int64 = 0
+	for _, uid := range uids {
+		ok, err := tm.migrateRow(tbName, uid)
+		if err != nil {
+			return moved, err
+		}
+		if ok {
+			moved += 1
+		}
+	}
+	log.Printf("[Table Manager] Migrate %d rows of table %s from page %d\n", moved, tbName, pageId)
+	return moved, nil
+}
+
+// rowsOnPage 快照读出表中位于pageId页的行
+func (tm *TMImpl) rowsOnPage(tbName string, pageId int64) ([]int64, error) {
+	xid := tm.vm.Begin()
+	defer tm.vm.Commit(xid)
+	uid, err := tm.getTbUid(xid, tbName)
+	if err != nil {
+		return nil, err
+	}
+	record := tm.vm.Read(xid, uid)
+	if record == nil {
+		return nil, &ErrorTableNotExist{}
+	}
+	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
+	engine, err := tm.engineOf(tb)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := engine.(RowMigrator); !ok {
+		return nil, &ErrorNotMigratable{}
+	}
+	rows, err := engine.Scan(xid, tb, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]int64, 0)
+	for _, row := range rows {
+		if dataManager.PageOf(row.GetUid()) == pageId {
+			uids = append(uids, row.GetUid())
+		}
+	}
+	return uids, nil
+}
+
+// migrateRow 在一个独立的事物中迁移一行, 行已经被删除或者迁移时返回false
+func (tm *TMImpl) migrateRow(tbName string, uid int64) (bool, error) {
+	xid := tm.vm.Begin()
+	newUid, err := func() (int64, error) {
+		tbUid, err := tm.getTbUid(xid, tbName)
+		if err != nil {
+			return 0, err
+		}
+		tb, err := tm.lockTable(xid, tbUid)
+		if err != nil {
+			return 0, err
+		}
+		engine, err := tm.engineOf(tb)
+		if err != nil {
+			return 0, err
+		}
+		return engine.(RowMigrator).Migrate(xid, tb, uid)
+	}()
+	if err != nil {
+		tm.vm.Abort(xid)
+		return false, err
+	}
+	tm.vm.Commit(xid)
+	return newUid != 0, nil
+}
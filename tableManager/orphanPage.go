@@ -0,0 +1,125 @@
+package tableManager
+
+import (
+	"log"
+	"myDB/dataManager"
+	"myDB/versionManager"
+	"sort"
+)
+
+// 孤儿页回收
+// 从目录(所有已经提交的表)出发, 表空间中可达的页为表的行所在的页, 其他非空的数据页为孤儿页, 回收后放回空闲空间表
+// 没有被任何表使用的表空间(例如回滚的建表)中所有的数据页都是孤儿页
+// 系统表空间(目录, 字段等元数据)以及非默认引擎的表空间不参与回收
+// 在独立的事物中执行: 在元数据表以及所有表上加锁, 之后必须没有其他活跃事物(清理的后台事物除外), 否则返回ErrorReclaimBusy
+// 已经开始的快照读可能沿旧指针读到孤儿页中的数据, 因此不能与其他事物并发
+// 目录以及行链表都使用当前读, 加锁之前提交的修改都是可见的
+
+type ErrorReclaimBusy struct{}
+
+func (err *ErrorReclaimBusy) Error() string {
+	return "Orphan pages can only be reclaimed when no other transaction is active"
+}
+
+type OrphanPage struct {
+	Space  int64
+	PageId int64
+}
+
+// ReclaimOrphans 返回孤儿页(按表空间和页号排序), dryRun时只检查不回收
+func (tm *TMImpl) ReclaimOrphans(dryRun bool) ([]OrphanPage, error) {
+	xid := tm.vm.Begin()
+	orphans, err := tm.reclaimOrphans(xid, dryRun)
+	if err != nil {
+		tm.vm.Abort(xid)
+		return nil, err
+	}
+	tm.vm.Commit(xid)
+	log.Printf("[Table Manager] Find %d orphan pages, dry run %t\n", len(orphans), dryRun)
+	return orphans, nil
+}
+
+func (tm *TMImpl) reclaimOrphans(xid int64, dryRun bool) ([]OrphanPage, error) {
+	if err := tm.vm.LockTable(xid, versionManager.MetaDataTbUid); err != nil {
+		return nil, err
+	}
+	tables, err := tm.lockAllTables(xid)
+	if err != nil {
+		return nil, err
+	}
+	// 之后创建的表空间(由之后开始的事物创建)不参与回收
+	status := tm.vm.Status()
+	for _, tran := range status.Active {
+		if tran.Xid != xid && !tran.Purge {
+			return nil, &ErrorReclaimBusy{}
+		}
+	}
+	reachable, err := tm.reachablePages(xid, tables)
+	if err != nil {
+		return nil, err
+	}
+	orphans := make([]OrphanPage, 0)
+	for _, space := range status.Dm.Spaces {
+		pages, ext := reachable[space.Space]
+		if space.Space == dataManager.SystemSpace || (ext && pages == nil) {
+			continue
+		}
+		for _, pageId := range tm.vm.ReclaimPages(xid, space.Space, pages, dryRun) {
+			orphans = append(orphans, OrphanPage{Space: space.Space, PageId: pageId})
+		}
+	}
+	return orphans, nil
+}
+
+// lockAllTables 在所有表上加锁并当前读表的元数据(按uid顺序), 回滚的表被跳过
+func (tm *TMImpl) lockAllTables(xid int64) ([]Table, error) {
+	tm.lock.RLock()
+	uids := make([]int64, 0, len(tm.tableUid))
+	for uid := range tm.tableUid {
+		uids = append(uids, uid)
+	}
+	tm.lock.RUnlock()
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	tables := make([]Table, 0, len(uids))
+	for _, uid := range uids {
+		record, err := tm.vm.ReadForUpdate(xid, uid, uid)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			tables = append(tables, DefaultTableFactory.NewTable(uid, record.GetData(), tm))
+		}
+	}
+	return tables, nil
+}
+
+// reachablePages 表空间 -> 表的行所在的页, 不参与回收的表空间对应nil
+func (tm *TMImpl) reachablePages(xid int64, tables []Table) (map[int64]map[int64]struct{}, error) {
+	reachable := make(map[int64]map[int64]struct{})
+	for _, tb := range tables {
+		space := tb.GetSpace()
+		if tb.GetEngine() != "" && tb.GetEngine() != HeapEngine {
+			reachable[space] = nil
+			continue
+		}
+		engine, err := tm.engineOf(tb)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := engine.Scan(xid, tb, true, 0)
+		if err != nil {
+			return nil, err
+		}
+		pages, ext := reachable[space]
+		if !ext {
+			pages = make(map[int64]struct{})
+			reachable[space] = pages
+		} else if pages == nil {
+			continue
+		}
+		for _, row := range rows {
+			pages[dataManager.PageOf(row.GetUid())] = struct{}{}
+		}
+	}
+	return reachable, nil
+}
@@ -0,0 +1,65 @@
+package tableManager
+
+import (
+	"sync"
+)
+
+// 并行扫描
+// 行链表只能顺序遍历: 由引擎顺序读出(快照读)每一行的数据, 按页的范围切分为块
+// 多个worker并行解析块中的行, 执行Filter/Project(vectorPlan)
+// exchange: 按块的顺序合并worker的结果, 结果的顺序与顺序扫描相同
+
+const ScanChunkPages int = 4 // 每个块最多包含的页数
+
+// ScanChunk 表中连续的一段行, 位于不超过ScanChunkPages个页中
+type ScanChunk struct {
+	Index int
+	Uids  []int64
+	Raws  [][]byte // 行数据(已经拷贝, 不引用页)
+}
+
+// ChunkScanner 支持并行扫描的引擎
+type ChunkScanner interface {
+	// ScanChunks 快照读, 将表切分为块依次发送到chunks, 不关闭chunks
+	// 读出的数据超过maxMemory(> 0)时返回ErrorOutOfQueryMemory
+	ScanChunks(xid int64, tb Table, maxMemory int64, chunks chan<- *ScanChunk) error
+}
+
+// parallelScan 返回所有匹配where条件的行的投影
+func (tm *TMImpl) parallelScan(xid int64, tb Table, scanner ChunkScanner, workers int, maxMemory int64, plan *vectorPlan) ([][]string, error) {
+	chunks := make(chan *ScanChunk, workers)
+	results := make(map[int][][]string)
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex // 保护results
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				rows := make([]Row, len(chunk.Raws))
+				for j, raw := range chunk.Raws {
+					rows[j] = DefaultRowFactory.NewRow(chunk.Uids[j], tb, raw)
+				}
+				tm.vm.AddRows(xid, int64(len(rows)), 0)
+				values := plan.execute(rows)
+				lock.Lock()
+				results[chunk.Index] = values
+				lock.Unlock()
+			}
+		}()
+	}
+	err := scanner.ScanChunks(xid, tb, maxMemory, chunks)
+	close(chunks)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	// merge
+	merged := make([][]string, 0)
+	for i := 0; i < len(results); i++ {
+		merged = append(merged, results[i]...)
+	}
+	return merged, nil
+}
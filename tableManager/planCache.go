@@ -0,0 +1,177 @@
+package tableManager
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// 执行计划缓存
+// 缓存SELECT编译后的执行计划(字段下标, JSON路径表达式, where条件中解析过的常量), 相同的查询不再重复解析字段和条件
+// key为规范化的语句文本(由解析后的Select生成, 与原语句中的空白无关) + 表的schema版本
+// 每个表有一个schema版本, DDL(CREATE, ATTACH)或统计信息更新(ANALYZE)时版本加一, 该表的所有计划失效
+// 计划不引用表的行链表(firstRecordUid), 每次执行仍然快照读表的元数据
+// 超过容量时淘汰最久未使用的计划
+
+const PlanCacheCapacity int = 1024
+
+// PlanCacheStats 计划缓存的运行状态
+type PlanCacheStats struct {
+	Capacity      int
+	Entries       int
+	Hits          int64
+	Misses        int64
+	Invalidations int64 // 因表的schema版本变化而失效的计划数
+}
+
+type cachedPlan struct {
+	key     string
+	tbName  string
+	tbUid   int64 // 同名的表被重新创建时uid不同
+	version int64
+	pred    *predicate
+	columns []*column
+}
+
+type planCache struct {
+	lock     sync.Mutex
+	capacity int
+	entries  map[string]*list.Element // key -> *cachedPlan
+	lru      *list.List               // 头部为最近使用的计划
+	versions map[string]int64         // tbName -> schema version
+	stats    PlanCacheStats
+}
+
+func newPlanCache(capacity int) *planCache {
+	return &planCache{
+		capacity: capacity,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+		versions: map[string]int64{},
+	}
+}
+
+// planKey 规范化的SELECT语句
+func planKey(sel *Select) string {
+	builder := strings.Builder{}
+	builder.WriteString("SELECT")
+	for _, fName := range sel.FNames {
+		builder.WriteByte(' ')
+		builder.WriteString(fName)
+	}
+	builder.WriteString(" FROM ")
+	builder.WriteString(sel.TbName)
+	if sel.Where != nil && sel.Where.Compare != nil {
+		builder.WriteString(" WHERE ")
+		builder.WriteString(sel.Where.Compare.FieldName)
+		builder.WriteByte(' ')
+		builder.WriteString(sel.Where.Compare.CompareTo)
+		builder.WriteByte(' ')
+		builder.WriteString(sel.Where.Compare.Value)
+	}
+	return builder.String()
+}
+
+// get 返回tb当前schema版本下的计划, 不存在或已经失效时返回nil
+func (c *planCache) get(key string, tb Table) *vectorPlan {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ext := c.entries[key]
+	if !ext {
+		c.stats.Misses += 1
+		return nil
+	}
+	cached := elem.Value.(*cachedPlan)
+	if cached.tbUid != tb.GetUid() || cached.version != c.versions[cached.tbName] {
+		c.remove(elem)
+		c.stats.Invalidations += 1
+		c.stats.Misses += 1
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	c.stats.Hits += 1
+	return &vectorPlan{tb: tb, pred: cached.pred, columns: cached.columns}
+}
+
+func (c *planCache) put(key string, plan *vectorPlan) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ext := c.entries[key]; ext {
+		c.remove(elem)
+	}
+	tbName := plan.tb.GetName()
+	cached := &cachedPlan{
+		key:     key,
+		tbName:  tbName,
+		tbUid:   plan.tb.GetUid(),
+		version: c.versions[tbName],
+		pred:    plan.pred,
+		columns: plan.columns,
+	}
+	c.entries[key] = c.lru.PushFront(cached)
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate 表的schema版本加一, 删除该表的所有计划
+func (c *planCache) invalidate(tbName string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.versions[tbName] += 1
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*cachedPlan).tbName == tbName {
+			c.remove(elem)
+			c.stats.Invalidations += 1
+		}
+		elem = next
+	}
+}
+
+func (c *planCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cachedPlan).key)
+}
+
+func (c *planCache) Stats() PlanCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats := c.stats
+	stats.Capacity, stats.Entries = c.capacity, c.lru.Len()
+	return stats
+}
+
+// InvalidatePlans 表的结构或统计信息变化后调用, 使该表的所有执行计划失效
+func (tm *TMImpl) InvalidatePlans(tbName string) {
+	tm.plans.invalidate(tbName)
+}
+
+func (tm *TMImpl) PlanCacheStats() PlanCacheStats {
+	return tm.plans.Stats()
+}
+
+// compilePlan 返回sel的执行计划, 缓存中不存在时校验where条件与字段并编译
+func (tm *TMImpl) compilePlan(tb Table, sel *Select) (*vectorPlan, error) {
+	key := planKey(sel)
+	if plan := tm.plans.get(key, tb); plan != nil {
+		return plan, nil
+	}
+	// check where condition valid
+	if sel.Where != nil && sel.Where.Compare != nil {
+		if err := tm.checkWhereCondition(tb, sel.Where); err != nil {
+			return nil, err
+		}
+	}
+	// check字段条件, 查找字段下标(或JSON路径表达式)
+	columns, err := tm.checkFieldNames(tb, sel.FNames)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := newVectorPlan(tb, sel.Where, columns)
+	if err != nil {
+		return nil, err
+	}
+	tm.plans.put(key, plan)
+	return plan, nil
+}
@@ -0,0 +1,114 @@
+package tableManager
+
+import (
+	"strconv"
+	"sync"
+)
+
+// 主键点查
+// SELECT ... WHERE ID = <key>不经过扫描和过滤: 按主键直接读出一行(TableEngine.ReadByKey), 之后只做投影
+// 主键由表的主键计数器分配并且不能修改, 一张表中可见的行主键唯一; 主键不小于快照读到的计数器时一定不存在, 不读取任何行
+// 默认引擎在内存中维护主键 -> uid的目录(keyDirectory): 插入, 修改迁移以及点查退化的扫描时记录
+// 点查时快照读目录中的uid并校验主键(迁移留下的转发桩仍然可以读到该行), 没有记录, 不可见或者主键不一致时退化为扫描并重建该表的目录
+// 行的槽位号不复用, 目录中的uid不会指向其他的行; 目录不持久化, 重启之后由点查重建, 条目数超过KeyDirectoryCapacity时清空
+
+const KeyDirectoryCapacity int = 1 << 20
+
+type keyDirectory struct {
+	lock   sync.RWMutex
+	tables map[int64]map[int64]int64 // 表uid -> 主键 -> 行uid
+	size   int
+}
+
+func newKeyDirectory() *keyDirectory {
+	return &keyDirectory{tables: map[int64]map[int64]int64{}}
+}
+
+func (d *keyDirectory) get(tbUid, key int64) (int64, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	uid, ext := d.tables[tbUid][key]
+	return uid, ext
+}
+
+func (d *keyDirectory) put(tbUid, key, uid int64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.size >= KeyDirectoryCapacity {
+		d.tables, d.size = map[int64]map[int64]int64{}, 0
+	}
+	keys, ext := d.tables[tbUid]
+	if !ext {
+		keys = map[int64]int64{}
+		d.tables[tbUid] = keys
+	}
+	if _, ext := keys[key]; !ext {
+		d.size += 1
+	}
+	keys[key] = uid
+}
+
+// fill 用扫描得到的所有行重建表的目录
+func (d *keyDirectory) fill(tbUid int64, rows []Row) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.size -= len(d.tables[tbUid])
+	delete(d.tables, tbUid)
+	if d.size+len(rows) > KeyDirectoryCapacity {
+		return
+	}
+	keys := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		keys[row.GetValues()[0].(int64)] = row.GetUid()
+	}
+	d.tables[tbUid] = keys
+	d.size += len(keys)
+}
+
+// pointKey sel是否为快照读的主键等值查询, 返回主键
+func pointKey(sel *Select) (int64, bool) {
+	if !sel.AsOf.IsZero() || sel.ReadForUpdate || sel.Where == nil || sel.Where.Compare == nil {
+		return 0, false
+	}
+	compare := sel.Where.Compare
+	if compare.FieldName != PrimaryKeyCol || compare.CompareTo != "=" {
+		return 0, false
+	}
+	key, err := strconv.ParseInt(compare.Value, 10, 64)
+	return key, err == nil
+}
+
+// ReadKey
+// 主键点查, 快照读主键为key的行并投影为sel.FNames, sel的where条件被忽略
+func (tm *TMImpl) ReadKey(xid int64, sel *Select, key int64) ([]*ResponseObject, error) {
+	uid, err := tm.getTbUid(xid, sel.TbName)
+	if err != nil {
+		return nil, err
+	}
+	record := tm.vm.Read(xid, uid)
+	if record == nil {
+		return nil, &ErrorTableNotExist{}
+	}
+	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
+	engine, err := tm.engineOf(tb)
+	if err != nil {
+		return nil, err
+	}
+	// 只投影, 计划与不带条件的查询共享
+	plan, err := tm.compilePlan(tb, &Select{TbName: sel.TbName, FNames: sel.FNames})
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]string, 0, 1)
+	if key >= 0 && key < tb.GetPrimaryKey() {
+		row, err := engine.ReadByKey(xid, tb, key)
+		if err != nil {
+			return nil, err
+		}
+		if row != nil {
+			tm.vm.AddRows(xid, 1, 0)
+			values = plan.project([]Row{row}, []int{0}, values)
+		}
+	}
+	return tm.wrapRows(sel.FNames, values), nil
+}
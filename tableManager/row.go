@@ -60,6 +60,12 @@ func (r *RowImpl) GetValues() []any {
 	return r.values
 }
 
+// nextUidOf 只解析行数据中的NextRowUid
+func nextUidOf(raw []byte) int64 {
+	offset := SzRowType + SzRowUid
+	return int64(binary.BigEndian.Uint64(raw[offset : offset+SzRowUid]))
+}
+
 type RowType int64
 
 const (
@@ -77,8 +83,39 @@ var DefaultRowFactory RowFactory
 type RowImplFactory struct{}
 
 func (r *RowImplFactory) NewRow(uid int64, tb Table, raw []byte) Row {
-	fields := tb.GetFields()
-	values := make([]any, len(fields))
+	columns, err := columnsOf(tb)
+	if err != nil {
+		panic(err)
+	}
+	row, err := decodeRow(uid, columns, raw)
+	if err != nil {
+		panic(err)
+	}
+	return row
+}
+
+type ErrorMalformedRecord struct{}
+
+func (err *ErrorMalformedRecord) Error() string {
+	return "Malformed record raw"
+}
+
+// DecodeRecord 按字段类型解析一条记录
+// 与NewRow不同, 数据不完整或者长度不合法时返回ErrorMalformedRecord而不是panic, 可用于fuzz
+func DecodeRecord(fTypes []FieldType, raw []byte) (Row, error) {
+	return decodeRow(0, plainColumns(fTypes), raw)
+}
+
+// EncodeRecord 将values按字段类型编码为一条记录(RECORD)
+func EncodeRecord(fTypes []FieldType, prevRowUid, nextRowUid int64, values []any) ([]byte, error) {
+	return encodeRow(plainColumns(fTypes), RECORD, prevRowUid, nextRowUid, values)
+}
+
+func decodeRow(uid int64, columns []columnCodec, raw []byte) (Row, error) {
+	if int64(len(raw)) < SzRowType+2*SzRowUid {
+		return nil, &ErrorMalformedRecord{}
+	}
+	values := make([]any, len(columns))
 	offset := int64(0)
 	rType := int64(binary.BigEndian.Uint64(raw[offset : offset+SzRowType]))
 	offset += SzRowType
@@ -86,17 +123,36 @@ func (r *RowImplFactory) NewRow(uid int64, tb Table, raw []byte) Row {
 	offset += SzRowUid
 	nextUid := int64(binary.BigEndian.Uint64(raw[offset : offset+SzRowUid]))
 	offset += SzRowUid
-	for i, field := range fields {
-		fType := field.GetFType()
-		length := FTypeLength[fType]
-		if length == VARIABLE {
+	var rowKey []byte // 第一个字段(主键)的编码, 加密字段的附加数据
+	for i, c := range columns {
+		fType := c.fType
+		length, ext := FTypeLength[fType]
+		if !ext {
+			return nil, &ErrorFTypeInvalid{}
+		}
+		if length == VARIABLE || c.aead != nil {
 			// 变长字段
+			if int64(len(raw))-offset < SzVariableLength {
+				return nil, &ErrorMalformedRecord{}
+			}
 			length = int64(binary.BigEndian.Uint64(raw[offset : offset+SzVariableLength]))
 			offset += SzVariableLength
 		}
-		value, err := getFTypeValue(fType, raw[offset:offset+length])
+		if length < 0 || length > int64(len(raw))-offset {
+			return nil, &ErrorMalformedRecord{}
+		}
+		var value any
+		var err error
+		if c.aead != nil {
+			value, err = decryptValue(c, rowKey, raw[offset:offset+length])
+		} else {
+			value, err = getFTypeValue(fType, raw[offset:offset+length])
+		}
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		if i == 0 {
+			rowKey = raw[offset : offset+length]
 		}
 		offset += length
 		values[i] = value
@@ -107,22 +163,44 @@ func (r *RowImplFactory) NewRow(uid int64, tb Table, raw []byte) Row {
 		prevUid: prevUid,
 		nextUid: nextUid,
 		values:  values,
-	}
+	}, nil
 }
 
 func (r *RowImplFactory) WrapRowRaw(tb Table, rType RowType, prevRowUid, nextRowUid int64, values []any) ([]byte, error) {
+	columns, err := columnsOf(tb)
+	if err != nil {
+		return nil, err
+	}
+	return encodeRow(columns, rType, prevRowUid, nextRowUid, values)
+}
+
+// encodeRow 加密字段(aead不为nil)以变长格式存储密文
+func encodeRow(columns []columnCodec, rType RowType, prevRowUid, nextRowUid int64, values []any) ([]byte, error) {
 	buffer := bytes.NewBuffer([]byte{})
 	_ = binary.Write(buffer, binary.BigEndian, rType)
 	_ = binary.Write(buffer, binary.BigEndian, prevRowUid)
 	_ = binary.Write(buffer, binary.BigEndian, nextRowUid)
 	cnt := len(values)
-	fields := tb.GetFields()
+	if cnt > len(columns) {
+		return nil, &ErrorValueNotMatch{}
+	}
+	var rowKey []byte // 第一个字段(主键)的编码, 加密字段的附加数据
 	for i := 0; i < cnt; i++ {
-		if toBytes, err := fieldValueToBytes(fields[i].GetFType(), values[i]); err != nil {
+		var toBytes []byte
+		var err error
+		if columns[i].aead != nil {
+			toBytes, err = encryptValue(columns[i], rowKey, values[i])
+		} else {
+			toBytes, err = fieldValueToBytes(columns[i].fType, values[i])
+		}
+		if err != nil {
 			return nil, err
 		} else {
 			_ = binary.Write(buffer, binary.BigEndian, toBytes)
 		}
+		if i == 0 {
+			rowKey = toBytes
+		}
 	}
 	return buffer.Bytes(), nil
 }
@@ -0,0 +1,129 @@
+package tableManager
+
+import (
+	"sync"
+)
+
+// 近似行数
+// 每个表维护一个近似的已提交行数: 插入和删除(emitChange, 包括批量导入以及flashback)累计到事物的增量中,
+// 事物通过TM提交时加到表的行数上, 回滚时丢弃
+// 表的行数在第一次估计时通过一次快照扫描初始化, 不持久化, 重启之后重新初始化;
+// 初始化期间提交的事物可能被漏算或者重复计算, 因此只是估计值
+// 估计值包括调用方事物自身未提交的增量
+// 用途: 快速COUNT(*)(见executor, approximate_count), 以及选择扫描方式: 估计行数少于ParallelScanMinRows的表不并行扫描
+
+const ParallelScanMinRows int64 = 1000
+
+type rowCounter struct {
+	lock    sync.Mutex
+	counts  map[int64]int64           // 表uid -> 近似行数, 只包含已经初始化的表
+	pending map[int64]map[int64]int64 // xid -> 表uid -> 未提交的增量
+}
+
+func newRowCounter() *rowCounter {
+	return &rowCounter{counts: map[int64]int64{}, pending: map[int64]map[int64]int64{}}
+}
+
+func (c *rowCounter) record(xid, tbUid, delta int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	deltas, ext := c.pending[xid]
+	if !ext {
+		deltas = map[int64]int64{}
+		c.pending[xid] = deltas
+	}
+	deltas[tbUid] += delta
+}
+
+// commit 只累加已经初始化的表, 其他表在初始化时扫描到提交的行
+func (c *rowCounter) commit(xid int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for tbUid, delta := range c.pending[xid] {
+		if n, ext := c.counts[tbUid]; ext {
+			if n += delta; n < 0 {
+				n = 0
+			}
+			c.counts[tbUid] = n
+		}
+	}
+	delete(c.pending, xid)
+}
+
+func (c *rowCounter) abort(xid int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pending, xid)
+}
+
+// estimate xid看到的tbUid的近似行数, 表没有初始化时返回false
+func (c *rowCounter) estimate(xid, tbUid int64) (int64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	n, ext := c.counts[tbUid]
+	if !ext {
+		return 0, false
+	}
+	if n += c.pending[xid][tbUid]; n < 0 {
+		n = 0
+	}
+	return n, true
+}
+
+// init 初始化tbUid的行数, 已经初始化时保持原值
+func (c *rowCounter) init(tbUid, n int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ext := c.counts[tbUid]; !ext {
+		c.counts[tbUid] = n
+	}
+}
+
+// EstimateRows
+// 返回xid中名为tbName的表的近似行数, 表的行数没有初始化时在独立的事物中快照扫描一次
+// xid为-1(事物之外)时在独立的事物中查找表
+func (tm *TMImpl) EstimateRows(xid int64, tbName string) (int64, error) {
+	if xid == -1 {
+		xid = tm.vm.Begin()
+		defer tm.vm.Commit(xid)
+	}
+	uid, err := tm.getTbUid(xid, tbName)
+	if err != nil {
+		return 0, err
+	}
+	if n, ok := tm.rows.estimate(xid, uid); ok {
+		return n, nil
+	}
+	if err := tm.countRows(uid); err != nil {
+		return 0, err
+	}
+	n, _ := tm.rows.estimate(xid, uid)
+	return n, nil
+}
+
+// countRows 快照扫描uid表中已提交的行, 初始化行数; 表对新事物不可见(本事物创建)时为0
+func (tm *TMImpl) countRows(uid int64) error {
+	xid := tm.vm.Begin()
+	defer tm.vm.Commit(xid)
+	var n int64
+	if record := tm.vm.Read(xid, uid); record != nil {
+		tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
+		engine, err := tm.engineOf(tb)
+		if err != nil {
+			return err
+		}
+		rows, err := engine.Scan(xid, tb, false, 0)
+		if err != nil {
+			return err
+		}
+		n = int64(len(rows))
+	}
+	tm.rows.init(uid, n)
+	return nil
+}
+
+// parallelWorthy 估计行数不少于ParallelScanMinRows(或者没有估计值)的表并行扫描
+func (tm *TMImpl) parallelWorthy(xid int64, tb Table) bool {
+	n, ok := tm.rows.estimate(xid, tb.GetUid())
+	return !ok || n >= ParallelScanMinRows
+}
@@ -1,5 +1,7 @@
 package tableManager
 
+import "time"
+
 // TableManager提供的服务
 // 与执行器交互
 // REQUEST
@@ -8,32 +10,57 @@ package tableManager
 // 创建表
 // 创建每个表时，会添加一个自增主键字段'ID', 在上层添加
 type Create struct {
-	TbName string
-	Fields []*FieldCreate
+	TbName   string
+	Fields   []*FieldCreate
+	Engine   string // 表级存储引擎, 为空时使用默认引擎
+	Checksum bool   // 表的每一行带校验和, 读取时校验
+	// FillFactor 插入时页的填充因子(百分比), 剩余空间留给行的原地更新, 0表示默认值
+	FillFactor int
+	Unlogged   bool // 表的修改不记录redo log, 崩溃之后清空
 }
 
 type Select struct {
-	TbName        string   // select which table
-	FNames        []string // select which table
-	ReadForUpdate bool     // 快照读/当前读
-	Where         *Where   // nil则没有where子句
+	TbName        string    // select which table
+	FNames        []string  // select which table
+	ReadForUpdate bool      // 快照读/当前读
+	Where         *Where    // nil则没有where子句
+	MaxMemory     int64     // 查询可以使用的最大内存(字节), 0表示不限制, 由会话所在的资源组决定
+	Parallel      int       // 快照读时并行扫描的worker数, <= 1 时顺序扫描
+	AsOf          time.Time // 非零时读取该时刻的数据(时间旅行查询), 只能用于快照读
 }
 
 type Update struct {
-	TName    string
-	FName    string // field to update
-	ToUpdate string // update to its value
-	Where    *Where
+	TName     string
+	FName     string // field to update
+	ToUpdate  string // update to its value
+	Where     *Where
+	Returning []string // RETURNING 返回被修改的行(修改后的值)的这些字段, nil则不返回
 }
 
 type Delete struct {
-	TName string
-	Where *Where
+	TName     string
+	Where     *Where
+	Returning []string // RETURNING 返回被删除的行的这些字段
 }
 
 type Insert struct {
+	TbName    string
+	Values    []string // 字段值与字段一一对应,自增主键不用设置 TODO 可以用map实现非一一对应关系
+	Returning []string // RETURNING 返回插入的行的这些字段(包括生成的主键)
+}
+
+// Export
+// 导出表到目录Dir, 生成表空间文件(TbName.fds)和元数据文件(TbName.meta)
+type Export struct {
+	TbName string
+	Dir    string
+}
+
+// Attach
+// 将目录Dir中导出的表挂载为表TbName
+type Attach struct {
 	TbName string
-	Values []string // 字段值与字段一一对应,自增主键不用设置 TODO 可以用map实现非一一对应关系
+	Dir    string
 }
 
 type Where struct {
@@ -47,9 +74,10 @@ type Compare struct {
 }
 
 type FieldCreate struct {
-	FName   string
-	FType   string
-	Indexed string
+	FName     string
+	FType     string
+	Indexed   string
+	Encrypted bool // 列级加密
 }
 
 // TODO ADD 添加索引
@@ -0,0 +1,66 @@
+package tableManager
+
+import (
+	"myDB/versionManager"
+)
+
+// 原子交换
+// 重建一个对象(索引重建, vacuum full, 在线DDL)时先在新表中建好数据, 之后在一个事物中交换新旧两张表的名字
+// 交换不原地修改元数据: 在xid中删除两张表的元数据记录, 再以对方的名字插入两条新的记录(字段, 行链表, 主键计数器, 表空间以及引擎不变)
+// 与其他DDL一样持有元数据表的锁直到事物结束, 并当前读(锁住)两张表, 等待进行中的写入结束
+// 事物的提交记录是交换唯一的原子点: 崩溃时未提交的交换在恢复中整体撤销, 已提交的交换整体可见, 目录中不会出现只交换了一半的表
+// 快照早于提交的事物继续读到原来的表, 之后当前读原来的表时返回ErrorTableNotExist
+// 插入不持有表锁的引擎(WAL-only)的表不能交换
+
+type Swap struct {
+	TbName string
+	With   string
+}
+
+type ErrorSwapSameTable struct{}
+
+func (err *ErrorSwapSameTable) Error() string {
+	return "Can not swap a table with itself"
+}
+
+// Swap
+// 上层必须确保在遇到error时回滚
+func (tm *TMImpl) Swap(xid int64, swap *Swap) error {
+	if swap.TbName == swap.With {
+		return &ErrorSwapSameTable{}
+	}
+	if err := tm.vm.LockTable(xid, versionManager.MetaDataTbUid); err != nil {
+		return err
+	}
+	tables := make([]Table, 2)
+	for i, name := range []string{swap.TbName, swap.With} {
+		uid, err := tm.getTbUid(xid, name)
+		if err != nil {
+			return err
+		}
+		if tables[i], err = tm.lockTable(xid, uid); err != nil {
+			return err
+		}
+		engine, err := tm.engineOf(tables[i])
+		if err != nil {
+			return err
+		}
+		if lf, ok := engine.(LockFreeEngine); ok && lf.LockFree() {
+			return &ErrorUnsupportedOperationType{}
+		}
+	}
+	for _, tb := range tables {
+		if err := tm.vm.Delete(xid, tb.GetUid(), tb.GetUid()); err != nil {
+			return err
+		}
+	}
+	for i, tb := range tables {
+		other := tables[1-i]
+		raw := DefaultTableFactory.WrapTableRaw(tb.GetName(), tm.topTableUid, other.GetFields(), other.GetFirstRecordUid(),
+			other.GetPrimaryKey(), other.GetSpace(), other.GetEngine())
+		if _, err := tm.insertTable(xid, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -19,6 +19,8 @@ type Table interface {
 	GetFields() []Field
 	GetFirstRecordUid() int64
 	GetPrimaryKey() int64
+	GetSpace() int64 // 表数据所在的表空间
+	GetEngine() string
 }
 
 // DB中的所有表组织成链表的形式
@@ -26,6 +28,8 @@ type Table interface {
 // [TABLE_MASK]4[TableName(string_format)][nextTable_uid]8[PRIMARY_KEY_ID]8[TableFieldNumber]4
 // [Field1UID]8[Field2UID]8...[FieldNUID]8
 // [FIRST_RECORD_UID] 8 (v1.0 未实现索引)
+// [SPACE] 8 表空间id, 旧版本创建的表没有该字段，数据位于系统表空间(0)
+// [ENGINE](string_format) 表级存储引擎, 使用默认引擎的表没有该字段
 // v1.0 first_record_uid 该表的第一个数据的uid
 // nextTable_uid == 0 if this is the last table
 // first_record_uid == 0 if this is an empty table
@@ -35,6 +39,7 @@ const (
 	SzFieldUid         int64 = 8
 	SzPrimaryKey       int64 = 8
 	SzTableFieldNumber int64 = 4
+	SzTableSpace       int64 = 8
 )
 
 type TableImpl struct {
@@ -46,6 +51,8 @@ type TableImpl struct {
 	fields         []Field
 	firstRecordUid int64
 	primaryKey     int64
+	space          int64
+	engine         string // 空字符串表示默认引擎
 }
 
 func (tb *TableImpl) GetName() string {
@@ -72,6 +79,14 @@ func (tb *TableImpl) GetPrimaryKey() int64 {
 	return tb.primaryKey
 }
 
+func (tb *TableImpl) GetSpace() int64 {
+	return tb.space
+}
+
+func (tb *TableImpl) GetEngine() string {
+	return tb.engine
+}
+
 type TableStatus byte
 
 const (
@@ -81,7 +96,7 @@ const (
 
 type TableFactory interface {
 	NewTable(uid int64, raw []byte, tm TableManager) Table
-	WrapTableRaw(tableName string, nextUid int64, fields []Field, firstRecordUid int64, primaryKey int64) []byte
+	WrapTableRaw(tableName string, nextUid int64, fields []Field, firstRecordUid int64, primaryKey int64, space int64, engine string) []byte
 }
 
 type TableImplFactory struct{}
@@ -120,13 +135,23 @@ func (f *TableImplFactory) NewTable(uid int64, raw []byte, tm TableManager) Tabl
 		pointer += SzFieldUid
 		fields[i] = tm.loadField(table, fUid)
 	}
-	table.firstRecordUid = int64(binary.BigEndian.Uint64(raw[pointer:]))
+	table.firstRecordUid = int64(binary.BigEndian.Uint64(raw[pointer : pointer+SzTableUid]))
+	pointer += SzTableUid
+	if int64(len(raw)) >= pointer+SzTableSpace {
+		table.space = int64(binary.BigEndian.Uint64(raw[pointer : pointer+SzTableSpace]))
+		pointer += SzTableSpace
+	}
+	if int64(len(raw)) >= pointer+SzVariableLength {
+		engineLength := int64(binary.BigEndian.Uint64(raw[pointer : pointer+SzVariableLength]))
+		table.engine = string(raw[pointer+SzVariableLength : pointer+SzVariableLength+engineLength])
+	}
 	return table
 }
 
 // WrapTableRaw
 // 包装一个空表的Raw
-func (f *TableImplFactory) WrapTableRaw(tableName string, nextUid int64, fields []Field, firstRecordUid int64, primaryKey int64) []byte {
+// 使用默认引擎时不写入引擎名, 与旧版本的格式相同
+func (f *TableImplFactory) WrapTableRaw(tableName string, nextUid int64, fields []Field, firstRecordUid int64, primaryKey int64, space int64, engine string) []byte {
 	buffer := bytes.NewBuffer([]byte{})
 	stringLength := int64(len(tableName))
 	_ = binary.Write(buffer, binary.BigEndian, TableMask)
@@ -141,6 +166,11 @@ func (f *TableImplFactory) WrapTableRaw(tableName string, nextUid int64, fields
 		_ = binary.Write(buffer, binary.BigEndian, uid)
 	}
 	_ = binary.Write(buffer, binary.BigEndian, firstRecordUid)
+	_ = binary.Write(buffer, binary.BigEndian, space)
+	if engine != "" && engine != HeapEngine {
+		_ = binary.Write(buffer, binary.BigEndian, int64(len(engine)))
+		_ = binary.Write(buffer, binary.BigEndian, []byte(engine))
+	}
 	return buffer.Bytes()
 }
 
@@ -5,12 +5,17 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"myDB/dataManager"
+	"myDB/dbError"
 	"myDB/indexManager"
 	"myDB/transactions"
 	"myDB/versionManager"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // TableManager
@@ -18,25 +23,75 @@ import (
 // 表和字段管理
 
 type TableManager interface {
-	Begin() int64 // 开启一个事物，返回xid
+	Begin() int64                                           // 开启一个事物，返回xid
+	BeginWith(opts versionManager.TransactionOptions) int64 // 以指定的隔离级别以及锁等待超时开启事物
 	Commit(xid int64)
 	Abort(xid int64)
+	BeginBatch(xid int64) // 批量执行, 日志不逐条刷盘
+	EndBatch(xid int64)   // 结束批量执行, 日志统一刷盘
 
 	Show(xid int64) ([]*ResponseObject, error) // 展示DB中的所有表
 	Create(xid int64, create *Create) error    // create table
 
-	Insert(xid int64, insert *Insert) error                 // insert
-	Read(xid int64, sel *Select) ([]*ResponseObject, error) // select
-	Update(xid int64, update *Update) error                 // update fields
-	Delete(xid int64, delete *Delete) error                 // delete
+	Insert(xid int64, insert *Insert) ([]*ResponseObject, error)          // insert, 返回RETURNING的结果(没有RETURNING时为nil)
+	BulkInsert(xid int64, tbName string, rows [][]string) (int, error)    // 批量导入一批行, 见bulkLoad.go
+	Read(xid int64, sel *Select) ([]*ResponseObject, error)               // select
+	ReadKey(xid int64, sel *Select, key int64) ([]*ResponseObject, error) // 主键点查, 见pointLookup.go
+	OpenCursor(xid int64, sel *Select) (*Cursor, error)                   // 为快照读sel声明游标, 见cursor.go
+	Fetch(xid int64, cursor *Cursor, n int) ([]*ResponseObject, error)    // 读出游标之后最多n行
+	Update(xid int64, update *Update) ([]*ResponseObject, error)          // update fields
+	Delete(xid int64, delete *Delete) ([]*ResponseObject, error)          // delete
+
+	Describe(xid int64, tbName string) ([]Field, error) // 表的所有字段(快照读)
+	// 表的近似行数, 见rowCount.go
+	EstimateRows(xid int64, tbName string) (int64, error)
+	// 块采样更新表的统计信息, 见analyze.go
+	Analyze(xid int64, analyze *Analyze) (*TableStats, error)
+
+	Export(xid int64, export *Export) error                    // 导出表(可传输表空间)
+	Attach(xid int64, attach *Attach) error                    // 挂载导出的表
+	Flashback(xid int64, flashback *Flashback) error           // 将表(或部分行)恢复到过去某个时刻的状态
+	Swap(xid int64, swap *Swap) error                          // 原子地交换两张表的名字, 见swap.go
+	MigratePage(tbName string, pageId int64) (int64, error)    // 在线迁移表中位于pageId页的行(独立的事物)
+	ReclaimOrphans(dryRun bool) ([]OrphanPage, error)          // 回收不可达的数据页(独立的事物)
+	Hotspots(tbName string, top int) ([]*TableHotspots, error) // 表的页事件统计以及插入热点(独立的事物)
+	TableSizes(tbName string) ([]*TableSize, error)            // 表的磁盘占用(独立的事物), 见tableSize.go
+	// OffloadCold 将表中idle时间内没有访问的区迁移到二级目录dir(独立的事物)
+	OffloadCold(tbName, dir string, idle time.Duration) (dataManager.TierStats, error)
+	// Vacuum 整理表所在的表空间, 回收失效DataItem占用的空间(独立的事物), 见vacuum.go
+	Vacuum(tbName string) (dataManager.VacuumStats, error)
+	Backup(dir, base string) (dataManager.BackupStats, error) // 在线备份, base为基准备份的目录(为空时全量备份)
+	BackupTo(w io.Writer) (dataManager.BackupStats, error)    // 流式在线备份
+	Scrub(all bool) (dataManager.ScrubStats, error)           // 校验上一次校验之后写回的页, all时为所有页
 
 	CreateField(xid int64, fieldName string, fieldType FieldType, indexed bool) (Field, error)
-	CreateTable(xid int64, tableName string, fields []*FieldCreate) (Table, error)
+	CreateTable(xid int64, tableName string, fields []*FieldCreate, engine string) (Table, error)
+
+	Status() versionManager.VmStatus         // 存储层的运行状态
+	ReportReplica(name string, lsn int64)    // 记录副本已经应用到的redo log LSN
+	CheckHealth(timeout time.Duration) error // 存储层的健康检查
+	Close()                                  // 停止后台整理以及压缩, 关闭存储层
+	// BeginStatement 开始xid的一条新语句, 读已提交时创建语句的读视图
+	BeginStatement(xid int64)
+	// EndStatement 结束xid的当前语句, 返回语句以及事物的执行统计, xid不是活跃事物时返回false
+	EndStatement(xid int64) (versionManager.ExecStats, versionManager.ExecStats, bool)
+	// SetStatementTimeout xid当前语句的最长执行时间, 超时则回滚事物
+	SetStatementTimeout(xid int64, timeout time.Duration)
+	PlanCacheStats() PlanCacheStats       // 执行计划缓存的命中统计
+	InvalidatePlans(tbName string)        // 表的结构或统计信息变化后使该表的执行计划失效
+	SetRetention(retention time.Duration) // 时间旅行查询(AS OF)的保留时间
+	SetPurgeWorkers(workers int)          // 清理失效DataItem的并行度
+	SetChangeSink(sink ChangeSink)        // 行级变更流(CDC), 见changeStream.go
+	// SetVacuumInterval 后台整理所有表的间隔, 0表示停止
+	SetVacuumInterval(interval time.Duration)
+	// SetColdCompression 自动压缩所有表中idle时间内没有访问的区, 0表示停止, 见coldCompression.go
+	SetColdCompression(idle time.Duration)
 
 	// TODO ADD INDEX
 
 	loadField(tb Table, uid int64) Field
 	loadTable(uid int64) Table
+	keys() *keyring // 列级加密的密钥, 见encryption.go
 }
 
 const (
@@ -49,12 +104,33 @@ const (
 type TMImpl struct {
 	vm          versionManager.VersionManager
 	im          indexManager.IndexManager // 保留字段, 实现索引后使用
-	tables      map[string]int64          // name -> uid
+	tables      map[string][]int64        // name -> 表的所有版本(uid), 见catalog.go
 	tableUid    map[int64]string          // ****uid -> name, 因为表的recordRaw不会增加，因此表的uid永远不会更新
 	bootFile    *os.File                  // bootFile里保存一个八字节长度tbUid, 为tb链表的头部，在每次数据库启动时，通过这个文件初始化tableUid
 	topTableUid int64
 	path        string
-	lock        *sync.RWMutex // 保护tables和tableUid(CreateTable和Show)
+	lock        *sync.RWMutex          // 保护tables和tableUid(CreateTable和Show)
+	engines     map[string]TableEngine // name -> engine
+	plans       *planCache             // SELECT执行计划缓存
+	fieldRaws   sync.Map               // 字段uid -> 字段的元数据, 字段创建之后不再修改, 读出之后缓存
+	sink        atomic.Pointer[ChangeSink]
+	rows        *rowCounter // 近似行数, 见rowCount.go
+	stats       *tableStats // 采样统计信息, 见analyze.go
+	vacuum      *vacuumWorker
+	compress    *compressWorker
+	dataOpts    []dataManager.Option // 打开DataManager的选项, 见WithDataOptions
+	ring        *keyring             // 列级加密的主密钥以及数据密钥, 见encryption.go
+	masterKey   []byte               // WithMasterKey传入的主密钥, 打开时设置到ring
+}
+
+// Option 打开TableManager时的选项
+type Option func(tm *TMImpl)
+
+// WithDataOptions 打开DataManager(页大小, 加密, 段大小等)的选项
+func WithDataOptions(opts ...dataManager.Option) Option {
+	return func(tm *TMImpl) {
+		tm.dataOpts = append(tm.dataOpts, opts...)
+	}
 }
 
 // error
@@ -65,6 +141,7 @@ type ErrorInvalidFieldName struct{}
 type ErrorUnsupportedOperationType struct{}
 type ErrorTableAlreadyExist struct{}
 type ErrorFieldNotExist struct{}
+type ErrorOutOfQueryMemory struct{}
 
 func (err *ErrorTableNotExist) Error() string {
 	return "Table doesn't exist"
@@ -86,24 +163,100 @@ func (err *ErrorTableAlreadyExist) Error() string {
 	return "This table is already created"
 }
 
+func (err *ErrorTableAlreadyExist) Is(target error) bool {
+	return target == dbError.ErrDuplicateKey
+}
+
 func (err *ErrorFieldNotExist) Error() string {
 	return "One or more field not exists in this table"
 }
 
+func (err *ErrorOutOfQueryMemory) Error() string {
+	return "Query exceeds the memory limit of its resource group"
+}
+
 func (tm *TMImpl) Begin() int64 {
 	return tm.vm.Begin()
 }
 
+func (tm *TMImpl) BeginWith(opts versionManager.TransactionOptions) int64 {
+	return tm.vm.BeginWith(opts)
+}
+
 func (tm *TMImpl) Commit(xid int64) {
 	tm.vm.Commit(xid)
+	tm.rows.commit(xid)
 }
 
 func (tm *TMImpl) Abort(xid int64) {
 	tm.vm.Abort(xid)
+	tm.rows.abort(xid)
+}
+
+func (tm *TMImpl) BeginBatch(xid int64) {
+	tm.vm.BeginBatch(xid)
+}
+
+func (tm *TMImpl) EndBatch(xid int64) {
+	tm.vm.EndBatch(xid)
 }
 
 // Show
 // 展示DB中的所有表
+func (tm *TMImpl) Status() versionManager.VmStatus {
+	return tm.vm.Status()
+}
+
+func (tm *TMImpl) ReportReplica(name string, lsn int64) {
+	tm.vm.ReportReplica(name, lsn)
+}
+
+func (tm *TMImpl) Backup(dir, base string) (dataManager.BackupStats, error) {
+	return tm.vm.Backup(dir, base)
+}
+
+func (tm *TMImpl) BackupTo(w io.Writer) (dataManager.BackupStats, error) {
+	return tm.vm.BackupTo(w)
+}
+
+func (tm *TMImpl) Scrub(all bool) (dataManager.ScrubStats, error) {
+	return tm.vm.Scrub(all)
+}
+
+func (tm *TMImpl) CheckHealth(timeout time.Duration) error {
+	return tm.vm.CheckHealth(timeout)
+}
+
+// Close 等待后台整理以及压缩退出之后关闭VersionManager, 调用方保证没有活跃的事物
+func (tm *TMImpl) Close() {
+	tm.SetVacuumInterval(0)
+	tm.SetColdCompression(0)
+	tm.vacuum.running.Wait()
+	tm.compress.running.Wait()
+	tm.vm.Close()
+	_ = tm.bootFile.Close()
+}
+
+func (tm *TMImpl) BeginStatement(xid int64) {
+	tm.vm.BeginStatement(xid)
+}
+
+func (tm *TMImpl) EndStatement(xid int64) (versionManager.ExecStats, versionManager.ExecStats, bool) {
+	return tm.vm.EndStatement(xid)
+}
+
+func (tm *TMImpl) SetStatementTimeout(xid int64, timeout time.Duration) {
+	tm.vm.SetStatementTimeout(xid, timeout)
+}
+
+func (tm *TMImpl) SetPurgeWorkers(workers int) {
+	tm.vm.SetPurgeWorkers(workers)
+}
+
+func (tm *TMImpl) SetRetention(retention time.Duration) {
+	tm.vm.SetRetention(retention)
+}
+
 func (tm *TMImpl) Show(xid int64) ([]*ResponseObject, error) {
 	// read快照读 所有UID， 不能直接使用tables, 因为会有版本问题
 	// title
@@ -124,36 +277,52 @@ func (tm *TMImpl) Show(xid int64) ([]*ResponseObject, error) {
 
 func (tm *TMImpl) Create(xid int64, create *Create) error {
 	// check table exists
-	tm.lock.RLock()
-	if _, ext := tm.tables[create.TbName]; ext {
-		return &ErrorTableAlreadyExist{}
+	if err := tm.lockCatalog(xid, create.TbName); err != nil {
+		return err
+	}
+	if ff := create.FillFactor; ff != 0 && (ff < dataManager.MinFillFactor || ff > dataManager.DefaultFillFactor) {
+		return &dataManager.ErrorInvalidFillFactor{}
+	}
+	tb, err := tm.CreateTable(xid, create.TbName, create.Fields, create.Engine)
+	if err != nil {
+		return err
+	}
+	if create.FillFactor != 0 {
+		if err := tm.vm.SetFillFactor(tb.GetSpace(), create.FillFactor); err != nil {
+			return err
+		}
+	}
+	if create.Unlogged {
+		if err := tm.vm.SetUnlogged(tb.GetSpace()); err != nil {
+			return err
+		}
+	}
+	if !create.Checksum {
+		return nil
 	}
-	tm.lock.RUnlock()
-	_, err := tm.CreateTable(xid, create.TbName, create.Fields)
-	return err
+	return tm.vm.SetChecksum(tb.GetSpace(), true)
 }
 
 // Insert
 // 需要修改主键
-func (tm *TMImpl) Insert(xid int64, insert *Insert) error {
+func (tm *TMImpl) Insert(xid int64, insert *Insert) ([]*ResponseObject, error) {
 	// check valid
-	if uid, err := tm.getTbUid(insert.TbName); err != nil {
-		return err
+	if uid, err := tm.getTbUid(xid, insert.TbName); err != nil {
+		return nil, err
 	} else {
-		record, err := tm.vm.ReadForUpdate(xid, uid, uid) // locks table
+		tb, engine, err := tm.tableForInsert(xid, uid) // locks table
 		if err != nil {
-			return err
-		}
-		if record == nil {
-			// never happened
-			return &ErrorTableNotExist{}
+			return nil, err
 		}
-		tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
 		// 该表对当前事物可见
 		// check valid
 		insertValueCount := len(insert.Values)
 		if insertValueCount != len(tb.GetFields())-1 {
-			return &ErrorInvalidFieldCount{}
+			return nil, &ErrorInvalidFieldCount{}
+		}
+		returning, err := tm.checkFieldNames(tb, insert.Returning)
+		if err != nil {
+			return nil, err
 		}
 		// TODO INDEX
 
@@ -163,54 +332,37 @@ func (tm *TMImpl) Insert(xid int64, insert *Insert) error {
 		for i, value := range insert.Values {
 			// to value
 			if ret, err := traverseStringToValue(tb.GetFields()[i+1].GetFType(), value); err != nil {
-				return err
+				return nil, err
 			} else {
 				values[i+1] = ret
 			}
 		}
-		if raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, int64(0), tb.GetFirstRecordUid(), values); err != nil {
-			return err
-		} else {
-			uid, err := tm.vm.Insert(xid, raw, tb.GetUid())
-			if err != nil {
-				return err
-			}
-			if tb.GetFirstRecordUid() != 0 {
-				// update
-				rc, err := tm.vm.ReadForUpdate(xid, tb.GetFirstRecordUid(), tb.GetUid())
-				if err != nil {
-					return err
-				}
-				oldFirstRow := DefaultRowFactory.NewRow(tb.GetFirstRecordUid(), tb, rc.GetData())
-				oldFirstRaw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, uid, oldFirstRow.GetNextUid(), oldFirstRow.GetValues())
-				if err != nil {
-					return err
-				}
-				newOldFirstUid, err := tm.vm.Update(xid, tb.GetFirstRecordUid(), tb.GetUid(), oldFirstRaw)
-				if newOldFirstUid != tb.GetFirstRecordUid() {
-					panic("Fatal error occurs when updating record row")
-				}
-			}
-			newTableRaw := DefaultTableFactory.WrapTableRaw(insert.TbName, tb.GetNextUid(), tb.GetFields(), uid, tb.GetPrimaryKey()+1)
-			// 当前事物一定已经获取表锁, 这个Update和上面的Insert一定是原子的
-			newUid, err := tm.vm.Update(xid, tb.GetUid(), tb.GetUid(), newTableRaw)
-			// **** newUid must equal to the current one
-			// assert
-			if newUid != tb.GetUid() {
-				panic("Error occurs when updating table meta data")
-			}
-			if err != nil {
-				return err
-			}
+		if _, err := engine.Insert(xid, tb, values); err != nil {
+			return nil, err
 		}
-		return nil
+		tm.emitChange(xid, tb, nil, values)
+		tm.vm.AddRows(xid, 0, 1)
+		return tm.wrapReturning(tb, insert.Returning, returning, [][]any{values}), nil
 	}
 }
 
 // Read
 // Select请求读取数据
 func (tm *TMImpl) Read(xid int64, sel *Select) ([]*ResponseObject, error) {
-	uid, err := tm.getTbUid(sel.TbName)
+	if key, ok := pointKey(sel); ok {
+		return tm.ReadKey(xid, sel, key)
+	}
+	if !sel.AsOf.IsZero() {
+		// 目录, 表的元数据以及所有行都读取AS OF时刻的版本
+		if sel.ReadForUpdate {
+			return nil, &ErrorUnsupportedOperationType{}
+		}
+		if err := tm.vm.BeginAsOf(xid, sel.AsOf); err != nil {
+			return nil, err
+		}
+		defer tm.vm.EndAsOf(xid)
+	}
+	uid, err := tm.getTbUid(xid, sel.TbName)
 	if err != nil {
 		return nil, err
 	}
@@ -218,69 +370,75 @@ func (tm *TMImpl) Read(xid int64, sel *Select) ([]*ResponseObject, error) {
 		return nil, &ErrorTableNotExist{}
 	} else {
 		tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
-		// check where condition valid
-		if sel.Where != nil && sel.Where.Compare != nil {
-			if err := tm.checkWhereCondition(tb, sel.Where); err != nil {
-				return nil, err
-			}
-		}
-		// check字段条件, 查找字段下标
-		targetFieldsId, er := tm.checkFieldNames(tb, sel.FNames)
-		if er != nil {
-			return nil, er
-		}
-		// read data
-		var (
-			rows []Row
-			err  error
-		)
-		if sel.ReadForUpdate {
-			rows, err = tm.searchAllForUpdate(xid, tb)
-		} else {
-			rows, err = tm.searchAll(xid, tb)
+		engine, err := tm.engineOf(tb)
+		if err != nil {
+			return nil, err
 		}
+		plan, err := tm.compilePlan(tb, sel)
 		if err != nil {
 			return nil, err
 		}
-		rowCnt := 1
-		// title
-		response := tm.wrapTableResponseTitle(sel.FNames)
-		// addResponse
-		for _, row := range rows {
-			if matchWhereCondition(row, tb, sel.Where) {
-				colCnt := 0
-				for _, target := range targetFieldsId {
-					// row.GetValues[target]
-					value, _ := fieldValueToString(tb.GetFields()[target].GetFType(), row.GetValues()[target])
-					response = append(response, &ResponseObject{
-						Payload: value,
-						RowId:   rowCnt,
-						ColId:   colCnt,
-					})
-					colCnt += 1
-				}
-				rowCnt += 1
+		// read data, filter & project
+		var values [][]string
+		if scanner, ok := engine.(ChunkScanner); ok && sel.Parallel > 1 && !sel.ReadForUpdate && tm.parallelWorthy(xid, tb) {
+			// 并行扫描
+			if values, err = tm.parallelScan(xid, tb, scanner, sel.Parallel, sel.MaxMemory, plan); err != nil {
+				return nil, err
 			}
+		} else {
+			rows, err := engine.Scan(xid, tb, sel.ReadForUpdate, sel.MaxMemory)
+			if err != nil {
+				return nil, err
+			}
+			tm.vm.AddRows(xid, int64(len(rows)), 0)
+			values = plan.execute(rows)
 		}
-		return response, nil
+		return tm.wrapRows(sel.FNames, values), nil
 	}
 }
 
+// wrapRows 标题以及查询结果
+func (tm *TMImpl) wrapRows(fNames []string, values [][]string) []*ResponseObject {
+	// title
+	response := tm.wrapTableResponseTitle(fNames)
+	// addResponse
+	for i, row := range values {
+		for j, value := range row {
+			response = append(response, &ResponseObject{Payload: value, RowId: i + 1, ColId: j})
+		}
+	}
+	return response
+}
+
+// Describe
+// 快照读表的元数据，返回表的所有字段(包括主键)
+func (tm *TMImpl) Describe(xid int64, tbName string) ([]Field, error) {
+	uid, err := tm.getTbUid(xid, tbName)
+	if err != nil {
+		return nil, err
+	}
+	record := tm.vm.Read(xid, uid)
+	if record == nil {
+		return nil, &ErrorTableNotExist{}
+	}
+	return DefaultTableFactory.NewTable(uid, record.GetData(), tm).GetFields(), nil
+}
+
 // Update
 // 上层必须确保在遇到error时回滚
-func (tm *TMImpl) Update(xid int64, update *Update) error {
-	uid, err := tm.getTbUid(update.TName)
+func (tm *TMImpl) Update(xid int64, update *Update) ([]*ResponseObject, error) {
+	uid, err := tm.getTbUid(xid, update.TName)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	record, err := tm.vm.ReadForUpdate(xid, uid, uid) // locks table
-	if record == nil {
-		return &ErrorTableNotExist{}
+	tb, err := tm.lockTable(xid, uid) // locks table
+	if err != nil {
+		return nil, err
 	}
+	engine, err := tm.engineOf(tb)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
 	// check update valid
 	var target = -1
 	for i, field := range tb.GetFields() {
@@ -290,206 +448,93 @@ func (tm *TMImpl) Update(xid int64, update *Update) error {
 		}
 	}
 	if target == -1 {
-		return &ErrorInvalidFieldName{}
+		return nil, &ErrorInvalidFieldName{}
 	}
+	returning, err := tm.checkFieldNames(tb, update.Returning)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// check where
 	if update.Where != nil && update.Where.Compare != nil {
 		if err := tm.checkWhereCondition(tb, update.Where); err != nil {
-			return err
+			return nil, err
 		}
 	}
-	rUid := tb.GetFirstRecordUid()
 	// check toUpdate match field type
 	value, err := traverseStringToValue(tb.GetFields()[target].GetFType(), update.ToUpdate)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for rUid != 0 {
-		record, err := tm.vm.ReadForUpdate(xid, rUid, tb.GetUid())
-		if err != nil {
-			tm.Abort(xid)
-			return err
-		}
-		row := DefaultRowFactory.NewRow(rUid, tb, record.GetData())
+	updated := make([][]any, 0)
+	rows, err := engine.Scan(xid, tb, true, 0)
+	if err != nil {
+		tm.Abort(xid)
+		return nil, err
+	}
+	for _, row := range rows {
 		if matchWhereCondition(row, tb, update.Where) {
-			row.GetValues()[target] = value // any value
-			if raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, row.GetPrevUid(), row.GetNextUid(), row.GetValues()); err != nil {
+			values := make([]any, len(row.GetValues()))
+			copy(values, row.GetValues())
+			values[target] = value // any value
+			if err := engine.Update(xid, tb, row, values); err != nil {
 				tm.Abort(xid)
-				return err
-			} else {
-				newUid, err := tm.vm.Update(xid, row.GetUid(), tb.GetUid(), raw)
-				if err != nil {
-					tm.Abort(xid)
-					return err
-				}
-				// uid change
-				if newUid != row.GetUid() {
-					prevUid := row.GetPrevUid()
-					nextUid := row.GetNextUid()
-					// modify prev
-					if prevUid != 0 {
-						// rewrite the previous row
-						rec, err := tm.vm.ReadForUpdate(xid, prevUid, tb.GetUid())
-						if err != nil {
-							tm.Abort(xid)
-							return err
-						}
-						previousRowRaw := rec.GetData()
-						row := DefaultRowFactory.NewRow(prevUid, tb, previousRowRaw)
-						if raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, row.GetPrevUid(), newUid, row.GetValues()); err != nil {
-							tm.Abort(xid)
-							return err
-						} else {
-							newPrevUid, err := tm.vm.Update(xid, prevUid, tb.GetUid(), raw)
-							if newPrevUid != prevUid {
-								panic("Fatal Error occurs when updating record raw")
-							}
-							if err != nil {
-								tm.Abort(xid)
-								return err
-							}
-						}
-					} else {
-						// rewrite the table
-						tableRaw := DefaultTableFactory.WrapTableRaw(tb.GetName(), tb.GetNextUid(), tb.GetFields(), newUid, tb.GetPrimaryKey())
-						newTableUid, err := tm.vm.Update(xid, tb.GetUid(), tb.GetUid(), tableRaw)
-						if newTableUid != tb.GetUid() {
-							panic("Fatal Error occurs when updating table metadata raw")
-						}
-						if err != nil {
-							tm.Abort(xid)
-							return err
-						}
-					}
-					// modify next
-					if nextUid != 0 {
-						// rewrite the next row
-						rec, err := tm.vm.ReadForUpdate(xid, nextUid, tb.GetUid())
-						if err != nil {
-							tm.Abort(xid)
-							return err
-						}
-						nextRowRaw := rec.GetData()
-						row := DefaultRowFactory.NewRow(nextUid, tb, nextRowRaw)
-						if raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, newUid, row.GetNextUid(), row.GetValues()); err != nil {
-							tm.Abort(xid)
-							return err
-						} else {
-							newNextUid, err := tm.vm.Update(xid, nextUid, tb.GetUid(), raw)
-							if newNextUid != nextUid {
-								panic("Fatal Error occurs when updating record raw")
-							}
-							if err != nil {
-								tm.Abort(xid)
-								return err
-							}
-						}
-					}
-				}
+				return nil, err
 			}
+			tm.emitChange(xid, tb, row.GetValues(), values)
+			updated = append(updated, values)
 		}
-		rUid = row.GetNextUid()
 	}
-	return nil
+	tm.vm.AddRows(xid, int64(len(rows)), int64(len(updated)))
+	return tm.wrapReturning(tb, update.Returning, returning, updated), nil
 }
 
 // Delete
 // 如果没有where子句，则代表删除全表所有的数据
-func (tm *TMImpl) Delete(xid int64, delete *Delete) error {
-	uid, err := tm.getTbUid(delete.TName)
+func (tm *TMImpl) Delete(xid int64, delete *Delete) ([]*ResponseObject, error) {
+	uid, err := tm.getTbUid(xid, delete.TName)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	record, err := tm.vm.ReadForUpdate(xid, uid, uid)
-	if record == nil {
-		return &ErrorTableNotExist{}
+	tb, err := tm.lockTable(xid, uid) // locks table
+	if err != nil {
+		return nil, err
 	}
+	engine, err := tm.engineOf(tb)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	returning, err := tm.checkFieldNames(tb, delete.Returning)
+	if err != nil {
+		return nil, err
 	}
-	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
 	// check where
-	if delete.Where != nil && delete.Where.Compare != nil {
-		if err := tm.checkWhereCondition(tb, delete.Where); err != nil {
-			return err
-		}
-	} else {
-		// delete all
-		return tm.deleteAll(xid, tb)
+	if err := tm.checkWhereCondition(tb, delete.Where); err != nil {
+		return nil, err
 	}
-	rUid := tb.GetFirstRecordUid()
-	for rUid != 0 {
-		record, err := tm.vm.ReadForUpdate(xid, rUid, tb.GetUid())
-		if err != nil {
-			tm.Abort(xid)
-			return err
-		}
-		row := DefaultRowFactory.NewRow(rUid, tb, record.GetData())
+	deleted := make([][]any, 0)
+	rows, err := engine.Scan(xid, tb, true, 0)
+	if err != nil {
+		tm.Abort(xid)
+		return nil, err
+	}
+	for _, row := range rows {
 		if matchWhereCondition(row, tb, delete.Where) {
-			if err := tm.vm.Delete(xid, row.GetUid(), tb.GetUid()); err != nil {
+			if err := engine.Delete(xid, tb, row); err != nil {
 				tm.Abort(xid)
-				return err
-			}
-			if row.GetPrevUid() == 0 {
-				// update table
-				newTbRaw := DefaultTableFactory.WrapTableRaw(tb.GetName(), tb.GetNextUid(), tb.GetFields(), row.GetNextUid(), tb.GetPrimaryKey())
-				if newTbUid, err := tm.vm.Update(xid, tb.GetUid(), tb.GetUid(), newTbRaw); err != nil {
-					tm.Abort(xid)
-					return err
-				} else if newTbUid != tb.GetUid() {
-					panic("Fatal Error occurs when updating table metadata raw")
-				}
-			} else {
-				// update previous
-				prevRecord, err := tm.vm.ReadForUpdate(xid, row.GetPrevUid(), tb.GetUid())
-				if err != nil {
-					tm.Abort(xid)
-					return err
-				}
-				prevRaw := prevRecord.GetData()
-				prevRow := DefaultRowFactory.NewRow(row.GetPrevUid(), tb, prevRaw)
-				raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, prevRow.GetPrevUid(), row.GetNextUid(), prevRow.GetValues())
-				if err != nil {
-					tm.Abort(xid)
-					return err
-				}
-				prevUid, err := tm.vm.Update(xid, prevRow.GetUid(), tb.GetUid(), raw)
-				if prevUid != row.GetPrevUid() {
-					panic("Fatal Error occurs when updating record raw")
-				} else if err != nil {
-					panic(fmt.Sprintf("Error occurs whne updating record raw, err = %s", err))
-				}
-			}
-			if row.GetNextUid() != 0 {
-				nextRecord, err := tm.vm.ReadForUpdate(xid, row.GetNextUid(), tb.GetUid())
-				if err != nil {
-					tm.Abort(xid)
-					return err
-				}
-				nextRaw := nextRecord.GetData()
-				nextRow := DefaultRowFactory.NewRow(row.GetNextUid(), tb, nextRaw)
-				raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, row.GetPrevUid(), nextRow.GetNextUid(), nextRow.GetValues())
-				if err != nil {
-					tm.Abort(xid)
-					return err
-				}
-				nextUid, err := tm.vm.Update(xid, nextRow.GetUid(), tb.GetUid(), raw)
-				if nextUid != row.GetNextUid() {
-					panic("Fatal Error occurs when updating record raw")
-				} else if err != nil {
-					panic(fmt.Sprintf("Error occurs when updating record raw, err = %s", err))
-				}
+				return nil, err
 			}
+			tm.emitChange(xid, tb, row.GetValues(), nil)
+			deleted = append(deleted, row.GetValues())
 		}
-		rUid = row.GetNextUid()
 	}
-	return nil
+	tm.vm.AddRows(xid, int64(len(rows)), int64(len(deleted)))
+	return tm.wrapReturning(tb, delete.Returning, returning, deleted), nil
 }
 
 func (tm *TMImpl) loadField(tb Table, uid int64) Field {
+	if data, ext := tm.fieldRaws.Load(uid); ext {
+		return DefaultFieldFactory.NewField(tb, uid, data.([]byte), tm.im)
+	}
 	record := tm.vm.Read(transactions.SuperXID, uid)
 	if record == nil {
 		panic("Error occurs when loading metadata of field")
@@ -497,17 +542,23 @@ func (tm *TMImpl) loadField(tb Table, uid int64) Field {
 	// RECORD
 	// [ROLLBACK]8[XID]8[Data length]8[DATA]
 	data := record.GetData()
+	tm.fieldRaws.Store(uid, data)
 	// [DATA] -> of field meta data
 	return DefaultFieldFactory.NewField(tb, uid, data, tm.im)
 }
 
 func (tm *TMImpl) CreateField(xid int64, fieldName string, fieldType FieldType, indexed bool) (Field, error) {
+	return tm.createField(xid, fieldName, fieldType, indexed, nil)
+}
+
+// createField dataKey不为nil时创建加密字段
+func (tm *TMImpl) createField(xid int64, fieldName string, fieldType FieldType, indexed bool, dataKey []byte) (Field, error) {
 	var indexUid int64 = 0
 	if indexed {
 		// TODO index
 		// indexUid = tm.im.CreateIndex(xid, DefaultFieldFactory.GetCompareFunction(fieldType))
 	}
-	raw := DefaultFieldFactory.WrapFieldRaw(fieldName, fieldType, indexUid) // format RECORD DATA
+	raw := DefaultFieldFactory.WrapFieldRaw(fieldName, fieldType, indexUid, dataKey) // format RECORD DATA
 	// insert metadata to dm
 	if uid, err := tm.vm.Insert(xid, raw, versionManager.MetaDataTbUid); err != nil {
 		return nil, err
@@ -528,8 +579,25 @@ func (tm *TMImpl) loadTable(uid int64) Table {
 // CreateTable
 // 创建表
 // 元数据, 不需要获取表锁
-// 创建表时，需要创建所有的Field
-func (tm *TMImpl) CreateTable(xid int64, tableName string, fields []*FieldCreate) (Table, error) {
+// 创建表时，需要创建所有的Field, 并为表创建独立的表空间
+// engine为空时使用默认引擎
+func (tm *TMImpl) CreateTable(xid int64, tableName string, fields []*FieldCreate, engine string) (Table, error) {
+	if engine == "" {
+		engine = HeapEngine
+	}
+	if _, ext := tm.engines[engine]; !ext {
+		return nil, &ErrorEngineNotExist{}
+	}
+	// 所有加密字段共用一个数据密钥
+	var dataKey []byte
+	for _, fc := range fields {
+		if fc.Encrypted && dataKey == nil {
+			var err error
+			if dataKey, err = tm.ring.newDataKey(); err != nil {
+				return nil, err
+			}
+		}
+	}
 	// CreateField
 	fs := make([]Field, len(fields))
 	for i, fc := range fields {
@@ -541,45 +609,85 @@ func (tm *TMImpl) CreateTable(xid int64, tableName string, fields []*FieldCreate
 		if err2 != nil {
 			return nil, err2
 		}
-		field, err := tm.CreateField(xid, fc.FName, fType, indexed)
+		var key []byte
+		if fc.Encrypted {
+			key = dataKey
+		}
+		field, err := tm.createField(xid, fc.FName, fType, indexed, key)
 		if err != nil {
 			return nil, err
 		}
 		fs[i] = field // Field的raw和table信息无关
 	}
-	raw := DefaultTableFactory.WrapTableRaw(tableName, tm.topTableUid, fs, 0, 0)
-	if uid, err := tm.vm.Insert(xid, raw, versionManager.MetaDataTbUid); err != nil {
+	space, err := tm.vm.CreateSpace()
+	if err != nil {
 		return nil, err
-	} else {
-		table := DefaultTableFactory.NewTable(uid, raw, tm)
-		for _, field := range fs {
-			field.SetTable(table)
-		}
-		// write lock
-		tm.lock.Lock()
-		defer tm.lock.Unlock()
-		if newFile, err := os.Create("tmp" + bootFileSuf); err != nil {
-			panic("Error occurs when creating temporary boot file")
-		} else {
-			buffer := bytes.NewBuffer([]byte{})
-			_ = binary.Write(buffer, binary.BigEndian, uid)
-			if _, err := newFile.Write(buffer.Bytes()); err != nil {
-				panic("Error occurs when writing temporary boot file")
-			} else {
-				// delete and rename
-				if err := os.Remove(tm.path + bootFileSuf); err != nil {
-					panic("Error occurs when writing temporary boot file")
-				}
-				if err := os.Rename(TMP+bootFileSuf, tm.path+bootFileSuf); err != nil {
-					panic("Error occurs when writing temporary boot file")
-				}
-			}
-		}
-		tm.tables[table.GetName()] = uid
-		tm.tableUid[uid] = table.GetName()
-		tm.topTableUid = uid
-		return table, nil
 	}
+	return tm.createTable(xid, tableName, fs, space, engine)
+}
+
+// createTable
+// 插入空表的元数据
+func (tm *TMImpl) createTable(xid int64, tableName string, fs []Field, space int64, engine string) (Table, error) {
+	table, err := tm.insertTable(xid, DefaultTableFactory.WrapTableRaw(tableName, tm.topTableUid, fs, 0, 0, space, engine))
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fs {
+		field.SetTable(table)
+	}
+	return table, nil
+}
+
+// insertTable
+// 插入表的元数据并更新表链表的头部, raw中的nextTable_uid为当前的头部
+func (tm *TMImpl) insertTable(xid int64, raw []byte) (Table, error) {
+	uid, err := tm.vm.Insert(xid, raw, versionManager.MetaDataTbUid)
+	if err != nil {
+		return nil, err
+	}
+	table := DefaultTableFactory.NewTable(uid, raw, tm)
+	if e, err := tm.engineOf(table); err != nil {
+		return nil, err
+	} else if err := e.Open(table); err != nil {
+		return nil, err
+	}
+	// write lock
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+	writeBootFile(tm.path, uid)
+	tm.tables[table.GetName()] = append(tm.tables[table.GetName()], uid)
+	tm.tableUid[uid] = table.GetName()
+	tm.topTableUid = uid
+	tm.plans.invalidate(table.GetName())
+	return table, nil
+}
+
+// writeBootFile
+// 先写入临时文件并刷盘, 再重命名覆盖boot文件, 崩溃时boot文件中为旧的或者新的头部
+func writeBootFile(path string, uid int64) {
+	tmp := bootTmpFile(path)
+	newFile, err := os.Create(tmp)
+	if err != nil {
+		panic("Error occurs when creating temporary boot file")
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	_ = binary.Write(buffer, binary.BigEndian, uid)
+	if _, err := newFile.Write(buffer.Bytes()); err != nil {
+		panic("Error occurs when writing temporary boot file")
+	}
+	if err := newFile.Sync(); err != nil {
+		panic("Error occurs when writing temporary boot file")
+	}
+	_ = newFile.Close()
+	if err := os.Rename(tmp, path+bootFileSuf); err != nil {
+		panic("Error occurs when writing temporary boot file")
+	}
+}
+
+// bootTmpFile 每个数据库的临时boot文件
+func bootTmpFile(path string) string {
+	return path + bootFileSuf + "." + TMP
 }
 
 func (tm *TMImpl) init() {
@@ -590,6 +698,7 @@ func (tm *TMImpl) init() {
 // loadTables
 // 载入所有表
 // 仅在启动时操作，不用加锁
+// 表链表中包括回滚的表, 只载入已经提交的表
 func (tm *TMImpl) loadTables() {
 	stat, _ := tm.bootFile.Stat()
 	if stat.Size() == 0 {
@@ -602,76 +711,38 @@ func (tm *TMImpl) loadTables() {
 	startUid := int64(binary.BigEndian.Uint64(buf))
 	tm.topTableUid = startUid
 	uid := startUid
+	xid := tm.vm.Begin()
+	defer tm.vm.Commit(xid)
+	truncated := make(map[int64]struct{})
+	for _, space := range tm.vm.TakeTruncated() {
+		truncated[space] = struct{}{}
+	}
 	for uid != 0 {
 		record := tm.vm.Read(transactions.SuperXID, uid)
 		tableRaw := record.GetData()
 		table := DefaultTableFactory.NewTable(uid, tableRaw, tm)
-		tm.tables[table.GetName()] = uid
-		tm.tableUid[uid] = table.GetName()
-		uid = table.GetNextUid()
-	}
-	log.Printf("[Table Manager] Load tables")
-}
-
-// SearchAll
-// 全表扫描
-func (tm *TMImpl) searchAll(xid int64, tb Table) ([]Row, error) {
-	uid := tb.GetFirstRecordUid()
-	var ret []Row
-	for uid != 0 {
-		record := tm.vm.Read(xid, uid)
-		row := DefaultRowFactory.NewRow(uid, tb, record.GetData())
-		ret = append(ret, row)
-		uid = row.GetNextUid()
-	}
-	return ret, nil
-}
-
-func (tm *TMImpl) searchAllForUpdate(xid int64, tb Table) ([]Row, error) {
-	uid := tb.GetFirstRecordUid()
-	var ret []Row
-	for uid != 0 {
-		if record, err := tm.vm.ReadForUpdate(xid, uid, tb.GetUid()); err != nil {
-			return nil, err
-		} else {
-			row := DefaultRowFactory.NewRow(uid, tb, record.GetData())
-			ret = append(ret, row)
-			uid = row.GetNextUid()
-		}
-	}
-	return ret, nil
-}
-
-func (tm *TMImpl) deleteAll(xid int64, tb Table) error {
-	if rows, err := tm.searchAllForUpdate(xid, tb); err != nil {
-		return err
-	} else {
-		for _, row := range rows {
-			if err := tm.vm.Delete(xid, row.GetUid(), tb.GetUid()); err != nil {
-				return err
+		if tm.vm.Read(xid, uid) == nil {
+			uid = table.GetNextUid()
+			continue
+		}
+		if _, ext := truncated[table.GetSpace()]; ext && table.GetFirstRecordUid() != 0 {
+			// 不记录日志的表在崩溃之后被清空
+			if err := UpdateTableMeta(tm.vm, xid, table, 0, table.GetPrimaryKey()); err != nil {
+				panic(fmt.Sprintf("Error occurs when loading table %s: %s", table.GetName(), err))
 			}
+			table = DefaultTableFactory.NewTable(uid, tm.vm.Read(xid, uid).GetData(), tm)
 		}
-		// update table
-		newTbRaw := DefaultTableFactory.WrapTableRaw(tb.GetName(), tb.GetNextUid(), tb.GetFields(), int64(0), tb.GetPrimaryKey())
-		if newUid, err := tm.vm.Update(xid, tb.GetUid(), tb.GetUid(), newTbRaw); err != nil {
-			return err
-		} else {
-			if newUid != tb.GetUid() {
-				panic("Fatal Error occurs when updating table metadata raw")
-			}
+		if e, err := tm.engineOf(table); err != nil {
+			panic(fmt.Sprintf("Error occurs when loading table %s: %s", table.GetName(), err))
+		} else if err := e.Open(table); err != nil {
+			panic(fmt.Sprintf("Error occurs when loading table %s: %s", table.GetName(), err))
 		}
-		return nil
-	}
-}
-
-func (tm *TMImpl) getTbUid(tbName string) (int64, error) {
-	tm.lock.RLock()
-	defer tm.lock.RUnlock()
-	if uid, ext := tm.tables[tbName]; !ext {
-		return -1, &ErrorTableNotExist{}
-	} else {
-		return uid, nil
+		// 链表从最新创建的表开始
+		tm.tables[table.GetName()] = append([]int64{uid}, tm.tables[table.GetName()]...)
+		tm.tableUid[uid] = table.GetName()
+		uid = table.GetNextUid()
 	}
+	log.Printf("[Table Manager] Load tables")
 }
 
 func (tm *TMImpl) getTbName(tbUid int64) (string, error) {
@@ -688,40 +759,33 @@ func (tm *TMImpl) checkWhereCondition(tb Table, where *Where) error {
 	if where == nil || where.Compare == nil {
 		return nil
 	}
-	fieldName := where.Compare.FieldName
-	find := false
-	for _, field := range tb.GetFields() {
-		if field.GetName() == fieldName {
-			find = true
-			if _, err := traverseStringToValue(field.GetFType(), where.Compare.Value); err != nil {
-				return err
-			}
-			break
-		}
-	}
-	if !find {
+	col, err := resolveColumn(tb, where.Compare.FieldName)
+	if _, ok := err.(*ErrorFieldNotExist); ok {
 		return &ErrorInvalidFieldName{}
+	} else if err != nil {
+		return err
+	}
+	if col.expr != nil {
+		// JSON路径提取的值可以是任意类型
+		return nil
+	}
+	if _, err := traverseStringToValue(tb.GetFields()[col.target].GetFType(), where.Compare.Value); err != nil {
+		return err
 	}
 	return nil
 }
 
-func (tm *TMImpl) checkFieldNames(tb Table, fNames []string) ([]int, error) {
-	target := make([]int, 0)
+// checkFieldNames 查找字段(或JSON路径表达式)对应的列
+func (tm *TMImpl) checkFieldNames(tb Table, fNames []string) ([]*column, error) {
+	columns := make([]*column, 0)
 	for _, fName := range fNames {
-		tar := -1
-		for i, field := range tb.GetFields() {
-			if fName == field.GetName() {
-				tar = i
-				break
-			}
-		}
-		if tar == -1 {
-			return nil, &ErrorFieldNotExist{}
-		} else {
-			target = append(target, tar)
+		col, err := resolveColumn(tb, fName)
+		if err != nil {
+			return nil, err
 		}
+		columns = append(columns, col)
 	}
-	return target, nil
+	return columns, nil
 }
 
 // used for select query
@@ -740,21 +804,39 @@ func (tm *TMImpl) wrapTableResponseTitle(fName []string) []*ResponseObject {
 	return res
 }
 
+// wrapReturning 将DML影响的行包装为RETURNING的结果
+// 没有RETURNING子句时返回nil
+func (tm *TMImpl) wrapReturning(tb Table, fNames []string, columns []*column, rows [][]any) []*ResponseObject {
+	if fNames == nil {
+		return nil
+	}
+	response := tm.wrapTableResponseTitle(fNames)
+	for i, values := range rows {
+		for j, col := range columns {
+			response = append(response, &ResponseObject{
+				Payload: col.toString(tb, values),
+				RowId:   i + 1,
+				ColId:   j,
+			})
+		}
+	}
+	return response
+}
+
 func matchWhereCondition(row Row, table Table, where *Where) bool {
 	if where == nil || where.Compare == nil {
 		return true
 	}
-	comparedField := where.Compare.FieldName
-	var target int
-	for i, field := range table.GetFields() {
-		if field.GetName() == comparedField {
-			target = i
-			break
-		}
+	col, err := resolveColumn(table, where.Compare.FieldName)
+	if err != nil {
+		return false
 	}
-	value1, _ := fieldValueToString(table.GetFields()[target].GetFType(), row.GetValues()[target]) // any type
+	value1 := col.toString(table, row.GetValues()) // any type
 	value2 := where.Compare.Value
-	compareFunction := DefaultFieldFactory.GetCompareFunction(table.GetFields()[target].GetFType())
+	compareFunction := DefaultFieldFactory.GetCompareFunction(table.GetFields()[col.target].GetFType())
+	if col.expr != nil {
+		compareFunction = func(a, b any) int { return compareJsonValue(a.(string), b.(string)) }
+	}
 	switch where.Compare.CompareTo {
 	case "=":
 		{
@@ -781,28 +863,46 @@ func matchWhereCondition(row Row, table Table, where *Where) bool {
 	}
 }
 
-func NewTableManager(path string, memory int64, mutex *sync.RWMutex, level versionManager.IsolationLevel) TableManager {
+// NewTableManager 同OpenTableManager, 打开失败时panic
+func NewTableManager(path string, memory, maxSize int64, mutex *sync.RWMutex, level versionManager.IsolationLevel, opts ...Option) TableManager {
+	tm, err := OpenTableManager(path, memory, maxSize, mutex, level, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return tm
+}
+
+// OpenTableManager 选项(例如主密钥)或者DataManager的选项不合法时返回错误, 此时没有打开任何文件
+func OpenTableManager(path string, memory, maxSize int64, mutex *sync.RWMutex, level versionManager.IsolationLevel, opts ...Option) (TableManager, error) {
 	tm := &TMImpl{
-		vm: versionManager.NewVersionManager(path, memory, &sync.RWMutex{}, level),
 		// TODO indexManager
-		tables:   map[string]int64{},
+		tables:   map[string][]int64{},
 		tableUid: map[int64]string{},
 		path:     path,
 		lock:     mutex,
+		plans:    newPlanCache(PlanCacheCapacity),
+		rows:     newRowCounter(),
+		stats:    newTableStats(),
+		vacuum:   &vacuumWorker{},
+		compress: &compressWorker{},
+		ring:     newKeyring(),
+	}
+	for _, opt := range opts {
+		opt(tm)
 	}
+	if err := tm.openKeyring(); err != nil {
+		return nil, err
+	}
+	vm, err := versionManager.OpenVersionManager(path, memory, maxSize, &sync.RWMutex{}, level, tm.dataOpts...)
+	if err != nil {
+		return nil, err
+	}
+	tm.vm = vm
 	if f, err := os.OpenFile(path+bootFileSuf, os.O_RDWR, 0666); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			if tryToOpenTmp() != nil {
-				tm.bootFile = f
-				// rename
-				if err := os.Rename(TMP+bootFileSuf, path+bootFileSuf); err != nil {
-					panic("Error occurs when initializing table manager")
-				}
-			} else {
-				f, err = os.Create(path + bootFileSuf)
-				if err != nil {
-					panic("Error occurs when initializing table manager")
-				}
+			f, err = os.Create(path + bootFileSuf)
+			if err != nil {
+				panic("Error occurs when initializing table manager")
 			}
 		} else {
 			panic("Error occurs when initializing table manager")
@@ -811,22 +911,11 @@ func NewTableManager(path string, memory int64, mutex *sync.RWMutex, level versi
 	} else {
 		tm.bootFile = f
 	}
-	// delete TMP
-	if err := os.Remove(TMP + bootFileSuf); err != nil && !errors.Is(err, os.ErrNotExist) {
+	// delete TMP, 重命名之前崩溃时boot文件仍然是完整的旧头部
+	if err := os.Remove(bootTmpFile(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
 		panic("Error occurs when initializing table manager")
 	}
+	tm.openEngines()
 	tm.init()
-	return tm
-}
-
-func tryToOpenTmp() *os.File {
-	if f, err := os.OpenFile(TMP+bootFileSuf, os.O_RDWR, 0666); err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
-		} else {
-			panic("Error occurs when initializing table manager")
-		}
-	} else {
-		return f
-	}
+	return tm, nil
 }
@@ -0,0 +1,54 @@
+package tableManager
+
+import (
+	"myDB/dataManager"
+	"sort"
+)
+
+// 表的磁盘占用
+// 每个表(以及它的索引)存放在独立的表空间中, 表的占用即表空间的占用(见dataManager/spaceSize.go), 按分配的字节数降序排列
+// 索引目前没有落盘的结构(indexManager为保留接口), 不单独统计; 系统表空间由多个表共享, 其中的表不参与统计
+
+type TableSize struct {
+	Table string
+	dataManager.SpaceSize
+}
+
+// TableSizes 在独立的事物中执行, tbName为空时返回所有表
+func (tm *TMImpl) TableSizes(tbName string) ([]*TableSize, error) {
+	xid := tm.vm.Begin()
+	defer tm.vm.Commit(xid)
+	names := []string{tbName}
+	if tbName == "" {
+		tm.lock.RLock()
+		names = make([]string, 0, len(tm.tables))
+		for name := range tm.tables {
+			names = append(names, name)
+		}
+		tm.lock.RUnlock()
+	}
+	ret := make([]*TableSize, 0)
+	for _, name := range names {
+		uid, err := tm.getTbUid(xid, name)
+		if err != nil {
+			if tbName != "" {
+				return nil, err
+			}
+			continue
+		}
+		tb := DefaultTableFactory.NewTable(uid, tm.vm.Read(xid, uid).GetData(), tm)
+		if tb.GetSpace() == dataManager.SystemSpace {
+			continue
+		}
+		size, err := tm.vm.SpaceSize(tb.GetSpace())
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &TableSize{Table: name, SpaceSize: size})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		return a.Allocated > b.Allocated || a.Allocated == b.Allocated && a.Table < b.Table
+	})
+	return ret, nil
+}
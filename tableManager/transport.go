@@ -0,0 +1,169 @@
+package tableManager
+
+import (
+	"encoding/json"
+	"log"
+	"myDB/dataManager"
+	"os"
+	"path/filepath"
+)
+
+// 可传输表空间
+// 每个表的数据存放在独立的表空间中，导出时直接拷贝表空间的数据文件，不需要逻辑导出
+// 导出目录中包含两个文件:
+// table.fds 表空间数据文件
+// table.meta 表的元数据(字段，第一条记录的uid，主键)，json格式
+// 加密字段的数据在表空间中仍然是密文, 元数据中只有被主密钥加密的数据密钥
+// 挂载时表空间会分配新的id，所有行中的prev/next uid需要改写到新的表空间中
+
+const (
+	ExportDataFile string = "table" + dataManager.FileSuffix
+	ExportMetaFile string = "table.meta"
+)
+
+type tableMeta struct {
+	Fields         []*fieldMeta `json:"Fields"`
+	FirstRecordUid int64        `json:"FirstRecordUid"`
+	PrimaryKey     int64        `json:"PrimaryKey"`
+	Space          int64        `json:"Space"` // 导出时的表空间id
+	Uid            int64        `json:"Uid"`   // 导出时的表uid, 加密字段的附加数据
+}
+
+type fieldMeta struct {
+	FName   string    `json:"FName"`
+	FType   FieldType `json:"FType"`
+	DataKey []byte    `json:"DataKey,omitempty"` // 加密字段被主密钥加密的数据密钥, 挂载时需要相同的主密钥
+}
+
+type ErrorNotTransportable struct{}
+type ErrorInvalidExport struct{}
+
+func (err *ErrorNotTransportable) Error() string {
+	return "The table is stored in the system table space and can not be exported"
+}
+
+func (err *ErrorInvalidExport) Error() string {
+	return "Invalid exported table files"
+}
+
+// Export
+// 持有表锁，保证导出期间没有其他事物修改该表
+func (tm *TMImpl) Export(xid int64, export *Export) error {
+	uid, err := tm.getTbUid(xid, export.TbName)
+	if err != nil {
+		return err
+	}
+	tb, err := tm.lockTable(xid, uid) // locks table
+	if err != nil {
+		return err
+	}
+	// 只有默认引擎的行链表可以迁移
+	if tb.GetSpace() == dataManager.SystemSpace || (tb.GetEngine() != "" && tb.GetEngine() != HeapEngine) {
+		return &ErrorNotTransportable{}
+	}
+	meta := &tableMeta{
+		Fields:         make([]*fieldMeta, len(tb.GetFields())),
+		FirstRecordUid: tb.GetFirstRecordUid(),
+		PrimaryKey:     tb.GetPrimaryKey(),
+		Space:          tb.GetSpace(),
+		Uid:            tb.GetUid(),
+	}
+	for i, f := range tb.GetFields() {
+		meta.Fields[i] = &fieldMeta{FName: f.GetName(), FType: f.GetFType(), DataKey: f.GetDataKey()}
+	}
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(export.Dir, 0755); err != nil {
+		return err
+	}
+	if err := tm.vm.ExportSpace(tb.GetSpace(), filepath.Join(export.Dir, ExportDataFile)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(export.Dir, ExportMetaFile), raw, 0666); err != nil {
+		return err
+	}
+	log.Printf("[Table Manager] Export table %s to %s\n", export.TbName, export.Dir)
+	return nil
+}
+
+// Attach
+// 挂载表空间并创建表的元数据，之后在当前事物中改写所有行的链表指针
+// 上层必须确保在遇到error时回滚
+// 回滚时已经挂载的表空间文件不会被删除
+func (tm *TMImpl) Attach(xid int64, attach *Attach) error {
+	if err := tm.lockCatalog(xid, attach.TbName); err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(filepath.Join(attach.Dir, ExportMetaFile))
+	if err != nil {
+		return err
+	}
+	meta := &tableMeta{}
+	if err := json.Unmarshal(raw, meta); err != nil || len(meta.Fields) == 0 {
+		return &ErrorInvalidExport{}
+	}
+	space, err := tm.vm.AttachSpace(filepath.Join(attach.Dir, ExportDataFile))
+	if err != nil {
+		return err
+	}
+	fs := make([]Field, len(meta.Fields))
+	for i, fm := range meta.Fields {
+		if fs[i], err = tm.createField(xid, fm.FName, fm.FType, false, fm.DataKey); err != nil {
+			return err
+		}
+	}
+	tb, err := tm.createTable(xid, attach.TbName, fs, space, HeapEngine)
+	if err != nil {
+		return err
+	}
+	if _, err := tm.vm.ReadForUpdate(xid, tb.GetUid(), tb.GetUid()); err != nil { // locks table
+		return err
+	}
+	// 改写行链表, 加密字段按导出时的表uid解密
+	source, err := columnsAs(tb, meta.Uid)
+	if err != nil {
+		return err
+	}
+	rUid := moveUid(meta.FirstRecordUid, space)
+	for rUid != 0 {
+		record, err := tm.vm.ReadForUpdate(xid, rUid, tb.GetUid())
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			return &ErrorInvalidExport{}
+		}
+		row, err := decodeRow(rUid, source, record.GetData())
+		if err != nil {
+			return err
+		}
+		raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, moveUid(row.GetPrevUid(), space), moveUid(row.GetNextUid(), space), row.GetValues())
+		if err != nil {
+			return err
+		}
+		if newUid, err := tm.vm.Update(xid, rUid, tb.GetUid(), raw); err != nil {
+			return err
+		} else if newUid != rUid {
+			panic("Fatal Error occurs when updating record raw")
+		}
+		rUid = moveUid(row.GetNextUid(), space)
+	}
+	tableRaw := DefaultTableFactory.WrapTableRaw(tb.GetName(), tb.GetNextUid(), tb.GetFields(), moveUid(meta.FirstRecordUid, space), meta.PrimaryKey, space, HeapEngine)
+	if newUid, err := tm.vm.Update(xid, tb.GetUid(), tb.GetUid(), tableRaw); err != nil {
+		return err
+	} else if newUid != tb.GetUid() {
+		panic("Fatal Error occurs when updating table metadata raw")
+	}
+	log.Printf("[Table Manager] Attach table %s from %s\n", attach.TbName, attach.Dir)
+	return nil
+}
+
+// moveUid 0表示空指针，不需要改写
+func moveUid(uid, space int64) int64 {
+	if uid == 0 {
+		return 0
+	}
+	return dataManager.MoveUid(uid, space)
+}
@@ -0,0 +1,98 @@
+package tableManager
+
+import (
+	"log"
+	"myDB/dataManager"
+	"myDB/simulation"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 整理(vacuum)
+// Vacuum整理表所在的表空间, 回收清理队列之外的失效DataItem(见versionManager/vacuum.go), 在独立的事物中执行
+// 后台整理: SetVacuumInterval(interval > 0)之后每隔interval按uid顺序整理所有的表, 0表示停止
+// 获取表锁失败(死锁, 锁等待超时)的表跳过, 下一轮重试
+
+type vacuumWorker struct {
+	lock     sync.Mutex
+	interval time.Duration
+	stop     chan struct{}
+	running  sync.WaitGroup // 后台协程退出, 见Close
+}
+
+// Vacuum 整理tbName
+func (tm *TMImpl) Vacuum(tbName string) (dataManager.VacuumStats, error) {
+	xid := tm.vm.Begin()
+	uid, err := tm.getTbUid(xid, tbName)
+	tm.vm.Commit(xid)
+	if err != nil {
+		return dataManager.VacuumStats{}, err
+	}
+	return tm.vacuumTable(uid)
+}
+
+func (tm *TMImpl) vacuumTable(uid int64) (dataManager.VacuumStats, error) {
+	xid := tm.vm.Begin()
+	record := tm.vm.Read(xid, uid)
+	tm.vm.Commit(xid)
+	if record == nil {
+		return dataManager.VacuumStats{}, &ErrorTableNotExist{}
+	}
+	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
+	return tm.vm.Vacuum(uid, tb.GetSpace())
+}
+
+// SetVacuumInterval 后台整理的间隔, 0表示停止
+func (tm *TMImpl) SetVacuumInterval(interval time.Duration) {
+	w := tm.vacuum
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+	w.interval = interval
+	if interval <= 0 {
+		return
+	}
+	w.stop = make(chan struct{})
+	w.running.Add(1)
+	go func(stop chan struct{}) {
+		defer w.running.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-simulation.After(interval):
+				tm.vacuumAll(stop)
+			}
+		}
+	}(w.stop)
+}
+
+// vacuumAll 依次整理所有的表, stop关闭时停止
+func (tm *TMImpl) vacuumAll(stop chan struct{}) {
+	tm.lock.RLock()
+	uids := make([]int64, 0, len(tm.tableUid))
+	for uid := range tm.tableUid {
+		uids = append(uids, uid)
+	}
+	tm.lock.RUnlock()
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	var items int64
+	for _, uid := range uids {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		stats, err := tm.vacuumTable(uid)
+		if err != nil {
+			log.Printf("[Table Manager] Skip vacuuming table %d: %s\n", uid, err)
+			continue
+		}
+		items += stats.Items
+	}
+	log.Printf("[Table Manager] Background vacuum reclaims %d items in %d tables\n", items, len(uids))
+}
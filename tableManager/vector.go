@@ -0,0 +1,172 @@
+package tableManager
+
+import (
+	"strconv"
+)
+
+// 向量化执行
+// Filter/Project 每次处理一批(VectorSize)行:
+// Filter 先取出条件字段的一列值, 再按字段类型用专门的循环与常量比较, 输出selection vector(选中行在批中的下标)
+// Project 按列将选中的行转换为字符串, 每列只判断一次字段类型
+// 条件中的常量只解析一次, 避免逐行调用compareFunction以及字符串与数值的相互转换
+
+const VectorSize int = 1024
+
+// vectorPlan 一次查询的Filter + Project
+type vectorPlan struct {
+	tb      Table
+	pred    *predicate // nil表示没有where条件
+	columns []*column
+}
+
+// predicate 单字段比较条件
+type predicate struct {
+	col     *column
+	fType   FieldType
+	accept  [3]bool // 比较结果(-1, 0, 1) + 1 是否满足条件
+	integer int64   // INT32, INT64
+	str     string  // STRING, JSON
+}
+
+// newVectorPlan where条件必须已经通过checkWhereCondition校验
+func newVectorPlan(tb Table, where *Where, columns []*column) (*vectorPlan, error) {
+	plan := &vectorPlan{tb: tb, columns: columns}
+	if where == nil || where.Compare == nil {
+		return plan, nil
+	}
+	col, err := resolveColumn(tb, where.Compare.FieldName)
+	if err != nil {
+		return nil, err
+	}
+	pred := &predicate{col: col, fType: tb.GetFields()[col.target].GetFType(), str: where.Compare.Value}
+	switch where.Compare.CompareTo {
+	case "=":
+		pred.accept = [3]bool{false, true, false}
+	case ">":
+		pred.accept = [3]bool{false, false, true}
+	case "<":
+		pred.accept = [3]bool{true, false, false}
+	case ">=":
+		pred.accept = [3]bool{false, true, true}
+	case "<=":
+		pred.accept = [3]bool{true, true, false}
+	}
+	if col.expr == nil && (pred.fType == INT32 || pred.fType == INT64) {
+		// 与compareFunction相同, 无法解析的常量视为0
+		v, _ := strconv.ParseInt(where.Compare.Value, 10, 64)
+		pred.integer = v
+	}
+	plan.pred = pred
+	return plan, nil
+}
+
+// execute 按批处理rows, 返回满足条件的行的投影
+func (plan *vectorPlan) execute(rows []Row) [][]string {
+	result := make([][]string, 0)
+	sel := make([]int, 0, VectorSize)
+	for start := 0; start < len(rows); start += VectorSize {
+		end := start + VectorSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := rows[start:end]
+		sel = sel[:0]
+		if plan.pred == nil {
+			for i := range batch {
+				sel = append(sel, i)
+			}
+		} else {
+			sel = plan.pred.filter(batch, sel)
+		}
+		result = plan.project(batch, sel, result)
+	}
+	return result
+}
+
+func (p *predicate) filter(batch []Row, sel []int) []int {
+	target := p.col.target
+	switch {
+	case p.col.expr != nil:
+		for i, row := range batch {
+			value := p.col.expr.extract(row.GetValues()[target].(string))
+			if p.accept[compareJsonValue(value, p.str)+1] {
+				sel = append(sel, i)
+			}
+		}
+	case p.fType == INT32 || p.fType == INT64:
+		ints := make([]int64, len(batch))
+		if p.fType == INT32 {
+			for i, row := range batch {
+				ints[i] = int64(row.GetValues()[target].(int32))
+			}
+		} else {
+			for i, row := range batch {
+				ints[i] = row.GetValues()[target].(int64)
+			}
+		}
+		for i, v := range ints {
+			c := 1
+			if v < p.integer {
+				c = 0
+			} else if v > p.integer {
+				c = 2
+			}
+			if p.accept[c] {
+				sel = append(sel, i)
+			}
+		}
+	case p.fType == JSON:
+		for i, row := range batch {
+			if p.accept[compareJsonValue(row.GetValues()[target].(string), p.str)+1] {
+				sel = append(sel, i)
+			}
+		}
+	default:
+		strs := make([]string, len(batch))
+		for i, row := range batch {
+			strs[i] = row.GetValues()[target].(string)
+		}
+		for i, v := range strs {
+			c := 1
+			if v < p.str {
+				c = 0
+			} else if v > p.str {
+				c = 2
+			}
+			if p.accept[c] {
+				sel = append(sel, i)
+			}
+		}
+	}
+	return sel
+}
+
+// project 将batch中选中的行按列转换为字符串追加到result
+func (plan *vectorPlan) project(batch []Row, sel []int, result [][]string) [][]string {
+	base := len(result)
+	for range sel {
+		result = append(result, make([]string, len(plan.columns)))
+	}
+	for j, col := range plan.columns {
+		target := col.target
+		switch {
+		case col.expr != nil:
+			for k, i := range sel {
+				result[base+k][j] = col.expr.extract(batch[i].GetValues()[target].(string))
+			}
+		case plan.tb.GetFields()[target].GetFType() == INT32:
+			for k, i := range sel {
+				result[base+k][j] = strconv.FormatInt(int64(batch[i].GetValues()[target].(int32)), 10)
+			}
+		case plan.tb.GetFields()[target].GetFType() == INT64:
+			for k, i := range sel {
+				result[base+k][j] = strconv.FormatInt(batch[i].GetValues()[target].(int64), 10)
+			}
+		default:
+			for k, i := range sel {
+				result[base+k][j] = batch[i].GetValues()[target].(string)
+			}
+		}
+	}
+	return result
+}
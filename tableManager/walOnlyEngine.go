@@ -0,0 +1,141 @@
+package tableManager
+
+import (
+	"myDB/versionManager"
+	"sync"
+)
+
+// walOnlyEngine WAL-only表, 用于只追加的事件表
+// 行的组织与默认引擎相同(新插入的行位于链表头部), 但是插入不维护版本链, 也不获取表锁:
+// 行以及表的元数据(第一行的uid, 主键计数器)都只记录redo log(见VersionManager的InsertRedoOnly), 提交之前对所有事物可见, 回滚时不撤销
+// 同一张表的并发插入由引擎内的表级闩锁串行化, 第一行的uid以及主键计数器保存在内存中, 打开表时从元数据载入
+// 只支持插入以及读取, 修改, 删除以及建立索引返回ErrorAppendOnly, 不支持在线迁移
+
+const WalOnlyEngine string = "walonly"
+
+type ErrorAppendOnly struct{}
+
+func (err *ErrorAppendOnly) Error() string {
+	return "WAL-only table is append-only"
+}
+
+// LockFreeEngine 插入不需要表锁的引擎, 由引擎自己保证并发插入的正确性
+type LockFreeEngine interface {
+	LockFree() bool
+}
+
+type walOnlyTable struct {
+	lock       sync.Mutex
+	first      int64
+	primaryKey int64
+}
+
+type walOnlyEngine struct {
+	heap   *heapEngine
+	vm     versionManager.VersionManager
+	lock   sync.Mutex
+	tables map[int64]*walOnlyTable // 表uid -> 追加位置
+}
+
+func NewWalOnlyEngine(vm versionManager.VersionManager) TableEngine {
+	return &walOnlyEngine{heap: &heapEngine{vm: vm, keys: newKeyDirectory()}, vm: vm, tables: map[int64]*walOnlyTable{}}
+}
+
+func (w *walOnlyEngine) Name() string {
+	return WalOnlyEngine
+}
+
+func (w *walOnlyEngine) LockFree() bool {
+	return true
+}
+
+func (w *walOnlyEngine) Open(tb Table) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.tables[tb.GetUid()] = &walOnlyTable{first: tb.GetFirstRecordUid(), primaryKey: tb.GetPrimaryKey()}
+	return nil
+}
+
+func (w *walOnlyEngine) tableOf(tb Table) *walOnlyTable {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	t, ext := w.tables[tb.GetUid()]
+	if !ext {
+		t = &walOnlyTable{first: tb.GetFirstRecordUid(), primaryKey: tb.GetPrimaryKey()}
+		w.tables[tb.GetUid()] = t
+	}
+	return t
+}
+
+// Insert
+// values[0]改写为引擎分配的主键
+func (w *walOnlyEngine) Insert(xid int64, tb Table, values []any) (int64, error) {
+	t := w.tableOf(tb)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	values[0] = t.primaryKey
+	raw, err := DefaultRowFactory.WrapRowRaw(tb, RECORD, int64(0), t.first, values)
+	if err != nil {
+		return -1, err
+	}
+	uid, err := w.vm.InsertRedoOnly(xid, raw, tb.GetSpace())
+	if err != nil {
+		return -1, err
+	}
+	meta := DefaultTableFactory.WrapTableRaw(tb.GetName(), tb.GetNextUid(), tb.GetFields(), uid, t.primaryKey+1, tb.GetSpace(), tb.GetEngine())
+	if err := w.vm.UpdateRedoOnly(xid, tb.GetUid(), meta); err != nil {
+		return -1, err
+	}
+	t.first, t.primaryKey = uid, t.primaryKey+1
+	w.heap.keys.put(tb.GetUid(), values[0].(int64), uid)
+	return uid, nil
+}
+
+func (w *walOnlyEngine) ReadByKey(xid int64, tb Table, key int64) (Row, error) {
+	return w.heap.ReadByKey(xid, tb, key)
+}
+
+// Scan 表的元数据原地修改, 快照读到的第一行总是最新的
+func (w *walOnlyEngine) Scan(xid int64, tb Table, forUpdate bool, maxMemory int64) ([]Row, error) {
+	return w.heap.Scan(xid, tb, forUpdate, maxMemory)
+}
+
+func (w *walOnlyEngine) ScanChunks(xid int64, tb Table, maxMemory int64, chunks chan<- *ScanChunk) error {
+	return w.heap.ScanChunks(xid, tb, maxMemory, chunks)
+}
+
+func (w *walOnlyEngine) ScanFrom(xid int64, tb Table, rv *versionManager.ReadView, uid int64, n int) ([]Row, int64, error) {
+	return w.heap.ScanFrom(xid, tb, rv, uid, n)
+}
+
+func (w *walOnlyEngine) Update(xid int64, tb Table, row Row, values []any) error {
+	return &ErrorAppendOnly{}
+}
+
+func (w *walOnlyEngine) Delete(xid int64, tb Table, row Row) error {
+	return &ErrorAppendOnly{}
+}
+
+func (w *walOnlyEngine) CreateIndex(xid int64, tb Table, field Field) error {
+	return &ErrorAppendOnly{}
+}
+
+// tableForInsert 获取表锁并当前读表的元数据, 不需要表锁的引擎只快照读
+func (tm *TMImpl) tableForInsert(xid, uid int64) (Table, TableEngine, error) {
+	record := tm.vm.Read(xid, uid)
+	if record == nil {
+		return nil, nil, &ErrorTableNotExist{}
+	}
+	tb := DefaultTableFactory.NewTable(uid, record.GetData(), tm)
+	engine, err := tm.engineOf(tb)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lf, ok := engine.(LockFreeEngine); ok && lf.LockFree() {
+		return tb, engine, nil
+	}
+	if tb, err = tm.lockTable(xid, uid); err != nil {
+		return nil, nil, err
+	}
+	return tb, engine, nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"myDB/dataManager"
+	"sync"
 	"testing"
 )
 
@@ -8,3 +10,28 @@ import (
 func TestRedoLog(t *testing.T) {
 	//_ = dataManager.OpenRedoLog("./test")
 }
+
+// 批量模式下的日志在EndBatch时通过一次writev写入
+func TestRedoLogBatch(t *testing.T) {
+	redo := dataManager.CreateRedoLog(t.TempDir()+"/batch", &sync.Mutex{})
+	defer redo.Close()
+	redo.ResetLog()
+	var xid int64 = 7
+	redo.BeginBatch(xid)
+	for i := 1; i <= 3; i++ {
+		raw := dataManager.WrapDataItemRaw(make([]byte, i))
+		redo.UpdateLog(int64(i)<<32, xid, raw, raw)
+	}
+	if redo.Next() != nil {
+		t.Fatalf("batched logs should not be written before EndBatch")
+	}
+	redo.EndBatch(xid)
+	for i := 1; i <= 3; i++ {
+		if data := redo.Next(); data == nil {
+			t.Fatalf("expect log %d after EndBatch", i)
+		}
+	}
+	if redo.Next() != nil {
+		t.Fatalf("expect 3 logs")
+	}
+}
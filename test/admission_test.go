@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"myDB/server/iface"
+	"myDB/server/network"
+	"myDB/server/utils"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConnection 记录发送给客户端的消息, 用于直接驱动DbRouter
+type fakeConnection struct {
+	lock       sync.Mutex
+	properties map[string]interface{}
+	messages   []string
+}
+
+func newFakeConnection() *fakeConnection {
+	return &fakeConnection{properties: map[string]interface{}{}}
+}
+
+func (c *fakeConnection) Start()                               {}
+func (c *fakeConnection) Stop()                                {}
+func (c *fakeConnection) GetTcpConnection() *net.TCPConn       { return nil }
+func (c *fakeConnection) GetConnId() uint32                    { return 1 }
+func (c *fakeConnection) GetClientTcpStatus() net.Addr         { return nil }
+func (c *fakeConnection) HasClosed() bool                      { return false }
+func (c *fakeConnection) GetMsgHandler() iface.IMessageHandler { return nil }
+
+func (c *fakeConnection) SendMessage(data []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.messages = append(c.messages, string(data))
+}
+
+func (c *fakeConnection) SetConnectionProperty(key string, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.properties[key] = value
+}
+
+func (c *fakeConnection) GetConnectionProperty(key string) interface{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.properties[key]
+}
+
+func (c *fakeConnection) RemoveConnectionProperty(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.properties, key)
+}
+
+// last 最后一条回复
+func (c *fakeConnection) last() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.messages) == 0 {
+		return ""
+	}
+	return c.messages[len(c.messages)-1]
+}
+
+type fakeRequest struct {
+	conn iface.IConnection
+	args []string
+}
+
+func (r *fakeRequest) GetConnection() iface.IConnection { return r.conn }
+func (r *fakeRequest) GetArgs() []string                { return r.args }
+
+// handle 在conn上执行一条语句, 返回服务器的回复
+func handle(router iface.IRouter, conn *fakeConnection, stmt string) string {
+	iface.Handle(router, &fakeRequest{conn: conn, args: strings.Fields(stmt)})
+	return conn.last()
+}
+
+// withServerConfig 修改全局配置, 测试结束之后恢复
+func withServerConfig(t *testing.T, update func(cfg *utils.GlobalConfig)) {
+	saved := *utils.GlobalObj
+	update(utils.GlobalObj)
+	t.Cleanup(func() { *utils.GlobalObj = saved })
+}
+
+// 超过并发上限的查询排队, 队列已满时拒绝, 排队超时返回ErrorQueueTimeout; 返回错误的查询不占用槽位
+func TestAdmissionControl(t *testing.T) {
+	timeout := 200 * time.Millisecond
+	ac := network.NewAdmissionControl(2, 1, timeout)
+	for i := 0; i < 2; i++ {
+		if err := ac.Acquire(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第三个查询排队, 直到有查询结束
+	queued := make(chan error, 1)
+	go func() { queued <- ac.Acquire() }()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-queued:
+		t.Fatalf("query over the limit isn't queued, %v", err)
+	default:
+	}
+	// 队列已满
+	if err := ac.Acquire(); !errors.As(err, new(*network.ErrorServerBusy)) {
+		t.Fatalf("expect server busy, got %v", err)
+	}
+	ac.Release()
+	if err := <-queued; err != nil {
+		t.Fatal(err)
+	}
+
+	// 排队超时
+	start := time.Now()
+	if err := ac.Acquire(); !errors.As(err, new(*network.ErrorQueueTimeout)) {
+		t.Fatalf("expect queue timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Fatalf("query times out after %s", elapsed)
+	}
+
+	// 被拒绝以及超时的查询没有占用槽位与队列位置
+	ac.Release()
+	ac.Release()
+	for i := 0; i < 2; i++ {
+		if err := ac.Acquire(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go func() { queued <- ac.Acquire() }()
+	time.Sleep(50 * time.Millisecond)
+	ac.Release()
+	if err := <-queued; err != nil {
+		t.Fatalf("queue position is leaked, %v", err)
+	}
+}
+
+// 执行出错的查询同样释放槽位
+func TestAdmissionReleaseOnError(t *testing.T) {
+	withServerConfig(t, func(cfg *utils.GlobalConfig) {
+		cfg.MaxConcurrentQueries, cfg.MaxQueuedQueries, cfg.QueueTimeout = 1, 0, 100
+	})
+	router := network.NewDbRouter(t.TempDir()+"/admission", 1<<20, 0, 0)
+	conn := newFakeConnection()
+	for i := 0; i < 3; i++ {
+		if reply := handle(router, conn, "select a from missing"); !strings.HasPrefix(reply, "-") || strings.Contains(reply, "busy") {
+			t.Fatalf("unexpected reply %q", reply)
+		}
+	}
+	if reply := handle(router, conn, "create t { a string }"); strings.HasPrefix(reply, "-") {
+		t.Fatalf("slot isn't released after errors, %q", reply)
+	}
+}
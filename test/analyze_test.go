@@ -0,0 +1,66 @@
+package main
+
+import (
+	"myDB/executor"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ANALYZE只读取约percent%的页, 按样本估计行数以及不同值的个数; 采样所有页时与表的内容一致, 溢出段不计为行
+func TestAnalyzeSample(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/analyze", 1<<20, 0, 1)
+	execAll(t, db, true, "create t { k int64 , c string , note string }")
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	for i := 0; i < 3000; i++ {
+		stmt := []string{"insert", "t", "values", strconv.Itoa(i), "c" + strconv.Itoa(i%10), strings.Repeat("n", 40)}
+		if i == 1500 {
+			stmt[5] = strings.Repeat("L", 20000)
+		}
+		if _, _, err := db.Execute(xid, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Execute(xid, []string{"commit"})
+	execAll(t, db, true, "delete t where k < 100")
+
+	stats := func(query string) map[string][]string {
+		_, res, err := db.Execute(-1, strings.Fields(query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret := map[string][]string{}
+		for _, row := range joinRows(res) {
+			fields := strings.Fields(row)
+			ret[fields[0]] = fields[1:]
+		}
+		return ret
+	}
+	full := stats("analyze t sample 100")
+	if k := full["k"]; len(k) != 5 || k[0] != "2900" || k[1] != "2900" || k[2] != "100" || k[3] != "2999" {
+		t.Fatalf("unexpected full sample stats %v", full)
+	}
+	if c := full["c"]; c[1] != "10" || c[2] != "c0" || c[3] != "c9" {
+		t.Fatalf("unexpected full sample stats %v", full)
+	}
+
+	part := stats("analyze t sample 20")
+	k := part["k"]
+	pages := strings.Split(k[4], "/")
+	sampled, _ := strconv.Atoi(pages[0])
+	total, _ := strconv.Atoi(pages[1])
+	if total < 20 || sampled > total/4+1 || sampled < total/5 {
+		t.Fatalf("unexpected sampled pages %s", k[4])
+	}
+	rows, _ := strconv.Atoi(k[0])
+	distinct, _ := strconv.Atoi(k[1])
+	if rows < 2000 || rows > 3800 || distinct < rows/2 || distinct > rows {
+		t.Fatalf("unexpected estimates %v", k)
+	}
+	if c := part["c"]; c[1] != "10" {
+		t.Fatalf("unexpected distinct estimate of a low cardinality field %v", c)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("analyze t sample 0")); err == nil {
+		t.Fatalf("expect error for an invalid sample percent")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/binary"
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestArrowResult(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/arrow", 1<<20, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create t { name string , age int32 }"))
+	for _, v := range []string{"a 1", "bb 2"} {
+		db.Execute(xid, strings.Fields("insert t values "+v))
+	}
+	_, table, err := db.ExecuteArrow(&executor.Session{Database: executor.DefaultDatabase}, xid, strings.Fields("select ID name age from t"))
+	if err != nil || len(table.Batches) != 1 || table.Batches[0].Length != 2 {
+		t.Fatalf("execute arrow failed, err = %v", err)
+	}
+	// 最后插入的行在前
+	if table.Value(0, 0, 1) != "bb" || table.Value(0, 1, 2) != "1" || table.Batches[0].Columns[0].Int64s[0] != 1 {
+		t.Fatalf("unexpected arrow values")
+	}
+	stream := table.Encode()
+	n := len(stream)
+	if binary.LittleEndian.Uint32(stream) != 0xffffffff || binary.LittleEndian.Uint32(stream[n-8:]) != 0xffffffff ||
+		binary.LittleEndian.Uint32(stream[n-4:]) != 0 || binary.LittleEndian.Uint32(stream[4:])%8 != 0 {
+		t.Fatalf("invalid arrow ipc stream")
+	}
+	db.Execute(xid, []string{"commit"})
+}
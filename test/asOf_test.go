@@ -0,0 +1,46 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectAsOf(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/asof", 1<<20, 0, 0)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create user { name string , age int64 }")); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, strings.Fields("insert user values tom 10"))
+	db.Execute(xid, []string{"commit"})
+	time.Sleep(2 * time.Millisecond)
+	before := time.Now().Format(time.RFC3339Nano)
+	time.Sleep(2 * time.Millisecond)
+
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("insert user values bob 20"))
+	db.Execute(xid, strings.Fields("update user set name = thomas_with_a_longer_name where age = 10"))
+	// 当前事物自己的修改对AS OF查询不可见
+	_, res, err := db.Execute(xid, strings.Fields("select name from user as of "+before))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[1].Payload != "tom" {
+		t.Fatalf("unexpected result as of the past, %d objects", len(res))
+	}
+	db.Execute(xid, []string{"commit"})
+
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	defer db.Execute(xid, []string{"commit"})
+	if _, res, _ := db.Execute(xid, strings.Fields("select name from user as of "+before+" where age = 20")); len(res) != 1 {
+		t.Fatalf("row inserted later is visible as of the past, %d objects", len(res))
+	}
+	if _, res, _ := db.Execute(xid, strings.Fields("select name from user")); len(res) != 3 {
+		t.Fatalf("unexpected current result, %d objects", len(res))
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("select name from user as of 1000")); err == nil {
+		t.Fatalf("expect error for timestamp out of the retention window")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"myDB/executor"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/audit.log"
+	db := executor.NewExecutor(dir+"/audit", 1<<20, 0, 0)
+	audit, err := executor.OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetAuditLog(audit)
+	alice := &executor.Session{Database: executor.DefaultDatabase, User: "alice", Client: "10.0.0.1:5000"}
+	bob := &executor.Session{Database: executor.DefaultDatabase, User: "bob", Client: "10.0.0.2:5000"}
+	run := func(session *executor.Session, xid int64, stmt string) int64 {
+		x, _, _ := db.ExecuteSession(session, xid, strings.Fields(stmt))
+		return x
+	}
+	xid := run(alice, -1, "begin")
+	run(alice, xid, "create account { owner string , balance int64 }")
+	run(alice, xid, "create orders { item string }")
+	run(alice, xid, "insert account values tom 100")
+	run(alice, xid, "commit")
+	xid = run(bob, -1, "begin")
+	run(bob, xid, "select owner balance from account")
+	run(bob, xid, "insert orders values book")
+	run(bob, xid, "select owner from missing")
+	run(bob, xid, "commit")
+	db.SetAuditLog(nil)
+	run(bob, -1, "notify cache flush")
+	audit.Close()
+
+	all, err := executor.ReadAuditLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 10 {
+		t.Fatalf("expect 10 audit records, got %d", len(all))
+	}
+	if r := all[3]; r.User != "alice" || r.Client != "10.0.0.1:5000" || r.Statement != "insert account values tom 100" || r.Xid == -1 {
+		t.Fatalf("unexpected audit record %+v", r)
+	}
+	if r := all[8]; r.Error == "" {
+		t.Fatalf("failed statement isn't recorded with its error %+v", r)
+	}
+	records, _ := executor.ReadAuditLog(path, &executor.AuditFilter{Table: "account"})
+	if len(records) != 3 || records[2].Statement != "select owner balance from account" {
+		t.Fatalf("unexpected records of table account %+v", records)
+	}
+	records, _ = executor.ReadAuditLog(path, &executor.AuditFilter{Table: "orders", User: "bob"})
+	if len(records) != 1 || records[0].Statement != "insert orders values book" {
+		t.Fatalf("unexpected records of bob on table orders %+v", records)
+	}
+
+	// 重新打开之后继续hash链
+	audit, err = executor.OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetAuditLog(audit)
+	run(alice, -1, "notify cache flush")
+	if seq, _ := audit.Head(); seq != 11 {
+		t.Fatalf("expect 11 records after reopening, got %d", seq)
+	}
+	audit.Close()
+
+	// 修改任意一条记录之后校验失败
+	raw, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.Replace(raw, []byte("tom 100"), []byte("tom 900"), 1), 0600)
+	if _, err := executor.ReadAuditLog(path, nil); err == nil {
+		t.Fatalf("tampered audit log is accepted")
+	}
+	if _, err := executor.OpenAuditLog(path); err == nil {
+		t.Fatalf("tampered audit log is opened")
+	}
+}
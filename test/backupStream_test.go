@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"sync"
+	"testing"
+)
+
+// 事物继续执行时写入流式备份, 恢复之后得到一致的状态: 已提交的修改都在, 未提交的修改被撤销
+func TestBackupStream(t *testing.T) {
+	dir := t.TempDir()
+	tm := transactions.NewTransactionManagerImpl(dir + "/src")
+	dm := dataManager.OpenDataManager(dir+"/src", 1<<20, 0, tm)
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf("stream backup %04d", i))
+	}
+	uids := make([]int64, 0)
+	for i := 0; i < 200; i++ {
+		uid, err := dm.Insert(transactions.SuperXID, value(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+	active := tm.Begin()
+	if _, err := dm.Update(active, uids[0], value(9999)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 备份期间并发的事物
+	stop := make(chan struct{})
+	var lock sync.Mutex
+	committed := make(map[int64]int)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			xid := tm.Begin()
+			uid, err := dm.Insert(xid, value(1000+i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := dm.Update(xid, uids[1+i%100], value(2000+i)); err != nil {
+				t.Error(err)
+				return
+			}
+			tm.Commit(xid)
+			lock.Lock()
+			committed[uid] = 1000 + i
+			lock.Unlock()
+		}
+	}()
+	// 写入流的头部之后等待并发的事物提交, 这些修改在StartLsn之后
+	var buf bytes.Buffer
+	var during map[int64]int
+	w := &hookWriter{w: &buf, hook: func() {
+		for {
+			lock.Lock()
+			if len(committed) >= 20 {
+				during = make(map[int64]int, len(committed))
+				for uid, i := range committed {
+					during[uid] = i
+				}
+				lock.Unlock()
+				return
+			}
+			lock.Unlock()
+		}
+	}}
+	stats, err := dm.BackupTo(w, nil)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pages == 0 || stats.Bytes != int64(buf.Len()) || stats.Lsn == 0 {
+		t.Fatalf("unexpected backup stats %+v, %d bytes written", stats, buf.Len())
+	}
+	tm.Commit(active)
+	stream := buf.Bytes()
+
+	if err := dataManager.RestoreStream(dir+"/bad", bytes.NewReader(stream[:len(stream)-10])); !errors.As(err, new(*dataManager.ErrorBackupStream)) {
+		t.Fatalf("expect truncated stream error, got %v", err)
+	}
+	if err := dataManager.RestoreStream(dir+"/src", bytes.NewReader(stream)); !errors.As(err, new(*dataManager.ErrorRestoreExists)) {
+		t.Fatalf("expect existing database error, got %v", err)
+	}
+	if err := dataManager.RestoreStream(dir+"/restored", bytes.NewReader(stream)); err != nil {
+		t.Fatal(err)
+	}
+	restored := dataManager.OpenDataManager(dir+"/restored", 1<<20, 0, transactions.NewTransactionManagerImpl(dir+"/restored"))
+	defer restored.Close()
+	for i, uid := range uids {
+		di, err := restored.Checked().Read(uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := string(di.GetData())
+		di.Release()
+		// 第一个DataItem被未提交的事物修改, 其余的可能被并发的事物修改
+		if i == 0 && data != string(value(0)) || i > 100 && data != string(value(i)) || len(data) != len(value(i)) {
+			t.Fatalf("unexpected restored data item %d: %q", i, data)
+		}
+	}
+	for uid, i := range during {
+		di, err := restored.Checked().Read(uid)
+		if err != nil || di == nil || string(di.GetData()) != string(value(i)) {
+			t.Fatalf("data item committed during backup is lost, %v", err)
+		}
+		di.Release()
+	}
+}
+
+// hookWriter 第一次写入之后调用hook
+type hookWriter struct {
+	w    *bytes.Buffer
+	hook func()
+	once sync.Once
+}
+
+func (h *hookWriter) Write(p []byte) (int, error) {
+	n, err := h.w.Write(p)
+	h.once.Do(h.hook)
+	return n, err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"myDB/dataManager"
+	"myDB/executor"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIncrementalBackup(t *testing.T) {
+	dir := t.TempDir()
+	db := executor.NewExecutor(dir+"/src", 8<<20, 0, 1)
+	execAll(t, db, true, "create hist { name string , payload string }", "create hot { name string , hits int64 }",
+		"insert hot values a 1", "insert hot values b 1")
+	lines := make([]string, 0)
+	for i := 0; i < 3000; i++ {
+		lines = append(lines, fmt.Sprintf("h%d\t%s", i, strings.Repeat("x", 400)))
+	}
+	file := dir + "/hist.tsv"
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("load hist from "+file+" batch 1000")); err != nil {
+		t.Fatal(err)
+	}
+	backup := func(stmt string) (int64, int64) {
+		_, res, err := db.Execute(-1, strings.Fields(stmt))
+		if err != nil {
+			t.Fatalf("%s: %s", stmt, err)
+		}
+		var id, base, lsn string
+		var pages, bytes int64
+		if _, err := fmt.Sscan(joinRows(res)[0], &id, &base, &lsn, &pages, &bytes); err != nil {
+			t.Fatal(err)
+		}
+		return pages, bytes
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("backup to "+dir+"/inc incremental from "+dir+"/none")); err == nil {
+		t.Fatalf("expect error without a base backup")
+	}
+	fullPages, fullBytes := backup("backup to " + dir + "/full")
+	if fullPages < 100 {
+		t.Fatalf("full backup copies %d pages", fullPages)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("backup to "+dir+"/full")); err == nil {
+		t.Fatalf("expect error for an existing backup")
+	}
+
+	// 增量备份只包含修改过的页以及追加的日志
+	execAll(t, db, true, "update hot set hits = 2 where name = a", "insert hot values c 1")
+	incPages, incBytes := backup("backup to " + dir + "/inc1 incremental from " + dir + "/full")
+	if incPages >= fullPages/10 || incBytes >= fullBytes/10 {
+		t.Fatalf("incremental backup isn't small, %d pages %d bytes, full %d pages %d bytes", incPages, incBytes, fullPages, fullBytes)
+	}
+	execAll(t, db, true, "update hot set hits = 3 where name = b", "delete hist where name = h7")
+	backup("backup to " + dir + "/inc2 incremental from " + dir + "/inc1")
+	execAll(t, db, true, "insert hot values d 1")
+	_, _, err := db.Execute(-1, strings.Fields("backup to "+dir+"/inc3 incremental from "+dir+"/inc1"))
+	var base *dataManager.ErrorBackupBase
+	if !errors.As(err, &base) {
+		t.Fatalf("expect base mismatch, got %v", err)
+	}
+
+	// 按顺序恢复全量以及增量备份
+	if err := dataManager.RestoreBackup(dir+"/bad", dir+"/full", dir+"/inc2"); !errors.As(err, &base) {
+		t.Fatalf("expect broken backup chain, got %v", err)
+	}
+	if _, err := os.Stat(dir + "/bad.fds"); !os.IsNotExist(err) {
+		t.Fatalf("broken backup chain is partially restored")
+	}
+	if err := dataManager.RestoreBackup(dir+"/restored", dir+"/full", dir+"/inc1", dir+"/inc2"); err != nil {
+		t.Fatal(err)
+	}
+	restored := executor.NewExecutor(dir+"/restored", 8<<20, 0, 1)
+	rows := viewRows(t, restored, "select name hits from hot")
+	if len(rows) != 3 || !contains(rows, "a 2") || !contains(rows, "b 3") || !contains(rows, "c 1") {
+		t.Fatalf("unexpected restored rows %v", rows)
+	}
+	if rows := viewRows(t, restored, "select name from hist"); len(rows) != 2999 || contains(rows, "h7") {
+		t.Fatalf("unexpected restored history, %d rows", len(rows))
+	}
+}
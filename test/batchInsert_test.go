@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"os"
+	"testing"
+)
+
+// 批量插入把一批DataItem写入尽量少的页, 省去每个DataItem的槽位和页头日志, 崩溃之后与逐条插入一样重做或撤销
+func TestInsertBatch(t *testing.T) {
+	path := t.TempDir() + "/batch"
+	tm := transactions.NewTransactionManagerImpl(path)
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, tm)
+	space, _ := dm.CreateSpace()
+	items := make([][]byte, 1000)
+	for i := range items {
+		items[i] = []byte(fmt.Sprintf("%04d%s", i, bytes.Repeat([]byte{'x'}, 96)))
+	}
+	items[500] = bytes.Repeat([]byte{'L'}, 20000)
+
+	single := tm.Begin()
+	for _, item := range items {
+		if _, err := dm.InsertIn(single, space, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tm.Commit(single)
+	batch := tm.Begin()
+	uids, err := dm.InsertBatchIn(batch, space, items)
+	if err != nil || len(uids) != len(items) {
+		t.Fatalf("unexpected batch insert, %d uids, %v", len(uids), err)
+	}
+	tm.Commit(batch)
+	if singleBytes, batchBytes := dm.TakeLogBytes(single), dm.TakeLogBytes(batch); batchBytes >= singleBytes*2/3 {
+		t.Fatalf("batch insert logs %d bytes, single inserts log %d bytes", batchBytes, singleBytes)
+	}
+	pages := map[int64]struct{}{}
+	for i, uid := range uids {
+		di := dm.Read(uid)
+		if di == nil || !bytes.Equal(di.GetData(), items[i]) {
+			t.Fatalf("unexpected data item %d", i)
+		}
+		di.Release()
+		pages[dataManager.PageOf(uid)] = struct{}{}
+	}
+	if len(pages) > len(items)*104/int(dataManager.DefaultPageSize)+4 {
+		t.Fatalf("batch insert uses %d pages", len(pages))
+	}
+	// 每个页只记录一条批量插入日志 [CheckSum]8 [Size]4[CheckSum]8[LogType]4[XID]8..., 溢出链按逐条插入记录
+	logBytes, err := os.ReadFile(path + dataManager.LogSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := 0
+	for offset := 8; offset+24 <= len(logBytes); {
+		size := int(binary.BigEndian.Uint32(logBytes[offset:]))
+		batchInsert := binary.BigEndian.Uint32(logBytes[offset+12:]) == 4
+		if batchInsert && int64(binary.BigEndian.Uint64(logBytes[offset+16:])) == batch {
+			records++
+		}
+		offset += 12 + size
+	}
+	if records != len(pages) {
+		t.Fatalf("batch insert into %d pages logs %d records", len(pages), records)
+	}
+
+	// 未提交的批量插入在崩溃之后撤销
+	aborted := tm.Begin()
+	lost, err := dm.InsertBatchIn(aborted, space, items[:300])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm = dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	for i, uid := range uids {
+		di := dm.Read(uid)
+		if di == nil || !bytes.Equal(di.GetData(), items[i]) {
+			t.Fatalf("committed data item %d isn't recovered", i)
+		}
+		di.Release()
+	}
+	for _, uid := range lost {
+		if di := dm.Read(uid); di != nil {
+			t.Fatalf("uncommitted data item survives a crash")
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestExecuteMany(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/batch", 1<<20, 0, 1)
+	stmt, params, err := executor.ParseExecuteMany(strings.Fields("executemany 7 insert user values ? ? returning ID tom 10 bob 20 ann 30"))
+	if err != nil || len(params) != 3 {
+		t.Fatalf("parse executemany failed, err = %v", err)
+	}
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create user { name string , age int64 }"))
+	_, res, err := db.ExecuteMany(&executor.Session{Database: executor.DefaultDatabase}, xid, stmt, params)
+	if err != nil || len(res) != 4 || res[3].Payload != "2" || res[3].RowId != 3 {
+		t.Fatalf("execute many failed, res = %v, err = %v", res, err)
+	}
+	if _, _, err := executor.ParseExecuteMany(strings.Fields("executemany 5 insert user values ? ? tom")); err == nil {
+		t.Fatalf("expect error for incomplete parameter set")
+	}
+	db.Execute(xid, []string{"commit"})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"myDB/executor"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBulkLoad(t *testing.T) {
+	dir := t.TempDir()
+	db := executor.NewExecutor(dir+"/bulk", 1<<20, 0, 1)
+	execAll(t, db, true, "create user { name string , age int64 }", "insert user values old 1")
+	lines := make([]string, 0)
+	for i := 0; i < 250; i++ {
+		lines = append(lines, fmt.Sprintf("u%d\t%d", i, i))
+	}
+	// 第231行字段数不对, 前两批导入之后中断
+	broken := append([]string(nil), lines...)
+	broken[230] = "bad"
+	file := dir + "/users.tsv"
+	if err := os.WriteFile(file, []byte(strings.Join(broken, "\n")+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	load := strings.Fields("load user from " + file + " batch 100")
+	if _, _, err := db.Execute(-1, load); err == nil {
+		t.Fatalf("expect error for a malformed row")
+	}
+	if rows := viewRows(t, db, "select name from user"); len(rows) != 201 {
+		t.Fatalf("committed batches are lost, %d rows", len(rows))
+	}
+
+	// 已经导入的部分被修改过时拒绝继续
+	changed := append([]string(nil), lines...)
+	changed[0] = "someone\t0"
+	if err := os.WriteFile(file, []byte(strings.Join(changed, "\n")+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(-1, load); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Fatalf("expect error for a changed input file, %v", err)
+	}
+	// 修正之后从中断的位置继续, 没有重复的行
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0666); err != nil {
+		t.Fatal(err)
+	}
+	_, res, err := db.Execute(-1, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joinRows(res); len(got) != 1 || got[0] != "user 50 200" {
+		t.Fatalf("unexpected load result %s", got)
+	}
+	names := viewRows(t, db, "select name from user")
+	if len(names) != 251 {
+		t.Fatalf("unexpected rows after resuming, %d", len(names))
+	}
+	sort.Strings(names)
+	for i := 1; i < len(names); i++ {
+		if names[i] == names[i-1] {
+			t.Fatalf("duplicate row %s", names[i])
+		}
+	}
+	if rows := viewRows(t, db, "select age from user where name = u249"); len(rows) != 1 || rows[0] != "249" {
+		t.Fatalf("unexpected last row %v", rows)
+	}
+	// 导入完成之后删除进度, 主键连续
+	if rows := viewRows(t, db, "select job from sys_bulk_loads"); len(rows) != 0 {
+		t.Fatalf("progress isn't removed, %v", rows)
+	}
+	if rows := viewRows(t, db, "select ID from user where name = u249"); len(rows) != 1 || rows[0] != "250" {
+		t.Fatalf("unexpected primary key %v", rows)
+	}
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, load); err == nil {
+		t.Fatalf("expect error for loading inside a transaction")
+	}
+	db.Execute(xid, []string{"abort"})
+}
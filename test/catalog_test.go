@@ -0,0 +1,57 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestVersionedCatalog(t *testing.T) {
+	path := t.TempDir() + "/catalog"
+	db := executor.NewExecutor(path, 1<<20, 0, 1)
+	// 事物开始之后创建的表对该事物不可见
+	old, _, _ := db.Execute(-1, []string{"begin"})
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create user { name string }")); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, strings.Fields("insert user values tom"))
+	db.Execute(xid, []string{"commit"})
+	if _, _, err := db.Execute(old, strings.Fields("select name from user")); err == nil {
+		t.Fatalf("table created after the transaction started is visible")
+	}
+	if _, _, err := db.Execute(old, strings.Fields("insert user values bob")); err == nil {
+		t.Fatalf("transaction writes into a table created after it started")
+	}
+	db.Execute(old, []string{"commit"})
+
+	// 回滚的DDL不会留在目录中
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create book { title string }")); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, []string{"abort"})
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create book { title string , pages int64 }")); err != nil {
+		t.Fatalf("table name of a rolled back create is still taken, %s", err)
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("create user { name string }")); err == nil {
+		t.Fatalf("expect error when creating an existing table")
+	}
+	db.Execute(xid, []string{"commit"})
+
+	// 重启之后只载入已经提交的表
+	db = executor.NewExecutor(path, 1<<20, 0, 1)
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	defer db.Execute(xid, []string{"commit"})
+	_, res, err := db.Execute(xid, []string{"show"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("unexpected tables after restart, %d objects", len(res))
+	}
+	if _, res, err := db.Execute(xid, strings.Fields("select title pages from book")); err != nil || len(res) != 2 {
+		t.Fatalf("unexpected schema of the recreated table, err = %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"myDB/dataManager"
+	"myDB/dbError"
+	"myDB/transactions"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Checked()返回的接口遇到非法的uid, 失效的DataItem以及损坏的数据时返回error而不是panic
+func TestCheckedDataManager(t *testing.T) {
+	path := t.TempDir() + "/checked"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	checked := dm.Checked()
+	space, _ := dm.CreateSpace()
+	if err := dm.SetChecksum(space, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checked.InsertIn(transactions.SuperXID, space+10, []byte("lost")); !errors.As(err, new(*dataManager.ErrorSpaceNotExist)) {
+		t.Fatalf("expect missing table space, got %v", err)
+	}
+	uid, err := checked.InsertIn(transactions.SuperXID, space, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if di, err := checked.Read(uid); err != nil || string(di.GetData()) != "value" {
+		t.Fatalf("unexpected read, %v", err)
+	} else {
+		di.Release()
+	}
+	if uid, err = checked.Update(transactions.SuperXID, uid, []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+
+	space, pageId, slot := dataManager.SplitUid(uid)
+	if _, err := checked.Read(dataManager.MakeUid(space, pageId+100, 0)); !errors.As(err, new(*dataManager.ErrorPageOverflow)) {
+		t.Fatalf("expect page overflow, got %v", err)
+	}
+	if _, err := checked.ReadSnapShot(dataManager.MakeUid(space, pageId, slot+5)); !errors.As(err, new(*dataManager.ErrorInvalidDataItem)) {
+		t.Fatalf("expect missing slot, got %v", err)
+	}
+	if err := checked.Delete(transactions.SuperXID, uid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checked.Read(uid); !errors.As(err, new(*dataManager.ErrorInvalidDataItem)) {
+		t.Fatalf("expect invalid data item, got %v", err)
+	}
+	if _, err := checked.Update(transactions.SuperXID, uid, []byte("v3")); !errors.As(err, new(*dataManager.ErrorInvalidDataItem)) {
+		t.Fatalf("expect invalid data item, got %v", err)
+	}
+	if err := checked.Delete(transactions.SuperXID, uid); !errors.As(err, new(*dataManager.ErrorInvalidDataItem)) {
+		t.Fatalf("expect invalid data item, got %v", err)
+	}
+
+	// 校验和不一致
+	uid, _ = checked.InsertIn(transactions.SuperXID, space, []byte("intact"))
+	di, _ := checked.Read(uid)
+	di.GetPage().GetData()[di.GetOffset()+dataManager.SzDIValid+dataManager.SzDIDataSize] = 'I'
+	defer di.Release()
+	_, err = checked.Read(uid)
+	var corrupt *dataManager.CorruptPage
+	if !errors.Is(err, dbError.ErrCorruptPage) || !errors.As(err, &corrupt) || corrupt.PageId != dataManager.PageOf(uid) {
+		t.Fatalf("expect corrupt page, got %v", err)
+	}
+	// 出错之后不持有页锁, 同一个页上的其他写入不会阻塞
+	if _, err := checked.Update(transactions.SuperXID, uid, []byte("v4")); !errors.Is(err, dbError.ErrCorruptPage) {
+		t.Fatalf("expect corrupt page when updating, got %v", err)
+	}
+	if err := checked.Delete(transactions.SuperXID, uid); !errors.Is(err, dbError.ErrCorruptPage) {
+		t.Fatalf("expect corrupt page when deleting, got %v", err)
+	}
+	other, err := checked.InsertIn(transactions.SuperXID, space, []byte("neighbour"))
+	if err != nil || dataManager.PageOf(other) != dataManager.PageOf(uid) {
+		t.Fatalf("neighbour isn't inserted into the same page, %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := checked.Update(transactions.SuperXID, other, []byte("neighbour2"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("page lock is leaked after an error")
+	}
+
+	// 检查有效与删除在同一个页锁内, 并发删除同一个DataItem只有一个成功
+	target, _ := checked.InsertIn(transactions.SuperXID, space, []byte("contended"))
+	var wg sync.WaitGroup
+	var deleted atomic.Int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := checked.Delete(transactions.SuperXID, target); err == nil {
+				deleted.Add(1)
+			} else if !errors.As(err, new(*dataManager.ErrorInvalidDataItem)) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if deleted.Load() != 1 {
+		t.Fatalf("data item is deleted %d times", deleted.Load())
+	}
+}
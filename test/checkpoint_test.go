@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"os"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := t.TempDir() + "/checkpoint"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	uid, err := dm.Insert(transactions.SuperXID, []byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 引用页, 修改后的脏页一直留在缓存中
+	di := dm.Read(uid)
+	defer di.Release()
+	if _, err := dm.Update(transactions.SuperXID, uid, []byte("after!")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path + dataManager.FileSuffix)
+	if !bytes.Contains(data, []byte("after!")) {
+		t.Fatalf("dirty page is not flushed by checkpoint")
+	}
+	redo := dm.Status().Redo
+	if redo.Checkpoint == 0 || redo.SyncedLsn != redo.Lsn {
+		t.Fatalf("unexpected log status after checkpoint %+v", redo)
+	}
+	// checkpoint记录在恢复时被跳过
+	raw, _ := os.ReadFile(path + dataManager.LogSuffix)
+	if _, err := dataManager.ParseLogBytes(raw); err != nil {
+		t.Fatalf("parse log with checkpoint failed, err = %v", err)
+	}
+}
+
+func TestSyncBarrier(t *testing.T) {
+	path := t.TempDir() + "/sync"
+	tm := transactions.NewTransactionManagerImpl(path)
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, tm)
+	xid := tm.Begin()
+	dm.BeginBatch(xid)
+	for _, data := range []string{"first", "second", "third"} {
+		if _, err := dm.Insert(xid, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if redo := dm.Status().Redo; redo.SyncedLsn == redo.Lsn {
+		t.Fatalf("batched log should not be synced before the barrier %+v", redo)
+	}
+	if err := dm.Sync(true); err != nil {
+		t.Fatal(err)
+	}
+	if redo := dm.Status().Redo; redo.SyncedLsn != redo.Lsn || redo.Checkpoint != 0 {
+		t.Fatalf("unexpected log status after the barrier %+v", redo)
+	}
+	dm.EndBatch(xid)
+	tm.Commit(xid)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"myDB/dataManager"
+	"myDB/transactions"
+	"strings"
+	"testing"
+)
+
+// 开启校验和的表空间中, 内存中被改写的DataItem在读取时被发现
+func TestDataItemChecksum(t *testing.T) {
+	path := t.TempDir() + "/checksum"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	space, err := dm.CreateSpace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.SetChecksum(space, true); err != nil {
+		t.Fatal(err)
+	}
+	uid, err := dm.InsertIn(transactions.SuperXID, space, []byte("high value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dm.Update(transactions.SuperXID, uid, []byte("high")); err != nil {
+		t.Fatal(err)
+	}
+	di := dm.Read(uid)
+	if di == nil || string(di.GetData()) != "high" {
+		t.Fatalf("unexpected data item after update")
+	}
+	// 不经过DataManager直接改写页中的数据, di引用的页不会被换出
+	di.GetPage().GetData()[di.GetOffset()+dataManager.SzDIValid+dataManager.SzDIDataSize] = 'H'
+	defer di.Release()
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(r.(string), "checksum mismatch") {
+				t.Fatalf("corruption isn't detected, recover = %v", r)
+			}
+		}()
+		dm.Read(uid)
+	}()
+	// 设置保存在元数据区
+	reopened := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	if _, ext := reopened.ReadMeta(dataManager.MetaChecksumSpaces); !ext {
+		t.Fatalf("checksum setting isn't persisted")
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"myDB/client/cli_core"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeServer 按照服务器的协议回复: ROLE返回角色, select返回服务器的名字, 备库拒绝其他语句, crash断开连接
+// hung时不回复任何请求(包括ROLE), 模拟挂起的服务器
+// listen回复之后推送一条通知, 内容为服务器的名字
+type fakeServer struct {
+	name     string
+	listener net.Listener
+	primary  atomic.Bool
+	hung     atomic.Bool
+	lock     sync.Mutex
+	conns    []net.Conn
+	executed []string
+}
+
+func startFakeServer(t *testing.T, name string, primary bool) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{name: name, listener: listener}
+	s.primary.Store(primary)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.lock.Lock()
+			s.conns = append(s.conns, conn)
+			s.lock.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(s.stop)
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// crash 断开所有连接, 不再接受新的连接
+func (s *fakeServer) stop() {
+	_ = s.listener.Close()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+func (s *fakeServer) statements() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string{}, s.executed...)
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	line := func() string {
+		l, _ := reader.ReadString('\n')
+		return strings.TrimSuffix(l, "\r\n")
+	}
+	for {
+		head := line()
+		if !strings.HasPrefix(head, "*") {
+			return
+		}
+		n, _ := strconv.Atoi(head[1:])
+		args := make([]string, n)
+		for i := range args {
+			line()
+			args[i] = line()
+		}
+		stmt := strings.Join(args, " ")
+		var reply string
+		switch {
+		case s.hung.Load():
+			continue
+		case stmt == "ROLE" && s.primary.Load():
+			reply = "+primary\r\n"
+		case stmt == "ROLE":
+			reply = "+standby\r\n"
+		case !s.primary.Load():
+			reply = "-ERROR: Not the primary server, current transaction has been aborted\n\r\n"
+		case strings.HasSuffix(stmt, "crash"):
+			return
+		case strings.HasPrefix(stmt, "select"):
+			reply = fmt.Sprintf("*3\r\n$1\r\n1\r\n$1\r\n1\r\n$%d\r\n%s\r\n", len(s.name), s.name)
+		case strings.HasPrefix(stmt, "listen"):
+			reply = fmt.Sprintf("+Query OK!\r\n>3\r\n$1\r\n1\r\n$1\r\n1\r\n$%d\r\n%s\r\n", len(s.name), s.name)
+		default:
+			reply = "+Query OK!\r\n"
+		}
+		if s.primary.Load() && stmt != "ROLE" {
+			s.lock.Lock()
+			s.executed = append(s.executed, stmt)
+			s.lock.Unlock()
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// 客户端在多个服务器中找到主库, 主库故障之后切换到新的主库并重试只读语句
+func TestClusterFailover(t *testing.T) {
+	a := startFakeServer(t, "a", false)
+	b := startFakeServer(t, "b", true)
+	cluster := cli_core.NewCluster(a.addr()+" , "+b.addr(), time.Second)
+	defer cluster.Close()
+	query := func(stmt string) string {
+		t.Helper()
+		reply, err := cluster.Execute(strings.Fields(stmt))
+		if err != nil {
+			t.Fatalf("%s: %s", stmt, err)
+		}
+		if reply.IsError() || len(reply.Values) == 0 {
+			t.Fatalf("%s: unexpected reply %v", stmt, reply.Values)
+		}
+		return reply.Values[len(reply.Values)-1]
+	}
+	if got := query("select name from t"); got != "b" || cluster.Primary() != b.addr() {
+		t.Fatalf("client doesn't discover the primary, got %s from %s", got, cluster.Primary())
+	}
+
+	// 主库故障, 备库接管之后读语句透明重试
+	b.stop()
+	a.primary.Store(true)
+	if got := query("select name from t"); got != "a" {
+		t.Fatalf("read isn't retried on the new primary, got %s", got)
+	}
+
+	// 写语句执行时连接断开, 可能已经执行, 不重试
+	if _, err := cluster.Execute(strings.Fields("insert t values crash")); !errors.As(err, new(*cli_core.ErrorFailover)) {
+		t.Fatalf("expect failover error, got %v", err)
+	}
+	// 被备库拒绝的写语句没有执行, 在新的主库上重试
+	c := startFakeServer(t, "c", true)
+	cluster = cli_core.NewCluster(a.addr()+","+c.addr(), time.Second)
+	query("insert t values 1")
+	a.primary.Store(false)
+	query("insert t values 2")
+	if stmts := c.statements(); strings.Join(stmts, ";") != "insert t values 2" {
+		t.Fatalf("rejected write isn't retried exactly once, %v", stmts)
+	}
+
+	// 事务中发生故障转移, 事务已经回滚, 不重试
+	query("begin")
+	c.primary.Store(false)
+	a.primary.Store(true)
+	if _, err := cluster.Execute(strings.Fields("select name from t")); !errors.As(err, new(*cli_core.ErrorFailover)) {
+		t.Fatalf("statement in a lost transaction is retried, %v", err)
+	}
+	if got := query("select name from t"); got != "a" {
+		t.Fatalf("client doesn't reconnect after the transaction fails, got %s", got)
+	}
+
+	// 没有主库
+	a.primary.Store(false)
+	start := time.Now()
+	if _, err := cluster.Execute(strings.Fields("select name from t")); !errors.As(err, new(*cli_core.ErrorNoPrimary)) {
+		t.Fatalf("expect no primary error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("discovery doesn't respect the failover timeout")
+	}
+}
+
+// 挂起的主库在超时之后按照故障处理, 不会无限期阻塞客户端
+func TestClusterHungPrimary(t *testing.T) {
+	a := startFakeServer(t, "a", true)
+	b := startFakeServer(t, "b", false)
+	timeout := 300 * time.Millisecond
+	cluster := cli_core.NewCluster(a.addr()+","+b.addr(), timeout)
+	defer cluster.Close()
+	if reply, err := cluster.Execute(strings.Fields("select name from t")); err != nil || reply.Values[len(reply.Values)-1] != "a" {
+		t.Fatalf("client doesn't connect to the primary, %v", err)
+	}
+
+	// 写语句可能已经执行, 超时之后返回ErrorFailover
+	a.hung.Store(true)
+	start := time.Now()
+	if _, err := cluster.Execute(strings.Fields("insert t values 1")); !errors.As(err, new(*cli_core.ErrorFailover)) {
+		t.Fatalf("expect failover error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > 5*timeout {
+		t.Fatalf("round trip doesn't respect the timeout, %s", elapsed)
+	}
+
+	// 重新寻找主库时跳过不回复ROLE的服务器
+	b.primary.Store(true)
+	reply, err := cluster.Execute(strings.Fields("select name from t"))
+	if err != nil || reply.Values[len(reply.Values)-1] != "b" || cluster.Primary() != b.addr() {
+		t.Fatalf("client doesn't fail over to the new primary, %v", err)
+	}
+
+	// 空闲超过超时时间的连接仍然可用
+	time.Sleep(2 * timeout)
+	if reply, err := cluster.Execute(strings.Fields("select name from t")); err != nil || reply.Values[len(reply.Values)-1] != "b" {
+		t.Fatalf("idle connection is broken, %v", err)
+	}
+}
+
+// 推送的通知由读协程交给OnPush, 不会被当作语句的回复; 故障转移之后新的连接同样接收通知
+func TestClusterPush(t *testing.T) {
+	a := startFakeServer(t, "a", false)
+	b := startFakeServer(t, "b", true)
+	cluster := cli_core.NewCluster(a.addr()+","+b.addr(), time.Second)
+	defer cluster.Close()
+	pushes := make(chan string, 4)
+	cluster.OnPush(func(reply *cli_core.Reply) {
+		pushes <- reply.Values[len(reply.Values)-1]
+	})
+	expect := func(name string) {
+		t.Helper()
+		reply, err := cluster.Execute(strings.Fields("listen ch"))
+		if err != nil || reply.Type != cli_core.STRING {
+			t.Fatalf("listen: %v %v", reply, err)
+		}
+		select {
+		case got := <-pushes:
+			if got != name {
+				t.Fatalf("expect notification from %s, got %s", name, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notification from %s isn't delivered", name)
+		}
+		// 通知之后的回复仍然属于下一条语句
+		if reply, err = cluster.Execute(strings.Fields("select name from t")); err != nil || reply.Values[len(reply.Values)-1] != name {
+			t.Fatalf("reply after notification is out of order: %v %v", reply, err)
+		}
+	}
+	expect("b")
+
+	b.stop()
+	a.primary.Store(true)
+	if _, err := cluster.Execute(strings.Fields("select name from t")); err != nil {
+		t.Fatal(err)
+	}
+	expect("a")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"testing"
+)
+
+// 批量事物反复原地更新同一个DataItem时合并日志, 崩溃恢复时重做以及撤销的结果不变
+func TestCoalesceBatchLog(t *testing.T) {
+	path := t.TempDir() + "/coalesce"
+	var tm transactions.TransactionManager
+	open := func() dataManager.DataManager {
+		tm = transactions.NewTransactionManagerImpl(path)
+		return dataManager.OpenDataManager(path, 1<<20, 0, tm)
+	}
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf("counter %04d", i))
+	}
+	expect := func(dm dataManager.DataManager, uid int64, want []byte) {
+		t.Helper()
+		if di := dm.Read(uid); di == nil || string(di.GetData()) != string(want) {
+			t.Fatalf("expect %q after recovery", want)
+		} else {
+			di.Release()
+		}
+	}
+	dm := open()
+	uid, err := dm.Insert(transactions.SuperXID, value(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 页没有被引用时每次更新之后换出, 写回之前日志写入文件, 不再合并
+	update := func(xid int64, batch bool) int64 {
+		if batch {
+			dm.BeginBatch(xid)
+			pin := dm.Read(uid)
+			defer pin.Release()
+		}
+		before := dm.Status().Redo.Lsn
+		for i := 1; i <= 100; i++ {
+			if _, err := dm.Update(xid, uid, value(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if batch {
+			dm.EndBatch(xid)
+		}
+		return dm.Status().Redo.Lsn - before
+	}
+	xid := tm.Begin()
+	unbatched := update(xid, false)
+	tm.Commit(xid)
+	xid = tm.Begin()
+	batched := update(xid, true)
+	tm.Commit(xid)
+	if coalesced := dm.Status().Redo.Coalesced; coalesced != 99 || batched*50 > unbatched {
+		t.Fatalf("batched updates log %d bytes (%d coalesced), unbatched %d bytes", batched, coalesced, unbatched)
+	}
+
+	// 崩溃之后重做合并的日志
+	dm = open()
+	expect(dm, uid, value(100))
+	// 没有提交的批量事物撤销到合并之前的旧值
+	xid = tm.Begin()
+	dm.BeginBatch(xid)
+	pin := dm.Read(uid)
+	for i := 0; i < 10; i++ {
+		if _, err := dm.Update(xid, uid, value(500+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dm.EndBatch(xid)
+	pin.Release()
+	if coalesced := dm.Status().Redo.Coalesced; coalesced != 9 {
+		t.Fatalf("expect 9 coalesced records, got %d", coalesced)
+	}
+	dm = open()
+	expect(dm, uid, value(100))
+	dm.Close()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"myDB/dataManager"
+	"myDB/executor"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 后台自动压缩长时间没有访问的区, 访问时解压
+func TestColdCompression(t *testing.T) {
+	dir := t.TempDir()
+	db := executor.NewExecutor(dir+"/zip", 8<<20, 0, 1)
+	execAll(t, db, true, "create hist { name string , payload string }")
+	lines := make([]string, 0)
+	for i := 0; i < 4000; i++ {
+		lines = append(lines, fmt.Sprintf("h%d\t%s", i, strings.Repeat("x", 400)))
+	}
+	file := dir + "/hist.tsv"
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("load hist from "+file+" batch 1000")); err != nil {
+		t.Fatal(err)
+	}
+	zipped := func() (int, string) {
+		files, _ := filepath.Glob(dir + "/*" + dataManager.ZipIndexSuffix)
+		if len(files) != 1 {
+			return 0, ""
+		}
+		raw, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		index := struct{ Extents map[string]json.RawMessage }{}
+		if err := json.Unmarshal(raw, &index); err != nil {
+			t.Fatal(err)
+		}
+		return len(index.Extents), strings.TrimSuffix(files[0], dataManager.ZipIndexSuffix)
+	}
+
+	db.SetColdCompression(20 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for n, _ := zipped(); n == 0 && time.Now().Before(deadline); n, _ = zipped() {
+		time.Sleep(20 * time.Millisecond)
+	}
+	db.SetColdCompression(0)
+	n, data := zipped()
+	if n == 0 {
+		t.Fatalf("idle extents aren't compressed")
+	}
+	stat, err := os.Stat(data + dataManager.ZipSuffix)
+	if err != nil || stat.Size()*4 > int64(n)*dataManager.ExtentPages*dataManager.DefaultPageSize {
+		t.Fatalf("compressed file doesn't save space, %d extents, %v", n, err)
+	}
+
+	// 重启之后导出时解压, 读取时解压到数据文件
+	db = executor.NewExecutor(dir+"/zip", 8<<20, 0, 1)
+	export := t.TempDir() + "/exp"
+	execAll(t, db, true, "export hist to "+export, "attach copy from "+export)
+	if rows := viewRows(t, db, "select payload from copy where name = h3999"); len(rows) != 1 || rows[0] != strings.Repeat("x", 400) {
+		t.Fatalf("exported table misses compressed extents, %v", rows)
+	}
+	if n := len(viewRows(t, db, "select name from hist")); n != 4000 {
+		t.Fatalf("expect 4000 rows, got %d", n)
+	}
+	if n, _ := zipped(); n != 0 {
+		t.Fatalf("%d extents are still compressed after access", n)
+	}
+	if stat, err := os.Stat(data + dataManager.ZipSuffix); err != nil || stat.Size() != 0 {
+		t.Fatalf("compressed file isn't emptied, %v", err)
+	}
+	execAll(t, db, true, "update hist set payload = y where name = h2000")
+	db = executor.NewExecutor(dir+"/zip", 8<<20, 0, 1)
+	if rows := viewRows(t, db, "select payload from hist where name = h2000"); len(rows) != 1 || rows[0] != "y" {
+		t.Fatalf("update of a decompressed page is lost, %v", rows)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"myDB/executor"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestColdStorage(t *testing.T) {
+	dir, cold := t.TempDir(), t.TempDir()
+	db := executor.NewExecutor(dir+"/cold", 8<<20, 0, 1)
+	execAll(t, db, true, "create hist { name string , payload string }")
+	lines := make([]string, 0)
+	for i := 0; i < 4000; i++ {
+		lines = append(lines, fmt.Sprintf("h%d\t%s", i, strings.Repeat("x", 400)))
+	}
+	file := dir + "/hist.tsv"
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("load hist from "+file+" batch 1000")); err != nil {
+		t.Fatal(err)
+	}
+	offload := func(db executor.Executor, stmt string) []string {
+		_, res, err := db.Execute(-1, strings.Fields(stmt))
+		if err != nil {
+			t.Fatalf("%s: %s", stmt, err)
+		}
+		return joinRows(res)
+	}
+
+	// 刚刚写入的区不迁移
+	if rows := offload(db, "offload hist to "+cold+" idle 1h"); rows[0] != "0 0 "+strings.Fields(rows[0])[2] {
+		t.Fatalf("recently accessed extents are offloaded, %v", rows)
+	}
+	rows := offload(db, "offload hist to "+cold+" idle 0s")
+	var moved, total, extents int
+	fmt.Sscan(rows[0], &moved, &total, &extents)
+	if moved == 0 || moved != total || moved >= extents {
+		t.Fatalf("unexpected offload result %v", rows)
+	}
+	if files, _ := filepath.Glob(cold + "/*.cold"); len(files) != 1 {
+		t.Fatalf("cold file isn't created, %v", files)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("offload hist to "+t.TempDir()+" idle 0s")); err == nil {
+		t.Fatalf("expect error for offloading to another directory")
+	}
+	for _, stmt := range []string{"offload missing to " + cold, "offload hist to " + cold + " idle x", "offload hist " + cold} {
+		if _, _, err := db.Execute(-1, strings.Fields(stmt)); err == nil {
+			t.Fatalf("expect error for %q", stmt)
+		}
+	}
+
+	// 迁移之后正常读写, 重启之后仍然可以读到冷区中的数据
+	if n := len(viewRows(t, db, "select name from hist")); n != 4000 {
+		t.Fatalf("expect 4000 rows, got %d", n)
+	}
+	execAll(t, db, true, "update hist set payload = y where name = h2000", "insert hist values new z")
+	export := t.TempDir() + "/exp"
+	execAll(t, db, true, "export hist to "+export)
+	db = executor.NewExecutor(dir+"/cold", 8<<20, 0, 1)
+	if rows := viewRows(t, db, "select payload from hist where name = h2000"); len(rows) != 1 || rows[0] != "y" {
+		t.Fatalf("update of a cold page is lost, %v", rows)
+	}
+	if n := len(viewRows(t, db, "select name from hist")); n != 4001 {
+		t.Fatalf("expect 4001 rows after restart, got %d", n)
+	}
+	// 导出的数据文件包含冷区
+	execAll(t, db, true, "attach copy from "+export)
+	if rows := viewRows(t, db, "select payload from copy where name = h3999"); len(rows) != 1 || rows[0] != strings.Repeat("x", 400) {
+		t.Fatalf("exported table misses cold extents, %v", rows)
+	}
+}
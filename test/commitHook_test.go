@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+// 提交之后报告事物修改的表以及主键
+func TestCommitHook(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/hook", 1<<20, 0, 1)
+	execAll(t, db, true, "create orders { item string , qty int64 }", "create stock { item string }")
+	format := func(changes *executor.CommitChanges) string {
+		parts := make([]string, 0)
+		for _, table := range changes.Tables {
+			parts = append(parts, fmt.Sprintf("%s%v%v", table.Table, table.Keys, table.All))
+		}
+		return strings.Join(parts, " ")
+	}
+	var withKeys, withoutKeys []string
+	removeKeys := db.OnCommit(func(changes *executor.CommitChanges) {
+		withKeys = append(withKeys, format(changes))
+	}, true)
+	removeTables := db.OnCommit(func(changes *executor.CommitChanges) {
+		withoutKeys = append(withoutKeys, format(changes))
+	}, false)
+
+	execAll(t, db, true, "insert orders values a 1", "insert orders values b 2", "insert orders values c 3",
+		"update orders set qty = 5 where item = b", "insert stock values a")
+	execAll(t, db, true, "delete orders where item = a", "select item from stock")
+	// 回滚以及只读的事物不报告
+	execAll(t, db, false, "delete orders")
+	execAll(t, db, true, "select item from orders")
+	if strings.Join(withKeys, "|") != "orders[0 1 2]false stock[0]false|orders[0]false" {
+		t.Fatalf("unexpected changes with keys %q", withKeys)
+	}
+	if strings.Join(withoutKeys, "|") != "orders[]false stock[]false|orders[]false" {
+		t.Fatalf("unexpected changes without keys %q", withoutKeys)
+	}
+
+	// swap为整表修改, 注销之后不再调用
+	execAll(t, db, true, "create orders_new { item string , qty int64 }", "swap table orders with orders_new")
+	if last := withKeys[len(withKeys)-1]; last != "orders[]true orders_new[]true" {
+		t.Fatalf("unexpected changes of swap %q", last)
+	}
+	removeKeys()
+	removeTables()
+	calls := len(withKeys) + len(withoutKeys)
+	execAll(t, db, true, "insert stock values b")
+	if len(withKeys)+len(withoutKeys) != calls {
+		t.Fatalf("removed hook is called")
+	}
+}
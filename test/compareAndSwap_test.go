@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"sync"
+	"testing"
+)
+
+func TestUpdateIf(t *testing.T) {
+	path := t.TempDir() + "/cas"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	encode := func(v uint64) []byte {
+		return binary.BigEndian.AppendUint64(nil, v)
+	}
+	uid, err := dm.Insert(transactions.SuperXID, encode(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 并发的乐观自增, 失败时重试
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; {
+				old, ok := dm.Load(uid)
+				if !ok {
+					t.Error("data item is lost")
+					return
+				}
+				_, err := dm.UpdateIf(transactions.SuperXID, uid, old, encode(binary.BigEndian.Uint64(old)+1))
+				var mismatch *dataManager.ErrorCompareMismatch
+				if err == nil {
+					n += 1
+				} else if !errors.As(err, &mismatch) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	di := dm.Read(uid)
+	if got := binary.BigEndian.Uint64(di.GetData()); got != 400 {
+		t.Fatalf("lost updates, counter = %d", got)
+	}
+	di.Release()
+
+	// 数据不同时不更新
+	if _, err := dm.UpdateIf(transactions.SuperXID, uid, encode(1), encode(2)); err == nil {
+		t.Fatalf("expect mismatch")
+	}
+	// 数据变长之后uid改变, 基于旧uid的更新失败
+	newUid, err := dm.UpdateIf(transactions.SuperXID, uid, encode(400), []byte("a much longer value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newUid != uid {
+		if _, err := dm.UpdateIf(transactions.SuperXID, uid, []byte("a much longer value"), encode(0)); err == nil {
+			t.Fatalf("expect mismatch on a relocated data item")
+		}
+	}
+	di = dm.Read(newUid)
+	defer di.Release()
+	if string(di.GetData()) != "a much longer value" {
+		t.Fatalf("unexpected data %s", di.GetData())
+	}
+}
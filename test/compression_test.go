@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"strings"
+	"testing"
+)
+
+// 开启压缩之后文本数据占用更少的页, 读取时透明地解压; 关闭压缩之后重新打开, 已经压缩的数据仍然可以读取
+func TestDataItemCompression(t *testing.T) {
+	text := func(i, n int) []byte {
+		return []byte(fmt.Sprintf("%04d %s", i, strings.Repeat("the quick brown fox jumps over the lazy dog ", n)))
+	}
+	pagesUsed := func(dm dataManager.DataManager, uids []int64) int {
+		pages := map[int64]struct{}{}
+		for _, uid := range uids {
+			pages[dataManager.PageOf(uid)] = struct{}{}
+		}
+		return len(pages)
+	}
+	insert := func(dm dataManager.DataManager, tm transactions.TransactionManager, space int64) []int64 {
+		xid := tm.Begin()
+		uids := make([]int64, 0)
+		for i := 0; i < 200; i++ {
+			uid, err := dm.InsertIn(xid, space, text(i, 20))
+			if err != nil {
+				t.Fatal(err)
+			}
+			uids = append(uids, uid)
+		}
+		tm.Commit(xid)
+		return uids
+	}
+
+	plainPath := t.TempDir() + "/plain"
+	plainTm := transactions.NewTransactionManagerImpl(plainPath)
+	plain := dataManager.OpenDataManager(plainPath, 1<<20, 0, plainTm)
+	plainSpace, _ := plain.CreateSpace()
+	plainPages := pagesUsed(plain, insert(plain, plainTm, plainSpace))
+
+	path := t.TempDir() + "/compressed"
+	tm := transactions.NewTransactionManagerImpl(path)
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, tm, dataManager.WithCompression("flate"))
+	space, _ := dm.CreateSpace()
+	if err := dm.SetChecksum(space, true); err != nil {
+		t.Fatal(err)
+	}
+	uids := insert(dm, tm, space)
+	if pages := pagesUsed(dm, uids); pages*4 > plainPages {
+		t.Fatalf("compressed items use %d pages, plain items use %d pages", pages, plainPages)
+	}
+	// 超过一个页的数据压缩之后放入一个页, 短数据不压缩
+	xid := tm.Begin()
+	large, err := dm.InsertIn(xid, space, text(-1, 2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, _ := dm.InsertIn(xid, space, []byte("short"))
+	// 更新为更长的数据之后迁移到其他页
+	moved, err := dm.Update(xid, uids[0], text(0, 3000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.Commit(xid)
+	// 回滚转发桩时重新压缩原来的数据
+	xid = tm.Begin()
+	if _, err := dm.Update(xid, uids[1], text(1, 3000)); err != nil {
+		t.Fatal(err)
+	}
+	dm.Unforward(xid, uids[1], text(1, 20))
+	tm.Commit(xid)
+	check := func(dm dataManager.DataManager) {
+		for i, uid := range uids[1:] {
+			di := dm.Read(uid)
+			if di == nil || !bytes.Equal(di.GetData(), text(i+1, 20)) {
+				t.Fatalf("unexpected data item %d", i+1)
+			}
+			di.Release()
+		}
+		guard := dm.NewReadGuard()
+		defer guard.Done()
+		for uid, want := range map[int64][]byte{large: text(-1, 2000), short: []byte("short"), uids[0]: text(0, 3000), moved: text(0, 3000)} {
+			if data, _ := guard.Read(uid); !bytes.Equal(data, want) {
+				t.Fatalf("unexpected data of %d, got %d bytes", uid, len(data))
+			}
+		}
+	}
+	check(dm)
+	if err := dm.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	dm.Close()
+	dm = dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	check(dm)
+	if stats, err := dm.Scrub(true); err != nil || len(stats.Corrupt) != 0 {
+		t.Fatalf("unexpected scrub result %v %v", stats, err)
+	}
+}
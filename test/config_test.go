@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"myDB/server/utils"
+	"os"
+	"strings"
+	"testing"
+)
+
+func loadConfig(t *testing.T, name, content string) (*utils.GlobalConfig, error) {
+	path := t.TempDir() + "/" + name
+	if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cfg := *utils.GlobalObj
+	return &cfg, cfg.Load(path)
+}
+
+func TestTomlConfig(t *testing.T) {
+	cfg, err := loadConfig(t, "server.toml", `
+# server
+name = "ntDb # not a comment"
+tcpPort = 4000
+bufferPoolMemory = 8_388_608
+path = '/var/lib/mydb/db'
+healthPort = 4001 # probes
+
+[[resourceGroups]]
+name = "default"
+shares = 2
+
+[[resourceGroups]]
+name = "batch"
+maxMemory = 1048576
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "ntDb # not a comment" || cfg.TcpPort != 4000 || cfg.BufferPoolMemory != 8<<20 ||
+		cfg.Path != "/var/lib/mydb/db" || cfg.HealthPort != 4001 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if len(cfg.ResourceGroups) != 2 || cfg.ResourceGroups[0].Shares != 2 || cfg.ResourceGroups[1].MaxMemory != 1<<20 {
+		t.Fatalf("unexpected resource groups %+v %+v", cfg.ResourceGroups[0], cfg.ResourceGroups[1])
+	}
+	// 没有出现的key保持默认值
+	if cfg.MaxConn != utils.GlobalObj.MaxConn {
+		t.Fatalf("default value is overwritten")
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	cases := []struct {
+		name, content, want string
+	}{
+		{"a.toml", "tcpPort = 4000\nmaxConns = 10", "a.toml:2: maxConns: unknown key, did you mean maxConn?"},
+		{"b.toml", "[[resourceGroups]]\nname = \"x\"\nweight = 3", "b.toml:3: resourceGroups[0].weight: unknown key"},
+		{"c.toml", "tcpPort = \"4000\"", "c.toml:1: tcpPort: expect int"},
+		{"d.toml", "maxConn = 0", "d.toml:1: maxConn: must be positive"},
+		{"e.toml", "tcpPort = 4000\ntcpPort = 4001", "e.toml:2: tcpPort: duplicate key"},
+		{"f.toml", "iso = 3", "f.toml:1: iso: must be 0 (read committed) or 1 (repeatable read)"},
+		{"i.toml", "role = \"leader\"", "i.toml:1: role: must be primary or standby"},
+		{"g.json", `{"name": "x", "bufferPool": 1}`, "g.json: bufferPool: unknown key"},
+		{"h.yaml", "name: x", "unsupported config format"},
+	}
+	for _, c := range cases {
+		_, err := loadConfig(t, c.name, c.content)
+		var configErr *utils.ErrorConfig
+		if !errors.As(err, &configErr) || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("%s: expect error %q, got %v", c.name, c.want, err)
+		}
+	}
+	cfg := *utils.GlobalObj
+	if err := cfg.Load(t.TempDir() + "/missing.toml"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expect ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"myDB/executor"
+	"myDB/versionManager"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHotCounter(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/counter", 1<<20, 0, versionManager.ReadCommitted)
+	execAll(t, db, true, "create t { name string , n int64 }", "insert t values a 0", "insert t values b 100")
+	metric := func(name string) int64 {
+		_, res, _ := db.Execute(-1, strings.Fields("show metrics"))
+		for _, row := range joinRows(res) {
+			if n, value, _ := strings.Cut(row, " "); n == name {
+				v, _ := strconv.ParseInt(value, 10, 64)
+				return v
+			}
+		}
+		return -1
+	}
+	value := func(name string) string {
+		xid, _, _ := db.Execute(-1, []string{"begin"})
+		defer db.Execute(xid, []string{"commit"})
+		_, res, _ := db.Execute(xid, strings.Fields("select n from t where name = "+name))
+		return strings.Join(joinRows(res), ",")
+	}
+
+	if _, res, err := db.Execute(-1, strings.Fields("increment t n by 5 where name = b")); err != nil || !contains(joinRows(res), "1 105") {
+		t.Fatalf("unexpected increment result %v, err = %v", joinRows(res), err)
+	}
+	for _, stmt := range []string{"increment t name", "increment t ID", "increment t n by x", "increment t n where name"} {
+		if _, _, err := db.Execute(-1, strings.Fields(stmt)); err == nil {
+			t.Fatalf("expect error for %q", stmt)
+		}
+	}
+
+	// 持有表锁期间到达的增量合并为一批
+	const n = 40
+	batches := metric("counter_batches")
+	hold, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(hold, strings.Fields("update t set name = a where name = a")); err != nil {
+		t.Fatal(err)
+	}
+	wg := sync.WaitGroup{}
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := db.Execute(-1, strings.Fields("increment t n where name = a")); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	time.Sleep(200 * time.Millisecond)
+	db.Execute(hold, []string{"commit"})
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if v := value("a"); v != strconv.Itoa(n) {
+		t.Fatalf("expect %d, got %s", n, v)
+	}
+	if b := metric("counter_batches") - batches; b > 2 {
+		t.Fatalf("%d increments are applied in %d batches", n, b)
+	}
+
+	// 增量不属于当前事物, 回滚不撤销
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("increment t n by -100 where name = b"))
+	db.Execute(xid, []string{"abort"})
+	if v := value("b"); v != "5" {
+		t.Fatalf("expect 5, got %s", v)
+	}
+}
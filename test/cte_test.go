@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestRecursiveCte(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/cte", 1<<20, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create emp { name string , boss int64 }"))
+	// ID: 0 ceo, 1 vp, 2 eng, 3/4 互为上级(环)
+	for _, v := range []string{"ceo -1", "vp 0", "eng 1", "a 4", "b 3"} {
+		db.Execute(xid, strings.Fields("insert emp values "+v))
+	}
+	_, res, err := db.Execute(xid, strings.Fields(
+		"with recursive sub as ( select ID name from emp where ID = 0 union all select ID name from emp where boss = sub.ID ) select name from sub"))
+	if err != nil || len(res) != 4 {
+		t.Fatalf("expect 3 rows, got %d objects, err = %v", len(res), err)
+	}
+	cycle := "with recursive c as ( select ID boss from emp where ID = 3 union%s select ID boss from emp where ID = c.boss ) select ID from c"
+	if _, res, err := db.Execute(xid, strings.Fields(strings.Replace(cycle, "%s", "", 1))); err != nil || len(res) != 3 {
+		t.Fatalf("union should stop at the cycle, got %d objects, err = %v", len(res), err)
+	}
+	_, _, err = db.Execute(xid, strings.Fields(strings.Replace(cycle, "%s", " all", 1)))
+	var limit *executor.ErrorCteRecursionLimit
+	if !errors.As(err, &limit) {
+		t.Fatalf("expect recursion limit, got %v", err)
+	}
+	db.Execute(xid, []string{"commit"})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"myDB/executor"
+	"myDB/versionManager"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/cursor", 1<<20, 0, versionManager.ReadCommitted)
+	stmts := []string{"create t { k int32 , v string }"}
+	for i := 0; i < 250; i++ {
+		stmts = append(stmts, "insert t values "+strconv.Itoa(i)+" v"+strconv.Itoa(i))
+	}
+	execAll(t, db, true, stmts...)
+
+	if _, _, err := db.Execute(-1, strings.Fields("declare c cursor for select k from t")); err == nil {
+		t.Fatalf("expect error for declaring a cursor outside transaction")
+	}
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("declare c cursor for select k from t where k >= 10")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("declare c cursor for select k from t")); err == nil {
+		t.Fatalf("expect error for declaring a duplicate cursor")
+	}
+	for _, stmt := range []string{"declare d cursor for show", "declare d cursor for select k from t for update", "fetch 0 from c", "fetch from e"} {
+		if _, _, err := db.Execute(xid, strings.Fields(stmt)); err == nil {
+			t.Fatalf("expect error for %q", stmt)
+		}
+	}
+
+	seen := map[string]bool{}
+	fetch := func(stmt string) int {
+		_, res, err := db.Execute(xid, strings.Fields(stmt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := joinRows(res)
+		for _, row := range rows {
+			if seen[row] {
+				t.Fatalf("row %s is fetched twice", row)
+			}
+			seen[row] = true
+		}
+		return len(rows)
+	}
+	if n := fetch("fetch 100 from c"); n != 100 {
+		t.Fatalf("fetch %d rows", n)
+	}
+	// 声明之后提交的修改对游标不可见
+	execAll(t, db, true, "delete t where k >= 100", "insert t values 1000 new")
+	if n := fetch("fetch from c"); n != 100 {
+		t.Fatalf("fetch %d rows", n)
+	}
+	if n := fetch("fetch 100 from c"); n != 40 {
+		t.Fatalf("fetch %d rows at the end", n)
+	}
+	if n := fetch("fetch 100 from c"); n != 0 {
+		t.Fatalf("fetch %d rows after the end", n)
+	}
+	for k := 10; k < 250; k++ {
+		if !seen[strconv.Itoa(k)] {
+			t.Fatalf("row %d is missing", k)
+		}
+	}
+	// 游标之外的查询读到最新的数据
+	if _, res, _ := db.Execute(xid, strings.Fields("select k from t where k >= 10")); len(joinRows(res)) != 91 {
+		t.Fatalf("unexpected rows %d", len(joinRows(res)))
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("close c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("fetch from c")); err == nil {
+		t.Fatalf("expect error for fetching a closed cursor")
+	}
+
+	// 事物结束时关闭游标
+	db.Execute(xid, strings.Fields("declare c cursor for select k v from t"))
+	db.Execute(xid, []string{"commit"})
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	defer db.Execute(xid, []string{"commit"})
+	if _, _, err := db.Execute(xid, strings.Fields("fetch from c")); err == nil {
+		t.Fatalf("expect error for fetching a cursor of a committed transaction")
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"myDB/dataManager"
+	"myDB/transactions"
+	"testing"
+)
+
+func TestDanglingReference(t *testing.T) {
+	path := t.TempDir() + "/dangling"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	uid, err := dm.Insert(transactions.SuperXID, []byte("indexed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm.Delete(transactions.SuperXID, uid)
+	for i := 0; i < 2; i++ {
+		if di := dm.ReadRef(uid); di != nil {
+			t.Fatalf("read an invalid data item")
+		}
+	}
+	if status := dm.Status(); status.DanglingPending != 1 || status.DanglingTotal != 1 {
+		t.Fatalf("unexpected dangling status %d %d", status.DanglingPending, status.DanglingTotal)
+	}
+	if uids := dm.TakeDangling(); len(uids) != 1 || uids[0] != uid {
+		t.Fatalf("unexpected dangling references %v", uids)
+	}
+	if uids := dm.TakeDangling(); len(uids) != 0 {
+		t.Fatalf("dangling references should be taken only once")
+	}
+}
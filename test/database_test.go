@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCreateDatabase(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/database", 1<<20, 0, 0)
+
+	// 回滚的CREATE DATABASE不留下数据库
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create database shop")); err != nil {
+		t.Fatal(err)
+	}
+	// 提交之前其他会话不可见
+	if _, _, err := db.Execute(-1, strings.Fields("use shop")); !errors.As(err, new(*executor.ErrorDatabaseNotExist)) {
+		t.Fatalf("uncommitted database is visible, %v", err)
+	}
+	db.Execute(xid, []string{"abort"})
+	if _, _, err := db.Execute(-1, strings.Fields("use shop")); !errors.As(err, new(*executor.ErrorDatabaseNotExist)) {
+		t.Fatalf("aborted database is visible, %v", err)
+	}
+	_, rows, _ := db.Execute(-1, strings.Fields("show databases"))
+	if len(rows) != 2 {
+		t.Fatalf("unexpected databases %d", len(rows))
+	}
+
+	// 回滚之后名字可以再次使用, 提交之后可见
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create database shop")); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, []string{"commit"})
+	if _, _, err := db.Execute(-1, strings.Fields("use shop")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发创建同名数据库只有一个成功, sys_databases中只有一条记录
+	var wg sync.WaitGroup
+	var created atomic.Int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x, _, _ := db.Execute(-1, []string{"begin"})
+			_, _, err := db.Execute(x, strings.Fields("create database report"))
+			if err == nil {
+				created.Add(1)
+			} else if !errors.As(err, new(*executor.ErrorDatabaseAlreadyExist)) {
+				t.Error(err)
+			}
+			db.Execute(x, []string{"commit"})
+		}()
+	}
+	wg.Wait()
+	if created.Load() != 1 {
+		t.Fatalf("database is created %d times", created.Load())
+	}
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	_, rows, err := db.Execute(xid, strings.Fields("select name from sys_databases where name = report"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, []string{"commit"})
+	if len(rows) != 2 {
+		t.Fatalf("unexpected rows of sys_databases %d", len(rows)-1)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"myDB/dataManager"
+	"myDB/dbError"
+	"myDB/executor"
+	"myDB/tableManager"
+	"myDB/versionManager"
+	"strings"
+	"testing"
+)
+
+// 各层返回的错误可以用errors.Is判断类别, 具体的错误仍然可以用errors.As取出
+func TestErrorClasses(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/class", 1<<20, 0, 1)
+	execAll(t, db, true, "create a { k int64 }", "create b { k int64 }", "insert a values 1", "insert b values 1")
+
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	_, _, err := db.Execute(xid, strings.Fields("create a { k int64 }"))
+	var exist *tableManager.ErrorTableAlreadyExist
+	if !errors.Is(err, dbError.ErrDuplicateKey) || !errors.As(err, &exist) || dbError.Retryable(err) {
+		t.Fatalf("expect duplicate key, got %v", err)
+	}
+	db.Execute(xid, []string{"abort"})
+
+	// 两个事物以相反的顺序更新两张表, 其中一个检测到死锁并回滚
+	first, _, _ := db.Execute(-1, []string{"begin"})
+	second, _, _ := db.Execute(-1, []string{"begin"})
+	for xid, table := range map[int64]string{first: "a", second: "b"} {
+		if _, _, err := db.Execute(xid, strings.Fields("update "+table+" set k = 2 where k = 1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	errs := make(chan error, 2)
+	for xid, table := range map[int64]string{first: "b", second: "a"} {
+		go func(xid int64, table string) {
+			_, _, err := db.Execute(xid, strings.Fields("update "+table+" set k = 3 where k = 1"))
+			if err == nil {
+				_, _, err = db.Execute(xid, []string{"commit"})
+			}
+			errs <- err
+		}(xid, table)
+	}
+	deadlocks := 0
+	for i := 0; i < 2; i++ {
+		if err := <-errs; errors.Is(err, dbError.ErrDeadlock) && dbError.Retryable(err) {
+			deadlocks++
+		} else if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if deadlocks != 1 {
+		t.Fatalf("expect one deadlock, got %d", deadlocks)
+	}
+
+	// 等待锁超时
+	session := &executor.Session{Database: executor.DefaultDatabase, Vars: executor.NewSessionVariables()}
+	if _, _, err := db.ExecuteSession(session, -1, strings.Fields("set lock_timeout = 50")); err != nil {
+		t.Fatal(err)
+	}
+	owner, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(owner, strings.Fields("insert a values 5"))
+	waiter, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+	_, _, err = db.ExecuteSession(session, waiter, strings.Fields("insert a values 6"))
+	var timeout *versionManager.ErrorLockTimeout
+	if !errors.Is(err, dbError.ErrLockTimeout) || !errors.As(err, &timeout) || !dbError.Retryable(err) {
+		t.Fatalf("expect lock wait timeout, got %v", err)
+	}
+	db.Execute(waiter, []string{"abort"})
+	db.Execute(owner, []string{"commit"})
+
+	// 容量限制
+	full := executor.NewExecutor(t.TempDir()+"/full", 1<<20, 5*dataManager.DefaultPageSize, 1)
+	xid, _, _ = full.Execute(-1, []string{"begin"})
+	full.Execute(xid, strings.Fields("create t { v string }"))
+	err = nil
+	for i := 0; i < 100 && err == nil; i++ {
+		_, _, err = full.Execute(xid, strings.Fields("insert t values "+strings.Repeat("v", 1000)))
+	}
+	if !errors.Is(err, dbError.ErrDiskFull) || dbError.Retryable(err) {
+		t.Fatalf("expect disk full, got %v", err)
+	}
+	full.Execute(xid, []string{"abort"})
+
+	for _, c := range []struct {
+		err   error
+		class error
+	}{
+		{&tableManager.ErrorSchemaChanged{}, dbError.ErrSerialization},
+		{&dataManager.CorruptPage{Space: 1, PageId: 2, Reason: "checksum mismatch"}, dbError.ErrCorruptPage},
+		{&dataManager.ErrorDiskFull{}, dbError.ErrDiskFull},
+	} {
+		if !errors.Is(c.err, c.class) || errors.Is(c.err, dbError.ErrDuplicateKey) {
+			t.Fatalf("%v isn't classified as %v", c.err, c.class)
+		}
+	}
+}
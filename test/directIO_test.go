@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"myDB/dataManager"
+	"myDB/executor"
+	"myDB/tableManager"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 使用O_DIRECT以及fdatasync读写数据文件, 页只缓存在缓冲池中
+func TestDirectIO(t *testing.T) {
+	dir := t.TempDir()
+	backend := tableManager.WithDataOptions(dataManager.WithFileBackend(dataManager.FileBackend{Direct: true, DataSync: true}))
+	segment := tableManager.WithDataOptions(dataManager.WithSegmentSize(2 * dataManager.ExtentPages * dataManager.DefaultPageSize))
+	db := executor.NewExecutor(dir+"/direct", 1<<20, 0, 1, backend, segment)
+	stmts := []string{"create t { name string , payload string }"}
+	for i := 0; i < 1500; i++ {
+		stmts = append(stmts, fmt.Sprintf("insert t values d%d %s", i, strings.Repeat("p", 200)))
+	}
+	execAll(t, db, true, stmts...)
+
+	// linux上数据文件以O_DIRECT打开
+	if runtime.GOOS == "linux" {
+		const oDirect = 0o40000
+		direct := 0
+		fds, _ := filepath.Glob("/proc/self/fd/*")
+		for _, fd := range fds {
+			if target, err := os.Readlink(fd); err != nil || !strings.HasPrefix(target, dir) || !strings.Contains(target, dataManager.FileSuffix) {
+				continue
+			}
+			info, err := os.ReadFile("/proc/self/fdinfo/" + filepath.Base(fd))
+			if err != nil {
+				continue
+			}
+			for _, line := range strings.Split(string(info), "\n") {
+				if strings.HasPrefix(line, "flags:") {
+					if flags, _ := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "flags:")), 8, 64); flags&oDirect != 0 {
+						direct += 1
+					}
+				}
+			}
+		}
+		if direct == 0 {
+			t.Fatalf("data files aren't opened with O_DIRECT")
+		}
+	}
+
+	// 重启之后读出所有行, 导出以及挂载
+	db = executor.NewExecutor(dir+"/direct", 1<<20, 0, 1, backend)
+	if n := len(viewRows(t, db, "select name from t")); n != 1500 {
+		t.Fatalf("expect 1500 rows, got %d", n)
+	}
+	export := t.TempDir() + "/exp"
+	execAll(t, db, true, "update t set payload = q where name = d700", "export t to "+export, "attach copy from "+export)
+	if rows := viewRows(t, db, "select payload from copy where name = d700"); len(rows) != 1 || rows[0] != "q" {
+		t.Fatalf("exported table misses the update, %v", rows)
+	}
+	db = executor.NewExecutor(dir+"/direct", 1<<20, 0, 1, backend)
+	if rows := viewRows(t, db, "select payload from t where name = d1499"); len(rows) != 1 || rows[0] != strings.Repeat("p", 200) {
+		t.Fatalf("row is lost after restart, %v", rows)
+	}
+}
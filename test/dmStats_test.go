@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"testing"
+)
+
+// DataManager打开之后的累计计数器
+func TestDataManagerStats(t *testing.T) {
+	path := t.TempDir() + "/stats"
+	open := func() dataManager.DataManager {
+		return dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	}
+	dm := open()
+	if stats := dm.Stats(); stats.Inserted != 0 || stats.LogBytes != 0 || stats.Recovery != 0 {
+		t.Fatalf("unexpected stats of a new data manager %+v", stats)
+	}
+	uids := make([]int64, 0)
+	for i := 0; i < 100; i++ {
+		uid, err := dm.Insert(transactions.SuperXID, bytes.Repeat([]byte{byte(i)}, 200))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+	batch, err := dm.InsertBatch(transactions.SuperXID, [][]byte{[]byte("a"), []byte("b")})
+	if err != nil || len(batch) != 2 {
+		t.Fatal(err)
+	}
+	for _, uid := range uids[:10] {
+		dm.Delete(transactions.SuperXID, uid)
+	}
+	// 页中放不下时迁移, 旧的DataItem改写为转发桩
+	moved, err := dm.Update(transactions.SuperXID, uids[50], bytes.Repeat([]byte{1}, 6000))
+	if err != nil || moved == uids[50] {
+		t.Fatalf("update isn't relocated, err = %v", err)
+	}
+	stats := dm.Stats()
+	if stats.Inserted != 103 || stats.Deleted != 10 || stats.Invalidated != 11 {
+		t.Fatalf("unexpected data item counters %+v", stats)
+	}
+	if stats.Pool.Allocated == 0 || stats.Pool.Misses == 0 || stats.Pool.Evictions == 0 || stats.LogBytes == 0 {
+		t.Fatalf("unexpected page cache counters %+v", stats)
+	}
+	if stats.Pool.Allocated != dm.Status().Pool.Allocated || stats.Pool.Evictions != dm.Status().Pool.Evictions {
+		t.Fatalf("stats differ from status %+v %+v", stats.Pool, dm.Status().Pool)
+	}
+
+	// 崩溃之后记录恢复耗时, 计数器从0开始
+	dm = open()
+	stats = dm.Stats()
+	if stats.Recovery <= 0 || stats.Inserted != 0 || stats.Deleted != 0 {
+		t.Fatalf("unexpected stats after a crash %+v", stats)
+	}
+	dm.Close()
+	dm = open()
+	if stats = dm.Stats(); stats.Recovery != 0 {
+		t.Fatalf("normal startup records recovery time %v", stats.Recovery)
+	}
+	dm.Close()
+}
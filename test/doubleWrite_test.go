@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 开启双写时写回中途崩溃留下的不完整的页在打开数据库时从双写文件恢复
+func TestDoubleWrite(t *testing.T) {
+	path := t.TempDir() + "/doubleWrite"
+	var tm transactions.TransactionManager
+	open := func() dataManager.DataManager {
+		tm = transactions.NewTransactionManagerImpl(path)
+		return dataManager.OpenDataManager(path, 1<<20, 0, tm, dataManager.WithDoubleWrite(true))
+	}
+	dm := open()
+	// 双写属于每个数据库, 同时打开的没有开启双写的数据库不写双写文件
+	plain := t.TempDir() + "/plain"
+	plainDm := dataManager.OpenDataManager(plain, 1<<20, 0, transactions.NewTransactionManagerImpl(plain))
+	if _, err := plainDm.Insert(transactions.SuperXID, []byte("plain")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(plain + dataManager.FileSuffix + dataManager.DoubleWriteSuffix); !os.IsNotExist(err) {
+		t.Fatalf("database without double write opens double write file, %v", err)
+	}
+	plainDm.Close()
+	space, _ := dm.CreateSpace()
+	uid, err := dm.InsertIn(transactions.SuperXID, space, []byte("double write "+strings.Repeat("x", 64)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xid := tm.Begin()
+	if _, err := dm.Update(xid, uid, []byte("double write "+strings.Repeat("y", 64))); err != nil {
+		t.Fatal(err)
+	}
+	tm.Commit(xid)
+
+	file := fmt.Sprintf("%s%s%d%s", path, dataManager.SpaceFileInfix, space, dataManager.FileSuffix)
+	if stat, err := os.Stat(file + dataManager.DoubleWriteSuffix); err != nil || stat.Size() == 0 {
+		t.Fatalf("pages aren't written to double write file, %v", err)
+	}
+	// 崩溃时页的后一半还没有写入
+	f, err := os.OpenFile(file, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := (dataManager.PageOf(uid) - 1) * dataManager.DefaultPageSize
+	torn := make([]byte, dataManager.DefaultPageSize/2)
+	for i := range torn {
+		torn[i] = 0xee
+	}
+	if _, err := f.WriteAt(torn, offset+dataManager.DefaultPageSize/2); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	dm = open()
+	di, err := dm.Checked().Read(uid)
+	if err != nil || string(di.GetData()) != "double write "+strings.Repeat("y", 64) {
+		t.Fatalf("torn page isn't restored, %v", err)
+	}
+	di.Release()
+	if stats, _ := dm.Scrub(true); len(stats.Corrupt) != 0 {
+		t.Fatalf("restored page is corrupt, %+v", stats.Corrupt)
+	}
+	// 正常关闭时删除双写文件
+	dm.Close()
+	if _, err := os.Stat(file + dataManager.DoubleWriteSuffix); !os.IsNotExist(err) {
+		t.Fatalf("double write file isn't removed after close, %v", err)
+	}
+}
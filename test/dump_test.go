@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"myDB/executor"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 导出期间持续有事物同时向两个表各写入一行, 同一个快照中导出的两个表行数相同
+func TestConsistentDump(t *testing.T) {
+	dir := t.TempDir()
+	db := executor.NewExecutor(dir+"/dump", 8<<20, 0, 1)
+	stmts := []string{"create acct { owner string , amount int64 }", "create ledger { owner string indexed , amount int64 }"}
+	for i := 0; i < 300; i++ {
+		stmts = append(stmts, "insert acct values a"+strconv.Itoa(i)+" 100", "insert ledger values a"+strconv.Itoa(i)+" 100")
+	}
+	execAll(t, db, true, stmts...)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			xid, _, _ := db.Execute(-1, []string{"begin"})
+			db.Execute(xid, strings.Fields("insert ledger values w"+strconv.Itoa(i)+" -1"))
+			db.Execute(xid, strings.Fields("insert acct values w"+strconv.Itoa(i)+" 1"))
+			db.Execute(xid, []string{"commit"})
+		}
+	}()
+	file := dir + "/out.sql"
+	var lines []string
+	for k := 0; k < 10; k++ {
+		_, res, err := db.Execute(-1, strings.Fields("dump to "+file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := joinRows(res)
+		if len(rows) != 2 {
+			t.Fatalf("unexpected dump result %v", rows)
+		}
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = strings.Split(strings.TrimSpace(string(raw)), "\n")
+		count := map[string]int{}
+		for _, line := range lines {
+			if fields := strings.Fields(line); fields[0] == "insert" {
+				count[fields[1]] += 1
+			}
+		}
+		if count["acct"] != count["ledger"] || count["acct"] < 300 {
+			t.Fatalf("dumped tables are inconsistent, %v", count)
+		}
+		lsn := "-- snapshot lsn " + strings.Fields(rows[0])[2]
+		if !contains(lines, lsn) || strings.HasSuffix(lsn, " 0") {
+			t.Fatalf("dump header doesn't record the snapshot lsn, %v", lines[:4])
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	// 导出的语句可以在新的实例中恢复
+	restored := executor.NewExecutor(dir+"/restore", 8<<20, 0, 1)
+	replay := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "--") {
+			replay = append(replay, line)
+		}
+	}
+	execAll(t, restored, true, replay...)
+	if rows := viewRows(t, restored, "select owner amount from ledger where owner = a7"); len(rows) != 1 || rows[0] != "a7 100" {
+		t.Fatalf("unexpected restored rows %v", rows)
+	}
+
+	// csv: 每个表一个文件, 文件头单独写入
+	out := dir + "/csv"
+	if _, _, err := db.Execute(-1, strings.Fields("dump acct to "+out+" format csv")); err != nil {
+		t.Fatal(err)
+	}
+	header, err := os.ReadFile(filepath.Join(out, executor.DumpHeaderFile))
+	if err != nil || !strings.Contains(string(header), "-- snapshot lsn ") {
+		t.Fatalf("csv dump header is missing, %s %v", header, err)
+	}
+	f, err := os.Open(filepath.Join(out, "acct.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil || strings.Join(records[0], ",") != "owner,amount" || len(records) < 301 {
+		t.Fatalf("unexpected csv dump, %d records, err = %v", len(records), err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "ledger.csv")); !os.IsNotExist(err) {
+		t.Fatalf("table not listed is dumped")
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("dump to "+out+" format xml")); err == nil {
+		t.Fatalf("expect invalid format error")
+	}
+}
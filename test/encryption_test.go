@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"myDB/dataManager"
+	"myDB/executor"
+	"myDB/tableManager"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// containsPlaintext dir下是否有文件包含plain
+func containsPlaintext(t *testing.T, dir, plain string) bool {
+	found := false
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		found = found || bytes.Contains(raw, []byte(plain))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+// copySealedField 把from所在行的下一个字段(加密字段, [length]8[密文])拷贝到所有to所在行的同一个字段, 之后重新计算页校验和
+func copySealedField(t *testing.T, raw []byte, from, to string) []byte {
+	sealedAt := func(i int) (int, int) {
+		start := i + len(to)
+		if bytes.HasPrefix(raw[i:], []byte(from)) {
+			start = i + len(from)
+		}
+		length := int(binary.BigEndian.Uint64(raw[start:]))
+		return start + 8, start + 8 + length
+	}
+	i := bytes.Index(raw, []byte(from))
+	if i < 0 {
+		t.Fatalf("%s isn't found in the exported table", from)
+	}
+	s, e := sealedAt(i)
+	sealed := append([]byte{}, raw[s:e]...)
+	copied := 0
+	for offset := 0; ; {
+		j := bytes.Index(raw[offset:], []byte(to))
+		if j < 0 {
+			break
+		}
+		ts, te := sealedAt(offset + j)
+		if te-ts == len(sealed) {
+			copy(raw[ts:te], sealed)
+			copied++
+		}
+		offset += j + len(to)
+	}
+	if copied == 0 {
+		t.Fatalf("%s isn't found in the exported table", to)
+	}
+	size := int(dataManager.DefaultPageSize)
+	for start := 0; start+size <= len(raw); start += size {
+		id := make([]byte, 8)
+		binary.BigEndian.PutUint64(id, uint64(start/size+1))
+		trailer := start + size - int(dataManager.SzPageTrailer)
+		binary.BigEndian.PutUint32(raw[trailer:], crc32.Update(crc32.ChecksumIEEE(id), crc32.IEEETable, raw[start:trailer]))
+	}
+	return raw
+}
+
+func TestEncryptedField(t *testing.T) {
+	master := tableManager.WithMasterKey(bytes.Repeat([]byte{7}, tableManager.SzMasterKey))
+	dir := t.TempDir()
+	// 不合法的主密钥打开失败
+	if _, err := executor.OpenExecutor(dir+"/short", 1<<20, 0, 1, tableManager.WithMasterKey([]byte("short"))); !errors.As(err, new(*tableManager.ErrorInvalidMasterKey)) {
+		t.Fatalf("invalid master key isn't rejected, %v", err)
+	}
+	src := executor.NewExecutor(dir+"/src", 1<<20, 0, 1, master)
+	// 主密钥属于每个数据库, 同时打开的没有主密钥的数据库不能创建加密字段
+	plain := executor.NewExecutor(t.TempDir()+"/plain", 1<<20, 0, 1)
+	xid, _, _ := plain.Execute(-1, []string{"begin"})
+	_, _, err := plain.Execute(xid, strings.Fields("create secret { ssn string encrypted }"))
+	plain.Execute(xid, []string{"abort"})
+	if !errors.As(err, new(*tableManager.ErrorNoMasterKey)) {
+		t.Fatalf("encrypted field is created without master key, %v", err)
+	}
+	execAll(t, src, true,
+		"create person { name string , ssn string encrypted , age int32 encrypted }",
+		"insert person values alice-visible ssn-4f2a9c 30",
+		"insert person values bob-visible ssn-7b1d3e 40",
+		"update person set age = 31 where ssn = ssn-4f2a9c",
+		"export person to "+dir+"/exp")
+	rows := viewRows(t, src, "select name ssn age from person where age > 35")
+	if len(rows) != 1 || rows[0] != "bob-visible ssn-7b1d3e 40" {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	if !containsPlaintext(t, dir, "alice-visible") {
+		t.Fatalf("plain field isn't written to the data files")
+	}
+	for _, plain := range []string{"ssn-4f2a9c", "ssn-7b1d3e"} {
+		if containsPlaintext(t, dir, plain) {
+			t.Fatalf("plaintext %s is found in the data files", plain)
+		}
+	}
+	// 逻辑导出默认不导出加密字段的明文, 指定decrypt时导出
+	out := t.TempDir()
+	for _, format := range []string{"sql", "csv"} {
+		file := out + "/dump." + format
+		if _, _, err := src.Execute(-1, strings.Fields("dump person to "+file+" format "+format)); !errors.As(err, new(*executor.ErrorEncryptedDump)) {
+			t.Fatalf("table with encrypted fields is dumped as %s, %v", format, err)
+		}
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Fatalf("refused dump leaves %s", file)
+		}
+	}
+	if _, _, err := src.Execute(-1, strings.Fields("dump person to "+out+"/plain.sql decrypt")); err != nil {
+		t.Fatal(err)
+	}
+	if !containsPlaintext(t, out, "ssn-4f2a9c") || !containsPlaintext(t, out, "exported as plaintext") {
+		t.Fatalf("dump with decrypt doesn't export the marked plaintext")
+	}
+
+	// 密文与表, 字段以及行绑定: 把bob的ssn密文拷贝到alice的行中, 挂载时解密失败
+	tampered := t.TempDir()
+	for _, name := range []string{tableManager.ExportDataFile, tableManager.ExportMetaFile} {
+		raw, err := os.ReadFile(filepath.Join(dir, "exp", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == tableManager.ExportDataFile {
+			raw = copySealedField(t, raw, "bob-visible", "alice-visible")
+		}
+		if err := os.WriteFile(filepath.Join(tampered, name), raw, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := executor.NewExecutor(t.TempDir()+"/other", 1<<20, 0, 1, master)
+	xid, _, _ = other.Execute(-1, []string{"begin"})
+	_, _, err = other.Execute(xid, strings.Fields("attach person from "+tampered))
+	other.Execute(xid, []string{"abort"})
+	if !errors.As(err, new(*tableManager.ErrorDecryptField)) {
+		t.Fatalf("ciphertext moved to another row is decrypted, %v", err)
+	}
+
+	// 挂载之后使用导出的数据密钥
+	dst := executor.NewExecutor(dir+"/dst", 1<<20, 0, 1, master)
+	execAll(t, dst, true, "attach person from "+dir+"/exp", "insert person values carol-visible ssn-9e8d7c 50")
+	rows = viewRows(t, dst, "select name ssn age from person where name = alice-visible")
+	if len(rows) != 1 || rows[0] != "alice-visible ssn-4f2a9c 31" {
+		t.Fatalf("unexpected rows after attach %v", rows)
+	}
+	if containsPlaintext(t, dir, "ssn-9e8d7c") {
+		t.Fatalf("plaintext is found in the attached table space")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"myDB/executor"
+	"myDB/storageEngine"
+	"myDB/versionManager"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShowEngineStatus(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/status", 1<<22, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create item { name string , price int64 }"))
+	db.Execute(xid, strings.Fields("insert item values apple 3"))
+	_, res, err := db.Execute(xid, strings.Fields("show engine status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make([]string, 0, len(res))
+	for _, r := range res {
+		lines = append(lines, r.Payload)
+	}
+	report := strings.Join(lines, "\n")
+	for _, want := range []string{"BUFFER POOL", "Log sequence number", "1 active transactions", "No deadlock detected"} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report doesn't contain %q:\n%s", want, report)
+		}
+	}
+	db.Execute(xid, []string{"commit"})
+}
+
+func TestFormatStatus(t *testing.T) {
+	now := time.Date(2000, 1, 1, 0, 0, 10, 0, time.UTC)
+	wait := &versionManager.LockWait{Xid: 5, TbUid: 42, Owner: 4, Since: now.Add(-2 * time.Second)}
+	report := storageEngine.FormatStatus(versionManager.VmStatus{
+		Active: []*versionManager.TransactionStatus{
+			{Xid: 4, Level: versionManager.ReadRepeatable, Begin: now.Add(-5 * time.Second)},
+			{Xid: 5, Level: versionManager.ReadCommitted, Begin: now.Add(-3 * time.Second), Waiting: wait},
+		},
+		LockWaits:    []*versionManager.LockWait{wait},
+		LastDeadLock: &versionManager.DeadLockInfo{Xid: 7, TbUid: 42, Owner: 6, Time: now},
+		DeadLocks:    1,
+	}, now)
+	for _, want := range []string{
+		"---TRANSACTION 4, ACTIVE 5s, REPEATABLE READ",
+		"---TRANSACTION 5, ACTIVE 3s, READ COMMITTED, LOCK WAIT 2s",
+		"Transaction 5 waits 2s for table lock 42 held by transaction 4",
+		"WE ROLL BACK TRANSACTION 7",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report doesn't contain %q:\n%s", want, report)
+		}
+	}
+}
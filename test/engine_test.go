@@ -0,0 +1,57 @@
+package main
+
+import (
+	"myDB/executor"
+	"myDB/tableManager"
+	"myDB/versionManager"
+	"strings"
+	"testing"
+)
+
+// countingEngine 包装默认引擎, 统计插入次数
+type countingEngine struct {
+	tableManager.TableEngine
+	inserts int
+}
+
+func (e *countingEngine) Name() string {
+	return "counting"
+}
+
+func (e *countingEngine) Insert(xid int64, tb tableManager.Table, values []any) (int64, error) {
+	e.inserts += 1
+	return e.TableEngine.Insert(xid, tb, values)
+}
+
+func TestTableEngine(t *testing.T) {
+	var engine *countingEngine
+	tableManager.RegisterEngine("counting", func(vm versionManager.VersionManager) tableManager.TableEngine {
+		heap := tableManager.NewHeapEngine(vm)
+		engine = &countingEngine{TableEngine: heap}
+		return engine
+	})
+	db := executor.NewExecutor(t.TempDir()+"/engine", 1<<20, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create bad { name string } engine nothing")); err == nil {
+		t.Fatalf("expect error for unknown engine")
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("create user { name string , age int64 } engine counting")); err != nil {
+		t.Fatalf("create table failed, err = %v", err)
+	}
+	for _, name := range []string{"tom", "bob", "ann"} {
+		db.Execute(xid, strings.Fields("insert user values "+name+" 10"))
+	}
+	if engine.inserts != 3 {
+		t.Fatalf("expect 3 inserts through engine, got %d", engine.inserts)
+	}
+	// 多行修改与删除
+	db.Execute(xid, strings.Fields("update user set name = someone_with_a_longer_name where age = 10"))
+	if _, res, _ := db.Execute(xid, strings.Fields("select name from user where name = someone_with_a_longer_name")); len(res) != 4 {
+		t.Fatalf("expect 3 updated rows, got %d objects", len(res))
+	}
+	db.Execute(xid, strings.Fields("delete user where age = 10"))
+	if _, res, _ := db.Execute(xid, strings.Fields("select name from user")); len(res) != 1 {
+		t.Fatalf("expect empty table, got %d objects", len(res))
+	}
+	db.Execute(xid, []string{"commit"})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"myDB/executor"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecStats(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/stats", 1<<22, 0, 1)
+	session := &executor.Session{Database: executor.DefaultDatabase, Stats: &executor.SessionStats{}}
+	xid, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+	db.ExecuteSession(session, xid, strings.Fields("create item { name string , price int64 }"))
+	for _, name := range []string{"apple", "pear", "plum"} {
+		db.ExecuteSession(session, xid, strings.Fields("insert item values "+name+" 3"))
+	}
+	stmt := session.Stats.Statement
+	if stmt.RowsWritten != 1 || stmt.LogBytes == 0 || stmt.PagesTouched == 0 {
+		t.Fatalf("unexpected insert stats %+v", stmt)
+	}
+	if session.Stats.Transaction.RowsWritten != 3 {
+		t.Fatalf("unexpected transaction stats %+v", session.Stats.Transaction)
+	}
+
+	buffer := &bytes.Buffer{}
+	defer func(logger *log.Logger) { executor.SlowQueryLog = logger }(executor.SlowQueryLog)
+	executor.SlowQueryLog = log.New(buffer, "", 0)
+	session.SlowQuery = time.Nanosecond
+	db.ExecuteSession(session, xid, strings.Fields("select name from item where price = 3"))
+	session.SlowQuery = 0
+	if stmt := session.Stats.Statement; stmt.RowsRead != 3 || stmt.RowsWritten != 0 {
+		t.Fatalf("unexpected select stats %+v", stmt)
+	}
+	if !strings.Contains(buffer.String(), "rows read = 3") {
+		t.Fatalf("unexpected slow query log %q", buffer.String())
+	}
+
+	_, res, err := db.ExecuteSession(session, xid, strings.Fields("show stats"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// title + statement + transaction, 7列
+	if len(res) != 21 || res[7].Payload != "statement" || res[8].Payload != "3" || res[16].Payload != "3" {
+		t.Fatalf("unexpected show stats result")
+	}
+	db.ExecuteSession(session, xid, []string{"commit"})
+}
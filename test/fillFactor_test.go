@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/executor"
+	"myDB/transactions"
+	"strings"
+	"testing"
+)
+
+// 填充因子为50的表空间中每页只插入一半, 变长的Update在页内移动, uid不变
+func TestFillFactor(t *testing.T) {
+	path := t.TempDir() + "/fillFactor"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	full, _ := dm.CreateSpace()
+	half, _ := dm.CreateSpace()
+	if err := dm.SetFillFactor(half, 5); err == nil {
+		t.Fatalf("fill factor below %d must be rejected", dataManager.MinFillFactor)
+	}
+	if err := dm.SetFillFactor(half, 50); err != nil {
+		t.Fatal(err)
+	}
+	uids := map[int64][]int64{}
+	for i := 0; i < 200; i++ {
+		for _, space := range []int64{full, half} {
+			uid, err := dm.InsertIn(transactions.SuperXID, space, bytes.Repeat([]byte{'x'}, 200))
+			if err != nil {
+				t.Fatal(err)
+			}
+			uids[space] = append(uids[space], uid)
+		}
+	}
+	pages := map[int64]int64{}
+	for _, space := range dm.Status().Spaces {
+		pages[space.Space] = space.Pages
+	}
+	if pages[half] < 2*(pages[full]-1) {
+		t.Fatalf("fill factor isn't honored, %d pages with fill factor 100, %d pages with fill factor 50", pages[full], pages[half])
+	}
+	// 第一页已满, 不预留空间时只能删除之后重新插入
+	grown := bytes.Repeat([]byte{'y'}, 400)
+	if uid, _ := dm.Update(transactions.SuperXID, uids[full][0], grown); uid == uids[full][0] {
+		t.Fatalf("data item on a full page can't grow in place")
+	}
+	if uid, _ := dm.Update(transactions.SuperXID, uids[half][0], grown); uid != uids[half][0] {
+		t.Fatalf("data item must grow into the reserved space, uid %d -> %d", uids[half][0], uid)
+	}
+
+	reopened := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	for _, space := range reopened.Status().Spaces {
+		if space.Space == half && space.FillFactor != 50 {
+			t.Fatalf("fill factor isn't persisted, got %d", space.FillFactor)
+		}
+	}
+}
+
+func TestCreateTableFillFactor(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/fillFactor", 1<<20, 0, 1)
+	execAll(t, db, true, "create t { v string } fillfactor 70 checksum")
+	if _, _, err := db.Execute(-1, strings.Fields("create u { v string } fillfactor 5")); err == nil {
+		t.Fatalf("fill factor out of range must be rejected")
+	}
+	_, res, err := db.Execute(-1, strings.Fields("show engine status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := strings.Join(joinRows(res), "\n"); !strings.Contains(status, "fill factor 70%") {
+		t.Fatalf("fill factor isn't reported\n%s", status)
+	}
+}
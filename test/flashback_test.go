@@ -0,0 +1,64 @@
+package main
+
+import (
+	"myDB/executor"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlashback(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/flashback", 1<<20, 0, 0)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create user { name string , age int64 }")); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, strings.Fields("insert user values tom 10"))
+	db.Execute(xid, strings.Fields("insert user values bob 20"))
+	db.Execute(xid, strings.Fields("insert user values amy 30"))
+	db.Execute(xid, []string{"commit"})
+	time.Sleep(2 * time.Millisecond)
+	before := time.Now().Format(time.RFC3339Nano)
+	time.Sleep(2 * time.Millisecond)
+
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("delete user where age = 10"))
+	db.Execute(xid, strings.Fields("update user set name = robert where age = 20"))
+	db.Execute(xid, strings.Fields("update user set name = amelia where age = 30"))
+	db.Execute(xid, strings.Fields("insert user values joe 40"))
+	db.Execute(xid, []string{"commit"})
+
+	names := func() string {
+		xid, _, _ := db.Execute(-1, []string{"begin"})
+		defer db.Execute(xid, []string{"commit"})
+		_, res, err := db.Execute(xid, strings.Fields("select name from user"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret := make([]string, 0)
+		for _, obj := range res[1:] {
+			ret = append(ret, obj.Payload)
+		}
+		sort.Strings(ret)
+		return strings.Join(ret, ",")
+	}
+	// 只恢复一行
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("flashback user to "+before+" where age = 20")); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, []string{"commit"})
+	if got := names(); got != "amelia,bob,joe" {
+		t.Fatalf("unexpected rows after flashback of a single row, %s", got)
+	}
+	// 恢复整张表
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("flashback user to "+before)); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, []string{"commit"})
+	if got := names(); got != "amy,bob,tom" {
+		t.Fatalf("unexpected rows after flashback of the table, %s", got)
+	}
+}
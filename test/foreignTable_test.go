@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"myDB/exporter"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 外部表按照声明的字段读取CSV或者Parquet文件, 可以与普通表以及其他外部表join, 只读, 定义在重启之后保留
+func TestForeignTable(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/foreign"
+	csvFile := dir + "/customers.csv"
+	if err := os.WriteFile(csvFile, []byte("id,name,score\n1,alice,90\n2,bob,40\n3,\"carol, jr\",75\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parquetFile := dir + "/regions.parquet"
+	w, err := exporter.NewParquetWriter(parquetFile, []*exporter.Column{
+		{Name: "region", Type: exporter.ByteArray, Converted: exporter.ConvertedUtf8},
+		{Name: "customer", Type: exporter.Int64, Converted: exporter.ConvertedNone},
+	}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]string{{"east", "1"}, {"west", "2"}, {"east", "3"}} {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db := executor.NewExecutor(path, 1<<20, 0, 1)
+	execAll(t, db, true,
+		"create foreign table customers { id int64 , name string , score int32 } from "+csvFile+" header",
+		"create foreign table regions { customer int64 , region string } from "+parquetFile,
+		"create orders { customer int64 , amount int64 }",
+		"insert orders values 1 100",
+		"insert orders values 3 30",
+		"insert orders values 1 7",
+		"insert orders values 9 1",
+	)
+	if rows := viewRows(t, db, "select name from customers where score > 50"); len(rows) != 2 || rows[0] != "alice" || rows[1] != "carol, jr" {
+		t.Fatalf("unexpected csv rows %v", rows)
+	}
+	if rows := viewRows(t, db, "select region customer from regions where customer >= 2"); len(rows) != 2 || rows[0] != "west 2" || rows[1] != "east 3" {
+		t.Fatalf("unexpected parquet rows %v", rows)
+	}
+	if rows := viewRows(t, db, "select count(*) from customers"); len(rows) != 1 || rows[0] != "3" {
+		t.Fatalf("unexpected count %v", rows)
+	}
+	rows := viewRows(t, db, "select customers.name orders.amount from orders join customers on customers.id = orders.customer where customers.score > 50")
+	sort.Strings(rows)
+	if strings.Join(rows, "|") != "alice 100|alice 7|carol, jr 30" {
+		t.Fatalf("unexpected join with a base table %v", rows)
+	}
+	// 两张外部表的join不需要事物
+	_, res, err := db.Execute(-1, strings.Fields("select regions.region customers.name from regions join customers on regions.customer = customers.id where regions.region = east"))
+	if err != nil || strings.Join(joinRows(res), "|") != "east alice|east carol, jr" {
+		t.Fatalf("unexpected join of foreign tables %v, %v", joinRows(res), err)
+	}
+
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("insert customers values 4 dave 10")); !errors.As(err, new(*executor.ErrorModifyForeignTable)) {
+		t.Fatalf("foreign table is modified, %v", err)
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("create customers { id int64 }")); err == nil {
+		t.Fatalf("table shadows a foreign table")
+	}
+	db.Execute(xid, []string{"abort"})
+
+	// 文件变化之后重新扫描, 值不符合字段类型时报错
+	if err := os.WriteFile(csvFile, []byte("id,name,score\n1,alice,90\n2,bob,40\n3,carol,75\n4,dave,60\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rows := viewRows(t, db, "select count(*) from customers"); rows[0] != "4" {
+		t.Fatalf("changed file isn't scanned again, count %v", rows)
+	}
+	if err := os.WriteFile(csvFile, []byte("id,name,score\nx,alice,90\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("select name from customers")); !errors.As(err, new(*executor.ErrorInvalidForeignData)) {
+		t.Fatalf("invalid foreign data is read, %v", err)
+	}
+
+	// 重启之后定义仍然存在, 删除之后不能读取
+	db = executor.NewExecutor(path, 1<<20, 0, 1)
+	if rows := viewRows(t, db, "select region from regions where customer = 1"); len(rows) != 1 || rows[0] != "east" {
+		t.Fatalf("foreign table isn't reloaded %v", rows)
+	}
+	execAll(t, db, true, "drop foreign table regions")
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	defer db.Execute(xid, []string{"commit"})
+	if _, _, err := db.Execute(xid, strings.Fields("select region from regions")); err == nil {
+		t.Fatalf("dropped foreign table is read")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/executor"
+	"myDB/transactions"
+	"strings"
+	"testing"
+)
+
+// 迁移到其他页的DataItem在旧uid处留下转发桩, 快照读以及ReadRef沿转发桩读到新的位置
+func TestForwardingStub(t *testing.T) {
+	path := t.TempDir() + "/forward"
+	tm := transactions.NewTransactionManagerImpl(path)
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, tm)
+	space, _ := dm.CreateSpace()
+	uids := make([]int64, 0)
+	for len(uids) == 0 || dataManager.PageOf(uids[len(uids)-1]) == dataManager.PageOf(uids[0]) {
+		uid, err := dm.InsertIn(transactions.SuperXID, space, bytes.Repeat([]byte{'x'}, 200))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+	grown := bytes.Repeat([]byte{'y'}, 400)
+	old := uids[0]
+	moved, err := dm.Update(transactions.SuperXID, old, grown)
+	if err != nil || moved == old {
+		t.Fatalf("data item on a full page must move, %v", err)
+	}
+	if dm.Read(old) != nil {
+		t.Fatalf("current read must not follow a forwarding stub")
+	}
+	di := dm.ReadSnapShot(old)
+	if di.GetUid() != moved || !bytes.Equal(di.GetData(), grown) {
+		t.Fatalf("snapshot read doesn't follow the forwarding stub")
+	}
+	di.Release()
+	// 再次迁移之后沿两个转发桩读取
+	huge := bytes.Repeat([]byte{'z'}, int(dm.Geometry().MaxItemSize-dataManager.SzDIValid-dataManager.SzDIDataSize))
+	again, _ := dm.Update(transactions.SuperXID, moved, huge)
+	if again == moved {
+		t.Fatalf("data item larger than the free space must move")
+	}
+	guard := dm.NewReadGuard()
+	if data, valid := guard.Read(old); !valid || !bytes.Equal(data, huge) {
+		t.Fatalf("read guard doesn't follow the forwarding chain")
+	}
+	guard.Done()
+	if di := dm.ReadRef(old); di == nil || di.GetUid() != again {
+		t.Fatalf("reference isn't resolved through forwarding stubs")
+	} else {
+		di.Release()
+	}
+	if forwarded := dm.TakeForwarded(); len(forwarded) != 1 || forwarded[old] != again {
+		t.Fatalf("unexpected forwarded references %v", forwarded)
+	}
+
+	// 回滚时恢复原来的数据
+	xid := tm.Begin()
+	original := bytes.Repeat([]byte{'x'}, 200)
+	movedAgain, _ := dm.Update(xid, uids[1], grown)
+	dm.Delete(xid, movedAgain)
+	dm.Unforward(xid, uids[1], original)
+	tm.Abort(xid)
+	if di := dm.Read(uids[1]); di == nil || !bytes.Equal(di.GetData(), original) {
+		t.Fatalf("forwarding stub isn't restored")
+	} else {
+		di.Release()
+	}
+
+	// 转发桩与失效的DataItem一样被清理
+	if n := dm.Purge(transactions.SuperXID, []int64{old, moved}); n != 2 {
+		t.Fatalf("forwarding stubs must be purged, got %d", n)
+	}
+}
+
+// 快照读沿旧版本中的指针读到迁移之后的行, 回滚迁移的Update之后行恢复
+func TestForwardedRows(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/forward", 1<<20, 0, 1)
+	stmts := []string{"create t { v string }"}
+	for i := 0; i < 60; i++ {
+		stmts = append(stmts, "insert t values "+strings.Repeat("a", 100))
+	}
+	execAll(t, db, true, stmts...)
+	reader, _, _ := db.Execute(-1, []string{"begin"})
+	before := viewRows(t, db, "select v from t")
+	db.Execute(reader, strings.Fields("select v from t"))
+	execAll(t, db, true, "update t set v = "+strings.Repeat("b", 300))
+	_, res, err := db.Execute(reader, strings.Fields("select v from t"))
+	if err != nil || strings.Join(joinRows(res), ",") != strings.Join(before, ",") {
+		t.Fatalf("snapshot changes after rows moved, %v", err)
+	}
+	db.Execute(reader, []string{"commit"})
+	execAll(t, db, false, "update t set v = "+strings.Repeat("c", 600))
+	if rows := viewRows(t, db, "select v from t"); len(rows) != 60 || !contains(rows, strings.Repeat("b", 300)) {
+		t.Fatalf("rows aren't restored after rollback")
+	}
+}
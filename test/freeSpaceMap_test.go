@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"os"
+	"testing"
+)
+
+// 正常关闭时写入FSM, 启动时只读FSM页, 不逐页扫描; 崩溃之后回退到逐页扫描
+func TestFreeSpaceMap(t *testing.T) {
+	path := t.TempDir() + "/fsm"
+	open := func() dataManager.DataManager {
+		return dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	}
+	insert := func(dm dataManager.DataManager, space int64, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := dm.InsertIn(transactions.SuperXID, space, bytes.Repeat([]byte{byte(i)}, 300+i%7*100)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	dm := open()
+	space, err := dm.CreateSpace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert(dm, dataManager.SystemSpace, 500)
+	insert(dm, space, 500)
+	dm.Close()
+
+	dm = open()
+	if misses := dm.Status().Pool.Misses; misses > 10 {
+		t.Fatalf("startup reads %d pages with a free space map", misses)
+	}
+	if checked, corrected := dm.VerifyFreeSpace(0); checked == 0 || corrected != 0 {
+		t.Fatalf("loaded free space map drifts, checked %d, corrected %d", checked, corrected)
+	}
+	// 载入的空闲空间表可以用于插入
+	uid, err := dm.InsertIn(transactions.SuperXID, space, []byte("small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert(dm, space, 100)
+	dm.Close()
+
+	// 崩溃之后不使用FSM
+	dm = open()
+	insert(dm, space, 200)
+	dm = open()
+	if misses := dm.Status().Pool.Misses; misses < 100 {
+		t.Fatalf("startup after a crash reads only %d pages", misses)
+	}
+	if _, corrected := dm.VerifyFreeSpace(0); corrected != 0 {
+		t.Fatalf("rebuilt free space map drifts, corrected %d", corrected)
+	}
+	if di := dm.Read(uid); di == nil || string(di.GetData()) != "small" {
+		t.Fatalf("data item inserted with a loaded free space map is lost")
+	} else {
+		di.Release()
+	}
+	dm.Close()
+
+	// 之后的关闭复用已有的FSM页
+	stat, _ := os.Stat(path + "_ts1.fds")
+	for i := 0; i < 2; i++ {
+		dm = open()
+		if misses := dm.Status().Pool.Misses; misses > 10 {
+			t.Fatalf("startup reads %d pages with a free space map", misses)
+		}
+		dm.Close()
+	}
+	if again, _ := os.Stat(path + "_ts1.fds"); again.Size() != stat.Size() {
+		t.Fatalf("free space map pages aren't reused, table space grows from %d to %d", stat.Size(), again.Size())
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"testing"
+)
+
+// 同一个数据文件上打开两个DataManager, 一个写入之后另一个的空闲空间表与页头不一致
+func TestFreeSpaceDrift(t *testing.T) {
+	path := t.TempDir() + "/free"
+	writer := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	first, err := writer.Insert(transactions.SuperXID, []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	verifier := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	if _, err := writer.Insert(transactions.SuperXID, bytes.Repeat([]byte("w"), 7000)); err != nil {
+		t.Fatal(err)
+	}
+	// Insert选中的页放不下数据时按页头修正并改用其他页
+	uid, err := stale.Insert(transactions.SuperXID, bytes.Repeat([]byte("s"), 2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dataManager.PageOf(uid) == dataManager.PageOf(first) {
+		t.Fatalf("insert selected a page that can't fit the data")
+	}
+	checked, corrected := verifier.VerifyFreeSpace(0)
+	if checked == 0 || corrected != 1 {
+		t.Fatalf("unexpected verification result, checked %d, corrected %d", checked, corrected)
+	}
+	if _, corrected := verifier.VerifyFreeSpace(1); corrected != 0 {
+		t.Fatalf("free space map still drifts after correction")
+	}
+}
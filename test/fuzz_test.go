@@ -0,0 +1,37 @@
+package main
+
+import (
+	"myDB/fuzz"
+	"testing"
+)
+
+// go test -fuzz FuzzXxx ./test 使用与go-fuzz相同的入口以及初始语料
+
+func fuzzTarget(f *testing.F, target string, fn func([]byte) int) {
+	corpus := fuzz.Corpus(target)
+	if len(corpus) == 0 {
+		f.Fatalf("empty corpus for %s", target)
+	}
+	for _, input := range corpus {
+		// 初始语料必须是合法的输入
+		if fn(input) != 1 {
+			f.Fatalf("invalid corpus input for %s: %q", target, input)
+		}
+		f.Add(input)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fn(data)
+	})
+}
+
+func FuzzParseSQL(f *testing.F) {
+	fuzzTarget(f, fuzz.TargetParseSQL, fuzz.FuzzParseSQL)
+}
+
+func FuzzDecodeRecord(f *testing.F) {
+	fuzzTarget(f, fuzz.TargetDecodeRecord, fuzz.FuzzDecodeRecord)
+}
+
+func FuzzReplayLogBytes(f *testing.F) {
+	fuzzTarget(f, fuzz.TargetReplayLogBytes, fuzz.FuzzReplayLogBytes)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"myDB/server/network"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type failingChecker struct{}
+
+func (c failingChecker) CheckHealth(timeout time.Duration) error {
+	return errors.New("log is not writable")
+}
+
+func TestHealthProbes(t *testing.T) {
+	health := network.NewHealthServer(time.Second)
+	server := httptest.NewServer(health.Handler())
+	defer server.Close()
+	expect := func(path string, code int) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Fatalf("GET %s: expect %d, got %d", path, code, resp.StatusCode)
+		}
+	}
+	// 崩溃恢复期间存活但没有就绪
+	expect("/livez", http.StatusOK)
+	expect("/readyz", http.StatusServiceUnavailable)
+
+	db := executor.NewExecutor(t.TempDir()+"/health", 1<<20, 0, 1)
+	execAll(t, db, true, "create item { name string }", "insert item values apple")
+	if err := db.CheckHealth(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	health.SetReady(db)
+	expect("/livez", http.StatusOK)
+	expect("/readyz", http.StatusOK)
+
+	health.SetReady(failingChecker{})
+	expect("/livez", http.StatusServiceUnavailable)
+	expect("/readyz", http.StatusServiceUnavailable)
+}
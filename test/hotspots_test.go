@@ -0,0 +1,60 @@
+package main
+
+import (
+	"myDB/executor"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 插入以及变长的Update记录在表的页事件中, 报告列出事件最多的页
+func TestHotspotsReport(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/hotspots", 1<<20, 0, 1)
+	stmts := []string{"create t { k int32 , v string }", "create u { v string }"}
+	for i := 0; i < 100; i++ {
+		stmts = append(stmts, "insert t values "+strconv.Itoa(i%10)+" "+strings.Repeat("a", 150))
+	}
+	execAll(t, db, true, stmts...)
+	execAll(t, db, true, "update t set v = "+strings.Repeat("b", 400)+" where k = 3")
+
+	show := func(args string) [][]string {
+		_, res, err := db.Execute(-1, strings.Fields(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := make([][]string, 0)
+		for _, row := range joinRows(res) {
+			rows = append(rows, strings.Fields(row))
+		}
+		return rows
+	}
+	rows := show("show hotspots t")
+	if len(rows) < 2 || rows[0][0] != "t" || rows[0][1] != "total" {
+		t.Fatalf("unexpected hotspots report %v", rows)
+	}
+	value := func(row []string, col int) int64 {
+		n, _ := strconv.ParseInt(row[col], 10, 64)
+		return n
+	}
+	allocations, inserts, overflows, splits := value(rows[0], 2), value(rows[0], 3), value(rows[0], 4), value(rows[0], 5)
+	if allocations < 2 || inserts < 100 || splits == 0 || overflows < splits {
+		t.Fatalf("unexpected page events %v", rows[0])
+	}
+	// 最热的页排在前面
+	for i := 2; i < len(rows); i++ {
+		prev := value(rows[i-1], 3) + value(rows[i-1], 4) + value(rows[i-1], 5)
+		if cur := value(rows[i], 3) + value(rows[i], 4) + value(rows[i], 5); cur > prev {
+			t.Fatalf("hot pages aren't sorted %v", rows)
+		}
+	}
+	tables := map[string]struct{}{}
+	for _, row := range show("show hotspots") {
+		tables[row[0]] = struct{}{}
+	}
+	if _, ext := tables["u"]; len(tables) != 2 || !ext {
+		t.Fatalf("all tables must be reported, got %v", tables)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("show hotspots missing")); err == nil {
+		t.Fatalf("unknown table must be rejected")
+	}
+}
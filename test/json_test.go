@@ -0,0 +1,37 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestJsonColumn(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/json", 1<<20, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create doc { name string , body json }"))
+	db.Execute(xid, []string{"insert", "doc", "values", "a", `{"age": 30, "tags": [{"k": "x"}, {"k": "y"}]}`})
+	db.Execute(xid, strings.Fields(`insert doc values b {"age":9,"tags":[]}`))
+	if _, _, err := db.Execute(xid, strings.Fields(`insert doc values c {"age":`)); err == nil {
+		t.Fatalf("expect error for invalid json")
+	}
+	// 存储压缩后的JSON
+	_, res, err := db.Execute(xid, strings.Fields("select body body->>$.tags[1].k json_extract(body,$.tags[1].k) body->$.none from doc where name = a"))
+	if err != nil || len(res) != 8 {
+		t.Fatalf("select json failed, res = %v, err = %v", res, err)
+	}
+	expect := []string{`{"age":30,"tags":[{"k":"x"},{"k":"y"}]}`, "y", `"y"`, "null"}
+	for i, e := range expect {
+		if res[4+i].Payload != e {
+			t.Fatalf("expect %s, got %s", e, res[4+i].Payload)
+		}
+	}
+	// 数值比较
+	if _, res, err = db.Execute(xid, strings.Fields("select name from doc where body->$.age > 10")); err != nil || len(res) != 2 || res[1].Payload != "a" {
+		t.Fatalf("where json path failed, res = %v, err = %v", res, err)
+	}
+	if _, _, err = db.Execute(xid, strings.Fields("select name->$.a from doc")); err == nil {
+		t.Fatalf("expect error for path on non json field")
+	}
+	db.Execute(xid, []string{"commit"})
+}
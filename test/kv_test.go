@@ -0,0 +1,55 @@
+package main
+
+import (
+	"myDB/kv"
+	"testing"
+)
+
+func TestKeyValue(t *testing.T) {
+	path := t.TempDir() + "/kv"
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"b", "a", "d", "c"} {
+		if err := db.Put([]byte(k), []byte("v"+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put([]byte("a"), []byte("a value with spaces")); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := db.Get([]byte("a")); err != nil || !ok || string(v) != "a value with spaces" {
+		t.Fatalf("unexpected value %q, %v", v, err)
+	}
+	if err := db.Delete([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := db.Get([]byte("c")); ok {
+		t.Fatalf("deleted key is still visible")
+	}
+	pairs, err := db.Scan([]byte("b"), nil)
+	if err != nil || len(pairs) != 2 || string(pairs[0].Key) != "b" || string(pairs[1].Key) != "d" {
+		t.Fatalf("unexpected scan result %v, %v", pairs, err)
+	}
+	// 回滚的事物不可见
+	tx := db.Begin()
+	tx.Put([]byte("e"), []byte("ve"))
+	if pairs, _ := tx.Scan(nil, []byte("c")); len(pairs) != 2 {
+		t.Fatalf("unexpected scan result in transaction, %v", pairs)
+	}
+	tx.Abort()
+	if _, ok, _ := db.Get([]byte("e")); ok {
+		t.Fatalf("aborted write is visible")
+	}
+	// 关闭之后重新打开
+	db.Close()
+	db, err = kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pairs, _ := db.Scan(nil, nil); len(pairs) != 3 || string(pairs[2].Value) != "vd" {
+		t.Fatalf("unexpected data after reopening, %v", pairs)
+	}
+	db.Close()
+}
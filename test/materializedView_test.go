@@ -0,0 +1,114 @@
+package main
+
+import (
+	"myDB/executor"
+	"myDB/tableManager"
+	"strings"
+	"testing"
+)
+
+// viewRows 按行拼接查询结果, 不包括表头
+func viewRows(t *testing.T, db executor.Executor, query string) []string {
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	defer db.Execute(xid, []string{"commit"})
+	_, res, err := db.Execute(xid, strings.Fields(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return joinRows(res)
+}
+
+func joinRows(res []*tableManager.ResponseObject) []string {
+	rows := make([]string, 0)
+	for _, r := range res {
+		if r.RowId == 0 {
+			continue
+		}
+		if r.ColId == 0 {
+			rows = append(rows, r.Payload)
+		} else {
+			rows[len(rows)-1] += " " + r.Payload
+		}
+	}
+	return rows
+}
+
+func execAll(t *testing.T, db executor.Executor, commit bool, stmts ...string) {
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	for _, stmt := range stmts {
+		if _, _, err := db.Execute(xid, strings.Fields(stmt)); err != nil {
+			db.Execute(xid, []string{"abort"})
+			t.Fatalf("%s: %s", stmt, err)
+		}
+	}
+	if commit {
+		db.Execute(xid, []string{"commit"})
+	} else {
+		db.Execute(xid, []string{"abort"})
+	}
+}
+
+func TestMaterializedView(t *testing.T) {
+	path := t.TempDir() + "/view"
+	db := executor.NewExecutor(path, 1<<22, 0, 0)
+	execAll(t, db, true,
+		"create sales { city string , amount int64 }",
+		"insert sales values sh 10",
+		"insert sales values sh 20",
+		"insert sales values gz 7",
+		"create materialized view city_sales as select city count(*) sum(amount) from sales group by city",
+		"create materialized view big as select city amount from sales where amount > 50",
+	)
+	query := "select city count sum_amount from city_sales"
+	if rows := viewRows(t, db, query); len(rows) != 2 || !contains(rows, "gz 1 7") || !contains(rows, "sh 2 30") {
+		t.Fatalf("unexpected view after create: %v", rows)
+	}
+
+	// 回滚的修改不影响视图
+	execAll(t, db, false, "insert sales values bj 1")
+	// 同一个事物中的修改按分组合并
+	execAll(t, db, true,
+		"insert sales values bj 5",
+		"insert sales values bj 60",
+		"update sales set amount = 100 where amount = 20",
+		"delete sales where city = gz",
+	)
+	rows := viewRows(t, db, query)
+	if len(rows) != 2 || !contains(rows, "bj 2 65") || !contains(rows, "sh 2 110") {
+		t.Fatalf("unexpected view after incremental maintenance: %v", rows)
+	}
+
+	// 非聚合视图只能手动刷新
+	if rows := viewRows(t, db, "select city amount from big"); len(rows) != 0 {
+		t.Fatalf("view without incremental maintenance is changed: %v", rows)
+	}
+	execAll(t, db, true, "refresh materialized view big")
+	if rows := strings.Join(viewRows(t, db, "select amount from big"), ","); rows != "60,100" && rows != "100,60" {
+		t.Fatalf("unexpected view after refresh: %s", rows)
+	}
+
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("insert city_sales values sz 1 1")); err == nil {
+		t.Fatalf("expect error for modifying a materialized view")
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("create materialized view bad as select city amount from sales group by city")); err == nil {
+		t.Fatalf("expect error for selecting a field which isn't grouped")
+	}
+	db.Execute(xid, []string{"abort"})
+
+	// 视图的定义持久化, 重启之后继续维护
+	reopened := executor.NewExecutor(path, 1<<22, 0, 0)
+	execAll(t, reopened, true, "delete sales where city = bj")
+	if rows := strings.Join(viewRows(t, reopened, query), ","); rows != "sh 2 110" {
+		t.Fatalf("unexpected view after reopen: %s", rows)
+	}
+}
+
+func contains(rows []string, row string) bool {
+	for _, r := range rows {
+		if r == row {
+			return true
+		}
+	}
+	return false
+}
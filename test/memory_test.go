@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	util "myDB/dataStructure"
+	"myDB/executor"
+	"myDB/tableManager"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 两个排序共享一个查询的内存预算, 预算不足时溢出到共享的溢出文件目录
+func TestSharedMemoryBudget(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "spill_stale"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	spill := util.NewSpillManager(dir, 0)
+	if _, err := os.Stat(filepath.Join(dir, "spill_stale")); !os.IsNotExist(err) {
+		t.Fatalf("stale spill file isn't removed")
+	}
+	less := func(a, b []string) bool { return atoi(a[0]) < atoi(b[0]) }
+	mem := util.NewMemoryBudget(16<<10, spill)
+	sorters := []*util.ExternalSorter{util.NewBudgetSorter(less, mem, 1), util.NewBudgetSorter(less, mem, 2)}
+	for i := 0; i < 2000; i++ {
+		for _, sorter := range sorters {
+			if err := sorter.Add([]string{strconv.Itoa((i * 37) % 2000), "payload"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if stats := spill.Stats(); stats.Files == 0 || stats.Bytes == 0 {
+		t.Fatalf("nothing is spilled, %+v", stats)
+	}
+	row := util.RowSize([]string{"2000", "payload"})
+	if peak := mem.Peak(); peak > 16<<10 {
+		t.Fatalf("peak memory %d exceeds the budget", peak)
+	}
+	for _, sorter := range sorters {
+		it, err := sorter.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2000; i++ {
+			if r, err := it.Next(); err != nil || r == nil || r[0] != strconv.Itoa(i) {
+				t.Fatalf("expect %d, got %v %v", i, r, err)
+			}
+		}
+		it.Close()
+	}
+	if stats := spill.Stats(); stats.Files != 0 || stats.Bytes != 0 || stats.TotalBytes < 2000*row/2 {
+		t.Fatalf("unexpected spill stats after sorting, %+v", stats)
+	}
+	if !mem.Reserve(16 << 10) {
+		t.Fatalf("memory isn't released after sorting")
+	}
+	mem.Release(16 << 10)
+
+	// 溢出文件超过上限
+	spill.SetLimit(1 << 10)
+	sorter := util.NewBudgetSorter(less, util.NewMemoryBudget(1<<10, spill), 1)
+	defer sorter.Close()
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = sorter.Add([]string{strconv.Itoa(i), "payload"})
+	}
+	var limit *util.ErrorSpillLimit
+	if !errors.As(err, &limit) {
+		t.Fatalf("expect spill limit, got %v", err)
+	}
+}
+
+func TestQueryMemory(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/memory", 1<<20, 0, 1)
+	stmts := []string{"create emp { dept string , boss int64 }"}
+	for i := 0; i < 2000; i++ {
+		boss := -1
+		if i > 0 {
+			boss = (i - 1) / 2
+		}
+		stmts = append(stmts, "insert emp values d"+strconv.Itoa(i%7)+" "+strconv.Itoa(boss))
+	}
+	execAll(t, db, true, stmts...)
+	session := &executor.Session{Database: executor.DefaultDatabase, Vars: executor.NewSessionVariables()}
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	defer db.Execute(xid, []string{"commit"})
+	run := func(stmt string) ([]*tableManager.ResponseObject, error) {
+		_, res, err := db.ExecuteSession(session, xid, strings.Fields(stmt))
+		return res, err
+	}
+	window := "select ID row_number() over (partition by dept order by ID) count(*) over (partition by dept) from emp"
+	expect, err := run(window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spilled := func() int64 {
+		_, res, _ := db.Execute(-1, strings.Fields("show metrics"))
+		for _, row := range joinRows(res) {
+			if name, value, _ := strings.Cut(row, " "); name == "spill_bytes_total" {
+				n, _ := strconv.ParseInt(value, 10, 64)
+				return n
+			}
+		}
+		return -1
+	}
+	before := spilled()
+
+	// 两个窗口的排序共享预算, 不足时溢出, 结果不变
+	if _, err := run("set sort_memory = 150000"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := run(window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(joinRows(res), ",") != strings.Join(joinRows(expect), ",") {
+		t.Fatalf("window result changes after spilling")
+	}
+	if after := spilled(); after <= before {
+		t.Fatalf("window sort isn't spilled, %d -> %d", before, after)
+	}
+
+	// 递归CTE物化的结果不能溢出
+	cte := "with recursive sub as ( select ID dept from emp where ID = 0 union select ID dept from emp where boss = sub.ID ) select ID from sub"
+	if res, err := run(cte); err != nil || len(joinRows(res)) != 2000 {
+		t.Fatalf("unexpected cte result %d rows, err = %v", len(joinRows(res)), err)
+	}
+	if _, err := run("set sort_memory = 20000"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = run(cte)
+	var oom *tableManager.ErrorOutOfQueryMemory
+	if !errors.As(err, &oom) {
+		t.Fatalf("expect out of query memory, got %v", err)
+	}
+}
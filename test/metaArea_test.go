@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"testing"
+)
+
+func TestMetaArea(t *testing.T) {
+	path := t.TempDir() + "/meta"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	if _, ext := dm.ReadMeta(dataManager.MetaFeatures); ext {
+		t.Fatalf("new database should not have any meta section")
+	}
+	sections := map[dataManager.MetaSection][]byte{
+		dataManager.MetaFeatures: bytes.Repeat([]byte("f"), 6000),
+		dataManager.MetaSpaces:   bytes.Repeat([]byte("s"), 6000),
+		dataManager.MetaCounters: bytes.Repeat([]byte("c"), 6000),
+	}
+	for section, data := range sections {
+		if err := dm.WriteMeta(section, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pages := dm.Status().MetaPages; pages < 3 {
+		t.Fatalf("meta area should grow across pages, got %d pages", pages)
+	}
+	if err := dm.WriteMeta(dataManager.MetaSpaces, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 重新打开(崩溃恢复)之后读出元数据区
+	reopened := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	for section, data := range sections {
+		got, ext := reopened.ReadMeta(section)
+		if section == dataManager.MetaSpaces {
+			if ext {
+				t.Fatalf("deleted section is still readable")
+			}
+			continue
+		}
+		if !ext || !bytes.Equal(got, data) {
+			t.Fatalf("section %d mismatch after reopening", section)
+		}
+	}
+}
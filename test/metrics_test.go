@@ -0,0 +1,66 @@
+package main
+
+import (
+	"myDB/dataManager"
+	"myDB/executor"
+	"myDB/storageEngine"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestShowMetrics(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/metrics", 1<<20, 0, 1)
+	execAll(t, db, true, "create item { name string }", "insert item values apple")
+	db.ReportReplica("r1", 0)
+	metrics := func() map[string]int64 {
+		_, res, err := db.Execute(-1, strings.Fields("show metrics"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret := map[string]int64{}
+		for _, row := range joinRows(res) {
+			kv := strings.Fields(row)
+			ret[kv[0]], _ = strconv.ParseInt(kv[1], 10, 64)
+		}
+		return ret
+	}
+	m := metrics()
+	lsn := m["redo_lsn"]
+	if lsn == 0 || m["redo_synced_lsn"] != lsn || m["redo_sync_lag_bytes"] != 0 {
+		t.Fatalf("unexpected redo metrics %v", m)
+	}
+	if m[`replica_applied_lsn{replica="r1"}`] != 0 || m[`replica_lag_bytes{replica="r1"}`] != lsn {
+		t.Fatalf("unexpected replica metrics %v", m)
+	}
+	db.ReportReplica("r1", lsn)
+	if m = metrics(); m[`replica_lag_bytes{replica="r1"}`] != 0 {
+		t.Fatalf("replica lag isn't updated %v", m)
+	}
+	db.ReportReplica("r1", -1)
+	if _, ext := metrics()[`replica_lag_bytes{replica="r1"}`]; ext {
+		t.Fatalf("removed replica is still reported")
+	}
+}
+
+func TestLsnMetrics(t *testing.T) {
+	metrics := storageEngine.LsnMetrics(dataManager.LogStats{
+		Lsn: 1000, FlushedLsn: 900, SyncedLsn: 600, Checkpoint: 100,
+		Replicas: []dataManager.ReplicaLsn{{Name: "a", AppliedLsn: 400}},
+	})
+	want := map[string]int64{
+		"redo_write_lag_bytes":           100,
+		"redo_sync_lag_bytes":            400,
+		"redo_checkpoint_age_bytes":      900,
+		`replica_lag_bytes{replica="a"}`: 600,
+	}
+	for _, metric := range metrics {
+		if v, ext := want[metric.Name]; ext && v != metric.Value {
+			t.Fatalf("%s = %d, want %d", metric.Name, metric.Value, v)
+		}
+		delete(want, metric.Name)
+	}
+	if len(want) != 0 {
+		t.Fatalf("missing metrics %v", want)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"myDB/executor"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMigratePage(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/migrate", 1<<20, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create user { name string , age int64 }")); err != nil {
+		t.Fatal(err)
+	}
+	for _, values := range []string{"tom 10", "bob 20", "amy 30", "joe 40"} {
+		db.Execute(xid, strings.Fields("insert user values "+values))
+	}
+	db.Execute(xid, strings.Fields("delete user where age = 20"))
+	db.Execute(xid, []string{"commit"})
+	names := func(xid int64) string {
+		_, res, err := db.Execute(xid, strings.Fields("select name from user"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret := make([]string, 0)
+		for _, obj := range res[1:] {
+			ret = append(ret, obj.Payload)
+		}
+		sort.Strings(ret)
+		return strings.Join(ret, ",")
+	}
+
+	// 迁移期间已经开始的事物继续读到相同的数据
+	reader, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(reader, strings.Fields("defragment user page 2")); err == nil {
+		t.Fatalf("expect error when defragmenting inside a transaction")
+	}
+	_, res, err := db.Execute(-1, strings.Fields("defragment user page 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[1].Payload != "3" {
+		t.Fatalf("unexpected number of migrated rows, %s", res[1].Payload)
+	}
+	if got := names(reader); got != "amy,joe,tom" {
+		t.Fatalf("unexpected rows read by an older transaction, %s", got)
+	}
+	db.Execute(reader, []string{"commit"})
+
+	// 迁移之后的行可以正常读写
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("update user set name = thomas where age = 10"))
+	db.Execute(xid, strings.Fields("delete user where age = 30"))
+	db.Execute(xid, strings.Fields("insert user values ann 50"))
+	if got := names(xid); got != "ann,joe,thomas" {
+		t.Fatalf("unexpected rows after migration, %s", got)
+	}
+	db.Execute(xid, []string{"commit"})
+	// 新插入的行可能重新使用该页
+	if _, _, err := db.Execute(-1, strings.Fields("defragment user page 2")); err != nil {
+		t.Fatal(err)
+	}
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	defer db.Execute(xid, []string{"commit"})
+	if got := names(xid); got != "ann,joe,thomas" {
+		t.Fatalf("unexpected rows after migrating again, %s", got)
+	}
+}
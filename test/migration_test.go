@@ -0,0 +1,32 @@
+package main
+
+import (
+	"myDB/executor"
+	"myDB/migration"
+	"testing"
+)
+
+func TestMigration(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/migration", 1<<20, 0, 1)
+	runner := migration.NewRunner(db)
+	ms := []*migration.Migration{
+		{Version: 1, Name: "users", Up: []string{"create users { name string }"}},
+		{Version: 2, Name: "seed", Up: []string{"insert users values alice"},
+			Down: []string{"delete users where name = alice"}},
+	}
+	if plan, err := runner.Apply(ms, true); err != nil || len(plan) != 2 {
+		t.Fatalf("dry run: %v %v", plan, err)
+	}
+	if applied, err := runner.Apply(ms, false); err != nil || len(applied) != 2 {
+		t.Fatalf("apply: %v %v", applied, err)
+	}
+	if applied, _ := runner.Apply(ms, false); len(applied) != 0 {
+		t.Fatalf("apply twice: %v", applied)
+	}
+	if rolled, err := runner.Rollback(ms, 1, false); err != nil || len(rolled) != 1 || rolled[0] != 2 {
+		t.Fatalf("rollback: %v %v", rolled, err)
+	}
+	if versions, _ := runner.Applied(); len(versions) != 1 || versions[0] != 1 {
+		t.Fatalf("applied: %v", versions)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"myDB/executor"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const mysqlDump = "-- MySQL dump 10.13  Distrib 8.0.36, for Linux (x86_64)\n" +
+	"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;\n" +
+	"/*!40101 SET NAMES utf8mb4 */;\n" +
+	"DROP TABLE IF EXISTS `users`;\n" +
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;\n" +
+	"CREATE TABLE `users` (\n" +
+	"  `id` int unsigned NOT NULL AUTO_INCREMENT,\n" +
+	"  `name` varchar(64) NOT NULL DEFAULT '',\n" +
+	"  `score` decimal(10,2) DEFAULT NULL COMMENT 'a (b), c',\n" +
+	"  `age` tinyint DEFAULT NULL,\n" +
+	"  `visits` bigint NOT NULL,\n" +
+	"  `profile` json DEFAULT NULL,\n" +
+	"  `kind` enum('a','b') DEFAULT 'a',\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `idx_name_age` (`name`,`age`)\n" +
+	") ENGINE=InnoDB AUTO_INCREMENT=4 DEFAULT CHARSET=utf8mb4;\n" +
+	"LOCK TABLES `users` WRITE;\n" +
+	"/*!40000 ALTER TABLE `users` DISABLE KEYS */;\n" +
+	"INSERT INTO `users` VALUES (1,'Ann O\\'Neil','1.50',30,10000000000,'{\\\"a\\\": 1}','a'),(2,'semi;colon',NULL,NULL,-2,NULL,'b'),\n" +
+	"(3,'line\\nbreak ''quoted''','0.00',0,0,'[]','a');\n" +
+	"/*!40000 ALTER TABLE `users` ENABLE KEYS */;\n" +
+	"UNLOCK TABLES;\n" +
+	"# complete insert\n" +
+	"INSERT INTO `users` (`name`, `id`, `visits`) VALUES ('bob',4,7);\n" +
+	"DELIMITER ;;\n" +
+	"/*!50003 CREATE TRIGGER `t` BEFORE INSERT ON `users` FOR EACH ROW BEGIN SET NEW.age = 1; END */;;\n" +
+	"DELIMITER ;\n" +
+	"INSERT INTO `notes` VALUES ('kept'),('also kept');\n"
+
+// 从mysqldump导入表结构和数据, 忽略注释以及其他语句
+func TestMysqlImport(t *testing.T) {
+	dir := t.TempDir()
+	db := executor.NewExecutor(dir+"/import", 1<<20, 0, 1)
+	// 没有CREATE TABLE的表导入到已经存在的表
+	execAll(t, db, true, "create notes { text string }")
+	file := dir + "/dump.sql"
+	if err := os.WriteFile(file, []byte(mysqlDump), 0666); err != nil {
+		t.Fatal(err)
+	}
+	imp := strings.Fields("import mysql " + file + " batch 2")
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, imp); err == nil {
+		t.Fatalf("expect error for import in a transaction")
+	}
+	db.Execute(xid, []string{"abort"})
+	_, res, err := db.Execute(-1, imp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joinRows(res); len(got) != 2 || got[0] != "users 4 3" || got[1] != "notes 2 0" {
+		t.Fatalf("unexpected import result %s", got)
+	}
+
+	// 类型映射以及字符串转义, 只有表结构的dump创建空表
+	create := mysqlDump[strings.Index(mysqlDump, "CREATE TABLE"):strings.Index(mysqlDump, "LOCK TABLES")]
+	if err := os.WriteFile(dir+"/schema.sql", []byte(strings.Replace(create, "users", "types", 1)), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("import mysql "+dir+"/schema.sql")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("dump types to "+dir+"/types.sql")); err != nil {
+		t.Fatal(err)
+	}
+	schema, _ := os.ReadFile(dir + "/types.sql")
+	want := "create types { id int64 , name string , score string , age int32 , visits int64 , profile json , kind string }"
+	if !strings.Contains(string(schema), want) {
+		t.Fatalf("unexpected type mapping %s", schema)
+	}
+	rows := viewRows(t, db, "select id age visits kind from users")
+	sort.Strings(rows)
+	if strings.Join(rows, ",") != "1 30 10000000000 a,2 0 -2 b,3 0 0 a,4 0 7 " {
+		t.Fatalf("unexpected rows %q", rows)
+	}
+	names := viewRows(t, db, "select name from users")
+	sort.Strings(names)
+	if strings.Join(names, "|") != "Ann O'Neil|bob|line\nbreak 'quoted'|semi;colon" {
+		t.Fatalf("unexpected strings %q", names)
+	}
+	if notes := viewRows(t, db, "select text from notes"); len(notes) != 2 {
+		t.Fatalf("unexpected rows in the existing table %q", notes)
+	}
+
+	// 表已经存在时失败, 语法错误的dump返回错误
+	if _, _, err := db.Execute(-1, imp); err == nil {
+		t.Fatalf("expect error for an existing table")
+	}
+	if err := os.WriteFile(file, []byte("INSERT INTO `users` VALUES (1,'unterminated);\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Execute(-1, imp); err == nil {
+		t.Fatalf("expect error for a malformed dump")
+	}
+}
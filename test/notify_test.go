@@ -0,0 +1,75 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestListenNotify(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/notify", 1<<20, 0, 0)
+	listener := executor.NewListener(2)
+	listening := &executor.Session{Database: executor.DefaultDatabase, Listener: listener}
+	writer := &executor.Session{Database: executor.DefaultDatabase}
+	if _, _, err := db.ExecuteSession(writer, -1, strings.Fields("listen cache")); err == nil {
+		t.Fatalf("expect error for a session without listener")
+	}
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create user { name string , age int64 }")); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, []string{"commit"})
+	for _, stmt := range []string{"listen table user", "listen cache"} {
+		if _, _, err := db.ExecuteSession(listening, -1, strings.Fields(stmt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 回滚的事物不发送通知
+	xid, _, _ = db.ExecuteSession(writer, -1, []string{"begin"})
+	db.ExecuteSession(writer, xid, strings.Fields("insert user values tom 10"))
+	db.ExecuteSession(writer, xid, strings.Fields("notify cache rolled back"))
+	db.ExecuteSession(writer, xid, []string{"abort"})
+	if len(listener.C) != 0 {
+		t.Fatalf("notification of an aborted transaction is delivered")
+	}
+
+	// 提交之后投递, 相同的通知只投递一次
+	xid, _, _ = db.ExecuteSession(writer, -1, []string{"begin"})
+	db.ExecuteSession(writer, xid, strings.Fields("insert user values tom 10"))
+	db.ExecuteSession(writer, xid, strings.Fields("insert user values bob 20"))
+	db.ExecuteSession(writer, xid, strings.Fields("notify cache user changed"))
+	if len(listener.C) != 0 {
+		t.Fatalf("notification is delivered before commit")
+	}
+	db.ExecuteSession(writer, xid, []string{"commit"})
+	if n := <-listener.C; n.Channel != executor.TableChannelPrefix+"user" || n.Payload != "insert" || n.Xid != xid {
+		t.Fatalf("unexpected notification %v", n)
+	}
+	if n := <-listener.C; n.Channel != "cache" || n.Payload != "user changed" {
+		t.Fatalf("unexpected notification %v", n)
+	}
+
+	// 缓冲区已满时丢弃
+	for i := 0; i < 3; i++ {
+		db.ExecuteSession(writer, -1, strings.Fields("notify cache flush"))
+	}
+	if len(listener.C) != 2 || listener.Dropped() != 1 {
+		t.Fatalf("unexpected buffered %d, dropped %d", len(listener.C), listener.Dropped())
+	}
+	<-listener.C
+	<-listener.C
+
+	db.ExecuteSession(listening, -1, strings.Fields("unlisten cache"))
+	db.ExecuteSession(writer, -1, strings.Fields("notify cache flush"))
+	if len(listener.C) != 0 {
+		t.Fatalf("notification is delivered after unlisten")
+	}
+	db.CloseListener(listener)
+	if _, ok := <-listener.C; ok {
+		t.Fatalf("listener isn't closed")
+	}
+	xid, _, _ = db.ExecuteSession(writer, -1, []string{"begin"})
+	db.ExecuteSession(writer, xid, strings.Fields("delete user where age = 10"))
+	db.ExecuteSession(writer, xid, []string{"commit"})
+}
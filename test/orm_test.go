@@ -0,0 +1,116 @@
+package main
+
+import (
+	"myDB/executor"
+	"myDB/orm"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ormProfile struct {
+	Tags  []string `json:"tags"`
+	Level int      `json:"level"`
+}
+
+type ormUser struct {
+	Id      int64      `db:"ID"`
+	Name    string     `db:"name"`
+	Age     uint8      `db:"age"`
+	Active  bool       `db:"active"`
+	Visits  int64      `db:"visits"`
+	Score   float64    `db:"score"`
+	Joined  time.Time  `db:"joined"`
+	Profile ormProfile `db:"profile,json"`
+	Cache   string     `db:"-"`
+	secret  string
+}
+
+// 结构体按标签映射为表中的行
+func TestOrm(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/orm", 1<<20, 0, 1)
+	users, err := orm.NewTable[ormUser](db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Create(orm.NoTrans); err != nil {
+		t.Fatal(err)
+	}
+	joined := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	ann := &ormUser{Id: -1, Name: "Ann O'Neil where", Age: 30, Active: true, Visits: 1 << 40, Score: 1.5, Joined: joined,
+		Profile: ormProfile{Tags: []string{"a b", "c"}, Level: 3}, Cache: "ignored", secret: "ignored"}
+	bob := &ormUser{Id: -1, Name: "bob", Age: 7}
+	if err := users.Insert(orm.NoTrans, ann, bob); err != nil {
+		t.Fatal(err)
+	}
+	if ann.Id < 0 || bob.Id < 0 || ann.Id == bob.Id {
+		t.Fatalf("primary keys aren't backfilled, %d %d", ann.Id, bob.Id)
+	}
+
+	rows, err := users.Select(orm.NoTrans, orm.Where("ID", "=", ann.Id)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	got := rows[0]
+	if got.Id != ann.Id || got.Name != ann.Name || got.Age != 30 || !got.Active || got.Visits != 1<<40 || got.Score != 1.5 ||
+		!got.Joined.Equal(joined) || strings.Join(got.Profile.Tags, ",") != "a b,c" || got.Profile.Level != 3 || got.Cache != "" {
+		t.Fatalf("unexpected row %+v", got)
+	}
+
+	// 修改所有字段, 在自己的事务中执行
+	bob.Name, bob.Active, bob.Profile.Level = "robert", true, 9
+	if err := users.Update(orm.NoTrans, bob); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = users.Select(orm.NoTrans, orm.Where("name", "=", "robert")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Id != bob.Id || !rows[0].Active || rows[0].Age != 7 || rows[0].Profile.Level != 9 {
+		t.Fatalf("unexpected updated rows %+v", rows)
+	}
+
+	// 事务中的修改在回滚后撤销
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if err := users.Delete(xid, ann); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, []string{"abort"})
+	if rows, _ = users.Select(orm.NoTrans); len(rows) != 2 {
+		t.Fatalf("aborted delete is visible, %+v", rows)
+	}
+	if err := users.Delete(orm.NoTrans, ann); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Delete(orm.NoTrans, ann); err == nil {
+		t.Fatalf("expect error for deleting a missing row")
+	}
+	if err := users.Update(orm.NoTrans, ann); err == nil {
+		t.Fatalf("expect error for updating a missing row")
+	}
+
+	// Scan直接转换查询结果, 多余的字段忽略
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	_, res, err := db.Execute(xid, strings.Fields("select name age from users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, []string{"commit"})
+	names, err := orm.Scan[struct {
+		Name string `db:"name"`
+	}](res)
+	if err != nil || len(names) != 1 || names[0].Name != "robert" {
+		t.Fatalf("unexpected scanned rows %+v, err = %v", names, err)
+	}
+
+	// 不支持的类型
+	if _, err := orm.NewTable[struct{ C chan int }](db, "bad"); err == nil {
+		t.Fatalf("expect error for an unsupported field type")
+	}
+	if _, err := orm.NewTable[int](db, "bad"); err == nil {
+		t.Fatalf("expect error for a non-struct type")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestReclaimOrphanPages(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/orphan", 1<<20, 0, 1)
+	execAll(t, db, true,
+		"create user { name string , age int64 }",
+		"insert user values tom 10",
+		"insert user values bob 20",
+		"insert user values amy 30",
+	)
+	// 回滚的建表留下的表空间
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create tmp { name string }"))
+	db.Execute(xid, strings.Fields("insert tmp values x"))
+	db.Execute(xid, []string{"abort"})
+
+	orphans := func(stmt string) string {
+		_, res, err := db.Execute(-1, strings.Fields(stmt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(joinRows(res), ";")
+	}
+	expect := "2 2"
+	if got := orphans("reclaim orphans dryrun"); got != expect {
+		t.Fatalf("unexpected orphan pages, %s", got)
+	}
+	// 有其他活跃事物时不能回收
+	reader, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(-1, strings.Fields("reclaim orphans")); err == nil {
+		t.Fatalf("expect error when other transactions are active")
+	}
+	if _, _, err := db.Execute(reader, strings.Fields("reclaim orphans")); err == nil {
+		t.Fatalf("expect error when reclaiming inside a transaction")
+	}
+	db.Execute(reader, []string{"commit"})
+	if got := orphans("reclaim orphans"); got != expect {
+		t.Fatalf("unexpected reclaimed pages, %s", got)
+	}
+	if got := orphans("reclaim orphans dryrun"); got != "" {
+		t.Fatalf("expect no orphan pages after reclaiming, %s", got)
+	}
+
+	// 回收的页重新用于插入
+	execAll(t, db, true, "insert user values joe 40")
+	if got := viewRows(t, db, "select name from user"); !contains(got, "tom") || !contains(got, "joe") || !contains(got, "amy") {
+		t.Fatalf("unexpected rows after reclaiming, %s", got)
+	}
+	if got := orphans("reclaim orphans dryrun"); got != "" {
+		t.Fatalf("expect no orphan pages, %s", got)
+	}
+}
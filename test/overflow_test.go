@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/executor"
+	"myDB/transactions"
+	"strings"
+	"testing"
+)
+
+// 超过一个页的数据写入溢出链, 读取时拼出完整的数据
+func TestOverflowDataItem(t *testing.T) {
+	path := t.TempDir() + "/overflow"
+	tm := transactions.NewTransactionManagerImpl(path)
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, tm)
+	for _, checked := range []bool{false, true} {
+		space, _ := dm.CreateSpace()
+		if err := dm.SetChecksum(space, checked); err != nil {
+			t.Fatal(err)
+		}
+		large := bytes.Repeat([]byte("0123456789abcdef"), 6400)
+		uid, err := dm.InsertIn(transactions.SuperXID, space, large)
+		if err != nil {
+			t.Fatal(err)
+		}
+		di := dm.Read(uid)
+		if di == nil || di.GetDataLength() != int64(len(large)) || !bytes.Equal(di.GetData(), large) {
+			t.Fatalf("unexpected overflow data item, checksum %v", checked)
+		}
+		di.Release()
+		guard := dm.NewReadGuard()
+		if data, valid := guard.Read(uid); !valid || !bytes.Equal(data, large) {
+			t.Fatalf("read guard doesn't assemble the overflow chain")
+		}
+		guard.Done()
+
+		// 小数据更新为大数据, 大数据更新为小数据
+		small, err := dm.InsertIn(transactions.SuperXID, space, []byte("small"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		grown := bytes.Repeat([]byte{'g'}, 20000)
+		if small, err = dm.Update(transactions.SuperXID, small, grown); err != nil {
+			t.Fatal(err)
+		}
+		if di := dm.ReadSnapShot(small); !bytes.Equal(di.GetData(), grown) {
+			t.Fatalf("small data item isn't updated to an overflow chain")
+		} else {
+			di.Release()
+		}
+		if uid, err = dm.Update(transactions.SuperXID, uid, []byte("shrunk")); err != nil {
+			t.Fatal(err)
+		}
+		if di := dm.ReadSnapShot(uid); string(di.GetData()) != "shrunk" {
+			t.Fatalf("overflow data item isn't updated in place")
+		} else {
+			di.Release()
+		}
+
+		// 回滚更新之后溢出头指向原来的溢出链
+		xid := tm.Begin()
+		if _, err := dm.Update(xid, small, bytes.Repeat([]byte{'h'}, 30000)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dm.Update(xid, small, grown); err != nil {
+			t.Fatal(err)
+		}
+		tm.Abort(xid)
+		if di := dm.ReadSnapShot(small); !bytes.Equal(di.GetData(), grown) {
+			t.Fatalf("overflow data item isn't restored")
+		} else {
+			di.Release()
+		}
+
+		// 可达的溢出头引用的溢出段不是孤儿页
+		reachable := map[int64]struct{}{dataManager.PageOf(uid): {}, dataManager.PageOf(small): {}}
+		if orphans := dm.ReclaimPages(transactions.SuperXID, space, reachable, true); len(orphans) == 0 {
+			t.Fatalf("the chain of the shrunk data item must be orphaned")
+		}
+		dm.ReclaimPages(transactions.SuperXID, space, reachable, false)
+		if di := dm.ReadSnapShot(small); !bytes.Equal(di.GetData(), grown) {
+			t.Fatalf("live overflow chain is reclaimed")
+		} else {
+			di.Release()
+		}
+	}
+}
+
+// 大字段的插入以及更新在崩溃之后重做
+func TestOverflowRecord(t *testing.T) {
+	path := t.TempDir() + "/overflow"
+	db := executor.NewExecutor(path, 1<<20, 0, 1)
+	body := strings.Repeat("x", 50000)
+	execAll(t, db, true, "create docs { name string , body string }", "insert docs values a "+body,
+		"insert docs values b small")
+	execAll(t, db, true, "update docs set body = "+strings.Repeat("y", 30000)+" where name = b")
+	execAll(t, db, false, "update docs set body = z where name = a")
+	db = executor.NewExecutor(path, 1<<20, 0, 1)
+	rows := viewRows(t, db, "select name body from docs")
+	if len(rows) != 2 || !contains(rows, "a "+body) || !contains(rows, "b "+strings.Repeat("y", 30000)) {
+		t.Fatalf("large records aren't recovered, %d rows", len(rows))
+	}
+}
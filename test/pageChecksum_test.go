@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"myDB/dataManager"
+	"myDB/dbError"
+	"myDB/transactions"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 写回的页带校验和, 读入时校验; 校验失败的页返回ErrorPageChecksum或者由修复函数修复
+func TestPageChecksum(t *testing.T) {
+	path := t.TempDir() + "/pageChecksum"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	space, _ := dm.CreateSpace()
+	uid, err := dm.InsertIn(transactions.SuperXID, space, []byte("page checksum "+strings.Repeat("x", 64)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	dm.Close()
+
+	pageId := dataManager.PageOf(uid)
+	file := fmt.Sprintf("%s%s%d%s", path, dataManager.SpaceFileInfix, space, dataManager.FileSuffix)
+	f, err := os.OpenFile(file, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	good := make([]byte, dataManager.DefaultPageSize)
+	if _, err := f.ReadAt(good, (pageId-1)*dataManager.DefaultPageSize); err != nil {
+		t.Fatal(err)
+	}
+	if geo := dm.Geometry(); geo.Checksum != dataManager.ChecksumCrc32 || good[dataManager.SzPgUsed]&dataManager.PageFormatFlag == 0 {
+		t.Fatalf("page is written without 32-bit checksum, %+v", geo)
+	}
+	bad := append([]byte{}, good...)
+	bad[bytes.Index(bad, []byte("page checksum"))] = 'P'
+	if _, err := f.WriteAt(bad, (pageId-1)*dataManager.DefaultPageSize); err != nil {
+		t.Fatal(err)
+	}
+
+	// 损坏的页不影响打开数据库, 读取时返回错误
+	dm = dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	_, err = dm.Checked().Read(uid)
+	if !errors.Is(err, dbError.ErrCorruptPage) || !errors.As(err, new(*dataManager.ErrorPageChecksum)) {
+		t.Fatalf("expect page checksum error, got %v", err)
+	}
+	if stats, _ := dm.Scrub(true); len(stats.Corrupt) != 1 || stats.Corrupt[0].PageId != pageId {
+		t.Fatalf("corrupt page isn't found by scrub, %+v", stats)
+	}
+	dm.Close()
+
+	// 修复函数返回的页代替损坏的页并写回
+	repaired := 0
+	dataManager.SetPageRepair(func(name string, id int64, data []byte) ([]byte, error) {
+		if name != file || id != pageId || !bytes.Equal(data, bad) {
+			return nil, fmt.Errorf("unexpected page %d in %s", id, name)
+		}
+		repaired++
+		return append([]byte{}, good...), nil
+	})
+	defer dataManager.SetPageRepair(nil)
+	dm = dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	di, err := dm.Checked().Read(uid)
+	if err != nil || !strings.HasPrefix(string(di.GetData()), "page checksum") || repaired != 1 {
+		t.Fatalf("page isn't repaired, %d repairs, %v", repaired, err)
+	}
+	di.Release()
+	if stats, _ := dm.Scrub(true); len(stats.Corrupt) != 0 {
+		t.Fatalf("repaired page isn't written back, %+v", stats)
+	}
+	dm.Close()
+
+	// 清除格式标志以及校验和的页不能绕过校验
+	dataManager.SetPageRepair(nil)
+	bad[dataManager.SzPgUsed] &^= dataManager.PageFormatFlag
+	copy(bad[dataManager.DefaultPageSize-dataManager.SzPageTrailer:], make([]byte, dataManager.SzPageTrailer))
+	if _, err := f.WriteAt(bad, (pageId-1)*dataManager.DefaultPageSize); err != nil {
+		t.Fatal(err)
+	}
+	dm = dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	defer dm.Close()
+	if _, err := dm.Checked().Read(uid); !errors.As(err, new(*dataManager.ErrorPageChecksum)) {
+		t.Fatalf("page without format flag isn't rejected, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"myDB/dataManager"
+	"myDB/dbError"
+	"myDB/transactions"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPageEncryption(t *testing.T) {
+	path := t.TempDir() + "/secret"
+	key := dataManager.StaticKey(bytes.Repeat([]byte{0x5a}, 32))
+	open := func(opts ...dataManager.Option) dataManager.DataManager {
+		return dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path), opts...)
+	}
+	expectError := func(name, dir string, target any, opts ...dataManager.Option) {
+		t.Helper()
+		if _, err := dataManager.Open(dir, 1<<20, 0, transactions.NewTransactionManagerImpl(dir), opts...); !errors.As(err, target) {
+			t.Fatalf("%s doesn't fail with %T, got %v", name, target, err)
+		}
+	}
+	secret := bytes.Repeat([]byte("top secret payload "), 20)
+	dm := open(dataManager.WithEncryption(key))
+	space, _ := dm.CreateSpace()
+	uids := make([]int64, 0)
+	for i := 0; i < 50; i++ {
+		uid, err := dm.InsertIn(transactions.SuperXID, space, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+	// 另一个表空间中相同页号的页
+	otherSpace, _ := dm.CreateSpace()
+	otherUid, err := dm.InsertIn(transactions.SuperXID, otherSpace, secret)
+	if err != nil || dataManager.PageOf(otherUid) != dataManager.PageOf(uids[0]) {
+		t.Fatalf("data item in another table space isn't on the same page, %v", err)
+	}
+	geo := dm.Geometry()
+	if geo.PageLimit != geo.PageSize-dataManager.SzPageCipher-dataManager.SzPageTrailer {
+		t.Fatalf("encrypted pages don't reserve space for the cipher trailer")
+	}
+	// 保留字节属于每个数据库, 同时打开的没有加密的数据库使用完整的页
+	other := t.TempDir() + "/plain"
+	plainDm := dataManager.OpenDataManager(other, 1<<20, 0, transactions.NewTransactionManagerImpl(other))
+	if g := plainDm.Geometry(); g.PageLimit != g.PageSize-dataManager.SzPageTrailer {
+		t.Fatalf("unencrypted database opened alongside reserves %d bytes", g.PageSize-g.PageLimit)
+	}
+	if _, err := plainDm.Insert(transactions.SuperXID, secret); err != nil {
+		t.Fatal(err)
+	}
+	plainDm.Close()
+	dm.Close()
+
+	// 数据文件中没有明文
+	files, _ := filepath.Glob(path + "*" + dataManager.FileSuffix)
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(raw, []byte("top secret")) {
+			t.Fatalf("plaintext is found in %s", file)
+		}
+	}
+
+	// 密钥校验值由HMAC派生, 不是全0块的密文(GHASH子密钥)
+	meta, err := os.ReadFile(path + dataManager.FileSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(key)
+	zeroBlock := make([]byte, aes.BlockSize)
+	block.Encrypt(zeroBlock, zeroBlock)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(dataManager.KeyCheckLabel))
+	record := meta[dataManager.EncryptionOffset : dataManager.EncryptionOffset+dataManager.SzCipherMode+dataManager.SzKeyCheck]
+	if int32(binary.BigEndian.Uint32(record)) != dataManager.CipherAesGcmHmac || bytes.Equal(record[dataManager.SzCipherMode:], zeroBlock[:8]) ||
+		!bytes.Equal(record[dataManager.SzCipherMode:], mac.Sum(nil)[:8]) {
+		t.Fatalf("unexpected key check record %x", record)
+	}
+	// 之前的版本记录的校验值仍然可以打开, 之后改写为新的校验值
+	binary.BigEndian.PutUint32(record, uint32(dataManager.CipherAesGcm))
+	copy(record[dataManager.SzCipherMode:], zeroBlock[:8])
+	metaTrailer := geo.PageSize - dataManager.SzPageTrailer
+	metaId := make([]byte, 8)
+	binary.BigEndian.PutUint64(metaId, uint64(dataManager.PageNumberDbMeta))
+	binary.BigEndian.PutUint32(meta[metaTrailer:], crc32.Update(crc32.ChecksumIEEE(metaId), crc32.IEEETable, meta[:metaTrailer]))
+	if err := os.WriteFile(path+dataManager.FileSuffix, meta, 0666); err != nil {
+		t.Fatal(err)
+	}
+	open(dataManager.WithEncryption(key)).Close()
+	if meta, _ = os.ReadFile(path + dataManager.FileSuffix); int32(binary.BigEndian.Uint32(meta[dataManager.EncryptionOffset:])) != dataManager.CipherAesGcmHmac {
+		t.Fatalf("legacy key check isn't replaced")
+	}
+
+	// 错误的密钥以及没有密钥时打开失败
+	expectError("opening with wrong key", path, new(*dataManager.ErrorEncryptionKey),
+		dataManager.WithEncryption(dataManager.StaticKey(bytes.Repeat([]byte{0x33}, 32))))
+	expectError("opening without key", path, new(*dataManager.ErrorEncryptionMismatch))
+
+	dm = open(dataManager.WithEncryption(key))
+	for _, uid := range uids {
+		di := dm.Read(uid)
+		if di == nil || !bytes.Equal(di.GetData(), secret) {
+			t.Fatalf("data item %d isn't decrypted", uid)
+		}
+		di.Release()
+	}
+	if stats, err := dm.Scrub(true); err != nil || len(stats.Corrupt) != 0 {
+		t.Fatalf("scrub fails on encrypted pages, %v %+v", err, stats.Corrupt)
+	}
+	dm.Close()
+
+	// 被篡改的页解密失败
+	file := path + dataManager.SpaceFileInfix + "1" + dataManager.FileSuffix
+	f, err := os.OpenFile(file, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := (dataManager.PageOf(uids[0]) - 1) * geo.PageSize
+	page := make([]byte, geo.PageSize)
+	if _, err := f.ReadAt(page, offset); err != nil {
+		t.Fatal(err)
+	}
+	original := append([]byte{}, page...)
+	// 校验和仍然正确, 只能由解密发现
+	page[geo.PageLimit-1] ^= 0xff
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, uint64(dataManager.PageOf(uids[0])))
+	trailer := geo.PageSize - dataManager.SzPageTrailer
+	binary.BigEndian.PutUint32(page[trailer:], crc32.Update(crc32.ChecksumIEEE(id), crc32.IEEETable, page[:trailer]))
+	if _, err := f.WriteAt(page, offset); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	// 放到另一个表空间相同页号的位置, 校验和仍然正确(只包含页号), 解密失败
+	otherFile := path + dataManager.SpaceFileInfix + "2" + dataManager.FileSuffix
+	if f, err = os.OpenFile(otherFile, os.O_RDWR, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(original, offset); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	ro := dataManager.OpenDataManagerReadOnly(path, 1<<20, dataManager.WithEncryption(key))
+	if stats, _ := ro.Scrub(true); len(stats.Corrupt) != 2 {
+		t.Fatalf("tampered and swapped pages aren't detected, %+v", stats.Corrupt)
+	} else {
+		for _, corrupt := range stats.Corrupt {
+			if corrupt.Reason != "page decryption fails" {
+				t.Fatalf("unexpected corrupt page %+v", corrupt)
+			}
+		}
+	}
+	if _, err := ro.Checked().Read(otherUid); !errors.Is(err, dbError.ErrCorruptPage) {
+		t.Fatalf("reading page swapped from another table space doesn't fail, %v", err)
+	}
+	if _, err := ro.Checked().Read(uids[0]); !errors.Is(err, dbError.ErrCorruptPage) {
+		t.Fatalf("reading tampered page doesn't fail, %v", err)
+	}
+	ro.Close()
+	// 页与表空间绑定, 加密的数据库不能挂载表空间的数据文件
+	dm = open(dataManager.WithEncryption(key))
+	if _, err := dm.AttachSpace(file); !errors.As(err, new(*dataManager.ErrorEncryptedAttach)) {
+		t.Fatalf("encrypted database attaches a table space file, %v", err)
+	}
+	dm.Close()
+
+	// 没有加密的数据库不能用密钥打开
+	plain := t.TempDir() + "/plain"
+	dataManager.OpenDataManager(plain, 1<<20, 0, transactions.NewTransactionManagerImpl(plain)).Close()
+	expectError("opening unencrypted database with key", plain, new(*dataManager.ErrorEncryptionMismatch), dataManager.WithEncryption(key))
+}
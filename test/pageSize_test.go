@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"os"
+	"testing"
+)
+
+func TestPageSize(t *testing.T) {
+	path := t.TempDir() + "/page"
+	open := func(dir string, opts ...dataManager.Option) (dataManager.DataManager, error) {
+		return dataManager.Open(dir, 1<<20, 0, transactions.NewTransactionManagerImpl(dir), opts...)
+	}
+	// 16K的页可以存放超过8K的DataItem
+	dm, err := open(path, dataManager.WithPageSize(16384))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wide := bytes.Repeat([]byte{'w'}, 12000)
+	uid, err := dm.Insert(transactions.SuperXID, wide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if geo := dm.Geometry(); geo.PageSize != 16384 || geo.MaxItemSize < int64(len(wide)) {
+		t.Fatalf("database isn't created with 16K pages")
+	}
+	// 页大小属于每个数据库, 同时打开的数据库可以使用不同的页大小
+	small, err := open(t.TempDir()+"/small", dataManager.WithPageSize(4096))
+	if err != nil {
+		t.Fatalf("opening 4K database alongside fails, %v", err)
+	}
+	if geo := small.Geometry(); geo.PageSize != 4096 || geo.MaxItemSize >= 4096 {
+		t.Fatalf("database isn't created with 4K pages, %+v", geo)
+	}
+	narrow := bytes.Repeat([]byte{'n'}, 3000)
+	smallUid, err := small.Insert(transactions.SuperXID, narrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if di := small.Read(smallUid); di == nil || !bytes.Equal(di.GetData(), narrow) {
+		t.Fatalf("data item in the 4K database is lost")
+	} else {
+		di.Release()
+	}
+	small.Close()
+	dm.Close()
+
+	// 重新打开时使用记录的页大小
+	if dm, err = open(path); err != nil {
+		t.Fatal(err)
+	}
+	if size := dm.Geometry().PageSize; size != 16384 {
+		t.Fatalf("database is reopened with %d bytes pages", size)
+	}
+	if di := dm.Read(uid); di == nil || !bytes.Equal(di.GetData(), wide) {
+		t.Fatalf("wide data item is lost after reopening")
+	} else {
+		di.Release()
+	}
+	dm.Close()
+	if stat, _ := os.Stat(path + dataManager.FileSuffix); stat.Size()%16384 != 0 {
+		t.Fatalf("data file size %d isn't a multiple of the page size", stat.Size())
+	}
+	// 与记录的页大小不一致以及不合法的页大小时Open返回错误
+	var mismatch *dataManager.ErrorPageSizeMismatch
+	if _, err := open(path, dataManager.WithPageSize(8192)); !errors.As(err, &mismatch) || mismatch.Stored != 16384 {
+		t.Fatalf("opening with 8K pages doesn't fail with page size mismatch, got %v", err)
+	}
+	if _, err := open(t.TempDir()+"/odd", dataManager.WithPageSize(5000)); !errors.As(err, new(*dataManager.ErrorInvalidPageSize)) {
+		t.Fatalf("invalid page size isn't rejected, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"myDB/executor"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParallelScan(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/parallel", 1<<22, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create item { name string , price int64 }"))
+	pad := strings.Repeat("x", 200)
+	for i := 0; i < 300; i++ {
+		db.Execute(xid, strings.Fields("insert item values "+pad+strconv.Itoa(i)+" "+strconv.Itoa(i%10)))
+	}
+	sequential := &executor.Session{Database: executor.DefaultDatabase}
+	parallel := &executor.Session{Database: executor.DefaultDatabase, Parallel: 4}
+	for _, query := range []string{
+		"select ID name price from item",
+		"select ID price from item where price > 5",
+		"select price sum(price) over (partition by price) from item where price < 3",
+	} {
+		_, want, err := db.ExecuteSession(sequential, xid, strings.Fields(query))
+		if err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+		_, got, err := db.ExecuteSession(parallel, xid, strings.Fields(query))
+		if err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("%s: parallel scan result differs from sequential scan", query)
+		}
+	}
+	db.Execute(xid, []string{"commit"})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/binary"
+	"myDB/executor"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCopyParquet(t *testing.T) {
+	dir := t.TempDir()
+	db := executor.NewExecutor(dir+"/parquet", 1<<20, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create t { name string , age int32 }"))
+	for _, v := range []string{"a 1", "b 2", "c 3"} {
+		db.Execute(xid, strings.Fields("insert t values "+v))
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("copy t to "+dir+"/t.parquet rowgroup 2")); err != nil {
+		t.Fatalf("copy table failed, err = %v", err)
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("copy ( select name from t where age > 1 ) to "+dir+"/q.parquet")); err != nil {
+		t.Fatalf("copy query failed, err = %v", err)
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("copy t into x")); err == nil {
+		t.Fatalf("expect error for invalid copy statement")
+	}
+	db.Execute(xid, []string{"commit"})
+	for _, f := range []string{"/t.parquet", "/q.parquet"} {
+		data, err := os.ReadFile(dir + f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := len(data)
+		footer := int(binary.LittleEndian.Uint32(data[n-8 : n-4]))
+		if string(data[:4]) != "PAR1" || string(data[n-4:]) != "PAR1" || footer <= 0 || footer > n-12 {
+			t.Fatalf("invalid parquet file %s", f)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func planCacheReport(t *testing.T, db executor.Executor, xid int64) string {
+	_, res, err := db.Execute(xid, strings.Fields("show engine status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make([]string, 0, len(res))
+	for _, r := range res {
+		lines = append(lines, r.Payload)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestPlanCache(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/plans", 1<<22, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create item { name string , price int64 }"))
+	db.Execute(xid, strings.Fields("insert item values apple 3"))
+	for i := 0; i < 3; i++ {
+		if _, res, err := db.Execute(xid, strings.Fields("select name from item where price = 3")); err != nil || len(res) != 2 {
+			t.Fatalf("unexpected select result, err = %v", err)
+		}
+	}
+	// 其他表的DDL不影响item的计划
+	db.Execute(xid, strings.Fields("create order { item int64 }"))
+	db.Execute(xid, strings.Fields("insert item values pear 5"))
+	if _, res, err := db.Execute(xid, strings.Fields("select name from item where price = 5")); err != nil || len(res) != 2 || res[1].Payload != "pear" {
+		t.Fatalf("unexpected select result, err = %v", err)
+	}
+	db.Execute(xid, strings.Fields("select   name from item where price = 5"))
+	report := planCacheReport(t, db, xid)
+	for _, want := range []string{"PLAN CACHE", "Plans cached 2", "Plan hits 3, misses 2", "Plans invalidated 0"} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report doesn't contain %q:\n%s", want, report)
+		}
+	}
+	db.Execute(xid, []string{"commit"})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"myDB/executor"
+	"myDB/versionManager"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 主键点查跳过解析以及扫描, 结果与普通查询一致
+func TestPointLookup(t *testing.T) {
+	path := t.TempDir() + "/point"
+	db := executor.NewExecutor(path, 1<<20, 0, versionManager.ReadRepeatable)
+	stmts := []string{"create t { name string , n int64 }"}
+	for i := 0; i < 200; i++ {
+		stmts = append(stmts, fmt.Sprintf("insert t values r%d %d", i, i*10))
+	}
+	execAll(t, db, true, stmts...)
+	metric := func(name string) int64 {
+		_, res, _ := db.Execute(-1, strings.Fields("show metrics"))
+		for _, row := range joinRows(res) {
+			if n, value, _ := strings.Cut(row, " "); n == name {
+				v, _ := strconv.ParseInt(value, 10, 64)
+				return v
+			}
+		}
+		return -1
+	}
+	lookup := func(id int) []string {
+		return viewRows(t, db, fmt.Sprintf("select name n from t where ID = %d", id))
+	}
+	expect := func(id int, want ...string) {
+		t.Helper()
+		if rows := lookup(id); strings.Join(rows, ",") != strings.Join(want, ",") {
+			t.Fatalf("lookup of %d expects %v, got %v", id, want, rows)
+		}
+	}
+
+	for _, id := range []int{0, 7, 150, 199} {
+		expect(id, fmt.Sprintf("r%d %d", id, id*10))
+	}
+	expect(200)
+	expect(-1)
+	if hits := metric("point_select_hits"); hits < 5 {
+		t.Fatalf("point lookups don't use the statement template, %d hits", hits)
+	}
+	// 非主键条件以及范围条件不走快速路径
+	if rows := viewRows(t, db, "select ID from t where ID >= 198"); len(rows) != 2 {
+		t.Fatalf("range query returns %v", rows)
+	}
+
+	// 迁移到其他位置的行, 删除的行
+	long := strings.Repeat("z", 300)
+	execAll(t, db, true, "update t set name = "+long+" where ID = 10", "delete t where ID = 20")
+	expect(10, long+" 100")
+	expect(20)
+
+	// 未提交的插入以及修改对其他事物不可见, 快照读旧版本
+	reader, _, _ := db.Execute(-1, []string{"begin"})
+	read := func(id int) string {
+		_, res, err := db.Execute(reader, strings.Fields(fmt.Sprintf("select name from t where ID = %d", id)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(joinRows(res), ",")
+	}
+	if got := read(30); got != "r30" {
+		t.Fatalf("snapshot read returns %q", got)
+	}
+	writer, _, _ := db.Execute(-1, []string{"begin"})
+	for _, stmt := range []string{"insert t values fresh 1", "update t set name = " + long + " where ID = 30"} {
+		if _, _, err := db.Execute(writer, strings.Fields(stmt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, res, _ := db.Execute(writer, strings.Fields("select name from t where ID = 200")); strings.Join(joinRows(res), ",") != "fresh" {
+		t.Fatalf("transaction doesn't read its own insert, %v", joinRows(res))
+	}
+	if got := read(200); got != "" {
+		t.Fatalf("uncommitted insert is visible, %q", got)
+	}
+	db.Execute(writer, []string{"commit"})
+	if got := read(30); got != "r30" {
+		t.Fatalf("snapshot read returns the new version %q", got)
+	}
+	db.Execute(reader, []string{"commit"})
+	expect(30, long+" 300")
+	expect(200, "fresh 1")
+
+	// 重启之后目录为空, 由点查重建
+	db = executor.NewExecutor(path, 1<<20, 0, versionManager.ReadRepeatable)
+	expect(10, long+" 100")
+	expect(20)
+	expect(199, "r199 1990")
+	execAll(t, db, true, "insert t values after 2")
+	expect(201, "after 2")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"myDB/executor"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParallelPurge(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/purge", 1<<20, 0, 1)
+	// 不保留时间旅行查询的历史版本, 提交之后即可清理
+	db.SetRetention(0)
+	execAll(t, db, true, "create a { v string }", "create b { v string }")
+	stmts := make([]string, 0)
+	for i := 0; i < 200; i++ {
+		stmts = append(stmts, "insert a values x", "insert b values x")
+	}
+	execAll(t, db, true, stmts...)
+	status := func() string {
+		_, res, err := db.Execute(-1, strings.Fields("show engine status"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(joinRows(res), "\n")
+	}
+	backlog := func() int64 {
+		m := regexp.MustCompile(`Purge backlog (\d+) data items`).FindStringSubmatch(status())
+		n, _ := strconv.ParseInt(m[1], 10, 64)
+		return n
+	}
+	pages := func() string {
+		return strings.Join(regexp.MustCompile(`Space [12]: \d+ pages`).FindAllString(status(), -1), ";")
+	}
+	before := pages()
+
+	// 删除提交时仍然活跃的事物结束之前不能清理
+	reader, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(reader, strings.Fields("select v from a"))
+	execAll(t, db, true, "delete a where v = x", "delete b where v = x")
+	if n := backlog(); n != 400 {
+		t.Fatalf("unexpected purge backlog %d", n)
+	}
+	_, res, err := db.Execute(reader, strings.Fields("select v from a"))
+	if err != nil || len(joinRows(res)) != 200 {
+		t.Fatalf("rows deleted after the reader started must be visible, %v", err)
+	}
+	db.Execute(reader, []string{"commit"})
+
+	for deadline := time.Now().Add(5 * time.Second); backlog() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("purge doesn't make progress\n%s", status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(status(), "purged 400") {
+		t.Fatalf("unexpected purge status\n%s", status())
+	}
+	// 清理的空间被之后的插入复用, 表空间不再增长
+	execAll(t, db, true, stmts...)
+	if after := pages(); after != before {
+		t.Fatalf("purged space isn't reused, %s -> %s", before, after)
+	}
+	if rows := viewRows(t, db, "select v from b"); len(rows) != 200 {
+		t.Fatalf("unexpected rows after purge, %d", len(rows))
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"myDB/dataManager"
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseQuota(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/quota", 1<<20, 5*dataManager.DefaultPageSize, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create t { a string }")); err != nil {
+		t.Fatal(err)
+	}
+	insert := strings.Fields("insert t values " + strings.Repeat("v", 1000))
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, _, err = db.Execute(xid, insert)
+	}
+	var full *dataManager.ErrorDatabaseFull
+	if !errors.As(err, &full) {
+		t.Fatalf("expect ErrorDatabaseFull, got %v", err)
+	}
+	// 读取不受影响
+	if _, res, err := db.Execute(xid, strings.Fields("select ID from t")); err != nil || len(res) < 2 {
+		t.Fatalf("select after quota exceeded: %d %v", len(res), err)
+	}
+	db.Execute(xid, []string{"commit"})
+}
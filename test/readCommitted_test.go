@@ -0,0 +1,70 @@
+package main
+
+import (
+	"myDB/executor"
+	"myDB/versionManager"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 读已提交: 每条语句看到语句开始时已经提交的数据, 允许不可重复读, 不允许脏读
+func TestReadCommitted(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/rc", 1<<20, 0, versionManager.ReadCommitted)
+	execAll(t, db, true, "create account { name string , balance int64 }", "insert account values a 100")
+	query := func(xid int64) string {
+		_, res, err := db.Execute(xid, strings.Fields("select balance from account where name = a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(joinRows(res), ",")
+	}
+	x1, _, _ := db.Execute(-1, []string{"begin"})
+	if got := query(x1); got != "100" {
+		t.Fatalf("initial read returns %q", got)
+	}
+	// 未提交的修改不可见
+	x2, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(x2, strings.Fields("update account set balance = 50 where name = a")); err != nil {
+		t.Fatal(err)
+	}
+	if got := query(x1); got != "100" {
+		t.Fatalf("dirty read returns %q", got)
+	}
+	// 提交之后的下一条语句可见
+	db.Execute(x2, []string{"commit"})
+	if got := query(x1); got != "50" {
+		t.Fatalf("read after the other transaction commits returns %q", got)
+	}
+	db.Execute(x1, []string{"commit"})
+}
+
+// 同一条语句中的快照读共享语句开始时的读视图
+func TestReadCommittedStatementView(t *testing.T) {
+	vm := versionManager.NewVersionManager(t.TempDir()+"/rcvm", 1<<20, 0, &sync.RWMutex{}, versionManager.ReadCommitted)
+	reader := vm.Begin()
+	vm.BeginStatement(reader)
+	writer := vm.Begin()
+	uid, err := vm.Insert(writer, []byte("row"), versionManager.MetaDataTbUid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.Commit(writer)
+	if r := vm.Read(reader, uid); r != nil {
+		t.Fatalf("record committed during the statement is visible")
+	}
+	vm.EndStatement(reader)
+	vm.BeginStatement(reader)
+	if r := vm.Read(reader, uid); r == nil || string(r.GetData()) != "row" {
+		t.Fatalf("record committed before the statement is invisible")
+	}
+	vm.EndStatement(reader)
+	// 不在语句中时每次快照读创建读视图
+	writer = vm.Begin()
+	other, _ := vm.Insert(writer, []byte("other"), versionManager.MetaDataTbUid)
+	vm.Commit(writer)
+	if r := vm.Read(reader, other); r == nil {
+		t.Fatalf("record committed before the read is invisible outside statements")
+	}
+	vm.Commit(reader)
+}
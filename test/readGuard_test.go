@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"testing"
+)
+
+func TestReadGuard(t *testing.T) {
+	path := t.TempDir() + "/guard"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	uids := make([]int64, 0)
+	for _, data := range []string{"first", "second", "third"} {
+		uid, err := dm.Insert(transactions.SuperXID, []byte(data))
+		if err != nil {
+			t.Fatalf("insert failed, err = %v", err)
+		}
+		uids = append(uids, uid)
+	}
+	guard := dm.NewReadGuard()
+	for _, uid := range uids {
+		data, valid := guard.Read(uid)
+		di := dm.ReadSnapShot(uid)
+		if !valid || !bytes.Equal(data, di.GetData()) {
+			t.Fatalf("zero-copy read mismatch, got %q, want %q", data, di.GetData())
+		}
+		di.Release()
+	}
+	guard.Done()
+	// Done之后禁止继续读
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect panic when reading after done")
+		}
+	}()
+	guard.Read(uids[0])
+}
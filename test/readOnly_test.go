@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 只读打开不修改数据库目录中的任何文件
+func TestReadOnlyDataManager(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/ro"
+	snapshot := func() map[string][32]byte {
+		files, _ := filepath.Glob(dir + "/*")
+		sums := map[string][32]byte{}
+		for _, f := range files {
+			raw, err := os.ReadFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sums[f] = sha256.Sum256(raw)
+		}
+		return sums
+	}
+	unchanged := func(before map[string][32]byte) {
+		after := snapshot()
+		if len(after) != len(before) {
+			t.Fatalf("read-only open changes files, %d -> %d", len(before), len(after))
+		}
+		for f, sum := range before {
+			if after[f] != sum {
+				t.Fatalf("read-only open modifies %s", f)
+			}
+		}
+	}
+	readOnly := func(uids map[int64]string) {
+		ro := dataManager.OpenDataManagerReadOnly(path, 1<<20)
+		defer ro.Close()
+		for uid, want := range uids {
+			di := ro.Read(uid)
+			if di == nil || string(di.GetData()) != want {
+				t.Fatalf("unexpected data item %d", uid)
+			}
+			di.Release()
+		}
+		var readOnly *dataManager.ErrorReadOnly
+		if _, err := ro.Insert(transactions.SuperXID, []byte("x")); !errors.As(err, &readOnly) {
+			t.Fatalf("expect ErrorReadOnly for insert, got %v", err)
+		}
+		for uid := range uids {
+			if _, err := ro.Update(transactions.SuperXID, uid, []byte("y")); !errors.As(err, &readOnly) {
+				t.Fatalf("expect ErrorReadOnly for update, got %v", err)
+			}
+			if err := ro.Checked().Delete(transactions.SuperXID, uid); err == nil {
+				t.Fatalf("expect error for delete")
+			}
+		}
+		if _, err := ro.CreateSpace(); !errors.As(err, &readOnly) {
+			t.Fatalf("expect ErrorReadOnly for creating a table space, got %v", err)
+		}
+		if err := ro.WriteMeta(dataManager.MetaCounters, []byte{1}); !errors.As(err, &readOnly) {
+			t.Fatalf("expect ErrorReadOnly for writing meta, got %v", err)
+		}
+	}
+
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	space, _ := dm.CreateSpace()
+	uids := map[int64]string{}
+	for i, data := range []string{"a", "bb", "ccc"} {
+		uid, err := dm.InsertIn(transactions.SuperXID, int64(i%2)*space, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids[uid] = data
+	}
+	dm.Close()
+	before := snapshot()
+	readOnly(uids)
+	unchanged(before)
+
+	// 数据库运行时只读打开, 写回数据文件的修改可见
+	dm = dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	uid, err := dm.InsertIn(transactions.SuperXID, space, []byte("live"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uids[uid] = "live"
+	if err := dm.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	before = snapshot()
+	readOnly(uids)
+	unchanged(before)
+	// 只读打开不影响正在运行的数据库
+	if _, err := dm.InsertIn(transactions.SuperXID, space, []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	dm.Close()
+	dm = dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	if di := dm.Read(uid); di == nil || string(di.GetData()) != "live" {
+		t.Fatalf("data item is lost after read-only inspection")
+	} else {
+		di.Release()
+	}
+	dm.Close()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect panic for opening a missing database read-only")
+		}
+	}()
+	dataManager.OpenDataManagerReadOnly(dir+"/missing", 1<<20)
+}
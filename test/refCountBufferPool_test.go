@@ -1,5 +1,79 @@
 package main
 
+import (
+	"myDB/dataManager"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type slowSource struct {
+	reads atomic.Int64
+}
+
+func (s *slowSource) GetFromDataSource(obj dataManager.PoolObj) ([]byte, error) {
+	s.reads.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	return make([]byte, 8), nil
+}
+
+func (s *slowSource) FlushBackToDataSource(obj dataManager.PoolObj) error { return nil }
+func (s *slowSource) Truncate(size int64) error                           { return nil }
+func (s *slowSource) Close() error                                        { return nil }
+func (s *slowSource) Sync() error                                         { return nil }
+func (s *slowSource) GetDataLength() int64                                { return 0 }
+
+type poolObj struct {
+	sync.Mutex
+	id   int64
+	data []byte
+}
+
+func (o *poolObj) IsDirty() bool       { return false }
+func (o *poolObj) SetDirty(dirty bool) {}
+func (o *poolObj) SetData(data []byte) { o.data = data }
+func (o *poolObj) GetId() int64        { return o.id }
+func (o *poolObj) GetDataSize() int64  { return int64(len(o.data)) }
+func (o *poolObj) GetData() []byte     { return o.data }
+
+// 并发读取同一个不在缓存中的页: 只有一次IO, 其他读者等待IO完成, 释放之后页被淘汰
+func TestRefCountConcurrentMiss(t *testing.T) {
+	ds := &slowSource{}
+	pool := dataManager.NewRefCountBufferPool(4, ds, &sync.Mutex{})
+	objs := make([]dataManager.PoolObj, 50)
+	wg := sync.WaitGroup{}
+	for i := range objs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			obj, err := pool.Get(&poolObj{id: 1})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			objs[i] = obj
+		}(i)
+	}
+	wg.Wait()
+	if reads := ds.reads.Load(); reads != 1 {
+		t.Fatalf("expect 1 read, got %d", reads)
+	}
+	for _, obj := range objs {
+		wg.Add(1)
+		go func(obj dataManager.PoolObj) {
+			defer wg.Done()
+			if err := pool.Release(obj); err != nil {
+				t.Error(err)
+			}
+		}(obj)
+	}
+	wg.Wait()
+	if stats := pool.Stats(); stats.Cached != 0 || stats.Evictions != 1 || stats.Hits+stats.Misses != 50 {
+		t.Fatalf("unexpected pool stats %+v", stats)
+	}
+}
+
 //// Accepted
 //func TestRefCountBufferPool1(t *testing.T) {
 //	pool := dataManager.NewRefCountBufferPoolImpl(10)
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 页中的碎片足够时, 变长的Update整理页之后在页内移动, uid不变
+func TestReorganizePage(t *testing.T) {
+	path := t.TempDir() + "/reorganize"
+	tm := transactions.NewTransactionManagerImpl(path)
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, tm)
+	space, _ := dm.CreateSpace()
+	uids := make([]int64, 0)
+	for len(uids) == 0 || dataManager.PageOf(uids[len(uids)-1]) == dataManager.PageOf(uids[0]) {
+		uid, err := dm.InsertIn(transactions.SuperXID, space, bytes.Repeat([]byte{'x'}, 200))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+	// 第一页已满, 缩短之后留下碎片
+	uids = uids[:len(uids)-1]
+	expected := map[int64][]byte{}
+	for _, uid := range uids {
+		expected[uid] = []byte("short")
+		if _, err := dm.Update(transactions.SuperXID, uid, expected[uid]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	grown := bytes.Repeat([]byte{'y'}, 400)
+
+	// 页上有未结束事物的修改时不能整理
+	xid := tm.Begin()
+	expected[uids[1]] = []byte("xid")
+	dm.Update(xid, uids[1], expected[uids[1]])
+	if uid, _ := dm.Update(transactions.SuperXID, uids[2], grown); uid == uids[2] {
+		t.Fatalf("page with changes of an active transaction must not be reorganized")
+	} else {
+		delete(expected, uids[2])
+		expected[uid] = grown
+	}
+	tm.Commit(xid)
+	for _, uid := range uids[3:6] {
+		if newUid, _ := dm.Update(transactions.SuperXID, uid, grown); newUid != uid {
+			t.Fatalf("data item must grow in place after reorganizing, uid %d -> %d", uid, newUid)
+		}
+		expected[uid] = grown
+	}
+
+	check := func(dm dataManager.DataManager) {
+		for uid, data := range expected {
+			di := dm.Read(uid)
+			if di == nil || !bytes.Equal(di.GetData(), data) {
+				t.Fatalf("data item %d is corrupted", uid)
+			}
+			di.Release()
+		}
+	}
+	check(dm)
+	// 崩溃恢复重做整理
+	check(dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path)))
+}
+
+// 整理以及清理替换页的数据时, 零拷贝读的扫描仍然读到正确的数据(go test -race)
+func TestReorganizeDuringScan(t *testing.T) {
+	path := t.TempDir() + "/reorganizeScan"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	space, _ := dm.CreateSpace()
+	uids := make([]int64, 0)
+	for len(uids) == 0 || dataManager.PageOf(uids[len(uids)-1]) == dataManager.PageOf(uids[0]) {
+		uid, err := dm.InsertIn(transactions.SuperXID, space, bytes.Repeat([]byte{'x'}, 200))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+	uids = uids[:len(uids)-1]
+	for _, uid := range uids {
+		if _, err := dm.Update(transactions.SuperXID, uid, []byte("short")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stable := uids[0]
+	var finished atomic.Bool
+	var wg sync.WaitGroup
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !finished.Load() {
+				guard := dm.NewReadGuard()
+				data, valid := guard.Read(stable)
+				if !valid || string(data) != "short" {
+					t.Errorf("scan reads %q during reorganizing", data)
+				}
+				guard.Done()
+				if di := dm.Read(stable); di == nil || string(di.GetData()) != "short" {
+					t.Errorf("read returns a wrong data item during reorganizing")
+				} else {
+					di.Release()
+				}
+			}
+		}()
+	}
+	grown := bytes.Repeat([]byte{'y'}, 400)
+	for _, uid := range uids[1:5] {
+		if newUid, _ := dm.Update(transactions.SuperXID, uid, grown); newUid != uid {
+			t.Errorf("data item must grow in place after reorganizing, uid %d -> %d", uid, newUid)
+		}
+	}
+	for _, uid := range uids[5:] {
+		dm.Delete(transactions.SuperXID, uid)
+	}
+	if n := dm.Purge(transactions.SuperXID, uids[5:]); n != len(uids)-5 {
+		t.Errorf("expect %d purged data items, got %d", len(uids)-5, n)
+	}
+	finished.Store(true)
+	wg.Wait()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"myDB/server/network"
+	"myDB/server/utils"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 会话加入资源组之后受该组的内存上限以及并发份额限制
+func TestResourceGroups(t *testing.T) {
+	withServerConfig(t, func(cfg *utils.GlobalConfig) {
+		cfg.MaxConcurrentQueries, cfg.MaxQueuedQueries, cfg.QueueTimeout = 3, 0, 100
+		cfg.ResourceGroups = []*utils.ResourceGroupConfig{
+			{Name: network.DefaultResourceGroup, Shares: 2},
+			{Name: "olap", Shares: 1, MaxMemory: 50000},
+		}
+	})
+	router := network.NewDbRouter(t.TempDir()+"/group", 1<<20, 0, 0)
+	oltp, olap := newFakeConnection(), newFakeConnection()
+	handle(router, oltp, "create emp { dept string , boss int64 }")
+	handle(router, oltp, "begin")
+	for i := 0; i < 1000; i++ {
+		handle(router, oltp, fmt.Sprintf("insert emp values d%d %d", i%7, (i-1)/2))
+	}
+	if reply := handle(router, oltp, "commit"); strings.HasPrefix(reply, "-") {
+		t.Fatal(reply)
+	}
+
+	// 加入资源组
+	if reply := handle(router, olap, "set resource_group missing"); !strings.Contains(reply, "Resource group doesn't exist") {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+	if reply := handle(router, olap, "set resource_group olap"); strings.HasPrefix(reply, "-") {
+		t.Fatal(reply)
+	}
+
+	// 超过组的内存上限: 窗口函数的排序溢出到磁盘, 结果不变; 不能溢出的CTE被拒绝
+	spilled := func() int64 {
+		parts := strings.Split(handle(router, oltp, "show metrics"), "\r\n")
+		for i := 0; i+2 < len(parts); i++ {
+			if parts[i] == "spill_bytes_total" {
+				n, _ := strconv.ParseInt(parts[i+2], 10, 64)
+				return n
+			}
+		}
+		return -1
+	}
+	window := "select ID row_number() over (partition by dept order by ID) from emp"
+	expect := handle(router, oltp, window)
+	before := spilled()
+	if got := handle(router, olap, window); strings.HasPrefix(got, "-") || got != expect {
+		t.Fatalf("window result changes in the resource group, %.80q", got)
+	}
+	if after := spilled(); after <= before {
+		t.Fatalf("window sort isn't spilled, %d -> %d", before, after)
+	}
+	cte := "with recursive sub as ( select ID dept from emp where ID = 0 union select ID dept from emp where boss = sub.ID ) select ID from sub"
+	if reply := handle(router, oltp, cte); strings.HasPrefix(reply, "-") {
+		t.Fatal(reply)
+	}
+	if reply := handle(router, olap, cte); !strings.Contains(reply, "memory") {
+		t.Fatalf("expect out of query memory, got %.80q", reply)
+	}
+
+	// 并发份额: olap只有一个执行槽位, 被阻塞的查询占用槽位时组内的其他查询被拒绝, 默认组不受影响
+	handle(router, oltp, "begin")
+	handle(router, oltp, "update emp set dept = x where ID = 1")
+	blocked := newFakeConnection()
+	handle(router, blocked, "set resource_group olap")
+	done := make(chan string, 1)
+	go func() { done <- handle(router, blocked, "update emp set dept = y where ID = 1") }()
+	time.Sleep(100 * time.Millisecond)
+	if reply := handle(router, olap, "select dept from emp where ID = 2"); !strings.Contains(reply, "busy") {
+		t.Fatalf("query over the share of the group isn't rejected, %.80q", reply)
+	}
+	if reply := handle(router, newFakeConnection(), "select dept from emp where ID = 2"); strings.HasPrefix(reply, "-") {
+		t.Fatalf("query of the default group is blocked by olap, %.80q", reply)
+	}
+	handle(router, oltp, "commit")
+	if reply := <-done; strings.HasPrefix(reply, "-") {
+		t.Fatal(reply)
+	}
+	if reply := handle(router, olap, "select dept from emp where ID = 2"); strings.HasPrefix(reply, "-") {
+		t.Fatalf("slot of the group isn't released, %.80q", reply)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"myDB/executor"
+	"myDB/versionManager"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestResultCache(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/resultCache", 1<<20, 0, versionManager.ReadCommitted)
+	execAll(t, db, true, "create t { k int32 , v string }", "insert t values 1 a", "insert t values 2 b")
+	session := &executor.Session{Database: executor.DefaultDatabase, Vars: executor.NewSessionVariables()}
+	query := func(xid int64, stmt string) []string {
+		_, res, err := db.ExecuteSession(session, xid, strings.Fields(stmt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return joinRows(res)
+	}
+	metric := func(name string) int64 {
+		_, res, _ := db.Execute(-1, strings.Fields("show metrics"))
+		for _, row := range joinRows(res) {
+			if n, value, _ := strings.Cut(row, " "); n == name {
+				v, _ := strconv.ParseInt(value, 10, 64)
+				return v
+			}
+		}
+		t.Fatalf("metric %s doesn't exist", name)
+		return 0
+	}
+	// 自动提交
+	auto := func(stmt string) []string {
+		xid, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+		defer db.Execute(xid, []string{"commit"})
+		return query(xid, stmt)
+	}
+	stmt := "select k v from t where k > 0"
+
+	// 默认关闭
+	auto(stmt)
+	auto(stmt)
+	if metric("result_cache_hits") != 0 || metric("result_cache_entries") != 0 {
+		t.Fatalf("result cache is used without enabling")
+	}
+	query(-1, "set result_cache = on")
+	if rows := auto(stmt); len(rows) != 2 {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	if rows := auto(stmt); len(rows) != 2 || metric("result_cache_hits") != 1 {
+		t.Fatalf("repeated query isn't served from cache, %v", rows)
+	}
+
+	// 事物中修改过表之后不使用缓存, 提交之后缓存的结果失效
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	query(xid, "insert t values 3 c")
+	if rows := query(xid, stmt); len(rows) != 3 {
+		t.Fatalf("own change isn't visible, %v", rows)
+	}
+	if rows := auto(stmt); len(rows) != 2 {
+		t.Fatalf("uncommitted change is visible, %v", rows)
+	}
+	db.Execute(xid, []string{"commit"})
+	if rows := auto(stmt); len(rows) != 3 || metric("result_cache_invalidations") == 0 {
+		t.Fatalf("cached result isn't invalidated after commit, %v", rows)
+	}
+
+	// 回滚的修改不影响缓存
+	hits := metric("result_cache_hits")
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	query(xid, "delete t where k = 1")
+	db.Execute(xid, []string{"abort"})
+	if rows := auto(stmt); len(rows) != 3 || metric("result_cache_hits") != hits+1 {
+		t.Fatalf("aborted change invalidates the cache, %v", rows)
+	}
+
+	// 可重复读的事物不使用缓存
+	query(-1, "set isolation = repeatable_read")
+	rr, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+	query(rr, stmt)
+	execAll(t, db, true, "update t set v = z where k = 1")
+	query(-1, "set isolation = read_committed")
+	if rows := auto(stmt); !contains(rows, "1 z") {
+		t.Fatalf("cached result is stale after update, %v", rows)
+	}
+	if rows := query(rr, stmt); contains(rows, "1 z") {
+		t.Fatalf("repeatable read transaction reads the latest result, %v", rows)
+	}
+	db.Execute(rr, []string{"commit"})
+
+	// 其他表的修改不影响缓存
+	hits = metric("result_cache_hits")
+	execAll(t, db, true, "create u { k int32 }", "insert u values 1")
+	if auto(stmt); metric("result_cache_hits") != hits+1 {
+		t.Fatalf("change of another table invalidates the cache")
+	}
+}
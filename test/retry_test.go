@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"myDB/executor"
+	"myDB/kv"
+	"myDB/orm"
+	"myDB/tableManager"
+	"myDB/versionManager"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 可以重试的错误回滚之后用新的事物重新执行, 其他错误直接返回
+func TestRunInTransaction(t *testing.T) {
+	db, err := kv.Open(t.TempDir() + "/retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	attempts := 0
+	err = db.RunInTransaction(context.Background(), func(tx *kv.Txn) error {
+		attempts++
+		if err := tx.Put([]byte("k"), []byte("v")); err != nil {
+			return err
+		}
+		switch attempts {
+		case 1:
+			return &versionManager.DeadLockError{}
+		case 2:
+			return &tableManager.ErrorSchemaChanged{}
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("expect success after 3 attempts, got %d attempts, %v", attempts, err)
+	}
+	if v, ok, _ := db.Get([]byte("k")); !ok || string(v) != "v" {
+		t.Fatalf("committed value is lost")
+	}
+
+	// 不可重试的错误只执行一次并回滚
+	attempts = 0
+	failed := errors.New("application error")
+	err = db.RunInTransaction(context.Background(), func(tx *kv.Txn) error {
+		attempts++
+		tx.Put([]byte("k"), []byte("rolled back"))
+		return failed
+	})
+	if err != failed || attempts != 1 {
+		t.Fatalf("unexpected retry of a permanent error, %d attempts, %v", attempts, err)
+	}
+	if v, _, _ := db.Get([]byte("k")); string(v) != "v" {
+		t.Fatalf("failed transaction isn't rolled back")
+	}
+
+	// 重试次数有上限, 取消ctx之后不再重试
+	attempts = 0
+	err = db.RunInTransaction(context.Background(), func(tx *kv.Txn) error {
+		attempts++
+		return &versionManager.ErrorLockTimeout{}
+	})
+	if !errors.As(err, new(*versionManager.ErrorLockTimeout)) || attempts != kv.MaxRetries+1 {
+		t.Fatalf("unexpected retries, %d attempts, %v", attempts, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = db.RunInTransaction(ctx, func(tx *kv.Txn) error {
+		attempts++
+		cancel()
+		return &versionManager.DeadLockError{}
+	})
+	if err != context.Canceled || attempts != 1 {
+		t.Fatalf("expect cancellation after one attempt, %d attempts, %v", attempts, err)
+	}
+}
+
+type retryAccount struct {
+	Id int64  `db:"ID"`
+	A  string `db:"a"`
+	B  string `db:"b"`
+}
+
+// 两个事物以相反的顺序更新两张表(写操作持有表锁), 第一次执行时发生死锁, 被回滚的事物自动重试之后两个事物都提交
+func TestRunInTransactionDeadlock(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/deadlock", 1<<20, 0, versionManager.ReadRepeatable)
+	tables := make([]*orm.Table[retryAccount], 0)
+	for _, name := range []string{"checking", "savings"} {
+		table, err := orm.NewTable[retryAccount](db, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := table.Create(orm.NoTrans); err != nil {
+			t.Fatal(err)
+		}
+		if err := table.Insert(orm.NoTrans, &retryAccount{Id: -1, A: "-", B: "-"}); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+
+	var attempts atomic.Int32
+	var deadlocks atomic.Int32
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	transfer := func(col, value string, order ...string) error {
+		first := true
+		return orm.RunInTransaction(context.Background(), db, func(xid int64) error {
+			attempts.Add(1)
+			for i, table := range order {
+				_, _, err := db.Execute(xid, strings.Fields("update "+table+" set "+col+" = "+value))
+				if errors.As(err, new(*versionManager.DeadLockError)) {
+					deadlocks.Add(1)
+				}
+				if err != nil {
+					return err
+				}
+				// 第一次执行时两个事物都持有第一张表的锁之后再更新第二张表
+				if i == 0 && first {
+					first = false
+					barrier.Done()
+					barrier.Wait()
+				}
+			}
+			return nil
+		})
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- transfer("a", "x", "checking", "savings") }()
+	go func() { errs <- transfer("b", "y", "savings", "checking") }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if deadlocks.Load() == 0 || attempts.Load() < 3 {
+		t.Fatalf("transactions don't deadlock, %d attempts", attempts.Load())
+	}
+	for _, table := range tables {
+		rows, err := table.Select(orm.NoTrans)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0].A != "x" || rows[0].B != "y" {
+			t.Fatalf("update of a retried transaction is lost, %+v", rows)
+		}
+	}
+}
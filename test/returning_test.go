@@ -0,0 +1,35 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestReturning(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/returning", 1<<20, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create user { name string , age int64 }"))
+	db.Execute(xid, strings.Fields("insert user values tom 10"))
+	// 返回生成的主键
+	_, res, err := db.Execute(xid, strings.Fields("insert user values bob 20 returning ID name"))
+	if err != nil || len(res) != 4 || res[2].Payload != "1" || res[3].Payload != "bob" {
+		t.Fatalf("insert returning failed, res = %v, err = %v", res, err)
+	}
+	_, res, err = db.Execute(xid, strings.Fields("update user set age = 30 where name = bob returning age"))
+	if err != nil || len(res) != 2 || res[1].Payload != "30" {
+		t.Fatalf("update returning failed, res = %v, err = %v", res, err)
+	}
+	_, res, err = db.Execute(xid, strings.Fields("delete user returning name"))
+	if err != nil || len(res) != 3 {
+		t.Fatalf("delete returning failed, res = %v, err = %v", res, err)
+	}
+	// 字段不存在时不修改数据
+	if _, _, err = db.Execute(xid, strings.Fields("insert user values ann 5 returning nothing")); err == nil {
+		t.Fatalf("expect error for unknown returning field")
+	}
+	if _, res, _ = db.Execute(xid, strings.Fields("select name from user")); len(res) != 1 {
+		t.Fatalf("expect empty table, got %d objects", len(res))
+	}
+	db.Execute(xid, []string{"commit"})
+}
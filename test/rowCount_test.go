@@ -0,0 +1,66 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+// approximate_count为on时count(*)返回提交时维护的近似行数, 包括本事物未提交的修改, 回滚的修改不计入
+func TestApproximateCount(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/count", 1<<20, 0, 1)
+	execAll(t, db, true, "create t { k int32 , v string }", "insert t values 1 a", "insert t values 2 b", "insert t values 3 c")
+	session := &executor.Session{Database: executor.DefaultDatabase, Vars: executor.NewSessionVariables()}
+	count := func(xid int64, tb string) string {
+		_, res, err := db.ExecuteSession(session, xid, []string{"select", "count(*)", "from", tb})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(joinRows(res), ",")
+	}
+	if rows := viewRows(t, db, "select count(*) from t"); len(rows) != 1 || rows[0] != "3" {
+		t.Fatalf("unexpected exact count %v", rows)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("select count(*) from t")); err == nil {
+		t.Fatalf("expect error for an exact count outside a transaction")
+	}
+	if _, _, err := db.ExecuteSession(session, -1, strings.Fields("set approximate_count = on")); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(-1, "t"); n != "3" {
+		t.Fatalf("unexpected approximate count %s", n)
+	}
+
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	for _, stmt := range []string{"insert t values 4 d", "insert t values 5 e", "delete t where k = 1"} {
+		if _, _, err := db.Execute(xid, strings.Fields(stmt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, other := count(xid, "t"), count(-1, "t"); n != "4" || other != "3" {
+		t.Fatalf("unexpected approximate counts %s %s", n, other)
+	}
+	db.Execute(xid, []string{"abort"})
+	if n := count(-1, "t"); n != "3" {
+		t.Fatalf("aborted changes are counted, %s", n)
+	}
+	execAll(t, db, true, "insert t values 4 d", "delete t where k = 1", "delete t where k = 2")
+	if n := count(-1, "t"); n != "2" {
+		t.Fatalf("committed changes aren't counted, %s", n)
+	}
+
+	// 新建的表在创建事物中计数
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	for _, stmt := range []string{"create u { k int32 }", "insert u values 1"} {
+		if _, _, err := db.Execute(xid, strings.Fields(stmt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := count(xid, "u"); n != "1" {
+		t.Fatalf("unexpected count of a new table %s", n)
+	}
+	db.Execute(xid, []string{"commit"})
+	if n := count(-1, "u"); n != "1" {
+		t.Fatalf("unexpected count of a new table %s", n)
+	}
+}
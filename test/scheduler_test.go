@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventScheduler(t *testing.T) {
+	path := t.TempDir() + "/scheduler"
+	db := executor.NewExecutor(path, 1<<20, 0, 0)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("create logs { msg string , age int64 }")); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, strings.Fields("insert logs values old 1"))
+	db.Execute(xid, strings.Fields("insert logs values new 10"))
+	db.Execute(xid, []string{"commit"})
+	purge := strings.Fields("create event purge every 1m do delete logs where age < 5")
+
+	// 回滚的创建不生效
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, purge); err != nil {
+		t.Fatal(err)
+	}
+	db.Execute(xid, []string{"abort"})
+	if _, res, _ := db.Execute(-1, strings.Fields("show events")); len(res) != 5 {
+		t.Fatalf("event of an aborted transaction is scheduled, %d objects", len(res))
+	}
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	db.Execute(xid, purge)
+	db.Execute(xid, []string{"commit"})
+
+	runs := 0
+	if err := db.Schedule("counter", "* * * * *", func(db executor.Executor, xid int64) error {
+		runs += 1
+		_, _, err := db.Execute(xid, strings.Fields("insert logs values tick 20"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Schedule("broken", "@every 30s", func(db executor.Executor, xid int64) error {
+		db.Execute(xid, strings.Fields("insert logs values broken 2"))
+		return errors.New("broken job")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Schedule("never", "0 0 31 2 *", nil); err == nil {
+		t.Fatalf("expect error for a schedule which never fires")
+	}
+	if n := db.RunEvents(time.Now()); n != 0 {
+		t.Fatalf("%d events run before they are due", n)
+	}
+	if n := db.RunEvents(time.Now().Add(2 * time.Minute)); n != 2 || runs != 1 {
+		t.Fatalf("unexpected runs %d, callback runs %d", n, runs)
+	}
+	// 到期的事件已经运行, 下一次运行在之后
+	if n := db.RunEvents(time.Now().Add(2 * time.Minute)); n != 0 {
+		t.Fatalf("%d events run twice", n)
+	}
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	_, res, _ := db.Execute(xid, strings.Fields("select msg from logs"))
+	db.Execute(xid, []string{"commit"})
+	msgs := make([]string, 0)
+	for _, r := range res[1:] {
+		msgs = append(msgs, r.Payload)
+	}
+	sort.Strings(msgs)
+	if strings.Join(msgs, " ") != "new tick" {
+		t.Fatalf("unexpected rows after running events %v", msgs)
+	}
+
+	// 语句事件持久化, Go回调不持久化
+	reopened := executor.NewExecutor(path, 1<<20, 0, 0)
+	if _, res, _ := reopened.Execute(-1, strings.Fields("show events")); len(res) != 10 || res[5].Payload != "purge" || res[7].Payload != executor.DefaultDatabase {
+		t.Fatalf("unexpected events after reopen, %d objects", len(res))
+	}
+	xid, _, _ = reopened.Execute(-1, []string{"begin"})
+	if _, _, err := reopened.Execute(xid, strings.Fields("drop event purge")); err != nil {
+		t.Fatal(err)
+	}
+	reopened.Execute(xid, []string{"commit"})
+	if _, res, _ := reopened.Execute(-1, strings.Fields("show events")); len(res) != 5 {
+		t.Fatalf("event isn't dropped, %d objects", len(res))
+	}
+	xid, _, _ = reopened.Execute(-1, []string{"begin"})
+	defer reopened.Execute(xid, []string{"commit"})
+	if _, _, err := reopened.Execute(xid, strings.Fields("drop event purge")); err == nil {
+		t.Fatalf("expect error for dropping a nonexistent event")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"myDB/dataManager"
+	"myDB/executor"
+	"myDB/transactions"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 定向校验只读取上一次校验之后写回的页, 损坏的页在之后的校验中(包括重启之后)再次检查
+func TestScrubChangedPages(t *testing.T) {
+	path := t.TempDir() + "/scrub"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	space, err := dm.CreateSpace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.SetChecksum(space, true); err != nil {
+		t.Fatal(err)
+	}
+	var first int64
+	for i := 0; i < 300; i++ {
+		uid, err := dm.InsertIn(transactions.SuperXID, space, []byte(fmt.Sprintf("item-%04d-%s", i, strings.Repeat("x", 80))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = uid
+		}
+	}
+	if err := dm.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if unscrubbed := dm.Status().UnscrubbedPages; unscrubbed < 3 {
+		t.Fatalf("flushed pages aren't tracked, %d", unscrubbed)
+	}
+	stats, err := dm.Scrub(false)
+	if err != nil || stats.Pages < 3 || stats.Items < 300 || len(stats.Corrupt) != 0 {
+		t.Fatalf("unexpected scrub %+v %v", stats, err)
+	}
+	if stats, _ := dm.Scrub(false); stats.Pages != 0 || dm.Status().UnscrubbedPages != 0 {
+		t.Fatalf("scrubbed pages are read again, %+v", stats)
+	}
+
+	// 直接修改数据文件中的DataItem, 不经过写回路径
+	pageId := dataManager.PageOf(first)
+	file := fmt.Sprintf("%s%s%d%s", path, dataManager.SpaceFileInfix, space, dataManager.FileSuffix)
+	f, err := os.OpenFile(file, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := make([]byte, dataManager.DefaultPageSize)
+	if _, err := f.ReadAt(page, (pageId-1)*dataManager.DefaultPageSize); err != nil {
+		t.Fatal(err)
+	}
+	at := bytes.Index(page, []byte("item-0000"))
+	if at < 0 {
+		t.Fatalf("data item isn't found in page %d", pageId)
+	}
+	page[at] = 'X'
+	if _, err := f.WriteAt(page, (pageId-1)*dataManager.DefaultPageSize); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if stats, _ := dm.Scrub(false); stats.Pages != 0 {
+		t.Fatalf("page not written back is scrubbed, %+v", stats)
+	}
+	corruptOnly := func(stats dataManager.ScrubStats) bool {
+		return len(stats.Corrupt) == 1 && stats.Corrupt[0].Space == space && stats.Corrupt[0].PageId == pageId &&
+			strings.Contains(stats.Corrupt[0].Reason, "checksum")
+	}
+	if stats, err := dm.Scrub(true); err != nil || !corruptOnly(stats) {
+		t.Fatalf("corrupt page isn't found, %+v %v", stats, err)
+	}
+	if stats, _ := dm.Scrub(false); stats.Pages != 1 || !corruptOnly(stats) {
+		t.Fatalf("corrupt page isn't checked again, %+v", stats)
+	}
+	dm.Close()
+
+	reopened := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	if stats, _ := reopened.Scrub(false); !corruptOnly(stats) {
+		t.Fatalf("changed pages aren't persisted, %+v", stats)
+	}
+}
+
+func TestScrubCommand(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/scrubCmd", 1<<20, 0, 1)
+	execAll(t, db, true, "create t { k string }", "insert t values a", "insert t values b")
+	_, res, err := db.Execute(-1, strings.Fields("scrub all"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages, items int64
+	var corrupt string
+	if _, err := fmt.Sscan(joinRows(res)[0], &pages, &items, &corrupt); err != nil || pages == 0 || corrupt != "-" {
+		t.Fatalf("unexpected scrub result %v %v", joinRows(res), err)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("scrub everything")); err == nil {
+		t.Fatalf("expect invalid argument error")
+	}
+}
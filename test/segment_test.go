@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"os"
+	"testing"
+)
+
+// 数据文件按段大小切分为多个段文件, 重新打开之后按记录的段大小读取
+func TestSegmentedDataFile(t *testing.T) {
+	segment := dataManager.ExtentPages * dataManager.DefaultPageSize
+	odd := t.TempDir() + "/odd"
+	if _, err := dataManager.Open(odd, 1<<20, 0, transactions.NewTransactionManagerImpl(odd), dataManager.WithSegmentSize(segment+1)); !errors.As(err, new(*dataManager.ErrorInvalidSegmentSize)) {
+		t.Fatalf("segment size that splits an extent is accepted, %v", err)
+	}
+	path := t.TempDir() + "/segment"
+	open := func(opts ...dataManager.Option) dataManager.DataManager {
+		return dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path), opts...)
+	}
+	dm := open(dataManager.WithSegmentSize(segment))
+	space, err := dm.CreateSpace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uids := make([]int64, 0)
+	for i := 0; i < 600; i++ {
+		uid, err := dm.InsertIn(transactions.SuperXID, space, bytes.Repeat([]byte{byte(i)}, 1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+	dm.Close()
+	data := path + "_ts1" + dataManager.FileSuffix
+	if stat, err := os.Stat(data); err != nil || stat.Size() != segment {
+		t.Fatalf("first segment isn't full, err = %v", err)
+	}
+	if _, err := os.Stat(data + dataManager.SegmentSuffix + "1"); err != nil {
+		t.Fatalf("second segment isn't created, err = %v", err)
+	}
+
+	// 段大小在创建时决定, 之后使用其他段大小打开不影响已有的数据文件
+	dm = open()
+	for i, uid := range uids {
+		di := dm.Read(uid)
+		if di == nil || !bytes.Equal(di.GetData(), bytes.Repeat([]byte{byte(i)}, 1000)) {
+			t.Fatalf("data item %d is lost after reopening", i)
+		}
+		di.Release()
+	}
+	if stats, err := dm.Scrub(true); err != nil || len(stats.Corrupt) != 0 {
+		t.Fatalf("scrub segmented data file, err = %v", err)
+	}
+	// 导出为一个不分段的文件
+	exported := t.TempDir() + "/exported" + dataManager.FileSuffix
+	if err := dm.ExportSpace(space, exported); err != nil {
+		t.Fatal(err)
+	}
+	attached, err := dm.AttachSpace(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, _ := os.Stat(exported)
+	if stat.Size() <= segment {
+		t.Fatalf("exported file has %d bytes", stat.Size())
+	}
+	if _, err := os.Stat(path + "_ts2" + dataManager.FileSuffix + dataManager.SegmentSuffix + "1"); !os.IsNotExist(err) {
+		t.Fatalf("attached table space is segmented")
+	}
+	uid, err := dm.InsertIn(transactions.SuperXID, attached, []byte("attached"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm.Close()
+	dm = open()
+	if di := dm.Read(uid); di == nil || string(di.GetData()) != "attached" {
+		t.Fatalf("data item in the attached table space is lost")
+	} else {
+		di.Release()
+	}
+	dm.Close()
+}
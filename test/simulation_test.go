@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"myDB/simulation"
+	"myDB/tableManager"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// runSimulation 两个任务并发向同一张表插入数据, 返回调度顺序以及表中的数据
+func runSimulation(t *testing.T, seed int64, crashAt int) ([]string, []*tableManager.ResponseObject, error) {
+	db := executor.NewExecutor(t.TempDir()+"/simulation", 1<<22, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create item { name string , price int64 }"))
+	db.Execute(xid, []string{"commit"})
+
+	sim := simulation.NewSimulation(seed)
+	defer sim.Close()
+	sim.Faults.CrashAt(crashAt)
+	for w := 0; w < 2; w++ {
+		name := "worker" + strconv.Itoa(w)
+		sim.Scheduler.Go(name, func() {
+			xid, _, _ := db.Execute(-1, []string{"begin"})
+			for i := 0; i < 3; i++ {
+				db.Execute(xid, strings.Fields("insert item values "+name+" "+strconv.Itoa(i)))
+			}
+			db.Execute(xid, []string{"commit"})
+		})
+	}
+	err := sim.Scheduler.Run()
+	if err != nil {
+		return sim.Scheduler.Trace(), nil, err
+	}
+	sim.Close()
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	_, rows, _ := db.Execute(xid, strings.Fields("select name price from item"))
+	db.Execute(xid, []string{"commit"})
+	return sim.Scheduler.Trace(), rows, nil
+}
+
+func TestSimulationDeterministic(t *testing.T) {
+	trace, rows, err := runSimulation(t, 42, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 表头 + 6行, 每行2列
+	if len(rows) != 14 {
+		t.Fatalf("expected 14 cells, got %d", len(rows))
+	}
+	again, rowsAgain, err := runSimulation(t, 42, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(trace, again) || !reflect.DeepEqual(rows, rowsAgain) {
+		t.Fatalf("same seed produces different executions")
+	}
+}
+
+func TestSimulationCrash(t *testing.T) {
+	trace, _, err := runSimulation(t, 7, 3)
+	var crash *simulation.Crash
+	if !errors.As(err, &crash) {
+		t.Fatalf("expected simulated crash, got %v", err)
+	}
+	again, _, _ := runSimulation(t, 7, 3)
+	if !reflect.DeepEqual(trace, again) {
+		t.Fatalf("crash is not reproducible")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	util "myDB/dataStructure"
+	"testing"
+)
+
+func TestSkipList(t *testing.T) {
+	list := util.NewSkipList(func(a, b any) int {
+		if x, y := a.(int), b.(int); x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	})
+	for _, v := range []int{20, 8, 31, 8, 15} {
+		list.Add(v)
+	}
+	if v := list.BinarySearch(9); v != 15 {
+		t.Fatalf("unexpected search result %v", v)
+	}
+	list.Remove(15)
+	list.Remove(8)
+	if v := list.BinarySearch(9); v != 20 {
+		t.Fatalf("unexpected search result after remove %v", v)
+	}
+	if v := list.BinarySearch(8); v != 8 {
+		t.Fatalf("duplicate value is removed twice, got %v", v)
+	}
+	if v := list.BinarySearch(32); v != nil {
+		t.Fatalf("unexpected search result %v", v)
+	}
+}
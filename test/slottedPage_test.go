@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"myDB/dataManager"
+	"myDB/transactions"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 槽式数据页中DataItem变长之后在页内移动, uid不变
+func TestSlottedPageRelocate(t *testing.T) {
+	path := t.TempDir() + "/slotted"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	var uids []int64
+	for _, data := range []string{"first", "second", "third"} {
+		uid, err := dm.Insert(transactions.SuperXID, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+	if dataManager.PageOf(uids[0]) != dataManager.PageOf(uids[2]) {
+		t.Fatalf("small data items should be inserted into the same page")
+	}
+	grown := bytes.Repeat([]byte("g"), 512)
+	newUid, err := dm.Update(transactions.SuperXID, uids[1], grown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newUid != uids[1] {
+		t.Fatalf("uid changes after relocating in page, %d -> %d", uids[1], newUid)
+	}
+	for i, want := range [][]byte{[]byte("first"), grown, []byte("third")} {
+		di := dm.Read(uids[i])
+		if di == nil || !bytes.Equal(di.GetData(), want) {
+			t.Fatalf("unexpected data item %d after relocation", i)
+		}
+		di.Release()
+	}
+	// 重放redo log, 页头以及槽位为REDOONLY日志
+	logBytes, err := os.ReadFile(path + dataManager.LogSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := dataManager.ParseLogBytes(logBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redoOnly := 0
+	for _, rc := range records {
+		if rc.RedoOnly {
+			redoOnly += 1
+		}
+	}
+	if redoOnly == 0 {
+		t.Fatalf("no redo only record in the log")
+	}
+	pages, err := dataManager.ReplayLogBytes(logBytes, dataManager.DefaultPageSize, func(xid int64) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := pages[dataManager.PageOf(uids[1])]
+	if page == nil {
+		t.Fatalf("data page isn't replayed")
+	}
+	pageType := dataManager.PageType(binary.BigEndian.Uint32(page[dataManager.SzPgUsed:dataManager.InitOffset]))
+	if pageType != dataManager.SlottedPage || !bytes.Contains(page, grown) {
+		t.Fatalf("unexpected replayed page")
+	}
+	// 没有正常关闭, 再次打开时崩溃恢复
+	recovered := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	if di := recovered.Read(uids[1]); di == nil || !bytes.Equal(di.GetData(), grown) {
+		t.Fatalf("unexpected data item after crash recovery")
+	} else {
+		di.Release()
+	}
+}
+
+// 插入修改页头以及槽位数组的同时读取同一个页上的DataItem(go test -race)
+func TestSlottedPageConcurrentRead(t *testing.T) {
+	path := t.TempDir() + "/slottedRead"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	uids := make(chan int64, 1024)
+	go func() {
+		defer close(uids)
+		for i := 0; i < 600; i++ {
+			uid, err := dm.Insert(transactions.SuperXID, []byte(strconv.Itoa(i)))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			uids <- uid
+		}
+	}()
+	var wg sync.WaitGroup
+	inserted := make([]int64, 0, 600)
+	var lock sync.Mutex
+	var finished atomic.Bool
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			guard := dm.NewReadGuard()
+			defer guard.Done()
+			for i := 0; !finished.Load(); i++ {
+				lock.Lock()
+				n := len(inserted)
+				lock.Unlock()
+				if n == 0 {
+					continue
+				}
+				lock.Lock()
+				uid := inserted[i%n]
+				lock.Unlock()
+				if data, valid := guard.Read(uid); !valid || len(data) == 0 {
+					t.Errorf("unexpected data item %d", uid)
+					return
+				}
+				if di := dm.Read(uid); di == nil {
+					t.Errorf("data item %d is lost", uid)
+					return
+				} else {
+					di.Release()
+				}
+			}
+		}()
+	}
+	for uid := range uids {
+		lock.Lock()
+		inserted = append(inserted, uid)
+		lock.Unlock()
+	}
+	finished.Store(true)
+	wg.Wait()
+}
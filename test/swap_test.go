@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"myDB/tableManager"
+	"strings"
+	"testing"
+)
+
+// 交换在提交时整体生效, 崩溃之后未提交的交换整体撤销
+func TestAtomicSwap(t *testing.T) {
+	path := t.TempDir() + "/swap"
+	db := executor.NewExecutor(path, 1<<20, 0, 1)
+	execAll(t, db, true, "create orders { name string , qty int64 }", "insert orders values a 1", "insert orders values b 2",
+		"create orders_new { name string , qty int64 , note string }", "insert orders_new values a 1 rebuilt")
+
+	// 未提交之前其他事物看到原来的表, 不提交直接重新打开(崩溃)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("swap table orders with orders_new")); err != nil {
+		t.Fatal(err)
+	}
+	if rows := viewRows(t, db, "select name from orders"); len(rows) != 2 {
+		t.Fatalf("uncommitted swap is visible, %v", rows)
+	}
+	if _, res, err := db.Execute(xid, strings.Fields("select name note from orders")); err != nil || len(joinRows(res)) != 1 {
+		t.Fatalf("swap isn't visible in its transaction, %v", err)
+	}
+	db = executor.NewExecutor(path, 1<<20, 0, 1)
+	if rows := viewRows(t, db, "select name qty from orders"); len(rows) != 2 || !contains(rows, "b 2") {
+		t.Fatalf("uncommitted swap survives a crash, %v", rows)
+	}
+	if rows := viewRows(t, db, "select name note from orders_new"); len(rows) != 1 || rows[0] != "a rebuilt" {
+		t.Fatalf("uncommitted swap survives a crash, %v", rows)
+	}
+
+	// 提交之后两个名字同时指向对方的表, 重新打开之后保持
+	execAll(t, db, true, "swap table orders with orders_new")
+	check := func(db executor.Executor) {
+		if rows := viewRows(t, db, "select name qty note from orders"); len(rows) != 1 || rows[0] != "a 1 rebuilt" {
+			t.Fatalf("unexpected rows after swap %v", rows)
+		}
+		if rows := viewRows(t, db, "select name qty from orders_new"); len(rows) != 2 || !contains(rows, "a 1") {
+			t.Fatalf("unexpected rows after swap %v", rows)
+		}
+	}
+	check(db)
+	execAll(t, db, true, "insert orders values c 3 new")
+	db = executor.NewExecutor(path, 1<<20, 0, 1)
+	if rows := viewRows(t, db, "select name ID from orders where name = c"); len(rows) != 1 || rows[0] != "c 1" {
+		t.Fatalf("primary key counter isn't swapped, %v", rows)
+	}
+	execAll(t, db, true, "delete orders where name = c")
+	check(db)
+
+	if _, _, err := db.Execute(-1, strings.Fields("swap table orders with orders_new")); err == nil {
+		t.Fatalf("expect error outside a transaction")
+	}
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	defer db.Execute(xid, []string{"abort"})
+	var same *tableManager.ErrorSwapSameTable
+	if _, _, err := db.Execute(xid, strings.Fields("swap table orders with orders")); !errors.As(err, &same) {
+		t.Fatalf("expect same table error, got %v", err)
+	}
+	if _, _, err := db.Execute(xid, strings.Fields("swap table orders with missing")); err == nil {
+		t.Fatalf("expect error for a missing table")
+	}
+}
+
+func TestSwapRejectsViews(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/swapView", 1<<20, 0, 1)
+	execAll(t, db, true, "create sales { city string , amount int64 }", "create sales_new { city string , amount int64 }",
+		"create materialized view totals as select city sum(amount) from sales group by city")
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	defer db.Execute(xid, []string{"abort"})
+	var view *executor.ErrorSwapView
+	if _, _, err := db.Execute(xid, strings.Fields("swap table sales_new with sales")); !errors.As(err, &view) {
+		t.Fatalf("expect view error, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"myDB/dataManager"
+	"myDB/executor"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 每个表一行磁盘占用, 按分配的字节数降序, 插入之后已使用的字节数增长
+func TestTableSizes(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/tableSize", 1<<20, 0, 1)
+	execAll(t, db, true, "create big { k int32 , v string }", "create small { v string }", "insert small values x")
+	show := func(args string) [][]int64 {
+		_, res, err := db.Execute(-1, strings.Fields(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := make([][]int64, 0)
+		for _, row := range joinRows(res) {
+			fields := strings.Fields(row)
+			values := []int64{0}
+			if fields[0] == "small" {
+				values[0] = 1
+			}
+			for _, field := range fields[1:] {
+				n, _ := strconv.ParseInt(field, 10, 64)
+				values = append(values, n)
+			}
+			rows = append(rows, values)
+		}
+		return rows
+	}
+	before := show("show sizes big")
+	if len(before) != 1 {
+		t.Fatalf("unexpected size report %v", before)
+	}
+	stmts := make([]string, 0)
+	for i := 0; i < 300; i++ {
+		stmts = append(stmts, "insert big values "+strconv.Itoa(i)+" "+strings.Repeat("a", 150))
+	}
+	execAll(t, db, true, stmts...)
+
+	rows := show("show sizes")
+	if len(rows) != 2 || rows[0][0] != 0 || rows[1][0] != 1 {
+		t.Fatalf("tables aren't sorted by allocated bytes, %v", rows)
+	}
+	// pages, allocated, used, free, cold
+	big := rows[0]
+	if big[2] != big[1]*dataManager.DefaultPageSize || big[3]+big[4] != big[2] || big[5] != 0 {
+		t.Fatalf("inconsistent table size %v", big)
+	}
+	if big[3]-before[0][3] < 300*150 || big[1] <= before[0][1] {
+		t.Fatalf("used bytes don't grow after inserts, before %v, after %v", before[0], big)
+	}
+	if _, _, err := db.Execute(-1, strings.Fields("show sizes missing")); err == nil {
+		t.Fatalf("unknown table must be rejected")
+	}
+}
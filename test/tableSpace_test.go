@@ -0,0 +1,35 @@
+package main
+
+import (
+	"myDB/executor"
+	"strings"
+	"testing"
+)
+
+func TestTransportableTableSpace(t *testing.T) {
+	dir := t.TempDir()
+	exec := func(db executor.Executor, xid int64, q string) (int64, int) {
+		x, res, err := db.Execute(xid, strings.Fields(q))
+		if err != nil {
+			t.Fatalf("%s: %s", q, err)
+		}
+		return x, len(res)
+	}
+	src := executor.NewExecutor(dir+"/src", 1<<20, 0, 1)
+	xid, _ := exec(src, -1, "begin")
+	exec(src, xid, "create t { a int32 , b string }")
+	exec(src, xid, "insert t values 1 x")
+	exec(src, xid, "insert t values 2 y")
+	exec(src, xid, "export t to "+dir+"/exp")
+	exec(src, xid, "commit")
+
+	dst := executor.NewExecutor(dir+"/dst", 1<<20, 0, 1)
+	xid, _ = exec(dst, -1, "begin")
+	exec(dst, xid, "create other { c int64 }")
+	exec(dst, xid, "attach t from "+dir+"/exp")
+	exec(dst, xid, "insert t values 3 z")
+	if _, n := exec(dst, xid, "select ID a b from t"); n != 12 {
+		t.Fatalf("expect 3 rows after attach, got %d objects", n)
+	}
+	exec(dst, xid, "commit")
+}
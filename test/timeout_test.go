@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"myDB/versionManager"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statement_timeout回滚执行(等待表锁)过久的语句所在的事物, idle_in_transaction_timeout回滚语句之间空闲过久的事物并释放表锁
+func TestSessionTimeouts(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/timeout", 1<<20, 0, versionManager.ReadCommitted)
+	execAll(t, db, true, "create t { k int32 , v string }", "insert t values 1 a")
+	session := &executor.Session{Database: executor.DefaultDatabase, Vars: executor.NewSessionVariables()}
+	for _, stmt := range []string{"set statement_timeout = -1", "set idle_in_transaction_timeout = x"} {
+		if _, _, err := db.ExecuteSession(session, -1, strings.Fields(stmt)); err == nil {
+			t.Fatalf("expect error for %q", stmt)
+		}
+	}
+
+	// 没有设置锁等待超时, 语句超时结束等待
+	if _, _, err := db.ExecuteSession(session, -1, strings.Fields("set statement_timeout = 50")); err != nil {
+		t.Fatal(err)
+	}
+	owner, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(owner, strings.Fields("update t set v = x where k = 1")); err != nil {
+		t.Fatal(err)
+	}
+	waiter, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+	start := time.Now()
+	_, _, err := db.ExecuteSession(session, waiter, strings.Fields("update t set v = y where k = 1"))
+	if !errors.As(err, new(*versionManager.ErrorStatementTimeout)) || time.Since(start) > 5*time.Second {
+		t.Fatalf("expect statement timeout, got %v after %s", err, time.Since(start))
+	}
+	db.Execute(waiter, []string{"abort"})
+	if _, _, err := db.Execute(owner, []string{"commit"}); err != nil {
+		t.Fatal(err)
+	}
+	xid, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+	if _, _, err := db.ExecuteSession(session, xid, strings.Fields("update t set v = y where k = 1")); err != nil {
+		t.Fatalf("statement within timeout fails, %v", err)
+	}
+	db.Execute(xid, []string{"commit"})
+
+	// 空闲超时的事物被回滚, 修改撤销, 表锁释放
+	if _, _, err := db.ExecuteSession(session, -1, strings.Fields("set idle_in_transaction_timeout = 50")); err != nil {
+		t.Fatal(err)
+	}
+	idle, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+	if _, _, err := db.ExecuteSession(session, idle, strings.Fields("update t set v = z where k = 1")); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.ReapIdleTransactions(time.Now()); n != 0 {
+		t.Fatalf("%d transactions are reaped before timeout", n)
+	}
+	if n := db.ReapIdleTransactions(time.Now().Add(time.Second)); n != 1 {
+		t.Fatalf("expect 1 idle transaction to be reaped, got %d", n)
+	}
+	execAll(t, db, true, "update t set v = w where k = 1")
+	if _, _, err := db.ExecuteSession(session, idle, strings.Fields("select v from t")); !errors.As(err, new(*executor.ErrorIdleTransactionTimeout)) {
+		t.Fatalf("expect idle in transaction timeout, got %v", err)
+	}
+	db.Execute(idle, []string{"abort"})
+	if rows := viewRows(t, db, "select v from t"); !contains(rows, "w") {
+		t.Fatalf("unexpected rows %q", rows)
+	}
+
+	// 后台协程回滚空闲的事物, 执行中的事物以及没有设置空闲超时的事物不受影响
+	idle, _, _ = db.ExecuteSession(session, -1, []string{"begin"})
+	other, _, _ := db.Execute(-1, []string{"begin"})
+	time.Sleep(50*time.Millisecond + 4*executor.IdleCheckTick)
+	if _, _, err := db.ExecuteSession(session, idle, strings.Fields("select v from t")); !errors.As(err, new(*executor.ErrorIdleTransactionTimeout)) {
+		t.Fatalf("expect idle in transaction timeout, got %v", err)
+	}
+	if _, _, err := db.Execute(other, []string{"commit"}); err != nil {
+		t.Fatal(err)
+	}
+}
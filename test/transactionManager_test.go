@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"myDB/transactions"
+	"sync"
 	"testing"
 )
 
@@ -20,3 +21,36 @@ func TestTransactionManager(t *testing.T) {
 	//stat := tm.Debug()
 	//fmt.Println(stat.Size())
 }
+
+// 并发读取事物状态
+func TestTransactionStatusConcurrent(t *testing.T) {
+	tm := transactions.NewTransactionManagerImpl(t.TempDir() + "/status")
+	xids := make([]int64, 200)
+	for i := range xids {
+		xids[i] = tm.Begin()
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, xid := range xids {
+				_ = tm.Status(xid)
+			}
+		}()
+	}
+	for i, xid := range xids {
+		if i%2 == 0 {
+			tm.Commit(xid)
+		} else {
+			tm.Abort(xid)
+		}
+	}
+	wg.Wait()
+	for i, xid := range xids {
+		if want := []byte{transactions.COMMITTED, transactions.ABORTED}[i%2]; tm.Status(xid) != want {
+			t.Fatalf("xid %d: expect status %d, got %d", xid, want, tm.Status(xid))
+		}
+	}
+	tm.Close()
+}
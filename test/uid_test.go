@@ -0,0 +1,31 @@
+package main
+
+import (
+	"myDB/dataManager"
+	"testing"
+)
+
+func TestUidLayout(t *testing.T) {
+	cases := [][3]int64{
+		{dataManager.SystemSpace, 1, 8},
+		{dataManager.MaxSpaceId, dataManager.MaxPageId, dataManager.DefaultPageSize - 1},
+		{7, 1 << 20, 0},
+		{1, dataManager.MaxPageId, dataManager.MaxPageSize - 1},
+	}
+	for _, c := range cases {
+		uid := dataManager.MakeUid(c[0], c[1], c[2])
+		if uid <= 0 {
+			t.Fatalf("uid of %v must be positive, got %d", c, uid)
+		}
+		if space, pageId, offset := dataManager.SplitUid(uid); space != c[0] || pageId != c[1] || offset != c[2] {
+			t.Fatalf("uid round trip of %v got %d %d %d", c, space, pageId, offset)
+		}
+		if dataManager.PageKeyOf(uid) != dataManager.MakeUid(c[0], c[1], 0) {
+			t.Fatalf("unexpected page key of %v", c)
+		}
+	}
+	// 系统表空间的uid与旧格式兼容
+	if dataManager.MakeUid(dataManager.SystemSpace, 3, 100) != 3<<32|100 {
+		t.Fatalf("system space uid is not compatible with the old format")
+	}
+}
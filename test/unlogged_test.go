@@ -0,0 +1,87 @@
+package main
+
+import (
+	"myDB/dataManager"
+	"myDB/executor"
+	"myDB/transactions"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 不记录日志的表空间: 正常关闭之后数据完整, 崩溃之后被清空
+func TestUnloggedSpace(t *testing.T) {
+	path := t.TempDir() + "/unlogged"
+	dm := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	if err := dm.SetUnlogged(dataManager.SystemSpace); err == nil {
+		t.Fatalf("expect error for the system space")
+	}
+	space, err := dm.CreateSpace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.SetUnlogged(space); err != nil {
+		t.Fatal(err)
+	}
+	lsn := dm.Status().Redo.Lsn
+	uid, err := dm.InsertIn(transactions.SuperXID, space, []byte("cached"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dm.Update(transactions.SuperXID, uid, []byte("cache")); err != nil {
+		t.Fatal(err)
+	}
+	if after := dm.Status().Redo.Lsn; after != lsn {
+		t.Fatalf("unlogged space writes redo log, %d -> %d", lsn, after)
+	}
+	dm.Close()
+
+	reopened := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	if di := reopened.Read(uid); di == nil || string(di.GetData()) != "cache" {
+		t.Fatalf("unlogged data is lost after a clean shutdown")
+	} else {
+		di.Release()
+	}
+	if truncated := reopened.TakeTruncated(); len(truncated) != 0 {
+		t.Fatalf("unexpected truncated spaces after a clean shutdown %v", truncated)
+	}
+	// 不关闭直接重新打开(崩溃)
+	crashed := dataManager.OpenDataManager(path, 1<<20, 0, transactions.NewTransactionManagerImpl(path))
+	if truncated := crashed.TakeTruncated(); len(truncated) != 1 || truncated[0] != space {
+		t.Fatalf("unlogged space isn't truncated after crash, %v", truncated)
+	}
+	if pages := crashed.Status().Spaces[1].Pages; pages != 1 {
+		t.Fatalf("unexpected pages after truncating, %d", pages)
+	}
+	if uid, err := crashed.InsertIn(transactions.SuperXID, space, []byte("again")); err != nil || dataManager.PageOf(uid) != 2 {
+		t.Fatalf("unexpected insert after truncating, %d %v", uid, err)
+	}
+}
+
+func TestUnloggedTable(t *testing.T) {
+	path := t.TempDir() + "/unloggedTable"
+	db := executor.NewExecutor(path, 1<<20, 0, 1)
+	execAll(t, db, true, "create cache { k string } unlogged", "create kept { k string }")
+	execAll(t, db, true, "insert cache values a", "insert cache values b", "insert kept values c")
+	if rows := viewRows(t, db, "select k from cache"); len(rows) != 2 {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	_, res, err := db.Execute(-1, strings.Fields("show engine status"))
+	if err != nil || !strings.Contains(strings.Join(joinRows(res), "\n"), ", unlogged") {
+		t.Fatalf("unlogged space isn't reported, %v", err)
+	}
+	// 不关闭直接重新打开(崩溃): 不记录日志的表被清空, 其他表不受影响
+	reopened := executor.NewExecutor(path, 1<<20, 0, 1)
+	if rows := viewRows(t, reopened, "select k from cache"); len(rows) != 0 {
+		t.Fatalf("unlogged table isn't truncated after crash, %v", rows)
+	}
+	if rows := viewRows(t, reopened, "select k from kept"); len(rows) != 1 {
+		t.Fatalf("logged table is affected, %v", rows)
+	}
+	execAll(t, reopened, true, "insert cache values d")
+	rows := viewRows(t, reopened, "select k from cache")
+	sort.Strings(rows)
+	if strings.Join(rows, ",") != "d" {
+		t.Fatalf("unexpected rows after truncating, %v", rows)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// vacuum回收回滚的插入以及重启之前没有清理的删除, 仍在清理队列中的DataItem留给purge; 整理之后uid不变, 空间可以重用
+func TestVacuum(t *testing.T) {
+	path := t.TempDir() + "/vacuum"
+	db := executor.NewExecutor(path, 1<<20, 0, 1)
+	vacuum := func() map[string]int64 {
+		_, res, err := db.Execute(-1, []string{"vacuum", "t"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats := map[string]int64{}
+		for _, r := range res {
+			if r.RowId == 1 {
+				stats[res[r.ColId].Payload], _ = strconv.ParseInt(r.Payload, 10, 64)
+			}
+		}
+		return stats
+	}
+	insert := func(commit bool, from, to int) {
+		stmts := make([]string, 0)
+		for i := from; i < to; i++ {
+			stmts = append(stmts, "insert t values "+strconv.Itoa(i)+" "+strings.Repeat("v", 200))
+		}
+		execAll(t, db, commit, stmts...)
+	}
+	count := func() string {
+		return viewRows(t, db, "select count(*) from t")[0]
+	}
+	execAll(t, db, true, "create t { k int64 , v string }")
+	insert(true, 0, 200)
+	insert(false, 200, 400)
+	// 提交的删除在保留时间之内留在清理队列中
+	execAll(t, db, true, "delete t where k < 100")
+
+	stats := vacuum()
+	if stats["items"] < 200 || stats["items"] >= 300 || stats["bytes"] < 200*200 || stats["skipped"] != 0 {
+		t.Fatalf("unexpected vacuum stats %v", stats)
+	}
+	if c := count(); c != "100" {
+		t.Fatalf("unexpected count after vacuum %s", c)
+	}
+	if again := vacuum(); again["items"] != 0 || again["pages"] != stats["pages"] {
+		t.Fatalf("unexpected second vacuum %v", again)
+	}
+	// 回收的空间被之后的插入重用
+	insert(true, 1000, 1200)
+	if grown := vacuum(); grown["pages"] > stats["pages"]+1 {
+		t.Fatalf("reclaimed space isn't reused, %d pages before, %d pages after", stats["pages"], grown["pages"])
+	}
+
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, []string{"vacuum", "t"}); !errors.As(err, new(*executor.ErrorIllegalOperation)) {
+		t.Fatalf("vacuum runs in a transaction, %v", err)
+	}
+	db.Execute(xid, []string{"abort"})
+
+	// 重启之后清理队列为空, 之前的删除由vacuum回收
+	db = executor.NewExecutor(path, 1<<20, 0, 1)
+	if stats = vacuum(); stats["items"] < 100 {
+		t.Fatalf("deleted items before restart aren't reclaimed, %v", stats)
+	}
+	rows := viewRows(t, db, "select k from t where k >= 1100")
+	if c := count(); c != "300" || len(rows) != 100 {
+		t.Fatalf("unexpected rows after vacuum, count %s, %d rows", c, len(rows))
+	}
+
+	// 后台整理
+	insert(false, 2000, 2100)
+	db.SetVacuumInterval(10 * time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+	db.SetVacuumInterval(0)
+	if stats = vacuum(); stats["items"] != 0 {
+		t.Fatalf("background vacuum doesn't run, %v", stats)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"myDB/executor"
+	"myDB/versionManager"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionVariables(t *testing.T) {
+	path := t.TempDir() + "/variables"
+	db := executor.NewExecutor(path, 1<<20, 0, versionManager.ReadCommitted)
+	execAll(t, db, true, "create t { k int32 , v string }", "insert t values 1 a")
+	session := &executor.Session{Database: executor.DefaultDatabase, Vars: executor.NewSessionVariables()}
+	show := func(s *executor.Session) []string {
+		_, res, err := db.ExecuteSession(s, -1, strings.Fields("show variables"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return joinRows(res)
+	}
+	if got := show(session); !contains(got, "isolation read_committed global") || !contains(got, "autocommit on global") {
+		t.Fatalf("unexpected default variables %q", got)
+	}
+
+	// 校验变量名以及取值
+	for _, stmt := range []string{"set unknown = 1", "set lock_timeout = -1", "set isolation = serializable", "set autocommit = maybe", "set local isolation = read_committed"} {
+		if _, _, err := db.ExecuteSession(session, -1, strings.Fields(stmt)); err == nil {
+			t.Fatalf("expect error for %q", stmt)
+		}
+	}
+
+	// 会话变量只影响当前会话: 可重复读的事物看不到之后提交的插入
+	if _, _, err := db.ExecuteSession(session, -1, strings.Fields("set session isolation = REPEATABLE_READ")); err != nil {
+		t.Fatal(err)
+	}
+	if got := show(session); !contains(got, "isolation repeatable_read session") {
+		t.Fatalf("session variable isn't set %q", got)
+	}
+	if got := show(&executor.Session{Database: executor.DefaultDatabase}); !contains(got, "isolation read_committed global") {
+		t.Fatalf("session variable leaks into other sessions %q", got)
+	}
+	rr, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+	rc, _, _ := db.Execute(-1, []string{"begin"})
+	count := func(xid int64) int {
+		_, res, err := db.Execute(xid, strings.Fields("select k from t"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(res) - 1
+	}
+	count(rr)
+	count(rc)
+	execAll(t, db, true, "insert t values 2 b")
+	if n := count(rr); n != 1 {
+		t.Fatalf("repeatable read transaction sees %d rows", n)
+	}
+	if n := count(rc); n != 2 {
+		t.Fatalf("read committed transaction sees %d rows", n)
+	}
+	db.Execute(rr, []string{"commit"})
+	db.Execute(rc, []string{"commit"})
+
+	// 锁等待超时回滚等待的事物
+	if _, _, err := db.ExecuteSession(session, -1, strings.Fields("set lock_timeout = 50")); err != nil {
+		t.Fatal(err)
+	}
+	owner, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(owner, strings.Fields("update t set v = x where k = 1")); err != nil {
+		t.Fatal(err)
+	}
+	waiter, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+	start := time.Now()
+	_, _, err := db.Execute(waiter, strings.Fields("update t set v = y where k = 1"))
+	var timeout *versionManager.ErrorLockTimeout
+	if !errors.As(err, &timeout) || time.Since(start) > 5*time.Second {
+		t.Fatalf("expect lock wait timeout, got %v after %s", err, time.Since(start))
+	}
+	db.Execute(waiter, []string{"abort"})
+	if _, _, err := db.Execute(owner, []string{"commit"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// sort_memory 限制查询内存
+	if _, _, err := db.ExecuteSession(session, -1, strings.Fields("set sort_memory = 1")); err != nil {
+		t.Fatal(err)
+	}
+	xid, _, _ := db.ExecuteSession(session, -1, []string{"begin"})
+	if _, _, err := db.ExecuteSession(session, xid, strings.Fields("select k from t")); err == nil {
+		t.Fatalf("expect error for query exceeding sort_memory")
+	}
+	db.Execute(xid, []string{"abort"})
+
+	// 全局变量在提交之后生效并持久化, 回滚则丢弃
+	if _, _, err := db.Execute(-1, strings.Fields("set global autocommit = off")); err == nil {
+		t.Fatalf("expect error for setting a global variable outside transaction")
+	}
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("set global lock_timeout = 100"))
+	db.Execute(xid, []string{"abort"})
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("set global autocommit = off")); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Autocommit(&executor.Session{}) {
+		t.Fatalf("global variable takes effect before commit")
+	}
+	db.Execute(xid, []string{"commit"})
+	if db.Autocommit(&executor.Session{}) {
+		t.Fatalf("global variable doesn't take effect after commit")
+	}
+	reopened := executor.NewExecutor(path, 1<<20, 0, versionManager.ReadCommitted)
+	got := show(&executor.Session{Database: executor.DefaultDatabase})
+	if _, res, _ := reopened.Execute(-1, strings.Fields("show variables")); strings.Join(joinRows(res), ",") != strings.Join(got, ",") || !contains(got, "autocommit off global") || !contains(got, "lock_timeout 0 global") {
+		t.Fatalf("unexpected global variables after reopen %q", joinRows(res))
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"myDB/executor"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 跨多个批次的Filter/Project
+func TestVectorizedFilter(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/vector", 1<<22, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create v { a int32 , b string , c json }"))
+	n := 2500
+	for i := 0; i < n; i++ {
+		s := strconv.Itoa(i % 100)
+		db.Execute(xid, []string{"insert", "v", "values", s, "s" + s, `{"k":` + s + `}`})
+	}
+	for _, c := range []struct {
+		query string
+		rows  int
+	}{
+		{"select a b from v where a < 10", 250},
+		{"select a from v where a >= 90", 250},
+		{"select a from v where a = 7", 25},
+		{"select b from v where b > s8", 525}, // s80..s89, s9, s90..s99
+		{"select c->$.k from v where c->$.k <= 1", 50},
+		{"select ID from v", n},
+	} {
+		_, res, err := db.Execute(xid, strings.Fields(c.query))
+		if err != nil {
+			t.Fatalf("%s: %s", c.query, err)
+		}
+		columns := len(strings.Fields(strings.Split(c.query, "from")[0])) - 1
+		if got := len(res)/columns - 1; got != c.rows {
+			t.Fatalf("%s: expect %d rows, got %d", c.query, c.rows, got)
+		}
+	}
+	_, res, _ := db.Execute(xid, strings.Fields("select a b c->$.k from v where a = 42"))
+	if res[3].Payload != "42" || res[4].Payload != "s42" || res[5].Payload != "42" {
+		t.Fatalf("unexpected projection %s %s %s", res[3].Payload, res[4].Payload, res[5].Payload)
+	}
+	db.Execute(xid, []string{"commit"})
+}
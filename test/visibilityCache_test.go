@@ -0,0 +1,81 @@
+package main
+
+import (
+	"myDB/transactions"
+	"sync"
+	"testing"
+)
+
+// 水位线以下的事物不读取XID文件, 回滚以及崩溃时未结束的事物记录为例外
+func TestVisibilityWatermark(t *testing.T) {
+	path := t.TempDir() + "/visibility"
+	open := func() *transactions.TransactionManagerImpl {
+		return transactions.NewTransactionManagerImpl(path).(*transactions.TransactionManagerImpl)
+	}
+	expect := func(tm *transactions.TransactionManagerImpl, watermark int64, exceptions int) {
+		t.Helper()
+		if w, e := tm.Watermark(); w != watermark || e != exceptions {
+			t.Fatalf("expect watermark %d with %d exceptions, got %d with %d", watermark, exceptions, w, e)
+		}
+	}
+	tm := open()
+	xids := make([]int64, 10)
+	for i := range xids {
+		xids[i] = tm.Begin()
+	}
+	for i, xid := range xids {
+		switch i {
+		case 2:
+			tm.Abort(xid)
+		case 6:
+		default:
+			tm.Commit(xid)
+		}
+	}
+	// 停在活跃的事物上
+	expect(tm, xids[6], 1)
+	tm.Commit(xids[6])
+	expect(tm, xids[9]+1, 1)
+	for i, xid := range xids {
+		want := transactions.COMMITTED
+		if i == 2 {
+			want = transactions.ABORTED
+		}
+		if tm.Status(xid) != want {
+			t.Fatalf("xid %d: expect status %d, got %d", xid, want, tm.Status(xid))
+		}
+	}
+
+	// 崩溃时未结束的事物: 状态仍为活跃, 恢复回滚之后更新
+	active := tm.Begin()
+	tm.Commit(tm.Begin())
+	tm = open()
+	expect(tm, active+2, 2)
+	if tm.Status(active) != transactions.ACTIVE {
+		t.Fatalf("unfinished xid %d isn't active after restart", active)
+	}
+	tm.Abort(active)
+	if tm.Status(active) != transactions.ABORTED {
+		t.Fatalf("xid %d aborted by recovery isn't aborted", active)
+	}
+
+	// 并发提交时水位线不会停在已经结束的事物上
+	xids = make([]int64, 400)
+	for i := range xids {
+		xids[i] = tm.Begin()
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < len(xids); i += 4 {
+				tm.Commit(xids[i])
+				_ = tm.Status(xids[(i*7)%len(xids)])
+			}
+		}(g)
+	}
+	wg.Wait()
+	expect(tm, xids[len(xids)-1]+1, 2)
+	tm.Close()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"myDB/executor"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWalOnlyTable(t *testing.T) {
+	path := t.TempDir() + "/walonly"
+	db := executor.NewExecutor(path, 1<<20, 0, 1)
+	execAll(t, db, true, "create events { kind string , n int32 } engine walonly")
+	kinds := func(db executor.Executor) string {
+		rows := viewRows(t, db, "select kind from events")
+		sort.Strings(rows)
+		return strings.Join(rows, ",")
+	}
+
+	// 插入不获取表锁, 两个事物可以同时向同一张表插入
+	reader, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(reader, strings.Fields("select kind from events"))
+	a, _, _ := db.Execute(-1, []string{"begin"})
+	b, _, _ := db.Execute(-1, []string{"begin"})
+	for _, stmt := range []struct {
+		xid  int64
+		kind string
+	}{{a, "login"}, {b, "click"}, {a, "logout"}} {
+		if _, _, err := db.Execute(stmt.xid, strings.Fields("insert events values "+stmt.kind+" 1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没有版本链: 之前开始的事物也能读到未提交的插入
+	_, res, err := db.Execute(reader, strings.Fields("select kind from events"))
+	if err != nil || len(joinRows(res)) != 3 {
+		t.Fatalf("appended rows must be visible to every transaction, %v", err)
+	}
+	db.Execute(reader, []string{"commit"})
+	// 回滚不撤销插入
+	db.Execute(a, []string{"abort"})
+	db.Execute(b, []string{"commit"})
+	if got := kinds(db); got != "click,login,logout" {
+		t.Fatalf("unexpected rows, %s", got)
+	}
+	// 主键由引擎分配, 不会重复
+	ids := viewRows(t, db, "select ID from events")
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "0,1,2" {
+		t.Fatalf("unexpected primary keys %v", ids)
+	}
+
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("update events set n = 2 where kind = click")); err == nil {
+		t.Fatalf("expect error for updating a WAL-only table")
+	}
+	db.Execute(xid, []string{"abort"})
+	xid, _, _ = db.Execute(-1, []string{"begin"})
+	if _, _, err := db.Execute(xid, strings.Fields("delete events where kind = click")); err == nil {
+		t.Fatalf("expect error for deleting from a WAL-only table")
+	}
+	db.Execute(xid, []string{"abort"})
+
+	// 重新打开之后从redo log恢复
+	reopened := executor.NewExecutor(path, 1<<20, 0, 1)
+	execAll(t, reopened, true, "insert events values view 1")
+	if got := kinds(reopened); got != "click,login,logout,view" {
+		t.Fatalf("unexpected rows after reopening, %s", got)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	util "myDB/dataStructure"
+	"myDB/executor"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExternalSort(t *testing.T) {
+	less := func(a, b []string) bool {
+		x, _ := strconv.Atoi(a[0])
+		y, _ := strconv.Atoi(b[0])
+		return x < y
+	}
+	// 预算很小，强制写入多个run
+	sorter := util.NewExternalSorter(less, 256, t.TempDir())
+	for i := 0; i < 100; i++ {
+		if err := sorter.Add([]string{strconv.Itoa((i * 37) % 100), "v"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	it, err := sorter.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	for i := 0; i < 100; i++ {
+		row, err := it.Next()
+		if err != nil || row == nil || row[0] != strconv.Itoa(i) {
+			t.Fatalf("expect %d, got %v %v", i, row, err)
+		}
+	}
+	if row, _ := it.Next(); row != nil {
+		t.Fatalf("expect end of rows, got %v", row)
+	}
+}
+
+// 并行排序结果与顺序排序相同(稳定)
+func TestParallelExternalSort(t *testing.T) {
+	less := func(a, b []string) bool {
+		x, _ := strconv.Atoi(a[0])
+		y, _ := strconv.Atoi(b[0])
+		return x < y
+	}
+	sorter := util.NewParallelExternalSorter(less, 0, t.TempDir(), 4)
+	for i := 0; i < 10000; i++ {
+		if err := sorter.Add([]string{strconv.Itoa((i * 37) % 100), strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	it, err := sorter.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var prev []string
+	for i := 0; i < 10000; i++ {
+		row, err := it.Next()
+		if err != nil || row == nil {
+			t.Fatalf("expect row %d, got %v %v", i, row, err)
+		}
+		if prev != nil && (less(row, prev) || (!less(prev, row) && atoi(row[1]) < atoi(prev[1]))) {
+			t.Fatalf("rows out of order: %v after %v", row, prev)
+		}
+		prev = row
+	}
+}
+
+func atoi(s string) int {
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+func TestWindowFunction(t *testing.T) {
+	db := executor.NewExecutor(t.TempDir()+"/window", 1<<20, 0, 1)
+	xid, _, _ := db.Execute(-1, []string{"begin"})
+	db.Execute(xid, strings.Fields("create emp { dept string , salary int64 }"))
+	for _, v := range []string{"a 10", "a 30", "b 5", "a 20"} {
+		db.Execute(xid, strings.Fields("insert emp values "+v))
+	}
+	_, res, err := db.Execute(xid, strings.Fields(
+		"select salary rank() over (partition by dept order by salary desc) sum(salary) over (partition by dept) from emp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{"10": "3 60", "30": "1 60", "5": "1 5", "20": "2 60"}
+	for i := 3; i+2 < len(res); i += 3 {
+		if got := res[i+1].Payload + " " + res[i+2].Payload; expect[res[i].Payload] != got {
+			t.Fatalf("salary %s: expect %s, got %s", res[i].Payload, expect[res[i].Payload], got)
+		}
+	}
+	db.Execute(xid, []string{"commit"})
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"log"
+	"myDB/simulation"
 	"os"
 	"sync"
+	"sync/atomic"
 )
 
 // 事物的状态
@@ -20,6 +22,8 @@ const (
 	XidFileSuffix   string = ".xid" // xid文件后缀
 	XidStatusSize   int64  = 1      // 每个事物用1个字节(byte)记录
 	XidHeaderLength int64  = 8      // 首8个字节用于记录事物的总数
+	StatusStripes   int64  = 64     // 事物状态缓存的分段数
+	StripeCacheSize int    = 1024   // 每个分段最多缓存的事物数
 )
 
 // TransactionManager 事物状态管理器
@@ -35,9 +39,19 @@ type TransactionManager interface {
 }
 
 type TransactionManagerImpl struct {
-	lock       sync.Mutex
+	lock       sync.Mutex // 保护Begin
 	file       *os.File
-	xidCounter int64 // xid计数
+	xidCounter atomic.Int64 // xid计数
+	stripes    [StatusStripes]statusStripe
+	visibility *visibilityCache // 不加锁的状态缓存以及水位线, 见visibilityCache.go
+}
+
+// statusStripe 事物状态缓存的一个分段
+// 可见性判断会频繁读取事物状态, 按xid分段加锁, 避免所有读取竞争同一把锁
+// 只缓存已经结束(提交/回滚)的事物, 结束的状态不会再改变; 缓存满时清空, 之后从XID文件重新读取
+type statusStripe struct {
+	lock     sync.RWMutex
+	finished map[int64]byte
 }
 
 func NewTransactionManagerImpl(path string) TransactionManager {
@@ -52,12 +66,17 @@ func NewTransactionManagerImpl(path string) TransactionManager {
 		panic(err)
 	}
 	t := &TransactionManagerImpl{
-		file: file,
+		file:       file,
+		visibility: newVisibilityCache(),
+	}
+	for i := range t.stripes {
+		t.stripes[i].finished = make(map[int64]byte)
 	}
 	if valid, xid := t.checkXidFile(); !valid {
 		panic("Invalid XID File\n")
 	} else {
-		t.xidCounter = xid
+		t.xidCounter.Store(xid)
+		t.loadVisibility(xid)
 		log.Printf("[Transaction Manager] Start transaction manager\n")
 		return t
 	}
@@ -92,47 +111,103 @@ func (t *TransactionManagerImpl) checkXidFile() (bool, int64) {
 func (t *TransactionManagerImpl) Begin() int64 {
 	t.lock.Lock()
 	defer t.lock.Unlock()
-	t.increaseXidCounter()
-	t.updateXidStatus(t.xidCounter, ACTIVE)
-	return t.xidCounter
+	xid := t.increaseXidCounter()
+	t.updateXidStatus(xid, ACTIVE)
+	return xid
 }
 
 func (t *TransactionManagerImpl) Commit(xid int64) {
 	if xid == SuperXID {
 		return
 	}
-	if xid > t.xidCounter {
+	if xid > t.xidCounter.Load() {
 		panic("Invalid Xid\n")
 	}
 	// update status
-	t.updateXidStatus(xid, COMMITTED)
+	t.finish(xid, COMMITTED)
 }
 
 func (t *TransactionManagerImpl) Abort(xid int64) {
 	if xid == SuperXID {
 		return
 	}
-	if xid > t.xidCounter {
+	if xid > t.xidCounter.Load() {
 		panic("Invalid Xid\n")
 	}
-	t.updateXidStatus(xid, ABORTED)
+	t.finish(xid, ABORTED)
 }
 
 func (t *TransactionManagerImpl) Status(xid int64) byte {
 	if xid == SuperXID {
 		return COMMITTED
 	}
-	if xid > t.xidCounter {
+	if status, ok := t.visibility.lookup(xid); ok {
+		return status
+	}
+	if xid > t.xidCounter.Load() {
 		panic("Invalid Xid\n")
 	}
+	return t.storedStatus(xid)
+}
+
+// storedStatus 从分段缓存或者XID文件读取状态
+func (t *TransactionManagerImpl) storedStatus(xid int64) byte {
+	stripe := t.stripeOf(xid)
+	stripe.lock.RLock()
+	status, ext := stripe.finished[xid]
+	stripe.lock.RUnlock()
+	if ext {
+		return status
+	}
 	offset := t.getXidOffset(xid)
 	buf := make([]byte, XidStatusSize)
 	if _, err := t.file.ReadAt(buf, offset); err != nil {
 		panic(err)
 	}
+	if buf[0] != ACTIVE {
+		stripe.lock.Lock()
+		stripe.cache(xid, buf[0])
+		stripe.lock.Unlock()
+	}
 	return buf[0]
 }
 
+// finish 提交或回滚事物, 先写XID文件再更新缓存
+func (t *TransactionManagerImpl) finish(xid int64, status byte) {
+	stripe := t.stripeOf(xid)
+	stripe.lock.Lock()
+	t.updateXidStatus(xid, status)
+	stripe.cache(xid, status)
+	stripe.lock.Unlock()
+	t.visibility.remember(xid, status, t.xidCounter.Load(), t.storedStatus)
+}
+
+// Watermark 小于返回值的事物都已经结束, 其中没有提交的事物数
+func (t *TransactionManagerImpl) Watermark() (int64, int) {
+	return t.visibility.watermark.Load(), len(*t.visibility.exceptions.Load())
+}
+
+// loadVisibility 启动时读取已有事物的状态, 初始化水位线
+func (t *TransactionManagerImpl) loadVisibility(counter int64) {
+	statuses := make([]byte, counter*XidStatusSize)
+	if _, err := t.file.ReadAt(statuses, XidHeaderLength); err != nil && counter > 0 {
+		panic(err)
+	}
+	t.visibility.load(statuses)
+}
+
+func (t *TransactionManagerImpl) stripeOf(xid int64) *statusStripe {
+	return &t.stripes[xid&(StatusStripes-1)]
+}
+
+// cache 调用方持有分段的写锁
+func (s *statusStripe) cache(xid int64, status byte) {
+	if len(s.finished) >= StripeCacheSize {
+		s.finished = make(map[int64]byte)
+	}
+	s.finished[xid] = status
+}
+
 func (t *TransactionManagerImpl) Close() {
 	if err := t.file.Close(); err != nil {
 		panic(err)
@@ -160,21 +235,26 @@ func (t *TransactionManagerImpl) updateXidStatus(xid int64, status byte) {
 	offset := t.getXidOffset(xid)
 	buf := make([]byte, XidStatusSize)
 	buf[0] = status
+	if err := simulation.Fault("xid.status"); err != nil {
+		panic(err)
+	}
 	if _, err := t.file.WriteAt(buf, offset); err != nil {
 		panic(err)
 	}
 	_ = t.file.Sync()
 }
 
-func (t *TransactionManagerImpl) increaseXidCounter() {
-	t.xidCounter++
+func (t *TransactionManagerImpl) increaseXidCounter() int64 {
+	xid := t.xidCounter.Load() + 1
 	// update length header
 	bytesBuffer := bytes.NewBuffer(make([]byte, 0))
-	if err := binary.Write(bytesBuffer, binary.BigEndian, t.xidCounter); err != nil {
+	if err := binary.Write(bytesBuffer, binary.BigEndian, xid); err != nil {
 		panic(err)
 	}
 	if _, err := t.file.WriteAt(bytesBuffer.Bytes(), 0); err != nil {
 		panic(err)
 	}
 	_ = t.file.Sync()
+	t.xidCounter.Store(xid)
+	return xid
 }
@@ -0,0 +1,128 @@
+package transactions
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// 可见性缓存
+// 可见性判断对每个版本读取写入事物的状态, 常见情况(早已提交的事物)不加锁, 只需要几次原子读
+// 水位线: 小于watermark的事物都已经结束, 其中没有提交的事物(回滚或者崩溃时未结束)记录在例外表中, 其余都已提交
+// 例外表有序, 写时复制并通过原子指针发布, 最多记录MaxWatermarkExceptions个事物, 记满之后水位线不再推进
+// 最近结束的事物: 按xid直接映射的定长槽位, 每个槽位一个原子uint64(xid << 8 | 状态), 冲突时覆盖
+// 两者都没有命中时回退到分段缓存以及XID文件(statusStripe)
+
+const (
+	VisibilitySlots        int64 = 4096 // 最近结束事物的槽位数, 2的幂
+	MaxWatermarkExceptions int   = 1024 // 水位线以下最多记录的没有提交的事物数
+)
+
+type xidException struct {
+	xid    int64
+	status byte
+}
+
+type visibilityCache struct {
+	watermark  atomic.Int64                   // 小于watermark的事物都已经结束
+	exceptions atomic.Pointer[[]xidException] // 水位线以下没有提交的事物, 按xid升序
+	slots      [VisibilitySlots]atomic.Uint64
+	advance    sync.Mutex // 保护水位线的推进以及例外表的修改
+}
+
+func newVisibilityCache() *visibilityCache {
+	c := &visibilityCache{}
+	c.watermark.Store(SuperXID + 1)
+	c.exceptions.Store(&[]xidException{})
+	return c
+}
+
+// lookup 不加锁查找xid的状态, 没有命中时返回false
+func (c *visibilityCache) lookup(xid int64) (byte, bool) {
+	if xid < c.watermark.Load() {
+		// 例外表只增不减, 在水位线之后读取可以看到水位线以下的所有例外
+		exceptions := *c.exceptions.Load()
+		if i := searchException(exceptions, xid); i < len(exceptions) && exceptions[i].xid == xid {
+			return exceptions[i].status, true
+		}
+		return COMMITTED, true
+	}
+	slot := c.slots[xid&(VisibilitySlots-1)].Load()
+	if int64(slot>>8) == xid {
+		return byte(slot), true
+	}
+	return 0, false
+}
+
+// remember 记录结束的事物, 调用方已经写入XID文件
+// xid恰好位于水位线时推进水位线(水位线只会停在没有结束的事物上), 检查与推进持有同一把锁, 不会错过推进
+func (c *visibilityCache) remember(xid int64, status byte, limit int64, stored func(xid int64) byte) {
+	c.slots[xid&(VisibilitySlots-1)].Store(uint64(xid)<<8 | uint64(status))
+	c.advance.Lock()
+	defer c.advance.Unlock()
+	w := c.watermark.Load()
+	if xid == w {
+		c.advanceFrom(w, limit, stored)
+		return
+	}
+	if xid > w {
+		return
+	}
+	// 崩溃时未结束的事物在恢复时回滚, 更新例外表中的状态
+	exceptions := *c.exceptions.Load()
+	if i := searchException(exceptions, xid); i < len(exceptions) && exceptions[i].xid == xid {
+		updated := append([]xidException(nil), exceptions...)
+		updated[i].status = status
+		c.exceptions.Store(&updated)
+	}
+}
+
+// advanceFrom 从水位线w开始依次检查事物的状态, 推进到第一个没有结束的事物, 不超过limit, 必须持有advance锁
+func (c *visibilityCache) advanceFrom(w, limit int64, stored func(xid int64) byte) {
+	exceptions := *c.exceptions.Load()
+	added := exceptions
+	for ; w <= limit; w++ {
+		s, ok := c.lookup(w)
+		if !ok {
+			s = stored(w)
+		}
+		if s == COMMITTED {
+			continue
+		}
+		if s&(1<<FINISH) == 0 || len(added) >= MaxWatermarkExceptions {
+			break
+		}
+		if len(added) == len(exceptions) {
+			added = append([]xidException(nil), exceptions...)
+		}
+		added = append(added, xidException{xid: w, status: s})
+	}
+	// 先发布例外表再推进水位线
+	if len(added) != len(exceptions) {
+		c.exceptions.Store(&added)
+	}
+	c.watermark.Store(w)
+}
+
+// load 启动时读取XID文件中已有事物的状态, 上次运行中没有结束的事物已经不再活跃, 作为例外计入水位线
+func (c *visibilityCache) load(statuses []byte) {
+	c.advance.Lock()
+	defer c.advance.Unlock()
+	exceptions := make([]xidException, 0)
+	w := SuperXID + 1
+	for _, s := range statuses {
+		if s != COMMITTED {
+			if len(exceptions) >= MaxWatermarkExceptions {
+				break
+			}
+			exceptions = append(exceptions, xidException{xid: w, status: s})
+		}
+		w++
+	}
+	c.exceptions.Store(&exceptions)
+	c.watermark.Store(w)
+}
+
+func searchException(exceptions []xidException, xid int64) int {
+	return sort.Search(len(exceptions), func(i int) bool { return exceptions[i].xid >= xid })
+}
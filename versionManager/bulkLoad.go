@@ -0,0 +1,75 @@
+package versionManager
+
+// 批量导入
+// InsertPacked忽略表空间的填充因子, 导入的行尽量填满数据页
+// InsertBatch通过DataManager的批量插入把一批记录写入尽量少的页, 每个页只记录一条日志
+// Rewrite原地改写本事物插入(还没有其他版本)的记录, 不记录undo log也不产生新版本: 回滚时插入本身失效, 改写随之作废
+// 用于导入时补写同一批新插入的行之间的指针
+
+type ErrorNotOwnInsert struct{}
+
+func (err *ErrorNotOwnInsert) Error() string {
+	return "Only records inserted by the transaction itself can be rewritten"
+}
+
+// InsertPacked
+// 同InsertIn, 不在页中保留填充因子的空闲空间
+func (v *VmImpl) InsertPacked(xid int64, data []byte, tbUid, space int64) (int64, error) {
+	return v.insertIn(xid, data, tbUid, space, true)
+}
+
+// InsertBatch
+// 同InsertPacked, 返回每条记录的uid, 顺序与data相同; 不能用于表的元数据
+// 中途失败时已经插入的记录同样记录在事物中, 回滚时失效
+func (v *VmImpl) InsertBatch(xid int64, data [][]byte, tbUid, space int64) ([]int64, error) {
+	tran := v.getTransaction(xid) // check valid
+	if tran == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	if err := v.tryToLockTable(xid, tbUid); err != nil {
+		return nil, err
+	}
+	raws := make([][]byte, len(data))
+	for i, d := range data {
+		raws[i] = WrapRecordRaw(true, d, xid, 0)
+	}
+	uids, err := v.dm.InsertBatchIn(xid, space, raws)
+	for _, uid := range uids {
+		tran.stats.touch(uid)
+		tran.AddInsert(uid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+// Rewrite
+// 原地改写xid插入的记录, 长度必须不变
+func (v *VmImpl) Rewrite(xid, uid, tbUid int64, newData []byte) error {
+	tran := v.getTransaction(xid) // check valid
+	if tran == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	if err := v.tryToLockTable(xid, tbUid); err != nil {
+		return err
+	}
+	di := v.dm.Read(uid)
+	if di == nil {
+		panic("Error occurs when rewriting records, it is an invalid record")
+	}
+	raw := di.GetData()
+	di.Release()
+	record := DefaultRecordFactory.NewSnapShot(raw, v.undo).(*SnapShot)
+	if record.xid != xid || record.rollback != 0 {
+		return &ErrorNotOwnInsert{}
+	}
+	if len(record.data) != len(newData) {
+		return &ErrorRedoOnlyResize{}
+	}
+	if _, err := v.dm.Update(xid, uid, WrapRecordRaw(true, newData, xid, 0)); err != nil {
+		return err
+	}
+	tran.stats.touch(uid)
+	return nil
+}
@@ -0,0 +1,26 @@
+package versionManager
+
+// 游标读
+// 游标在声明时创建读视图, 之后每次FETCH都使用这个读视图快照读, 结果与声明时一次读出相同(不受隔离级别影响)
+// 本事物的修改总是可见(包括声明之后的修改)
+// 声明之后提交的事物使之失效的DataItem, 其horizon大于游标所在的事物, 在事物结束之前不会被清理(见purge.go)
+
+// ReadWithView
+// 使用rv快照读uid, 可能返回nil
+func (v *VmImpl) ReadWithView(xid, uid int64, rv *ReadView) Record {
+	transaction := v.getTransaction(xid)
+	if transaction == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	transaction.stats.touch(uid)
+	di := v.dm.ReadSnapShot(uid)
+	if di == nil {
+		return nil
+	}
+	snapShot := DefaultRecordFactory.NewSnapShot(di.GetData(), v.undo)
+	di.Release()
+	for snapShot != nil && snapShot.GetXid() != xid && !v.visibleIn(snapShot.GetXid(), rv) {
+		snapShot = snapShot.GetPrevious()
+	}
+	return snapShot
+}
@@ -2,7 +2,11 @@ package versionManager
 
 import (
 	"log"
+	"myDB/dbError"
+	"myDB/simulation"
+	"sort"
 	"sync"
+	"time"
 )
 
 // LockTable 记录当前VersionManager的锁状态
@@ -11,23 +15,49 @@ import (
 type LockTable interface {
 	AddLock(xid, tbUid, lastOwner int64) (bool, int64, error) // 事物xid对tb加锁
 	RemoveLock(xid int64)                                     // remove事物xid上的所有锁
+	cancelWait(xid, owner int64)                              // 事物xid放弃等待owner持有的锁
 	checkDeadLock() bool
 	alreadyOwnLock(xid, tbUid int64) bool
+	waits() []*LockWait                   // 正在等待锁的事物, 按xid排序
+	lastDeadLock() (*DeadLockInfo, int64) // 最近一次死锁以及死锁的总次数
 }
 
 type LockTableImpl struct {
 	locks      map[int64][]int64 // xid -> tbUid
 	lockStatus map[int64]int64   // tbUid -> owner(xid)
 	lockEdge   map[int64][]int64 // xid1 -> xid2 (xid2 is waiting for xid1)
+	waiting    map[int64]*LockWait
+	deadLock   *DeadLockInfo
+	deadLocks  int64
 	lock       sync.RWMutex
 }
 
+// LockWait 事物xid等待owner持有的tbUid锁
+type LockWait struct {
+	Xid   int64
+	TbUid int64
+	Owner int64
+	Since time.Time
+}
+
+// DeadLockInfo 事物xid等待owner持有的tbUid锁时检测到死锁, xid被回滚
+type DeadLockInfo struct {
+	Xid   int64
+	TbUid int64
+	Owner int64
+	Time  time.Time
+}
+
 type DeadLockError struct{}
 
 func (err *DeadLockError) Error() string {
 	return "A DeadLock will happen, this transaction must be roll back"
 }
 
+func (err *DeadLockError) Is(target error) bool {
+	return target == dbError.ErrDeadlock
+}
+
 // AddLock
 // 事物xid对tbUid加锁(表锁)
 func (lt *LockTableImpl) AddLock(xid, tbUid, lastOwner int64) (bool, int64, error) {
@@ -52,9 +82,15 @@ func (lt *LockTableImpl) AddLock(xid, tbUid, lastOwner int64) (bool, int64, erro
 		}
 		lt.lockEdge[owner] = append(lt.lockEdge[owner], xid)
 		if lt.checkDeadLock() {
-			lt.lockEdge[owner] = append(lt.lockEdge[owner][:len(lt.lockEdge[owner])-1])
+			lt.lockEdge[owner] = lt.lockEdge[owner][:len(lt.lockEdge[owner])-1]
+			delete(lt.waiting, xid)
+			lt.deadLock = &DeadLockInfo{Xid: xid, TbUid: tbUid, Owner: owner, Time: simulation.Now()}
+			lt.deadLocks += 1
 			return false, owner, &DeadLockError{}
 		} else {
+			if wait, ext := lt.waiting[xid]; !ext || wait.TbUid != tbUid || wait.Owner != owner {
+				lt.waiting[xid] = &LockWait{Xid: xid, TbUid: tbUid, Owner: owner, Since: simulation.Now()}
+			}
 			return false, owner, nil
 		}
 	} else {
@@ -62,6 +98,7 @@ func (lt *LockTableImpl) AddLock(xid, tbUid, lastOwner int64) (bool, int64, erro
 		log.Printf("[Version Manager] Transaction %d locks semaphore %d\n", xid, tbUid)
 		lt.lockStatus[tbUid] = xid
 		lt.locks[xid] = append(lt.locks[xid], tbUid)
+		delete(lt.waiting, xid)
 		return true, xid, nil
 	}
 }
@@ -76,6 +113,22 @@ func (lt *LockTableImpl) RemoveLock(xid int64) {
 	}
 	delete(lt.lockEdge, xid)
 	delete(lt.locks, xid)
+	delete(lt.waiting, xid)
+}
+
+// cancelWait
+// 事物xid放弃等待(锁等待超时), 移除owner -> xid的等待边
+func (lt *LockTableImpl) cancelWait(xid, owner int64) {
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+	edges := lt.lockEdge[owner]
+	for i, x := range edges {
+		if x == xid {
+			lt.lockEdge[owner] = append(edges[:i:i], edges[i+1:]...)
+			break
+		}
+	}
+	delete(lt.waiting, xid)
 }
 
 // checkDeadLock
@@ -101,7 +154,7 @@ func (lt *LockTableImpl) checkDeadLock() bool {
 	cnt := 0
 	for len(q) > 0 {
 		curr := q[0]
-		q = append(q[1:])
+		q = q[1:]
 		cnt += 1
 		for _, to := range lt.lockEdge[curr] {
 			in[to] -= 1
@@ -123,11 +176,29 @@ func (lt *LockTableImpl) alreadyOwnLock(xid, tbUid int64) bool {
 	}
 }
 
+func (lt *LockTableImpl) waits() []*LockWait {
+	lt.lock.RLock()
+	defer lt.lock.RUnlock()
+	ret := make([]*LockWait, 0, len(lt.waiting))
+	for _, wait := range lt.waiting {
+		ret = append(ret, wait)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Xid < ret[j].Xid })
+	return ret
+}
+
+func (lt *LockTableImpl) lastDeadLock() (*DeadLockInfo, int64) {
+	lt.lock.RLock()
+	defer lt.lock.RUnlock()
+	return lt.deadLock, lt.deadLocks
+}
+
 func NewLockTable() LockTable {
 	log.Printf("[Version Manager] Initialzing lock table\n")
 	return &LockTableImpl{
 		locks:      map[int64][]int64{},
 		lockStatus: map[int64]int64{},
 		lockEdge:   map[int64][]int64{},
+		waiting:    map[int64]*LockWait{},
 	}
 }
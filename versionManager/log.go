@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"myDB/simulation"
 	"os"
 	"sync"
 )
@@ -21,7 +22,11 @@ const (
 
 type Log interface {
 	Read(offset int64) []byte
-	Log(data []byte) int64
+	Log(data []byte, sync bool) int64 // sync为false时只写入OS缓存
+	Sync()
+	Size() int64 // undo log的长度(字节)
+	File() string
+	Close()
 }
 
 type UndoLog struct {
@@ -30,6 +35,16 @@ type UndoLog struct {
 	lock   *sync.Mutex
 }
 
+func (undo *UndoLog) Size() int64 {
+	undo.lock.Lock()
+	defer undo.lock.Unlock()
+	return undo.offset
+}
+
+func (undo *UndoLog) File() string {
+	return undo.file.Name()
+}
+
 func (undo *UndoLog) Read(offset int64) []byte {
 	buffer := make([]byte, SzUndoData)
 	if _, err := undo.file.ReadAt(buffer, offset); err != nil {
@@ -46,20 +61,39 @@ func (undo *UndoLog) Read(offset int64) []byte {
 // Log
 // append a log in undo log and return the offset of the log
 // data -> log data
-func (undo *UndoLog) Log(data []byte) int64 {
+func (undo *UndoLog) Log(data []byte, sync bool) int64 {
 	undo.lock.Lock()
 	defer undo.lock.Unlock()
 	ret := undo.offset
 	raw := wrapUndoLog(data)
+	if err := simulation.Fault("undo.write"); err != nil {
+		panic(fmt.Sprintf("Error occurs when logging undo log, err = %s", err))
+	}
 	if n, err := undo.file.WriteAt(raw, undo.offset); err != nil {
 		panic(fmt.Sprintf("Error occurs when logging undo log, err = %s", err))
 	} else {
 		undo.offset += int64(n)
 	}
-	_ = undo.file.Sync()
+	if sync {
+		_ = undo.file.Sync()
+	}
 	return ret
 }
 
+func (undo *UndoLog) Sync() {
+	undo.lock.Lock()
+	defer undo.lock.Unlock()
+	_ = undo.file.Sync()
+}
+
+func (undo *UndoLog) Close() {
+	undo.lock.Lock()
+	defer undo.lock.Unlock()
+	if err := undo.file.Close(); err != nil {
+		panic(fmt.Sprintf("Error occurs when closing undo log, err = %s", err))
+	}
+}
+
 func OpenUndoLog(path string, lock *sync.Mutex) Log {
 	f, err := os.OpenFile(path+UndoSuffix, os.O_RDWR, 0666)
 	if err != nil && errors.Is(err, os.ErrNotExist) {
@@ -0,0 +1,207 @@
+package versionManager
+
+import (
+	"log"
+	"myDB/dataManager"
+	"myDB/simulation"
+	"sync"
+	"time"
+)
+
+// 清理(purge)
+// 删除的行以及迁移(变长的Update, Relocate)留下的旧DataItem在提交之后失效, 但提交时仍然活跃的事物可能还持有旧的uid(快照读沿行链表读取)
+// 提交时将这些uid按表加入清理队列, 并记录提交时的nextXid为horizon, 所有xid < horizon的事物结束之后才能清理(见DM的Purge)
+// 队列按表分区, 最多workers个worker并行清理不同的表; 同一张表同一时刻只有一个worker, 按提交顺序清理
+// worker在独立的事物中获取表锁之后清理, 期间该表的写入等待
+// 事物提交或者回滚(活跃事物变化)时唤醒worker, 没有可以清理的表时worker退出
+// 时间旅行查询(AS OF)沿版本链读取提交之前的版本, 因此提交时间仍在保留时间之内的DataItem也不清理, 正在进行的AS OF查询按其读视图计算horizon
+// 队列只保存在内存中, 重启之后没有清理的DataItem不再回收; 系统表空间由多个表共享, 其中的DataItem不清理
+
+const DefaultPurgeWorkers = 4
+
+type PurgeStats struct {
+	Workers int   // worker数上限, 0表示不清理
+	Running int   // 正在运行的worker
+	Tables  int   // 有待清理DataItem的表
+	Backlog int64 // 待清理的DataItem
+	Purged  int64 // 累计清理的DataItem
+}
+
+type purgeEntry struct {
+	uids      []int64
+	horizon   int64     // 提交时的nextXid
+	committed time.Time // 提交时间
+}
+
+// purgePartition 一张表的清理队列, 按提交顺序排列
+type purgePartition struct {
+	tbUid   int64
+	entries []*purgeEntry
+	busy    bool // 正在被一个worker清理
+}
+
+type purgeQueue struct {
+	lock       sync.Mutex
+	partitions map[int64]*purgePartition
+	workers    int
+	running    int
+	backlog    int64
+	purged     int64
+	exited     sync.WaitGroup // 所有worker退出, 见Close
+}
+
+func newPurgeQueue() *purgeQueue {
+	return &purgeQueue{partitions: map[int64]*purgePartition{}, workers: DefaultPurgeWorkers}
+}
+
+// addGarbage 记录事物使之失效的DataItem, 提交时加入清理队列
+func (t *Transaction) addGarbage(tbUid, uid int64) {
+	if tbUid == MetaDataTbUid || dataManager.SpaceOf(uid) == dataManager.SystemSpace {
+		return
+	}
+	if t.garbage == nil {
+		t.garbage = make(map[int64][]int64)
+	}
+	t.garbage[tbUid] = append(t.garbage[tbUid], uid)
+}
+
+// enqueue 加入事物提交时失效的DataItem
+func (q *purgeQueue) enqueue(garbage map[int64][]int64, horizon int64, committed time.Time) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for tbUid, uids := range garbage {
+		p := q.partitions[tbUid]
+		if p == nil {
+			p = &purgePartition{tbUid: tbUid}
+			q.partitions[tbUid] = p
+		}
+		p.entries = append(p.entries, &purgeEntry{uids: uids, horizon: horizon, committed: committed})
+		q.backlog += int64(len(uids))
+	}
+}
+
+// wake 有待清理的表并且worker数未达到上限时启动worker
+func (q *purgeQueue) wake(v *VmImpl) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	idle := 0
+	for _, p := range q.partitions {
+		if !p.busy {
+			idle += 1
+		}
+	}
+	for ; idle > 0 && q.running < q.workers; idle-- {
+		q.running += 1
+		q.exited.Add(1)
+		go v.purgeWorker()
+	}
+}
+
+// claim 选择一张可以清理的表, 取出其中horizon <= oldest并且在before之前提交的DataItem; 没有时worker退出
+func (q *purgeQueue) claim(oldest int64, before time.Time) (*purgePartition, []int64) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.running <= q.workers {
+		for _, p := range q.partitions {
+			if p.busy || !p.entries[0].ready(oldest, before) {
+				continue
+			}
+			uids := make([]int64, 0)
+			n := 0
+			for ; n < len(p.entries) && p.entries[n].ready(oldest, before); n++ {
+				uids = append(uids, p.entries[n].uids...)
+			}
+			p.entries = p.entries[n:]
+			p.busy = true
+			return p, uids
+		}
+	}
+	q.running -= 1
+	return nil, nil
+}
+
+func (e *purgeEntry) ready(oldest int64, before time.Time) bool {
+	return e.horizon <= oldest && !e.committed.After(before)
+}
+
+// done 清理结束, purged < 0 时清理失败, uids重新放回队列头部, worker退出(下次唤醒时重试)
+func (q *purgeQueue) done(p *purgePartition, uids []int64, purged int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	p.busy = false
+	if purged < 0 {
+		p.entries = append([]*purgeEntry{{uids: uids}}, p.entries...)
+		q.running -= 1
+		return
+	}
+	q.backlog -= int64(len(uids))
+	q.purged += int64(purged)
+	if len(p.entries) == 0 {
+		delete(q.partitions, p.tbUid)
+	}
+}
+
+func (q *purgeQueue) stats() PurgeStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return PurgeStats{Workers: q.workers, Running: q.running, Tables: len(q.partitions), Backlog: q.backlog, Purged: q.purged}
+}
+
+// SetPurgeWorkers 清理的并行度, 0表示不清理(待清理的DataItem继续累积)
+func (v *VmImpl) SetPurgeWorkers(workers int) {
+	if workers < 0 {
+		workers = 0
+	}
+	v.purge.lock.Lock()
+	v.purge.workers = workers
+	v.purge.lock.Unlock()
+	v.purge.wake(v)
+}
+
+// purgeHorizon 最小的活跃事物xid(AS OF查询为其读视图中最小的不可见xid), 没有活跃事物时为nextXid
+// 以及时间旅行查询可以访问的最早提交时间
+func (v *VmImpl) purgeHorizon() (int64, time.Time) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	oldest := v.nextXid
+	for xid, tran := range v.activeTrans {
+		if xid < oldest {
+			oldest = xid
+		}
+		if tran.asOf != nil && tran.asOf.minXid < oldest {
+			oldest = tran.asOf.minXid
+		}
+	}
+	return oldest, simulation.Now().Add(-v.history.retention)
+}
+
+func (v *VmImpl) purgeWorker() {
+	defer v.purge.exited.Done()
+	for {
+		p, uids := v.purge.claim(v.purgeHorizon())
+		if p == nil {
+			return
+		}
+		purged := v.purgeTable(p.tbUid, uids)
+		v.purge.done(p, uids, purged)
+		if purged < 0 {
+			return
+		}
+	}
+}
+
+// purgeTable 在独立的事物中获取表锁之后清理, 失败时返回-1
+func (v *VmImpl) purgeTable(tbUid int64, uids []int64) int {
+	xid := v.Begin()
+	v.lock.Lock()
+	v.activeTrans[xid].purge = true
+	v.lock.Unlock()
+	if err := v.LockTable(xid, tbUid); err != nil {
+		log.Printf("[Version Manager] Failed to purge table %d: %s\n", tbUid, err)
+		v.Abort(xid)
+		return -1
+	}
+	purged := v.dm.Purge(xid, uids)
+	v.Commit(xid)
+	return purged
+}
@@ -0,0 +1,57 @@
+package versionManager
+
+import (
+	"myDB/transactions"
+)
+
+// 只重做的写入(WAL-only表)
+// 以超级事物的身份写入DataManager: 日志只需要重做, 崩溃恢复以及回滚时都不会撤销
+// 不获取表锁, 不记录在事物中, 写入的版本对所有事物(包括AS OF查询)立即可见, 没有历史版本
+// 上层自己保证同一张表上并发写入的正确性
+
+type ErrorRedoOnlyResize struct{}
+
+func (err *ErrorRedoOnlyResize) Error() string {
+	return "Redo-only update must not change the length of the record"
+}
+
+// InsertRedoOnly
+// 向space表空间插入一条对所有事物可见的记录, 返回uid
+func (v *VmImpl) InsertRedoOnly(xid int64, data []byte, space int64) (int64, error) {
+	tran := v.getTransaction(xid) // check valid
+	if tran == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	raw := WrapRecordRaw(true, data, transactions.SuperXID, 0)
+	uid, err := v.dm.InsertIn(transactions.SuperXID, space, raw)
+	if err != nil {
+		return -1, err
+	}
+	tran.stats.touch(uid)
+	return uid, nil
+}
+
+// UpdateRedoOnly
+// 原地修改uid处记录的最新版本(版本信息不变), 长度必须不变
+func (v *VmImpl) UpdateRedoOnly(xid, uid int64, newData []byte) error {
+	tran := v.getTransaction(xid) // check valid
+	if tran == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	di := v.dm.Read(uid)
+	if di == nil {
+		panic("Error occurs when updating records, it is an invalid record")
+	}
+	raw := di.GetData()
+	di.Release()
+	header := SzValid + SzRcRollBack + SzRcXid
+	if int64(len(raw))-header != int64(len(newData)) {
+		return &ErrorRedoOnlyResize{}
+	}
+	newRaw := append(raw[:header:header], newData...)
+	if _, err := v.dm.Update(transactions.SuperXID, uid, newRaw); err != nil {
+		return err
+	}
+	tran.stats.touch(uid)
+	return nil
+}
@@ -0,0 +1,41 @@
+package versionManager
+
+import (
+	"myDB/dataManager"
+)
+
+// 块采样
+// 在DM选中的页(见dataManager/sample.go)上快照读每条记录, 对xid可见的版本交给上层(ANALYZE)统计
+// 旧版本写入的溢出段没有标记, 按记录格式读出的XID不是已经开始的事物时跳过, 不沿其中的回滚指针读取undo log
+
+func (v *VmImpl) SampleRecords(xid, space int64, percent int, seed int64, fn func(uid int64, data []byte)) (dataManager.PageSample, error) {
+	if v.getTransaction(xid) == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	sample, err := v.dm.SamplePages(space, percent, seed)
+	if err != nil {
+		return sample, err
+	}
+	v.lock.RLock()
+	next := v.nextXid
+	v.lock.RUnlock()
+	guard := v.dm.NewReadGuard()
+	defer guard.Done()
+	for _, uid := range sample.Uids {
+		if err := v.CheckStatement(xid); err != nil {
+			return sample, err
+		}
+		data, _ := guard.Read(uid)
+		if int64(len(data)) < SzValid+SzRcRollBack+SzRcXid {
+			continue
+		}
+		snapShot := DefaultRecordFactory.NewSnapShot(data, v.undo)
+		if recordXid := snapShot.GetXid(); recordXid < 0 || recordXid >= next {
+			continue
+		}
+		if record := v.ReadIn(xid, uid, guard); record != nil {
+			fn(uid, record.GetData())
+		}
+	}
+	return sample, nil
+}
@@ -0,0 +1,24 @@
+package versionManager
+
+// 语句级读视图
+// 读已提交的事物在每条语句开始时(BeginStatement)创建读视图, 语句中的所有快照读共享该读视图,
+// 同一条语句(例如全表扫描)看到一致的快照, 后一条语句可以看到这期间其他事物已经提交的修改(不可重复读), 未提交的修改不可见
+// EndStatement之后读视图失效; 没有标记语句边界的调用者(直接使用VersionManager)每次快照读时创建读视图
+// 可重复读的事物只在开始时创建读视图, BeginStatement不做任何事
+
+// BeginStatement 开始xid的一条新语句, 读已提交时创建语句的读视图
+func (v *VmImpl) BeginStatement(xid int64) {
+	tran := v.getTransaction(xid)
+	if tran == nil || tran.level != ReadCommitted {
+		return
+	}
+	tran.rv = v.CreateReadView(xid)
+	tran.statement = true
+}
+
+// refreshReadView 快照读之前调用, 读已提交并且不在语句中时创建新的读视图
+func (v *VmImpl) refreshReadView(tran *Transaction) {
+	if tran.level == ReadCommitted && !tran.statement {
+		tran.rv = v.CreateReadView(tran.xid)
+	}
+}
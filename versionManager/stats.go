@@ -0,0 +1,98 @@
+package versionManager
+
+import (
+	"myDB/dataManager"
+	"sync"
+	"time"
+)
+
+// ExecStats 事物或者语句的执行统计
+type ExecStats struct {
+	RowsRead     int64         // 扫描的行数
+	RowsWritten  int64         // 插入, 修改, 删除的行数
+	PagesTouched int64         // 访问过的页数(同一个页只计一次)
+	LockWait     time.Duration // 等待表锁的时间
+	LogBytes     int64         // 写入的redo log以及undo log字节数
+}
+
+func (s *ExecStats) add(other ExecStats) {
+	s.RowsRead += other.RowsRead
+	s.RowsWritten += other.RowsWritten
+	s.LockWait += other.LockWait
+	s.LogBytes += other.LogBytes
+}
+
+// execStats 事物的统计, 分别累计当前语句以及整个事物
+// 并行扫描时多个goroutine可能同时访问
+type execStats struct {
+	lock      sync.Mutex
+	stmt      ExecStats
+	total     ExecStats
+	stmtPages map[int64]struct{}
+	pages     map[int64]struct{}
+}
+
+func newExecStats() *execStats {
+	return &execStats{stmtPages: map[int64]struct{}{}, pages: map[int64]struct{}{}}
+}
+
+func (s *execStats) touch(uid int64) {
+	key := dataManager.PageKeyOf(uid)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stmtPages[key] = struct{}{}
+	s.pages[key] = struct{}{}
+}
+
+func (s *execStats) addRows(read, written int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stmt.RowsRead += read
+	s.stmt.RowsWritten += written
+}
+
+func (s *execStats) addLockWait(wait time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stmt.LockWait += wait
+}
+
+func (s *execStats) addLogBytes(n int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stmt.LogBytes += n
+}
+
+// endStatement 结束当前语句, 返回语句以及事物(包括当前语句)的统计
+func (s *execStats) endStatement() (ExecStats, ExecStats) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stmt := s.stmt
+	stmt.PagesTouched = int64(len(s.stmtPages))
+	s.total.add(stmt)
+	s.total.PagesTouched = int64(len(s.pages))
+	s.stmt = ExecStats{}
+	s.stmtPages = map[int64]struct{}{}
+	return stmt, s.total
+}
+
+// AddRows 由上层(TM)统计读写的行数
+func (v *VmImpl) AddRows(xid, read, written int64) {
+	if tran := v.getTransaction(xid); tran != nil {
+		tran.stats.addRows(read, written)
+	}
+}
+
+// EndStatement
+// 结束xid的当前语句, 返回语句以及事物的统计
+// xid不是活跃事物时返回false
+func (v *VmImpl) EndStatement(xid int64) (ExecStats, ExecStats, bool) {
+	tran := v.getTransaction(xid)
+	if tran == nil {
+		return ExecStats{}, ExecStats{}, false
+	}
+	tran.statement = false
+	tran.stats.addLogBytes(v.dm.TakeLogBytes(xid))
+	stmt, total := tran.stats.endStatement()
+	return stmt, total, true
+}
@@ -0,0 +1,62 @@
+package versionManager
+
+import (
+	"myDB/dataManager"
+	"sort"
+	"time"
+)
+
+// VmStatus VersionManager的运行状态, 用于诊断
+
+type TransactionStatus struct {
+	Xid     int64
+	Level   IsolationLevel
+	Begin   time.Time
+	Waiting *LockWait // 正在等待的锁, 没有等待时为nil
+	Purge   bool      // 清理DataItem的后台事物(只获取表锁, 不读取数据)
+}
+
+type VmStatus struct {
+	NextXid      int64
+	MinActiveXid int64
+	Active       []*TransactionStatus // 活跃事物, 按xid排序
+	LockWaits    []*LockWait
+	LastDeadLock *DeadLockInfo // 没有发生过死锁时为nil
+	DeadLocks    int64
+	UndoSize     int64 // undo log不会被清理(purge), 全部为历史版本
+	Purge        PurgeStats
+	Dm           dataManager.DmStatus
+}
+
+func (v *VmImpl) ReportReplica(name string, lsn int64) {
+	v.dm.ReportReplica(name, lsn)
+}
+
+func (v *VmImpl) CheckHealth(timeout time.Duration) error {
+	return v.dm.CheckHealth(timeout)
+}
+
+// Close 等待正在清理的worker退出之后关闭undo log以及DataManager(同时关闭TransactionManager)
+func (v *VmImpl) Close() {
+	v.SetPurgeWorkers(0)
+	v.purge.exited.Wait()
+	v.undo.Close()
+	v.dm.Close()
+}
+
+func (v *VmImpl) Status() VmStatus {
+	status := VmStatus{LockWaits: v.lt.waits(), UndoSize: v.undo.Size(), Purge: v.purge.stats(), Dm: v.dm.Status()}
+	status.LastDeadLock, status.DeadLocks = v.lt.lastDeadLock()
+	waiting := make(map[int64]*LockWait, len(status.LockWaits))
+	for _, wait := range status.LockWaits {
+		waiting[wait.Xid] = wait
+	}
+	v.lock.RLock()
+	status.NextXid, status.MinActiveXid = v.nextXid, v.minActiveXid
+	for xid, tran := range v.activeTrans {
+		status.Active = append(status.Active, &TransactionStatus{Xid: xid, Level: tran.level, Begin: tran.begin, Waiting: waiting[xid], Purge: tran.purge})
+	}
+	v.lock.RUnlock()
+	sort.Slice(status.Active, func(i, j int) bool { return status.Active[i].Xid < status.Active[j].Xid })
+	return status
+}
@@ -0,0 +1,105 @@
+package versionManager
+
+import (
+	"myDB/simulation"
+	"time"
+)
+
+// 时间旅行查询(AS OF)
+// VM在内存中按提交顺序记录最近提交的事物及其提交时间, 超过保留时间的记录在之后的提交时清理
+// AS OF t的读视图: t之前(包括t)提交的事物可见, t之后提交的以及当前仍然活跃的事物(包括查询所在的事物)不可见
+// 历史版本沿undo log中的版本链读取(undo log不会被清理)
+// 提交记录只保存在内存中, 无法查询VM启动之前或者超过保留时间的时间点
+
+const DefaultTimeTravelRetention = 10 * time.Minute
+
+type ErrorTimeTravelOutOfRange struct{}
+
+func (err *ErrorTimeTravelOutOfRange) Error() string {
+	return "Time travel query out of the retention window"
+}
+
+type commitPoint struct {
+	xid int64
+	at  time.Time
+}
+
+type commitHistory struct {
+	points    []commitPoint // 按提交时间排序
+	horizon   time.Time     // 可以查询的最早时间点, 之前提交的事物对所有AS OF查询可见
+	retention time.Duration
+}
+
+func newCommitHistory(retention time.Duration) commitHistory {
+	return commitHistory{horizon: simulation.Now(), retention: retention}
+}
+
+// commit 记录xid的提交并清理超过保留时间的记录, 必须持有v的锁
+func (h *commitHistory) commit(xid int64, at time.Time) {
+	h.points = append(h.points, commitPoint{xid: xid, at: at})
+	n := 0
+	for n < len(h.points) && at.Sub(h.points[n].at) > h.retention {
+		h.horizon = h.points[n].at
+		n += 1
+	}
+	if n > 0 {
+		h.points = append([]commitPoint(nil), h.points[n:]...)
+	}
+}
+
+// SetRetention 设置时间旅行查询的保留时间
+func (v *VmImpl) SetRetention(retention time.Duration) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.history.retention = retention
+}
+
+// BeginAsOf xid之后的快照读使用at时刻的读视图, 直到EndAsOf
+func (v *VmImpl) BeginAsOf(xid int64, at time.Time) error {
+	tran := v.getTransaction(xid)
+	if tran == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	rv, err := v.readViewAsOf(xid, at)
+	if err != nil {
+		return err
+	}
+	v.lock.Lock()
+	tran.asOf = rv
+	v.lock.Unlock()
+	return nil
+}
+
+func (v *VmImpl) EndAsOf(xid int64) {
+	if tran := v.getTransaction(xid); tran != nil {
+		v.lock.Lock()
+		tran.asOf = nil
+		v.lock.Unlock()
+	}
+}
+
+// readViewAsOf at之后提交的事物以及当前活跃的事物记录在active中
+func (v *VmImpl) readViewAsOf(xid int64, at time.Time) (*ReadView, error) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	now := simulation.Now()
+	if at.After(now) || at.Before(v.history.horizon) || now.Sub(at) > v.history.retention {
+		return nil, &ErrorTimeTravelOutOfRange{}
+	}
+	rv := &ReadView{creatorId: xid, maxXid: v.nextXid}
+	for activeXid := range v.activeTrans {
+		rv.active = append(rv.active, activeXid)
+	}
+	for _, point := range v.history.points {
+		if point.at.After(at) {
+			rv.active = append(rv.active, point.xid)
+		}
+	}
+	rv.minXid = rv.maxXid
+	for _, invisible := range rv.active {
+		if invisible < rv.minXid {
+			rv.minXid = invisible
+		}
+	}
+	return rv, nil
+}
@@ -0,0 +1,61 @@
+package versionManager
+
+import (
+	"myDB/simulation"
+	"time"
+)
+
+// 语句超时
+// 上层在每条语句开始时调用SetStatementTimeout重新设置截止时间(内部执行的查询沿用外层语句的截止时间)
+// 扫描在读取每一行之前调用CheckStatement, 等待表锁时同样检查截止时间; 超时则回滚事物并返回ErrorStatementTimeout
+
+type ErrorStatementTimeout struct{}
+
+func (err *ErrorStatementTimeout) Error() string {
+	return "Statement timeout exceeded, this transaction has been rolled back"
+}
+
+// SetStatementTimeout xid当前语句最多执行timeout, 0表示不限制
+func (v *VmImpl) SetStatementTimeout(xid int64, timeout time.Duration) {
+	if tran := v.getTransaction(xid); tran != nil {
+		var deadline int64
+		if timeout > 0 {
+			deadline = simulation.Now().Add(timeout).UnixNano()
+		}
+		tran.deadline.Store(deadline)
+	}
+}
+
+// CheckStatement xid的当前语句超时则回滚事物并返回ErrorStatementTimeout
+func (v *VmImpl) CheckStatement(xid int64) error {
+	if v.statementExpired(xid) {
+		v.Abort(xid)
+		return &ErrorStatementTimeout{}
+	}
+	return nil
+}
+
+// statementLimit 等待表锁时最多阻塞的时间, 不超过timeout以及当前语句的剩余时间
+func (v *VmImpl) statementLimit(xid int64, timeout time.Duration) time.Duration {
+	tran := v.getTransaction(xid)
+	if tran == nil || tran.deadline.Load() == 0 {
+		return timeout
+	}
+	left := time.Duration(tran.deadline.Load() - simulation.Now().UnixNano())
+	if left <= 0 {
+		left = time.Nanosecond
+	}
+	if timeout <= 0 || left < timeout {
+		return left
+	}
+	return timeout
+}
+
+func (v *VmImpl) statementExpired(xid int64) bool {
+	tran := v.getTransaction(xid)
+	if tran == nil {
+		return false
+	}
+	deadline := tran.deadline.Load()
+	return deadline > 0 && simulation.Now().UnixNano() >= deadline
+}
@@ -1,9 +1,16 @@
 package versionManager
 
+import (
+	"myDB/dbError"
+	"myDB/simulation"
+	"sync/atomic"
+	"time"
+)
+
 type IsolationLevel int32
 
 const (
-	ReadCommitted  IsolationLevel = 0 // 读已提交，每次快照读时创建读视图
+	ReadCommitted  IsolationLevel = 0 // 读已提交, 每条语句开始时创建读视图, 见statementView.go
 	ReadRepeatable IsolationLevel = 1 // 可重复读, 仅在事物开始时创建读视图
 )
 
@@ -12,22 +19,44 @@ type Transaction struct {
 	xid     int64
 	level   IsolationLevel
 	rv      *ReadView // 读视图
-	vm      VersionManager
+	asOf    *ReadView // 时间旅行查询的读视图, 非nil时代替rv
 	action  []*Action // 执行的操作, 用于回滚
 	waiting chan struct{}
+	batch   bool // 批量模式, 日志不逐条刷盘
+	begin   time.Time
+	stats   *execStats
+	garbage map[int64][]int64 // 表 -> 提交之后失效的DataItem, 见purge.go
+	purge   bool              // 清理DataItem的后台事物
+
+	lockTimeout time.Duration // 等待表锁的最长时间, 0表示不限制
+	statement   bool          // 读已提交: 当前语句的读视图已经创建, 语句中的快照读共享rv
+	deadline    atomic.Int64  // 当前语句的截止时间(UnixNano), 0表示不限制, 见timeout.go
 }
 
-func NewTransaction(xid int64, level IsolationLevel, vm VersionManager) *Transaction {
+// TransactionOptions 开启事物时的设置(由会话变量决定)
+type TransactionOptions struct {
+	Level       IsolationLevel
+	LockTimeout time.Duration // 等待表锁的最长时间, 超时则回滚事物, 0表示不限制
+}
+
+type ErrorLockTimeout struct{}
+
+func (err *ErrorLockTimeout) Error() string {
+	return "Lock wait timeout exceeded, this transaction has been rolled back"
+}
+
+func (err *ErrorLockTimeout) Is(target error) bool {
+	return target == dbError.ErrLockTimeout
+}
+
+func NewTransaction(xid int64, level IsolationLevel) *Transaction {
 	tx := &Transaction{
 		xid:     xid,
 		level:   level,
-		vm:      vm,
 		action:  make([]*Action, 0),
 		waiting: make(chan struct{}),
-	}
-	if level == ReadRepeatable {
-		// 生成ReadView
-		tx.rv = vm.CreateReadView(xid)
+		begin:   simulation.Now(),
+		stats:   newExecStats(),
 	}
 	return tx
 }
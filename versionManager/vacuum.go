@@ -0,0 +1,57 @@
+package versionManager
+
+import (
+	"log"
+	"myDB/dataManager"
+)
+
+// 整理(vacuum)
+// 在独立的事物中获取表锁之后整理表所在的表空间(见dataManager/vacuum.go)
+// 修改过该表的事物在结束之前一直持有表锁, 获取表锁之后所有失效的DataItem都来自已经结束的事物:
+// 1. 仍在清理队列中的: 提交时仍然活跃的事物或者时间旅行查询可能访问, 留给purge按horizon清理
+// 2. 其他的: 回滚的插入或者迁移(任何事物都不可见), 已经被claim的(已经满足horizon), 以及VM启动之前提交的(启动之后开始的事物以及AS OF查询都不会访问)
+// 因此只清理不在清理队列中的失效DataItem; 整理期间该表的写入等待
+
+// pending 表tbUid在清理队列中的DataItem
+func (q *purgeQueue) pending(tbUid int64) map[int64]struct{} {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	ret := make(map[int64]struct{})
+	if p := q.partitions[tbUid]; p != nil {
+		for _, entry := range p.entries {
+			for _, uid := range entry.uids {
+				ret[uid] = struct{}{}
+			}
+		}
+	}
+	return ret
+}
+
+// Vacuum
+// 整理表tbUid所在的表空间space, 系统表空间由多个表共享, 不整理
+func (v *VmImpl) Vacuum(tbUid, space int64) (dataManager.VacuumStats, error) {
+	if space == dataManager.SystemSpace {
+		return dataManager.VacuumStats{}, nil
+	}
+	xid := v.Begin()
+	v.lock.Lock()
+	v.activeTrans[xid].purge = true
+	v.lock.Unlock()
+	if err := v.LockTable(xid, tbUid); err != nil {
+		v.Abort(xid)
+		return dataManager.VacuumStats{}, err
+	}
+	// 提交在持有v的锁时释放表锁并加入清理队列, 获取v的锁之后读取的队列包括所有已经结束的事物
+	v.lock.RLock()
+	pending := v.purge.pending(tbUid)
+	v.lock.RUnlock()
+	stats, err := v.dm.Vacuum(xid, space, func(uid int64) bool {
+		_, ext := pending[uid]
+		return !ext
+	})
+	v.Commit(xid)
+	if err == nil {
+		log.Printf("[Version Manager] Vacuum table %d, %d items, %d bytes in %d pages\n", tbUid, stats.Items, stats.Bytes, stats.Compacted)
+	}
+	return stats, err
+}
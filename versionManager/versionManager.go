@@ -3,10 +3,14 @@ package versionManager
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"myDB/dataManager"
+	"myDB/dbError"
+	"myDB/simulation"
 	"myDB/transactions"
 	"sync"
+	"time"
 )
 
 // VersionManager
@@ -17,15 +21,69 @@ import (
 
 type VersionManager interface {
 	Read(xid, uid int64) Record
-	ReadForUpdate(xid, uid, tbUid int64) (Record, error)         // ReadForUpdate 当前读
-	Update(xid, uid, tbUid int64, newData []byte) (int64, error) // Update 更新 返回更新后的uid
-	Insert(xid int64, data []byte, tbUid int64) (int64, error)   // Insert 返回插入位置(uid)
+	ReadIn(xid, uid int64, guard dataManager.ReadGuard) Record // ReadIn 零拷贝快照读, Record在guard.Done之前有效
+	NewReadGuard() dataManager.ReadGuard
+	ReadForUpdate(xid, uid, tbUid int64) (Record, error)                // ReadForUpdate 当前读
+	Update(xid, uid, tbUid int64, newData []byte) (int64, error)        // Update 更新 返回更新后的uid
+	Relocate(xid, uid, tbUid int64) (int64, error)                      // Relocate 将记录迁移到同一表空间的其他页 返回新的uid
+	Insert(xid int64, data []byte, tbUid int64) (int64, error)          // Insert 返回插入位置(uid)
+	InsertIn(xid int64, data []byte, tbUid, space int64) (int64, error) // InsertIn 插入到指定表空间
 	Delete(xid, uid, tbUid int64) error
-	CreateReadView(xid int64) *ReadView // 创建读视图
+	InsertPacked(xid int64, data []byte, tbUid, space int64) (int64, error)    // 同InsertIn, 忽略填充因子(批量导入)
+	InsertBatch(xid int64, data [][]byte, tbUid, space int64) ([]int64, error) // 同InsertPacked, 一批记录一次写入, 见bulkLoad.go
+	Rewrite(xid, uid, tbUid int64, newData []byte) error                       // 原地改写本事物插入的记录, 见bulkLoad.go
+	InsertRedoOnly(xid int64, data []byte, space int64) (int64, error)         // 只记录redo log的插入, 不加锁, 回滚时不撤销, 见redoOnly.go
+	UpdateRedoOnly(xid, uid int64, newData []byte) error                       // 只记录redo log的原地更新, 长度不变
+	LockTable(xid, tbUid int64) error                                          // 获取表锁(不读取数据), 直到事物结束
+	CreateReadView(xid int64) *ReadView                                        // 创建读视图
+	ReadWithView(xid, uid int64, rv *ReadView) Record                          // 使用读视图rv快照读(游标), 见cursor.go
+	BeginAsOf(xid int64, at time.Time) error                                   // 之后的快照读使用at时刻的读视图(时间旅行查询)
+	EndAsOf(xid int64)                                                         // 结束时间旅行查询
+	SetRetention(retention time.Duration)                                      // 时间旅行查询的保留时间
+	SetPurgeWorkers(workers int)                                               // 清理失效DataItem的并行度, 见purge.go
+
+	CreateSpace() (int64, error)                  // 创建表空间
+	ExportSpace(space int64, dst string) error    // 导出表空间数据文件
+	AttachSpace(src string) (int64, error)        // 挂载外部表空间数据文件
+	SetChecksum(space int64, on bool) error       // 表空间中之后写入的数据是否带校验和
+	SetFillFactor(space int64, percent int) error // 表空间之后插入时的填充因子
+	SetUnlogged(space int64) error                // 表空间之后的修改不记录redo log, 崩溃之后清空
+	TakeTruncated() []int64                       // 取走启动时清空的不记录日志的表空间
+	// ReclaimPages 回收space中reachable之外的孤儿页, 调用方保证没有其他事物访问该表空间
+	ReclaimPages(xid, space int64, reachable map[int64]struct{}, dryRun bool) []int64
+	PageEvents(space int64, top int) (dataManager.SpaceEvents, error) // 页事件统计以及事件最多的top个页
+	SpaceSize(space int64) (dataManager.SpaceSize, error)             // 表空间的磁盘占用
+	// OffloadCold 将表空间中idle时间内没有访问的区迁移到二级目录dir
+	OffloadCold(space int64, dir string, idle time.Duration) (dataManager.TierStats, error)
+	// CompressCold 压缩表空间中idle时间内没有访问的区
+	CompressCold(space int64, idle time.Duration) (dataManager.CompressStats, error)
+	// Backup 备份到dir, base为基准备份的目录(为空时全量备份), undo log在redo log之后拷贝
+	Backup(dir, base string) (dataManager.BackupStats, error)
+	BackupTo(w io.Writer) (dataManager.BackupStats, error) // 流式在线备份, 用dataManager.RestoreStream恢复
+	Scrub(all bool) (dataManager.ScrubStats, error)
+	// SampleRecords 块采样, 选中的页上对xid可见的记录依次调用fn, 见sample.go
+	SampleRecords(xid, space int64, percent int, seed int64, fn func(uid int64, data []byte)) (dataManager.PageSample, error)
+	// Vacuum 在独立的事物中整理表所在的表空间, 回收不在清理队列中的失效DataItem, 见vacuum.go
+	Vacuum(tbUid, space int64) (dataManager.VacuumStats, error)
+
+	BeginBatch(xid int64) // 批量模式, xid的undo/redo log不再逐条刷盘
+	EndBatch(xid int64)   // 结束批量模式, 统一刷盘
 
 	Begin() int64
+	BeginWith(opts TransactionOptions) int64 // 以指定的隔离级别以及锁等待超时开启事物
 	Commit(xid int64)
 	Abort(xid int64)
+
+	Status() VmStatus                        // 运行状态
+	ReportReplica(name string, lsn int64)    // 记录副本已经应用到的redo log LSN
+	CheckHealth(timeout time.Duration) error // 存储层的健康检查
+	Close()                                  // 停止清理并关闭DataManager, 调用方保证没有活跃的事物
+
+	AddRows(xid, read, written int64)                     // 累计xid当前语句读写的行数
+	BeginStatement(xid int64)                             // 开始一条新语句, 读已提交时创建语句的读视图, 见statementView.go
+	EndStatement(xid int64) (ExecStats, ExecStats, bool)  // 结束当前语句, 返回语句以及事物的执行统计
+	SetStatementTimeout(xid int64, timeout time.Duration) // 当前语句的最长执行时间, 见timeout.go
+	CheckStatement(xid int64) error                       // 当前语句超时则回滚事物并返回ErrorStatementTimeout
 }
 
 type VmImpl struct {
@@ -38,6 +96,8 @@ type VmImpl struct {
 	lt             LockTable
 	lock           *sync.RWMutex
 	isolationLevel IsolationLevel
+	history        commitHistory // 最近提交的事物, 用于时间旅行查询
+	purge          *purgeQueue   // 提交之后失效的DataItem, 见purge.go
 }
 
 const (
@@ -56,9 +116,8 @@ func (v *VmImpl) Read(xid, uid int64) Record {
 		if transaction == nil {
 			panic("Error occurs when getting transaction struct, it is not an active transaction")
 		}
-		if transaction.level == ReadCommitted {
-			transaction.rv = v.CreateReadView(xid)
-		}
+		v.refreshReadView(transaction)
+		transaction.stats.touch(uid)
 	}
 	di := v.dm.ReadSnapShot(uid) // DataItem
 	if di == nil {
@@ -66,6 +125,31 @@ func (v *VmImpl) Read(xid, uid int64) Record {
 	}
 	snapShot := DefaultRecordFactory.NewSnapShot(di.GetData(), v.undo)
 	di.Release()
+	return v.visibleVersion(xid, snapShot)
+}
+
+// ReadIn
+// 快照读, 最新版本的数据直接引用guard中的页(不拷贝), 旧版本从undo log中读取
+// 可能返回nil
+func (v *VmImpl) ReadIn(xid, uid int64, guard dataManager.ReadGuard) Record {
+	if xid != transactions.SuperXID {
+		transaction := v.getTransaction(xid)
+		if transaction == nil {
+			panic("Error occurs when getting transaction struct, it is not an active transaction")
+		}
+		v.refreshReadView(transaction)
+		transaction.stats.touch(uid)
+	}
+	data, _ := guard.Read(uid)
+	return v.visibleVersion(xid, DefaultRecordFactory.NewSnapShot(data, v.undo))
+}
+
+func (v *VmImpl) NewReadGuard() dataManager.ReadGuard {
+	return v.dm.NewReadGuard()
+}
+
+// visibleVersion 沿版本链找到对xid可见的版本
+func (v *VmImpl) visibleVersion(xid int64, snapShot Record) Record {
 	// 超级事物读取的
 	if xid == transactions.SuperXID {
 		return snapShot
@@ -73,7 +157,7 @@ func (v *VmImpl) Read(xid, uid int64) Record {
 	for snapShot != nil && !v.checkMvccValid(snapShot, xid) {
 		snapShot = snapShot.GetPrevious()
 	}
-	if snapShot == nil && !snapShot.IsValid() {
+	if snapShot == nil {
 		return nil
 	}
 	return snapShot
@@ -90,6 +174,7 @@ func (v *VmImpl) ReadForUpdate(xid, uid, tbUid int64) (Record, error) {
 	if err := v.tryToLockTable(xid, tbUid); err != nil {
 		return nil, err
 	}
+	transaction.stats.touch(uid)
 	di := v.dm.Read(uid)
 	if di == nil {
 		return nil, nil
@@ -114,34 +199,89 @@ func (v *VmImpl) Update(xid, uid, tbUid int64, newData []byte) (int64, error) {
 			panic("Error occurs when updating records, it is an invalid record")
 		}
 		// undoLog
-		rollback := v.undo.Log(record.GetRaw())
+		rollback := v.undo.Log(record.GetRaw(), !tran.batch)
+		tran.stats.addLogBytes(SzUndoData + int64(len(record.GetRaw())))
 		newRecordRaw := WrapRecordRaw(true, newData, xid, rollback)
-		newUid := v.dm.Update(xid, uid, newRecordRaw)
+		newUid, err := v.dm.Update(xid, uid, newRecordRaw)
+		if err != nil {
+			return -1, err
+		}
+		tran.stats.touch(newUid)
 		tran.AddUpdate(uid, newUid, record.GetRaw(), newRecordRaw)
+		if newUid != uid {
+			tran.addGarbage(tbUid, uid)
+		}
 		return newUid, err
 	}
 }
 
+// Relocate
+// 将uid处的记录原样(版本信息不变)迁移到同一表空间的其他页, 返回新的uid
+// 旧的DataItem改写为转发桩, 持有旧指针的快照读仍然可以读出数据; 回滚时与迁移的Update相同(新的失效, 旧的恢复)
+func (v *VmImpl) Relocate(xid, uid, tbUid int64) (int64, error) {
+	tran := v.getTransaction(xid) // check valid
+	if tran == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	record, err := v.ReadForUpdate(xid, uid, tbUid)
+	if err != nil {
+		return -1, err
+	}
+	if record == nil {
+		panic("Error occurs when relocating records, it is an invalid record")
+	}
+	raw := record.GetRaw()
+	newUid, err := v.dm.InsertAvoid(xid, dataManager.SpaceOf(uid), raw, dataManager.PageOf(uid))
+	if err != nil {
+		return -1, err
+	}
+	v.dm.Forward(xid, uid, newUid)
+	tran.stats.touch(newUid)
+	tran.AddUpdate(uid, newUid, raw, raw)
+	tran.addGarbage(tbUid, uid)
+	return newUid, nil
+}
+
 // Insert
 // 向DataManager插入数据
 // 可以插入元数据（插入表Table信息），也可以插入（索引，数据，字段信息），后者要先获取表锁
 // 当插入元数据时，tbUid == -1
 // 返回DataItem的uid
 func (v *VmImpl) Insert(xid int64, data []byte, tbUid int64) (int64, error) {
+	return v.InsertIn(xid, data, tbUid, dataManager.SystemSpace)
+}
+
+// InsertIn
+// 同Insert, 数据插入到space表空间
+func (v *VmImpl) InsertIn(xid int64, data []byte, tbUid, space int64) (int64, error) {
+	return v.insertIn(xid, data, tbUid, space, false)
+}
+
+// insertIn packed时忽略表空间的填充因子
+func (v *VmImpl) insertIn(xid int64, data []byte, tbUid, space int64, packed bool) (int64, error) {
 	tran := v.getTransaction(xid) // check valid
 	if tran == nil {
 		panic("Error occurs when getting transaction struct, it is not an active transaction")
 	}
 	// metaData, 不需要获得锁，直接插入, 但是在插入结束后，xid会直接获得这个uid的锁
+	// 元数据的插入同样记录在事物中, 回滚时失效
 	raw := WrapRecordRaw(true, data, xid, 0)
-	if tbUid == MetaDataTbUid {
-		uid := v.dm.Insert(xid, raw)
-		return uid, nil
+	if tbUid != MetaDataTbUid {
+		if err := v.tryToLockTable(xid, tbUid); err != nil {
+			return -1, err
+		}
 	}
-	if err := v.tryToLockTable(xid, tbUid); err != nil {
+	var uid int64
+	var err error
+	if packed {
+		uid, err = v.dm.InsertPacked(xid, space, raw)
+	} else {
+		uid, err = v.dm.InsertIn(xid, space, raw)
+	}
+	if err != nil {
 		return -1, err
 	}
-	uid := v.dm.Insert(xid, raw)
+	tran.stats.touch(uid)
 	tran.AddInsert(uid)
 	// 插入的是表元数据，xid获得uid的锁, must success
 	if tbUid == MetaDataTbUid {
@@ -150,6 +290,95 @@ func (v *VmImpl) Insert(xid int64, data []byte, tbUid int64) (int64, error) {
 	return uid, nil
 }
 
+// BeginBatch
+// 批量执行时由上层开启, 事物的日志只在EndBatch时刷盘一次
+// 事物提交或回滚时会自动结束批量模式
+func (v *VmImpl) BeginBatch(xid int64) {
+	tran := v.getTransaction(xid)
+	if tran == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	tran.batch = true
+	v.dm.BeginBatch(xid)
+}
+
+func (v *VmImpl) EndBatch(xid int64) {
+	if tran := v.getTransaction(xid); tran != nil {
+		v.endBatch(xid, tran)
+	}
+}
+
+func (v *VmImpl) endBatch(xid int64, tran *Transaction) {
+	if !tran.batch {
+		return
+	}
+	tran.batch = false
+	v.undo.Sync()
+	v.dm.EndBatch(xid)
+}
+
+func (v *VmImpl) CreateSpace() (int64, error) {
+	return v.dm.CreateSpace()
+}
+
+func (v *VmImpl) ExportSpace(space int64, dst string) error {
+	return v.dm.ExportSpace(space, dst)
+}
+
+func (v *VmImpl) AttachSpace(src string) (int64, error) {
+	return v.dm.AttachSpace(src)
+}
+
+func (v *VmImpl) SetChecksum(space int64, on bool) error {
+	return v.dm.SetChecksum(space, on)
+}
+
+func (v *VmImpl) SetFillFactor(space int64, percent int) error {
+	return v.dm.SetFillFactor(space, percent)
+}
+
+func (v *VmImpl) SetUnlogged(space int64) error {
+	return v.dm.SetUnlogged(space)
+}
+
+func (v *VmImpl) TakeTruncated() []int64 {
+	return v.dm.TakeTruncated()
+}
+
+func (v *VmImpl) PageEvents(space int64, top int) (dataManager.SpaceEvents, error) {
+	return v.dm.PageEvents(space, top)
+}
+
+func (v *VmImpl) SpaceSize(space int64) (dataManager.SpaceSize, error) {
+	return v.dm.SpaceSize(space)
+}
+
+func (v *VmImpl) OffloadCold(space int64, dir string, idle time.Duration) (dataManager.TierStats, error) {
+	return v.dm.OffloadCold(space, dir, idle)
+}
+
+func (v *VmImpl) CompressCold(space int64, idle time.Duration) (dataManager.CompressStats, error) {
+	return v.dm.CompressCold(space, idle)
+}
+
+func (v *VmImpl) Backup(dir, base string) (dataManager.BackupStats, error) {
+	v.undo.Sync()
+	return v.dm.Backup(dir, base, []string{v.undo.File()})
+}
+
+func (v *VmImpl) BackupTo(w io.Writer) (dataManager.BackupStats, error) {
+	v.undo.Sync()
+	return v.dm.BackupTo(w, []string{v.undo.File()})
+}
+
+func (v *VmImpl) Scrub(all bool) (dataManager.ScrubStats, error) {
+	return v.dm.Scrub(all)
+}
+
+func (v *VmImpl) ReclaimPages(xid, space int64, reachable map[int64]struct{}, dryRun bool) []int64 {
+	return v.dm.ReclaimPages(xid, space, reachable, dryRun)
+}
+
 // Delete
 // 删除一条记录
 // 2步： step1 -> 当前读出record, 将record调用dm.update为invalid step2 -> 调用dm层的Delete方法将uid所在dataItem置为invalid
@@ -164,21 +393,40 @@ func (v *VmImpl) Delete(xid, uid, tbUid int64) error {
 		return err
 	}
 	// undoLog
-	rollback := v.undo.Log(record.GetRaw())
+	rollback := v.undo.Log(record.GetRaw(), !tran.batch)
+	tran.stats.addLogBytes(SzUndoData + int64(len(record.GetRaw())))
 	newRecordRaw := WrapRecordRaw(false, record.GetData(), xid, rollback)
-	newUid := v.dm.Update(xid, uid, newRecordRaw) // newUid == uid
+	newUid, err := v.dm.Update(xid, uid, newRecordRaw) // newUid == uid
+	if err != nil {
+		return err
+	}
 	if newUid != uid {
 		panic("Fatal error when updating records")
 	}
 	tran.AddUpdate(uid, newUid, record.GetRaw(), newRecordRaw)
 	v.dm.Delete(xid, uid)
 	tran.AddDelete(uid)
+	tran.addGarbage(tbUid, uid)
 	return nil
 }
 
+// LockTable
+// 获取tbUid的锁, 直到事物结束
+func (v *VmImpl) LockTable(xid, tbUid int64) error {
+	if tran := v.getTransaction(xid); tran == nil {
+		panic("Error occurs when getting transaction struct, it is not an active transaction")
+	}
+	return v.tryToLockTable(xid, tbUid)
+}
+
 func (v *VmImpl) CreateReadView(xid int64) *ReadView {
 	v.lock.RLock()
 	defer v.lock.RUnlock()
+	return v.readView(xid)
+}
+
+// readView 必须持有v的锁
+func (v *VmImpl) readView(xid int64) *ReadView {
 	var active []int64
 	for xid := range v.activeTrans {
 		active = append(active, xid)
@@ -192,16 +440,27 @@ func (v *VmImpl) CreateReadView(xid int64) *ReadView {
 }
 
 // Begin
-// 开启一个新的事物
+// 开启一个新的事物, 使用默认的隔离级别
 func (v *VmImpl) Begin() int64 {
+	return v.BeginWith(TransactionOptions{Level: v.isolationLevel})
+}
+
+// BeginWith
+// 以opts开启一个新的事物
+func (v *VmImpl) BeginWith(opts TransactionOptions) int64 {
 	v.lock.Lock()
 	defer v.lock.Unlock()
 	xid := v.tm.Begin()
-	trans := NewTransaction(xid, v.isolationLevel, v)
+	trans := NewTransaction(xid, opts.Level)
+	trans.lockTimeout = opts.LockTimeout
 	if xid+1 > v.nextXid {
 		v.nextXid = xid + 1
 	}
 	v.activeTrans[xid] = trans
+	if trans.level == ReadRepeatable {
+		// 生成ReadView, 已经持有v的锁
+		trans.rv = v.readView(xid)
+	}
 	return xid
 }
 
@@ -210,13 +469,19 @@ func (v *VmImpl) Begin() int64 {
 // 释放该事物持有的所有锁
 // 更新vm状态
 func (v *VmImpl) Commit(xid int64) {
+	simulation.Yield("vm.commit")
 	tran := v.getTransaction(xid)
 	if tran == nil {
 		return
 	}
+	v.endBatch(xid, tran)
 	v.lock.Lock()
 	defer v.lock.Unlock()
 	v.endTransaction(xid, tran)
+	now := simulation.Now()
+	v.history.commit(xid, now)
+	v.purge.enqueue(tran.garbage, v.nextXid, now)
+	v.purge.wake(v)
 	// tm
 	v.tm.Commit(xid)
 }
@@ -227,10 +492,12 @@ func (v *VmImpl) Commit(xid int64) {
 // 释放该事物持有的所有锁
 // 更新vm状态
 func (v *VmImpl) Abort(xid int64) {
+	simulation.Yield("vm.abort")
 	tran := v.getTransaction(xid)
 	if tran == nil {
 		return
 	}
+	v.endBatch(xid, tran)
 	v.lock.Lock()
 	defer v.lock.Unlock()
 	n := len(tran.action)
@@ -240,11 +507,11 @@ func (v *VmImpl) Abort(xid int64) {
 			{
 				if tran.action[i].newUid == tran.action[i].oldUid {
 					// newUid == oldUid 原地修改
-					_ = v.dm.Update(xid, tran.action[i].oldUid, tran.action[i].oldRaw)
+					_, _ = v.dm.Update(xid, tran.action[i].oldUid, tran.action[i].oldRaw)
 				} else {
-					// newUid != oldUid 让新的失效，旧的重新valid
+					// newUid != oldUid 让新的失效，旧的(转发桩)恢复
 					v.dm.Delete(xid, tran.action[i].newUid)
-					v.dm.Recover(xid, tran.action[i].oldUid)
+					v.dm.Unforward(xid, tran.action[i].oldUid, tran.action[i].oldRaw)
 				}
 			}
 		case DELETE:
@@ -260,6 +527,7 @@ func (v *VmImpl) Abort(xid int64) {
 		}
 	}
 	v.endTransaction(xid, tran)
+	v.purge.wake(v)
 	// tm
 	v.tm.Abort(xid)
 }
@@ -281,12 +549,20 @@ func (v *VmImpl) checkMvccValid(record Record, xid int64) bool {
 	}
 	readView := transaction.rv
 	recordXid := record.GetXid()
-	// 自己创建的
-	if recordXid == xid {
+	if transaction.asOf != nil {
+		// 时间旅行查询, 自己的修改同样不可见
+		readView = transaction.asOf
+	} else if recordXid == xid {
+		// 自己创建的
 		return true
 	}
+	return v.visibleIn(recordXid, readView)
+}
+
+// visibleIn recordXid写入的版本对读视图readView是否可见
+func (v *VmImpl) visibleIn(recordXid int64, readView *ReadView) bool {
 	if recordXid < readView.minXid {
-		return true
+		return v.committed(recordXid)
 	}
 	if recordXid >= readView.maxXid {
 		return false
@@ -296,7 +572,12 @@ func (v *VmImpl) checkMvccValid(record Record, xid int64) bool {
 			return false
 		}
 	}
-	return true
+	return v.committed(recordXid)
+}
+
+// committed 读视图之外的事物已经结束, 回滚(或者崩溃时未提交)的事物写入的版本不可见
+func (v *VmImpl) committed(xid int64) bool {
+	return v.tm.Status(xid) == transactions.COMMITTED
 }
 
 // tryToLockTable
@@ -305,12 +586,13 @@ func (v *VmImpl) checkMvccValid(record Record, xid int64) bool {
 func (v *VmImpl) tryToLockTable(xid, tbUid int64) error {
 	tryTime := 0 // 尝试获取锁的次数
 	var lastOwner int64 = -1
+	var waitStart time.Time // 第一次加锁失败的时间
 	for true {
 		// 成功获取表锁
 		locked, last, err := v.lt.AddLock(xid, tbUid, lastOwner)
 		if err != nil {
 			// 死锁，回滚
-			if errors.Is(err, &DeadLockError{}) {
+			if errors.Is(err, dbError.ErrDeadlock) {
 				v.Abort(xid)
 				return err
 			} else {
@@ -319,36 +601,69 @@ func (v *VmImpl) tryToLockTable(xid, tbUid int64) error {
 		}
 		// 加锁成功
 		if locked {
+			if tran := v.getTransaction(xid); tran != nil && !waitStart.IsZero() {
+				tran.stats.addLockWait(simulation.Now().Sub(waitStart))
+			}
 			break
 		}
+		if waitStart.IsZero() {
+			waitStart = simulation.Now()
+		}
+		if v.statementExpired(xid) {
+			// 语句超时, 回滚
+			v.lt.cancelWait(xid, last)
+			v.Abort(xid)
+			return &ErrorStatementTimeout{}
+		}
+		timeout := v.lockTimeout(xid)
+		if timeout > 0 && simulation.Now().Sub(waitStart) >= timeout {
+			// 等待超时, 回滚
+			v.lt.cancelWait(xid, last)
+			v.Abort(xid)
+			return &ErrorLockTimeout{}
+		}
 		lastOwner = last
 		tryTime += 1
-		if tryTime == MaxTryLockCount {
-			v.parkOnChannel(lastOwner)
+		simulation.Yield("vm.lock")
+		// 模拟模式下只在yield点等待, 保证调度确定
+		if tryTime == MaxTryLockCount && !simulation.Enabled() {
+			v.parkOnChannel(lastOwner, v.statementLimit(xid, timeout))
 		}
 	}
 	return nil
 }
 
 // parkOnChannel
-// 在transaction上的channel阻塞
-func (v *VmImpl) parkOnChannel(wait int64) {
+// 在transaction上的channel阻塞, timeout > 0 时最多等待timeout
+func (v *VmImpl) parkOnChannel(wait int64, timeout time.Duration) {
 	if tran := v.getTransaction(wait); tran != nil {
 		// wait依旧活跃
+		if timeout <= 0 {
+			<-tran.waiting
+			return
+		}
 		select {
 		case <-tran.waiting:
-			{
-			}
+		case <-time.After(timeout):
 		}
 	}
 }
 
+// lockTimeout 事物等待表锁的最长时间, 0表示不限制
+func (v *VmImpl) lockTimeout(xid int64) time.Duration {
+	if tran := v.getTransaction(xid); tran != nil {
+		return tran.lockTimeout
+	}
+	return 0
+}
+
 // endTransaction
 // 结束事物
 // 必须获取v的锁
 func (v *VmImpl) endTransaction(xid int64, tran *Transaction) {
 	v.lt.RemoveLock(xid)
 	delete(v.activeTrans, xid)
+	v.dm.TakeLogBytes(xid) // 丢弃没有被EndStatement取走的日志统计
 	v.changeMinXid(xid)
 	// wake up
 	close(tran.waiting)
@@ -368,15 +683,32 @@ func (v *VmImpl) changeMinXid(xid int64) {
 	}
 }
 
-func NewVersionManager(path string, memory int64, lock *sync.RWMutex, isolationLevel IsolationLevel) VersionManager {
+// NewVersionManager opts为打开DataManager的选项, 打开失败时panic
+func NewVersionManager(path string, memory, maxSize int64, lock *sync.RWMutex, isolationLevel IsolationLevel, opts ...dataManager.Option) VersionManager {
+	vm, err := OpenVersionManager(path, memory, maxSize, lock, isolationLevel, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return vm
+}
+
+// OpenVersionManager 同NewVersionManager, DataManager打开失败(见dataManager.Open)时返回错误
+func OpenVersionManager(path string, memory, maxSize int64, lock *sync.RWMutex, isolationLevel IsolationLevel, opts ...dataManager.Option) (VersionManager, error) {
 	tm := transactions.NewTransactionManagerImpl(path)
-	dm := dataManager.OpenDataManager(path, memory, tm)
+	dm, err := dataManager.Open(path, memory, maxSize, tm, opts...)
+	if err != nil {
+		tm.Close()
+		return nil, err
+	}
 	undo := OpenUndoLog(path, &sync.Mutex{})
 	lt := NewLockTable()
 	log.Printf("[Version Manager] Initialze version manager\n")
 	return &VmImpl{
 		dm: dm, tm: tm, undo: undo, lock: lock,
-		activeTrans: map[int64]*Transaction{},
-		lt:          lt,
-	}
+		isolationLevel: isolationLevel,
+		activeTrans:    map[int64]*Transaction{},
+		lt:             lt,
+		history:        newCommitHistory(DefaultTimeTravelRetention),
+		purge:          newPurgeQueue(),
+	}, nil
 }